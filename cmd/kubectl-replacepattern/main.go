@@ -0,0 +1,228 @@
+// Command kubectl-replacepattern is a kubectl plugin applying a bundle of
+// replace-pattern rules to objects read from the cluster or from files, and
+// printing or applying the result:
+//
+//	kubectl replacepattern deploy web -n shop --bundle 2024.05
+//	kubectl replacepattern -f manifests.yaml --rules rules.yaml --apply
+//	kubectl replacepattern --validate --rules rules.yaml
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/sirupsen/logrus"
+	"github.com/wrkt/velero-custom-plugins/internal/kubectl"
+	"github.com/wrkt/velero-custom-plugins/pkg/transform"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/restmapper"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+type options struct {
+	kubeconfig     string
+	context        string
+	namespace      string
+	allNamespaces  bool
+	filename       string
+	selector       string
+	rulesFile      string
+	rulesNamespace string
+	bundle         string
+	output         string
+	apply          bool
+	dryRun         bool
+	validate       bool
+}
+
+func main() {
+	var opts options
+	flags := flag.NewFlagSet("kubectl-replacepattern", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "usage: kubectl replacepattern (TYPE [NAME...] | -f FILE | --validate) [flags]\n")
+		flags.PrintDefaults()
+	}
+	flags.StringVar(&opts.kubeconfig, "kubeconfig", "", "path to the kubeconfig file")
+	flags.StringVar(&opts.context, "context", "", "kubeconfig context to use")
+	flags.StringVar(&opts.namespace, "namespace", "", "namespace of the objects, the one of the context by default")
+	flags.StringVar(&opts.namespace, "n", "", "shorthand for --namespace")
+	flags.BoolVar(&opts.allNamespaces, "all-namespaces", false, "read the objects of all namespaces")
+	flags.BoolVar(&opts.allNamespaces, "A", false, "shorthand for --all-namespaces")
+	flags.StringVar(&opts.filename, "filename", "", "file to read the objects from instead of the cluster, - for stdin")
+	flags.StringVar(&opts.filename, "f", "", "shorthand for --filename")
+	flags.StringVar(&opts.selector, "selector", "", "label selector of the objects")
+	flags.StringVar(&opts.selector, "l", "", "shorthand for --selector")
+	flags.StringVar(&opts.rulesFile, "rules", "", "file holding the rule ConfigMaps, instead of the cluster's")
+	flags.StringVar(&opts.rulesNamespace, "rules-namespace", "velero", "namespace of the rule ConfigMaps in the cluster")
+	flags.StringVar(&opts.bundle, "bundle", "", "version of the rule bundle to apply, from the "+transform.BundleAnnotation+" annotation")
+	flags.StringVar(&opts.output, "output", kubectl.OutputYAML, "output format: yaml or json")
+	flags.StringVar(&opts.output, "o", kubectl.OutputYAML, "shorthand for --output")
+	flags.BoolVar(&opts.apply, "apply", false, "apply the transformed objects with server-side apply instead of printing them")
+	flags.BoolVar(&opts.dryRun, "dry-run", false, "with --apply, only validate the objects on the server")
+	flags.BoolVar(&opts.validate, "validate", false, "only check the rule ConfigMaps, reporting those the plugin would ignore")
+	args := parseInterspersed(flags, os.Args[1:])
+
+	logger := logrus.New()
+	logger.SetOutput(os.Stderr)
+
+	if !opts.validate && (opts.filename == "") == (len(args) == 0) {
+		flags.Usage()
+		os.Exit(2)
+	}
+	if err := run(context.Background(), opts, args, os.Stdout, logger); err != nil {
+		logger.Fatal(err)
+	}
+}
+
+// parseInterspersed parses the flags wherever they appear, as kubectl does,
+// and returns the other arguments.
+func parseInterspersed(flags *flag.FlagSet, args []string) []string {
+	var positional []string
+	for {
+		flags.Parse(args)
+		if flags.NArg() == 0 {
+			return positional
+		}
+		positional = append(positional, flags.Arg(0))
+		args = flags.Args()[1:]
+	}
+}
+
+func run(ctx context.Context, opts options, args []string, out io.Writer, logger logrus.FieldLogger) error {
+	loading := clientcmd.NewDefaultClientConfigLoadingRules()
+	loading.ExplicitPath = opts.kubeconfig
+	clientConfig := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(loading, &clientcmd.ConfigOverrides{CurrentContext: opts.context})
+	if opts.namespace == "" {
+		namespace, _, err := clientConfig.Namespace()
+		if err != nil {
+			return fmt.Errorf("failed to read kubeconfig: %v", err)
+		}
+		opts.namespace = namespace
+	}
+
+	// the cluster is only needed to read objects or rules, or to apply
+	var clientset *kubernetes.Clientset
+	var cluster *kubectl.Cluster
+	if opts.rulesFile == "" || (!opts.validate && (opts.filename == "" || opts.apply)) {
+		config, err := clientConfig.ClientConfig()
+		if err != nil {
+			return fmt.Errorf("failed to read kubeconfig: %v", err)
+		}
+		if clientset, err = kubernetes.NewForConfig(config); err != nil {
+			return fmt.Errorf("failed to create clientset: %v", err)
+		}
+		client, err := dynamic.NewForConfig(config)
+		if err != nil {
+			return fmt.Errorf("failed to create dynamic client: %v", err)
+		}
+		groups, err := restmapper.GetAPIGroupResources(clientset.Discovery())
+		if err != nil {
+			return fmt.Errorf("failed to discover resources: %v", err)
+		}
+		mapper := restmapper.NewShortcutExpander(restmapper.NewDiscoveryRESTMapper(groups), clientset.Discovery())
+		cluster = &kubectl.Cluster{Client: client, Mapper: mapper, Namespace: opts.namespace}
+	}
+
+	rules, err := loadRules(ctx, opts, clientset)
+	if err != nil {
+		return err
+	}
+	if opts.validate {
+		return validate(rules, out)
+	}
+	chainOpts := transform.Options{SkipOrigin: true, Logger: logger}
+	if clientset != nil {
+		chainOpts.Discovery = clientset.Discovery()
+	}
+	chain, err := transform.New(rules, chainOpts)
+	if err != nil {
+		return err
+	}
+
+	var objects []*unstructured.Unstructured
+	if opts.filename != "" {
+		objects, err = readFile(opts.filename)
+	} else {
+		objects, err = cluster.Get(ctx, kubectl.Query{
+			Resource:      args[0],
+			Names:         args[1:],
+			Namespace:     opts.namespace,
+			AllNamespaces: opts.allNamespaces,
+			Selector:      opts.selector,
+		})
+	}
+	if err != nil {
+		return err
+	}
+
+	transformed, err := kubectl.Transform(chain, objects, logger)
+	if err != nil {
+		return err
+	}
+	if !opts.apply {
+		return kubectl.Write(out, transformed, opts.output)
+	}
+	for _, object := range transformed {
+		if err := cluster.Apply(ctx, object, opts.dryRun); err != nil {
+			return err
+		}
+		logger.Infof("Applied %s %s/%s", object.GetKind(), object.GetNamespace(), object.GetName())
+	}
+	return nil
+}
+
+// validate reports the invalid rule ConfigMaps, and fails when there is any.
+func validate(rules []corev1.ConfigMap, out io.Writer) error {
+	errs := transform.Validate(rules)
+	for _, err := range errs {
+		fmt.Fprintln(out, err)
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("%d invalid rules", len(errs))
+	}
+	fmt.Fprintf(out, "%d rule ConfigMaps are valid\n", len(rules))
+	return nil
+}
+
+// loadRules reads the rules from --rules, or else from the cluster, and keeps
+// those of --bundle.
+func loadRules(ctx context.Context, opts options, clientset *kubernetes.Clientset) ([]corev1.ConfigMap, error) {
+	var rules []corev1.ConfigMap
+	if opts.rulesFile != "" {
+		file, err := os.Open(opts.rulesFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open rules: %v", err)
+		}
+		defer file.Close()
+		if rules, err = transform.LoadRules(file); err != nil {
+			return nil, err
+		}
+	} else {
+		var err error
+		if rules, err = transform.ListRules(ctx, clientset.CoreV1(), opts.rulesNamespace); err != nil {
+			return nil, err
+		}
+	}
+	if opts.bundle == "" {
+		return rules, nil
+	}
+	return transform.SelectBundle(rules, opts.bundle)
+}
+
+func readFile(name string) ([]*unstructured.Unstructured, error) {
+	if name == "-" {
+		return kubectl.ReadObjects(os.Stdin)
+	}
+	file, err := os.Open(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %v", name, err)
+	}
+	defer file.Close()
+	return kubectl.ReadObjects(file)
+}
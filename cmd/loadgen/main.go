@@ -0,0 +1,116 @@
+// Command loadgen runs synthetic restores through the transformer chain of the
+// restore plugin, in process, and reports the latency and allocations of the
+// items as JSON, to track performance from release to release:
+//
+//	loadgen -items 5000 -size 8192 -label v1.4.0 -o v1.4.0.json
+//	loadgen -rules rules.yaml -baseline v1.4.0.json
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"github.com/wrkt/velero-custom-plugins/internal/fixtures"
+	"github.com/wrkt/velero-custom-plugins/internal/loadgen"
+	"github.com/wrkt/velero-custom-plugins/internal/plugin"
+	corev1 "k8s.io/api/core/v1"
+)
+
+func main() {
+	kinds := flag.String("kinds", "", "comma-separated fixtures the items are built from, all by default: "+strings.Join(fixtures.Names(), ", "))
+	items := flag.Int("items", 1000, "number of items of the restore")
+	size := flag.Int("size", 4096, "minimum size of an item in JSON, in bytes")
+	namespaces := flag.Int("namespaces", 10, "number of namespaces the items are spread across")
+	iterations := flag.Int("iterations", 5, "number of measured passes over the items")
+	rulesFile := flag.String("rules", "", "file holding the rule ConfigMaps, generated literal rules by default")
+	patterns := flag.Int("patterns", 50, "number of patterns of the generated rules")
+	label := flag.String("label", "", "label of the report, such as the release")
+	output := flag.String("o", "-", "file to write the JSON report to, - for stdout")
+	baseline := flag.String("baseline", "", "report of a previous run to compare with, failing on regressions")
+	tolerance := flag.Float64("tolerance", 0.2, "regression tolerated over the baseline, as a fraction")
+	flag.Parse()
+
+	logger := logrus.New()
+	logger.SetOutput(os.Stderr)
+	logger.SetLevel(logrus.WarnLevel)
+
+	rules := loadgen.DefaultRules(*patterns)
+	if *rulesFile != "" {
+		file, err := os.Open(*rulesFile)
+		if err != nil {
+			logger.Fatalf("Failed to open the rules: %v", err)
+		}
+		rules, err = plugin.ReadConfigMaps(file)
+		file.Close()
+		if err != nil {
+			logger.Fatalf("Failed to read the rules: %v", err)
+		}
+	}
+
+	opts := loadgen.Options{Count: *items, Size: *size, Namespaces: *namespaces}
+	if *kinds != "" {
+		opts.Kinds = strings.Split(*kinds, ",")
+	}
+	report, err := run(rules, opts, *iterations, logger)
+	if err != nil {
+		logger.Fatal(err)
+	}
+	report.Label = *label
+	fmt.Fprint(os.Stderr, report)
+
+	out := io.Writer(os.Stdout)
+	if *output != "-" {
+		file, err := os.Create(*output)
+		if err != nil {
+			logger.Fatalf("Failed to create the report: %v", err)
+		}
+		defer file.Close()
+		out = file
+	}
+	encoder := json.NewEncoder(out)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(report); err != nil {
+		logger.Fatalf("Failed to write the report: %v", err)
+	}
+
+	if *baseline != "" {
+		previous, err := readReport(*baseline)
+		if err != nil {
+			logger.Fatal(err)
+		}
+		if regressions := loadgen.Compare(previous, report, *tolerance); len(regressions) > 0 {
+			fmt.Fprintf(os.Stderr, "regressions over %s:\n  %s\n", *baseline, strings.Join(regressions, "\n  "))
+			os.Exit(1)
+		}
+	}
+}
+
+func run(rules []corev1.ConfigMap, opts loadgen.Options, iterations int, logger logrus.FieldLogger) (loadgen.Report, error) {
+	restore := loadgen.Restore()
+	engine, err := plugin.NewEngine(rules, restore, nil, logger)
+	if err != nil {
+		return loadgen.Report{}, err
+	}
+	inputs, err := loadgen.Generate(opts, restore)
+	if err != nil {
+		return loadgen.Report{}, err
+	}
+	return loadgen.Run(engine, inputs, iterations), nil
+}
+
+func readReport(name string) (loadgen.Report, error) {
+	var report loadgen.Report
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return report, fmt.Errorf("failed to read the baseline: %v", err)
+	}
+	if err := json.Unmarshal(data, &report); err != nil {
+		return report, fmt.Errorf("failed to decode the baseline %s: %v", name, err)
+	}
+	return report, nil
+}
@@ -0,0 +1,104 @@
+// Command replace-pattern-contracts generates the contract tests of a rule
+// bundle, one case per literal pattern, and the Go test running them in CI:
+//
+//	replace-pattern-contracts -rules rules.yaml -o contracts.yaml -test contracts_test.go
+//	replace-pattern-contracts -rules rules.yaml -o contracts.yaml -check
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"os"
+	"path/filepath"
+
+	"github.com/sirupsen/logrus"
+	"github.com/wrkt/velero-custom-plugins/pkg/contract"
+	"github.com/wrkt/velero-custom-plugins/pkg/transform"
+)
+
+func main() {
+	rulesFile := flag.String("rules", "", "file holding the rule ConfigMaps")
+	casesFile := flag.String("o", "contracts.yaml", "file of the cases, whose hand-written cases are kept")
+	testFile := flag.String("test", "", "Go test file to write, running the cases")
+	pkg := flag.String("package", "contracts", "package of the Go test file")
+	check := flag.Bool("check", false, "only check the cases against the rules, failing on differences")
+	flag.Parse()
+
+	logger := logrus.New()
+	logger.SetOutput(os.Stderr)
+	if *rulesFile == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	file, err := os.Open(*rulesFile)
+	if err != nil {
+		logger.Fatalf("Failed to open the rules: %v", err)
+	}
+	rules, err := transform.LoadRules(file)
+	file.Close()
+	if err != nil {
+		logger.Fatalf("Failed to read the rules: %v", err)
+	}
+
+	var existing []contract.Case
+	data, err := os.ReadFile(*casesFile)
+	switch {
+	case err == nil:
+		if existing, err = contract.ReadCases(bytes.NewReader(data)); err != nil {
+			logger.Fatal(err)
+		}
+	case !errors.Is(err, os.ErrNotExist) || *check:
+		logger.Fatalf("Failed to read the cases: %v", err)
+	}
+
+	// the transformers only log to the standard output of a restore
+	quiet := logrus.New()
+	quiet.SetLevel(logrus.ErrorLevel)
+	quiet.SetOutput(os.Stderr)
+
+	if *check {
+		failures, err := contract.Check(rules, existing, quiet)
+		if err != nil {
+			logger.Fatal(err)
+		}
+		for _, failure := range failures {
+			logger.Error(failure)
+		}
+		if len(failures) > 0 {
+			os.Exit(1)
+		}
+		return
+	}
+
+	cases, unexercised, err := contract.Generate(rules, existing, quiet)
+	if err != nil {
+		logger.Fatal(err)
+	}
+	for _, rule := range unexercised {
+		logger.Warnf("No case generated for %s: write one by hand", rule)
+	}
+	var out bytes.Buffer
+	if err := contract.WriteCases(&out, cases); err != nil {
+		logger.Fatal(err)
+	}
+	if err := os.WriteFile(*casesFile, out.Bytes(), 0o644); err != nil {
+		logger.Fatalf("Failed to write the cases: %v", err)
+	}
+	if *testFile != "" {
+		dir := filepath.Dir(*testFile)
+		rel := func(path string) string {
+			abs, _ := filepath.Abs(path)
+			absDir, _ := filepath.Abs(dir)
+			if r, err := filepath.Rel(absDir, abs); err == nil {
+				return filepath.ToSlash(r)
+			}
+			return path
+		}
+		if err := os.WriteFile(*testFile, contract.TestFile(*pkg, rel(*rulesFile), rel(*casesFile)), 0o644); err != nil {
+			logger.Fatalf("Failed to write the test: %v", err)
+		}
+	}
+	logger.Infof("Wrote %d cases to %s", len(cases), *casesFile)
+}
@@ -0,0 +1,89 @@
+// Command replace-pattern-verifier keeps checking the namespaces of recent
+// restores for references to the backup environment that the replace-pattern
+// rules map, and reports them as events and metrics.
+package main
+
+import (
+	"context"
+	"flag"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	veleroclient "github.com/vmware-tanzu/velero/pkg/generated/clientset/versioned"
+	"github.com/wrkt/velero-custom-plugins/internal/plugin"
+	"github.com/wrkt/velero-custom-plugins/internal/verify"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/record"
+)
+
+func main() {
+	addr := flag.String("metrics-addr", ":8080", "address to serve the metrics on")
+	namespace := flag.String("namespace", "velero", "namespace of the Restores and the rule ConfigMaps")
+	window := flag.Duration("window", 24*time.Hour, "how long after a restore its namespaces are checked")
+	interval := flag.Duration("interval", 5*time.Minute, "interval between two checks")
+	sections := flag.String("sections", os.Getenv(plugin.SectionsSetting), "top-level fields the patterns are restricted to, as the plugin's "+plugin.SectionsSetting+"; read from the settings ConfigMap when empty")
+	flag.Parse()
+
+	logger := logrus.New()
+
+	config, err := rest.InClusterConfig()
+	if err != nil {
+		logger.Fatalf("Failed to create in-cluster config: %v", err)
+	}
+	kube, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		logger.Fatalf("Failed to create clientset: %v", err)
+	}
+	velero, err := veleroclient.NewForConfig(config)
+	if err != nil {
+		logger.Fatalf("Failed to create Velero clientset: %v", err)
+	}
+	client, err := dynamic.NewForConfig(config)
+	if err != nil {
+		logger.Fatalf("Failed to create dynamic client: %v", err)
+	}
+
+	broadcaster := record.NewBroadcaster()
+	broadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{Interface: kube.CoreV1().Events("")})
+	defer broadcaster.Shutdown()
+	recorder := broadcaster.NewRecorder(scheme.Scheme, corev1.EventSource{Component: "replace-pattern-verifier"})
+
+	metrics := verify.NewMetrics()
+	controller := verify.NewController(kube, velero.VeleroV1(), client, recorder, metrics, verify.Options{
+		Namespace: *namespace,
+		Window:    *window,
+		Sections:  *sections,
+		Logger:    logger,
+	})
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go controller.Run(ctx, *interval)
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metrics)
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	server := &http.Server{Addr: *addr, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		<-ctx.Done()
+		shutdown, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		_ = server.Shutdown(shutdown)
+	}()
+
+	logger.Infof("Serving metrics on %s", *addr)
+	if err := server.ListenAndServe(); err != http.ErrServerClosed {
+		logger.Fatalf("Failed to serve: %v", err)
+	}
+}
@@ -0,0 +1,70 @@
+// Command replace-pattern-webhook serves a mutating admission webhook applying
+// the replace-pattern rules of the velero namespace to the objects applied to
+// the cluster.
+package main
+
+import (
+	"context"
+	"flag"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/wrkt/velero-custom-plugins/internal/webhook"
+	"github.com/wrkt/velero-custom-plugins/pkg/transform"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+func main() {
+	addr := flag.String("addr", ":8443", "address to serve on")
+	certFile := flag.String("tls-cert", "/tls/tls.crt", "TLS certificate file")
+	keyFile := flag.String("tls-key", "/tls/tls.key", "TLS key file")
+	namespace := flag.String("rules-namespace", "velero", "namespace of the rule ConfigMaps")
+	refresh := flag.Duration("refresh", 30*time.Second, "interval between two reloads of the rules")
+	flag.Parse()
+
+	logger := logrus.New()
+
+	config, err := rest.InClusterConfig()
+	if err != nil {
+		logger.Fatalf("Failed to create in-cluster config: %v", err)
+	}
+	clientset, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		logger.Fatalf("Failed to create clientset: %v", err)
+	}
+
+	handler := webhook.NewHandler(func(ctx context.Context) ([]corev1.ConfigMap, error) {
+		return transform.ListRules(ctx, clientset.CoreV1(), *namespace)
+	}, transform.Options{Discovery: clientset.Discovery(), Logger: logger})
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if err := handler.Refresh(ctx); err != nil {
+		logger.Fatalf("Failed to load the rules: %v", err)
+	}
+	go handler.Run(ctx, *refresh)
+
+	mux := http.NewServeMux()
+	mux.Handle("/mutate", handler)
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	server := &http.Server{Addr: *addr, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		<-ctx.Done()
+		shutdown, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		_ = server.Shutdown(shutdown)
+	}()
+
+	logger.Infof("Serving on %s", *addr)
+	if err := server.ListenAndServeTLS(*certFile, *keyFile); err != http.ErrServerClosed {
+		logger.Fatalf("Failed to serve: %v", err)
+	}
+}
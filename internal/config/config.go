@@ -0,0 +1,243 @@
+// Package config resolves the settings of the plugins from layered sources:
+// the defaults, then each source in order, a later source overriding the
+// values of the earlier ones.
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"sigs.k8s.io/yaml"
+)
+
+// Setting is a configuration key.
+type Setting struct {
+	Name    string
+	Default string
+	// Secret settings are redacted when the configuration is dumped.
+	Secret bool
+	// Validate checks a value, when set.
+	Validate func(value string) error
+}
+
+// Source holds the values of a configuration source.
+type Source struct {
+	// Name identifies the source in errors and in the dump.
+	Name   string
+	Values map[string]string
+	// Partial sources, such as the environment, hold other values too, which
+	// are ignored. Unknown keys in the other sources are errors.
+	Partial bool
+}
+
+// defaultSource is the origin of the values no source sets.
+const defaultSource = "default"
+
+// Config is the effective configuration.
+type Config struct {
+	settings []Setting
+	values   map[string]string
+	origins  map[string]string
+}
+
+// Load merges the sources over the defaults of settings. Every value is
+// validated, and all the errors found are returned together.
+func Load(settings []Setting, sources ...Source) (*Config, error) {
+	c := &Config{
+		settings: settings,
+		values:   make(map[string]string, len(settings)),
+		origins:  make(map[string]string, len(settings)),
+	}
+	known := make(map[string]Setting, len(settings))
+	for _, setting := range settings {
+		known[setting.Name] = setting
+		if setting.Default != "" {
+			c.values[setting.Name] = setting.Default
+			c.origins[setting.Name] = defaultSource
+		}
+	}
+
+	var errs []string
+	for _, source := range sources {
+		names := make([]string, 0, len(source.Values))
+		for name := range source.Values {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			value := source.Values[name]
+			setting, ok := known[name]
+			if !ok {
+				if !source.Partial {
+					errs = append(errs, fmt.Sprintf("unknown setting %s in %s", name, source.Name))
+				}
+				continue
+			}
+			if value == "" {
+				// an empty value leaves the setting to the earlier sources
+				continue
+			}
+			if setting.Validate != nil {
+				if err := setting.Validate(value); err != nil {
+					errs = append(errs, fmt.Sprintf("invalid %s=%q in %s: %v", name, redact(setting, value), source.Name, err))
+					continue
+				}
+			}
+			c.values[name] = value
+			c.origins[name] = source.Name
+		}
+	}
+	if len(errs) > 0 {
+		return nil, errors.New(strings.Join(errs, "; "))
+	}
+	return c, nil
+}
+
+// Lookup returns the value of a setting, and whether a source or a default
+// sets it.
+func (c *Config) Lookup(name string) (string, bool) {
+	value, ok := c.values[name]
+	return value, ok
+}
+
+// Dump logs the effective configuration, one setting per line with the source
+// of its value, secrets redacted.
+func (c *Config) Dump(logf func(format string, args ...interface{})) {
+	settings := append([]Setting{}, c.settings...)
+	sort.Slice(settings, func(i, j int) bool { return settings[i].Name < settings[j].Name })
+	for _, setting := range settings {
+		value, ok := c.values[setting.Name]
+		if !ok {
+			logf("Config %s is unset", setting.Name)
+			continue
+		}
+		logf("Config %s=%q (%s)", setting.Name, redact(setting, value), c.origins[setting.Name])
+	}
+}
+
+func redact(setting Setting, value string) string {
+	if setting.Secret && value != "" {
+		return "<redacted>"
+	}
+	return value
+}
+
+// Environment returns the environment variables of the process.
+func Environment() Source {
+	values := make(map[string]string)
+	for _, entry := range os.Environ() {
+		if name, value, ok := strings.Cut(entry, "="); ok {
+			values[name] = value
+		}
+	}
+	return Source{Name: "environment", Values: values, Partial: true}
+}
+
+// File reads a YAML file mapping settings to values. A missing file is an
+// empty source.
+func File(path string) (Source, error) {
+	source := Source{Name: "file " + path}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return source, nil
+	}
+	if err != nil {
+		return source, fmt.Errorf("failed to read %s: %v", path, err)
+	}
+	var raw map[string]interface{}
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return source, fmt.Errorf("failed to parse %s: %v", path, err)
+	}
+	source.Values = make(map[string]string, len(raw))
+	for name, value := range raw {
+		switch v := value.(type) {
+		case string:
+			source.Values[name] = v
+		case bool:
+			// YAML scalars such as true or 5 need no quotes
+			source.Values[name] = strconv.FormatBool(v)
+		case float64:
+			source.Values[name] = strconv.FormatFloat(v, 'f', -1, 64)
+		default:
+			return source, fmt.Errorf("%s in %s is not a scalar", name, path)
+		}
+	}
+	return source, nil
+}
+
+// NonNegativeInt accepts integers from 0.
+func NonNegativeInt(value string) error {
+	if n, err := strconv.Atoi(value); err != nil || n < 0 {
+		return fmt.Errorf("not a non-negative integer")
+	}
+	return nil
+}
+
+// NonNegativeDuration accepts durations such as 500ms, from 0.
+func NonNegativeDuration(value string) error {
+	if d, err := time.ParseDuration(value); err != nil || d < 0 {
+		return fmt.Errorf("not a non-negative duration")
+	}
+	return nil
+}
+
+// PositiveDuration accepts durations above 0.
+func PositiveDuration(value string) error {
+	if d, err := time.ParseDuration(value); err != nil || d <= 0 {
+		return fmt.Errorf("not a positive duration")
+	}
+	return nil
+}
+
+// Fraction accepts numbers between 0 and 1.
+func Fraction(value string) error {
+	if f, err := strconv.ParseFloat(value, 64); err != nil || f < 0 || f > 1 {
+		return fmt.Errorf("not a number between 0 and 1")
+	}
+	return nil
+}
+
+// Bool accepts the values strconv.ParseBool does.
+func Bool(value string) error {
+	if _, err := strconv.ParseBool(value); err != nil {
+		return fmt.Errorf("not a boolean")
+	}
+	return nil
+}
+
+// OneOf accepts the given values.
+func OneOf(values ...string) func(string) error {
+	return func(value string) error {
+		for _, allowed := range values {
+			if value == allowed {
+				return nil
+			}
+		}
+		return fmt.Errorf("expected one of %s", strings.Join(values, ", "))
+	}
+}
+
+// List accepts comma-separated lists without empty entries.
+func List(value string) error {
+	for _, entry := range strings.Split(value, ",") {
+		if strings.TrimSpace(entry) == "" {
+			return fmt.Errorf("empty entry")
+		}
+	}
+	return nil
+}
+
+// URL accepts absolute http and https URLs.
+func URL(value string) error {
+	u, err := url.Parse(value)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("not an http or https URL")
+	}
+	return nil
+}
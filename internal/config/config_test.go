@@ -0,0 +1,118 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testSettings = []Setting{
+	{Name: "LIMIT", Default: "5", Validate: NonNegativeInt},
+	{Name: "POLICY", Default: "warn", Validate: OneOf("warn", "refuse")},
+	{Name: "TOKEN", Secret: true},
+	{Name: "DIR"},
+}
+
+func TestLoad_Precedence(t *testing.T) {
+	c, err := Load(testSettings,
+		Source{Name: "configmap", Values: map[string]string{"LIMIT": "10", "POLICY": "refuse"}},
+		Source{Name: "file", Values: map[string]string{"LIMIT": "20", "TOKEN": ""}},
+		Source{Name: "environment", Values: map[string]string{"LIMIT": "30", "HOME": "/root"}, Partial: true},
+	)
+	require.NoError(t, err)
+
+	value, ok := c.Lookup("LIMIT")
+	assert.True(t, ok)
+	assert.Equal(t, "30", value)
+	value, _ = c.Lookup("POLICY")
+	assert.Equal(t, "refuse", value)
+	_, ok = c.Lookup("TOKEN")
+	assert.False(t, ok, "empty values leave the setting unset")
+	_, ok = c.Lookup("HOME")
+	assert.False(t, ok)
+
+	c, err = Load(testSettings)
+	require.NoError(t, err)
+	value, ok = c.Lookup("LIMIT")
+	assert.True(t, ok)
+	assert.Equal(t, "5", value)
+	_, ok = c.Lookup("DIR")
+	assert.False(t, ok)
+}
+
+func TestLoad_Invalid(t *testing.T) {
+	_, err := Load(testSettings,
+		Source{Name: "file", Values: map[string]string{"LIMIT": "-1", "LIMT": "2"}},
+		Source{Name: "environment", Values: map[string]string{"POLICY": "ignore"}, Partial: true},
+	)
+	require.Error(t, err)
+	assert.Equal(t, `invalid LIMIT="-1" in file: not a non-negative integer; unknown setting LIMT in file; `+
+		`invalid POLICY="ignore" in environment: expected one of warn, refuse`, err.Error())
+
+	secret := []Setting{{Name: "TOKEN", Secret: true, Validate: URL}}
+	_, err = Load(secret, Source{Name: "file", Values: map[string]string{"TOKEN": "s3cr3t"}})
+	require.Error(t, err)
+	assert.NotContains(t, err.Error(), "s3cr3t")
+}
+
+func TestDump(t *testing.T) {
+	c, err := Load(testSettings, Source{Name: "environment", Values: map[string]string{"TOKEN": "s3cr3t"}, Partial: true})
+	require.NoError(t, err)
+
+	var lines []string
+	c.Dump(func(format string, args ...interface{}) {
+		lines = append(lines, fmt.Sprintf(format, args...))
+	})
+	assert.Equal(t, []string{
+		"Config DIR is unset",
+		`Config LIMIT="5" (default)`,
+		`Config POLICY="warn" (default)`,
+		`Config TOKEN="<redacted>" (environment)`,
+	}, lines)
+}
+
+func TestFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.yaml")
+	require.NoError(t, os.WriteFile(path, []byte("LIMIT: 1000000\nPOLICY: refuse\nENABLED: true\nRATE: 0.25\n"), 0o600))
+
+	source, err := File(path)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"LIMIT": "1000000", "POLICY": "refuse", "ENABLED": "true", "RATE": "0.25"}, source.Values)
+	assert.False(t, source.Partial)
+
+	source, err = File(filepath.Join(dir, "missing.yaml"))
+	require.NoError(t, err)
+	assert.Empty(t, source.Values)
+
+	require.NoError(t, os.WriteFile(path, []byte("LIMIT: [1, 2]\n"), 0o600))
+	_, err = File(path)
+	assert.Error(t, err)
+}
+
+func TestValidators(t *testing.T) {
+	for _, tc := range []struct {
+		validate func(string) error
+		valid    []string
+		invalid  []string
+	}{
+		{NonNegativeInt, []string{"0", "42"}, []string{"-1", "1.5", "many"}},
+		{NonNegativeDuration, []string{"0s", "500ms"}, []string{"-1s", "5"}},
+		{PositiveDuration, []string{"1s"}, []string{"0s", "soon"}},
+		{Fraction, []string{"0", "0.5", "1"}, []string{"1.5", "-0.1", "half"}},
+		{Bool, []string{"true", "0"}, []string{"yes"}},
+		{List, []string{"a", "a, b"}, []string{"a,,b", ","}},
+		{URL, []string{"http://scanner:8080", "https://scanner/"}, []string{"scanner:8080", "ftp://scanner", "http://"}},
+	} {
+		for _, value := range tc.valid {
+			assert.NoError(t, tc.validate(value), value)
+		}
+		for _, value := range tc.invalid {
+			assert.Error(t, tc.validate(value), value)
+		}
+	}
+}
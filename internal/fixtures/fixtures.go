@@ -0,0 +1,61 @@
+// Package fixtures provides a corpus of real-world manifests used to exercise
+// the transformer chain against realistic item shapes.
+package fixtures
+
+import (
+	"embed"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/yaml"
+)
+
+//go:embed manifests/*.yaml
+var manifests embed.FS
+
+// Names returns the names of all fixtures, sorted.
+func Names() []string {
+	entries, err := manifests.ReadDir("manifests")
+	if err != nil {
+		panic(fmt.Sprintf("failed to read embedded fixtures: %v", err))
+	}
+
+	names := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		names = append(names, strings.TrimSuffix(entry.Name(), ".yaml"))
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Load returns a fresh copy of the named fixture.
+func Load(name string) (*unstructured.Unstructured, error) {
+	data, err := manifests.ReadFile(path.Join("manifests", name+".yaml"))
+	if err != nil {
+		return nil, fmt.Errorf("unknown fixture %q: %v", name, err)
+	}
+
+	// Go through the unstructured JSON scheme so numbers are typed the way
+	// Velero hands them to the plugin.
+	jsonData, err := yaml.YAMLToJSON(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert fixture %q: %v", name, err)
+	}
+	item := &unstructured.Unstructured{}
+	if err := item.UnmarshalJSON(jsonData); err != nil {
+		return nil, fmt.Errorf("failed to decode fixture %q: %v", name, err)
+	}
+	return item, nil
+}
+
+// MustLoad is like Load but panics on error. It is meant for tests.
+func MustLoad(name string) *unstructured.Unstructured {
+	item, err := Load(name)
+	if err != nil {
+		panic(err)
+	}
+	return item
+}
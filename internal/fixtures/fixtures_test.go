@@ -0,0 +1,28 @@
+package fixtures
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoad(t *testing.T) {
+	names := Names()
+	require.NotEmpty(t, names)
+
+	for _, name := range names {
+		t.Run(name, func(t *testing.T) {
+			item, err := Load(name)
+			require.NoError(t, err)
+			assert.NotEmpty(t, item.GetAPIVersion())
+			assert.NotEmpty(t, item.GetKind())
+			assert.NotEmpty(t, item.GetName())
+		})
+	}
+}
+
+func TestLoad_Unknown(t *testing.T) {
+	_, err := Load("does-not-exist")
+	assert.Error(t, err)
+}
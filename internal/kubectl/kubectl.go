@@ -0,0 +1,220 @@
+// Package kubectl implements the kubectl-replacepattern plugin: it reads
+// objects from the cluster or from files, applies a rule bundle to them, and
+// writes or applies the result.
+package kubectl
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"github.com/wrkt/velero-custom-plugins/pkg/transform"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+	"k8s.io/client-go/dynamic"
+	"sigs.k8s.io/yaml"
+)
+
+// FieldManager owns the fields the plugin applies.
+const FieldManager = "kubectl-replacepattern"
+
+// Output formats.
+const (
+	OutputYAML = "yaml"
+	OutputJSON = "json"
+)
+
+// ReadObjects decodes the objects of a multi-document YAML or JSON stream,
+// expanding Lists.
+func ReadObjects(r io.Reader) ([]*unstructured.Unstructured, error) {
+	var objects []*unstructured.Unstructured
+	dec := utilyaml.NewYAMLOrJSONDecoder(r, 4096)
+	for {
+		var object map[string]interface{}
+		if err := dec.Decode(&object); err == io.EOF {
+			return objects, nil
+		} else if err != nil {
+			return nil, fmt.Errorf("failed to read objects: %v", err)
+		}
+		if len(object) == 0 {
+			continue
+		}
+		u := &unstructured.Unstructured{Object: object}
+		if !u.IsList() {
+			objects = append(objects, u)
+			continue
+		}
+		list, err := u.ToList()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %v", u.GetKind(), err)
+		}
+		for i := range list.Items {
+			objects = append(objects, &list.Items[i])
+		}
+	}
+}
+
+// Cluster reads and applies objects with the dynamic client.
+type Cluster struct {
+	Client dynamic.Interface
+	Mapper meta.RESTMapper
+	// Namespace is applied to the namespaced objects that have none.
+	Namespace string
+}
+
+// Query selects objects of a resource: by name, or else by label selector.
+type Query struct {
+	// Resource is named the way kubectl accepts it, e.g. "deploy" or
+	// "certificates.cert-manager.io".
+	Resource      string
+	Names         []string
+	Namespace     string
+	AllNamespaces bool
+	Selector      string
+}
+
+// Get returns the objects selected by q.
+func (c *Cluster) Get(ctx context.Context, q Query) ([]*unstructured.Unstructured, error) {
+	gvr, namespaced, err := c.resolve(q.Resource)
+	if err != nil {
+		return nil, err
+	}
+	var client dynamic.ResourceInterface = c.Client.Resource(gvr)
+	if namespaced && !(q.AllNamespaces && len(q.Names) == 0) {
+		client = c.Client.Resource(gvr).Namespace(q.Namespace)
+	}
+
+	if len(q.Names) > 0 {
+		objects := make([]*unstructured.Unstructured, 0, len(q.Names))
+		for _, name := range q.Names {
+			object, err := client.Get(ctx, name, metav1.GetOptions{})
+			if err != nil {
+				return nil, fmt.Errorf("failed to get %s %s: %v", q.Resource, name, err)
+			}
+			objects = append(objects, object)
+		}
+		return objects, nil
+	}
+	list, err := client.List(ctx, metav1.ListOptions{LabelSelector: q.Selector})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list %s: %v", q.Resource, err)
+	}
+	objects := make([]*unstructured.Unstructured, 0, len(list.Items))
+	for i := range list.Items {
+		objects = append(objects, &list.Items[i])
+	}
+	return objects, nil
+}
+
+// resolve returns the preferred resource matching a kubectl-style name, and
+// whether it is namespaced.
+func (c *Cluster) resolve(resource string) (schema.GroupVersionResource, bool, error) {
+	fullySpecified, groupResource := schema.ParseResourceArg(strings.ToLower(resource))
+	input := groupResource.WithVersion("")
+	if fullySpecified != nil {
+		input = *fullySpecified
+	}
+	gvr, err := c.Mapper.ResourceFor(input)
+	if err != nil {
+		return schema.GroupVersionResource{}, false, fmt.Errorf("unknown resource %q: %v", resource, err)
+	}
+	gvk, err := c.Mapper.KindFor(gvr)
+	if err != nil {
+		return schema.GroupVersionResource{}, false, fmt.Errorf("unknown resource %q: %v", resource, err)
+	}
+	mapping, err := c.Mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+	if err != nil {
+		return schema.GroupVersionResource{}, false, fmt.Errorf("unknown resource %q: %v", resource, err)
+	}
+	return gvr, mapping.Scope.Name() == meta.RESTScopeNameNamespace, nil
+}
+
+// Apply applies object with server-side apply, forcing conflicts: the rules
+// are meant to win over the fields they rewrite.
+func (c *Cluster) Apply(ctx context.Context, object *unstructured.Unstructured, dryRun bool) error {
+	gvk := object.GroupVersionKind()
+	mapping, err := c.Mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+	if err != nil {
+		return fmt.Errorf("unknown kind %s: %v", gvk, err)
+	}
+	var client dynamic.ResourceInterface = c.Client.Resource(mapping.Resource)
+	if mapping.Scope.Name() == meta.RESTScopeNameNamespace {
+		namespace := object.GetNamespace()
+		if namespace == "" {
+			namespace = c.Namespace
+		}
+		client = c.Client.Resource(mapping.Resource).Namespace(namespace)
+	}
+
+	applied := object.DeepCopy()
+	// server-side apply refuses managed fields in the request
+	applied.SetManagedFields(nil)
+	data, err := json.Marshal(applied.Object)
+	if err != nil {
+		return fmt.Errorf("failed to encode %s %s: %v", gvk.Kind, object.GetName(), err)
+	}
+	force := true
+	opts := metav1.PatchOptions{FieldManager: FieldManager, Force: &force}
+	if dryRun {
+		opts.DryRun = []string{metav1.DryRunAll}
+	}
+	if _, err := client.Patch(ctx, object.GetName(), types.ApplyPatchType, data, opts); err != nil {
+		return fmt.Errorf("failed to apply %s %s: %v", gvk.Kind, object.GetName(), err)
+	}
+	return nil
+}
+
+// Transform applies chain to the objects. The objects the rules exclude from
+// restore are left out with a warning.
+func Transform(chain *transform.Chain, objects []*unstructured.Unstructured, logger logrus.FieldLogger) ([]*unstructured.Unstructured, error) {
+	transformed := make([]*unstructured.Unstructured, 0, len(objects))
+	for _, object := range objects {
+		result, err := chain.Apply(object)
+		if err != nil {
+			return nil, err
+		}
+		if result.Excluded {
+			logger.Warnf("Skipping %s %s/%s: excluded by the rules", object.GetKind(), object.GetNamespace(), object.GetName())
+			continue
+		}
+		transformed = append(transformed, result.Object)
+	}
+	return transformed, nil
+}
+
+// Write writes the objects in the given format: a YAML stream, or a JSON List.
+func Write(out io.Writer, objects []*unstructured.Unstructured, format string) error {
+	switch format {
+	case OutputYAML, "":
+		for _, object := range objects {
+			data, err := yaml.Marshal(object.Object)
+			if err != nil {
+				return fmt.Errorf("failed to encode %s %s: %v", object.GetKind(), object.GetName(), err)
+			}
+			if _, err := fmt.Fprintf(out, "---\n%s", data); err != nil {
+				return fmt.Errorf("failed to write objects: %v", err)
+			}
+		}
+		return nil
+	case OutputJSON:
+		items := make([]interface{}, 0, len(objects))
+		for _, object := range objects {
+			items = append(items, object.Object)
+		}
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(map[string]interface{}{"apiVersion": "v1", "kind": "List", "items": items}); err != nil {
+			return fmt.Errorf("failed to write objects: %v", err)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown output format %q, expected %s or %s", format, OutputYAML, OutputJSON)
+	}
+}
@@ -0,0 +1,157 @@
+package kubectl
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wrkt/velero-custom-plugins/pkg/transform"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+const rules = `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: hosts
+  namespace: velero
+  labels:
+    agoracalyce.io/replace-pattern: RestoreItemAction
+  annotations:
+    agoracalyce.io/exclude-labels: dr.example.com/skip
+data:
+  example.com: dr.example.com
+`
+
+var serviceGVK = schema.GroupVersionKind{Version: "v1", Kind: "Service"}
+
+func service(namespace, name, externalName string, labels map[string]string) *unstructured.Unstructured {
+	u := &unstructured.Unstructured{Object: map[string]interface{}{
+		"spec": map[string]interface{}{"type": "ExternalName", "externalName": externalName},
+	}}
+	u.SetGroupVersionKind(serviceGVK)
+	u.SetNamespace(namespace)
+	u.SetName(name)
+	u.SetLabels(labels)
+	return u
+}
+
+func newCluster(objects ...runtime.Object) (*Cluster, *dynamicfake.FakeDynamicClient) {
+	mapper := meta.NewDefaultRESTMapper(nil)
+	mapper.Add(serviceGVK, meta.RESTScopeNamespace)
+	client := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{{Version: "v1", Resource: "services"}: "ServiceList"}, objects...)
+	return &Cluster{Client: client, Mapper: mapper}, client
+}
+
+func TestReadObjects(t *testing.T) {
+	objects, err := ReadObjects(strings.NewReader(`apiVersion: v1
+kind: Service
+metadata:
+  name: web
+---
+---
+{"apiVersion": "v1", "kind": "List", "items": [
+  {"apiVersion": "v1", "kind": "Service", "metadata": {"name": "api"}},
+  {"apiVersion": "v1", "kind": "Service", "metadata": {"name": "db"}}
+]}
+`))
+	require.NoError(t, err)
+	var names []string
+	for _, object := range objects {
+		names = append(names, object.GetName())
+	}
+	assert.Equal(t, []string{"web", "api", "db"}, names)
+
+	_, err = ReadObjects(strings.NewReader("kind: [Service"))
+	assert.Error(t, err)
+}
+
+func TestClusterGet(t *testing.T) {
+	cluster, _ := newCluster(
+		service("shop", "web", "web.example.com", map[string]string{"app": "web"}),
+		service("shop", "db", "db.example.com", nil),
+		service("blog", "web", "blog.example.com", map[string]string{"app": "web"}),
+	)
+	ctx := context.Background()
+
+	objects, err := cluster.Get(ctx, Query{Resource: "services", Names: []string{"db"}, Namespace: "shop"})
+	require.NoError(t, err)
+	require.Len(t, objects, 1)
+	assert.Equal(t, "db", objects[0].GetName())
+
+	objects, err = cluster.Get(ctx, Query{Resource: "Service", Namespace: "shop"})
+	require.NoError(t, err)
+	assert.Len(t, objects, 2)
+
+	objects, err = cluster.Get(ctx, Query{Resource: "services", AllNamespaces: true, Selector: "app=web"})
+	require.NoError(t, err)
+	assert.Len(t, objects, 2)
+
+	_, err = cluster.Get(ctx, Query{Resource: "services", Names: []string{"missing"}, Namespace: "shop"})
+	assert.ErrorContains(t, err, "failed to get services missing")
+
+	_, err = cluster.Get(ctx, Query{Resource: "widgets", Namespace: "shop"})
+	assert.ErrorContains(t, err, `unknown resource "widgets"`)
+}
+
+func TestClusterApply(t *testing.T) {
+	cluster, client := newCluster()
+	var patch k8stesting.PatchActionImpl
+	client.PrependReactor("patch", "services", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		patch = action.(k8stesting.PatchActionImpl)
+		return true, nil, nil
+	})
+
+	object := service("shop", "web", "web.dr.example.com", nil)
+	object.SetManagedFields([]metav1.ManagedFieldsEntry{{Manager: "kubectl"}})
+	require.NoError(t, cluster.Apply(context.Background(), object, false))
+
+	assert.Equal(t, "shop", patch.GetNamespace())
+	assert.Equal(t, "web", patch.GetName())
+	assert.Equal(t, types.ApplyPatchType, patch.GetPatchType())
+	assert.NotContains(t, string(patch.GetPatch()), "managedFields")
+	assert.Contains(t, string(patch.GetPatch()), "web.dr.example.com")
+	assert.Len(t, object.GetManagedFields(), 1)
+}
+
+func TestTransformAndWrite(t *testing.T) {
+	configMaps, err := transform.LoadRules(strings.NewReader(rules))
+	require.NoError(t, err)
+	chain, err := transform.New(configMaps, transform.Options{SkipOrigin: true, Logger: logrus.New()})
+	require.NoError(t, err)
+
+	objects, err := Transform(chain, []*unstructured.Unstructured{
+		service("shop", "web", "web.example.com", nil),
+		service("shop", "db", "db.example.com", map[string]string{"dr.example.com/skip": "true"}),
+	}, logrus.New())
+	require.NoError(t, err)
+	require.Len(t, objects, 1)
+	externalName, _, _ := unstructured.NestedString(objects[0].Object, "spec", "externalName")
+	assert.Equal(t, "web.dr.example.com", externalName)
+
+	var out bytes.Buffer
+	require.NoError(t, Write(&out, objects, OutputYAML))
+	assert.True(t, strings.HasPrefix(out.String(), "---\napiVersion: v1\n"))
+	read, err := ReadObjects(&out)
+	require.NoError(t, err)
+	assert.Equal(t, objects, read)
+
+	out.Reset()
+	require.NoError(t, Write(&out, objects, OutputJSON))
+	read, err = ReadObjects(&out)
+	require.NoError(t, err)
+	assert.Equal(t, objects, read)
+
+	assert.EqualError(t, Write(&out, objects, "wide"), `unknown output format "wide", expected yaml or json`)
+}
@@ -0,0 +1,281 @@
+// Package loadgen drives the transformer chain of the restore plugin with
+// synthetic restores, built from the fixtures, and measures the latency and
+// allocations of each item to track performance from release to release.
+package loadgen
+
+import (
+	"encoding/json"
+	"fmt"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+
+	velerov1 "github.com/vmware-tanzu/velero/pkg/apis/velero/v1"
+	"github.com/vmware-tanzu/velero/pkg/plugin/velero"
+	"github.com/wrkt/velero-custom-plugins/internal/fixtures"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	k8sruntime "k8s.io/apimachinery/pkg/runtime"
+)
+
+const (
+	// paddingAnnotation holds the padding bringing items to the requested
+	// size.
+	paddingAnnotation = "loadgen.agoracalyce.io/padding"
+	// paddingWord is repeated in the padding, a hit of the default rules.
+	paddingWord = "db.prod.example.com "
+)
+
+// Options configures the synthetic restore.
+type Options struct {
+	// Kinds are the fixtures the items are built from, in turn, all of them
+	// when empty
+	Kinds []string
+	// Count is the number of items
+	Count int
+	// Size is the minimum size of an item in JSON, items being padded up to
+	// it
+	Size int
+	// Namespaces is the number of namespaces the namespaced items are spread
+	// across, one when zero
+	Namespaces int
+}
+
+// Restore returns the Restore the synthetic items belong to.
+func Restore() *velerov1.Restore {
+	return &velerov1.Restore{ObjectMeta: metav1.ObjectMeta{Name: "loadgen", Namespace: "velero", UID: "loadgen"}}
+}
+
+// DefaultRules returns a literal rule ConfigMap of n patterns, one of them
+// hitting the padding of the items.
+func DefaultRules(n int) []v1.ConfigMap {
+	data := map[string]string{"prod.example.com": "dr.example.com"}
+	for i := 1; i < n; i++ {
+		data[fmt.Sprintf("prod-%d.example.com", i)] = fmt.Sprintf("dr-%d.example.com", i)
+	}
+	return []v1.ConfigMap{{
+		ObjectMeta: metav1.ObjectMeta{Name: "loadgen", Namespace: "velero"},
+		Data:       data,
+	}}
+}
+
+// Generate returns the inputs of a synthetic restore.
+func Generate(opts Options, restore *velerov1.Restore) ([]*velero.RestoreItemActionExecuteInput, error) {
+	kinds := opts.Kinds
+	if len(kinds) == 0 {
+		kinds = fixtures.Names()
+	}
+	templates := make([]*unstructured.Unstructured, 0, len(kinds))
+	for _, kind := range kinds {
+		item, err := fixtures.Load(kind)
+		if err != nil {
+			return nil, err
+		}
+		templates = append(templates, item)
+	}
+	namespaces := opts.Namespaces
+	if namespaces < 1 {
+		namespaces = 1
+	}
+
+	inputs := make([]*velero.RestoreItemActionExecuteInput, 0, opts.Count)
+	for i := 0; i < opts.Count; i++ {
+		item := templates[i%len(templates)].DeepCopy()
+		item.SetName(fmt.Sprintf("%s-%d", item.GetName(), i))
+		if item.GetNamespace() != "" {
+			item.SetNamespace(fmt.Sprintf("loadgen-%d", i%namespaces))
+		}
+		if err := pad(item, opts.Size); err != nil {
+			return nil, err
+		}
+		inputs = append(inputs, &velero.RestoreItemActionExecuteInput{Item: item, ItemFromBackup: item.DeepCopy(), Restore: restore})
+	}
+	return inputs, nil
+}
+
+// pad adds padding to item until it is about size bytes long in JSON.
+func pad(item *unstructured.Unstructured, size int) error {
+	data, err := json.Marshal(item.Object)
+	if err != nil {
+		return fmt.Errorf("failed to encode %s %s: %v", item.GetKind(), item.GetName(), err)
+	}
+	// the annotation itself takes its key, quotes and separators
+	missing := size - len(data) - len(paddingAnnotation) - 6
+	if missing <= 0 {
+		return nil
+	}
+	annotations := item.GetAnnotations()
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+	padding := strings.Repeat(paddingWord, missing/len(paddingWord)+1)
+	annotations[paddingAnnotation] = padding[:missing]
+	item.SetAnnotations(annotations)
+	return nil
+}
+
+// Executor runs an item through the transformer chain, as plugin.Engine does.
+type Executor interface {
+	Execute(input *velero.RestoreItemActionExecuteInput) (*velero.RestoreItemActionExecuteOutput, error)
+}
+
+// Latency sums up the latencies of items, in nanoseconds.
+type Latency struct {
+	P50 time.Duration `json:"p50"`
+	P90 time.Duration `json:"p90"`
+	P99 time.Duration `json:"p99"`
+	Max time.Duration `json:"max"`
+}
+
+// Report is the result of a run, written as JSON to be compared with the runs
+// of other releases.
+type Report struct {
+	// Label names the run, typically the release
+	Label      string `json:"label,omitempty"`
+	GoVersion  string `json:"goVersion"`
+	Items      int    `json:"items"`
+	Iterations int    `json:"iterations"`
+	Errors     int    `json:"errors"`
+	// Duration is the time spent in the chain, in nanoseconds
+	Duration       time.Duration      `json:"duration"`
+	ItemsPerSecond float64            `json:"itemsPerSecond"`
+	Latency        Latency            `json:"latency"`
+	AllocsPerItem  float64            `json:"allocsPerItem"`
+	BytesPerItem   float64            `json:"bytesPerItem"`
+	Kinds          map[string]Latency `json:"kinds"`
+}
+
+// Run executes the inputs iterations times, after a first pass that is not
+// measured, and reports the latencies and allocations. Each execution gets a
+// copy of its input.
+func Run(executor Executor, inputs []*velero.RestoreItemActionExecuteInput, iterations int) Report {
+	report := Report{GoVersion: runtime.Version(), Items: len(inputs), Iterations: iterations}
+	execute := func(input *velero.RestoreItemActionExecuteInput) error {
+		_, err := executor.Execute(input)
+		return err
+	}
+	for _, input := range copies(inputs) {
+		_ = execute(input)
+	}
+
+	var all []time.Duration
+	byKind := make(map[string][]time.Duration)
+	var mallocs, bytes uint64
+	for i := 0; i < iterations; i++ {
+		batch := copies(inputs)
+		latencies := make([]time.Duration, len(batch))
+		var before, after runtime.MemStats
+		runtime.GC()
+		runtime.ReadMemStats(&before)
+		for j, input := range batch {
+			start := time.Now()
+			if err := execute(input); err != nil {
+				report.Errors++
+			}
+			latencies[j] = time.Since(start)
+		}
+		runtime.ReadMemStats(&after)
+		mallocs += after.Mallocs - before.Mallocs
+		bytes += after.TotalAlloc - before.TotalAlloc
+
+		for j, latency := range latencies {
+			report.Duration += latency
+			kind := batch[j].Item.GetObjectKind().GroupVersionKind().Kind
+			byKind[kind] = append(byKind[kind], latency)
+		}
+		all = append(all, latencies...)
+	}
+
+	if executions := len(all); executions > 0 {
+		report.AllocsPerItem = float64(mallocs) / float64(executions)
+		report.BytesPerItem = float64(bytes) / float64(executions)
+		if report.Duration > 0 {
+			report.ItemsPerSecond = float64(executions) / report.Duration.Seconds()
+		}
+	}
+	report.Latency = summarize(all)
+	report.Kinds = make(map[string]Latency, len(byKind))
+	for kind, latencies := range byKind {
+		report.Kinds[kind] = summarize(latencies)
+	}
+	return report
+}
+
+func copies(inputs []*velero.RestoreItemActionExecuteInput) []*velero.RestoreItemActionExecuteInput {
+	out := make([]*velero.RestoreItemActionExecuteInput, len(inputs))
+	for i, input := range inputs {
+		copied := *input
+		copied.Item = input.Item.DeepCopyObject().(k8sruntime.Unstructured)
+		out[i] = &copied
+	}
+	return out
+}
+
+func summarize(latencies []time.Duration) Latency {
+	if len(latencies) == 0 {
+		return Latency{}
+	}
+	sorted := append([]time.Duration{}, latencies...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	percentile := func(p int) time.Duration {
+		return sorted[(len(sorted)-1)*p/100]
+	}
+	return Latency{P50: percentile(50), P90: percentile(90), P99: percentile(99), Max: sorted[len(sorted)-1]}
+}
+
+// Compare returns the measures of report exceeding those of baseline by more
+// than tolerance, a fraction.
+func Compare(baseline, report Report, tolerance float64) []string {
+	measures := []struct {
+		name             string
+		baseline, actual float64
+		format           func(float64) string
+	}{
+		{"p50 latency", float64(baseline.Latency.P50), float64(report.Latency.P50), formatDuration},
+		{"p99 latency", float64(baseline.Latency.P99), float64(report.Latency.P99), formatDuration},
+		{"allocations per item", baseline.AllocsPerItem, report.AllocsPerItem, formatCount},
+		{"bytes per item", baseline.BytesPerItem, report.BytesPerItem, formatCount},
+	}
+	var regressions []string
+	for _, m := range measures {
+		if m.baseline > 0 && m.actual > m.baseline*(1+tolerance) {
+			regressions = append(regressions, fmt.Sprintf("%s: %s, baseline %s (+%.0f%%)",
+				m.name, m.format(m.actual), m.format(m.baseline), (m.actual/m.baseline-1)*100))
+		}
+	}
+	return regressions
+}
+
+func formatDuration(ns float64) string {
+	return time.Duration(ns).String()
+}
+
+func formatCount(n float64) string {
+	return fmt.Sprintf("%.0f", n)
+}
+
+// String sums up the report for humans.
+func (r Report) String() string {
+	var b strings.Builder
+	if r.Label != "" {
+		fmt.Fprintf(&b, "%s, ", r.Label)
+	}
+	fmt.Fprintf(&b, "%d items x %d iterations, %d errors, %.0f items/s\n", r.Items, r.Iterations, r.Errors, r.ItemsPerSecond)
+	fmt.Fprintf(&b, "latency %s, %.0f allocs/item, %.0f B/item\n", r.Latency, r.AllocsPerItem, r.BytesPerItem)
+	kinds := make([]string, 0, len(r.Kinds))
+	for kind := range r.Kinds {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+	for _, kind := range kinds {
+		fmt.Fprintf(&b, "  %-20s %s\n", kind, r.Kinds[kind])
+	}
+	return b.String()
+}
+
+// String formats the percentiles.
+func (l Latency) String() string {
+	return fmt.Sprintf("p50 %s p90 %s p99 %s max %s", l.P50, l.P90, l.P99, l.Max)
+}
@@ -0,0 +1,74 @@
+package loadgen
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wrkt/velero-custom-plugins/internal/plugin"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestGenerate(t *testing.T) {
+	restore := Restore()
+	inputs, err := Generate(Options{Kinds: []string{"deployment", "certificate"}, Count: 5, Size: 8192, Namespaces: 2}, restore)
+	require.NoError(t, err)
+	require.Len(t, inputs, 5)
+
+	names := make(map[string]bool)
+	for i, input := range inputs {
+		item := input.Item.(*unstructured.Unstructured)
+		assert.Equal(t, []string{"Deployment", "Certificate"}[i%2], item.GetKind())
+		assert.Contains(t, []string{"loadgen-0", "loadgen-1"}, item.GetNamespace())
+		names[item.GetName()] = true
+		data, err := json.Marshal(item.Object)
+		require.NoError(t, err)
+		assert.GreaterOrEqual(t, len(data), 8192)
+		assert.Less(t, len(data), 8192+100)
+		assert.Equal(t, item, input.ItemFromBackup)
+		assert.Same(t, restore, input.Restore)
+	}
+	assert.Len(t, names, 5)
+
+	_, err = Generate(Options{Kinds: []string{"pod"}, Count: 1}, restore)
+	assert.Error(t, err)
+}
+
+func TestRun(t *testing.T) {
+	restore := Restore()
+	engine, err := plugin.NewEngine(DefaultRules(10), restore, nil, logrus.New())
+	require.NoError(t, err)
+	inputs, err := Generate(Options{Count: 16, Size: 2048}, restore)
+	require.NoError(t, err)
+
+	output, err := engine.Execute(inputs[0])
+	require.NoError(t, err)
+	annotations := output.UpdatedItem.(*unstructured.Unstructured).GetAnnotations()
+	assert.True(t, strings.HasPrefix(annotations[paddingAnnotation], "db.dr.example.com "))
+
+	report := Run(engine, inputs, 2)
+	assert.Equal(t, 16, report.Items)
+	assert.Equal(t, 2, report.Iterations)
+	assert.Zero(t, report.Errors)
+	assert.Positive(t, report.AllocsPerItem)
+	assert.Positive(t, report.ItemsPerSecond)
+	assert.LessOrEqual(t, report.Latency.P50, report.Latency.P99)
+	assert.LessOrEqual(t, report.Latency.P99, report.Latency.Max)
+	assert.Contains(t, report.Kinds, "Deployment")
+	// the inputs are left as they were
+	assert.True(t, strings.HasPrefix(inputs[0].Item.(*unstructured.Unstructured).GetAnnotations()[paddingAnnotation], paddingWord))
+}
+
+func TestCompare(t *testing.T) {
+	baseline := Report{Latency: Latency{P50: time.Millisecond, P99: 4 * time.Millisecond}, AllocsPerItem: 300, BytesPerItem: 60000}
+	report := baseline
+	report.Latency.P99 = 6 * time.Millisecond
+	report.AllocsPerItem = 330
+	assert.Equal(t, []string{"p99 latency: 6ms, baseline 4ms (+50%)"}, Compare(baseline, report, 0.2))
+	assert.Len(t, Compare(baseline, report, 0.05), 2)
+	assert.Empty(t, Compare(Report{}, report, 0))
+}
@@ -0,0 +1,65 @@
+// Package lru is a bounded cache of the values derived from the rules, such as
+// compiled expressions: rules change over the life of the plugin, and the
+// values of the rules no longer in use are evicted with the least recently
+// used ones.
+package lru
+
+import (
+	"container/list"
+	"sync"
+)
+
+// Cache holds up to a number of values, safe for concurrent use.
+type Cache[K comparable, V any] struct {
+	mu      sync.Mutex
+	size    int
+	order   *list.List
+	entries map[K]*list.Element
+}
+
+type entry[K comparable, V any] struct {
+	key   K
+	value V
+}
+
+// New returns a cache holding up to size values.
+func New[K comparable, V any](size int) *Cache[K, V] {
+	return &Cache[K, V]{size: size, order: list.New(), entries: make(map[K]*list.Element)}
+}
+
+// Get returns the value of key, if cached.
+func (c *Cache[K, V]) Get(key K) (V, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if element, ok := c.entries[key]; ok {
+		c.order.MoveToFront(element)
+		return element.Value.(*entry[K, V]).value, true
+	}
+	var zero V
+	return zero, false
+}
+
+// Add caches the value of key, evicting the least recently used value when
+// the cache is full.
+func (c *Cache[K, V]) Add(key K, value V) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if element, ok := c.entries[key]; ok {
+		element.Value.(*entry[K, V]).value = value
+		c.order.MoveToFront(element)
+		return
+	}
+	c.entries[key] = c.order.PushFront(&entry[K, V]{key: key, value: value})
+	if c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*entry[K, V]).key)
+	}
+}
+
+// Len returns the number of cached values.
+func (c *Cache[K, V]) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
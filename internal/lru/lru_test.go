@@ -0,0 +1,51 @@
+package lru
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCache(t *testing.T) {
+	cache := New[string, int](2)
+	cache.Add("a", 1)
+	cache.Add("b", 2)
+
+	value, ok := cache.Get("a")
+	assert.True(t, ok)
+	assert.Equal(t, 1, value)
+
+	// b is the least recently used
+	cache.Add("c", 3)
+	_, ok = cache.Get("b")
+	assert.False(t, ok)
+	value, ok = cache.Get("a")
+	assert.True(t, ok)
+	assert.Equal(t, 1, value)
+	assert.Equal(t, 2, cache.Len())
+
+	cache.Add("a", 4)
+	value, _ = cache.Get("a")
+	assert.Equal(t, 4, value)
+	assert.Equal(t, 2, cache.Len())
+}
+
+func TestCache_Concurrent(t *testing.T) {
+	cache := New[string, int](8)
+	var wg sync.WaitGroup
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				key := strconv.Itoa((i + j) % 32)
+				cache.Add(key, j)
+				cache.Get(key)
+			}
+		}(i)
+	}
+	wg.Wait()
+	assert.Equal(t, 8, cache.Len())
+}
@@ -0,0 +1,125 @@
+package objectstore
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/bloberror"
+)
+
+// accountKeyVariable is the default variable of the storage account key in
+// Velero's Azure credentials.
+const accountKeyVariable = "AZURE_STORAGE_ACCOUNT_ACCESS_KEY"
+
+// AzureOptions locates a container of Azure Blob Storage.
+type AzureOptions struct {
+	Container string
+	Account   string
+	// AccountURI overrides the https://<account>.blob.core.windows.net URL
+	AccountURI string
+	// Credentials are the variables of Velero's Azure credentials file, see
+	// ParseAzureCredentials. A storage account key is used when present,
+	// then a client secret; without either, the default credential chain is
+	// used: environment, workload identity and managed identity.
+	Credentials map[string]string
+	// AccountKeyVariable names the variable of the account key, by default
+	// AZURE_STORAGE_ACCOUNT_ACCESS_KEY
+	AccountKeyVariable string
+	Client             azcore.ClientOptions
+}
+
+// ParseAzureCredentials reads the KEY=value lines of Velero's Azure
+// credentials file.
+func ParseAzureCredentials(data []byte) map[string]string {
+	variables := map[string]string{}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if key, value, ok := strings.Cut(line, "="); ok {
+			variables[strings.TrimSpace(key)] = strings.Trim(strings.TrimSpace(value), `"`)
+		}
+	}
+	return variables
+}
+
+// Azure is a container of Azure Blob Storage.
+type Azure struct {
+	client    *azblob.Client
+	account   string
+	container string
+}
+
+// NewAzure returns the container of options.
+func NewAzure(options AzureOptions) (*Azure, error) {
+	if options.Container == "" || (options.Account == "" && options.AccountURI == "") {
+		return nil, fmt.Errorf("container and storage account are required")
+	}
+	serviceURL := options.AccountURI
+	if serviceURL == "" {
+		serviceURL = fmt.Sprintf("https://%s.blob.core.windows.net/", options.Account)
+	}
+	clientOptions := &azblob.ClientOptions{ClientOptions: options.Client}
+	keyVariable := options.AccountKeyVariable
+	if keyVariable == "" {
+		keyVariable = accountKeyVariable
+	}
+	var client *azblob.Client
+	var err error
+	credentials := options.Credentials
+	switch {
+	case credentials[keyVariable] != "":
+		var key *azblob.SharedKeyCredential
+		if key, err = azblob.NewSharedKeyCredential(options.Account, credentials[keyVariable]); err == nil {
+			client, err = azblob.NewClientWithSharedKeyCredential(serviceURL, key, clientOptions)
+		}
+	case credentials["AZURE_CLIENT_SECRET"] != "":
+		var secret *azidentity.ClientSecretCredential
+		secret, err = azidentity.NewClientSecretCredential(credentials["AZURE_TENANT_ID"], credentials["AZURE_CLIENT_ID"], credentials["AZURE_CLIENT_SECRET"], &azidentity.ClientSecretCredentialOptions{ClientOptions: options.Client})
+		if err == nil {
+			client, err = azblob.NewClient(serviceURL, secret, clientOptions)
+		}
+	default:
+		var chain *azidentity.DefaultAzureCredential
+		if chain, err = azidentity.NewDefaultAzureCredential(&azidentity.DefaultAzureCredentialOptions{ClientOptions: options.Client}); err == nil {
+			client, err = azblob.NewClient(serviceURL, chain, clientOptions)
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to create the blob client: %v", err)
+	}
+	return &Azure{client: client, account: options.Account, container: options.Container}, nil
+}
+
+// URL returns the azure:// URL of key.
+func (a *Azure) URL(key string) string {
+	return fmt.Sprintf("azure://%s/%s/%s", a.account, a.container, key)
+}
+
+// Get returns the content of key, ErrNotFound when it does not exist.
+func (a *Azure) Get(ctx context.Context, key string) ([]byte, error) {
+	out, err := a.client.DownloadStream(ctx, a.container, key, nil)
+	if bloberror.HasCode(err, bloberror.BlobNotFound) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer out.Body.Close()
+	return io.ReadAll(out.Body)
+}
+
+// Put writes data to key.
+func (a *Azure) Put(ctx context.Context, key string, data []byte) error {
+	_, err := a.client.UploadBuffer(ctx, a.container, key, data, nil)
+	return err
+}
@@ -0,0 +1,72 @@
+package objectstore
+
+import (
+	"context"
+	"encoding/base64"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseAzureCredentials(t *testing.T) {
+	variables := ParseAzureCredentials([]byte("# velero\nAZURE_TENANT_ID=tenant\nAZURE_CLIENT_SECRET=\"s=cret\"\n\nAZURE_CLOUD_NAME = AzurePublicCloud\n"))
+	assert.Equal(t, map[string]string{"AZURE_TENANT_ID": "tenant", "AZURE_CLIENT_SECRET": "s=cret", "AZURE_CLOUD_NAME": "AzurePublicCloud"}, variables)
+}
+
+func TestAzure_GetPut(t *testing.T) {
+	var mu sync.Mutex
+	objects := map[string]string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if !strings.HasPrefix(r.Header.Get("Authorization"), "SharedKey account:") {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		switch r.Method {
+		case http.MethodPut:
+			body, _ := io.ReadAll(r.Body)
+			objects[r.URL.Path] = string(body)
+			w.WriteHeader(http.StatusCreated)
+		case http.MethodGet:
+			body, ok := objects[r.URL.Path]
+			if !ok {
+				w.Header().Set("x-ms-error-code", "BlobNotFound")
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			io.WriteString(w, body)
+		}
+	}))
+	defer server.Close()
+	ctx := context.Background()
+
+	azure, err := NewAzure(AzureOptions{
+		Container:          "backups",
+		Account:            "account",
+		AccountURI:         server.URL + "/account/",
+		Credentials:        map[string]string{"KEY": base64.StdEncoding.EncodeToString([]byte("key"))},
+		AccountKeyVariable: "KEY",
+		Client:             azcore.ClientOptions{Transport: server.Client(), Retry: policy.RetryOptions{MaxRetries: -1}},
+	})
+	require.NoError(t, err)
+	_, err = azure.Get(ctx, "velero/state.json")
+	assert.Equal(t, ErrNotFound, err)
+	require.NoError(t, azure.Put(ctx, "velero/state.json", []byte(`{"uid":"1"}`)))
+	assert.Equal(t, map[string]string{"/account/backups/velero/state.json": `{"uid":"1"}`}, objects)
+	data, err := azure.Get(ctx, "velero/state.json")
+	require.NoError(t, err)
+	assert.Equal(t, `{"uid":"1"}`, string(data))
+	assert.Equal(t, "azure://account/backups/velero/state.json", azure.URL("velero/state.json"))
+
+	_, err = NewAzure(AzureOptions{Container: "backups"})
+	assert.EqualError(t, err, "container and storage account are required")
+}
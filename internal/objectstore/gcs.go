@@ -0,0 +1,63 @@
+package objectstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"cloud.google.com/go/storage"
+	"google.golang.org/api/option"
+)
+
+// GCS is a bucket of Google Cloud Storage.
+type GCS struct {
+	bucket *storage.BucketHandle
+	name   string
+}
+
+// NewGCS returns a bucket of Google Cloud Storage. Credentials is the JSON
+// key of a service account; without, the application default credentials are
+// used: GOOGLE_APPLICATION_CREDENTIALS, workload identity or the metadata
+// server.
+func NewGCS(ctx context.Context, bucket string, credentials []byte, options ...option.ClientOption) (*GCS, error) {
+	if bucket == "" {
+		return nil, fmt.Errorf("bucket is required")
+	}
+	if credentials != nil {
+		options = append(options, option.WithCredentialsJSON(credentials))
+	}
+	client, err := storage.NewClient(ctx, options...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create the storage client: %v", err)
+	}
+	return &GCS{bucket: client.Bucket(bucket), name: bucket}, nil
+}
+
+// URL returns the gs:// URL of key.
+func (g *GCS) URL(key string) string {
+	return fmt.Sprintf("gs://%s/%s", g.name, key)
+}
+
+// Get returns the content of key, ErrNotFound when it does not exist.
+func (g *GCS) Get(ctx context.Context, key string) ([]byte, error) {
+	reader, err := g.bucket.Object(key).NewReader(ctx)
+	if errors.Is(err, storage.ErrObjectNotExist) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	return io.ReadAll(reader)
+}
+
+// Put writes data to key.
+func (g *GCS) Put(ctx context.Context, key string, data []byte) error {
+	writer := g.bucket.Object(key).NewWriter(ctx)
+	if _, err := writer.Write(data); err != nil {
+		writer.Close()
+		return err
+	}
+	return writer.Close()
+}
@@ -0,0 +1,62 @@
+package objectstore
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/api/option"
+)
+
+func TestGCS_GetPut(t *testing.T) {
+	var mu sync.Mutex
+	objects := map[string]string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if r.Method == http.MethodPost && strings.HasPrefix(r.URL.Path, "/upload/storage/v1/b/backups/o") {
+			_, params, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+			require.NoError(t, err)
+			parts := multipart.NewReader(r.Body, params["boundary"])
+			part, err := parts.NextPart()
+			require.NoError(t, err)
+			var metadata struct{ Name string }
+			require.NoError(t, json.NewDecoder(part).Decode(&metadata))
+			part, err = parts.NextPart()
+			require.NoError(t, err)
+			body, _ := io.ReadAll(part)
+			objects[metadata.Name] = string(body)
+			fmt.Fprintf(w, `{"bucket":"backups","name":%q}`, metadata.Name)
+			return
+		}
+		body, ok := objects[strings.TrimPrefix(r.URL.Path, "/backups/")]
+		if r.Method != http.MethodGet || !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		io.WriteString(w, body)
+	}))
+	defer server.Close()
+	ctx := context.Background()
+
+	gcs, err := NewGCS(ctx, "backups", nil, option.WithEndpoint(server.URL+"/storage/v1/"), option.WithoutAuthentication())
+	require.NoError(t, err)
+	_, err = gcs.Get(ctx, "velero/state.json")
+	assert.Equal(t, ErrNotFound, err)
+	require.NoError(t, gcs.Put(ctx, "velero/state.json", []byte(`{"uid":"1"}`)))
+	assert.Equal(t, map[string]string{"velero/state.json": `{"uid":"1"}`}, objects)
+	data, err := gcs.Get(ctx, "velero/state.json")
+	require.NoError(t, err)
+	assert.Equal(t, `{"uid":"1"}`, string(data))
+	assert.Equal(t, "gs://backups/velero/state.json", gcs.URL("velero/state.json"))
+}
@@ -0,0 +1,9 @@
+// Package objectstore reads and writes objects in the buckets of Velero's
+// backup storage locations, with the SDKs of the cloud providers and their
+// default credential chains.
+package objectstore
+
+import "errors"
+
+// ErrNotFound is returned when the object does not exist.
+var ErrNotFound = errors.New("object not found")
@@ -0,0 +1,101 @@
+package objectstore
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// S3Options locates a bucket of S3 or of an S3-compatible service.
+type S3Options struct {
+	Bucket string
+	Region string
+	// Endpoint is the URL of an S3-compatible service, empty for AWS
+	Endpoint  string
+	PathStyle bool
+	// Credentials is the content of a shared credentials file, the format of
+	// Velero's cloud credentials. Without, the default credential chain is
+	// used: environment, AWS_SHARED_CREDENTIALS_FILE, web identity (IRSA) and
+	// instance profiles.
+	Credentials []byte
+	// Profile is the profile of the credentials and configuration to use
+	Profile string
+}
+
+// S3 is a bucket of an S3-compatible object storage.
+type S3 struct {
+	bucket string
+	client *s3.Client
+}
+
+// NewS3 returns the bucket of options.
+func NewS3(ctx context.Context, options S3Options) (*S3, error) {
+	if options.Bucket == "" || options.Region == "" {
+		return nil, fmt.Errorf("bucket and region are required")
+	}
+	loaders := []func(*config.LoadOptions) error{config.WithRegion(options.Region)}
+	if options.Credentials != nil {
+		// the SDK only reads shared credentials from files, which it loads
+		// with the configuration
+		file, err := os.CreateTemp("", "credentials-")
+		if err != nil {
+			return nil, fmt.Errorf("failed to write the credentials: %v", err)
+		}
+		defer os.Remove(file.Name())
+		_, err = file.Write(options.Credentials)
+		if closeErr := file.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to write the credentials: %v", err)
+		}
+		loaders = append(loaders, config.WithSharedCredentialsFiles([]string{file.Name()}))
+	}
+	if options.Profile != "" {
+		loaders = append(loaders, config.WithSharedConfigProfile(options.Profile))
+	}
+	cfg, err := config.LoadDefaultConfig(ctx, loaders...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load the AWS configuration: %v", err)
+	}
+	client := s3.NewFromConfig(cfg, func(o *s3.Options) {
+		if options.Endpoint != "" {
+			o.BaseEndpoint = aws.String(options.Endpoint)
+		}
+		o.UsePathStyle = options.PathStyle
+	})
+	return &S3{bucket: options.Bucket, client: client}, nil
+}
+
+// URL returns the s3:// URL of key.
+func (s *S3) URL(key string) string {
+	return fmt.Sprintf("s3://%s/%s", s.bucket, key)
+}
+
+// Get returns the content of key, ErrNotFound when it does not exist.
+func (s *S3) Get(ctx context.Context, key string) ([]byte, error) {
+	out, err := s.client.GetObject(ctx, &s3.GetObjectInput{Bucket: aws.String(s.bucket), Key: aws.String(key)})
+	var noSuchKey *types.NoSuchKey
+	if errors.As(err, &noSuchKey) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer out.Body.Close()
+	return io.ReadAll(out.Body)
+}
+
+// Put writes data to key.
+func (s *S3) Put(ctx context.Context, key string, data []byte) error {
+	_, err := s.client.PutObject(ctx, &s3.PutObjectInput{Bucket: aws.String(s.bucket), Key: aws.String(key), Body: bytes.NewReader(data)})
+	return err
+}
@@ -0,0 +1,69 @@
+package objectstore
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestS3_GetPut(t *testing.T) {
+	var mu sync.Mutex
+	objects := map[string]string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=AKID/") {
+			w.WriteHeader(http.StatusForbidden)
+			io.WriteString(w, "<Error><Code>AccessDenied</Code><Message>Access Denied</Message></Error>")
+			return
+		}
+		switch r.Method {
+		case http.MethodPut:
+			body, _ := io.ReadAll(r.Body)
+			objects[r.URL.Path] = string(body)
+		case http.MethodGet:
+			body, ok := objects[r.URL.Path]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				io.WriteString(w, "<Error><Code>NoSuchKey</Code><Message>The specified key does not exist.</Message></Error>")
+				return
+			}
+			io.WriteString(w, body)
+		}
+	}))
+	defer server.Close()
+
+	credentials := []byte("[default]\naws_access_key_id = OTHER\naws_secret_access_key = secret\n\n[velero]\naws_access_key_id = AKID\naws_secret_access_key = secret\n")
+	t.Setenv("AWS_CONFIG_FILE", filepath.Join(t.TempDir(), "config"))
+	t.Setenv("AWS_ACCESS_KEY_ID", "")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "")
+	ctx := context.Background()
+
+	s3, err := NewS3(ctx, S3Options{Bucket: "backups", Region: "minio", Endpoint: server.URL, PathStyle: true, Credentials: credentials, Profile: "velero"})
+	require.NoError(t, err)
+	_, err = s3.Get(ctx, "velero/state.json")
+	assert.Equal(t, ErrNotFound, err)
+	require.NoError(t, s3.Put(ctx, "velero/state.json", []byte(`{"uid":"1"}`)))
+	assert.Equal(t, map[string]string{"/backups/velero/state.json": `{"uid":"1"}`}, objects)
+	data, err := s3.Get(ctx, "velero/state.json")
+	require.NoError(t, err)
+	assert.Equal(t, `{"uid":"1"}`, string(data))
+	assert.Equal(t, "s3://backups/velero/state.json", s3.URL("velero/state.json"))
+
+	s3, err = NewS3(ctx, S3Options{Bucket: "backups", Region: "minio", Endpoint: server.URL, PathStyle: true, Credentials: credentials})
+	require.NoError(t, err)
+	err = s3.Put(ctx, "velero/state.json", nil)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "AccessDenied")
+
+	_, err = NewS3(ctx, S3Options{Bucket: "backups"})
+	assert.EqualError(t, err, "bucket and region are required")
+}
@@ -0,0 +1,132 @@
+// Package opa evaluates Rego policies with an Open Policy Agent server,
+// through its REST API: policies are uploaded with PUT /v1/policies/<id> and
+// their decisions read with POST /v1/data/<package>.
+package opa
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// packagePattern matches the package clause of a module.
+var packagePattern = regexp.MustCompile(`(?m)^[ \t]*package[ \t]+([A-Za-z_][A-Za-z0-9_]*(?:\.[A-Za-z_][A-Za-z0-9_]*)*)[ \t]*(?:#.*)?$`)
+
+// PackagePath returns the package of a module as a data path, a.b for
+// package a.b.
+func PackagePath(module string) (string, error) {
+	match := packagePattern.FindStringSubmatch(module)
+	if match == nil {
+		return "", fmt.Errorf("the policy has no package clause")
+	}
+	return strings.ReplaceAll(match[1], ".", "/"), nil
+}
+
+// Client is an OPA server.
+type Client struct {
+	URL  string
+	HTTP *http.Client
+
+	// uploaded holds the hash of the last module uploaded under each id
+	mu       sync.Mutex
+	uploaded map[string][sha256.Size]byte
+}
+
+// NewClient returns the OPA server at baseURL.
+func NewClient(baseURL string, timeout time.Duration) *Client {
+	return &Client{URL: strings.TrimSuffix(baseURL, "/"), HTTP: &http.Client{Timeout: timeout}}
+}
+
+// Decide uploads the module under id, unless this version already was, and
+// returns the document of its package for input, nil when it is undefined.
+func (c *Client) Decide(id, module string, input interface{}) ([]byte, error) {
+	path, err := PackagePath(module)
+	if err != nil {
+		return nil, err
+	}
+	ctx := context.Background()
+	if err := c.upload(ctx, id, module); err != nil {
+		return nil, err
+	}
+
+	body, err := json.Marshal(map[string]interface{}{"input": input})
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode input: %v", err)
+	}
+	var answer struct {
+		Result json.RawMessage `json:"result"`
+	}
+	if err := c.do(ctx, http.MethodPost, "/v1/data/"+path, "application/json", body, &answer); err != nil {
+		return nil, err
+	}
+	return answer.Result, nil
+}
+
+func (c *Client) upload(ctx context.Context, id, module string) error {
+	hash := sha256.Sum256([]byte(module))
+	c.mu.Lock()
+	done := c.uploaded[id] == hash
+	c.mu.Unlock()
+	if done {
+		return nil
+	}
+
+	if err := c.do(ctx, http.MethodPut, "/v1/policies/"+url.PathEscape(id), "text/plain", []byte(module), nil); err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.uploaded == nil {
+		c.uploaded = make(map[string][sha256.Size]byte)
+	}
+	c.uploaded[id] = hash
+	return nil
+}
+
+// serverError is the body of the OPA error responses.
+type serverError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	Errors  []struct {
+		Message string `json:"message"`
+	} `json:"errors"`
+}
+
+func (c *Client) do(ctx context.Context, method, path, contentType string, body []byte, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, method, c.URL+path, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to build OPA request: %v", err)
+	}
+	req.Header.Set("Content-Type", contentType)
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to call OPA: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		var answer serverError
+		_ = json.NewDecoder(io.LimitReader(resp.Body, 64<<10)).Decode(&answer)
+		messages := []string{answer.Message}
+		for _, e := range answer.Errors {
+			messages = append(messages, e.Message)
+		}
+		return fmt.Errorf("OPA answered %s to %s %s: %s", resp.Status, method, path, strings.Join(messages, ": "))
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode OPA response: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,79 @@
+package opa
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPackagePath(t *testing.T) {
+	for module, expected := range map[string]string{
+		"package restore\n\ndeny[msg] { false }":      "restore",
+		"# policy\npackage velero.restore # rewrites": "velero/restore",
+		"  package a.b_2.c\n":                         "a/b_2/c",
+	} {
+		path, err := PackagePath(module)
+		require.NoError(t, err, module)
+		assert.Equal(t, expected, path)
+	}
+	for _, module := range []string{"", "deny[msg] { false }", "package a..b", "# package a"} {
+		_, err := PackagePath(module)
+		assert.Error(t, err, module)
+	}
+}
+
+func TestClient_Decide(t *testing.T) {
+	policies := map[string]string{}
+	uploads := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodPut && r.URL.Path == "/v1/policies/replace-pattern/broken":
+			w.WriteHeader(http.StatusBadRequest)
+			io.WriteString(w, `{"code":"invalid_parameter","message":"error(s) occurred while compiling module(s)","errors":[{"message":"rego_parse_error: unexpected eof token"}]}`)
+		case r.Method == http.MethodPut:
+			body, _ := io.ReadAll(r.Body)
+			assert.Equal(t, "text/plain", r.Header.Get("Content-Type"))
+			policies[r.URL.Path] = string(body)
+			uploads++
+			io.WriteString(w, "{}")
+		case r.Method == http.MethodPost && r.URL.Path == "/v1/data/restore":
+			var query struct {
+				Input map[string]interface{} `json:"input"`
+			}
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&query))
+			kind, _ := query.Input["kind"].(string)
+			result, _ := json.Marshal(map[string]interface{}{"deny": []string{"kind " + kind}})
+			io.WriteString(w, `{"result":`+string(result)+`}`)
+		case r.Method == http.MethodPost:
+			io.WriteString(w, "{}")
+		}
+	}))
+	defer server.Close()
+	client := NewClient(server.URL+"/", time.Second)
+
+	module := "package restore\n\ndeny[msg] { msg := sprintf(\"kind %s\", [input.kind]) }"
+	for i := 0; i < 2; i++ {
+		document, err := client.Decide("replace-pattern/kinds", module, map[string]interface{}{"kind": "Secret"})
+		require.NoError(t, err)
+		assert.JSONEq(t, `{"deny":["kind Secret"]}`, string(document))
+	}
+	assert.Equal(t, 1, uploads, "unchanged modules are uploaded once")
+	_, err := client.Decide("replace-pattern/kinds", module+"\n", nil)
+	require.NoError(t, err)
+	assert.Equal(t, 2, uploads)
+	assert.Equal(t, module+"\n", policies["/v1/policies/replace-pattern/kinds"])
+
+	document, err := client.Decide("replace-pattern/other", "package other", nil)
+	require.NoError(t, err)
+	assert.Nil(t, document, "undefined documents have no result")
+
+	_, err = client.Decide("replace-pattern/broken", "package broken\ndeny[msg] {", nil)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "rego_parse_error: unexpected eof token")
+}
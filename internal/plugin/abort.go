@@ -0,0 +1,122 @@
+package plugin
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/vmware-tanzu/velero/pkg/plugin/velero"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+const (
+	// severityCritical is the severity of the policies whose violation aborts
+	// the restore: the item and every later one are not restored.
+	severityCritical = "critical"
+	// severityDeny is the default severity of the rego policies: the item is
+	// restored untouched.
+	severityDeny = "deny"
+	// regoSeverityKey is the data key of a rego ConfigMap giving its severity.
+	regoSeverityKey = "severity"
+
+	// abortLabel marks the abort marker ConfigMap of a restore, whose value is
+	// the restore.
+	abortLabel = "agoracalyce.io/replace-pattern-abort"
+)
+
+// restoreAbort is why a restore was aborted.
+type restoreAbort struct {
+	// Item is the item violating the policy, as kind namespace/name
+	Item   string    `json:"item"`
+	Reason string    `json:"reason"`
+	Time   time.Time `json:"time"`
+}
+
+// abortConfigMapName is the name of the abort marker ConfigMap of a restore.
+func abortConfigMapName(restore string) string {
+	return fmt.Sprintf("%s-replace-pattern-abort", restore)
+}
+
+// abortRestore aborts the restore of state for a critical policy violation of
+// item: the item and the later ones are not restored, and the abort marker
+// is written at once. Dry runs only log it.
+func (p *RestorePlugin) abortRestore(state *restoreState, item *unstructured.Unstructured, reason string) {
+	abort := restoreAbort{
+		Item:   fmt.Sprintf("%s %s/%s", item.GetKind(), item.GetNamespace(), item.GetName()),
+		Reason: reason,
+		Time:   time.Now().UTC(),
+	}
+	if state.dryRun {
+		p.logger.Errorf("Dry run: the restore would be aborted by %s: %s", abort.Item, reason)
+		return
+	}
+
+	state.abortMu.Lock()
+	first := state.aborted == nil
+	if first {
+		state.aborted = &abort
+	}
+	state.abortMu.Unlock()
+	if !first {
+		if state.report != nil {
+			state.report.recordAborted()
+		}
+		return
+	}
+
+	p.logger.Errorf("Aborting the restore: %s violates a critical policy: %s. The remaining items are not restored", abort.Item, reason)
+	if state.report == nil {
+		return
+	}
+	state.report.recordAbort(abort)
+	p.flushReportNow(state.report)
+	if err := p.writeAbortMarker(state.report.summary.Restore, abort); err != nil {
+		p.logger.Warnf("Failed to write the abort marker: %v", err)
+	}
+}
+
+// abortedOutput returns the output of an item of an aborted restore, nil when
+// the restore was not aborted.
+func (p *RestorePlugin) abortedOutput(input *velero.RestoreItemActionExecuteInput, state *restoreState, clusterScoped bool) *velero.RestoreItemActionExecuteOutput {
+	state.abortMu.Lock()
+	abort := state.aborted
+	state.abortMu.Unlock()
+	if abort == nil {
+		return nil
+	}
+
+	item := &unstructured.Unstructured{Object: input.Item.UnstructuredContent()}
+	p.logger.Warnf("Skipping %s %s/%s: the restore was aborted by %s", item.GetKind(), item.GetNamespace(), item.GetName(), abort.Item)
+	if state.report != nil {
+		state.report.recordItem(false, clusterScoped)
+		state.report.recordAborted()
+		p.scheduleReportFlush(state.report)
+	}
+	return velero.NewRestoreItemActionExecuteOutput(input.Item).WithoutRestore()
+}
+
+// writeAbortMarker writes the abort marker ConfigMap of a restore, in the
+// velero namespace.
+func (p *RestorePlugin) writeAbortMarker(restore string, abort restoreAbort) error {
+	if p.readOnly || p.configMapClient == nil {
+		return nil
+	}
+	data := map[string]string{
+		"item":   abort.Item,
+		"reason": abort.Reason,
+		"time":   abort.Time.Format(time.RFC3339),
+	}
+	return p.upsertConfigMap(abortConfigMapName(restore), map[string]string{abortLabel: restore}, nil, data)
+}
+
+func (r *restoreReport) recordAbort(abort restoreAbort) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.summary.Aborted = &abort
+	r.summary.ItemsAborted++
+}
+
+func (r *restoreReport) recordAborted() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.summary.ItemsAborted++
+}
@@ -0,0 +1,158 @@
+package plugin
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	velerov1 "github.com/vmware-tanzu/velero/pkg/apis/velero/v1"
+	"github.com/vmware-tanzu/velero/pkg/plugin/velero"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func abortItems() (*unstructured.Unstructured, *unstructured.Unstructured) {
+	location := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "velero.io/v1",
+		"kind":       "BackupStorageLocation",
+		"metadata":   map[string]interface{}{"name": "default", "namespace": "velero"},
+		"spec":       map[string]interface{}{"objectStorage": map[string]interface{}{"bucket": "backups-prod"}},
+	}}
+	configMap := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "ConfigMap",
+		"metadata":   map[string]interface{}{"name": "app", "namespace": "shop"},
+		"data":       map[string]interface{}{"bucket": "backups-prod"},
+	}}
+	return location, configMap
+}
+
+func TestReplacePatternAction_CriticalAbort(t *testing.T) {
+	configMaps := fake.NewSimpleClientset().CoreV1().ConfigMaps("velero")
+	plugin := &RestorePlugin{logger: logrus.New(), configMapClient: configMaps, veleroPolicy: veleroResourcesCritical}
+	restore := &velerov1.Restore{ObjectMeta: metav1.ObjectMeta{Name: "dr-1", UID: "uid-1"}}
+	sets := ruleSetsFrom([]v1.ConfigMap{{
+		ObjectMeta: metav1.ObjectMeta{Name: "buckets"},
+		Data:       map[string]string{"backups-prod": "backups-dr"},
+	}})
+	location, configMap := abortItems()
+
+	// items before the violation are restored
+	output, err := replacePatternAction(plugin, &velero.RestoreItemActionExecuteInput{Item: configMap.DeepCopy(), Restore: restore}, sets)
+	require.NoError(t, err)
+	assert.False(t, output.SkipRestore)
+
+	output, err = replacePatternAction(plugin, &velero.RestoreItemActionExecuteInput{Item: location.DeepCopy(), Restore: restore}, sets)
+	require.NoError(t, err)
+	assert.True(t, output.SkipRestore, "the violating item is not restored")
+
+	output, err = replacePatternAction(plugin, &velero.RestoreItemActionExecuteInput{Item: configMap.DeepCopy(), Restore: restore}, sets)
+	require.NoError(t, err)
+	assert.True(t, output.SkipRestore, "nor the later ones")
+	assert.Equal(t, configMap, output.UpdatedItem, "untouched")
+
+	summary := plugin.stateFor(restore).report.summary
+	assert.Equal(t, 3, summary.ItemsProcessed)
+	assert.Equal(t, 2, summary.ItemsAborted)
+	require.NotNil(t, summary.Aborted)
+	assert.Equal(t, "BackupStorageLocation velero/default", summary.Aborted.Item)
+	assert.Equal(t, "the rules change an object of Velero", summary.Aborted.Reason)
+
+	marker, err := configMaps.Get(context.TODO(), "dr-1-replace-pattern-abort", metav1.GetOptions{})
+	require.NoError(t, err, "the marker is written at once")
+	assert.Equal(t, "dr-1", marker.Labels[abortLabel])
+	assert.Equal(t, "BackupStorageLocation velero/default", marker.Data["item"])
+	assert.Equal(t, "the rules change an object of Velero", marker.Data["reason"])
+
+	// the abort survives a restart of the plugin
+	require.NoError(t, plugin.flushReport(plugin.stateFor(restore).report))
+	plugin.states = nil
+	output, err = replacePatternAction(plugin, &velero.RestoreItemActionExecuteInput{Item: configMap.DeepCopy(), Restore: restore}, sets)
+	require.NoError(t, err)
+	assert.True(t, output.SkipRestore)
+	assert.Equal(t, 3, plugin.stateFor(restore).report.summary.ItemsAborted)
+
+	// other restores go on
+	other := &velerov1.Restore{ObjectMeta: metav1.ObjectMeta{Name: "dr-2", UID: "uid-2"}}
+	output, err = replacePatternAction(plugin, &velero.RestoreItemActionExecuteInput{Item: configMap.DeepCopy(), Restore: other}, sets)
+	require.NoError(t, err)
+	assert.False(t, output.SkipRestore)
+}
+
+func TestReplacePatternAction_CriticalAbortDryRun(t *testing.T) {
+	plugin := &RestorePlugin{logger: logrus.New(), veleroPolicy: veleroResourcesCritical, dryRun: true}
+	restore := &velerov1.Restore{ObjectMeta: metav1.ObjectMeta{Name: "dr-1", UID: "uid-1"}}
+	sets := ruleSetsFrom([]v1.ConfigMap{{
+		ObjectMeta: metav1.ObjectMeta{Name: "buckets"},
+		Data:       map[string]string{"backups-prod": "backups-dr"},
+	}})
+	location, configMap := abortItems()
+
+	_, err := replacePatternAction(plugin, &velero.RestoreItemActionExecuteInput{Item: location, Restore: restore}, sets)
+	require.NoError(t, err)
+	output, err := replacePatternAction(plugin, &velero.RestoreItemActionExecuteInput{Item: configMap, Restore: restore}, sets)
+	require.NoError(t, err)
+	assert.False(t, output.SkipRestore, "dry runs are not aborted")
+	assert.Nil(t, plugin.stateFor(restore).report.summary.Aborted)
+	assert.True(t, plugin.stateFor(restore).report.diffs["BackupStorageLocation/velero/default"].Skipped, "the violating item would not be restored")
+}
+
+func TestReplacePatternAction_CriticalRego(t *testing.T) {
+	t.Setenv(stampOriginEnv, "false")
+	plugin := &RestorePlugin{logger: logrus.New(), policies: &hostPolicy{}}
+	restore := &velerov1.Restore{ObjectMeta: metav1.ObjectMeta{Name: "dr-1", UID: "uid-1"}}
+	sets := ruleSetsFrom([]v1.ConfigMap{
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "ingresses", Annotations: map[string]string{transformerAnnotation: transformerRego}},
+			Data:       map[string]string{regoPolicyKey: "package restore.ingresses\n", regoSeverityKey: severityCritical},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "namespaces"},
+			Data:       map[string]string{"shop": "shop-dr"},
+		},
+	})
+	ingress := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "networking.k8s.io/v1",
+		"kind":       "Ingress",
+		"metadata":   map[string]interface{}{"name": "web", "namespace": "shop"},
+	}}
+
+	output, err := replacePatternAction(plugin, &velero.RestoreItemActionExecuteInput{Item: ingress, Restore: restore}, sets)
+	require.NoError(t, err)
+	assert.True(t, output.SkipRestore)
+	summary := plugin.stateFor(restore).report.summary
+	require.NotNil(t, summary.Aborted)
+	assert.Equal(t, "policy replace-pattern/ingresses denies its changes: Ingresses stay in their namespace", summary.Aborted.Reason)
+	assert.Zero(t, summary.ItemsDenied)
+}
+
+// unreachablePolicy fails every evaluation.
+type unreachablePolicy struct{}
+
+func (unreachablePolicy) Decide(string, string, interface{}) ([]byte, error) {
+	return nil, errors.New("connection refused")
+}
+
+func TestReplacePatternAction_CriticalRegoError(t *testing.T) {
+	t.Setenv(stampOriginEnv, "false")
+	plugin := &RestorePlugin{logger: logrus.New(), policies: unreachablePolicy{}}
+	restore := &velerov1.Restore{ObjectMeta: metav1.ObjectMeta{Name: "dr-1", UID: "uid-1"}}
+	sets := ruleSetsFrom([]v1.ConfigMap{{
+		ObjectMeta: metav1.ObjectMeta{Name: "ingresses", Annotations: map[string]string{transformerAnnotation: transformerRego}},
+		Data:       map[string]string{regoPolicyKey: "package restore.ingresses\n", regoSeverityKey: severityCritical},
+	}})
+	_, configMap := abortItems()
+
+	// critical policies fail closed too
+	output, err := replacePatternAction(plugin, &velero.RestoreItemActionExecuteInput{Item: configMap, Restore: restore}, sets)
+	require.NoError(t, err)
+	assert.True(t, output.SkipRestore)
+	summary := plugin.stateFor(restore).report.summary
+	require.NotNil(t, summary.Aborted)
+	assert.Contains(t, summary.Aborted.Reason, "connection refused")
+}
@@ -0,0 +1,144 @@
+package plugin
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+const (
+	// apiConcurrencyEnv is the number of API calls the transforms of items
+	// make at once in a namespace, the cluster-scoped calls sharing one.
+	// Zero means no limit.
+	apiConcurrencyEnv = "REPLACE_PATTERN_API_CONCURRENCY"
+	// apiConcurrencyTotalEnv is the number of API calls they make at once
+	// across namespaces, in a plugin process. Zero means no limit.
+	apiConcurrencyTotalEnv = "REPLACE_PATTERN_API_CONCURRENCY_TOTAL"
+
+	defaultAPIConcurrency = 4
+)
+
+// keyedSemaphore bounds the holders of each key.
+type keyedSemaphore struct {
+	limit int
+
+	mu    sync.Mutex
+	slots map[string]chan struct{}
+}
+
+func newKeyedSemaphore(limit int) *keyedSemaphore {
+	return &keyedSemaphore{limit: limit, slots: make(map[string]chan struct{})}
+}
+
+// acquire blocks until key has a free slot, and returns the function freeing
+// it.
+func (s *keyedSemaphore) acquire(key string) func() {
+	s.mu.Lock()
+	slots, ok := s.slots[key]
+	if !ok {
+		slots = make(chan struct{}, s.limit)
+		s.slots[key] = slots
+	}
+	s.mu.Unlock()
+	slots <- struct{}{}
+	return func() { <-slots }
+}
+
+// apiLimiter bounds the concurrent API calls of transforms, per namespace and
+// in total, so that the items of a namespace restored at once do not stampede
+// the API server.
+type apiLimiter struct {
+	// namespaces is nil without limit per namespace
+	namespaces *keyedSemaphore
+	// total is nil without total limit
+	total chan struct{}
+	now   func() time.Time
+}
+
+func loadAPILimiter(lookup lookupFunc, logger logrus.FieldLogger) *apiLimiter {
+	perNamespace, total := defaultAPIConcurrency, 0
+	if value, ok := lookup(apiConcurrencyEnv); ok {
+		if n, err := strconv.Atoi(value); err == nil && n >= 0 {
+			perNamespace = n
+		} else {
+			logger.Warnf("Ignoring invalid %s=%q", apiConcurrencyEnv, value)
+		}
+	}
+	if value, ok := lookup(apiConcurrencyTotalEnv); ok {
+		if n, err := strconv.Atoi(value); err == nil && n >= 0 {
+			total = n
+		} else {
+			logger.Warnf("Ignoring invalid %s=%q", apiConcurrencyTotalEnv, value)
+		}
+	}
+	return newAPILimiter(perNamespace, total)
+}
+
+func newAPILimiter(perNamespace, total int) *apiLimiter {
+	l := &apiLimiter{now: time.Now}
+	if perNamespace > 0 {
+		l.namespaces = newKeyedSemaphore(perNamespace)
+	}
+	if total > 0 {
+		l.total = make(chan struct{}, total)
+	}
+	return l
+}
+
+// acquire blocks until a call in namespace is allowed, and returns the
+// function ending it and the time it waited. The namespace slot is taken
+// first, so that a busy namespace does not hold total slots while it waits.
+func (l *apiLimiter) acquire(namespace string) (func(), time.Duration) {
+	release := func() {}
+	if l.namespaces == nil && l.total == nil {
+		return release, 0
+	}
+	start := l.now()
+	if l.namespaces != nil {
+		release = l.namespaces.acquire(namespace)
+	}
+	if l.total != nil {
+		l.total <- struct{}{}
+		releaseNamespace := release
+		release = func() {
+			<-l.total
+			releaseNamespace()
+		}
+	}
+	return release, l.now().Sub(start)
+}
+
+// getLive reads a live object of the target cluster within the API limits,
+// recording the time the call waited in the report of the restore.
+func (p *RestorePlugin) getLive(state *restoreState, gvk schema.GroupVersionKind, namespace, name string) (*unstructured.Unstructured, error) {
+	if p.apiLimiter == nil {
+		return p.liveGetter.getLive(gvk, namespace, name)
+	}
+	release, waited := p.apiLimiter.acquire(namespace)
+	defer release()
+	if state != nil && state.report != nil {
+		state.report.recordAPICall(waited)
+	}
+	return p.liveGetter.getLive(gvk, namespace, name)
+}
+
+// recordAPICall counts an API call of the transforms and the time it was
+// queued.
+func (r *restoreReport) recordAPICall(waited time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.summary.APICalls++
+	if waited < time.Millisecond {
+		return
+	}
+	ms := waited.Milliseconds()
+	r.summary.APICallsQueued++
+	r.summary.APIQueueMilliseconds += ms
+	if ms > r.summary.APIMaxQueueMilliseconds {
+		r.summary.APIMaxQueueMilliseconds = ms
+	}
+}
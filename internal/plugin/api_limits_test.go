@@ -0,0 +1,121 @@
+package plugin
+
+import (
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func TestLoadAPILimiter(t *testing.T) {
+	l := loadAPILimiter(os.LookupEnv, logrus.New())
+	require.NotNil(t, l.namespaces)
+	assert.Equal(t, defaultAPIConcurrency, l.namespaces.limit)
+	assert.Nil(t, l.total)
+
+	t.Setenv(apiConcurrencyEnv, "0")
+	t.Setenv(apiConcurrencyTotalEnv, "10")
+	l = loadAPILimiter(os.LookupEnv, logrus.New())
+	assert.Nil(t, l.namespaces)
+	assert.Equal(t, 10, cap(l.total))
+
+	t.Setenv(apiConcurrencyEnv, "-1")
+	t.Setenv(apiConcurrencyTotalEnv, "many")
+	l = loadAPILimiter(os.LookupEnv, logrus.New())
+	assert.Equal(t, defaultAPIConcurrency, l.namespaces.limit)
+	assert.Nil(t, l.total)
+}
+
+// peakCalls makes calls concurrent calls in each namespace through l, and
+// returns the most that ran at once in a namespace, and in total.
+func peakCalls(l *apiLimiter, namespaces []string, calls int) (int, int) {
+	var mu sync.Mutex
+	running := make(map[string]int)
+	total, namespacePeak, peak := 0, 0, 0
+	var wg sync.WaitGroup
+	for _, ns := range namespaces {
+		for i := 0; i < calls; i++ {
+			wg.Add(1)
+			go func(ns string) {
+				defer wg.Done()
+				release, _ := l.acquire(ns)
+				defer release()
+				mu.Lock()
+				running[ns]++
+				total++
+				if running[ns] > namespacePeak {
+					namespacePeak = running[ns]
+				}
+				if total > peak {
+					peak = total
+				}
+				mu.Unlock()
+				time.Sleep(5 * time.Millisecond)
+				mu.Lock()
+				running[ns]--
+				total--
+				mu.Unlock()
+			}(ns)
+		}
+	}
+	wg.Wait()
+	return namespacePeak, peak
+}
+
+func TestAPILimiter_PerNamespace(t *testing.T) {
+	namespacePeak, peak := peakCalls(newAPILimiter(2, 0), []string{"shop", "billing", ""}, 8)
+	assert.Equal(t, 2, namespacePeak)
+	assert.Greater(t, peak, 2, "namespaces do not wait for each other")
+	assert.LessOrEqual(t, peak, 6)
+}
+
+func TestAPILimiter_Total(t *testing.T) {
+	namespacePeak, peak := peakCalls(newAPILimiter(2, 3), []string{"shop", "billing", ""}, 8)
+	assert.LessOrEqual(t, namespacePeak, 2)
+	assert.Equal(t, 3, peak)
+}
+
+func TestAPILimiter_Unlimited(t *testing.T) {
+	l := newAPILimiter(0, 0)
+	releases := make([]func(), 0, 100)
+	for i := 0; i < 100; i++ {
+		release, waited := l.acquire("shop")
+		assert.Zero(t, waited)
+		releases = append(releases, release)
+	}
+	for _, release := range releases {
+		release()
+	}
+}
+
+func TestGetLive_RecordsQueueTime(t *testing.T) {
+	live := &unstructured.Unstructured{Object: map[string]interface{}{"apiVersion": "v1", "kind": "ConfigMap"}}
+	limiter := newAPILimiter(1, 0)
+	start := time.Unix(0, 0)
+	waits := []time.Duration{0, 0, 0, 250 * time.Millisecond, 0, 40 * time.Millisecond}
+	limiter.now = func() time.Time {
+		wait := waits[0]
+		waits = waits[1:]
+		start = start.Add(wait)
+		return start
+	}
+	plugin := &RestorePlugin{logger: logrus.New(), liveGetter: &stubLiveGetter{live: live}, apiLimiter: limiter}
+	state := &restoreState{report: newRestoreReport("restore")}
+
+	for i := 0; i < 3; i++ {
+		got, err := plugin.getLive(state, schema.GroupVersionKind{Version: "v1", Kind: "ConfigMap"}, "shop", "app")
+		require.NoError(t, err)
+		assert.Equal(t, live, got)
+	}
+	summary := state.report.summary
+	assert.Equal(t, 3, summary.APICalls)
+	assert.Equal(t, 2, summary.APICallsQueued)
+	assert.Equal(t, int64(290), summary.APIQueueMilliseconds)
+	assert.Equal(t, int64(250), summary.APIMaxQueueMilliseconds)
+}
@@ -0,0 +1,70 @@
+package plugin
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// apiVersionsAnnotation scopes a pattern ConfigMap to a comma separated list
+// of API groups and versions: group/version as in apiVersion (e.g. "v1",
+// "apps/v1"), or a group alone for all its versions (e.g. "apps",
+// "networking.k8s.io", "core" for the core group). With the
+// resourcesAnnotation, items must match both.
+const apiVersionsAnnotation = "agoracalyce.io/api-versions"
+
+// coreGroup names the core API group, whose name is empty.
+const coreGroup = "core"
+
+// kubeVersion matches the versions of API groups.
+var kubeVersion = regexp.MustCompile(`^v[0-9]+((alpha|beta)[0-9]+)?$`)
+
+// apiVersionFilter is an entry of the apiVersionsAnnotation. version is
+// empty for all the versions of group.
+type apiVersionFilter struct {
+	group, version string
+}
+
+// parseAPIVersionFilter parses an entry of the apiVersionsAnnotation.
+func parseAPIVersionFilter(entry string) (apiVersionFilter, error) {
+	entry = strings.TrimSpace(entry)
+	switch {
+	case entry == "":
+		return apiVersionFilter{}, fmt.Errorf("empty API version")
+	case entry == coreGroup:
+		return apiVersionFilter{}, nil
+	case kubeVersion.MatchString(entry):
+		return apiVersionFilter{version: entry}, nil
+	case !strings.Contains(entry, "/"):
+		return apiVersionFilter{group: entry}, nil
+	}
+	gv, err := schema.ParseGroupVersion(entry)
+	if err != nil || gv.Group == "" || !kubeVersion.MatchString(gv.Version) {
+		return apiVersionFilter{}, fmt.Errorf("invalid API version %q", entry)
+	}
+	return apiVersionFilter{group: gv.Group, version: gv.Version}, nil
+}
+
+func (f apiVersionFilter) matches(gv schema.GroupVersion) bool {
+	return f.group == gv.Group && (f.version == "" || f.version == gv.Version)
+}
+
+// matchesAPIVersions reports whether gv is one of the API versions listed in
+// an apiVersionsAnnotation value. Invalid entries match nothing, with a
+// warning.
+func matchesAPIVersions(apiVersions string, gv schema.GroupVersion, logger logrus.FieldLogger) bool {
+	for _, entry := range strings.Split(apiVersions, ",") {
+		filter, err := parseAPIVersionFilter(entry)
+		if err != nil {
+			logger.Warnf("Ignoring %s in %s annotation", err, apiVersionsAnnotation)
+			continue
+		}
+		if filter.matches(gv) {
+			return true
+		}
+	}
+	return false
+}
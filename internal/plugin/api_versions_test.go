@@ -0,0 +1,64 @@
+package plugin
+
+import (
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func TestParseAPIVersionFilter(t *testing.T) {
+	for entry, want := range map[string]apiVersionFilter{
+		"v1":                   {version: "v1"},
+		" core ":               {},
+		"apps":                 {group: "apps"},
+		"apps/v1":              {group: "apps", version: "v1"},
+		"cert-manager.io/v1":   {group: "cert-manager.io", version: "v1"},
+		"batch/v1beta1":        {group: "batch", version: "v1beta1"},
+		"networking.k8s.io":    {group: "networking.k8s.io"},
+		"argoproj.io/v1alpha1": {group: "argoproj.io", version: "v1alpha1"},
+	} {
+		filter, err := parseAPIVersionFilter(entry)
+		assert.NoError(t, err, entry)
+		assert.Equal(t, want, filter, entry)
+	}
+	for _, entry := range []string{"", "apps/latest", "/v1", "apps/v1/deployments"} {
+		_, err := parseAPIVersionFilter(entry)
+		assert.Error(t, err, entry)
+	}
+}
+
+func TestMatchesAPIVersions(t *testing.T) {
+	logger := logrus.New()
+	assert.True(t, matchesAPIVersions("v1", schema.GroupVersion{Version: "v1"}, logger))
+	assert.False(t, matchesAPIVersions("v1", schema.GroupVersion{Group: "apps", Version: "v1"}, logger), "v1 is the core group")
+	assert.True(t, matchesAPIVersions("core", schema.GroupVersion{Version: "v1"}, logger))
+	assert.True(t, matchesAPIVersions("apps/v1, batch", schema.GroupVersion{Group: "batch", Version: "v1beta1"}, logger))
+	assert.False(t, matchesAPIVersions("apps/v1", schema.GroupVersion{Group: "apps", Version: "v1beta2"}, logger))
+	assert.False(t, matchesAPIVersions("apps/latest", schema.GroupVersion{Group: "apps", Version: "v1"}, logger), "invalid entries match nothing")
+}
+
+func TestConfigMapsFor_APIVersions(t *testing.T) {
+	configMaps := []v1.ConfigMap{
+		{ObjectMeta: metav1.ObjectMeta{Name: "all"}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "built-in", Annotations: map[string]string{apiVersionsAnnotation: "core,apps,batch/v1"}}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "v1-workloads", Annotations: map[string]string{apiVersionsAnnotation: "apps/v1", resourcesAnnotation: "Deployment,StatefulSet"}}},
+	}
+	names := func(configMaps []v1.ConfigMap) []string {
+		var out []string
+		for _, cm := range configMaps {
+			out = append(out, cm.Name)
+		}
+		return out
+	}
+
+	plugin := &RestorePlugin{logger: logrus.New()}
+	assert.Equal(t, []string{"all", "built-in", "v1-workloads"}, names(plugin.configMapsFor(schema.GroupVersionKind{Group: "apps", Version: "v1", Kind: "Deployment"}, configMaps)))
+	assert.Equal(t, []string{"all", "built-in"}, names(plugin.configMapsFor(schema.GroupVersionKind{Group: "apps", Version: "v1", Kind: "DaemonSet"}, configMaps)))
+	assert.Equal(t, []string{"all", "built-in"}, names(plugin.configMapsFor(schema.GroupVersionKind{Version: "v1", Kind: "Service"}, configMaps)))
+	assert.Equal(t, []string{"all"}, names(plugin.configMapsFor(schema.GroupVersionKind{Group: "batch", Version: "v1beta1", Kind: "CronJob"}, configMaps)))
+	assert.Equal(t, []string{"all"}, names(plugin.configMapsFor(schema.GroupVersionKind{Group: "cert-manager.io", Version: "v1", Kind: "Certificate"}, configMaps)), "custom resources are left alone")
+}
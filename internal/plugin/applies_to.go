@@ -0,0 +1,115 @@
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	velerov1 "github.com/vmware-tanzu/velero/pkg/apis/velero/v1"
+	"github.com/wrkt/velero-custom-plugins/internal/transform"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// appliesToResources returns the resources the rules can change, in the
+// resource.group form Velero resolves, or nil when they may change any: when
+// a ConfigMap is not scoped with the resources annotation, or without
+// discovery. Gateway API resources are always included, their references
+// following the Restore's namespace mapping whatever the rules.
+func (p *RestorePlugin) appliesToResources(configMaps []v1.ConfigMap) []string {
+	if p.resolver == nil || p.resolver.lister == nil {
+		return nil
+	}
+
+	included := make(map[string]bool)
+	for _, configMap := range configMaps {
+		resources, scoped := configMap.Annotations[resourcesAnnotation]
+		if !scoped {
+			return nil
+		}
+		for _, name := range strings.Split(resources, ",") {
+			// unknown names match no item, Execute warns about them
+			gk, ok := p.resolver.resolve(name)
+			if !ok {
+				continue
+			}
+			if gvr, ok := p.resolver.resourceFor(gk); ok {
+				included[gvr.GroupResource().String()] = true
+			}
+		}
+	}
+	if len(included) == 0 {
+		return nil
+	}
+	for _, gr := range p.resolver.groupResources(transform.GatewayGroup) {
+		included[gr.String()] = true
+	}
+
+	resources := make([]string, 0, len(included))
+	for resource := range included {
+		resources = append(resources, resource)
+	}
+	sort.Strings(resources)
+	return resources
+}
+
+// allItemFeatures returns the enabled features acting on every item, not only
+// on the ones the rules change, which need every resource routed through the
+// plugin. The features Restores enable with their annotations are read from
+// the restores in progress.
+func (p *RestorePlugin) allItemFeatures(configMaps []v1.ConfigMap) []string {
+	var features []string
+	if !p.skipOrigin && stampOrigin(p.setting) {
+		features = append(features, "the original identity annotations")
+	}
+	rate, _ := p.setting(logSampleRateEnv)
+	namespaces, _ := p.setting(logNamespacesEnv)
+	if fraction, err := strconv.ParseFloat(rate, 64); (err == nil && fraction < 1) || strings.TrimSpace(namespaces) != "" {
+		features = append(features, "log sampling")
+	}
+	if p.veleroPolicy == veleroResourcesCritical {
+		features = append(features, "the critical policy of the Velero resources")
+	}
+	for _, configMap := range configMaps {
+		if strings.TrimSpace(configMap.Annotations[transformerAnnotation]) == transformerRego && strings.TrimSpace(configMap.Data[regoSeverityKey]) == severityCritical {
+			features = append(features, "the critical policy "+configMap.Name)
+		}
+	}
+
+	// a Restore without annotations stands for the settings
+	restores := []velerov1.Restore{{}}
+	if p.restores != nil {
+		list, err := p.restores.List(context.TODO(), metav1.ListOptions{})
+		if err != nil {
+			return append(features, fmt.Sprintf("the restores, which cannot be listed: %v", err))
+		}
+		for _, restore := range list.Items {
+			if restore.Status.Phase == velerov1.RestorePhaseNew || restore.Status.Phase == velerov1.RestorePhaseInProgress {
+				restores = append(restores, restore)
+			}
+		}
+	}
+	for i := range restores {
+		restore := &restores[i]
+		if p.isDryRun(restore) {
+			features = append(features, "the dry run"+restoreSuffix(restore))
+		}
+		if differentialEnabled(restore) {
+			features = append(features, "the differential restore"+restoreSuffix(restore))
+		}
+		if p.freezeTransformer(restore) != nil {
+			features = append(features, "the freeze window"+restoreSuffix(restore))
+		}
+	}
+	return features
+}
+
+// restoreSuffix names a restore in progress, nothing for the settings.
+func restoreSuffix(restore *velerov1.Restore) string {
+	if restore.Name == "" {
+		return ""
+	}
+	return " of Restore " + restore.Name
+}
@@ -0,0 +1,123 @@
+package plugin
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	velerov1 "github.com/vmware-tanzu/velero/pkg/apis/velero/v1"
+	velerofake "github.com/vmware-tanzu/velero/pkg/generated/clientset/versioned/fake"
+	"github.com/wrkt/velero-custom-plugins/mocks"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func scopedConfigMap(name, resources string) v1.ConfigMap {
+	configMap := v1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: name}}
+	if resources != "" {
+		configMap.Annotations = map[string]string{resourcesAnnotation: resources}
+	}
+	return configMap
+}
+
+func TestAppliesToResources(t *testing.T) {
+	lister := newStubResourceLister()
+	lister.lists = append(lister.lists, &metav1.APIResourceList{
+		GroupVersion: "gateway.networking.k8s.io/v1",
+		APIResources: []metav1.APIResource{
+			{Name: "httproutes", SingularName: "httproute", Kind: "HTTPRoute", Namespaced: true},
+		},
+	})
+	plugin := &RestorePlugin{logger: logrus.New(), resolver: newResourceResolver(lister, logrus.New())}
+
+	assert.Equal(t, []string{"deployments.apps", "httproutes.gateway.networking.k8s.io", "ingresses.networking.k8s.io", "services"},
+		plugin.appliesToResources([]v1.ConfigMap{
+			scopedConfigMap("hosts", "ing, svc"),
+			scopedConfigMap("images", "deploy,widgets"),
+		}))
+
+	// an unscoped ConfigMap applies to every resource
+	assert.Nil(t, plugin.appliesToResources([]v1.ConfigMap{
+		scopedConfigMap("hosts", "ing"),
+		scopedConfigMap("everything", ""),
+	}))
+	assert.Nil(t, plugin.appliesToResources([]v1.ConfigMap{scopedConfigMap("unknown", "widgets")}))
+
+	// so does any ConfigMap without discovery
+	local := &RestorePlugin{logger: logrus.New(), resolver: newResourceResolver(nil, logrus.New())}
+	assert.Nil(t, local.appliesToResources([]v1.ConfigMap{scopedConfigMap("hosts", "ing")}))
+}
+
+func TestAppliesTo(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	t.Setenv(stampOriginEnv, "false")
+	mockConfigMapClient := mocks.NewMockConfigMapInterface(ctrl)
+	plugin := &RestorePlugin{
+		logger:          logrus.New(),
+		configMapClient: mockConfigMapClient,
+		resolver:        newResourceResolver(newStubResourceLister(), logrus.New()),
+	}
+	appliesTo := func(configMaps ...v1.ConfigMap) []string {
+		mockConfigMapClient.EXPECT().List(gomock.Any(), gomock.Any()).
+			Return(&v1.ConfigMapList{Items: configMaps}, nil)
+		selector, err := plugin.AppliesTo()
+		require.NoError(t, err)
+		return selector.IncludedResources
+	}
+
+	assert.Equal(t, []string{"ingresses.networking.k8s.io"}, appliesTo(scopedConfigMap("hosts", "ing")))
+	assert.Empty(t, appliesTo())
+
+	// the features acting on every item route every resource
+	for name, enable := range map[string]func() func(){
+		"origin": func() func() {
+			t.Setenv(stampOriginEnv, "true")
+			return func() { t.Setenv(stampOriginEnv, "false") }
+		},
+		"sampling": func() func() {
+			t.Setenv(logSampleRateEnv, "0.1")
+			return func() { os.Unsetenv(logSampleRateEnv) }
+		},
+		"dry run": func() func() {
+			plugin.dryRun = true
+			return func() { plugin.dryRun = false }
+		},
+		"freeze": func() func() {
+			plugin.freezeWindow = time.Hour
+			return func() { plugin.freezeWindow = 0 }
+		},
+		"critical Velero resources": func() func() {
+			plugin.veleroPolicy = veleroResourcesCritical
+			return func() { plugin.veleroPolicy = "" }
+		},
+		"differential restore": func() func() {
+			plugin.restores = velerofake.NewSimpleClientset(&velerov1.Restore{
+				ObjectMeta: metav1.ObjectMeta{Name: "dr-1", Namespace: "velero", Annotations: map[string]string{differentialAnnotation: "true"}},
+				Status:     velerov1.RestoreStatus{Phase: velerov1.RestorePhaseInProgress},
+			}).VeleroV1().Restores("velero")
+			return func() { plugin.restores = nil }
+		},
+	} {
+		disable := enable()
+		assert.Empty(t, appliesTo(scopedConfigMap("hosts", "ing")), name)
+		disable()
+	}
+
+	critical := scopedConfigMap("policy", "ing")
+	critical.Annotations[transformerAnnotation] = transformerRego
+	critical.Data = map[string]string{regoSeverityKey: severityCritical}
+	assert.Empty(t, appliesTo(critical), "a critical policy aborts the restore of every item")
+
+	// a completed differential restore does not matter
+	plugin.restores = velerofake.NewSimpleClientset(&velerov1.Restore{
+		ObjectMeta: metav1.ObjectMeta{Name: "dr-0", Namespace: "velero", Annotations: map[string]string{differentialAnnotation: "true"}},
+		Status:     velerov1.RestoreStatus{Phase: velerov1.RestorePhaseCompleted},
+	}).VeleroV1().Restores("velero")
+	assert.Equal(t, []string{"ingresses.networking.k8s.io"}, appliesTo(scopedConfigMap("hosts", "ing")))
+}
@@ -0,0 +1,105 @@
+package plugin
+
+import (
+	"fmt"
+	"runtime"
+	"runtime/debug"
+	"sort"
+	"strings"
+)
+
+// RuleFormatVersion is the version of the format of the rule ConfigMaps,
+// raised when rules written for a release would be read differently by
+// earlier ones. New transformers and annotations do not raise it: rule
+// authors check them in the capabilities.
+const RuleFormatVersion = 1
+
+// Version is the version of the engine, set at build time with
+//
+//	-ldflags "-X github.com/wrkt/velero-custom-plugins/internal/plugin.Version=1.4.0"
+//
+// The version of the main module is used when it is empty.
+var Version string
+
+// transformers are the values of the agoracalyce.io/transformer annotation the
+// engine understands.
+var transformers = []string{
+	transformerLiteral, transformerIdentity, transformerCloudIDs, transformerLBs, transformerLists,
+	transformerCron, transformerCapacity, transformerSecrets, transformerXP, transformerKEDA,
+	transformerFlows, transformerKnative, transformerSvcIPs, transformerPorts, transformerIngress,
+	transformerRegex, transformerTargets, transformerPatch, transformerMerge, transformerVersions,
+	transformerJQ, transformerLua, transformerStarlark, transformerRego, transformerTopology,
+	transformerDevices, transformerPinning, transformerRemoved, transformerOrder, transformerNSPolicy,
+	transformerChainOrder, transformerResourceModifiers,
+}
+
+// ruleAnnotations are the annotations of the rule ConfigMaps the engine
+// understands.
+var ruleAnnotations = []string{
+	transformerAnnotation, scopeAnnotation, pathsAnnotation, valuesOnlyAnnotation, priorityAnnotation, resourcesAnnotation, apiVersionsAnnotation,
+	conditionAnnotation, patternConditionsAnnotation, matchOptionsAnnotation, excludeLabelsAnnotation, excludeAnnotationsAnnotation,
+	excludePathsAnnotation, excludeStringsAnnotation, clustersAnnotation, templatesAnnotation,
+	restoreSelectorAnnotation, rulesVersionAnnotation, stageAnnotation,
+}
+
+// Capabilities describe what rules the engine of a binary understands, for
+// rule authors targeting several releases.
+type Capabilities struct {
+	EngineVersion     string `json:"engineVersion"`
+	Revision          string `json:"revision,omitempty"`
+	GoVersion         string `json:"goVersion"`
+	RuleFormatVersion int    `json:"ruleFormatVersion"`
+	// Transformers and Annotations are sorted
+	Transformers []string `json:"transformers"`
+	Annotations  []string `json:"annotations"`
+	// Dependencies maps the modules built in to their versions
+	Dependencies map[string]string `json:"dependencies,omitempty"`
+}
+
+// GetCapabilities returns the capabilities of the running binary.
+func GetCapabilities() Capabilities {
+	c := Capabilities{
+		EngineVersion:     Version,
+		GoVersion:         runtime.Version(),
+		RuleFormatVersion: RuleFormatVersion,
+		Transformers:      append([]string{}, transformers...),
+		Annotations:       append([]string{}, ruleAnnotations...),
+	}
+	sort.Strings(c.Transformers)
+	sort.Strings(c.Annotations)
+
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		if c.EngineVersion == "" {
+			c.EngineVersion = "unknown"
+		}
+		return c
+	}
+	if c.EngineVersion == "" {
+		c.EngineVersion = info.Main.Version
+	}
+	for _, setting := range info.Settings {
+		if setting.Key == "vcs.revision" {
+			c.Revision = setting.Value
+		}
+	}
+	c.Dependencies = make(map[string]string, len(info.Deps))
+	for _, dep := range info.Deps {
+		version := dep.Version
+		if dep.Replace != nil {
+			// as go version -m prints them
+			version = strings.TrimSpace(version + " => " + dep.Replace.Path + " " + dep.Replace.Version)
+		}
+		c.Dependencies[dep.Path] = version
+	}
+	return c
+}
+
+// String sums up the capabilities in a log line.
+func (c Capabilities) String() string {
+	version := c.EngineVersion
+	if c.Revision != "" {
+		version += " (" + c.Revision + ")"
+	}
+	return fmt.Sprintf("engine %s, rule format %d, transformers %s", version, c.RuleFormatVersion, strings.Join(c.Transformers, ", "))
+}
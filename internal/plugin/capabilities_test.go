@@ -0,0 +1,32 @@
+package plugin
+
+import (
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCapabilities(t *testing.T) {
+	c := GetCapabilities()
+	assert.Equal(t, RuleFormatVersion, c.RuleFormatVersion)
+	assert.NotEmpty(t, c.EngineVersion)
+	assert.IsIncreasing(t, c.Transformers)
+	assert.IsIncreasing(t, c.Annotations)
+	assert.Contains(t, c.Annotations, pathsAnnotation)
+
+	// every transformer listed is known to build, configured or not
+	for _, name := range c.Transformers {
+		if name == transformerLiteral || name == transformerChainOrder {
+			continue
+		}
+		_, err := ruleSet{transformer: name, config: map[string]string{}}.build(logrus.New())
+		if err != nil {
+			assert.NotContains(t, err.Error(), "unknown transformer", name)
+		}
+	}
+
+	Version = "1.4.0"
+	defer func() { Version = "" }()
+	assert.Contains(t, GetCapabilities().String(), "engine 1.4.0")
+}
@@ -0,0 +1,269 @@
+package plugin
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/wrkt/velero-custom-plugins/internal/transform"
+	"sigs.k8s.io/yaml"
+)
+
+// transformerChainOrder configures the order of the steps of the chain, per
+// kind, rather than a transformer. Each data key is a kind, its value a
+// chainOrder in YAML.
+const transformerChainOrder = "chain-order"
+
+// The steps the plugin appends to the chain after those of the rule sets.
+const (
+	stepLastApplied = "last-applied"
+	stepFieldRefs   = "field-refs"
+	stepGatewayRefs = "gateway-refs"
+	stepFreeze      = "freeze"
+	stepOrigin      = "origin"
+)
+
+// chainStep is a transformer of the chain. A chain-order ConfigMap selects it
+// by name or by kind.
+type chainStep struct {
+	// name is the rule ConfigMap configuring the step, or the name of a
+	// built-in step
+	name string
+	// kind is the transformer annotation of the ConfigMap, or the name of a
+	// built-in step
+	kind        string
+	transformer transform.Transformer
+}
+
+// setStep returns the step of the transformer built from set.
+func setStep(set ruleSet, transformer transform.Transformer) chainStep {
+	kind := set.transformer
+	if set.isLiteral() {
+		kind = transformerLiteral
+	}
+	return chainStep{name: set.name, kind: kind, transformer: transformer}
+}
+
+// builtinStep returns a built-in step of the chain.
+func builtinStep(name string, transformer transform.Transformer) chainStep {
+	return chainStep{name: name, kind: name, transformer: transformer}
+}
+
+// is reports whether selector, a ConfigMap name or a kind, selects the step.
+func (s chainStep) is(selector string) bool {
+	return selector == s.name || selector == s.kind
+}
+
+func (s chainStep) String() string {
+	if s.name == s.kind {
+		return s.name
+	}
+	return fmt.Sprintf("%s %s", s.kind, s.name)
+}
+
+// chainOrder rearranges the steps of the chain of the items of a kind.
+type chainOrder struct {
+	// Order lists steps in the order they run, at the places the steps it
+	// selects held.
+	Order []string `json:"order"`
+	// Insert moves steps next to another.
+	Insert []chainInsert `json:"insert"`
+	// Disable lists the steps left out.
+	Disable []string `json:"disable"`
+}
+
+// chainInsert moves the steps Step selects right before the first step Before
+// selects, or right after the last step After selects.
+type chainInsert struct {
+	Step   string `json:"step"`
+	Before string `json:"before"`
+	After  string `json:"after"`
+}
+
+// chainConstraints are the orders no chain-order ConfigMap may break: the steps
+// first selects run before those then selects, an empty selector selecting
+// every other step.
+var chainConstraints = []struct {
+	first, then string
+	reason      string
+}{
+	{transformerVersions, "", "the other transformers expect the current schemas"},
+	{"", stepOrigin, "the original identity is stamped last"},
+	{transformerLiteral, stepFieldRefs, "the patterns would rewrite the field paths it restores"},
+	{transformerRegex, stepFieldRefs, "the patterns would rewrite the field paths it restores"},
+}
+
+// isChainOrder reports whether the set configures the order of the chain.
+func (s ruleSet) isChainOrder() bool {
+	return s.transformer == transformerChainOrder
+}
+
+// chainOrders parses and validates the orders of a chain-order set, by kind.
+func (s ruleSet) chainOrders() (map[string]chainOrder, error) {
+	orders := make(map[string]chainOrder, len(s.config))
+	for kind, data := range s.config {
+		var order chainOrder
+		if err := yaml.UnmarshalStrict([]byte(data), &order); err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %v", kind, err)
+		}
+		if err := order.validate(); err != nil {
+			return nil, fmt.Errorf("%s: %v", kind, err)
+		}
+		orders[kind] = order
+	}
+	return orders, nil
+}
+
+func (o chainOrder) validate() error {
+	for _, selector := range append(append([]string{}, o.Order...), o.Disable...) {
+		if selector == "" {
+			return fmt.Errorf("empty step")
+		}
+	}
+	for _, selector := range o.Disable {
+		if selector == transformerRego {
+			return fmt.Errorf("%s steps cannot be disabled: policies always apply", transformerRego)
+		}
+	}
+	for i, insert := range o.Insert {
+		if (insert.Before == "") == (insert.After == "") {
+			return fmt.Errorf("insert %d: exactly one of before and after must be set", i)
+		}
+		if insert.Step == "" || insert.Step == insert.Before+insert.After {
+			return fmt.Errorf("insert %d: step must be set and differ from its anchor", i)
+		}
+	}
+	return nil
+}
+
+// arrange returns the steps disabled, reordered then moved as the order says,
+// or an error when the result breaks a chainConstraint. Selectors matching no
+// step of the chain are ignored.
+func (o chainOrder) arrange(steps []chainStep) ([]chainStep, error) {
+	arranged := make([]chainStep, 0, len(steps))
+	for _, step := range steps {
+		if !selects(o.Disable, step) {
+			arranged = append(arranged, step)
+			continue
+		}
+		if step.kind == transformerRego {
+			return nil, fmt.Errorf("%s cannot be disabled: policies always apply", step)
+		}
+	}
+	arranged = o.reorder(arranged)
+	for _, insert := range o.Insert {
+		arranged = insert.apply(arranged)
+	}
+	if err := checkChain(arranged); err != nil {
+		return nil, err
+	}
+	return arranged, nil
+}
+
+// reorder sorts the steps Order selects among the places they hold.
+func (o chainOrder) reorder(steps []chainStep) []chainStep {
+	rank := func(step chainStep) int {
+		for i, selector := range o.Order {
+			if step.is(selector) {
+				return i
+			}
+		}
+		return -1
+	}
+	var places []int
+	var selected []chainStep
+	for i, step := range steps {
+		if rank(step) >= 0 {
+			places = append(places, i)
+			selected = append(selected, step)
+		}
+	}
+	sort.SliceStable(selected, func(i, j int) bool { return rank(selected[i]) < rank(selected[j]) })
+	reordered := append([]chainStep{}, steps...)
+	for i, place := range places {
+		reordered[place] = selected[i]
+	}
+	return reordered
+}
+
+func (i chainInsert) apply(steps []chainStep) []chainStep {
+	var moved, rest []chainStep
+	for _, step := range steps {
+		if step.is(i.Step) {
+			moved = append(moved, step)
+		} else {
+			rest = append(rest, step)
+		}
+	}
+	at := -1
+	for j, step := range rest {
+		if i.Before != "" && step.is(i.Before) {
+			at = j
+			break
+		}
+		if i.After != "" && step.is(i.After) {
+			at = j + 1
+		}
+	}
+	if len(moved) == 0 || at < 0 {
+		return steps
+	}
+	inserted := make([]chainStep, 0, len(steps))
+	inserted = append(append(append(inserted, rest[:at]...), moved...), rest[at:]...)
+	return inserted
+}
+
+// checkChain returns an error naming the first pair of steps breaking a
+// chainConstraint.
+func checkChain(steps []chainStep) error {
+	matches := func(selector string, step chainStep) bool {
+		return selector == "" || step.kind == selector
+	}
+	for i, later := range steps {
+		for _, earlier := range steps[:i] {
+			if earlier.kind == later.kind {
+				continue
+			}
+			for _, constraint := range chainConstraints {
+				if matches(constraint.first, later) && matches(constraint.then, earlier) {
+					return fmt.Errorf("%s must run before %s: %s", later, earlier, constraint.reason)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func selects(selectors []string, step chainStep) bool {
+	for _, selector := range selectors {
+		if step.is(selector) {
+			return true
+		}
+	}
+	return false
+}
+
+// arrangeChain applies the chain-order sets to the steps of an item of the
+// kind, in turn. A set that is invalid or breaks a chainConstraint is ignored.
+func (p *RestorePlugin) arrangeChain(sets []ruleSet, kind string, steps []chainStep) []chainStep {
+	for _, set := range sets {
+		if !set.isChainOrder() {
+			continue
+		}
+		orders, err := set.chainOrders()
+		if err != nil {
+			p.logger.Warnf("Ignoring ConfigMap %s: %v", set.name, err)
+			continue
+		}
+		order, ok := orders[kind]
+		if !ok {
+			continue
+		}
+		arranged, err := order.arrange(steps)
+		if err != nil {
+			p.logger.Warnf("Ignoring ConfigMap %s for %s: %v", set.name, kind, err)
+			continue
+		}
+		steps = arranged
+	}
+	return steps
+}
@@ -0,0 +1,129 @@
+package plugin
+
+import (
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	velerov1 "github.com/vmware-tanzu/velero/pkg/apis/velero/v1"
+	"github.com/vmware-tanzu/velero/pkg/plugin/velero"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestChainOrders(t *testing.T) {
+	set := ruleSet{name: "order", transformer: transformerChainOrder, config: map[string]string{
+		"Pod": "order: [image-pinning, literal]\ninsert:\n- step: cleanup\n  after: field-refs\ndisable: [gateway-refs]\n",
+	}}
+	orders, err := set.chainOrders()
+	require.NoError(t, err)
+	assert.Equal(t, map[string]chainOrder{"Pod": {
+		Order:   []string{"image-pinning", "literal"},
+		Insert:  []chainInsert{{Step: "cleanup", After: "field-refs"}},
+		Disable: []string{"gateway-refs"},
+	}}, orders)
+
+	for data, message := range map[string]string{
+		"ordre: [literal]":          "failed to parse Pod",
+		"order: ['']":               "empty step",
+		"disable: [rego]":           "policies always apply",
+		"insert: [{step: cleanup}]": "exactly one of before and after",
+		"insert: [{step: cleanup, before: a, after: b}]": "exactly one of before and after",
+		"insert: [{step: literal, before: literal}]":     "differ from its anchor",
+	} {
+		_, err := ruleSet{config: map[string]string{"Pod": data}}.chainOrders()
+		assert.ErrorContains(t, err, message, data)
+	}
+}
+
+func TestChainOrder_Arrange(t *testing.T) {
+	steps := []chainStep{
+		{name: "versions", kind: transformerVersions},
+		{name: "hosts", kind: transformerLiteral},
+		{name: "images", kind: transformerRegex},
+		{name: "pins", kind: transformerPinning},
+		{name: "cleanup", kind: transformerJQ},
+		{name: "policy", kind: transformerRego},
+		builtinStep(stepFieldRefs, nil),
+		builtinStep(stepGatewayRefs, nil),
+		builtinStep(stepOrigin, nil),
+	}
+	names := func(steps []chainStep) []string {
+		var names []string
+		for _, step := range steps {
+			names = append(names, step.name)
+		}
+		return names
+	}
+
+	arranged, err := chainOrder{Order: []string{transformerPinning, transformerLiteral}}.arrange(steps)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"versions", "pins", "images", "hosts", "cleanup", "policy", stepFieldRefs, stepGatewayRefs, stepOrigin}, names(arranged),
+		"the steps selected swap places, the others keep theirs")
+
+	arranged, err = chainOrder{
+		Insert:  []chainInsert{{Step: "cleanup", After: stepFieldRefs}, {Step: "pins", Before: transformerLiteral}},
+		Disable: []string{stepGatewayRefs},
+	}.arrange(steps)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"versions", "pins", "hosts", "images", "policy", stepFieldRefs, "cleanup", stepOrigin}, names(arranged))
+
+	arranged, err = chainOrder{Insert: []chainInsert{{Step: "missing", After: "hosts"}, {Step: "hosts", Before: "missing"}}}.arrange(steps)
+	require.NoError(t, err)
+	assert.Equal(t, names(steps), names(arranged), "steps not in the chain are ignored")
+
+	for _, test := range []struct {
+		order   chainOrder
+		message string
+	}{
+		{chainOrder{Order: []string{"hosts", transformerVersions}}, "api-versions versions must run before literal hosts"},
+		{chainOrder{Insert: []chainInsert{{Step: stepOrigin, Before: stepGatewayRefs}}}, "gateway-refs must run before origin"},
+		{chainOrder{Insert: []chainInsert{{Step: "images", After: stepFieldRefs}}}, "regex images must run before field-refs"},
+		{chainOrder{Disable: []string{"policy"}}, "rego policy cannot be disabled"},
+	} {
+		_, err := test.order.arrange(steps)
+		assert.ErrorContains(t, err, test.message)
+	}
+}
+
+func TestReplacePatternAction_ChainOrder(t *testing.T) {
+	t.Setenv(stampOriginEnv, "false")
+	plugin := &RestorePlugin{logger: logrus.New()}
+	configMaps := []v1.ConfigMap{
+		{ObjectMeta: metav1.ObjectMeta{Name: "hosts"}, Data: map[string]string{"registry.prod": "registry.dr"}},
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "mirror", Annotations: map[string]string{transformerAnnotation: transformerPatch}},
+			Data:       map[string]string{jsonPatchKey: `[{"op": "add", "path": "/data/mirror", "value": "registry.prod/mirror"}]`},
+		},
+	}
+	run := func(order map[string]string) map[string]interface{} {
+		sets := ruleSetsFrom(append(configMaps, v1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: "order", Annotations: map[string]string{transformerAnnotation: transformerChainOrder}},
+			Data:       order,
+		}))
+		item := &unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": "v1",
+			"kind":       "ConfigMap",
+			"metadata":   map[string]interface{}{"name": "web", "namespace": "shop"},
+			"data":       map[string]interface{}{"image": "registry.prod/web"},
+		}}
+		output, err := replacePatternAction(plugin, &velero.RestoreItemActionExecuteInput{Item: item, Restore: &velerov1.Restore{}}, sets)
+		require.NoError(t, err)
+		return output.UpdatedItem.(*unstructured.Unstructured).Object["data"].(map[string]interface{})
+	}
+
+	// by default the patterns apply before the other transformers
+	assert.Equal(t, "registry.prod/mirror", run(nil)["mirror"])
+	assert.Equal(t, "registry.prod/mirror", run(map[string]string{"Secret": "order: [json-patch, literal]"})["mirror"], "other kinds keep the default")
+	assert.Equal(t, "registry.dr/mirror", run(map[string]string{"ConfigMap": "order: [json-patch, literal]"})["mirror"])
+	assert.Equal(t, "registry.dr/mirror", run(map[string]string{"ConfigMap": "insert: [{step: hosts, after: mirror}]"})["mirror"])
+
+	out := run(map[string]string{"ConfigMap": "disable: [hosts]"})
+	assert.Equal(t, "registry.prod/web", out["image"])
+
+	// a forbidden order leaves the chain as it is
+	out = run(map[string]string{"ConfigMap": "order: [json-patch, literal]\ninsert: [{step: hosts, after: field-refs}]"})
+	assert.Equal(t, map[string]interface{}{"image": "registry.dr/web", "mirror": "registry.prod/mirror"}, out)
+}
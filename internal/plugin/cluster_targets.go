@@ -0,0 +1,47 @@
+package plugin
+
+import (
+	"strings"
+
+	velerov1 "github.com/vmware-tanzu/velero/pkg/apis/velero/v1"
+)
+
+const (
+	// targetClusterAnnotation on a Restore names the cluster the backup is
+	// restored for, when one backup is fanned out to several clusters.
+	targetClusterAnnotation = "agoracalyce.io/target-cluster"
+
+	// clustersAnnotation restricts a ConfigMap to the Restores targeting one
+	// of a comma separated list of clusters.
+	clustersAnnotation = "agoracalyce.io/clusters"
+)
+
+// parseClusters splits the value of clustersAnnotation.
+func parseClusters(list string) []string {
+	var clusters []string
+	for _, cluster := range strings.Split(list, ",") {
+		if cluster = strings.TrimSpace(cluster); cluster != "" {
+			clusters = append(clusters, cluster)
+		}
+	}
+	return clusters
+}
+
+// targetsCluster reports whether the set applies to the cluster the restore
+// targets. Sets without clusters apply to every restore, the others only to
+// the restores targeting one of them.
+func (s ruleSet) targetsCluster(restore *velerov1.Restore) bool {
+	if len(s.clusters) == 0 {
+		return true
+	}
+	if restore == nil {
+		return false
+	}
+	target := strings.TrimSpace(restore.Annotations[targetClusterAnnotation])
+	for _, cluster := range s.clusters {
+		if cluster == target {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,57 @@
+package plugin
+
+import (
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	velerov1 "github.com/vmware-tanzu/velero/pkg/apis/velero/v1"
+	"github.com/vmware-tanzu/velero/pkg/plugin/velero"
+	"github.com/wrkt/velero-custom-plugins/internal/transform"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestReplacePatternAction_ClusterTargets(t *testing.T) {
+	t.Setenv(stampOriginEnv, "false")
+	plugin := &RestorePlugin{logger: logrus.New()}
+	sets := ruleSetsFrom([]v1.ConfigMap{
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "fan-out", Annotations: map[string]string{transformerAnnotation: transformerTargets}},
+			Data: map[string]string{
+				targetRulesKey: "- namespaces: [shop, shop-*]\n  clusters: [dr-east, dr-west]\n",
+				"label-prefix": "targets.example.com/",
+			},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "east", Annotations: map[string]string{clustersAnnotation: "dr-east, dr-eu"}},
+			Data:       map[string]string{"db.example.com": "db.east.example.com"},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "west", Annotations: map[string]string{clustersAnnotation: "dr-west"}},
+			Data:       map[string]string{"db.example.com": "db.west.example.com"},
+		},
+	})
+
+	original := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "ConfigMap",
+		"metadata":   map[string]interface{}{"name": "settings", "namespace": "shop"},
+		"data":       map[string]interface{}{"db": "db.example.com"},
+	}}
+	// mapped by the Restore's namespaceMapping
+	item := original.DeepCopy()
+	item.SetNamespace("shop-dr")
+
+	for target, expected := range map[string]string{"dr-east": "db.east.example.com", "dr-west": "db.west.example.com", "": "db.example.com"} {
+		restore := &velerov1.Restore{ObjectMeta: metav1.ObjectMeta{Name: "dr-1", Annotations: map[string]string{targetClusterAnnotation: target}}}
+		output, err := replacePatternAction(plugin, &velero.RestoreItemActionExecuteInput{Item: item, ItemFromBackup: original, Restore: restore}, sets)
+		require.NoError(t, err)
+		result := output.UpdatedItem.(*unstructured.Unstructured)
+		assert.Equal(t, expected, result.Object["data"].(map[string]interface{})["db"], target)
+		assert.Equal(t, "dr-east,dr-west", result.GetAnnotations()[transform.TargetsAnnotation], target)
+		assert.Equal(t, map[string]string{"targets.example.com/dr-east": "true", "targets.example.com/dr-west": "true"}, result.GetLabels(), target)
+	}
+}
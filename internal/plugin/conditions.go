@@ -0,0 +1,201 @@
+package plugin
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/google/cel-go/cel"
+	"github.com/wrkt/velero-custom-plugins/internal/lru"
+	"github.com/wrkt/velero-custom-plugins/internal/transform"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	// conditionAnnotation restricts a ConfigMap to the items for which a CEL
+	// expression, seeing the item as object, is true.
+	conditionAnnotation = "agoracalyce.io/condition"
+
+	// patternConditionsAnnotation gates patterns of a ConfigMap on fields of
+	// the items: a YAML map of pattern to the values that fields must have,
+	// by path.
+	patternConditionsAnnotation = "agoracalyce.io/pattern-conditions"
+
+	// conditionCostLimit bounds the evaluation of a condition on one item, as
+	// the API server bounds validation rules.
+	conditionCostLimit = 1000000
+
+	// cacheSize bounds the caches of the values parsed from the rules: rule
+	// sets are rebuilt for every item, from rules that change over time.
+	cacheSize = 1024
+)
+
+// conditions caches the compiled conditions by expression: the rule sets are
+// rebuilt for every item.
+var conditions = lru.New[string, compiledCondition](cacheSize)
+
+// compiledCondition is a compiled condition, or the error compiling it.
+type compiledCondition struct {
+	program cel.Program
+	err     error
+}
+
+// compileCondition compiles a condition once.
+func compileCondition(expression string) (cel.Program, error) {
+	if cached, ok := conditions.Get(expression); ok {
+		return cached.program, cached.err
+	}
+	program, err := newConditionProgram(expression)
+	conditions.Add(expression, compiledCondition{program: program, err: err})
+	return program, err
+}
+
+func newConditionProgram(expression string) (cel.Program, error) {
+	env, err := cel.NewEnv(cel.Variable("object", cel.DynType))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create CEL environment: %v", err)
+	}
+	ast, issues := env.Compile(expression)
+	if issues != nil && issues.Err() != nil {
+		return nil, fmt.Errorf("invalid %s: %v", conditionAnnotation, issues.Err())
+	}
+	if ast.OutputType() != cel.BoolType && ast.OutputType() != cel.DynType {
+		return nil, fmt.Errorf("invalid %s: evaluates to %s, not bool", conditionAnnotation, ast.OutputType())
+	}
+	program, err := env.Program(ast, cel.CostLimit(conditionCostLimit))
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %v", conditionAnnotation, err)
+	}
+	return program, nil
+}
+
+// matchesCondition reports whether the condition of the set holds for the
+// item. Sets without one match every item. An expression that is invalid, or
+// not a boolean, fails; one that cannot be evaluated on the item, typically
+// reading a field the item lacks without has(), does not match.
+func (s ruleSet) matchesCondition(item *unstructured.Unstructured) (bool, error) {
+	if s.condition == "" {
+		return true, nil
+	}
+	program, err := compileCondition(s.condition)
+	if err != nil {
+		return false, err
+	}
+	out, _, err := program.Eval(map[string]interface{}{"object": item.Object})
+	if err != nil {
+		return false, nil
+	}
+	matched, ok := out.Value().(bool)
+	if !ok {
+		return false, fmt.Errorf("invalid %s: evaluates to %T, not bool", conditionAnnotation, out.Value())
+	}
+	return matched, nil
+}
+
+// fieldCondition requires a field of the item to have a value. A path
+// selecting several fields requires one of them to.
+type fieldCondition struct {
+	path  transform.FieldPath
+	value string
+}
+
+// holds reports whether the condition holds for the item. Values that are not
+// strings are compared in their YAML form, 3 or true.
+func (c fieldCondition) holds(item *unstructured.Unstructured) bool {
+	for _, value := range c.path.Values(item.Object) {
+		switch value.(type) {
+		case map[string]interface{}, []interface{}, nil:
+			continue
+		}
+		if fmt.Sprint(value) == c.value {
+			return true
+		}
+	}
+	return false
+}
+
+// patternConditions caches the parsed pattern conditions by annotation, as
+// conditions does.
+var patternConditions = lru.New[string, parsedPatternConditions](cacheSize)
+
+// parsedPatternConditions are the conditions of each pattern, or the error
+// parsing them.
+type parsedPatternConditions struct {
+	conditions map[string][]fieldCondition
+	err        error
+}
+
+// parsePatternConditions parses the pattern conditions of the set once.
+func (s ruleSet) parsePatternConditions() (map[string][]fieldCondition, error) {
+	if s.patternConditions == "" {
+		return nil, nil
+	}
+	if cached, ok := patternConditions.Get(s.patternConditions); ok {
+		return cached.conditions, cached.err
+	}
+	conditions, err := newPatternConditions(s.patternConditions)
+	patternConditions.Add(s.patternConditions, parsedPatternConditions{conditions: conditions, err: err})
+	return conditions, err
+}
+
+func newPatternConditions(annotation string) (map[string][]fieldCondition, error) {
+	var entries map[string]map[string]interface{}
+	if err := yaml.Unmarshal([]byte(annotation), &entries); err != nil {
+		return nil, fmt.Errorf("invalid %s: %v", patternConditionsAnnotation, err)
+	}
+	conditions := make(map[string][]fieldCondition, len(entries))
+	for pattern, fields := range entries {
+		if len(fields) == 0 {
+			return nil, fmt.Errorf("invalid %s: no condition for %q", patternConditionsAnnotation, pattern)
+		}
+		expressions := make([]string, 0, len(fields))
+		for expression := range fields {
+			expressions = append(expressions, expression)
+		}
+		sort.Strings(expressions)
+		for _, expression := range expressions {
+			path, err := transform.ParseFieldPath(expression)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s: %v", patternConditionsAnnotation, err)
+			}
+			switch value := fields[expression].(type) {
+			case map[string]interface{}, []interface{}, nil:
+				return nil, fmt.Errorf("invalid %s: the value of %s for %q must be a string, a number or a boolean", patternConditionsAnnotation, expression, pattern)
+			default:
+				conditions[pattern] = append(conditions[pattern], fieldCondition{path: path, value: fmt.Sprint(value)})
+			}
+		}
+	}
+	return conditions, nil
+}
+
+// gatePatterns returns the set with the patterns whose conditions do not hold
+// for the item left out. Only literal patterns can have conditions.
+func (s ruleSet) gatePatterns(item *unstructured.Unstructured) (ruleSet, error) {
+	conditions, err := s.parsePatternConditions()
+	if err != nil || conditions == nil {
+		return s, err
+	}
+	if !s.isLiteral() {
+		return s, fmt.Errorf("%s only applies to literal patterns", patternConditionsAnnotation)
+	}
+	gated := make(map[string]string, len(s.patterns))
+	for pattern, replacement := range s.patterns {
+		holds := true
+		for _, condition := range conditions[pattern] {
+			holds = holds && condition.holds(item)
+		}
+		if holds {
+			gated[pattern] = replacement
+		}
+	}
+	s.patterns = gated
+	return s, nil
+}
+
+// isGated reports whether a pattern of the set has conditions.
+func (s ruleSet) isGated(pattern string) bool {
+	conditions, _ := s.parsePatternConditions()
+	_, ok := conditions[pattern]
+	return ok
+}
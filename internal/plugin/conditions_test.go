@@ -0,0 +1,158 @@
+package plugin
+
+import (
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	velerov1 "github.com/vmware-tanzu/velero/pkg/apis/velero/v1"
+	"github.com/vmware-tanzu/velero/pkg/plugin/velero"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestMatchesCondition(t *testing.T) {
+	service := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "Service",
+		"metadata":   map[string]interface{}{"name": "web", "labels": map[string]interface{}{"tier": "front"}},
+		"spec":       map[string]interface{}{"type": "LoadBalancer", "ports": []interface{}{map[string]interface{}{"port": int64(443)}}},
+	}}
+	configMap := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "ConfigMap",
+		"metadata":   map[string]interface{}{"name": "web"},
+	}}
+
+	for _, tc := range []struct {
+		condition string
+		service   bool
+		configMap bool
+	}{
+		{"", true, true},
+		{"object.kind == 'Service' && object.spec.type == 'LoadBalancer'", true, false},
+		{"object.spec.ports.exists(p, p.port == 443)", true, false},
+		{"has(object.metadata.labels) && object.metadata.labels.tier == 'front'", true, false},
+		{"!has(object.spec)", false, true},
+	} {
+		set := ruleSet{condition: tc.condition}
+		matched, err := set.matchesCondition(service)
+		require.NoError(t, err, tc.condition)
+		assert.Equal(t, tc.service, matched, tc.condition)
+		matched, err = set.matchesCondition(configMap)
+		require.NoError(t, err, tc.condition)
+		assert.Equal(t, tc.configMap, matched, tc.condition)
+	}
+
+	for _, condition := range []string{"object.kind ==", "object.metadata.name", "1 + 1"} {
+		_, err := ruleSet{condition: condition}.matchesCondition(service)
+		assert.Error(t, err, condition)
+	}
+}
+
+func TestReplacePatternAction_Condition(t *testing.T) {
+	t.Setenv(stampOriginEnv, "false")
+	plugin := &RestorePlugin{logger: logrus.New()}
+	sets := ruleSetsFrom([]v1.ConfigMap{
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "load-balancers", Annotations: map[string]string{
+				conditionAnnotation: "object.kind == 'Service' && object.spec.type == 'LoadBalancer'",
+			}},
+			Data: map[string]string{"internal": "internet-facing"},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "invalid", Annotations: map[string]string{conditionAnnotation: "object.kind =="}},
+			Data:       map[string]string{"web": "site"},
+		},
+	})
+	restore := &velerov1.Restore{ObjectMeta: metav1.ObjectMeta{Name: "dr-1", UID: "uid-1"}}
+
+	for serviceType, expected := range map[string]string{"LoadBalancer": "internet-facing", "ClusterIP": "internal"} {
+		item := &unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": "v1",
+			"kind":       "Service",
+			"metadata":   map[string]interface{}{"name": "web", "namespace": "shop", "annotations": map[string]interface{}{"scheme": "internal"}},
+			"spec":       map[string]interface{}{"type": serviceType},
+		}}
+		output, err := replacePatternAction(plugin, &velero.RestoreItemActionExecuteInput{Item: item, Restore: restore}, sets)
+		require.NoError(t, err)
+		result := output.UpdatedItem.(*unstructured.Unstructured)
+		assert.Equal(t, expected, result.GetAnnotations()["scheme"], serviceType)
+		assert.Equal(t, "web", result.GetName(), "the invalid ConfigMap is ignored")
+	}
+	assert.Empty(t, plugin.stateFor(restore).report.applied)
+}
+
+func TestGatePatterns(t *testing.T) {
+	pvc := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "PersistentVolumeClaim",
+		"metadata":   map[string]interface{}{"name": "data", "labels": map[string]interface{}{"app.kubernetes.io/name": "db"}},
+		"spec":       map[string]interface{}{"storageClassName": "ceph-rbd", "resources": map[string]interface{}{"requests": map[string]interface{}{"storage": "10Gi"}}},
+		"status":     map[string]interface{}{"capacity": map[string]interface{}{"replicas": int64(3)}, "accessModes": []interface{}{"ReadWriteOnce", "ReadOnlyMany"}},
+	}}
+	set := ruleSet{
+		patterns: map[string]string{"ceph.prod": "ceph.dr", "nfs.prod": "nfs.dr", "prod": "dr"},
+		patternConditions: `
+ceph.prod:
+  spec.storageClassName: ceph-rbd
+  metadata.labels['app.kubernetes.io/name']: db
+  status.capacity.replicas: 3
+  status.accessModes[*]: ReadOnlyMany
+nfs.prod:
+  spec.storageClassName: nfs
+`,
+	}
+	gated, err := set.gatePatterns(pvc)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"ceph.prod": "ceph.dr", "prod": "dr"}, gated.patterns)
+	assert.Len(t, set.patterns, 3, "the set is not modified")
+	assert.True(t, set.isGated("nfs.prod"))
+	assert.False(t, set.isGated("prod"))
+
+	// every condition must hold
+	pvc.SetLabels(nil)
+	gated, err = set.gatePatterns(pvc)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"prod": "dr"}, gated.patterns)
+
+	for _, invalid := range []ruleSet{
+		{patterns: map[string]string{"a": "b"}, patternConditions: "a: [spec]"},
+		{patterns: map[string]string{"a": "b"}, patternConditions: "a: {}"},
+		{patterns: map[string]string{"a": "b"}, patternConditions: "a: {spec..type: x}"},
+		{patterns: map[string]string{"a": "b"}, patternConditions: "a: {spec: {type: x}}"},
+		{transformer: transformerRegex, config: map[string]string{}, patternConditions: "a: {spec.type: x}"},
+	} {
+		_, err := invalid.gatePatterns(pvc)
+		assert.Error(t, err, invalid.patternConditions)
+	}
+}
+
+func TestReplacePatternAction_PatternConditions(t *testing.T) {
+	t.Setenv(stampOriginEnv, "false")
+	plugin := &RestorePlugin{logger: logrus.New()}
+	sets := ruleSetsFrom([]v1.ConfigMap{{
+		ObjectMeta: metav1.ObjectMeta{Name: "storage", Annotations: map[string]string{
+			patternConditionsAnnotation: "s3.prod.example.com: {spec.storageClassName: ceph-rbd}",
+		}},
+		Data: map[string]string{"s3.prod.example.com": "s3.dr.example.com", "prod-": "dr-"},
+	}})
+	restore := &velerov1.Restore{ObjectMeta: metav1.ObjectMeta{Name: "dr-1", UID: "uid-1"}}
+
+	for class, expected := range map[string]string{"ceph-rbd": "s3.dr.example.com", "gp3": "s3.prod.example.com"} {
+		item := &unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": "v1",
+			"kind":       "PersistentVolumeClaim",
+			"metadata":   map[string]interface{}{"name": "prod-data", "namespace": "shop", "annotations": map[string]interface{}{"endpoint": "s3.prod.example.com"}},
+			"spec":       map[string]interface{}{"storageClassName": class},
+		}}
+		output, err := replacePatternAction(plugin, &velero.RestoreItemActionExecuteInput{Item: item, Restore: restore}, sets)
+		require.NoError(t, err)
+		result := output.UpdatedItem.(*unstructured.Unstructured)
+		assert.Equal(t, expected, result.GetAnnotations()["endpoint"], class)
+		assert.Equal(t, "dr-data", result.GetName(), "the other patterns apply")
+	}
+	assert.Equal(t, map[string]string{"prod-": "dr-"}, plugin.stateFor(restore).report.applied, "gated patterns are not inverted")
+}
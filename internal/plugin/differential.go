@@ -0,0 +1,114 @@
+package plugin
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	velerov1 "github.com/vmware-tanzu/velero/pkg/apis/velero/v1"
+	"github.com/wrkt/velero-custom-plugins/pkg/sanitize"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+)
+
+// differentialAnnotation on a Restore enables the differential mode: items
+// identical to the live object in the target cluster are skipped.
+const differentialAnnotation = "agoracalyce.io/differential-restore"
+
+// sanitizer removes the fields set by the cluster an object was read from, so
+// that an item and its live object compare equal.
+var sanitizer = sanitize.Default()
+
+// ignoredLabels lists the labels Velero stamps on restored objects.
+var ignoredLabels = []string{
+	velerov1.BackupNameLabel,
+	velerov1.RestoreNameLabel,
+}
+
+// liveObjectGetter fetches the live version of an item in the target cluster.
+type liveObjectGetter interface {
+	getLive(gvk schema.GroupVersionKind, namespace, name string) (*unstructured.Unstructured, error)
+}
+
+// dynamicLiveGetter reads live objects with the dynamic client.
+type dynamicLiveGetter struct {
+	client   dynamic.Interface
+	resolver *resourceResolver
+}
+
+func (g *dynamicLiveGetter) getLive(gvk schema.GroupVersionKind, namespace, name string) (*unstructured.Unstructured, error) {
+	gvr, ok := g.resolver.resourceFor(gvk.GroupKind())
+	if !ok {
+		return nil, fmt.Errorf("no resource serves %s in the target cluster", gvk.GroupKind())
+	}
+	if namespace == "" {
+		return g.client.Resource(gvr).Get(context.TODO(), name, metav1.GetOptions{})
+	}
+	return g.client.Resource(gvr).Namespace(namespace).Get(context.TODO(), name, metav1.GetOptions{})
+}
+
+// differentialEnabled tells whether the restore asked for the differential mode.
+func differentialEnabled(restore *velerov1.Restore) bool {
+	if restore == nil {
+		return false
+	}
+	enabled, _ := strconv.ParseBool(restore.Annotations[differentialAnnotation])
+	return enabled
+}
+
+// identicalToLive reports whether item, once normalized, hashes the same as
+// its live counterpart.
+func (p *RestorePlugin) identicalToLive(item *unstructured.Unstructured, state *restoreState) bool {
+	if p.liveGetter == nil {
+		return false
+	}
+
+	live, err := p.getLive(state, item.GroupVersionKind(), item.GetNamespace(), item.GetName())
+	if apierrors.IsNotFound(err) {
+		return false
+	}
+	if err != nil {
+		p.logger.Warnf("Differential restore: cannot read live %s %s/%s, restoring it: %v", item.GetKind(), item.GetNamespace(), item.GetName(), err)
+		return false
+	}
+
+	itemHash, err := normalizedHash(item)
+	if err != nil {
+		p.logger.Warnf("Differential restore: %v", err)
+		return false
+	}
+	liveHash, err := normalizedHash(live)
+	if err != nil {
+		p.logger.Warnf("Differential restore: %v", err)
+		return false
+	}
+	return itemHash == liveHash
+}
+
+// normalizedHash hashes the object without its status and the fields that
+// differ between two restores of the same object.
+func normalizedHash(obj *unstructured.Unstructured) (string, error) {
+	normalized := sanitizer.Sanitize(obj)
+	// owners are restored with new uids
+	unstructured.RemoveNestedField(normalized.Object, "metadata", "ownerReferences")
+	for _, label := range ignoredLabels {
+		unstructured.RemoveNestedField(normalized.Object, "metadata", "labels", label)
+	}
+	if labels, found, _ := unstructured.NestedMap(normalized.Object, "metadata", "labels"); found && len(labels) == 0 {
+		unstructured.RemoveNestedField(normalized.Object, "metadata", "labels")
+	}
+
+	// map keys are sorted by encoding/json, so the encoding is canonical
+	data, err := json.Marshal(normalized.Object)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode %s %s: %v", obj.GetKind(), obj.GetName(), err)
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
@@ -0,0 +1,123 @@
+package plugin
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	velerov1 "github.com/vmware-tanzu/velero/pkg/apis/velero/v1"
+	"github.com/vmware-tanzu/velero/pkg/plugin/velero"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+type stubLiveGetter struct {
+	live *unstructured.Unstructured
+	err  error
+}
+
+func (s *stubLiveGetter) getLive(gvk schema.GroupVersionKind, namespace, name string) (*unstructured.Unstructured, error) {
+	return s.live, s.err
+}
+
+func differentialItem() *unstructured.Unstructured {
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "ConfigMap",
+		"metadata": map[string]interface{}{
+			"name":      "app",
+			"namespace": "review-3",
+		},
+		"data": map[string]interface{}{"url": "https://example.com"},
+	}}
+}
+
+func TestNormalizedHash(t *testing.T) {
+	item := differentialItem()
+	live := differentialItem()
+	live.SetUID(types.UID("1234"))
+	live.SetResourceVersion("42")
+	live.SetLabels(map[string]string{velerov1.RestoreNameLabel: "previous-rehearsal"})
+	live.Object["status"] = map[string]interface{}{"phase": "Active"}
+
+	itemHash, err := normalizedHash(item)
+	require.NoError(t, err)
+	liveHash, err := normalizedHash(live)
+	require.NoError(t, err)
+	assert.Equal(t, itemHash, liveHash)
+
+	live.Object["data"] = map[string]interface{}{"url": "https://replaced.com"}
+	liveHash, err = normalizedHash(live)
+	require.NoError(t, err)
+	assert.NotEqual(t, itemHash, liveHash)
+}
+
+func TestNormalizedHash_Sanitized(t *testing.T) {
+	service := func(clusterIP string) *unstructured.Unstructured {
+		return &unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": "v1",
+			"kind":       "Service",
+			"metadata":   map[string]interface{}{"name": "web", "namespace": "review-3"},
+			"spec":       map[string]interface{}{"clusterIP": clusterIP, "clusterIPs": []interface{}{clusterIP}},
+		}}
+	}
+
+	// the live Service got another cluster IP
+	itemHash, err := normalizedHash(service("10.0.0.1"))
+	require.NoError(t, err)
+	liveHash, err := normalizedHash(service("10.96.0.7"))
+	require.NoError(t, err)
+	assert.Equal(t, itemHash, liveHash)
+}
+
+func TestReplacePatternAction_Differential(t *testing.T) {
+	restore := &velerov1.Restore{ObjectMeta: metav1.ObjectMeta{
+		Name:        "dr-1",
+		UID:         types.UID("dr-1"),
+		Annotations: map[string]string{differentialAnnotation: "true"},
+	}}
+	sets := []ruleSet{{patterns: map[string]string{"example.com": "replaced.com"}}}
+	t.Setenv(stampOriginEnv, "false")
+
+	live := differentialItem()
+	live.Object["data"] = map[string]interface{}{"url": "https://replaced.com"}
+	live.SetResourceVersion("42")
+
+	tests := []struct {
+		name     string
+		getter   *stubLiveGetter
+		annotate bool
+		skip     bool
+	}{
+		{name: "identical", getter: &stubLiveGetter{live: live}, annotate: true, skip: true},
+		{name: "not annotated", getter: &stubLiveGetter{live: live}},
+		{name: "changed", getter: &stubLiveGetter{live: differentialItem()}, annotate: true},
+		{name: "missing", getter: &stubLiveGetter{err: apierrors.NewNotFound(schema.GroupResource{Resource: "configmaps"}, "app")}, annotate: true},
+		{name: "unreadable", getter: &stubLiveGetter{err: errors.New("forbidden")}, annotate: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plugin := &RestorePlugin{logger: logrus.New(), liveGetter: tt.getter}
+			input := &velero.RestoreItemActionExecuteInput{Item: differentialItem(), Restore: restore.DeepCopy()}
+			if !tt.annotate {
+				input.Restore.Annotations = nil
+			}
+
+			output, err := replacePatternAction(plugin, input, sets)
+			require.NoError(t, err)
+			assert.Equal(t, tt.skip, output.SkipRestore)
+
+			state := plugin.stateFor(input.Restore)
+			if tt.skip {
+				assert.Equal(t, 1, state.report.summary.ItemsSkippedIdentical)
+			} else {
+				assert.Zero(t, state.report.summary.ItemsSkippedIdentical)
+			}
+		})
+	}
+}
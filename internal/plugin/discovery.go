@@ -0,0 +1,186 @@
+package plugin
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// resourcesAnnotation scopes a pattern ConfigMap to a comma separated list of
+// resources, named the way kubectl accepts them: plural, singular, short name
+// or kind, optionally qualified with the group (e.g. "deploy", "ing",
+// "certificates.cert-manager.io").
+const resourcesAnnotation = "agoracalyce.io/resources"
+
+// resourceLister is the part of the discovery client used to resolve names.
+type resourceLister interface {
+	ServerPreferredResources() ([]*metav1.APIResourceList, error)
+}
+
+// resourceResolver resolves kubectl-style resource names to the group and
+// kind of their preferred version in the target cluster.
+type resourceResolver struct {
+	lister resourceLister
+	logger logrus.FieldLogger
+
+	once       sync.Once
+	names      map[string]schema.GroupKind
+	namespaced map[schema.GroupKind]bool
+	resources  map[schema.GroupKind]schema.GroupVersionResource
+}
+
+func newResourceResolver(lister resourceLister, logger logrus.FieldLogger) *resourceResolver {
+	return &resourceResolver{lister: lister, logger: logger}
+}
+
+// load enumerates the resources served by the cluster once.
+func (r *resourceResolver) load() {
+	r.names = make(map[string]schema.GroupKind)
+	r.namespaced = make(map[schema.GroupKind]bool)
+	r.resources = make(map[schema.GroupKind]schema.GroupVersionResource)
+
+	lists, err := r.lister.ServerPreferredResources()
+	if err != nil {
+		// partial results are still returned when some API groups fail
+		r.logger.Warnf("Resource discovery is incomplete: %v", err)
+	}
+
+	for _, list := range lists {
+		gv, err := schema.ParseGroupVersion(list.GroupVersion)
+		if err != nil {
+			continue
+		}
+		for _, resource := range list.APIResources {
+			// skip subresources such as deployments/scale
+			if strings.Contains(resource.Name, "/") {
+				continue
+			}
+			gk := schema.GroupKind{Group: gv.Group, Kind: resource.Kind}
+			r.namespaced[gk] = resource.Namespaced
+			r.resources[gk] = gv.WithResource(resource.Name)
+
+			names := append([]string{resource.Name, resource.SingularName, resource.Kind}, resource.ShortNames...)
+			for _, name := range names {
+				if name == "" {
+					continue
+				}
+				name = strings.ToLower(name)
+				r.add(name, gk)
+				if gv.Group != "" {
+					r.add(name+"."+gv.Group, gk)
+				}
+			}
+		}
+	}
+}
+
+// add registers name unless it is already taken: core and earlier groups win,
+// which mirrors kubectl's preference order.
+func (r *resourceResolver) add(name string, gk schema.GroupKind) {
+	if _, ok := r.names[name]; !ok {
+		r.names[name] = gk
+	}
+}
+
+// resolve returns the group and kind named by name. Without a discovery
+// client (local mode) only kind names are understood, in any group.
+func (r *resourceResolver) resolve(name string) (schema.GroupKind, bool) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if r == nil || r.lister == nil {
+		return schema.GroupKind{Group: "*", Kind: name}, name != ""
+	}
+
+	r.once.Do(r.load)
+	gk, ok := r.names[name]
+	return gk, ok
+}
+
+// isNamespaced reports whether resources of the given group and kind are
+// namespaced, and whether the cluster told.
+func (r *resourceResolver) isNamespaced(gk schema.GroupKind) (namespaced, known bool) {
+	if r == nil || r.lister == nil {
+		return false, false
+	}
+	r.once.Do(r.load)
+	namespaced, known = r.namespaced[gk]
+	return namespaced, known
+}
+
+// resourceFor returns the preferred resource serving the given group and kind.
+func (r *resourceResolver) resourceFor(gk schema.GroupKind) (schema.GroupVersionResource, bool) {
+	if r == nil || r.lister == nil {
+		return schema.GroupVersionResource{}, false
+	}
+	r.once.Do(r.load)
+	gvr, ok := r.resources[gk]
+	return gvr, ok
+}
+
+// groupResources returns the preferred resources of a group.
+func (r *resourceResolver) groupResources(group string) []schema.GroupResource {
+	if r == nil || r.lister == nil {
+		return nil
+	}
+	r.once.Do(r.load)
+	var resources []schema.GroupResource
+	for gk, gvr := range r.resources {
+		if gk.Group == group {
+			resources = append(resources, gvr.GroupResource())
+		}
+	}
+	return resources
+}
+
+// matches reports whether an item of the given group and kind is one of the
+// resources listed in the annotation value.
+func (r *resourceResolver) matches(resources string, gk schema.GroupKind, logger logrus.FieldLogger) bool {
+	for _, name := range strings.Split(resources, ",") {
+		resolved, ok := r.resolve(name)
+		if !ok {
+			logger.Warnf("Unknown resource %q in %s annotation", strings.TrimSpace(name), resourcesAnnotation)
+			continue
+		}
+		if resolved.Group == "*" {
+			if strings.EqualFold(resolved.Kind, gk.Kind) {
+				return true
+			}
+			continue
+		}
+		if resolved == gk {
+			return true
+		}
+	}
+	return false
+}
+
+// isClusterScoped tells whether item is cluster-scoped, from discovery when
+// possible and otherwise from the absence of a namespace.
+func (p *RestorePlugin) isClusterScoped(item *unstructured.Unstructured) bool {
+	if namespaced, known := p.resolver.isNamespaced(item.GroupVersionKind().GroupKind()); known {
+		return !namespaced
+	}
+	return item.GetNamespace() == ""
+}
+
+// configMapsFor keeps the pattern ConfigMaps that apply to an item of the
+// given group, version and kind.
+func (p *RestorePlugin) configMapsFor(gvk schema.GroupVersionKind, configMaps []v1.ConfigMap) []v1.ConfigMap {
+	var applicable []v1.ConfigMap
+	for _, configMap := range configMaps {
+		resources, scoped := configMap.Annotations[resourcesAnnotation]
+		if scoped && !p.resolver.matches(resources, gvk.GroupKind(), p.logger) {
+			continue
+		}
+		apiVersions, scoped := configMap.Annotations[apiVersionsAnnotation]
+		if scoped && !matchesAPIVersions(apiVersions, gvk.GroupVersion(), p.logger) {
+			continue
+		}
+		applicable = append(applicable, configMap)
+	}
+	return applicable
+}
@@ -0,0 +1,118 @@
+package plugin
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+type stubResourceLister struct {
+	lists []*metav1.APIResourceList
+	err   error
+	calls int
+}
+
+func (s *stubResourceLister) ServerPreferredResources() ([]*metav1.APIResourceList, error) {
+	s.calls++
+	return s.lists, s.err
+}
+
+func newStubResourceLister() *stubResourceLister {
+	return &stubResourceLister{
+		lists: []*metav1.APIResourceList{
+			{
+				GroupVersion: "v1",
+				APIResources: []metav1.APIResource{
+					{Name: "services", SingularName: "service", Kind: "Service", Namespaced: true, ShortNames: []string{"svc"}},
+				},
+			},
+			{
+				GroupVersion: "apps/v1",
+				APIResources: []metav1.APIResource{
+					{Name: "deployments", SingularName: "deployment", Kind: "Deployment", Namespaced: true, ShortNames: []string{"deploy"}},
+					{Name: "deployments/scale", Kind: "Scale"},
+				},
+			},
+			{
+				GroupVersion: "networking.k8s.io/v1",
+				APIResources: []metav1.APIResource{
+					{Name: "ingresses", SingularName: "ingress", Kind: "Ingress", Namespaced: true, ShortNames: []string{"ing"}},
+				},
+			},
+		},
+		// a broken aggregated API must not prevent resolving the rest
+		err: errors.New("unable to retrieve the complete list of server APIs: metrics.k8s.io/v1beta1"),
+	}
+}
+
+func TestResourceResolver_Resolve(t *testing.T) {
+	lister := newStubResourceLister()
+	resolver := newResourceResolver(lister, logrus.New())
+
+	tests := map[string]schema.GroupKind{
+		"deploy":                      {Group: "apps", Kind: "Deployment"},
+		"Deployments":                 {Group: "apps", Kind: "Deployment"},
+		"deployment.apps":             {Group: "apps", Kind: "Deployment"},
+		" ing ":                       {Group: "networking.k8s.io", Kind: "Ingress"},
+		"ingresses.networking.k8s.io": {Group: "networking.k8s.io", Kind: "Ingress"},
+		"svc":                         {Group: "", Kind: "Service"},
+	}
+	for name, expected := range tests {
+		gk, ok := resolver.resolve(name)
+		assert.True(t, ok, name)
+		assert.Equal(t, expected, gk, name)
+	}
+
+	_, ok := resolver.resolve("scale")
+	assert.False(t, ok, "subresources are not resolvable")
+	_, ok = resolver.resolve("unknown")
+	assert.False(t, ok)
+
+	assert.Equal(t, 1, lister.calls, "discovery runs once")
+}
+
+func TestConfigMapsFor(t *testing.T) {
+	configMaps := []v1.ConfigMap{
+		{ObjectMeta: metav1.ObjectMeta{Name: "all"}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "workloads", Annotations: map[string]string{resourcesAnnotation: "deploy, sts"}}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "ingresses", Annotations: map[string]string{resourcesAnnotation: "ing"}}},
+	}
+
+	names := func(configMaps []v1.ConfigMap) []string {
+		var out []string
+		for _, cm := range configMaps {
+			out = append(out, cm.Name)
+		}
+		return out
+	}
+
+	plugin := &RestorePlugin{logger: logrus.New(), resolver: newResourceResolver(newStubResourceLister(), logrus.New())}
+	assert.Equal(t, []string{"all", "workloads"}, names(plugin.configMapsFor(schema.GroupVersionKind{Group: "apps", Version: "v1", Kind: "Deployment"}, configMaps)))
+	assert.Equal(t, []string{"all", "ingresses"}, names(plugin.configMapsFor(schema.GroupVersionKind{Group: "networking.k8s.io", Version: "v1", Kind: "Ingress"}, configMaps)))
+	assert.Equal(t, []string{"all"}, names(plugin.configMapsFor(schema.GroupVersionKind{Version: "v1", Kind: "Service"}, configMaps)))
+
+	// without discovery only kind names match
+	local := &RestorePlugin{logger: logrus.New()}
+	configMaps[1].Annotations[resourcesAnnotation] = "Deployment"
+	assert.Equal(t, []string{"all", "workloads"}, names(local.configMapsFor(schema.GroupVersionKind{Group: "apps", Version: "v1", Kind: "Deployment"}, configMaps)))
+}
+
+func TestResourceResolver_ResourceFor(t *testing.T) {
+	resolver := newResourceResolver(newStubResourceLister(), logrus.New())
+
+	gvr, ok := resolver.resourceFor(schema.GroupKind{Group: "apps", Kind: "Deployment"})
+	assert.True(t, ok)
+	assert.Equal(t, schema.GroupVersionResource{Group: "apps", Version: "v1", Resource: "deployments"}, gvr)
+
+	_, ok = resolver.resourceFor(schema.GroupKind{Group: "apps", Kind: "Scale"})
+	assert.False(t, ok)
+
+	var disabled *resourceResolver
+	_, ok = disabled.resourceFor(schema.GroupKind{Kind: "Service"})
+	assert.False(t, ok)
+}
@@ -0,0 +1,186 @@
+package plugin
+
+import (
+	"context"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+const (
+	// dnsCheckEnv enables the resolution of rewritten hostnames when true.
+	dnsCheckEnv = "REPLACE_PATTERN_DNS_CHECK"
+	// dnsTimeoutEnv bounds each lookup.
+	dnsTimeoutEnv = "REPLACE_PATTERN_DNS_TIMEOUT"
+
+	reportDNSKey = "dns.json"
+
+	defaultDNSTimeout = 2 * time.Second
+	// dnsCacheTTL keeps lookups from being repeated for every item of a
+	// restore, while a record fixed in the meantime is seen by the next one.
+	dnsCacheTTL = time.Minute
+)
+
+// hostnamePaths are the locations of hostnames, per kind.
+var hostnamePaths = map[string][][]string{
+	"Ingress":   {{"spec", "rules", "host"}, {"spec", "tls", "hosts"}},
+	"Service":   {{"spec", "externalName"}},
+	"Gateway":   {{"spec", "listeners", "hostname"}},
+	"HTTPRoute": {{"spec", "hostnames"}},
+	"GRPCRoute": {{"spec", "hostnames"}},
+	"TLSRoute":  {{"spec", "hostnames"}},
+}
+
+// hostResolver looks hostnames up, as net.Resolver does.
+type hostResolver interface {
+	LookupHost(ctx context.Context, host string) ([]string, error)
+}
+
+// dnsResult is the outcome of the lookup of a rewritten hostname.
+type dnsResult struct {
+	Hostname string `json:"hostname"`
+	Resolved bool   `json:"resolved"`
+	Error    string `json:"error,omitempty"`
+}
+
+type cachedLookup struct {
+	result  dnsResult
+	expires time.Time
+}
+
+// dnsChecker resolves the hostnames rewritten by the rules, so that records
+// missing in the target environment show up before traffic is cut over.
+type dnsChecker struct {
+	resolver hostResolver
+	timeout  time.Duration
+
+	mu    sync.Mutex
+	cache map[string]cachedLookup
+	now   func() time.Time
+}
+
+// loadDNSChecker returns the checker configured by the settings, or nil
+// when the check is disabled.
+func loadDNSChecker(lookup lookupFunc, logger logrus.FieldLogger) *dnsChecker {
+	value, ok := lookup(dnsCheckEnv)
+	if !ok {
+		return nil
+	}
+	enabled, err := strconv.ParseBool(value)
+	if err != nil {
+		logger.Warnf("Ignoring invalid %s=%q", dnsCheckEnv, value)
+		return nil
+	}
+	if !enabled {
+		return nil
+	}
+	c := newDNSChecker(net.DefaultResolver, defaultDNSTimeout)
+	if value, ok := lookup(dnsTimeoutEnv); ok {
+		if d, err := time.ParseDuration(value); err == nil && d > 0 {
+			c.timeout = d
+		} else {
+			logger.Warnf("Ignoring invalid %s=%q", dnsTimeoutEnv, value)
+		}
+	}
+	return c
+}
+
+func newDNSChecker(resolver hostResolver, timeout time.Duration) *dnsChecker {
+	return &dnsChecker{resolver: resolver, timeout: timeout, cache: make(map[string]cachedLookup), now: time.Now}
+}
+
+// lookup resolves a hostname, from the cache when possible.
+func (c *dnsChecker) lookup(hostname string) dnsResult {
+	c.mu.Lock()
+	cached, ok := c.cache[hostname]
+	c.mu.Unlock()
+	if ok && c.now().Before(cached.expires) {
+		return cached.result
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+	result := dnsResult{Hostname: hostname}
+	if _, err := c.resolver.LookupHost(ctx, hostname); err != nil {
+		result.Error = err.Error()
+	} else {
+		result.Resolved = true
+	}
+
+	c.mu.Lock()
+	c.cache[hostname] = cachedLookup{result: result, expires: c.now().Add(dnsCacheTTL)}
+	c.mu.Unlock()
+	return result
+}
+
+// rewrittenHostnames returns the hostnames of output that original did not
+// have, sorted. Wildcards cannot be resolved and are left out.
+func rewrittenHostnames(original, output *unstructured.Unstructured) []string {
+	before := hostnames(original)
+	var rewritten []string
+	for hostname := range hostnames(output) {
+		if !before[hostname] && !strings.HasPrefix(hostname, "*") {
+			rewritten = append(rewritten, hostname)
+		}
+	}
+	sort.Strings(rewritten)
+	return rewritten
+}
+
+func hostnames(item *unstructured.Unstructured) map[string]bool {
+	found := make(map[string]bool)
+	for _, path := range hostnamePaths[item.GetKind()] {
+		collectStrings(item.Object, path, found)
+	}
+	return found
+}
+
+// collectStrings adds the strings found at path, walking through lists.
+func collectStrings(value interface{}, path []string, found map[string]bool) {
+	switch v := value.(type) {
+	case []interface{}:
+		for _, element := range v {
+			collectStrings(element, path, found)
+		}
+	case map[string]interface{}:
+		if len(path) > 0 {
+			collectStrings(v[path[0]], path[1:], found)
+		}
+	case string:
+		if len(path) == 0 && v != "" {
+			found[v] = true
+		}
+	}
+}
+
+// checkHostnames resolves the hostnames the transformation introduced in the
+// item and warns about the ones that do not resolve.
+func (p *RestorePlugin) checkHostnames(original, output *unstructured.Unstructured, report *restoreReport) {
+	if p.dnsChecker == nil {
+		return
+	}
+	for _, hostname := range rewrittenHostnames(original, output) {
+		result := p.dnsChecker.lookup(hostname)
+		if report != nil {
+			report.recordDNS(result)
+		}
+		if !result.Resolved {
+			p.logger.Warnf("%s %s/%s: hostname %s does not resolve: %s", output.GetKind(), output.GetNamespace(), output.GetName(), hostname, result.Error)
+		}
+	}
+}
+
+func (r *restoreReport) recordDNS(result dnsResult) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.dns == nil {
+		r.dns = make(map[string]dnsResult)
+	}
+	r.dns[result.Hostname] = result
+}
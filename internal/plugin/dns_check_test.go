@@ -0,0 +1,117 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	velerov1 "github.com/vmware-tanzu/velero/pkg/apis/velero/v1"
+	"github.com/vmware-tanzu/velero/pkg/plugin/velero"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// fakeResolver knows a fixed set of hostnames and counts the lookups.
+type fakeResolver struct {
+	known   map[string]bool
+	lookups int
+}
+
+func (r *fakeResolver) LookupHost(_ context.Context, host string) ([]string, error) {
+	r.lookups++
+	if r.known[host] {
+		return []string{"192.0.2.1"}, nil
+	}
+	return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+}
+
+func TestLoadDNSChecker(t *testing.T) {
+	assert.Nil(t, loadDNSChecker(os.LookupEnv, logrus.New()))
+
+	t.Setenv(dnsCheckEnv, "false")
+	assert.Nil(t, loadDNSChecker(os.LookupEnv, logrus.New()))
+
+	t.Setenv(dnsCheckEnv, "true")
+	t.Setenv(dnsTimeoutEnv, "500ms")
+	checker := loadDNSChecker(os.LookupEnv, logrus.New())
+	require.NotNil(t, checker)
+	assert.Equal(t, 500*time.Millisecond, checker.timeout)
+
+	t.Setenv(dnsTimeoutEnv, "-1s")
+	assert.Equal(t, defaultDNSTimeout, loadDNSChecker(os.LookupEnv, logrus.New()).timeout)
+}
+
+func TestDNSChecker_Cache(t *testing.T) {
+	resolver := &fakeResolver{known: map[string]bool{"web.dr.example.com": true}}
+	checker := newDNSChecker(resolver, time.Second)
+	now := time.Now()
+	checker.now = func() time.Time { return now }
+
+	assert.Equal(t, dnsResult{Hostname: "web.dr.example.com", Resolved: true}, checker.lookup("web.dr.example.com"))
+	missing := checker.lookup("api.dr.example.com")
+	assert.False(t, missing.Resolved)
+	assert.Contains(t, missing.Error, "no such host")
+
+	checker.lookup("web.dr.example.com")
+	assert.Equal(t, 2, resolver.lookups)
+
+	now = now.Add(dnsCacheTTL)
+	checker.lookup("web.dr.example.com")
+	assert.Equal(t, 3, resolver.lookups)
+}
+
+func TestRewrittenHostnames(t *testing.T) {
+	ingress := &unstructured.Unstructured{Object: map[string]interface{}{
+		"kind": "Ingress",
+		"spec": map[string]interface{}{
+			"rules": []interface{}{
+				map[string]interface{}{"host": "web.example.com"},
+				map[string]interface{}{"host": "static.cdn.net"},
+			},
+			"tls": []interface{}{map[string]interface{}{"hosts": []interface{}{"web.example.com", "*.example.com"}}},
+		},
+	}}
+	rewritten := ingress.DeepCopy()
+	_ = unstructured.SetNestedSlice(rewritten.Object, []interface{}{
+		map[string]interface{}{"host": "web.dr.example.com"},
+		map[string]interface{}{"host": "static.cdn.net"},
+	}, "spec", "rules")
+	_ = unstructured.SetNestedSlice(rewritten.Object, []interface{}{
+		map[string]interface{}{"hosts": []interface{}{"web.dr.example.com", "*.dr.example.com"}},
+	}, "spec", "tls")
+
+	assert.Equal(t, []string{"web.dr.example.com"}, rewrittenHostnames(ingress, rewritten))
+	assert.Empty(t, rewrittenHostnames(ingress, ingress))
+}
+
+func TestReplacePatternAction_DNSCheck(t *testing.T) {
+	t.Setenv(stampOriginEnv, "false")
+	resolver := &fakeResolver{known: map[string]bool{"web.dr.example.com": true}}
+	plugin := &RestorePlugin{logger: logrus.New(), dnsChecker: newDNSChecker(resolver, time.Second)}
+	restore := &velerov1.Restore{ObjectMeta: metav1.ObjectMeta{Name: "dr-1", UID: "uid-1"}}
+	sets := []ruleSet{{patterns: map[string]string{"example.com": "dr.example.com"}}}
+
+	route := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "gateway.networking.k8s.io/v1",
+		"kind":       "HTTPRoute",
+		"metadata":   map[string]interface{}{"name": "web", "namespace": "shop"},
+		"spec":       map[string]interface{}{"hostnames": []interface{}{"web.example.com", "api.example.com"}},
+	}}
+	_, err := replacePatternAction(plugin, &velero.RestoreItemActionExecuteInput{Item: route, Restore: restore}, sets)
+	require.NoError(t, err)
+
+	data, err := plugin.stateFor(restore).report.data()
+	require.NoError(t, err)
+	var results []dnsResult
+	require.NoError(t, json.Unmarshal([]byte(data[reportDNSKey]), &results))
+	require.Len(t, results, 2)
+	assert.Equal(t, "api.dr.example.com", results[0].Hostname)
+	assert.False(t, results[0].Resolved)
+	assert.Equal(t, dnsResult{Hostname: "web.dr.example.com", Resolved: true}, results[1])
+}
@@ -0,0 +1,189 @@
+package plugin
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/wrkt/velero-custom-plugins/internal/transform"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// originAnnotationPrefix prefixes the annotations recording the identity
+// objects had in the backup, which keep referencing the backup environment.
+const originAnnotationPrefix = "agoracalyce.io/original-"
+
+// Drift is a reference to the backup environment found in a restored object:
+// a pattern that the literal rules map, outside of any of its replacements.
+type Drift struct {
+	// Rules names the pattern ConfigMap of the pattern.
+	Rules   string
+	Pattern string
+	// Path locates the string, e.g. spec.rules[0].host.
+	Path string
+}
+
+// DriftChecker finds the references to the backup environment that reappear
+// in restored objects, typically written back by controllers from their own
+// configuration.
+type DriftChecker struct {
+	sets []ruleSet
+	// sections are the top-level fields the patterns are restricted to, nil
+	// for the whole item
+	sections map[string]bool
+}
+
+// NewDriftChecker returns a checker of the literal patterns of configMaps.
+// Transformer ConfigMaps are ignored: their rewrites cannot be checked on the
+// result alone. So are the ConfigMaps restricted to some fields or excluding
+// some fields or strings, whose patterns legitimately remain elsewhere, to
+// some target clusters or to the items satisfying a condition, or whose
+// replacements are templates, and the patterns gated on fields.
+func NewDriftChecker(configMaps []v1.ConfigMap) *DriftChecker {
+	var sets []ruleSet
+	// invalid structured ConfigMaps are warned about by the plugin
+	for _, set := range ruleSetsFrom(expandRules(configMaps, quietLogger)) {
+		if !set.isLiteral() || set.paths != "" || set.excludePaths != "" || len(set.excludeStrings) > 0 || len(set.clusters) > 0 || set.templates || set.condition != "" {
+			continue
+		}
+		if _, err := set.parseMatchOptions(); err != nil {
+			continue
+		}
+		if set.patternConditions != "" {
+			if _, err := set.parsePatternConditions(); err != nil {
+				continue
+			}
+			ungated := make(map[string]string, len(set.patterns))
+			for pattern, replacement := range set.patterns {
+				if !set.isGated(pattern) {
+					ungated[pattern] = replacement
+				}
+			}
+			set.patterns = ungated
+		}
+		if len(set.patterns) > 0 {
+			sets = append(sets, set)
+		}
+	}
+	return &DriftChecker{sets: sets}
+}
+
+// WithSections restricts the checker to the top-level fields of a
+// REPLACE_PATTERN_SECTIONS value, as the plugin restricts the patterns: the
+// patterns left in other fields were never mapped.
+func (c *DriftChecker) WithSections(value string) *DriftChecker {
+	c.sections = nil
+	if value == "" {
+		return c
+	}
+	for _, section := range loadSections(func(string) (string, bool) { return value, true }, quietLogger) {
+		if c.sections == nil {
+			c.sections = make(map[string]bool)
+		}
+		c.sections[section[0].Key] = true
+	}
+	return c
+}
+
+// Check returns the drifts of a namespaced item, sorted by path. Items the
+// rules exclude from restore are never mapped, so they do not drift.
+func (c *DriftChecker) Check(item *unstructured.Unstructured) []Drift {
+	// patterns apply to the decoded data of Secrets
+	plaintext := transform.SecretPlaintext(item)
+	var drifts []Drift
+	for _, set := range c.sets {
+		if !set.appliesTo(false) {
+			continue
+		}
+		if _, excluded := set.excludes(item); excluded {
+			continue
+		}
+		options, _ := set.parseMatchOptions()
+		walkStrings(plaintext.Object, "", !set.valuesOnly, func(path, value string) {
+			if c.sections != nil && !c.sections[topLevelField(path)] {
+				return
+			}
+			for pattern, replacement := range set.patterns {
+				if pattern != "" && unmapped(value, pattern, replacement, options[pattern]) {
+					drifts = append(drifts, Drift{Rules: set.name, Pattern: pattern, Path: path})
+				}
+			}
+		})
+	}
+	sort.Slice(drifts, func(i, j int) bool {
+		if drifts[i].Path != drifts[j].Path {
+			return drifts[i].Path < drifts[j].Path
+		}
+		if drifts[i].Pattern != drifts[j].Pattern {
+			return drifts[i].Pattern < drifts[j].Pattern
+		}
+		return drifts[i].Rules < drifts[j].Rules
+	})
+	return drifts
+}
+
+// topLevelField returns the top-level field of a path such as
+// spec.rules[0].host.
+func topLevelField(path string) string {
+	if i := strings.IndexAny(path, ".["); i >= 0 {
+		return path[:i]
+	}
+	return path
+}
+
+// unmapped reports whether value holds pattern outside of every occurrence of
+// replacement, as when mapping example.com to dr.example.com.
+func unmapped(value, pattern, replacement string, options transform.MatchOptions) bool {
+	for offset := 0; ; {
+		start, end := transform.IndexLiteral(value, offset, pattern, options)
+		if start < 0 {
+			return false
+		}
+		if !covered(value, start, end-start, replacement) {
+			return true
+		}
+		offset = start + 1
+	}
+}
+
+// covered reports whether an occurrence of replacement in value spans
+// value[start:start+length].
+func covered(value string, start, length int, replacement string) bool {
+	if len(replacement) < length {
+		return false
+	}
+	for j := start + length - len(replacement); j <= start; j++ {
+		if j >= 0 && j+len(replacement) <= len(value) && value[j:j+len(replacement)] == replacement {
+			return true
+		}
+	}
+	return false
+}
+
+// walkStrings calls fn with the path of every string of value, object keys
+// included, except the managed fields and the original identity annotations.
+func walkStrings(value interface{}, path string, keys bool, fn func(path, value string)) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, element := range v {
+			child := key
+			if path != "" {
+				child = path + "." + key
+			}
+			if child == "metadata.managedFields" || (path == "metadata.annotations" && strings.HasPrefix(key, originAnnotationPrefix)) {
+				continue
+			}
+			if keys {
+				fn(child, key)
+			}
+			walkStrings(element, child, keys, fn)
+		}
+	case []interface{}:
+		for i, element := range v {
+			walkStrings(element, path+"["+strconv.Itoa(i)+"]", keys, fn)
+		}
+	case string:
+		fn(path, v)
+	}
+}
@@ -0,0 +1,123 @@
+package plugin
+
+import (
+	"encoding/base64"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/wrkt/velero-custom-plugins/internal/transform"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestDriftChecker(t *testing.T) {
+	checker := NewDriftChecker([]v1.ConfigMap{
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "domains", Annotations: map[string]string{excludeLabelsAnnotation: "dr.example.com/skip"}},
+			Data:       map[string]string{"example.com": "dr.example.com", "registry.prod": "registry.dr"},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "clusters", Annotations: map[string]string{scopeAnnotation: scopeCluster}},
+			Data:       map[string]string{"prod": "dr"},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "images", Annotations: map[string]string{pathsAnnotation: "spec.containers[*].image"}},
+			Data:       map[string]string{"web": "shop"},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "storage", Annotations: map[string]string{
+				patternConditionsAnnotation: "api: {spec.storageClassName: ceph-rbd}",
+				excludeLabelsAnnotation:     "dr.example.com/skip",
+			}},
+			Data: map[string]string{"api": "dr-api", "registry.dr/api": "registry.dr/dr-api"},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "ips", Annotations: map[string]string{transformerAnnotation: "service-ips"}},
+			Data:       map[string]string{"10.0.0.1": "10.1.0.1"},
+		},
+	})
+
+	item := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "apps/v1",
+		"kind":       "Deployment",
+		"metadata": map[string]interface{}{
+			"name":      "web",
+			"namespace": "shop",
+			"annotations": map[string]interface{}{
+				"agoracalyce.io/original-cluster": "example.com",
+				"example.com/owner":               "team",
+			},
+			"managedFields": []interface{}{map[string]interface{}{"manager": "example.com"}},
+		},
+		"spec": map[string]interface{}{
+			"containers": []interface{}{
+				map[string]interface{}{"image": "registry.prod/web:1", "env": []interface{}{
+					map[string]interface{}{"name": "HOST", "value": "web.dr.example.com"},
+					map[string]interface{}{"name": "API", "value": "web.dr.example.com,api.example.com"},
+					map[string]interface{}{"name": "IP", "value": "10.0.0.1"},
+				}},
+				map[string]interface{}{"image": "registry.dr/api:1"},
+			},
+		},
+	}}
+
+	assert.Equal(t, []Drift{
+		{Rules: "domains", Pattern: "example.com", Path: "metadata.annotations.example.com/owner"},
+		{Rules: "domains", Pattern: "example.com", Path: "spec.containers[0].env[1].value"},
+		{Rules: "domains", Pattern: "registry.prod", Path: "spec.containers[0].image"},
+		{Rules: "storage", Pattern: "registry.dr/api", Path: "spec.containers[1].image"},
+	}, checker.Check(item), "gated patterns are not checked")
+
+	item.SetLabels(map[string]string{"dr.example.com/skip": "true"})
+	assert.Empty(t, checker.Check(item))
+
+	// the data of Secrets is checked decoded
+	secret := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "Secret",
+		"metadata":   map[string]interface{}{"name": "db", "namespace": "shop"},
+		"data": map[string]interface{}{
+			"url":      base64.StdEncoding.EncodeToString([]byte("postgres://db.example.com/shop")),
+			"replica":  base64.StdEncoding.EncodeToString([]byte("postgres://db.dr.example.com/shop")),
+			"keystore": base64.StdEncoding.EncodeToString([]byte{0xff, 'x'}),
+		},
+	}}
+	assert.Equal(t, []Drift{{Rules: "domains", Pattern: "example.com", Path: "data.url"}}, checker.Check(secret))
+}
+
+func TestUnmapped(t *testing.T) {
+	exact := transform.MatchOptions{}
+	assert.False(t, unmapped("web.dr.example.com", "example.com", "dr.example.com", exact))
+	assert.True(t, unmapped("example.com.dr.example.com", "example.com", "dr.example.com", exact))
+	assert.False(t, unmapped("registry.dr", "registry.prod", "registry.dr", exact))
+	assert.True(t, unmapped("prod", "prod", "dr", exact))
+	assert.False(t, unmapped("pre-prod-1", "prod-1", "pre-prod-1", exact))
+	assert.True(t, unmapped("PROD", "prod", "dr", transform.MatchOptions{IgnoreCase: true}))
+	assert.False(t, unmapped("mydb", "db", "pg", transform.MatchOptions{WholeWord: true}))
+	assert.True(t, unmapped("my-db", "db", "pg", transform.MatchOptions{WholeWord: true}))
+}
+
+func TestDriftChecker_WithSections(t *testing.T) {
+	checker := NewDriftChecker([]v1.ConfigMap{{
+		ObjectMeta: metav1.ObjectMeta{Name: "domains"},
+		Data:       map[string]string{"example.com": "dr.example.com"},
+	}})
+	item := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "ConfigMap",
+		"metadata": map[string]interface{}{
+			"name":        "web",
+			"namespace":   "shop",
+			"annotations": map[string]interface{}{"example.com/owner": "team"},
+		},
+		"data": map[string]interface{}{"url": "https://example.com"},
+	}}
+	assert.Len(t, checker.Check(item), 2)
+
+	checker.WithSections("spec, data")
+	assert.Equal(t, []Drift{{Rules: "domains", Pattern: "example.com", Path: "data.url"}}, checker.Check(item), "the patterns were never applied to metadata")
+
+	checker.WithSections("spec.template")
+	assert.Len(t, checker.Check(item), 2, "without valid section, the whole item is checked")
+}
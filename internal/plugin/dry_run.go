@@ -0,0 +1,142 @@
+package plugin
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	jsonpatch "github.com/evanphx/json-patch"
+	"github.com/sirupsen/logrus"
+	velerov1 "github.com/vmware-tanzu/velero/pkg/apis/velero/v1"
+	"github.com/vmware-tanzu/velero/pkg/plugin/velero"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+const (
+	// dryRunEnv, when true, makes the restore plugin compute the changes it
+	// would make, log and report them, and restore the items unmodified.
+	dryRunEnv = "REPLACE_PATTERN_DRY_RUN"
+	// dryRunAnnotation on a Restore overrides dryRunEnv.
+	dryRunAnnotation = "agoracalyce.io/dry-run"
+
+	// reportDiffsKey is the report document listing the changes of a dry
+	// run.
+	reportDiffsKey = "diffs.json"
+	// maxDryRunDiffs bounds the changes kept in the report, which must fit in
+	// a ConfigMap; the logs list them all.
+	maxDryRunDiffs = 1000
+)
+
+// itemDiff is the change the plugin would make to an item of the restore.
+type itemDiff struct {
+	Kind      string `json:"kind"`
+	Namespace string `json:"namespace,omitempty"`
+	Name      string `json:"name"`
+	// Patch is the JSON merge patch from the item to its transformed version
+	Patch json.RawMessage `json:"patch,omitempty"`
+	// Skipped is set when the item would not be restored
+	Skipped bool `json:"skipped,omitempty"`
+}
+
+func (d itemDiff) key() string {
+	return d.Kind + "/" + d.Namespace + "/" + d.Name
+}
+
+// loadDryRun returns whether dryRunEnv enables the dry-run mode.
+func loadDryRun(lookup lookupFunc, logger logrus.FieldLogger) bool {
+	value, ok := lookup(dryRunEnv)
+	if !ok {
+		return false
+	}
+	dryRun, err := strconv.ParseBool(value)
+	if err != nil {
+		logger.Warnf("Ignoring invalid %s=%q", dryRunEnv, value)
+		return false
+	}
+	if dryRun {
+		logger.Infof("Dry-run mode: items are restored unmodified, their changes only logged and reported")
+	}
+	return dryRun
+}
+
+// isDryRun returns whether the restore is a dry run: its annotation, or else
+// the setting, says so.
+func (p *RestorePlugin) isDryRun(restore *velerov1.Restore) bool {
+	if restore == nil {
+		return p.dryRun
+	}
+	value, ok := restore.Annotations[dryRunAnnotation]
+	if !ok {
+		return p.dryRun
+	}
+	dryRun, err := strconv.ParseBool(strings.TrimSpace(value))
+	if err != nil {
+		p.logger.Warnf("Ignoring invalid %s annotation %q of Restore %s", dryRunAnnotation, value, restore.Name)
+		return p.dryRun
+	}
+	return dryRun
+}
+
+// dryRunOutput logs and reports the changes of output to the item of input,
+// and returns the item unmodified.
+func (p *RestorePlugin) dryRunOutput(input *velero.RestoreItemActionExecuteInput, output *velero.RestoreItemActionExecuteOutput, state *restoreState) (*velero.RestoreItemActionExecuteOutput, error) {
+	item := &unstructured.Unstructured{Object: input.Item.UnstructuredContent()}
+	diff, err := diffItem(item, output)
+	if err != nil {
+		p.logger.Warnf("Dry run: failed to compute the changes of %s %s/%s: %v", item.GetKind(), item.GetNamespace(), item.GetName(), err)
+		return velero.NewRestoreItemActionExecuteOutput(input.Item), nil
+	}
+	switch {
+	case diff.Skipped:
+		p.logger.Infof("Dry run: %s %s/%s would not be restored", diff.Kind, diff.Namespace, diff.Name)
+	case diff.Patch != nil:
+		p.logger.Infof("Dry run: %s %s/%s would be restored with %s", diff.Kind, diff.Namespace, diff.Name, diff.Patch)
+	default:
+		return velero.NewRestoreItemActionExecuteOutput(input.Item), nil
+	}
+	if state.report != nil {
+		state.report.recordDiff(diff)
+		p.scheduleReportFlush(state.report)
+	}
+	return velero.NewRestoreItemActionExecuteOutput(input.Item), nil
+}
+
+// diffItem returns the change output makes to item. Patch is nil when it makes
+// none.
+func diffItem(item *unstructured.Unstructured, output *velero.RestoreItemActionExecuteOutput) (itemDiff, error) {
+	diff := itemDiff{Kind: item.GetKind(), Namespace: item.GetNamespace(), Name: item.GetName(), Skipped: output.SkipRestore}
+	if output.UpdatedItem == nil {
+		return diff, nil
+	}
+	before, err := json.Marshal(item.Object)
+	if err != nil {
+		return diff, err
+	}
+	after, err := json.Marshal(output.UpdatedItem.UnstructuredContent())
+	if err != nil {
+		return diff, err
+	}
+	patch, err := jsonpatch.CreateMergePatch(before, after)
+	if err != nil {
+		return diff, fmt.Errorf("failed to create merge patch: %v", err)
+	}
+	if string(patch) != "{}" {
+		diff.Patch = patch
+	}
+	return diff, nil
+}
+
+// recordDiff keeps the change of an item, the first maxDryRunDiffs items only.
+func (r *restoreReport) recordDiff(diff itemDiff) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.diffs == nil {
+		r.diffs = make(map[string]itemDiff)
+	}
+	if _, ok := r.diffs[diff.key()]; !ok && len(r.diffs) >= maxDryRunDiffs {
+		r.summary.DiffsDropped++
+		return
+	}
+	r.diffs[diff.key()] = diff
+}
@@ -0,0 +1,132 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	velerov1 "github.com/vmware-tanzu/velero/pkg/apis/velero/v1"
+	"github.com/vmware-tanzu/velero/pkg/plugin/velero"
+	"github.com/wrkt/velero-custom-plugins/internal/config"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestLoadDryRun(t *testing.T) {
+	assert.False(t, loadDryRun(os.LookupEnv, logrus.New()))
+
+	t.Setenv(dryRunEnv, "true")
+	assert.True(t, loadDryRun(os.LookupEnv, logrus.New()))
+
+	t.Setenv(dryRunEnv, "maybe")
+	assert.False(t, loadDryRun(os.LookupEnv, logrus.New()))
+
+	// the environment only passes the registered settings
+	t.Setenv(dryRunEnv, "true")
+	c, err := config.Load(settings, config.Environment())
+	require.NoError(t, err)
+	assert.True(t, loadDryRun(c.Lookup, logrus.New()))
+	t.Setenv(dryRunEnv, "maybe")
+	_, err = config.Load(settings, config.Environment())
+	assert.Error(t, err, "invalid values are rejected on load")
+}
+
+func TestIsDryRun(t *testing.T) {
+	plugin := &RestorePlugin{logger: logrus.New(), dryRun: true}
+	assert.True(t, plugin.isDryRun(nil))
+
+	restore := &velerov1.Restore{ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{dryRunAnnotation: "false"}}}
+	assert.False(t, plugin.isDryRun(restore), "the Restore overrides the setting")
+
+	restore.Annotations[dryRunAnnotation] = "later"
+	assert.True(t, plugin.isDryRun(restore), "an invalid annotation falls back to the setting")
+
+	plugin.dryRun = false
+	restore.Annotations[dryRunAnnotation] = "true"
+	assert.True(t, plugin.isDryRun(restore))
+}
+
+func TestReplacePatternAction_DryRun(t *testing.T) {
+	t.Setenv(stampOriginEnv, "false")
+	plugin := &RestorePlugin{logger: logrus.New()}
+	sets := []ruleSet{{name: "hosts", patterns: map[string]string{"prod": "dr"}, excludeLabels: parseExclusions("backup-only")}}
+	restore := &velerov1.Restore{ObjectMeta: metav1.ObjectMeta{Name: "dr-1", UID: "uid-1", Annotations: map[string]string{dryRunAnnotation: "true"}}}
+
+	item := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "ConfigMap",
+		"metadata":   map[string]interface{}{"name": "web", "namespace": "shop"},
+		"data":       map[string]interface{}{"host": "api.prod.example.com", "port": "443"},
+	}}
+	output, err := replacePatternAction(plugin, &velero.RestoreItemActionExecuteInput{Item: item, Restore: restore}, sets)
+	require.NoError(t, err)
+	assert.Equal(t, item, output.UpdatedItem, "the item is restored unmodified")
+	assert.Equal(t, "api.prod.example.com", item.Object["data"].(map[string]interface{})["host"])
+
+	excluded := item.DeepCopy()
+	excluded.SetName("cache")
+	excluded.SetLabels(map[string]string{"backup-only": "true"})
+	output, err = replacePatternAction(plugin, &velero.RestoreItemActionExecuteInput{Item: excluded, Restore: restore}, sets)
+	require.NoError(t, err)
+	assert.False(t, output.SkipRestore, "excluded items are restored too")
+
+	unchanged := item.DeepCopy()
+	unchanged.SetName("empty")
+	unchanged.Object["data"] = map[string]interface{}{"port": "443"}
+	_, err = replacePatternAction(plugin, &velero.RestoreItemActionExecuteInput{Item: unchanged, Restore: restore}, sets)
+	require.NoError(t, err)
+
+	report := plugin.stateFor(restore).report
+	data, err := report.data()
+	require.NoError(t, err)
+	var diffs []itemDiff
+	require.NoError(t, json.Unmarshal([]byte(data[reportDiffsKey]), &diffs))
+	require.Len(t, diffs, 2, "items without changes are left out")
+	assert.Equal(t, itemDiff{Kind: "ConfigMap", Namespace: "shop", Name: "cache", Skipped: true}, diffs[0])
+	assert.Equal(t, "web", diffs[1].Name)
+	assert.JSONEq(t, `{"data": {"host": "api.dr.example.com"}}`, string(diffs[1].Patch))
+	assert.Contains(t, data[reportSummaryKey], `"dryRun":true`)
+
+	restore = &velerov1.Restore{ObjectMeta: metav1.ObjectMeta{Name: "dr-2", UID: "uid-2"}}
+	output, err = replacePatternAction(plugin, &velero.RestoreItemActionExecuteInput{Item: item, Restore: restore}, sets)
+	require.NoError(t, err)
+	assert.Equal(t, "api.dr.example.com", output.UpdatedItem.UnstructuredContent()["data"].(map[string]interface{})["host"])
+	assert.Empty(t, plugin.stateFor(restore).report.diffs)
+}
+
+func TestRecordDiff(t *testing.T) {
+	report := newRestoreReport("dr-1")
+	for i := 0; i < maxDryRunDiffs+2; i++ {
+		report.recordDiff(itemDiff{Kind: "ConfigMap", Namespace: "shop", Name: fmt.Sprintf("cm-%d", i)})
+	}
+	report.recordDiff(itemDiff{Kind: "ConfigMap", Namespace: "shop", Name: "cm-0", Skipped: true})
+	assert.Len(t, report.diffs, maxDryRunDiffs)
+	assert.Equal(t, 2, report.summary.DiffsDropped)
+	assert.True(t, report.diffs["ConfigMap/shop/cm-0"].Skipped, "the items already kept are updated")
+}
+
+func TestFlushReport_DryRun(t *testing.T) {
+	configMaps := fake.NewSimpleClientset().CoreV1().ConfigMaps("velero")
+	plugin := &RestorePlugin{logger: logrus.New(), configMapClient: configMaps, dryRun: true}
+	restore := &velerov1.Restore{ObjectMeta: metav1.ObjectMeta{
+		Name:        "dr-1",
+		UID:         "uid-1",
+		Annotations: map[string]string{migrationAnnotation: "shop-to-dr"},
+	}}
+
+	report := plugin.stateFor(restore).report
+	report.recordApplied(pattern1, replacement1)
+	report.recordRename(item("", "Service", "web", "foo"), item("", "Service", "web", "bar"))
+	require.NoError(t, plugin.flushReport(report))
+
+	list, err := configMaps.List(context.Background(), metav1.ListOptions{})
+	require.NoError(t, err)
+	require.Len(t, list.Items, 1, "neither the inverse rule set nor the migration state is written")
+	assert.Equal(t, report.configMapName(), list.Items[0].Name)
+}
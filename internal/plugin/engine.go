@@ -0,0 +1,128 @@
+package plugin
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/sirupsen/logrus"
+	velerov1 "github.com/vmware-tanzu/velero/pkg/apis/velero/v1"
+	"github.com/vmware-tanzu/velero/pkg/plugin/velero"
+	"github.com/wrkt/velero-custom-plugins/internal/transform"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// RulesSelector selects the pattern and transformer ConfigMaps.
+const RulesSelector = "agoracalyce.io/replace-pattern=RestoreItemAction"
+
+// RulesVersionAnnotation names the bundle version a rule ConfigMap belongs to.
+const RulesVersionAnnotation = rulesVersionAnnotation
+
+// Engine runs the transformer chain of the restore plugin outside of Velero,
+// with rule ConfigMaps given up front instead of read from the cluster.
+type Engine struct {
+	plugin     *RestorePlugin
+	configMaps []v1.ConfigMap
+	restore    *velerov1.Restore
+}
+
+// NewEngine returns an engine applying configMaps as the plugin would during
+// restore, which may be nil. lister resolves the resources named in the
+// agoracalyce.io/resources annotation; without it, only kinds are understood.
+// It fails when the restore pins other rules.
+func NewEngine(configMaps []v1.ConfigMap, restore *velerov1.Restore, lister resourceLister, logger logrus.FieldLogger) (*Engine, error) {
+	if err := checkRulesPin(restore, configMaps); err != nil {
+		return nil, err
+	}
+	p := &RestorePlugin{
+		logger:            logger,
+		limits:            loadLimits(os.LookupEnv, logger),
+		protectedPrefixes: loadProtectedPrefixes(os.LookupEnv, logger),
+		sections:          loadSections(os.LookupEnv, logger),
+		veleroPolicy:      loadVeleroResourcesPolicy(os.LookupEnv, logger),
+	}
+	if lister != nil {
+		p.resolver = newResourceResolver(lister, logger)
+	}
+	if restore != nil {
+		// an engine outlives restores: it keeps no report
+		p.states = map[types.UID]*restoreState{restore.UID: {breaker: transform.NewBreaker(p.limits.breakerThreshold)}}
+	}
+	return &Engine{plugin: p, configMaps: expandRules(configMaps, logger), restore: restore}, nil
+}
+
+// SkipOrigin disables the original identity annotations, meaningless on
+// objects that do not come from a backup.
+func (e *Engine) SkipOrigin() {
+	e.plugin.skipOrigin = true
+}
+
+// Transform returns the transformed item, and whether it is excluded from
+// restore. The item is not modified.
+func (e *Engine) Transform(item *unstructured.Unstructured) (*unstructured.Unstructured, bool, error) {
+	input := &velero.RestoreItemActionExecuteInput{Item: item.DeepCopy(), ItemFromBackup: item, Restore: e.restore}
+	output, err := e.Execute(input)
+	if err != nil {
+		return nil, false, err
+	}
+	return &unstructured.Unstructured{Object: output.UpdatedItem.UnstructuredContent()}, output.SkipRestore, nil
+}
+
+// Execute runs the chain on input as the plugin's Execute would, with the
+// rules of the engine. The restore of input should be the one of the engine,
+// or nil.
+func (e *Engine) Execute(input *velero.RestoreItemActionExecuteInput) (*velero.RestoreItemActionExecuteOutput, error) {
+	gvk := input.Item.GetObjectKind().GroupVersionKind()
+	return replacePatternAction(e.plugin, input, ruleSetsFrom(e.plugin.configMapsFor(gvk, e.configMaps)))
+}
+
+// LiteralPatterns returns the literal patterns of a rule ConfigMap with their
+// replacements, those of the literal rules of a structured ConfigMap, nil for
+// a ConfigMap configuring another transformer.
+func LiteralPatterns(configMap v1.ConfigMap) map[string]string {
+	var patterns map[string]string
+	for _, set := range ruleSetsFrom(expandRules([]v1.ConfigMap{configMap}, quietLogger)) {
+		if !set.isLiteral() {
+			continue
+		}
+		if patterns == nil {
+			patterns = make(map[string]string)
+		}
+		for pattern, replacement := range set.patterns {
+			patterns[pattern] = replacement
+		}
+	}
+	return patterns
+}
+
+// ValidateRules returns the errors of the rule ConfigMaps, one per ConfigMap
+// the plugin would ignore or fail to build.
+func ValidateRules(configMaps []v1.ConfigMap) []error {
+	var errs []error
+	var expanded []v1.ConfigMap
+	for _, configMap := range configMaps {
+		if !isStructured(configMap) {
+			expanded = append(expanded, configMap)
+			continue
+		}
+		doc, err := parseRulesDocument(configMap.Data[rulesKey])
+		if err != nil {
+			errs = append(errs, fmt.Errorf("ConfigMap %s: %v", configMap.Name, err))
+			continue
+		}
+		for _, r := range doc.Rules {
+			expanded = append(expanded, r.configMap(configMap))
+		}
+	}
+	for _, set := range ruleSetsFrom(expanded) {
+		err := set.loadErr()
+		if err == nil && !set.isLiteral() {
+			_, err = set.build(quietLogger)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("ConfigMap %s: %v", set.name, err))
+		}
+	}
+	return errs
+}
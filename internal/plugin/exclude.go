@@ -0,0 +1,125 @@
+package plugin
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/wrkt/velero-custom-plugins/internal/transform"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+const (
+	// excludeLabelsAnnotation and excludeAnnotationsAnnotation on a pattern
+	// ConfigMap list the labels and annotations that mark an item as never to be
+	// restored, as comma-separated `key` or `key=value` entries.
+	excludeLabelsAnnotation      = "agoracalyce.io/exclude-labels"
+	excludeAnnotationsAnnotation = "agoracalyce.io/exclude-annotations"
+
+	// excludePathsAnnotation on a pattern ConfigMap lists the fields its
+	// patterns never rewrite, comma-separated, as JSONPath expressions whose
+	// lists are only selected with [*].
+	excludePathsAnnotation = "agoracalyce.io/exclude-paths"
+	// excludeStringsAnnotation on a pattern ConfigMap lists comma-separated
+	// strings its patterns never rewrite, even when a broader pattern
+	// matches them.
+	excludeStringsAnnotation = "agoracalyce.io/exclude-strings"
+)
+
+// exclusion matches a label or annotation key, and its value when set.
+type exclusion struct {
+	key      string
+	value    string
+	anyValue bool
+}
+
+// parseExclusions parses a comma-separated list of `key` or `key=value`.
+func parseExclusions(list string) []exclusion {
+	var exclusions []exclusion
+	for _, entry := range strings.Split(list, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		key, value, found := strings.Cut(entry, "=")
+		exclusions = append(exclusions, exclusion{
+			key:      strings.TrimSpace(key),
+			value:    strings.TrimSpace(value),
+			anyValue: !found,
+		})
+	}
+	return exclusions
+}
+
+// excludedPaths returns the fields the patterns of the set never rewrite, as
+// protected paths, in which lists are transparent.
+func (s ruleSet) excludedPaths() ([][]string, error) {
+	if s.excludePaths == "" {
+		return nil, nil
+	}
+	paths, err := transform.ParseFieldPaths(s.excludePaths)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s annotation: %v", excludePathsAnnotation, err)
+	}
+	protected := make([][]string, 0, len(paths))
+	for _, path := range paths {
+		var keys []string
+		for _, segment := range path {
+			switch {
+			case segment.Index == nil:
+				keys = append(keys, segment.Key)
+			case *segment.Index >= 0:
+				return nil, fmt.Errorf("invalid %s annotation: %s selects a list element, only [*] is supported", excludePathsAnnotation, path)
+			}
+		}
+		protected = append(protected, keys)
+	}
+	return protected, nil
+}
+
+// parseExcludedStrings parses the comma-separated excludeStringsAnnotation.
+func parseExcludedStrings(list string) []string {
+	var excluded []string
+	for _, entry := range strings.Split(list, ",") {
+		if entry = strings.TrimSpace(entry); entry != "" {
+			excluded = append(excluded, entry)
+		}
+	}
+	return excluded
+}
+
+// formatExclusions is the inverse of parseExclusions.
+func formatExclusions(exclusions []exclusion) string {
+	entries := make([]string, 0, len(exclusions))
+	for _, e := range exclusions {
+		if e.anyValue {
+			entries = append(entries, e.key)
+		} else {
+			entries = append(entries, e.key+"="+e.value)
+		}
+	}
+	return strings.Join(entries, ",")
+}
+
+// matchExclusions returns the first entry of metadata matched by one of exclusions.
+func matchExclusions(exclusions []exclusion, metadata map[string]string) (string, bool) {
+	for _, e := range exclusions {
+		value, ok := metadata[e.key]
+		if ok && (e.anyValue || value == e.value) {
+			return e.key + "=" + value, true
+		}
+	}
+	return "", false
+}
+
+// excludes reports whether the set marks the item as never to be restored, and
+// the label or annotation that did.
+func (s ruleSet) excludes(item *unstructured.Unstructured) (string, bool) {
+	if match, ok := matchExclusions(s.excludeLabels, item.GetLabels()); ok {
+		return "label " + match, true
+	}
+	if match, ok := matchExclusions(s.excludeAnnotations, item.GetAnnotations()); ok {
+		return "annotation " + match, true
+	}
+	return "", false
+}
@@ -0,0 +1,129 @@
+package plugin
+
+import (
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	velerov1 "github.com/vmware-tanzu/velero/pkg/apis/velero/v1"
+	"github.com/vmware-tanzu/velero/pkg/plugin/velero"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func TestParseExclusions(t *testing.T) {
+	assert.Equal(t, []exclusion{
+		{key: "example.com/dr", value: "skip"},
+		{key: "example.com/ephemeral", anyValue: true},
+		{key: "empty"},
+	}, parseExclusions(" example.com/dr = skip,, example.com/ephemeral ,empty="))
+	assert.Nil(t, parseExclusions(""))
+}
+
+func TestReplacePatternAction_Exclusions(t *testing.T) {
+	plugin := &RestorePlugin{logger: logrus.New()}
+	restore := &velerov1.Restore{ObjectMeta: metav1.ObjectMeta{Name: "dr-1", UID: types.UID("dr-1")}}
+	sets := ruleSetsFrom([]v1.ConfigMap{{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "policy",
+			Annotations: map[string]string{
+				excludeLabelsAnnotation:      "example.com/dr=skip",
+				excludeAnnotationsAnnotation: "example.com/ephemeral",
+			},
+		},
+		Data: map[string]string{"production": "review-3"},
+	}})
+
+	tests := []struct {
+		name        string
+		labels      map[string]string
+		annotations map[string]string
+		excluded    bool
+	}{
+		{name: "label with value", labels: map[string]string{"example.com/dr": "skip"}, excluded: true},
+		{name: "label with another value", labels: map[string]string{"example.com/dr": "keep"}},
+		{name: "annotation with any value", annotations: map[string]string{"example.com/ephemeral": ""}, excluded: true},
+		{name: "unmarked"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			item := &unstructured.Unstructured{}
+			item.SetAPIVersion("v1")
+			item.SetKind("ConfigMap")
+			item.SetName("production-cache")
+			item.SetNamespace("production")
+			item.SetLabels(tt.labels)
+			item.SetAnnotations(tt.annotations)
+
+			output, err := replacePatternAction(plugin, &velero.RestoreItemActionExecuteInput{Item: item, Restore: restore}, sets)
+			require.NoError(t, err)
+			assert.Equal(t, tt.excluded, output.SkipRestore)
+			if !tt.excluded {
+				assert.Equal(t, "review-3-cache", output.UpdatedItem.(*unstructured.Unstructured).GetName())
+			}
+		})
+	}
+	assert.Equal(t, 2, plugin.stateFor(restore).report.summary.ItemsExcluded)
+}
+
+func TestRuleSetExcludedPaths(t *testing.T) {
+	set := ruleSet{excludePaths: "spec.template.spec.containers[*].args, metadata.annotations['example.com/owner']"}
+	paths, err := set.excludedPaths()
+	require.NoError(t, err)
+	assert.Equal(t, [][]string{{"spec", "template", "spec", "containers", "args"}, {"metadata", "annotations", "example.com/owner"}}, paths)
+
+	_, err = ruleSet{excludePaths: "spec.containers[0].args"}.excludedPaths()
+	assert.ErrorContains(t, err, "only [*]")
+	_, err = ruleSet{excludePaths: "spec..args"}.excludedPaths()
+	assert.Error(t, err)
+}
+
+func TestReplacePatternAction_ExcludedPathsAndStrings(t *testing.T) {
+	t.Setenv(stampOriginEnv, "false")
+	plugin := &RestorePlugin{logger: logrus.New()}
+	restore := &velerov1.Restore{ObjectMeta: metav1.ObjectMeta{Name: "dr-1", UID: types.UID("dr-1")}}
+	configMaps := []v1.ConfigMap{{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "hosts",
+			Annotations: map[string]string{
+				excludePathsAnnotation:   "spec.template.spec.containers[*].command",
+				excludeStringsAnnotation: "db.example.com-replica, example.com/owner",
+			},
+		},
+		Data: map[string]string{"example.com": "dr.example.com"},
+	}}
+	sets := ruleSetsFrom(configMaps)
+
+	deployment := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "apps/v1",
+		"kind":       "Deployment",
+		"metadata": map[string]interface{}{
+			"name":        "web",
+			"namespace":   "shop",
+			"annotations": map[string]interface{}{"example.com/owner": "web.example.com"},
+		},
+		"spec": map[string]interface{}{"template": map[string]interface{}{"spec": map[string]interface{}{
+			"containers": []interface{}{map[string]interface{}{
+				"name":    "web",
+				"command": []interface{}{"run", "--seed=example.com"},
+				"args":    []interface{}{"--db=db.example.com", "--replica=db.example.com-replica"},
+			}},
+		}}},
+	}}
+	output, err := replacePatternAction(plugin, &velero.RestoreItemActionExecuteInput{Item: deployment, Restore: restore}, sets)
+	require.NoError(t, err)
+	restored := output.UpdatedItem.(*unstructured.Unstructured)
+	containers, _, _ := unstructured.NestedSlice(restored.Object, "spec", "template", "spec", "containers")
+	container := containers[0].(map[string]interface{})
+	assert.Equal(t, []interface{}{"run", "--seed=example.com"}, container["command"])
+	assert.Equal(t, []interface{}{"--db=db.dr.example.com", "--replica=db.example.com-replica"}, container["args"])
+	assert.Equal(t, map[string]string{"example.com/owner": "web.dr.example.com"}, restored.GetAnnotations(), "the key is excluded")
+	assert.Empty(t, plugin.stateFor(restore).report.applied, "the patterns are not recorded as applied")
+
+	// the exclusions survive a recording
+	assert.Equal(t, sets, ruleSetsFrom([]v1.ConfigMap{sets[0].configMap()}))
+	assert.Empty(t, NewDriftChecker(configMaps).sets)
+}
@@ -0,0 +1,49 @@
+package plugin
+
+import (
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vmware-tanzu/velero/pkg/plugin/velero"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestReplacePatternAction_FieldRefs(t *testing.T) {
+	t.Setenv(stampOriginEnv, "false")
+	plugin := &RestorePlugin{logger: logrus.New()}
+	// ".name" would also rewrite the structure of the downward API paths
+	sets := []ruleSet{{patterns: map[string]string{"production": "review-3", ".name": ".id"}}}
+
+	pod := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "Pod",
+		"metadata": map[string]interface{}{
+			"name":      "web",
+			"namespace": "production",
+			"labels":    map[string]interface{}{"production.example.com/tier": "web"},
+		},
+		"spec": map[string]interface{}{
+			"containers": []interface{}{map[string]interface{}{
+				"name": "web",
+				"env": []interface{}{
+					map[string]interface{}{"name": "TIER", "valueFrom": map[string]interface{}{
+						"fieldRef": map[string]interface{}{"fieldPath": "metadata.labels['production.example.com/tier']"},
+					}},
+					map[string]interface{}{"name": "POD", "valueFrom": map[string]interface{}{
+						"fieldRef": map[string]interface{}{"fieldPath": "metadata.name"},
+					}},
+				},
+			}},
+		},
+	}}
+
+	output, err := replacePatternAction(plugin, &velero.RestoreItemActionExecuteInput{Item: pod}, sets)
+	require.NoError(t, err)
+	content := output.UpdatedItem.UnstructuredContent()
+
+	assert.Equal(t, map[string]interface{}{"review-3.example.com/tier": "web"}, lookupPath(t, content, "metadata.labels"))
+	assert.Equal(t, "metadata.labels['review-3.example.com/tier']", lookupPath(t, content, "spec.containers.0.env.0.valueFrom.fieldRef.fieldPath"))
+	assert.Equal(t, "metadata.name", lookupPath(t, content, "spec.containers.0.env.1.valueFrom.fieldRef.fieldPath"))
+}
@@ -0,0 +1,159 @@
+package plugin
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vmware-tanzu/velero/pkg/plugin/velero"
+	"github.com/wrkt/velero-custom-plugins/internal/fixtures"
+	"github.com/wrkt/velero-custom-plugins/internal/transform"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// TestReplacePatternAction_Fixtures runs the whole transformer chain against
+// the fixture corpus.
+func TestReplacePatternAction_Fixtures(t *testing.T) {
+	patterns := map[string]string{
+		"foo-production": "foo-review-3",
+		"example.com":    "replaced.com",
+	}
+
+	tests := []struct {
+		fixture  string
+		expected map[string]interface{}
+	}{
+		{
+			fixture: "deployment",
+			expected: map[string]interface{}{
+				"metadata.name":                          "foo-review-3-api",
+				"metadata.namespace":                     "foo-review-3",
+				"spec.replicas":                          int64(3),
+				"spec.template.spec.containers.0.image":  "registry.replaced.com/foo/api:1.4.2",
+				"spec.template.spec.containers.0.args.0": "--database-url=postgres://db.foo-review-3.replaced.com:5432/foo",
+				"spec.template.spec.containers.0.env.1.valueFrom.fieldRef.fieldPath": "metadata.namespace",
+				"spec.template.spec.volumes.0.configMap.name":                        "foo-review-3-config",
+			},
+		},
+		{
+			fixture: "statefulset",
+			expected: map[string]interface{}{
+				"spec.serviceName": "foo-review-3-db-headless",
+				"spec.template.spec.containers.0.env.1.value":       "foo-review-3-db-0.foo-review-3-db-headless.foo-review-3.svc.cluster.local",
+				"spec.volumeClaimTemplates.0.spec.storageClassName": "ceph-rbd",
+			},
+		},
+		{
+			fixture: "prometheus",
+			expected: map[string]interface{}{
+				"metadata.name":                                  "foo-review-3",
+				"spec.externalUrl":                               "https://prometheus.foo-review-3.replaced.com",
+				"spec.externalLabels.cluster":                    "production",
+				"spec.remoteWrite.0.url":                         "https://thanos-receive.production.replaced.com/api/v1/receive",
+				"spec.remoteWrite.0.writeRelabelConfigs.0.regex": "go_.*",
+			},
+		},
+		{
+			fixture: "certificate",
+			expected: map[string]interface{}{
+				"spec.secretName":     "foo-review-3-tls",
+				"spec.dnsNames.1":     "www.foo-review-3.replaced.com",
+				"spec.issuerRef.name": "letsencrypt-production",
+			},
+		},
+		{
+			fixture: "helm-release-secret",
+			expected: map[string]interface{}{
+				"metadata.name":        "sh.helm.release.v1.foo-review-3.v3",
+				"metadata.labels.name": "foo-review-3",
+				"type":                 "helm.sh/release.v1",
+			},
+		},
+		{
+			fixture: "istio-virtualservice",
+			expected: map[string]interface{}{
+				"spec.hosts.0":                                "api.foo-review-3.replaced.com",
+				"spec.gateways.0":                             "istio-system/production-gateway",
+				"spec.http.0.route.1.destination.host":        "foo-review-3-api-canary.foo-review-3.svc.cluster.local",
+				"spec.http.0.route.1.destination.port.number": int64(8080),
+				"spec.http.0.route.1.weight":                  int64(10),
+			},
+		},
+		{
+			fixture: "istio-gateway",
+			expected: map[string]interface{}{
+				"spec.servers.0.hosts.0":            "*.foo-review-3.replaced.com",
+				"spec.servers.0.tls.credentialName": "foo-review-3-tls",
+				"spec.servers.0.port.number":        int64(443),
+			},
+		},
+		{
+			fixture: "istio-destinationrule",
+			expected: map[string]interface{}{
+				"spec.host": "foo-review-3-api.foo-review-3.svc.cluster.local",
+				"spec.trafficPolicy.connectionPool.tcp.maxConnections": int64(100),
+				"spec.subsets.1.labels.track":                          "canary",
+			},
+		},
+	}
+
+	// every fixture must be covered
+	var covered []string
+	for _, tt := range tests {
+		covered = append(covered, tt.fixture)
+	}
+	assert.ElementsMatch(t, fixtures.Names(), covered)
+
+	plugin := &RestorePlugin{logger: logrus.New()}
+	for _, tt := range tests {
+		t.Run(tt.fixture, func(t *testing.T) {
+			item := fixtures.MustLoad(tt.fixture)
+			input := &velero.RestoreItemActionExecuteInput{Item: item}
+
+			output, err := replacePatternAction(plugin, input, []ruleSet{{patterns: patterns}})
+			require.NoError(t, err)
+
+			content := output.UpdatedItem.UnstructuredContent()
+			assert.Equal(t, item.GetAPIVersion(), content["apiVersion"])
+			assert.Equal(t, item.GetKind(), content["kind"])
+			for path, value := range tt.expected {
+				assert.Equal(t, value, lookupPath(t, content, path), path)
+			}
+
+			// the original identity is kept on purpose, the rest must be rewritten
+			annotations := output.UpdatedItem.(*unstructured.Unstructured).GetAnnotations()
+			assert.Equal(t, item.GetName(), annotations[transform.OriginalNameAnnotation])
+			assert.Equal(t, item.GetNamespace(), annotations[transform.OriginalNamespaceAnnotation])
+			unstructured.RemoveNestedField(content, "metadata", "annotations", transform.OriginalNameAnnotation)
+			unstructured.RemoveNestedField(content, "metadata", "annotations", transform.OriginalNamespaceAnnotation)
+
+			jsonData, err := json.Marshal(content)
+			require.NoError(t, err)
+			assert.NotContains(t, string(jsonData), "foo-production")
+		})
+	}
+}
+
+// lookupPath resolves a dotted path where numeric segments index lists.
+func lookupPath(t *testing.T, obj map[string]interface{}, path string) interface{} {
+	var current interface{} = obj
+	for _, segment := range strings.Split(path, ".") {
+		switch v := current.(type) {
+		case map[string]interface{}:
+			current = v[segment]
+		case []interface{}:
+			var index int
+			if _, err := fmt.Sscanf(segment, "%d", &index); err != nil || index >= len(v) {
+				t.Fatalf("invalid index %q in path %q", segment, path)
+			}
+			current = v[index]
+		default:
+			t.Fatalf("path %q does not resolve", path)
+		}
+	}
+	return current
+}
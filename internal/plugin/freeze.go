@@ -0,0 +1,63 @@
+package plugin
+
+import (
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	velerov1 "github.com/vmware-tanzu/velero/pkg/apis/velero/v1"
+	"github.com/wrkt/velero-custom-plugins/internal/transform"
+)
+
+const (
+	// freezeWindowEnv is how long after the start of a restore its workloads
+	// stay frozen, such as 30m; unset or 0 disables the freeze.
+	freezeWindowEnv = "REPLACE_PATTERN_FREEZE_WINDOW"
+	// freezeWindowAnnotation on a Restore overrides freezeWindowEnv.
+	freezeWindowAnnotation = "agoracalyce.io/freeze-window"
+)
+
+// loadFreezeWindow returns the window of freezeWindowEnv, zero when unset or
+// invalid.
+func loadFreezeWindow(lookup lookupFunc, logger logrus.FieldLogger) time.Duration {
+	value, ok := lookup(freezeWindowEnv)
+	if !ok {
+		return 0
+	}
+	window, err := time.ParseDuration(strings.TrimSpace(value))
+	if err != nil || window < 0 {
+		logger.Warnf("Ignoring invalid %s %q: must be a positive duration such as 30m", freezeWindowEnv, value)
+		return 0
+	}
+	if window > 0 {
+		logger.Infof("Freezing the restored workloads for %v", window)
+	}
+	return window
+}
+
+// freezeTransformer returns the transformer stamping the workloads with the
+// end of the freeze window of the Restore, nil when it has none. The window
+// starts with the restore, so it ends at the same time for all its items.
+func (p *RestorePlugin) freezeTransformer(restore *velerov1.Restore) transform.Transformer {
+	window := p.freezeWindow
+	start := time.Now()
+	if restore != nil {
+		if value, ok := restore.Annotations[freezeWindowAnnotation]; ok {
+			override, err := time.ParseDuration(strings.TrimSpace(value))
+			if err != nil || override < 0 {
+				p.logger.Warnf("Ignoring invalid %s annotation %q of Restore %s: must be a positive duration such as 30m", freezeWindowAnnotation, value, restore.Name)
+			} else {
+				window = override
+			}
+		}
+		if restore.Status.StartTimestamp != nil {
+			start = restore.Status.StartTimestamp.Time
+		} else if !restore.CreationTimestamp.IsZero() {
+			start = restore.CreationTimestamp.Time
+		}
+	}
+	if window <= 0 {
+		return nil
+	}
+	return &transform.Freeze{Until: start.Add(window)}
+}
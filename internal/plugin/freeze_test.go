@@ -0,0 +1,70 @@
+package plugin
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	velerov1 "github.com/vmware-tanzu/velero/pkg/apis/velero/v1"
+	"github.com/vmware-tanzu/velero/pkg/plugin/velero"
+	"github.com/wrkt/velero-custom-plugins/internal/transform"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestLoadFreezeWindow(t *testing.T) {
+	assert.Zero(t, loadFreezeWindow(os.LookupEnv, logrus.New()))
+
+	t.Setenv(freezeWindowEnv, "30m")
+	assert.Equal(t, 30*time.Minute, loadFreezeWindow(os.LookupEnv, logrus.New()))
+
+	for _, invalid := range []string{"30", "-5m", "soon"} {
+		t.Setenv(freezeWindowEnv, invalid)
+		assert.Zero(t, loadFreezeWindow(os.LookupEnv, logrus.New()), invalid)
+	}
+}
+
+func TestReplacePatternAction_Freeze(t *testing.T) {
+	t.Setenv(stampOriginEnv, "false")
+	plugin := &RestorePlugin{logger: logrus.New(), freezeWindow: 30 * time.Minute}
+	start := metav1.NewTime(time.Date(2026, 10, 16, 9, 0, 0, 0, time.UTC))
+	restore := &velerov1.Restore{
+		ObjectMeta: metav1.ObjectMeta{Name: "dr-1", CreationTimestamp: metav1.NewTime(start.Add(-time.Minute))},
+		Status:     velerov1.RestoreStatus{StartTimestamp: &start},
+	}
+	deployment := func() *unstructured.Unstructured {
+		return &unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": "apps/v1",
+			"kind":       "Deployment",
+			"metadata":   map[string]interface{}{"name": "web", "namespace": "shop"},
+			"spec": map[string]interface{}{"template": map[string]interface{}{"spec": map[string]interface{}{
+				"containers": []interface{}{map[string]interface{}{"name": "web", "image": "web:1"}},
+			}}},
+		}}
+	}
+	freezeUntil := func() string {
+		output, err := replacePatternAction(plugin, &velero.RestoreItemActionExecuteInput{Item: deployment(), Restore: restore}, nil)
+		require.NoError(t, err)
+		return output.UpdatedItem.(*unstructured.Unstructured).GetAnnotations()[transform.FreezeUntilAnnotation]
+	}
+
+	assert.Equal(t, "2026-10-16T09:30:00Z", freezeUntil())
+
+	restore.Annotations = map[string]string{freezeWindowAnnotation: "2h"}
+	assert.Equal(t, "2026-10-16T11:00:00Z", freezeUntil(), "the Restore overrides the setting")
+
+	restore.Annotations[freezeWindowAnnotation] = "0"
+	assert.Empty(t, freezeUntil(), "a zero window disables the freeze")
+
+	restore.Annotations[freezeWindowAnnotation] = "later"
+	assert.Equal(t, "2026-10-16T09:30:00Z", freezeUntil(), "an invalid annotation falls back to the setting")
+
+	restore.Annotations, restore.Status.StartTimestamp = nil, nil
+	assert.Equal(t, "2026-10-16T09:29:00Z", freezeUntil(), "restores not started yet count from their creation")
+
+	plugin.freezeWindow = 0
+	assert.Empty(t, freezeUntil())
+}
@@ -0,0 +1,20 @@
+package plugin
+
+import (
+	"github.com/vmware-tanzu/velero/pkg/plugin/velero"
+	"github.com/wrkt/velero-custom-plugins/internal/transform"
+)
+
+// gatewayRefs returns the transformer keeping the references of Gateway API
+// resources consistent with the namespace mapping of the restore and the
+// rename registry of report, which may be nil.
+func gatewayRefs(input *velero.RestoreItemActionExecuteInput, report *restoreReport) transform.Transformer {
+	refs := &transform.GatewayRefs{Namespace: originalItem(input).GetNamespace()}
+	if input.Restore != nil {
+		refs.Namespaces = input.Restore.Spec.NamespaceMapping
+	}
+	if report != nil {
+		refs.Renamed = report.renamed
+	}
+	return refs
+}
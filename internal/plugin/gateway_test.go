@@ -0,0 +1,53 @@
+package plugin
+
+import (
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	velerov1 "github.com/vmware-tanzu/velero/pkg/apis/velero/v1"
+	"github.com/vmware-tanzu/velero/pkg/plugin/velero"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestReplacePatternAction_GatewayRefs(t *testing.T) {
+	t.Setenv(stampOriginEnv, "false")
+	plugin := &RestorePlugin{logger: logrus.New()}
+	restore := &velerov1.Restore{
+		ObjectMeta: metav1.ObjectMeta{Name: "dr-1", UID: "uid-1"},
+		Spec:       velerov1.RestoreSpec{NamespaceMapping: map[string]string{"shop": "shop-dr", "infra": "infra-dr"}},
+	}
+	sets := []ruleSet{{patterns: map[string]string{"gw-prod": "gw-dr"}}}
+
+	// restored first, the Gateway is renamed by the rules and registered
+	gateway := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "gateway.networking.k8s.io/v1",
+		"kind":       "Gateway",
+		"metadata":   map[string]interface{}{"name": "gw-prod", "namespace": "infra"},
+	}}
+	restored := gateway.DeepCopy()
+	restored.SetNamespace("infra-dr")
+	_, err := replacePatternAction(plugin, &velero.RestoreItemActionExecuteInput{Item: restored, ItemFromBackup: gateway, Restore: restore}, sets)
+	require.NoError(t, err)
+
+	newNamespace, newName, ok := plugin.stateFor(restore).report.renamed("gateway.networking.k8s.io", "Gateway", "infra", "gw-prod")
+	require.True(t, ok)
+	assert.Equal(t, [2]string{"infra-dr", "gw-dr"}, [2]string{newNamespace, newName})
+
+	// the route is restored without rules, its parentRef follows the registry
+	route := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "gateway.networking.k8s.io/v1",
+		"kind":       "HTTPRoute",
+		"metadata":   map[string]interface{}{"name": "web", "namespace": "shop"},
+		"spec": map[string]interface{}{
+			"parentRefs": []interface{}{map[string]interface{}{"name": "gw-prod", "namespace": "infra"}},
+		},
+	}}
+	restored = route.DeepCopy()
+	restored.SetNamespace("shop-dr")
+	output, err := replacePatternAction(plugin, &velero.RestoreItemActionExecuteInput{Item: restored, ItemFromBackup: route, Restore: restore}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"name": "gw-dr", "namespace": "infra-dr"}, lookupPath(t, output.UpdatedItem.UnstructuredContent(), "spec.parentRefs.0"))
+}
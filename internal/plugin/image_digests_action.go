@@ -0,0 +1,171 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	velerov1 "github.com/vmware-tanzu/velero/pkg/apis/velero/v1"
+	"github.com/vmware-tanzu/velero/pkg/plugin/velero"
+	"github.com/wrkt/velero-custom-plugins/internal/transform"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes"
+	corev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/rest"
+)
+
+// ImageDigestsPlugin is a backup item action recording, in the
+// transform.ImageDigestsAnnotation of pods and workloads, the digests of the
+// images their containers run, for the image-pinning transformer to pin them
+// at restore time.
+type ImageDigestsPlugin struct {
+	logger logrus.FieldLogger
+	// pods lists the pods of workloads, nil when they cannot be listed:
+	// only pods then get their digests
+	pods corev1.PodsGetter
+}
+
+// NewImageDigestsPlugin instantiates an ImageDigestsPlugin.
+func NewImageDigestsPlugin(logger logrus.FieldLogger) *ImageDigestsPlugin {
+	config, err := rest.InClusterConfig()
+	if err != nil {
+		logger.Fatalf("Failed to create in-cluster config: %v", err)
+	}
+	clientset, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		logger.Fatalf("Failed to create clientset: %v", err)
+	}
+	p := &ImageDigestsPlugin{logger: logger, pods: clientset.CoreV1()}
+	if disabledFeatures(clientset.AuthorizationV1().SelfSubjectAccessReviews(), imageDigestsPermissions, false, logger)[featureWorkloadPods] {
+		p.pods = nil
+	}
+	return p
+}
+
+// Name implements BackupItemAction.
+func (p *ImageDigestsPlugin) Name() string {
+	return "agoracalyce.io/image-digests"
+}
+
+// AppliesTo returns a ResourceSelector that matches pods and the workloads
+// running them.
+func (p *ImageDigestsPlugin) AppliesTo() (velero.ResourceSelector, error) {
+	return velero.ResourceSelector{
+		IncludedResources: []string{"pods", "deployments.apps", "statefulsets.apps", "daemonsets.apps", "replicasets.apps", "jobs.batch"},
+	}, nil
+}
+
+// Execute records the digests of the images of the item. Workloads get the
+// ones of their running pods that still run the images of their template.
+func (p *ImageDigestsPlugin) Execute(item runtime.Unstructured, backup *velerov1.Backup) (runtime.Unstructured, []velero.ResourceIdentifier, error) {
+	object := &unstructured.Unstructured{Object: item.UnstructuredContent()}
+	specPath := []string{"spec", "template", "spec"}
+	if object.GetKind() == "Pod" {
+		specPath = []string{"spec"}
+	}
+	var spec v1.PodSpec
+	rawSpec, found, _ := unstructured.NestedMap(object.Object, specPath...)
+	if !found {
+		return item, nil, nil
+	}
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(rawSpec, &spec); err != nil {
+		return nil, nil, fmt.Errorf("failed to decode the pod spec of %s %s/%s: %v", object.GetKind(), object.GetNamespace(), object.GetName(), err)
+	}
+
+	var pods []v1.Pod
+	if object.GetKind() == "Pod" {
+		var pod v1.Pod
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(object.Object, &pod); err != nil {
+			return nil, nil, fmt.Errorf("failed to decode pod %s/%s: %v", object.GetNamespace(), object.GetName(), err)
+		}
+		pods = []v1.Pod{pod}
+	} else {
+		if p.pods == nil {
+			return item, nil, nil
+		}
+		rawSelector, found, _ := unstructured.NestedMap(object.Object, "spec", "selector")
+		if !found {
+			return item, nil, nil
+		}
+		var labelSelector metav1.LabelSelector
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(rawSelector, &labelSelector); err != nil {
+			return nil, nil, fmt.Errorf("invalid selector of %s %s/%s: %v", object.GetKind(), object.GetNamespace(), object.GetName(), err)
+		}
+		selector, err := metav1.LabelSelectorAsSelector(&labelSelector)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid selector of %s %s/%s: %v", object.GetKind(), object.GetNamespace(), object.GetName(), err)
+		}
+		list, err := p.pods.Pods(object.GetNamespace()).List(context.Background(), metav1.ListOptions{LabelSelector: selector.String()})
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to list the pods of %s %s/%s: %v", object.GetKind(), object.GetNamespace(), object.GetName(), err)
+		}
+		pods = list.Items
+	}
+
+	digests, ambiguous := podDigests(spec, pods)
+	if len(ambiguous) > 0 {
+		p.logger.Warnf("Not recording the digests of containers %s of %s %s/%s: their pods run different images", strings.Join(ambiguous, ", "), object.GetKind(), object.GetNamespace(), object.GetName())
+	}
+	if len(digests) == 0 {
+		return item, nil, nil
+	}
+	value, err := json.Marshal(digests)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to encode image digests: %v", err)
+	}
+	annotations := object.GetAnnotations()
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+	annotations[transform.ImageDigestsAnnotation] = string(value)
+	object.SetAnnotations(annotations)
+	return object, nil, nil
+}
+
+// podDigests returns the digests of the images the containers of spec run in
+// pods, by container name, and the containers whose pods run different
+// digests. Pods running other images than spec, as during a rollout, are
+// ignored.
+func podDigests(spec v1.PodSpec, pods []v1.Pod) (map[string]string, []string) {
+	images := make(map[string]string)
+	for _, container := range append(append([]v1.Container{}, spec.InitContainers...), spec.Containers...) {
+		images[container.Name] = container.Image
+	}
+
+	digests := make(map[string]string)
+	conflicts := make(map[string]bool)
+	for _, pod := range pods {
+		podImages := make(map[string]string)
+		for _, container := range append(append([]v1.Container{}, pod.Spec.InitContainers...), pod.Spec.Containers...) {
+			podImages[container.Name] = container.Image
+		}
+		for _, status := range append(append([]v1.ContainerStatus{}, pod.Status.InitContainerStatuses...), pod.Status.ContainerStatuses...) {
+			image, ok := images[status.Name]
+			if !ok || podImages[status.Name] != image {
+				continue
+			}
+			_, digest, ok := strings.Cut(status.ImageID, "@")
+			if !ok || digest == "" {
+				continue
+			}
+			if recorded, ok := digests[status.Name]; ok && recorded != digest {
+				conflicts[status.Name] = true
+			}
+			digests[status.Name] = digest
+		}
+	}
+
+	var ambiguous []string
+	for name := range conflicts {
+		delete(digests, name)
+		ambiguous = append(ambiguous, name)
+	}
+	sort.Strings(ambiguous)
+	return digests, ambiguous
+}
@@ -0,0 +1,75 @@
+package plugin
+
+import (
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	velerov1 "github.com/vmware-tanzu/velero/pkg/apis/velero/v1"
+	biav1 "github.com/vmware-tanzu/velero/pkg/plugin/velero/backupitemaction/v1"
+	"github.com/wrkt/velero-custom-plugins/internal/transform"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+var _ biav1.BackupItemAction = &ImageDigestsPlugin{}
+
+// webPod is a pod of the web Deployment running image web:tag with digest.
+func webPod(name, tag, digest string) *v1.Pod {
+	return &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "shop", Labels: map[string]string{"app": "web"}},
+		Spec:       v1.PodSpec{Containers: []v1.Container{{Name: "web", Image: "web:" + tag}, {Name: "proxy", Image: "envoy:latest"}}},
+		Status: v1.PodStatus{ContainerStatuses: []v1.ContainerStatus{
+			{Name: "web", Image: "web:" + tag, ImageID: "docker.io/library/web@" + digest},
+			{Name: "proxy", Image: "envoy:latest", ImageID: "docker-pullable://envoy@sha256:" + name},
+		}},
+	}
+}
+
+func TestImageDigestsPlugin(t *testing.T) {
+	clientset := fake.NewSimpleClientset(
+		webPod("web-1", "latest", "sha256:new"),
+		webPod("web-2", "latest", "sha256:new"),
+		// left by the rollout
+		webPod("web-0", "old", "sha256:old"),
+	)
+	plugin := &ImageDigestsPlugin{logger: logrus.New(), pods: clientset.CoreV1()}
+	deployment := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "apps/v1",
+		"kind":       "Deployment",
+		"metadata":   map[string]interface{}{"name": "web", "namespace": "shop"},
+		"spec": map[string]interface{}{
+			"selector": map[string]interface{}{"matchLabels": map[string]interface{}{"app": "web"}},
+			"template": map[string]interface{}{"spec": map[string]interface{}{"containers": []interface{}{
+				map[string]interface{}{"name": "web", "image": "web:latest"},
+				map[string]interface{}{"name": "proxy", "image": "envoy:latest"},
+			}}},
+		},
+	}}
+
+	out, extra, err := plugin.Execute(deployment, &velerov1.Backup{})
+	require.NoError(t, err)
+	assert.Empty(t, extra)
+	annotations := out.(*unstructured.Unstructured).GetAnnotations()
+	// the proxies run different digests
+	assert.JSONEq(t, `{"web": "sha256:new"}`, annotations[transform.ImageDigestsAnnotation])
+
+	content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(webPod("web-0", "old", "sha256:old"))
+	require.NoError(t, err)
+	pod := &unstructured.Unstructured{Object: content}
+	pod.SetKind("Pod")
+	out, _, err = plugin.Execute(pod, &velerov1.Backup{})
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"web": "sha256:old", "proxy": "sha256:web-0"}`, out.(*unstructured.Unstructured).GetAnnotations()[transform.ImageDigestsAnnotation])
+
+	// no running pod, nothing to record
+	unstructured.SetNestedField(deployment.Object, "api", "spec", "selector", "matchLabels", "app")
+	deployment.SetAnnotations(nil)
+	out, _, err = plugin.Execute(deployment, &velerov1.Backup{})
+	require.NoError(t, err)
+	assert.Empty(t, out.(*unstructured.Unstructured).GetAnnotations())
+}
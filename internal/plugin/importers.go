@@ -0,0 +1,366 @@
+package plugin
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"regexp/syntax"
+
+	"github.com/sirupsen/logrus"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+	"sigs.k8s.io/yaml"
+)
+
+// Formats accepted by Import.
+const (
+	ImportK10       = "k10"
+	ImportCrane     = "crane"
+	ImportKustomize = "kustomize"
+)
+
+// importedFromAnnotation records what an imported ConfigMap was converted from.
+const importedFromAnnotation = "agoracalyce.io/imported-from"
+
+// patchOp is a JSON patch operation. K10 adds regex to replace operations.
+type patchOp struct {
+	Op    string      `json:"op"`
+	Path  string      `json:"path"`
+	Value interface{} `json:"value,omitempty"`
+	Regex string      `json:"regex,omitempty"`
+}
+
+// k10Transform is a transform of a K10 TransformSet or restore action.
+type k10Transform struct {
+	Name    string `json:"name"`
+	Subject struct {
+		Group    string `json:"group"`
+		Resource string `json:"resource"`
+		Name     string `json:"name"`
+	} `json:"subject"`
+	JSON []patchOp `json:"json"`
+}
+
+// kustomization holds the fields of a kustomization.yaml the importer reads.
+type kustomization struct {
+	Namespace string `json:"namespace"`
+	Images    []struct {
+		Name    string `json:"name"`
+		NewName string `json:"newName"`
+		NewTag  string `json:"newTag"`
+		Digest  string `json:"digest"`
+	} `json:"images"`
+	Patches []struct {
+		Path   string `json:"path"`
+		Patch  string `json:"patch"`
+		Target *struct {
+			Group string `json:"group"`
+			Kind  string `json:"kind"`
+			Name  string `json:"name"`
+		} `json:"target"`
+	} `json:"patches"`
+	PatchesJSON6902       []json6902Patch `json:"patchesJson6902"`
+	PatchesStrategicMerge []interface{}   `json:"patchesStrategicMerge"`
+	Replacements          []interface{}   `json:"replacements"`
+}
+
+type json6902Patch struct {
+	Path   string `json:"path"`
+	Patch  string `json:"patch"`
+	Target struct {
+		Group string `json:"group"`
+		Kind  string `json:"kind"`
+		Name  string `json:"name"`
+	} `json:"target"`
+}
+
+// importedSet is a pattern ConfigMap converted from another tool.
+type importedSet struct {
+	source    string
+	resources string
+	patterns  map[string]string
+}
+
+// Import converts the transformation config of another tool, read from in,
+// into pattern ConfigMaps written to out as a YAML stream. The ConfigMaps are
+// named after prefix. What has no equivalent is logged as a warning.
+func Import(format string, in io.Reader, out io.Writer, prefix string, logger logrus.FieldLogger) error {
+	var sets []importedSet
+	var skipped []string
+	var err error
+	switch format {
+	case ImportK10:
+		sets, skipped, err = importK10(in)
+	case ImportCrane:
+		sets, skipped, err = importCrane(in)
+	case ImportKustomize:
+		sets, skipped, err = importKustomize(in)
+	default:
+		return fmt.Errorf("unknown format %q, expected %s, %s or %s", format, ImportK10, ImportCrane, ImportKustomize)
+	}
+	if err != nil {
+		return err
+	}
+	for _, reason := range skipped {
+		logger.Warnf("Not converted: %s", reason)
+	}
+
+	n := 0
+	for _, set := range sets {
+		if len(set.patterns) == 0 {
+			continue
+		}
+		n++
+		configMap := v1.ConfigMap{
+			TypeMeta: metav1.TypeMeta{APIVersion: "v1", Kind: "ConfigMap"},
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        fmt.Sprintf("%s-%d", prefix, n),
+				Namespace:   "velero",
+				Labels:      map[string]string{"agoracalyce.io/replace-pattern": "RestoreItemAction"},
+				Annotations: map[string]string{importedFromAnnotation: set.source},
+			},
+			Data: set.patterns,
+		}
+		if set.resources != "" {
+			configMap.Annotations[resourcesAnnotation] = set.resources
+		}
+		data, err := yaml.Marshal(configMap)
+		if err != nil {
+			return fmt.Errorf("failed to encode ConfigMap: %v", err)
+		}
+		if _, err := fmt.Fprintf(out, "---\n%s", data); err != nil {
+			return fmt.Errorf("failed to write ConfigMap: %v", err)
+		}
+	}
+	if n == 0 {
+		return fmt.Errorf("nothing could be converted")
+	}
+	return nil
+}
+
+// importK10 converts the transforms of K10 TransformSets, restore policies or
+// bare lists of transforms.
+func importK10(in io.Reader) ([]importedSet, []string, error) {
+	var sets []importedSet
+	var skipped []string
+	err := decodeDocuments(in, func(doc []byte) error {
+		var transforms []k10Transform
+		var object struct {
+			Spec struct {
+				Transforms []k10Transform `json:"transforms"`
+				Actions    []struct {
+					RestoreParameters struct {
+						Transforms []k10Transform `json:"transforms"`
+					} `json:"restoreParameters"`
+				} `json:"actions"`
+			} `json:"spec"`
+		}
+		if bytes.HasPrefix(bytes.TrimSpace(doc), []byte("-")) || bytes.HasPrefix(bytes.TrimSpace(doc), []byte("[")) {
+			if err := yaml.Unmarshal(doc, &transforms); err != nil {
+				return fmt.Errorf("failed to read K10 transforms: %v", err)
+			}
+		} else {
+			if err := yaml.Unmarshal(doc, &object); err != nil {
+				return fmt.Errorf("failed to read K10 object: %v", err)
+			}
+			transforms = object.Spec.Transforms
+			for _, action := range object.Spec.Actions {
+				transforms = append(transforms, action.RestoreParameters.Transforms...)
+			}
+		}
+
+		for _, t := range transforms {
+			source := "k10 transform " + t.Name
+			resources := t.Subject.Resource
+			if resources != "" && t.Subject.Group != "" {
+				resources += "." + t.Subject.Group
+			}
+			if t.Subject.Name != "" {
+				skipped = append(skipped, fmt.Sprintf("%s: restricted to %s, the patterns apply to every %s", source, t.Subject.Name, t.Subject.Resource))
+			}
+			patterns, reasons := convertPatch(t.JSON)
+			for _, reason := range reasons {
+				skipped = append(skipped, source+": "+reason)
+			}
+			sets = append(sets, importedSet{source: source, resources: resources, patterns: patterns})
+		}
+		return nil
+	})
+	return sets, skipped, err
+}
+
+// importCrane converts the JSON patches written by crane transform, one list
+// of operations per document.
+func importCrane(in io.Reader) ([]importedSet, []string, error) {
+	var sets []importedSet
+	var skipped []string
+	n := 0
+	err := decodeDocuments(in, func(doc []byte) error {
+		var ops []patchOp
+		if err := yaml.Unmarshal(doc, &ops); err != nil {
+			return fmt.Errorf("failed to read crane patch: %v", err)
+		}
+		n++
+		source := fmt.Sprintf("crane patch %d", n)
+		patterns, reasons := convertPatch(ops)
+		for _, reason := range reasons {
+			skipped = append(skipped, source+": "+reason)
+		}
+		sets = append(sets, importedSet{source: source, patterns: patterns})
+		return nil
+	})
+	return sets, skipped, err
+}
+
+// importKustomize converts the image overrides and the inline JSON 6902
+// patches of a kustomization.
+func importKustomize(in io.Reader) ([]importedSet, []string, error) {
+	data, err := io.ReadAll(in)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read kustomization: %v", err)
+	}
+	var k kustomization
+	if err := yaml.Unmarshal(data, &k); err != nil {
+		return nil, nil, fmt.Errorf("failed to read kustomization: %v", err)
+	}
+
+	var sets []importedSet
+	var skipped []string
+	if k.Namespace != "" {
+		skipped = append(skipped, fmt.Sprintf("namespace %s: use the namespaceMapping of the Restore", k.Namespace))
+	}
+	if len(k.PatchesStrategicMerge) > 0 {
+		skipped = append(skipped, fmt.Sprintf("%d strategic merge patches", len(k.PatchesStrategicMerge)))
+	}
+	if len(k.Replacements) > 0 {
+		skipped = append(skipped, fmt.Sprintf("%d replacements", len(k.Replacements)))
+	}
+
+	images := importedSet{source: "kustomize images", patterns: make(map[string]string)}
+	for _, image := range k.Images {
+		if image.NewName != "" && image.NewName != image.Name {
+			images.patterns[image.Name] = image.NewName
+		}
+		if image.NewTag != "" || image.Digest != "" {
+			skipped = append(skipped, fmt.Sprintf("image %s: the tag or digest it replaces is unknown", image.Name))
+		}
+	}
+	sets = append(sets, images)
+
+	patches := k.PatchesJSON6902
+	for _, patch := range k.Patches {
+		if patch.Target == nil {
+			skipped = append(skipped, "patch without target: strategic merge patches have no equivalent")
+			continue
+		}
+		patches = append(patches, json6902Patch{Path: patch.Path, Patch: patch.Patch, Target: *patch.Target})
+	}
+	for _, patch := range patches {
+		source := "kustomize patch of " + patch.Target.Kind
+		if patch.Target.Name != "" {
+			source += " " + patch.Target.Name
+			skipped = append(skipped, fmt.Sprintf("%s: restricted to %s, the patterns apply to every %s", source, patch.Target.Name, patch.Target.Kind))
+		}
+		if patch.Patch == "" {
+			skipped = append(skipped, fmt.Sprintf("%s: patches read from %s, inline them to convert them", source, patch.Path))
+			continue
+		}
+		var ops []patchOp
+		if err := yaml.Unmarshal([]byte(patch.Patch), &ops); err != nil {
+			skipped = append(skipped, fmt.Sprintf("%s: not a JSON 6902 patch", source))
+			continue
+		}
+		resources := patch.Target.Kind
+		if resources != "" && patch.Target.Group != "" {
+			resources += "." + patch.Target.Group
+		}
+		patterns, reasons := convertPatch(ops)
+		for _, reason := range reasons {
+			skipped = append(skipped, source+": "+reason)
+		}
+		sets = append(sets, importedSet{source: source, resources: resources, patterns: patterns})
+	}
+	return sets, skipped, nil
+}
+
+// convertPatch turns the replace operations of a JSON patch into literal
+// patterns. The value a replace operation overwrites must be known: from a test
+// operation on the same path before it, or from a regex matching a literal. The other operations have no equivalent.
+func convertPatch(ops []patchOp) (map[string]string, []string) {
+	patterns := make(map[string]string)
+	var skipped []string
+	tested := make(map[string]string)
+	for _, op := range ops {
+		switch op.Op {
+		case "test":
+			if value, ok := op.Value.(string); ok {
+				tested[op.Path] = value
+			}
+			continue
+		case "replace":
+		default:
+			skipped = append(skipped, fmt.Sprintf("%s of %s has no equivalent", op.Op, op.Path))
+			continue
+		}
+
+		replacement, ok := op.Value.(string)
+		if !ok {
+			skipped = append(skipped, fmt.Sprintf("replace of %s: only string values are converted", op.Path))
+			continue
+		}
+		var pattern string
+		switch {
+		case op.Regex != "":
+			if pattern, ok = literalRegex(op.Regex); !ok {
+				skipped = append(skipped, fmt.Sprintf("replace of %s: regex %q is not a literal", op.Path, op.Regex))
+				continue
+			}
+		default:
+			if pattern, ok = tested[op.Path]; !ok {
+				skipped = append(skipped, fmt.Sprintf("replace of %s: the value it replaces is unknown, test it first", op.Path))
+				continue
+			}
+		}
+		if pattern == "" || pattern == replacement {
+			continue
+		}
+		if existing, ok := patterns[pattern]; ok && existing != replacement {
+			skipped = append(skipped, fmt.Sprintf("replace of %s: %q is already replaced by %q", op.Path, pattern, existing))
+			continue
+		}
+		patterns[pattern] = replacement
+	}
+	return patterns, skipped
+}
+
+// literalRegex returns the string a regular expression matches when it only
+// matches that string.
+func literalRegex(expr string) (string, bool) {
+	re, err := syntax.Parse(expr, syntax.Perl)
+	if err != nil || re.Op != syntax.OpLiteral || re.Flags&syntax.FoldCase != 0 {
+		return "", false
+	}
+	return string(re.Rune), true
+}
+
+// decodeDocuments calls fn with every non-empty document of a YAML stream.
+func decodeDocuments(in io.Reader, fn func(doc []byte) error) error {
+	reader := utilyaml.NewYAMLReader(bufio.NewReader(in))
+	for {
+		doc, err := reader.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read document: %v", err)
+		}
+		if trimmed := bytes.TrimSpace(doc); len(trimmed) == 0 || string(trimmed) == "---" {
+			continue
+		}
+		if err := fn(doc); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,148 @@
+package plugin
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConvertPatch(t *testing.T) {
+	patterns, skipped := convertPatch([]patchOp{
+		{Op: "test", Path: "/spec/host", Value: "web.example.com"},
+		{Op: "replace", Path: "/spec/host", Value: "web.dr.example.com"},
+		{Op: "replace", Path: "/spec/image", Regex: `registry\.prod`, Value: "registry.dr"},
+		{Op: "replace", Path: "/spec/other", Regex: "prod-(.*)", Value: "dr-$1"},
+		{Op: "replace", Path: "/spec/unknown", Value: "x"},
+		{Op: "replace", Path: "/spec/replicas", Value: float64(1)},
+		{Op: "remove", Path: "/spec/nodeSelector"},
+	})
+	assert.Equal(t, map[string]string{"web.example.com": "web.dr.example.com", "registry.prod": "registry.dr"}, patterns)
+	assert.Equal(t, []string{
+		`replace of /spec/other: regex "prod-(.*)" is not a literal`,
+		"replace of /spec/unknown: the value it replaces is unknown, test it first",
+		"replace of /spec/replicas: only string values are converted",
+		"remove of /spec/nodeSelector has no equivalent",
+	}, skipped)
+}
+
+func TestImport_K10(t *testing.T) {
+	in := `apiVersion: config.kio.kasten.io/v1alpha1
+kind: TransformSet
+metadata:
+  name: dr
+spec:
+  transforms:
+  - name: ingress-hosts
+    subject:
+      resource: ingresses
+      group: networking.k8s.io
+    json:
+    - op: test
+      path: /spec/rules/0/host
+      value: shop.example.com
+    - op: replace
+      path: /spec/rules/0/host
+      value: shop.dr.example.com
+  - name: one-deployment
+    subject:
+      resource: deployments
+      name: web
+    json:
+    - op: replace
+      path: /spec/template/spec/containers/0/image
+      regex: registry\.prod\.local
+      value: registry.dr.local
+`
+	logger, hook := test.NewNullLogger()
+	var out bytes.Buffer
+	require.NoError(t, Import(ImportK10, strings.NewReader(in), &out, "k10", logger))
+
+	configMaps, err := ReadConfigMaps(&out)
+	require.NoError(t, err)
+	require.Len(t, configMaps, 2)
+	assert.Equal(t, "k10-1", configMaps[0].Name)
+	assert.Equal(t, "RestoreItemAction", configMaps[0].Labels["agoracalyce.io/replace-pattern"])
+	assert.Equal(t, "ingresses.networking.k8s.io", configMaps[0].Annotations[resourcesAnnotation])
+	assert.Equal(t, map[string]string{"shop.example.com": "shop.dr.example.com"}, configMaps[0].Data)
+	assert.Equal(t, "deployments", configMaps[1].Annotations[resourcesAnnotation])
+	assert.Equal(t, map[string]string{"registry.prod.local": "registry.dr.local"}, configMaps[1].Data)
+
+	require.Len(t, hook.AllEntries(), 1)
+	assert.Equal(t, "Not converted: k10 transform one-deployment: restricted to web, the patterns apply to every deployments", hook.LastEntry().Message)
+}
+
+func TestImport_Crane(t *testing.T) {
+	in := `- op: test
+  path: /spec/storageClassName
+  value: gp2
+- op: replace
+  path: /spec/storageClassName
+  value: premium-rwo
+---
+- op: remove
+  path: /metadata/uid
+`
+	var out bytes.Buffer
+	require.NoError(t, Import(ImportCrane, strings.NewReader(in), &out, "crane", logrus.New()))
+	configMaps, err := ReadConfigMaps(&out)
+	require.NoError(t, err)
+	require.Len(t, configMaps, 1)
+	assert.Equal(t, map[string]string{"gp2": "premium-rwo"}, configMaps[0].Data)
+	assert.Equal(t, "crane patch 1", configMaps[0].Annotations[importedFromAnnotation])
+
+	err = Import(ImportCrane, strings.NewReader("- op: remove\n  path: /metadata/uid\n"), &out, "crane", logrus.New())
+	assert.EqualError(t, err, "nothing could be converted")
+}
+
+func TestImport_Kustomize(t *testing.T) {
+	in := `apiVersion: kustomize.config.k8s.io/v1beta1
+kind: Kustomization
+namespace: shop-dr
+images:
+- name: registry.prod.local/shop/web
+  newName: registry.dr.local/shop/web
+- name: nginx
+  newTag: "1.25"
+patches:
+- target:
+    kind: Ingress
+    group: networking.k8s.io
+  patch: |-
+    - op: test
+      path: /spec/rules/0/host
+      value: shop.example.com
+    - op: replace
+      path: /spec/rules/0/host
+      value: shop.dr.example.com
+- path: resources-patch.yaml
+`
+	logger, hook := test.NewNullLogger()
+	var out bytes.Buffer
+	require.NoError(t, Import(ImportKustomize, strings.NewReader(in), &out, "kustomize", logger))
+	configMaps, err := ReadConfigMaps(&out)
+	require.NoError(t, err)
+	require.Len(t, configMaps, 2)
+	assert.Equal(t, map[string]string{"registry.prod.local/shop/web": "registry.dr.local/shop/web"}, configMaps[0].Data)
+	assert.Empty(t, configMaps[0].Annotations[resourcesAnnotation])
+	assert.Equal(t, "Ingress.networking.k8s.io", configMaps[1].Annotations[resourcesAnnotation])
+	assert.Equal(t, map[string]string{"shop.example.com": "shop.dr.example.com"}, configMaps[1].Data)
+
+	var warnings []string
+	for _, entry := range hook.AllEntries() {
+		warnings = append(warnings, entry.Message)
+	}
+	assert.Equal(t, []string{
+		"Not converted: namespace shop-dr: use the namespaceMapping of the Restore",
+		"Not converted: image nginx: the tag or digest it replaces is unknown",
+		"Not converted: patch without target: strategic merge patches have no equivalent",
+	}, warnings)
+}
+
+func TestImport_UnknownFormat(t *testing.T) {
+	assert.ErrorContains(t, Import("velero", strings.NewReader(""), &bytes.Buffer{}, "x", logrus.New()), `unknown format "velero"`)
+}
@@ -0,0 +1,53 @@
+package plugin
+
+import (
+	"strconv"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// reportDependenciesKey is the report document listing the dependencies of
+// the restored items, when an init-order ConfigMap asks for it.
+const reportDependenciesKey = "dependencies.json"
+
+// dependency is an item of the restore and the items it depends on.
+type dependency struct {
+	Kind      string   `json:"kind"`
+	Namespace string   `json:"namespace,omitempty"`
+	Name      string   `json:"name"`
+	DependsOn []string `json:"dependsOn"`
+}
+
+func (d dependency) key() string {
+	return d.Kind + "/" + d.Namespace + "/" + d.Name
+}
+
+func (r *restoreReport) recordDependencies(item dependency) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.dependencies == nil {
+		r.dependencies = make(map[string]dependency)
+	}
+	r.dependencies[item.key()] = item
+}
+
+// dependencyRecorder returns the OnDependencies function of the init-order
+// transformer, recording the dependencies in the report.
+func dependencyRecorder(report *restoreReport) func(*unstructured.Unstructured, []string) {
+	return func(item *unstructured.Unstructured, dependencies []string) {
+		report.recordDependencies(dependency{
+			Kind:      item.GetKind(),
+			Namespace: item.GetNamespace(),
+			Name:      item.GetName(),
+			DependsOn: dependencies,
+		})
+	}
+}
+
+// reportsDependencies tells whether an init-order set records the
+// dependencies in the report.
+func (s ruleSet) reportsDependencies() bool {
+	report, _ := strconv.ParseBool(strings.TrimSpace(s.config["report"]))
+	return s.transformer == transformerOrder && report
+}
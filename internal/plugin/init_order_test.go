@@ -0,0 +1,69 @@
+package plugin
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	velerov1 "github.com/vmware-tanzu/velero/pkg/apis/velero/v1"
+	"github.com/vmware-tanzu/velero/pkg/plugin/velero"
+	"github.com/wrkt/velero-custom-plugins/internal/transform"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestRuleSetBuild_InitOrder(t *testing.T) {
+	set := ruleSet{transformer: transformerOrder, config: map[string]string{
+		"wave-annotations": "argocd.argoproj.io/sync-wave, example.com/order",
+		"report":           "true",
+	}}
+	transformer, err := set.build(logrus.New())
+	require.NoError(t, err)
+	assert.Equal(t, []string{"argocd.argoproj.io/sync-wave", "example.com/order"}, transformer.(*transform.InitOrder).WaveAnnotations)
+	assert.True(t, set.reportsDependencies())
+	assert.False(t, ruleSet{transformer: transformerOrder, config: map[string]string{}}.reportsDependencies())
+
+	_, err = ruleSet{transformer: transformerOrder, config: map[string]string{"report": "sometimes"}}.build(logrus.New())
+	assert.Error(t, err)
+}
+
+func TestReplacePatternAction_InitOrder(t *testing.T) {
+	t.Setenv(stampOriginEnv, "false")
+	plugin := &RestorePlugin{logger: logrus.New()}
+	restore := &velerov1.Restore{ObjectMeta: metav1.ObjectMeta{Name: "dr-1", UID: "uid-1"}}
+	sets := ruleSetsFrom([]v1.ConfigMap{
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "order", Annotations: map[string]string{transformerAnnotation: transformerOrder}},
+			Data:       map[string]string{"report": "true"},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "names"},
+			Data:       map[string]string{"web-prod": "web-dr"},
+		},
+	})
+
+	pod := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "Pod",
+		"metadata":   map[string]interface{}{"name": "web", "namespace": "shop"},
+		"spec": map[string]interface{}{"containers": []interface{}{map[string]interface{}{
+			"name":    "web",
+			"envFrom": []interface{}{map[string]interface{}{"configMapRef": map[string]interface{}{"name": "web-prod"}}},
+		}}},
+	}}
+	output, err := replacePatternAction(plugin, &velero.RestoreItemActionExecuteInput{Item: pod, Restore: restore}, sets)
+	require.NoError(t, err)
+	annotations := output.UpdatedItem.(*unstructured.Unstructured).GetAnnotations()
+	// the dependencies are the restored names
+	assert.Equal(t, "ConfigMap/web-dr", annotations[transform.DependsOnAnnotation])
+	assert.Equal(t, "1", annotations[transform.InitOrderAnnotation])
+
+	data, err := plugin.stateFor(restore).report.data()
+	require.NoError(t, err)
+	var dependencies []dependency
+	require.NoError(t, json.Unmarshal([]byte(data[reportDependenciesKey]), &dependencies))
+	assert.Equal(t, []dependency{{Kind: "Pod", Namespace: "shop", Name: "web", DependsOn: []string{"ConfigMap/web-dr"}}}, dependencies)
+}
@@ -0,0 +1,38 @@
+package plugin
+
+import (
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"github.com/wrkt/velero-custom-plugins/internal/transform"
+	v1 "k8s.io/api/core/v1"
+)
+
+const (
+	// lastAppliedEnv selects how kubectl's last-applied-configuration
+	// annotation is handled: its nested document is either transformed with
+	// the same rules as the item, or stripped.
+	lastAppliedEnv = "REPLACE_PATTERN_LAST_APPLIED"
+
+	lastAppliedTransform = "transform"
+	lastAppliedStrip     = "strip"
+)
+
+// lastAppliedPath is never rewritten as a plain string: the rules are applied
+// to the decoded document instead, so the result stays valid JSON.
+var lastAppliedPath = []string{"metadata", "annotations", v1.LastAppliedConfigAnnotation}
+
+// lastAppliedTransformer returns the transformer handling the
+// last-applied-configuration annotation according to lastAppliedEnv.
+func lastAppliedTransformer(literals []transform.Transformer, lookup lookupFunc, logger logrus.FieldLogger) transform.Transformer {
+	policy, _ := lookup(lastAppliedEnv)
+	policy = strings.TrimSpace(policy)
+	switch policy {
+	case lastAppliedStrip:
+		return &transform.Embedded{Annotation: v1.LastAppliedConfigAnnotation, Strip: true}
+	case lastAppliedTransform, "":
+	default:
+		logger.Warnf("Invalid value %q for %s, using %q", policy, lastAppliedEnv, lastAppliedTransform)
+	}
+	return &transform.Embedded{Annotation: v1.LastAppliedConfigAnnotation, Transformers: literals}
+}
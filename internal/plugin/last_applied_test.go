@@ -0,0 +1,54 @@
+package plugin
+
+import (
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vmware-tanzu/velero/pkg/plugin/velero"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestReplacePatternAction_LastApplied(t *testing.T) {
+	t.Setenv(stampOriginEnv, "false")
+	plugin := &RestorePlugin{logger: logrus.New()}
+	sets := []ruleSet{{patterns: map[string]string{"production": "review-3", "quote": `"`}}}
+
+	newItem := func() *unstructured.Unstructured {
+		item := &unstructured.Unstructured{}
+		item.SetAPIVersion("v1")
+		item.SetKind("ConfigMap")
+		item.SetName("app")
+		item.SetNamespace("production")
+		item.SetAnnotations(map[string]string{
+			v1.LastAppliedConfigAnnotation: `{"apiVersion":"v1","data":{"mode":"quote"},"kind":"ConfigMap","metadata":{"name":"app","namespace":"production"}}` + "\n",
+		})
+		return item
+	}
+
+	tests := map[string]struct {
+		policy   string
+		expected map[string]string
+	}{
+		"transform by default": {
+			expected: map[string]string{
+				v1.LastAppliedConfigAnnotation: `{"apiVersion":"v1","data":{"mode":"\""},"kind":"ConfigMap","metadata":{"name":"app","namespace":"review-3"}}` + "\n",
+			},
+		},
+		"strip": {policy: lastAppliedStrip},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Setenv(lastAppliedEnv, tt.policy)
+
+			output, err := replacePatternAction(plugin, &velero.RestoreItemActionExecuteInput{Item: newItem()}, sets)
+			require.NoError(t, err)
+			item := output.UpdatedItem.(*unstructured.Unstructured)
+
+			assert.Equal(t, "review-3", item.GetNamespace())
+			assert.Equal(t, tt.expected, item.GetAnnotations())
+		})
+	}
+}
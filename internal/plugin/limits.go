@@ -0,0 +1,101 @@
+package plugin
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Environment variables read from the Velero server deployment, which the
+// plugin process inherits.
+const (
+	maxItemSizeEnv         = "REPLACE_PATTERN_MAX_ITEM_SIZE"
+	maxRulesEnv            = "REPLACE_PATTERN_MAX_RULES"
+	maxTransformLatencyEnv = "REPLACE_PATTERN_MAX_TRANSFORM_LATENCY"
+	breakerThresholdEnv    = "REPLACE_PATTERN_BREAKER_THRESHOLD"
+	itemTimeoutEnv         = "REPLACE_PATTERN_ITEM_TIMEOUT"
+	timeoutPolicyEnv       = "REPLACE_PATTERN_TIMEOUT_POLICY"
+
+	defaultBreakerThreshold = 5
+)
+
+// What to do with an item whose transformation timed out.
+const (
+	// timeoutRestoreOriginal restores the item as it was in the backup, after
+	// Velero's own mappings.
+	timeoutRestoreOriginal = "restore-original"
+	// timeoutSkip does not restore the item.
+	timeoutSkip = "skip"
+	// timeoutFail reports the item as failed to Velero.
+	timeoutFail = "fail"
+)
+
+// limits bounds the work the plugin accepts to do. Zero values mean no limit.
+type limits struct {
+	// maxItemSize is the estimated JSON size in bytes above which items are
+	// restored untouched.
+	maxItemSize int
+	// maxRules is the number of patterns above which the rule set is refused.
+	maxRules int
+	// maxTransformLatency is the time a transformer may spend on one item
+	// before the call counts as a failure.
+	maxTransformLatency time.Duration
+	// breakerThreshold is the number of consecutive failures after which a
+	// transformer is disabled for the rest of the restore.
+	breakerThreshold int
+	// itemTimeout is the wall-clock time the transformation of a single item
+	// may take, after which timeoutPolicy applies.
+	itemTimeout   time.Duration
+	timeoutPolicy string
+}
+
+func loadLimits(lookup lookupFunc, logger logrus.FieldLogger) limits {
+	l := limits{breakerThreshold: defaultBreakerThreshold, timeoutPolicy: timeoutRestoreOriginal}
+
+	if value, ok := lookup(maxItemSizeEnv); ok {
+		if n, err := strconv.Atoi(value); err == nil && n >= 0 {
+			l.maxItemSize = n
+		} else {
+			logger.Warnf("Ignoring invalid %s=%q", maxItemSizeEnv, value)
+		}
+	}
+	if value, ok := lookup(maxRulesEnv); ok {
+		if n, err := strconv.Atoi(value); err == nil && n >= 0 {
+			l.maxRules = n
+		} else {
+			logger.Warnf("Ignoring invalid %s=%q", maxRulesEnv, value)
+		}
+	}
+	if value, ok := lookup(maxTransformLatencyEnv); ok {
+		if d, err := time.ParseDuration(value); err == nil && d >= 0 {
+			l.maxTransformLatency = d
+		} else {
+			logger.Warnf("Ignoring invalid %s=%q", maxTransformLatencyEnv, value)
+		}
+	}
+	if value, ok := lookup(breakerThresholdEnv); ok {
+		if n, err := strconv.Atoi(value); err == nil && n >= 0 {
+			l.breakerThreshold = n
+		} else {
+			logger.Warnf("Ignoring invalid %s=%q", breakerThresholdEnv, value)
+		}
+	}
+	if value, ok := lookup(itemTimeoutEnv); ok {
+		if d, err := time.ParseDuration(value); err == nil && d >= 0 {
+			l.itemTimeout = d
+		} else {
+			logger.Warnf("Ignoring invalid %s=%q", itemTimeoutEnv, value)
+		}
+	}
+	if value, ok := lookup(timeoutPolicyEnv); ok {
+		switch value {
+		case timeoutRestoreOriginal, timeoutSkip, timeoutFail:
+			l.timeoutPolicy = value
+		default:
+			logger.Warnf("Ignoring invalid %s=%q", timeoutPolicyEnv, value)
+		}
+	}
+
+	return l
+}
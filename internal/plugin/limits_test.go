@@ -0,0 +1,153 @@
+package plugin
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	velerov1 "github.com/vmware-tanzu/velero/pkg/apis/velero/v1"
+	"github.com/vmware-tanzu/velero/pkg/plugin/velero"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestLoadLimits(t *testing.T) {
+	t.Setenv(maxItemSizeEnv, "1024")
+	t.Setenv(maxRulesEnv, "10")
+	t.Setenv(maxTransformLatencyEnv, "2s")
+	t.Setenv(breakerThresholdEnv, "not-a-number")
+	t.Setenv(itemTimeoutEnv, "30s")
+	t.Setenv(timeoutPolicyEnv, timeoutSkip)
+
+	l := loadLimits(os.LookupEnv, logrus.New())
+
+	assert.Equal(t, limits{
+		maxItemSize:         1024,
+		maxRules:            10,
+		maxTransformLatency: 2 * time.Second,
+		breakerThreshold:    defaultBreakerThreshold,
+		itemTimeout:         30 * time.Second,
+		timeoutPolicy:       timeoutSkip,
+	}, l)
+
+	t.Setenv(timeoutPolicyEnv, "retry")
+	assert.Equal(t, timeoutRestoreOriginal, loadLimits(os.LookupEnv, logrus.New()).timeoutPolicy)
+}
+
+func TestOnTimeout(t *testing.T) {
+	item := &unstructured.Unstructured{Object: map[string]interface{}{
+		"kind":     "ConfigMap",
+		"metadata": map[string]interface{}{"name": "foo"},
+	}}
+	input := &velero.RestoreItemActionExecuteInput{Item: item}
+
+	for policy, check := range map[string]func(*velero.RestoreItemActionExecuteOutput, error){
+		timeoutRestoreOriginal: func(output *velero.RestoreItemActionExecuteOutput, err error) {
+			require.NoError(t, err)
+			assert.Same(t, item, output.UpdatedItem)
+			assert.False(t, output.SkipRestore)
+		},
+		timeoutSkip: func(output *velero.RestoreItemActionExecuteOutput, err error) {
+			require.NoError(t, err)
+			assert.True(t, output.SkipRestore)
+		},
+		timeoutFail: func(output *velero.RestoreItemActionExecuteOutput, err error) {
+			assert.ErrorContains(t, err, "ConfigMap /foo timed out after 1s")
+		},
+	} {
+		plugin := &RestorePlugin{logger: logrus.New(), limits: limits{itemTimeout: time.Second, timeoutPolicy: policy}}
+		check(plugin.onTimeout(input, &restoreState{}, false))
+	}
+}
+
+func TestReplacePatternAction_Limits(t *testing.T) {
+	item := &unstructured.Unstructured{Object: map[string]interface{}{
+		"kind":     "ConfigMap",
+		"metadata": map[string]interface{}{"name": "foo"},
+		"data":     map[string]interface{}{"key": "foo"},
+	}}
+	input := &velero.RestoreItemActionExecuteInput{Item: item}
+	patterns := map[string]string{pattern2: replacement2, pattern1: replacement1}
+
+	tests := []struct {
+		name     string
+		limits   limits
+		expected string
+	}{
+		{name: "no limits", limits: limits{}, expected: replacement2},
+		{name: "too many rules", limits: limits{maxRules: 1}, expected: pattern2},
+		{name: "item too large", limits: limits{maxItemSize: 10}, expected: pattern2},
+		{name: "within limits", limits: limits{maxRules: 2, maxItemSize: 1000}, expected: replacement2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plugin := &RestorePlugin{logger: logrus.New(), limits: tt.limits}
+
+			output, err := replacePatternAction(plugin, input, []ruleSet{{patterns: patterns}})
+			require.NoError(t, err)
+
+			value, _, _ := unstructured.NestedString(output.UpdatedItem.UnstructuredContent(), "data", "key")
+			assert.Equal(t, tt.expected, value)
+		})
+	}
+}
+
+func TestReplacePatternAction_BreakerPerConfigMap(t *testing.T) {
+	plugin := &RestorePlugin{logger: logrus.New(), limits: limits{breakerThreshold: 2}}
+	restore := &velerov1.Restore{ObjectMeta: metav1.ObjectMeta{Name: "dr-1", UID: "uid-1"}}
+	starlark := func(name, script string) v1.ConfigMap {
+		return v1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Annotations: map[string]string{transformerAnnotation: transformerStarlark}},
+			Data:       map[string]string{starlarkScriptKey: script},
+		}
+	}
+	sets := ruleSetsFrom([]v1.ConfigMap{
+		starlark("broken", "def transform(item):\n    fail(\"boom\")\n"),
+		starlark("annotate", "def transform(item):\n    item[\"metadata\"][\"annotations\"] = {\"restored\": \"true\"}\n    return item\n"),
+	})
+
+	for i := 0; i < 5; i++ {
+		item := &unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": "v1",
+			"kind":       "ConfigMap",
+			"metadata":   map[string]interface{}{"name": "web", "namespace": "shop"},
+		}}
+		output, err := replacePatternAction(plugin, &velero.RestoreItemActionExecuteInput{Item: item, Restore: restore}, sets)
+		require.NoError(t, err)
+		annotations, _, _ := unstructured.NestedStringMap(output.UpdatedItem.UnstructuredContent(), "metadata", "annotations")
+		assert.Equal(t, "true", annotations["restored"], "the other starlark ConfigMap keeps running")
+	}
+	assert.False(t, plugin.stateFor(restore).breaker.Allow("starlark broken"))
+	assert.True(t, plugin.stateFor(restore).breaker.Allow("starlark annotate"))
+}
+
+func TestReplacePatternAction_TimeoutDropsHits(t *testing.T) {
+	plugin := &RestorePlugin{logger: logrus.New(), limits: limits{itemTimeout: 20 * time.Millisecond, timeoutPolicy: timeoutRestoreOriginal}}
+	restore := &velerov1.Restore{ObjectMeta: metav1.ObjectMeta{Name: "dr-1", UID: "uid-1"}}
+	sets := ruleSetsFrom([]v1.ConfigMap{
+		{ObjectMeta: metav1.ObjectMeta{Name: "names"}, Data: map[string]string{pattern2: replacement2}},
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "slow", Annotations: map[string]string{transformerAnnotation: transformerStarlark}},
+			Data:       map[string]string{starlarkScriptKey: "def transform(item):\n    for i in range(20000000):\n        pass\n    return item\n", "max-steps": "100000000"},
+		},
+	})
+	item := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "ConfigMap",
+		"metadata":   map[string]interface{}{"name": "web", "namespace": "shop"},
+		"data":       map[string]interface{}{"key": pattern2},
+	}}
+
+	output, err := replacePatternAction(plugin, &velero.RestoreItemActionExecuteInput{Item: item, Restore: restore}, sets)
+	require.NoError(t, err)
+	assert.Same(t, item, output.UpdatedItem)
+	summary := plugin.stateFor(restore).report.summary
+	assert.Equal(t, 1, summary.ItemsTimedOut)
+	assert.Zero(t, summary.Hits, "the hits of an item restored untouched are not counted")
+	assert.Empty(t, plugin.stateFor(restore).report.applied)
+}
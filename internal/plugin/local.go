@@ -0,0 +1,78 @@
+package plugin
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/sirupsen/logrus"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+)
+
+// RunLocal runs the transformer chain without any Kubernetes client: pattern
+// ConfigMaps are read from rules (a YAML or JSON stream of ConfigMaps) and
+// the items to transform are read from in as a stream of JSON objects. Each
+// transformed item is written to out as indented JSON.
+func RunLocal(rules io.Reader, in io.Reader, out io.Writer, logger logrus.FieldLogger) error {
+	configMaps, err := ReadConfigMaps(rules)
+	if err != nil {
+		return err
+	}
+
+	engine, err := NewEngine(configMaps, nil, nil, logger)
+	if err != nil {
+		return err
+	}
+
+	dec := json.NewDecoder(bufio.NewReader(in))
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "  ")
+	for {
+		var raw json.RawMessage
+		if err := dec.Decode(&raw); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("failed to read item: %v", err)
+		}
+		item := &unstructured.Unstructured{}
+		if err := item.UnmarshalJSON(raw); err != nil {
+			return fmt.Errorf("failed to decode item: %v", err)
+		}
+
+		output, _, err := engine.Transform(item)
+		if err != nil {
+			return err
+		}
+		if err := enc.Encode(output.Object); err != nil {
+			return fmt.Errorf("failed to write item: %v", err)
+		}
+	}
+}
+
+// ReadConfigMaps decodes every ConfigMap of a multi-document YAML or JSON
+// stream, ignoring other kinds.
+func ReadConfigMaps(r io.Reader) ([]v1.ConfigMap, error) {
+	var configMaps []v1.ConfigMap
+
+	dec := utilyaml.NewYAMLOrJSONDecoder(r, 4096)
+	for {
+		var configMap v1.ConfigMap
+		if err := dec.Decode(&configMap); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("failed to read rules: %v", err)
+		}
+		if configMap.Kind != "ConfigMap" {
+			continue
+		}
+		configMaps = append(configMaps, configMap)
+	}
+
+	if len(configMaps) == 0 {
+		return nil, fmt.Errorf("no ConfigMap found in rules")
+	}
+	return configMaps, nil
+}
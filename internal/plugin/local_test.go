@@ -0,0 +1,73 @@
+package plugin
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const localRules = `
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: replace-pattern-config
+data:
+  example.com: replaced.com
+---
+apiVersion: v1
+kind: Secret
+metadata:
+  name: ignored
+stringData:
+  foo: ignored
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: other-config
+data:
+  foo: bar
+`
+
+func TestRunLocal(t *testing.T) {
+	in := strings.NewReader(`
+{"apiVersion": "v1", "kind": "Service", "metadata": {"name": "foo", "namespace": "default"}, "spec": {"ports": [{"port": 80}]}}
+{"apiVersion": "v1", "kind": "ConfigMap", "metadata": {"name": "cfg"}, "data": {"url": "https://foo.example.com"}}
+`)
+	var out bytes.Buffer
+
+	err := RunLocal(strings.NewReader(localRules), in, &out, logrus.New())
+	require.NoError(t, err)
+
+	dec := json.NewDecoder(&out)
+	var items []map[string]interface{}
+	for {
+		var item map[string]interface{}
+		if err := dec.Decode(&item); err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		items = append(items, item)
+	}
+
+	require.Len(t, items, 2)
+	assert.Equal(t, "bar", items[0]["metadata"].(map[string]interface{})["name"])
+	assert.Equal(t, float64(80), items[0]["spec"].(map[string]interface{})["ports"].([]interface{})[0].(map[string]interface{})["port"])
+	assert.Equal(t, "https://bar.replaced.com", items[1]["data"].(map[string]interface{})["url"])
+}
+
+func TestRunLocal_Errors(t *testing.T) {
+	var out bytes.Buffer
+
+	err := RunLocal(strings.NewReader("kind: Secret\n"), strings.NewReader("{}"), &out, logrus.New())
+	assert.Error(t, err, "rules without ConfigMap")
+
+	err = RunLocal(strings.NewReader(localRules), strings.NewReader(`{"kind": `), &out, logrus.New())
+	assert.Error(t, err, "truncated item")
+}
@@ -0,0 +1,170 @@
+package plugin
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// lookupPrefix starts the replacements read from a live object of the target
+// cluster, such as lookup:configmap/velero/cluster-info:apiEndpoint, so that
+// the same rules inject the values of each destination cluster.
+const lookupPrefix = "lookup:"
+
+// valueLookup is a parsed lookup replacement.
+type valueLookup struct {
+	resource  string
+	namespace string
+	name      string
+	// field is a dot-separated path of the object; a single key names an entry
+	// of the data of ConfigMaps and Secrets
+	field []string
+}
+
+// lookupResult is a resolved lookup, kept for the rest of the restore.
+type lookupResult struct {
+	value string
+	err   error
+}
+
+// isLookup reports whether a replacement is a lookup.
+func isLookup(replacement string) bool {
+	return strings.HasPrefix(replacement, lookupPrefix)
+}
+
+// parseLookup parses a lookup replacement,
+// lookup:<resource>/[<namespace>/]<name>:<field>.
+func parseLookup(replacement string) (valueLookup, error) {
+	object, field, ok := strings.Cut(strings.TrimPrefix(replacement, lookupPrefix), ":")
+	if !ok || field == "" {
+		return valueLookup{}, fmt.Errorf("invalid lookup %q: expected %s<resource>/[<namespace>/]<name>:<field>", replacement, lookupPrefix)
+	}
+	var l valueLookup
+	parts := strings.Split(object, "/")
+	switch len(parts) {
+	case 2:
+		l.resource, l.name = parts[0], parts[1]
+	case 3:
+		l.resource, l.namespace, l.name = parts[0], parts[1], parts[2]
+	default:
+		return valueLookup{}, fmt.Errorf("invalid lookup %q: expected %s<resource>/[<namespace>/]<name>:<field>", replacement, lookupPrefix)
+	}
+	for _, part := range parts {
+		if part == "" {
+			return valueLookup{}, fmt.Errorf("invalid lookup %q: empty resource, namespace or name", replacement)
+		}
+	}
+	l.field = strings.Split(field, ".")
+	for _, segment := range l.field {
+		if segment == "" {
+			return valueLookup{}, fmt.Errorf("invalid lookup %q: invalid field %q", replacement, field)
+		}
+	}
+	return l, nil
+}
+
+// object names the object of the lookup, as namespace/name.
+func (l valueLookup) object() string {
+	if l.namespace == "" {
+		return l.name
+	}
+	return l.namespace + "/" + l.name
+}
+
+// fieldValue returns the value of the field of the lookup in object.
+func (l valueLookup) fieldValue(object *unstructured.Unstructured) (string, error) {
+	path := l.field
+	if len(path) == 1 {
+		if _, found := object.Object["data"]; found {
+			path = []string{"data", path[0]}
+		}
+	}
+	value, found, err := unstructured.NestedFieldNoCopy(object.Object, path...)
+	if err != nil || !found {
+		return "", fmt.Errorf("%s %s has no field %s", object.GetKind(), l.object(), strings.Join(l.field, "."))
+	}
+	switch value := value.(type) {
+	case string:
+		if object.GetKind() == "Secret" && path[0] == "data" {
+			decoded, err := base64.StdEncoding.DecodeString(value)
+			if err != nil {
+				return "", fmt.Errorf("failed to decode %s of Secret %s: %v", strings.Join(l.field, "."), l.object(), err)
+			}
+			return string(decoded), nil
+		}
+		return value, nil
+	case int64, float64, bool:
+		return fmt.Sprint(value), nil
+	default:
+		return "", fmt.Errorf("field %s of %s %s is not a string, a number or a boolean", strings.Join(l.field, "."), object.GetKind(), l.object())
+	}
+}
+
+// resolveLookup returns the value of a lookup replacement, read once per
+// restore, and whether it was read for this call.
+func (p *RestorePlugin) resolveLookup(replacement string, state *restoreState) (string, bool, error) {
+	state.lookupsMu.Lock()
+	defer state.lookupsMu.Unlock()
+	if result, ok := state.lookups[replacement]; ok {
+		return result.value, false, result.err
+	}
+	value, err := p.readLookup(replacement, state)
+	if state.lookups == nil {
+		state.lookups = make(map[string]lookupResult)
+	}
+	state.lookups[replacement] = lookupResult{value: value, err: err}
+	return value, true, err
+}
+
+// readLookup reads the value of a lookup replacement in the target cluster.
+func (p *RestorePlugin) readLookup(replacement string, state *restoreState) (string, error) {
+	l, err := parseLookup(replacement)
+	if err != nil {
+		return "", err
+	}
+	if p.liveGetter == nil {
+		return "", fmt.Errorf("the objects of the target cluster cannot be read")
+	}
+	gk, ok := p.resolver.resolve(l.resource)
+	if !ok {
+		return "", fmt.Errorf("unknown resource %q", l.resource)
+	}
+	object, err := p.getLive(state, gk.WithVersion(""), l.namespace, l.name)
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s %s: %v", l.resource, l.object(), err)
+	}
+	return l.fieldValue(object)
+}
+
+// resolveLookups returns the patterns of the set with their lookup
+// replacements resolved. The patterns whose lookup fails are left out, with
+// a warning the first time.
+func (p *RestorePlugin) resolveLookups(set ruleSet, patterns map[string]string, state *restoreState) map[string]string {
+	var resolved map[string]string
+	for pattern, replacement := range patterns {
+		if !isLookup(replacement) {
+			continue
+		}
+		if resolved == nil {
+			resolved = make(map[string]string, len(patterns))
+			for pattern, replacement := range patterns {
+				resolved[pattern] = replacement
+			}
+		}
+		value, first, err := p.resolveLookup(replacement, state)
+		if err != nil {
+			if first {
+				p.logger.Warnf("Ignoring pattern %q of ConfigMap %s: %v", pattern, set.name, err)
+			}
+			delete(resolved, pattern)
+			continue
+		}
+		resolved[pattern] = value
+	}
+	if resolved == nil {
+		return patterns
+	}
+	return resolved
+}
@@ -0,0 +1,135 @@
+package plugin
+
+import (
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	velerov1 "github.com/vmware-tanzu/velero/pkg/apis/velero/v1"
+	"github.com/vmware-tanzu/velero/pkg/plugin/velero"
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// countingLiveGetter serves objects by namespace/name and counts the reads.
+type countingLiveGetter struct {
+	objects map[string]*unstructured.Unstructured
+	reads   int
+}
+
+func (g *countingLiveGetter) getLive(gvk schema.GroupVersionKind, namespace, name string) (*unstructured.Unstructured, error) {
+	g.reads++
+	if object, ok := g.objects[namespace+"/"+name]; ok {
+		return object, nil
+	}
+	return nil, apierrors.NewNotFound(schema.GroupResource{Resource: gvk.Kind}, name)
+}
+
+func TestParseLookup(t *testing.T) {
+	l, err := parseLookup("lookup:configmap/velero/cluster-info:apiEndpoint")
+	require.NoError(t, err)
+	assert.Equal(t, valueLookup{resource: "configmap", namespace: "velero", name: "cluster-info", field: []string{"apiEndpoint"}}, l)
+
+	l, err = parseLookup("lookup:ingressclass/nginx:spec.controller")
+	require.NoError(t, err)
+	assert.Equal(t, valueLookup{resource: "ingressclass", name: "nginx", field: []string{"spec", "controller"}}, l)
+
+	for _, invalid := range []string{
+		"lookup:configmap/velero/cluster-info",
+		"lookup:configmap/velero/cluster-info:",
+		"lookup:cluster-info:apiEndpoint",
+		"lookup:configmap/a/b/c:key",
+		"lookup:configmap//cluster-info:key",
+		"lookup:configmap/velero/cluster-info:spec..host",
+	} {
+		_, err := parseLookup(invalid)
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestValueLookup_FieldValue(t *testing.T) {
+	configMap := &unstructured.Unstructured{Object: map[string]interface{}{
+		"kind": "ConfigMap",
+		"data": map[string]interface{}{"apiEndpoint": "https://dr.example.com:6443"},
+	}}
+	secret := &unstructured.Unstructured{Object: map[string]interface{}{
+		"kind": "Secret",
+		"data": map[string]interface{}{"token": "czNjcjN0"},
+	}}
+	route := &unstructured.Unstructured{Object: map[string]interface{}{
+		"kind": "Route",
+		"spec": map[string]interface{}{"host": "shop.apps.dr", "port": int64(8443), "tls": map[string]interface{}{}},
+	}}
+	value := func(object *unstructured.Unstructured, field string) (string, error) {
+		l, err := parseLookup("lookup:x/y:" + field)
+		require.NoError(t, err)
+		return l.fieldValue(object)
+	}
+
+	got, err := value(configMap, "apiEndpoint")
+	require.NoError(t, err)
+	assert.Equal(t, "https://dr.example.com:6443", got)
+	got, err = value(secret, "token")
+	require.NoError(t, err)
+	assert.Equal(t, "s3cr3t", got, "Secret data is decoded")
+	got, err = value(route, "spec.host")
+	require.NoError(t, err)
+	assert.Equal(t, "shop.apps.dr", got)
+	got, err = value(route, "spec.port")
+	require.NoError(t, err)
+	assert.Equal(t, "8443", got)
+
+	_, err = value(configMap, "missing")
+	assert.ErrorContains(t, err, "has no field missing")
+	_, err = value(route, "spec.tls")
+	assert.ErrorContains(t, err, "is not a string")
+}
+
+func TestReplacePatternAction_Lookups(t *testing.T) {
+	getter := &countingLiveGetter{objects: map[string]*unstructured.Unstructured{
+		"velero/cluster-info": {Object: map[string]interface{}{
+			"apiVersion": "v1",
+			"kind":       "ConfigMap",
+			"metadata":   map[string]interface{}{"name": "cluster-info", "namespace": "velero"},
+			"data":       map[string]interface{}{"apiEndpoint": "https://dr.example.com:6443"},
+		}},
+	}}
+	plugin := &RestorePlugin{logger: logrus.New(), liveGetter: getter, resolver: newResourceResolver(nil, logrus.New())}
+	restore := &velerov1.Restore{ObjectMeta: metav1.ObjectMeta{Name: "dr-1", UID: "uid-1"}}
+	sets := ruleSetsFrom([]v1.ConfigMap{{
+		ObjectMeta: metav1.ObjectMeta{Name: "endpoints"},
+		Data: map[string]string{
+			"https://prod.example.com:6443": "lookup:configmap/velero/cluster-info:apiEndpoint",
+			"prod-region":                   "lookup:configmap/velero/cluster-info:region",
+			"prod.example.com":              "dr.example.com",
+		},
+	}})
+	item := func() *unstructured.Unstructured {
+		return &unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": "v1",
+			"kind":       "ConfigMap",
+			"metadata":   map[string]interface{}{"name": "app", "namespace": "shop"},
+			"data": map[string]interface{}{
+				"server": "https://prod.example.com:6443",
+				"region": "prod-region",
+				"host":   "prod.example.com",
+			},
+		}}
+	}
+
+	for i := 0; i < 2; i++ {
+		output, err := replacePatternAction(plugin, &velero.RestoreItemActionExecuteInput{Item: item(), Restore: restore}, sets)
+		require.NoError(t, err)
+		data, _, _ := unstructured.NestedStringMap(output.UpdatedItem.UnstructuredContent(), "data")
+		assert.Equal(t, map[string]string{
+			"server": "https://dr.example.com:6443",
+			"region": "prod-region",
+			"host":   "dr.example.com",
+		}, data, "the pattern whose lookup fails is left out")
+	}
+	assert.Equal(t, 2, getter.reads, "each lookup is read once per restore")
+}
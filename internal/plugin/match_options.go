@@ -0,0 +1,78 @@
+package plugin
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/wrkt/velero-custom-plugins/internal/lru"
+	"github.com/wrkt/velero-custom-plugins/internal/transform"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	// matchOptionsAnnotation changes how patterns of a ConfigMap match: a YAML
+	// map of pattern to a comma separated list of options.
+	matchOptionsAnnotation = "agoracalyce.io/match-options"
+
+	matchIgnoreCase = "ignore-case"
+	matchWholeWord  = "whole-word"
+)
+
+// matchOptions caches the parsed match options by annotation, as conditions
+// does.
+var matchOptions = lru.New[string, parsedMatchOptions](cacheSize)
+
+// parsedMatchOptions are the options of each pattern, or the error parsing
+// them.
+type parsedMatchOptions struct {
+	options map[string]transform.MatchOptions
+	err     error
+}
+
+// parseMatchOptions parses the match options of the set once. Only literal
+// patterns take options.
+func (s ruleSet) parseMatchOptions() (map[string]transform.MatchOptions, error) {
+	if s.matchOptions == "" {
+		return nil, nil
+	}
+	if !s.isLiteral() {
+		return nil, fmt.Errorf("%s only applies to literal patterns", matchOptionsAnnotation)
+	}
+	if cached, ok := matchOptions.Get(s.matchOptions); ok {
+		return cached.options, cached.err
+	}
+	options, err := newMatchOptions(s.matchOptions)
+	matchOptions.Add(s.matchOptions, parsedMatchOptions{options: options, err: err})
+	return options, err
+}
+
+func newMatchOptions(annotation string) (map[string]transform.MatchOptions, error) {
+	var entries map[string]string
+	if err := yaml.Unmarshal([]byte(annotation), &entries); err != nil {
+		return nil, fmt.Errorf("invalid %s: %v", matchOptionsAnnotation, err)
+	}
+	options := make(map[string]transform.MatchOptions, len(entries))
+	for pattern, list := range entries {
+		var o transform.MatchOptions
+		for _, option := range strings.Split(list, ",") {
+			switch strings.TrimSpace(option) {
+			case matchIgnoreCase:
+				o.IgnoreCase = true
+			case matchWholeWord:
+				o.WholeWord = true
+			case "":
+			default:
+				return nil, fmt.Errorf("invalid %s: unknown option %q for %q, must be %s or %s", matchOptionsAnnotation, strings.TrimSpace(option), pattern, matchIgnoreCase, matchWholeWord)
+			}
+		}
+		options[pattern] = o
+	}
+	return options, nil
+}
+
+// hasMatchOptions reports whether a pattern of the set matches other than
+// exactly.
+func (s ruleSet) hasMatchOptions(pattern string) bool {
+	options, _ := s.parseMatchOptions()
+	return options[pattern] != (transform.MatchOptions{})
+}
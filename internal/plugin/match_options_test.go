@@ -0,0 +1,75 @@
+package plugin
+
+import (
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	velerov1 "github.com/vmware-tanzu/velero/pkg/apis/velero/v1"
+	"github.com/vmware-tanzu/velero/pkg/plugin/velero"
+	"github.com/wrkt/velero-custom-plugins/internal/transform"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestParseMatchOptions(t *testing.T) {
+	set := ruleSet{
+		patterns: map[string]string{"prod": "dr", "db": "pg", "DB": "PG"},
+		matchOptions: `
+prod: ignore-case
+db: "whole-word, ignore-case"
+`,
+	}
+	options, err := set.parseMatchOptions()
+	require.NoError(t, err)
+	assert.Equal(t, map[string]transform.MatchOptions{
+		"prod": {IgnoreCase: true},
+		"db":   {IgnoreCase: true, WholeWord: true},
+	}, options)
+	assert.True(t, set.hasMatchOptions("db"))
+	assert.False(t, set.hasMatchOptions("DB"))
+
+	for _, invalid := range []ruleSet{
+		{patterns: map[string]string{"a": "b"}, matchOptions: "a: [ignore-case]"},
+		{patterns: map[string]string{"a": "b"}, matchOptions: "a: case-insensitive"},
+		{transformer: transformerRegex, config: map[string]string{}, matchOptions: "a: ignore-case"},
+	} {
+		_, err := invalid.parseMatchOptions()
+		assert.Error(t, err, invalid.matchOptions)
+	}
+}
+
+func TestReplacePatternAction_MatchOptions(t *testing.T) {
+	t.Setenv(stampOriginEnv, "false")
+	plugin := &RestorePlugin{logger: logrus.New()}
+	sets := ruleSetsFrom([]v1.ConfigMap{{
+		ObjectMeta: metav1.ObjectMeta{Name: "hosts", Annotations: map[string]string{
+			matchOptionsAnnotation: "prod: ignore-case\ndb: whole-word",
+		}},
+		Data: map[string]string{"prod": "dr", "db": "pg", "example.com": "example.org"},
+	}})
+	restore := &velerov1.Restore{ObjectMeta: metav1.ObjectMeta{Name: "dr-1", UID: "uid-1"}}
+	item := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "ConfigMap",
+		"metadata":   map[string]interface{}{"name": "settings", "namespace": "shop", "labels": map[string]interface{}{"PROD.example.com/db": "true"}},
+		"data":       map[string]interface{}{"host": "api.PROD.example.com", "database": "db.prod.svc", "user": "admin-db-ro", "schema": "mydb"},
+	}}
+
+	output, err := replacePatternAction(plugin, &velero.RestoreItemActionExecuteInput{Item: item, Restore: restore}, sets)
+	require.NoError(t, err)
+	result := output.UpdatedItem.(*unstructured.Unstructured)
+	assert.Equal(t, map[string]interface{}{"host": "api.dr.example.org", "database": "pg.dr.svc", "user": "admin-pg-ro", "schema": "mydb"}, result.Object["data"])
+	assert.Equal(t, map[string]string{"dr.example.org/pg": "true"}, result.GetLabels())
+	assert.Equal(t, map[string]string{"example.com": "example.org"}, plugin.stateFor(restore).report.applied, "patterns with options are not inverted")
+
+	invalid := ruleSetsFrom([]v1.ConfigMap{{
+		ObjectMeta: metav1.ObjectMeta{Name: "hosts", Annotations: map[string]string{matchOptionsAnnotation: "prod: fuzzy"}},
+		Data:       map[string]string{"prod": "dr"},
+	}})
+	output, err = replacePatternAction(plugin, &velero.RestoreItemActionExecuteInput{Item: item, Restore: restore}, invalid)
+	require.NoError(t, err)
+	assert.Equal(t, "api.PROD.example.com", output.UpdatedItem.(*unstructured.Unstructured).Object["data"].(map[string]interface{})["host"], "invalid options ignore the ConfigMap")
+}
@@ -0,0 +1,192 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	velerov1 "github.com/vmware-tanzu/velero/pkg/apis/velero/v1"
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/client-go/util/retry"
+)
+
+const (
+	// migrationAnnotation on a Restore names the migration it is part of.
+	// Restores of the same migration share their rename registry and applied
+	// rules, so that later restores resolve references to the items renamed
+	// by earlier ones.
+	migrationAnnotation = "agoracalyce.io/migration-id"
+
+	// migrationLabel marks the ConfigMaps holding the state of a migration,
+	// its value is the migration ID
+	migrationLabel = "agoracalyce.io/replace-pattern-migration"
+
+	migrationRenamesKey  = "renames.json"
+	migrationAppliedKey  = "applied.json"
+	migrationRestoresKey = "restores.json"
+)
+
+// migrationState is what the restores of a migration share.
+type migrationState struct {
+	Renames  []rename
+	Applied  map[string]string
+	Restores []string
+}
+
+// migrationID returns the migration a restore is part of, if any.
+func (p *RestorePlugin) migrationID(restore *velerov1.Restore) string {
+	id := strings.TrimSpace(restore.Annotations[migrationAnnotation])
+	if id == "" {
+		return ""
+	}
+	if errs := validation.IsDNS1123Label(id); len(errs) > 0 {
+		p.logger.Warnf("Ignoring invalid %s=%q on restore %s: %s", migrationAnnotation, id, restore.Name, strings.Join(errs, ", "))
+		return ""
+	}
+	return id
+}
+
+// migrationConfigMapName is the name of the ConfigMap holding the state of a
+// migration.
+func migrationConfigMapName(id string) string {
+	return fmt.Sprintf("replace-pattern-migration-%s", id)
+}
+
+// loadMigration seeds the report with the state left by the earlier restores
+// of its migration.
+func (p *RestorePlugin) loadMigration(r *restoreReport) error {
+	configMap, err := p.configMapClient.Get(context.TODO(), migrationConfigMapName(r.migration), metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get the state of migration %s: %v", r.migration, err)
+	}
+	state, err := decodeMigration(configMap)
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.inherited = state.Renames
+	return nil
+}
+
+// flushMigration merges the renames and the applied rules of the report into
+// the state of its migration. Later renames of the same item win.
+func (p *RestorePlugin) flushMigration(r *restoreReport) error {
+	r.mu.Lock()
+	renames := append([]rename{}, r.renames...)
+	applied := make(map[string]string, len(r.applied))
+	for pattern, replacement := range r.applied {
+		applied[pattern] = replacement
+	}
+	r.mu.Unlock()
+
+	name := migrationConfigMapName(r.migration)
+	// restores of a migration may run in parallel
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		existing, err := p.configMapClient.Get(context.TODO(), name, metav1.GetOptions{})
+		found := err == nil
+		if apierrors.IsNotFound(err) {
+			existing = &v1.ConfigMap{ObjectMeta: metav1.ObjectMeta{
+				Name:   name,
+				Labels: map[string]string{migrationLabel: r.migration},
+			}}
+		} else if err != nil {
+			return fmt.Errorf("failed to get configmap %s: %v", name, err)
+		}
+		state, err := decodeMigration(existing)
+		if err != nil {
+			return err
+		}
+		state.merge(r.summary.Restore, renames, applied)
+		if existing.Data, err = state.data(); err != nil {
+			return fmt.Errorf("failed to render the state of migration %s: %v", r.migration, err)
+		}
+
+		if !found {
+			_, err = p.configMapClient.Create(context.TODO(), existing, metav1.CreateOptions{})
+		} else {
+			_, err = p.configMapClient.Update(context.TODO(), existing, metav1.UpdateOptions{})
+		}
+		if apierrors.IsConflict(err) || apierrors.IsAlreadyExists(err) {
+			return apierrors.NewConflict(v1.Resource("configmaps"), name, err)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to write configmap %s: %v", name, err)
+		}
+		return nil
+	})
+}
+
+func decodeMigration(configMap *v1.ConfigMap) (*migrationState, error) {
+	state := &migrationState{Applied: make(map[string]string)}
+	for key, target := range map[string]interface{}{
+		migrationRenamesKey:  &state.Renames,
+		migrationAppliedKey:  &state.Applied,
+		migrationRestoresKey: &state.Restores,
+	} {
+		if data, ok := configMap.Data[key]; ok {
+			if err := json.Unmarshal([]byte(data), target); err != nil {
+				return nil, fmt.Errorf("failed to decode %s of configmap %s: %v", key, configMap.Name, err)
+			}
+		}
+	}
+	return state, nil
+}
+
+// merge adds what a restore did to the state.
+func (s *migrationState) merge(restore string, renames []rename, applied map[string]string) {
+	for _, rn := range renames {
+		replaced := false
+		for i, existing := range s.Renames {
+			if existing.Group == rn.Group && existing.Kind == rn.Kind && existing.OldNamespace == rn.OldNamespace && existing.OldName == rn.OldName {
+				s.Renames[i], replaced = rn, true
+				break
+			}
+		}
+		if !replaced {
+			s.Renames = append(s.Renames, rn)
+		}
+	}
+	if s.Applied == nil {
+		s.Applied = make(map[string]string, len(applied))
+	}
+	for pattern, replacement := range applied {
+		s.Applied[pattern] = replacement
+	}
+	for _, name := range s.Restores {
+		if name == restore {
+			return
+		}
+	}
+	s.Restores = append(s.Restores, restore)
+	sort.Strings(s.Restores)
+}
+
+func (s *migrationState) data() (map[string]string, error) {
+	renames := s.Renames
+	if renames == nil {
+		renames = []rename{}
+	}
+	data := make(map[string]string, 3)
+	for key, value := range map[string]interface{}{
+		migrationRenamesKey:  renames,
+		migrationAppliedKey:  s.Applied,
+		migrationRestoresKey: s.Restores,
+	} {
+		encoded, err := json.Marshal(value)
+		if err != nil {
+			return nil, err
+		}
+		data[key] = string(encoded)
+	}
+	return data, nil
+}
@@ -0,0 +1,84 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	velerov1 "github.com/vmware-tanzu/velero/pkg/apis/velero/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestMigration(t *testing.T) {
+	configMaps := fake.NewSimpleClientset().CoreV1().ConfigMaps("velero")
+	plugin := &RestorePlugin{logger: logrus.New(), configMapClient: configMaps}
+	migrationRestore := func(name string) *velerov1.Restore {
+		return &velerov1.Restore{ObjectMeta: metav1.ObjectMeta{
+			Name:        name,
+			UID:         types.UID("uid-" + name),
+			Annotations: map[string]string{migrationAnnotation: "shop-to-dr"},
+		}}
+	}
+
+	// the first restore moves a shared Gateway
+	first := plugin.stateFor(migrationRestore("dr-cluster")).report
+	first.recordApplied("example.com", "dr.example.com")
+	first.recordRename(
+		item("gateway.networking.k8s.io", "Gateway", "infra", "public"),
+		item("gateway.networking.k8s.io", "Gateway", "infra-dr", "public"),
+	)
+	require.NoError(t, plugin.flushReport(first))
+
+	// a later restore of the migration sees it, another one does not
+	plugin.states = nil
+	second := plugin.stateFor(migrationRestore("dr-shop")).report
+	namespace, name, ok := second.renamed("gateway.networking.k8s.io", "Gateway", "infra", "public")
+	assert.True(t, ok)
+	assert.Equal(t, []string{"infra-dr", "public"}, []string{namespace, name})
+	other := plugin.stateFor(&velerov1.Restore{ObjectMeta: metav1.ObjectMeta{Name: "unrelated", UID: "uid-unrelated"}}).report
+	_, _, ok = other.renamed("gateway.networking.k8s.io", "Gateway", "infra", "public")
+	assert.False(t, ok)
+
+	// its own renames are merged in, later ones winning
+	second.recordApplied("registry.prod", "registry.dr")
+	second.recordRename(
+		item("gateway.networking.k8s.io", "Gateway", "infra", "public"),
+		item("gateway.networking.k8s.io", "Gateway", "edge", "public"),
+	)
+	require.NoError(t, plugin.flushReport(second))
+
+	configMap, err := configMaps.Get(context.Background(), "replace-pattern-migration-shop-to-dr", metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, "shop-to-dr", configMap.Labels[migrationLabel])
+	var renames []rename
+	require.NoError(t, json.Unmarshal([]byte(configMap.Data[migrationRenamesKey]), &renames))
+	assert.Equal(t, []rename{{
+		Group: "gateway.networking.k8s.io", Kind: "Gateway",
+		OldNamespace: "infra", OldName: "public", NewNamespace: "edge", NewName: "public",
+	}}, renames)
+	assert.JSONEq(t, `{"example.com":"dr.example.com","registry.prod":"registry.dr"}`, configMap.Data[migrationAppliedKey])
+	assert.JSONEq(t, `["dr-cluster","dr-shop"]`, configMap.Data[migrationRestoresKey])
+}
+
+func TestMigrationID(t *testing.T) {
+	plugin := &RestorePlugin{logger: logrus.New()}
+	restore := &velerov1.Restore{ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{migrationAnnotation: " shop "}}}
+	assert.Equal(t, "shop", plugin.migrationID(restore))
+	restore.Annotations[migrationAnnotation] = "Shop/DR"
+	assert.Empty(t, plugin.migrationID(restore))
+}
+
+func item(group, kind, namespace, name string) *unstructured.Unstructured {
+	u := &unstructured.Unstructured{}
+	u.SetAPIVersion(group + "/v1")
+	u.SetKind(kind)
+	u.SetNamespace(namespace)
+	u.SetName(name)
+	return u
+}
@@ -0,0 +1,67 @@
+package plugin
+
+import (
+	"context"
+	"fmt"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	corev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+)
+
+// nodePortLister lists the node ports in use in the target cluster, with the
+// namespace/name of the Service holding each.
+type nodePortLister interface {
+	nodePortsInUse() (map[int64]string, error)
+}
+
+// clientNodePortLister lists the Services of the target cluster.
+type clientNodePortLister struct {
+	services corev1.ServicesGetter
+}
+
+func (l *clientNodePortLister) nodePortsInUse() (map[int64]string, error) {
+	services, err := l.services.Services("").List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list services: %v", err)
+	}
+	used := make(map[int64]string)
+	for _, service := range services.Items {
+		for _, port := range service.Spec.Ports {
+			if port.NodePort != 0 {
+				used[int64(port.NodePort)] = service.Namespace + "/" + service.Name
+			}
+		}
+	}
+	return used, nil
+}
+
+// nodePortClaimer returns the Claim function of the node-ports transformer for
+// a restore: the ports in use in the target cluster are listed once, and the
+// ports kept by the restored Services are added to them once effects apply, so
+// that an item abandoned by the watchdog or failing holds no port.
+func (p *RestorePlugin) nodePortClaimer(state *restoreState, effects *deferred) func(port int64, owner string) (string, error) {
+	return func(port int64, owner string) (string, error) {
+		state.nodePortsMu.Lock()
+		defer state.nodePortsMu.Unlock()
+		if state.nodePorts == nil {
+			state.nodePorts = make(map[int64]string)
+			if p.nodePortLister != nil {
+				used, err := p.nodePortLister.nodePortsInUse()
+				if err != nil {
+					state.nodePorts = nil
+					return "", err
+				}
+				state.nodePorts = used
+			}
+		}
+		if holder, ok := state.nodePorts[port]; ok && holder != owner {
+			return holder, nil
+		}
+		effects.add(func() {
+			state.nodePortsMu.Lock()
+			defer state.nodePortsMu.Unlock()
+			state.nodePorts[port] = owner
+		})
+		return "", nil
+	}
+}
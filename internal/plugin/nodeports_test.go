@@ -0,0 +1,95 @@
+package plugin
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vmware-tanzu/velero/pkg/plugin/velero"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+type stubNodePortLister struct {
+	used  map[int64]string
+	err   error
+	calls int
+}
+
+func (s *stubNodePortLister) nodePortsInUse() (map[int64]string, error) {
+	s.calls++
+	if s.err != nil {
+		return nil, s.err
+	}
+	used := make(map[int64]string, len(s.used))
+	for port, owner := range s.used {
+		used[port] = owner
+	}
+	return used, nil
+}
+
+func TestNodePortClaimer(t *testing.T) {
+	lister := &stubNodePortLister{used: map[int64]string{30000: "apps/db"}}
+	plugin := &RestorePlugin{logger: logrus.New(), nodePortLister: lister}
+	state := &restoreState{}
+	effects := &deferred{}
+	claim := plugin.nodePortClaimer(state, effects)
+
+	holder, err := claim(30000, "apps/web")
+	require.NoError(t, err)
+	assert.Equal(t, "apps/db", holder)
+	holder, err = claim(30000, "apps/db")
+	require.NoError(t, err)
+	assert.Empty(t, holder)
+
+	// ports kept by restored Services are taken for the next ones once applied
+	holder, err = claim(30001, "apps/web")
+	require.NoError(t, err)
+	assert.Empty(t, holder)
+	effects.apply()
+	holder, err = plugin.nodePortClaimer(state, &deferred{})(30001, "apps/api")
+	require.NoError(t, err)
+	assert.Equal(t, "apps/web", holder)
+	assert.Equal(t, 1, lister.calls)
+
+	// the ports of a discarded item stay free
+	discarded := &deferred{}
+	holder, err = plugin.nodePortClaimer(state, discarded)(30002, "apps/web")
+	require.NoError(t, err)
+	assert.Empty(t, holder)
+	discarded.discard()
+	holder, err = plugin.nodePortClaimer(state, &deferred{})(30002, "apps/api")
+	require.NoError(t, err)
+	assert.Empty(t, holder)
+
+	failing := &RestorePlugin{logger: logrus.New(), nodePortLister: &stubNodePortLister{err: errors.New("forbidden")}}
+	_, err = failing.nodePortClaimer(&restoreState{}, &deferred{})(30000, "apps/web")
+	assert.Error(t, err)
+}
+
+func TestReplacePatternAction_NodePorts(t *testing.T) {
+	t.Setenv(stampOriginEnv, "false")
+	plugin := &RestorePlugin{logger: logrus.New(), nodePortLister: &stubNodePortLister{used: map[int64]string{30080: "other/web"}}}
+	sets := ruleSetsFrom([]v1.ConfigMap{{
+		ObjectMeta: metav1.ObjectMeta{Name: "node-ports", Annotations: map[string]string{transformerAnnotation: transformerPorts}},
+	}})
+
+	service := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "Service",
+		"metadata":   map[string]interface{}{"name": "web", "namespace": "apps"},
+		"spec": map[string]interface{}{"type": "NodePort", "ports": []interface{}{
+			map[string]interface{}{"port": int64(80), "nodePort": int64(30080)},
+			map[string]interface{}{"port": int64(443), "nodePort": int64(30443)},
+		}},
+	}}
+	output, err := replacePatternAction(plugin, &velero.RestoreItemActionExecuteInput{Item: service}, sets)
+	require.NoError(t, err)
+	assert.Equal(t, []interface{}{
+		map[string]interface{}{"port": int64(80)},
+		map[string]interface{}{"port": int64(443), "nodePort": int64(30443)},
+	}, output.UpdatedItem.(*unstructured.Unstructured).Object["spec"].(map[string]interface{})["ports"])
+}
@@ -0,0 +1,63 @@
+package plugin
+
+import (
+	"strconv"
+
+	"github.com/vmware-tanzu/velero/pkg/plugin/velero"
+	"github.com/wrkt/velero-custom-plugins/internal/transform"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+const (
+	// sourceClusterAnnotation on a Restore names the cluster the backup was
+	// taken from.
+	sourceClusterAnnotation = "agoracalyce.io/source-cluster"
+	// sourceClusterEnv is the fallback source cluster name.
+	sourceClusterEnv = "REPLACE_PATTERN_SOURCE_CLUSTER"
+	// stampOriginEnv disables the original identity annotations when false.
+	stampOriginEnv = "REPLACE_PATTERN_STAMP_ORIGIN"
+)
+
+// stampOrigin returns whether stampOriginEnv leaves the original identity
+// annotations enabled.
+func stampOrigin(lookup lookupFunc) bool {
+	if value, ok := lookup(stampOriginEnv); ok {
+		if enabled, err := strconv.ParseBool(value); err == nil && !enabled {
+			return false
+		}
+	}
+	return true
+}
+
+// originTransformer returns the transformer stamping the identity the item had
+// in the backup, or nil when stamping is disabled.
+func originTransformer(input *velero.RestoreItemActionExecuteInput, clusterScoped bool, lookup lookupFunc) transform.Transformer {
+	if !stampOrigin(lookup) {
+		return nil
+	}
+
+	item := originalItem(input)
+	cluster, _ := lookup(sourceClusterEnv)
+	origin := &transform.Origin{
+		OriginalName:    item.GetName(),
+		OriginalCluster: cluster,
+	}
+	if !clusterScoped {
+		origin.OriginalNamespace = item.GetNamespace()
+	}
+	if input.Restore != nil {
+		if cluster := input.Restore.Annotations[sourceClusterAnnotation]; cluster != "" {
+			origin.OriginalCluster = cluster
+		}
+	}
+	return origin
+}
+
+// originalItem returns the item as it was in the backup.
+func originalItem(input *velero.RestoreItemActionExecuteInput) *unstructured.Unstructured {
+	original := input.ItemFromBackup
+	if original == nil {
+		original = input.Item
+	}
+	return &unstructured.Unstructured{Object: original.UnstructuredContent()}
+}
@@ -0,0 +1,46 @@
+package plugin
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	velerov1 "github.com/vmware-tanzu/velero/pkg/apis/velero/v1"
+	"github.com/vmware-tanzu/velero/pkg/plugin/velero"
+	"github.com/wrkt/velero-custom-plugins/internal/transform"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestOriginTransformer(t *testing.T) {
+	fromBackup := &unstructured.Unstructured{}
+	fromBackup.SetName("foo-production")
+	fromBackup.SetNamespace("production")
+	// Velero already applied the restore namespace mapping to Item
+	item := fromBackup.DeepCopy()
+	item.SetNamespace("review-3")
+
+	input := &velero.RestoreItemActionExecuteInput{
+		Item:           item,
+		ItemFromBackup: fromBackup,
+		Restore: &velerov1.Restore{ObjectMeta: metav1.ObjectMeta{
+			Annotations: map[string]string{sourceClusterAnnotation: "prod-eu"},
+		}},
+	}
+
+	t.Setenv(sourceClusterEnv, "ignored")
+	origin := originTransformer(input, false, os.LookupEnv)
+	assert.Equal(t, &transform.Origin{
+		OriginalName:      "foo-production",
+		OriginalNamespace: "production",
+		OriginalCluster:   "prod-eu",
+	}, origin)
+
+	// cluster-scoped, cluster from the environment, no pristine item
+	origin = originTransformer(&velero.RestoreItemActionExecuteInput{Item: item}, true, os.LookupEnv)
+	assert.Equal(t, &transform.Origin{OriginalName: "foo-production", OriginalCluster: "ignored"}, origin)
+
+	t.Setenv(stampOriginEnv, "false")
+	require.Nil(t, originTransformer(input, false, os.LookupEnv))
+}
@@ -0,0 +1,115 @@
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	authorizationv1client "k8s.io/client-go/kubernetes/typed/authorization/v1"
+)
+
+// Optional features, disabled at startup when the service account of Velero
+// misses a permission they need, instead of failing on every item.
+const (
+	featureReports      = "summary report, inverse rule set and migration state"
+	featureNodePorts    = "node port conflicts with the Services of the target cluster"
+	featureNodes        = "topology-spread and extended-resources ConfigMaps"
+	featureCRDs         = "restores of custom resources in versions the cluster does not serve"
+	featureVersionCheck = "Velero version check"
+	featureWorkloadPods = "image digests of workloads"
+)
+
+// permission is an API access a feature needs.
+type permission struct {
+	feature    string
+	attributes authorizationv1.ResourceAttributes
+}
+
+// restorePermissions are the permissions of the optional features of the
+// restore plugin.
+var restorePermissions = []permission{
+	{featureReports, authorizationv1.ResourceAttributes{Namespace: "velero", Verb: "create", Resource: "configmaps"}},
+	{featureReports, authorizationv1.ResourceAttributes{Namespace: "velero", Verb: "update", Resource: "configmaps"}},
+	{featureNodePorts, authorizationv1.ResourceAttributes{Verb: "list", Resource: "services"}},
+	{featureNodes, authorizationv1.ResourceAttributes{Verb: "list", Resource: "nodes"}},
+	{featureCRDs, authorizationv1.ResourceAttributes{Verb: "get", Group: "apiextensions.k8s.io", Resource: "customresourcedefinitions"}},
+	{featureVersionCheck, authorizationv1.ResourceAttributes{Namespace: "velero", Verb: "get", Group: "apps", Resource: "deployments", Name: veleroDeploymentName}},
+}
+
+// imageDigestsPermissions are the permissions of the optional features of the
+// image digests plugin.
+var imageDigestsPermissions = []permission{
+	{featureWorkloadPods, authorizationv1.ResourceAttributes{Verb: "list", Resource: "pods"}},
+}
+
+// String describes the permission as kubectl auth can-i would ask for it.
+func (p permission) String() string {
+	resource := p.attributes.Resource
+	if p.attributes.Group != "" {
+		resource += "." + p.attributes.Group
+	}
+	if p.attributes.Name != "" {
+		resource += "/" + p.attributes.Name
+	}
+	scope := "in all namespaces"
+	if p.attributes.Namespace != "" {
+		scope = "in " + p.attributes.Namespace
+	}
+	return fmt.Sprintf("%s %s %s", p.attributes.Verb, resource, scope)
+}
+
+// disabledFeatures reviews permissions with SelfSubjectAccessReviews and
+// returns the features missing one, logged in a single line. Features whose
+// review fails are left enabled. In read-only mode, nothing is reviewed:
+// SelfSubjectAccessReviews are creates.
+func disabledFeatures(reviews authorizationv1client.SelfSubjectAccessReviewInterface, permissions []permission, readOnly bool, logger logrus.FieldLogger) map[string]bool {
+	disabled := make(map[string]bool)
+	if readOnly {
+		return disabled
+	}
+	var features []string
+	missing := make(map[string][]string)
+	for _, permission := range permissions {
+		attributes := permission.attributes
+		review, err := reviews.Create(context.TODO(), &authorizationv1.SelfSubjectAccessReview{
+			Spec: authorizationv1.SelfSubjectAccessReviewSpec{ResourceAttributes: &attributes},
+		}, metav1.CreateOptions{})
+		if err != nil {
+			logger.Warnf("Failed to review permission to %s, assuming it is granted: %v", permission, err)
+			continue
+		}
+		if review.Status.Allowed {
+			continue
+		}
+		if !disabled[permission.feature] {
+			disabled[permission.feature] = true
+			features = append(features, permission.feature)
+		}
+		missing[permission.feature] = append(missing[permission.feature], permission.String())
+	}
+
+	if len(features) > 0 {
+		parts := make([]string, 0, len(features))
+		for _, feature := range features {
+			parts = append(parts, fmt.Sprintf("%s (%s)", feature, strings.Join(missing[feature], ", ")))
+		}
+		logger.Warnf("Disabled for missing permissions: %s", strings.Join(parts, "; "))
+	}
+	return disabled
+}
+
+// transformerFeatures are the features the transformers depend on.
+var transformerFeatures = map[string]string{
+	transformerTopology: featureNodes,
+	transformerDevices:  featureNodes,
+}
+
+// isDisabled reports whether set configures a transformer whose feature is
+// disabled.
+func (p *RestorePlugin) isDisabled(set ruleSet) bool {
+	feature, ok := transformerFeatures[set.transformer]
+	return ok && p.disabled[feature]
+}
@@ -0,0 +1,110 @@
+package plugin
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	logtest "github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vmware-tanzu/velero/pkg/plugin/velero"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// reviewer returns a clientset granting every permission but the denied
+// resources, and failing to review the broken ones.
+func reviewer(denied, broken map[string]bool) *fake.Clientset {
+	clientset := fake.NewSimpleClientset()
+	clientset.PrependReactor("create", "selfsubjectaccessreviews", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		review := action.(k8stesting.CreateAction).GetObject().(*authorizationv1.SelfSubjectAccessReview)
+		resource := review.Spec.ResourceAttributes.Verb + " " + review.Spec.ResourceAttributes.Resource
+		if broken[resource] {
+			return true, nil, errors.New("the server is currently unable to handle the request")
+		}
+		review.Status.Allowed = !denied[resource]
+		return true, review, nil
+	})
+	return clientset
+}
+
+func TestDisabledFeatures(t *testing.T) {
+	logger, hook := logtest.NewNullLogger()
+	clientset := reviewer(map[string]bool{"create configmaps": true, "update configmaps": true, "list nodes": true}, map[string]bool{"list services": true})
+
+	disabled := disabledFeatures(clientset.AuthorizationV1().SelfSubjectAccessReviews(), restorePermissions, false, logger)
+	assert.Equal(t, map[string]bool{featureReports: true, featureNodes: true}, disabled)
+
+	assert.Equal(t, []string{
+		"Failed to review permission to list services in all namespaces, assuming it is granted: the server is currently unable to handle the request",
+		"Disabled for missing permissions: summary report, inverse rule set and migration state (create configmaps in velero, update configmaps in velero); topology-spread and extended-resources ConfigMaps (list nodes in all namespaces)",
+	}, warnings(hook))
+
+	hook.Reset()
+	assert.Empty(t, disabledFeatures(reviewer(nil, nil).AuthorizationV1().SelfSubjectAccessReviews(), restorePermissions, false, logger))
+	assert.Empty(t, hook.AllEntries())
+
+	// read-only mode creates nothing, reviews included
+	clientset.ClearActions()
+	assert.Empty(t, disabledFeatures(clientset.AuthorizationV1().SelfSubjectAccessReviews(), restorePermissions, true, logger))
+	assert.Empty(t, clientset.Actions(), "no SelfSubjectAccessReview is created")
+}
+
+func TestReplacePatternAction_DisabledFeatures(t *testing.T) {
+	t.Setenv(stampOriginEnv, "false")
+	lister := &stubNodeLister{nodes: []v1.Node{targetNode(map[string]string{"kubernetes.io/hostname": "a"}, nil)}}
+	plugin := &RestorePlugin{logger: logrus.New(), nodeLister: lister, disabled: map[string]bool{featureNodes: true}}
+	sets := ruleSetsFrom([]v1.ConfigMap{{
+		ObjectMeta: metav1.ObjectMeta{Name: "spread", Annotations: map[string]string{transformerAnnotation: transformerTopology}},
+	}})
+	deployment := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "apps/v1",
+		"kind":       "Deployment",
+		"metadata":   map[string]interface{}{"name": "web", "namespace": "shop"},
+		"spec": map[string]interface{}{"template": map[string]interface{}{"spec": map[string]interface{}{
+			"containers": []interface{}{map[string]interface{}{"name": "web"}},
+		}}},
+	}}
+	_, err := replacePatternAction(plugin, &velero.RestoreItemActionExecuteInput{Item: deployment}, sets)
+	require.NoError(t, err)
+	assert.Zero(t, lister.calls)
+
+	plugin.disabled = nil
+	_, err = replacePatternAction(plugin, &velero.RestoreItemActionExecuteInput{Item: deployment}, sets)
+	require.NoError(t, err)
+	assert.Equal(t, 1, lister.calls)
+}
+
+func warnings(hook *logtest.Hook) []string {
+	var messages []string
+	for _, entry := range hook.AllEntries() {
+		if entry.Level <= logrus.WarnLevel {
+			messages = append(messages, entry.Message)
+		}
+	}
+	return messages
+}
+
+func TestImageDigestsPlugin_WithoutPods(t *testing.T) {
+	plugin := &ImageDigestsPlugin{logger: logrus.New()}
+	deployment := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "apps/v1",
+		"kind":       "Deployment",
+		"metadata":   map[string]interface{}{"name": "web", "namespace": "shop"},
+		"spec": map[string]interface{}{
+			"selector": map[string]interface{}{"matchLabels": map[string]interface{}{"app": "web"}},
+			"template": map[string]interface{}{"spec": map[string]interface{}{"containers": []interface{}{
+				map[string]interface{}{"name": "web", "image": "web:latest"},
+			}}},
+		},
+	}}
+	out, _, err := plugin.Execute(deployment, nil)
+	require.NoError(t, err)
+	assert.Same(t, deployment, out)
+}
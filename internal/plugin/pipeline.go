@@ -0,0 +1,55 @@
+package plugin
+
+import (
+	"strings"
+
+	velerov1 "github.com/vmware-tanzu/velero/pkg/apis/velero/v1"
+)
+
+const (
+	// stageAnnotation assigns a rule ConfigMap to a named stage of the
+	// pipeline.
+	stageAnnotation = "agoracalyce.io/stage"
+	// pipelineAnnotation on a Restore lists the stages it applies, comma
+	// separated, in order.
+	pipelineAnnotation = "agoracalyce.io/pipeline"
+	// pipelineEnv is the pipeline of the Restores without pipelineAnnotation.
+	pipelineEnv = "REPLACE_PATTERN_PIPELINE"
+)
+
+// pipeline returns the stages the Restore applies, in order, from its
+// annotation or else from REPLACE_PATTERN_PIPELINE. A stage listed twice
+// applies at its first place.
+func (p *RestorePlugin) pipeline(restore *velerov1.Restore) []string {
+	list, ok := "", false
+	if restore != nil {
+		list, ok = restore.Annotations[pipelineAnnotation]
+	}
+	if !ok {
+		list, _ = p.setting(pipelineEnv)
+	}
+	var stages []string
+	seen := make(map[string]bool)
+	for _, stage := range strings.Split(list, ",") {
+		if stage = strings.TrimSpace(stage); stage != "" && !seen[stage] {
+			seen[stage] = true
+			stages = append(stages, stage)
+		}
+	}
+	return stages
+}
+
+// stageRank returns when the set applies in pipeline: 0 for the sets without
+// stage, which apply first, i+1 for the sets of its i-th stage, and -1 for the
+// sets of a stage it does not list, which do not apply.
+func (s ruleSet) stageRank(pipeline []string) int {
+	if s.stage == "" {
+		return 0
+	}
+	for i, stage := range pipeline {
+		if stage == s.stage {
+			return i + 1
+		}
+	}
+	return -1
+}
@@ -0,0 +1,89 @@
+package plugin
+
+import (
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	velerov1 "github.com/vmware-tanzu/velero/pkg/apis/velero/v1"
+	"github.com/vmware-tanzu/velero/pkg/plugin/velero"
+	"github.com/wrkt/velero-custom-plugins/internal/config"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestPipeline(t *testing.T) {
+	plugin := &RestorePlugin{logger: logrus.New()}
+	assert.Nil(t, plugin.pipeline(nil))
+
+	t.Setenv(pipelineEnv, "rename-namespace, rewrite-images")
+	assert.Equal(t, []string{"rename-namespace", "rewrite-images"}, plugin.pipeline(nil))
+
+	restore := &velerov1.Restore{ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{
+		pipelineAnnotation: "strip-cloud-ids,rename-namespace,,strip-cloud-ids",
+	}}}
+	assert.Equal(t, []string{"strip-cloud-ids", "rename-namespace"}, plugin.pipeline(restore), "the annotation wins, duplicates apply once")
+
+	restore.Annotations[pipelineAnnotation] = ""
+	assert.Nil(t, plugin.pipeline(restore), "an empty annotation disables the stages")
+
+	c, err := config.Load(settings, config.Source{Name: "file", Values: map[string]string{pipelineEnv: "rewrite-images"}})
+	require.NoError(t, err)
+	plugin.config = c
+	assert.Equal(t, []string{"rewrite-images"}, plugin.pipeline(nil), "from the settings")
+}
+
+func TestStageRank(t *testing.T) {
+	pipeline := []string{"rename-namespace", "rewrite-images"}
+	assert.Equal(t, 0, ruleSet{}.stageRank(pipeline))
+	assert.Equal(t, 0, ruleSet{}.stageRank(nil))
+	assert.Equal(t, 2, ruleSet{stage: "rewrite-images"}.stageRank(pipeline))
+	assert.Equal(t, -1, ruleSet{stage: "strip-cloud-ids"}.stageRank(pipeline))
+}
+
+func TestReplacePatternAction_Pipeline(t *testing.T) {
+	t.Setenv(stampOriginEnv, "false")
+	plugin := &RestorePlugin{logger: logrus.New()}
+	sets := ruleSetsFrom([]v1.ConfigMap{
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "hosts", Annotations: map[string]string{stageAnnotation: "rewrite-hosts", priorityAnnotation: "10"}},
+			Data:       map[string]string{"registry.prod": "registry.dr"},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "mirror", Annotations: map[string]string{
+				stageAnnotation:       "rewrite-images",
+				transformerAnnotation: transformerPatch,
+			}},
+			Data: map[string]string{jsonPatchKey: `[{"op": "add", "path": "/data/mirror", "value": "registry.prod/mirror"}]`},
+		},
+		{ObjectMeta: metav1.ObjectMeta{Name: "global"}, Data: map[string]string{"web": "shop"}},
+	})
+	item := func() *unstructured.Unstructured {
+		return &unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": "v1",
+			"kind":       "ConfigMap",
+			"metadata":   map[string]interface{}{"name": "web", "namespace": "shop"},
+			"data":       map[string]interface{}{"image": "registry.prod/web"},
+		}}
+	}
+	run := func(pipeline string) map[string]interface{} {
+		restore := &velerov1.Restore{ObjectMeta: metav1.ObjectMeta{Name: "dr-1", Annotations: map[string]string{pipelineAnnotation: pipeline}}}
+		output, err := replacePatternAction(plugin, &velero.RestoreItemActionExecuteInput{Item: item(), Restore: restore}, sets)
+		require.NoError(t, err)
+		return output.UpdatedItem.(*unstructured.Unstructured).Object
+	}
+
+	// the patch of the earlier stage is rewritten by the later one
+	out := run("rewrite-images,rewrite-hosts")
+	assert.Equal(t, map[string]interface{}{"image": "registry.dr/shop", "mirror": "registry.dr/mirror"}, out["data"])
+
+	out = run("rewrite-hosts,rewrite-images")
+	assert.Equal(t, map[string]interface{}{"image": "registry.dr/shop", "mirror": "registry.prod/mirror"}, out["data"])
+
+	// the stages the pipeline leaves out do not apply, the sets without stage do
+	out = run("")
+	assert.Equal(t, map[string]interface{}{"image": "registry.prod/shop"}, out["data"])
+	assert.Equal(t, "shop", out["metadata"].(map[string]interface{})["name"])
+}
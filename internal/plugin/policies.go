@@ -0,0 +1,32 @@
+package plugin
+
+import (
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/wrkt/velero-custom-plugins/internal/opa"
+	"github.com/wrkt/velero-custom-plugins/internal/transform"
+)
+
+const (
+	// opaURLEnv is the URL of the OPA server evaluating the rego ConfigMaps
+	opaURLEnv = "REPLACE_PATTERN_OPA_URL"
+	// opaTimeout bounds each request to the OPA server
+	opaTimeout = 5 * time.Second
+
+	// regoPolicyKey is the data key of a rego ConfigMap
+	regoPolicyKey = "policy.rego"
+	// regoPolicyPrefix prefixes the ids of the policies in the OPA server
+	regoPolicyPrefix = "replace-pattern/"
+)
+
+// loadPolicyDecider returns the OPA server of REPLACE_PATTERN_OPA_URL, nil
+// when unset.
+func loadPolicyDecider(lookup lookupFunc, logger logrus.FieldLogger) transform.PolicyDecider {
+	url, _ := lookup(opaURLEnv)
+	if url == "" {
+		return nil
+	}
+	logger.Infof("Evaluating the rego ConfigMaps with the OPA server at %s", url)
+	return opa.NewClient(url, opaTimeout)
+}
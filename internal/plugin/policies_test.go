@@ -0,0 +1,99 @@
+package plugin
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	velerov1 "github.com/vmware-tanzu/velero/pkg/apis/velero/v1"
+	"github.com/vmware-tanzu/velero/pkg/plugin/velero"
+	"github.com/wrkt/velero-custom-plugins/internal/transform"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// hostPolicy stands for a policy patching the Ingresses of the backup and
+// denying any change to their namespace.
+type hostPolicy struct {
+	ids []string
+}
+
+func (h *hostPolicy) Decide(id, _ string, input interface{}) ([]byte, error) {
+	h.ids = append(h.ids, id)
+	object := input.(map[string]interface{})["object"].(map[string]interface{})
+	old := input.(map[string]interface{})["oldObject"].(map[string]interface{})
+	decision := map[string]interface{}{
+		"patch": []interface{}{map[string]interface{}{"op": "add", "path": "/metadata/labels", "value": map[string]interface{}{"policy": "checked"}}},
+	}
+	if object["metadata"].(map[string]interface{})["namespace"] != old["metadata"].(map[string]interface{})["namespace"] {
+		decision["deny"] = []string{"Ingresses stay in their namespace"}
+	}
+	return json.Marshal(decision)
+}
+
+func TestReplacePatternAction_Rego(t *testing.T) {
+	t.Setenv(stampOriginEnv, "false")
+	policy := &hostPolicy{}
+	plugin := &RestorePlugin{logger: logrus.New(), policies: policy}
+	restore := &velerov1.Restore{ObjectMeta: metav1.ObjectMeta{Name: "dr-1", UID: "uid-1"}}
+	regoConfigMap := v1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "ingresses", Annotations: map[string]string{transformerAnnotation: transformerRego}},
+		Data:       map[string]string{regoPolicyKey: "package restore.ingresses\n"},
+	}
+	ingress := func() *unstructured.Unstructured {
+		return &unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": "networking.k8s.io/v1",
+			"kind":       "Ingress",
+			"metadata":   map[string]interface{}{"name": "web", "namespace": "shop"},
+			"spec":       map[string]interface{}{"rules": []interface{}{map[string]interface{}{"host": "web.example.com"}}},
+		}}
+	}
+
+	sets := ruleSetsFrom([]v1.ConfigMap{regoConfigMap, {
+		ObjectMeta: metav1.ObjectMeta{Name: "hosts"},
+		Data:       map[string]string{"example.com": "dr.example.com"},
+	}})
+	output, err := replacePatternAction(plugin, &velero.RestoreItemActionExecuteInput{Item: ingress(), Restore: restore}, sets)
+	require.NoError(t, err)
+	result := output.UpdatedItem.(*unstructured.Unstructured)
+	assert.Equal(t, map[string]string{"policy": "checked"}, result.GetLabels())
+	assert.Equal(t, "web.dr.example.com", result.Object["spec"].(map[string]interface{})["rules"].([]interface{})[0].(map[string]interface{})["host"])
+	assert.Equal(t, []string{"replace-pattern/ingresses", "replace-pattern/ingresses"}, policy.ids, "the patch and the decision are evaluated")
+
+	// a rule moving the Ingress to another namespace is denied
+	sets = ruleSetsFrom([]v1.ConfigMap{regoConfigMap, {
+		ObjectMeta: metav1.ObjectMeta{Name: "namespaces"},
+		Data:       map[string]string{"shop": "shop-dr"},
+	}})
+	original := ingress()
+	output, err = replacePatternAction(plugin, &velero.RestoreItemActionExecuteInput{Item: original, Restore: restore}, sets)
+	require.NoError(t, err)
+	assert.Equal(t, ingress(), output.UpdatedItem, "the item is restored untouched")
+	assert.Equal(t, 1, plugin.stateFor(restore).report.summary.ItemsDenied)
+
+	// without OPA server, the policy is ignored
+	plugin = &RestorePlugin{logger: logrus.New()}
+	output, err = replacePatternAction(plugin, &velero.RestoreItemActionExecuteInput{Item: ingress(), Restore: restore}, sets)
+	require.NoError(t, err)
+	assert.Equal(t, "shop-dr", output.UpdatedItem.(*unstructured.Unstructured).GetNamespace())
+}
+
+func TestRuleSetBuild_Rego(t *testing.T) {
+	set := ruleSet{name: "ingresses", transformer: transformerRego, config: map[string]string{regoPolicyKey: "package restore\n"}}
+	transformer, err := set.build(logrus.New())
+	require.NoError(t, err)
+	assert.Equal(t, "replace-pattern/ingresses", transformer.(*transform.Rego).ID)
+
+	set.config[regoSeverityKey] = severityCritical
+	transformer, err = set.build(logrus.New())
+	require.NoError(t, err)
+	assert.True(t, transformer.(*transform.Rego).Critical)
+
+	for _, config := range []map[string]string{{}, {regoPolicyKey: "deny[msg] { true }"}, {regoPolicyKey: "package restore\n", regoSeverityKey: "fatal"}} {
+		_, err := ruleSet{transformer: transformerRego, config: config}.build(logrus.New())
+		assert.Error(t, err, config)
+	}
+}
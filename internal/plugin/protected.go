@@ -0,0 +1,65 @@
+package plugin
+
+import (
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// protectedPrefixesEnv adds comma-separated prefixes to the label and
+// annotation keys that rules never alter.
+const protectedPrefixesEnv = "REPLACE_PATTERN_PROTECTED_PREFIXES"
+
+// defaultProtectedPrefixes prefix the labels and annotations Velero keeps its
+// own bookkeeping in, such as velero.io/backup-name: rewriting them breaks
+// restores, deletions and later backups.
+var defaultProtectedPrefixes = []string{"velero.io/", "backup.velero.io/", "restore.velero.io/"}
+
+// loadProtectedPrefixes returns the default protected prefixes and those of
+// protectedPrefixesEnv.
+func loadProtectedPrefixes(lookup lookupFunc, logger logrus.FieldLogger) []string {
+	prefixes := append([]string{}, defaultProtectedPrefixes...)
+	value, ok := lookup(protectedPrefixesEnv)
+	if !ok {
+		return prefixes
+	}
+	for _, prefix := range strings.Split(value, ",") {
+		prefix = strings.TrimSpace(prefix)
+		if prefix == "" {
+			logger.Warnf("Ignoring empty prefix in %s=%q", protectedPrefixesEnv, value)
+			continue
+		}
+		prefixes = append(prefixes, prefix)
+	}
+	return prefixes
+}
+
+// isProtectedKey reports whether rules must leave a label or annotation key,
+// and its value, untouched.
+func (p *RestorePlugin) isProtectedKey(key string) bool {
+	prefixes := p.protectedPrefixes
+	if prefixes == nil {
+		prefixes = defaultProtectedPrefixes
+	}
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// protectedMetadataPaths returns the paths of the protected labels and
+// annotations of item.
+func (p *RestorePlugin) protectedMetadataPaths(item *unstructured.Unstructured) [][]string {
+	var paths [][]string
+	for field, keys := range map[string]map[string]string{"labels": item.GetLabels(), "annotations": item.GetAnnotations()} {
+		for key := range keys {
+			if p.isProtectedKey(key) {
+				paths = append(paths, []string{"metadata", field, key})
+			}
+		}
+	}
+	return paths
+}
@@ -0,0 +1,61 @@
+package plugin
+
+import (
+	"os"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vmware-tanzu/velero/pkg/plugin/velero"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestLoadProtectedPrefixes(t *testing.T) {
+	assert.Equal(t, defaultProtectedPrefixes, loadProtectedPrefixes(os.LookupEnv, logrus.New()))
+
+	t.Setenv(protectedPrefixesEnv, "argocd.argoproj.io/, ,kapp.k14s.io/")
+	assert.Equal(t, append(append([]string{}, defaultProtectedPrefixes...), "argocd.argoproj.io/", "kapp.k14s.io/"), loadProtectedPrefixes(os.LookupEnv, logrus.New()))
+}
+
+func TestReplacePatternAction_ProtectedPrefixes(t *testing.T) {
+	t.Setenv(stampOriginEnv, "false")
+	plugin := &RestorePlugin{logger: logrus.New(), protectedPrefixes: append(append([]string{}, defaultProtectedPrefixes...), "argocd.argoproj.io/")}
+	sets := []ruleSet{{patterns: map[string]string{"prod": "dr"}}}
+
+	item := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "ConfigMap",
+		"metadata": map[string]interface{}{
+			"name":      "prod-settings",
+			"namespace": "shop",
+			"labels": map[string]interface{}{
+				"velero.io/backup-name":         "prod-daily",
+				"velero.io/restore-name":        "prod-daily-1",
+				"argocd.argoproj.io/instance":   "shop-prod",
+				"app.kubernetes.io/environment": "prod",
+			},
+			"annotations": map[string]interface{}{
+				"backup.velero.io/must-include-additional-items": "prod",
+				"prod.example.com/owner":                         "team",
+			},
+		},
+		"data": map[string]interface{}{"env": "prod"},
+	}}
+
+	output, err := replacePatternAction(plugin, &velero.RestoreItemActionExecuteInput{Item: item, ItemFromBackup: item}, sets)
+	require.NoError(t, err)
+	result := output.UpdatedItem.(*unstructured.Unstructured)
+	assert.Equal(t, "dr-settings", result.GetName())
+	assert.Equal(t, map[string]string{
+		"velero.io/backup-name":         "prod-daily",
+		"velero.io/restore-name":        "prod-daily-1",
+		"argocd.argoproj.io/instance":   "shop-prod",
+		"app.kubernetes.io/environment": "dr",
+	}, result.GetLabels())
+	assert.Equal(t, map[string]string{
+		"backup.velero.io/must-include-additional-items": "prod",
+		"dr.example.com/owner":                           "team",
+	}, result.GetAnnotations())
+	assert.Equal(t, "dr", result.Object["data"].(map[string]interface{})["env"])
+}
@@ -0,0 +1,30 @@
+package plugin
+
+import (
+	"strconv"
+
+	"github.com/sirupsen/logrus"
+)
+
+// readOnlyEnv, when true, keeps the plugin from writing to the API: the
+// summary report, the inverse rule set and the state of migrations are not
+// written, items are only transformed. For clusters whose change control
+// forbids writes initiated by plugins.
+const readOnlyEnv = "REPLACE_PATTERN_READ_ONLY"
+
+// loadReadOnly returns whether readOnlyEnv enables the read-only mode.
+func loadReadOnly(lookup lookupFunc, logger logrus.FieldLogger) bool {
+	value, ok := lookup(readOnlyEnv)
+	if !ok {
+		return false
+	}
+	readOnly, err := strconv.ParseBool(value)
+	if err != nil {
+		logger.Warnf("Ignoring invalid %s=%q", readOnlyEnv, value)
+		return false
+	}
+	if readOnly {
+		logger.Infof("Read-only mode: no summary report, inverse rule set or migration state is written")
+	}
+	return readOnly
+}
@@ -0,0 +1,41 @@
+package plugin
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	velerov1 "github.com/vmware-tanzu/velero/pkg/apis/velero/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestLoadReadOnly(t *testing.T) {
+	assert.False(t, loadReadOnly(os.LookupEnv, logrus.New()))
+	t.Setenv(readOnlyEnv, "true")
+	assert.True(t, loadReadOnly(os.LookupEnv, logrus.New()))
+	t.Setenv(readOnlyEnv, "maybe")
+	assert.False(t, loadReadOnly(os.LookupEnv, logrus.New()))
+}
+
+func TestFlushReport_ReadOnly(t *testing.T) {
+	configMaps := fake.NewSimpleClientset().CoreV1().ConfigMaps("velero")
+	plugin := &RestorePlugin{logger: logrus.New(), configMapClient: configMaps, readOnly: true}
+	restore := &velerov1.Restore{ObjectMeta: metav1.ObjectMeta{
+		Name:        "dr-1",
+		UID:         "uid-1",
+		Annotations: map[string]string{migrationAnnotation: "shop-to-dr"},
+	}}
+
+	report := plugin.stateFor(restore).report
+	report.recordApplied(pattern1, replacement1)
+	report.recordRename(item("", "Service", "web", "foo"), item("", "Service", "web", "bar"))
+	require.NoError(t, plugin.flushReport(report))
+
+	list, err := configMaps.List(context.Background(), metav1.ListOptions{})
+	require.NoError(t, err)
+	assert.Empty(t, list.Items)
+}
@@ -0,0 +1,264 @@
+package plugin
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/vmware-tanzu/velero/pkg/plugin/velero"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+const (
+	// recordDirEnv enables the recorder: the inputs of the items whose
+	// transformation hit errors are written to that directory.
+	recordDirEnv = "REPLACE_PATTERN_RECORD_DIR"
+
+	redacted = "<redacted>"
+)
+
+// recording is an item that hit errors, with everything needed to replay its
+// transformation.
+type recording struct {
+	Restore        string                 `json:"restore,omitempty"`
+	Errors         []string               `json:"errors"`
+	Item           map[string]interface{} `json:"item"`
+	ItemFromBackup map[string]interface{} `json:"itemFromBackup,omitempty"`
+	// ConfigMaps rebuilds the rule sets applied to the item.
+	ConfigMaps []v1.ConfigMap `json:"configMaps"`
+}
+
+// failures collects the errors of the transformation of an item, possibly from
+// the watchdog's goroutine.
+type failures struct {
+	mu   sync.Mutex
+	errs []string
+}
+
+func (f *failures) add(transformer string, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.errs = append(f.errs, fmt.Sprintf("%s: %v", transformer, err))
+}
+
+func (f *failures) list() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.errs...)
+}
+
+// deferred holds the side effects of the transformers of an item, applied
+// once the chain completes in time: a transformer abandoned by the watchdog
+// keeps running in the background, and must not count its hits then.
+type deferred struct {
+	mu      sync.Mutex
+	effects []func()
+	done    bool
+}
+
+// add queues effect, or drops it once the chain is over.
+func (d *deferred) add(effect func()) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if !d.done {
+		d.effects = append(d.effects, effect)
+	}
+}
+
+// apply runs the queued effects, in order, and drops the later ones.
+func (d *deferred) apply() {
+	d.mu.Lock()
+	effects := d.effects
+	d.effects, d.done = nil, true
+	d.mu.Unlock()
+	for _, effect := range effects {
+		effect()
+	}
+}
+
+// discard drops the queued effects and the later ones.
+func (d *deferred) discard() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.effects, d.done = nil, true
+}
+
+// record writes the input of an item that hit errors, with the rule sets
+// applying to it, to the record directory if enabled. Secret values are
+// redacted.
+func (p *RestorePlugin) record(input *velero.RestoreItemActionExecuteInput, sets []ruleSet, errs []string) {
+	if p.recordDir == "" {
+		return
+	}
+
+	rec := recording{
+		Errors: errs,
+		Item:   redact(input.Item.UnstructuredContent()),
+	}
+	if input.ItemFromBackup != nil {
+		rec.ItemFromBackup = redact(input.ItemFromBackup.UnstructuredContent())
+	}
+	if input.Restore != nil {
+		rec.Restore = input.Restore.Name
+	}
+	for _, set := range sets {
+		// the sets are the ones applying to the item, and the replay has no
+		// Restore to evaluate selectors against
+		set.restoreSelector = ""
+		rec.ConfigMaps = append(rec.ConfigMaps, set.configMap())
+	}
+
+	data, err := json.MarshalIndent(rec, "", "  ")
+	if err != nil {
+		p.logger.Warnf("Failed to encode recording: %v", err)
+		return
+	}
+	if err := os.MkdirAll(p.recordDir, 0o700); err != nil {
+		p.logger.Warnf("Failed to create %s: %v", p.recordDir, err)
+		return
+	}
+
+	item := &unstructured.Unstructured{Object: rec.Item}
+	name := strings.ToLower(fmt.Sprintf("%s-%s-%s-%s-%d.json", orDefault(rec.Restore, "none"), item.GetKind(), orDefault(item.GetNamespace(), "_"), item.GetName(), time.Now().UnixNano()))
+	path := filepath.Join(p.recordDir, strings.ReplaceAll(name, string(filepath.Separator), "_"))
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		p.logger.Warnf("Failed to write recording: %v", err)
+		return
+	}
+	p.logger.Infof("Recorded the input of %s %s/%s to %s", item.GetKind(), item.GetNamespace(), item.GetName(), path)
+}
+
+func orDefault(value, fallback string) string {
+	if value == "" {
+		return fallback
+	}
+	return value
+}
+
+// redact returns a copy of an item without the values of Secrets.
+func redact(content map[string]interface{}) map[string]interface{} {
+	item := (&unstructured.Unstructured{Object: content}).DeepCopy()
+	if item.GetAPIVersion() != "v1" || item.GetKind() != "Secret" {
+		return item.Object
+	}
+
+	for _, field := range []string{"data", "stringData"} {
+		values, _, _ := unstructured.NestedMap(item.Object, field)
+		for key := range values {
+			values[key] = redacted
+		}
+		if values != nil {
+			unstructured.SetNestedMap(item.Object, values, field)
+		}
+	}
+	annotations := item.GetAnnotations()
+	if _, ok := annotations[v1.LastAppliedConfigAnnotation]; ok {
+		annotations[v1.LastAppliedConfigAnnotation] = redacted
+		item.SetAnnotations(annotations)
+	}
+	return item.Object
+}
+
+// configMap returns a ConfigMap from which ruleSetsFrom rebuilds the set.
+func (s ruleSet) configMap() v1.ConfigMap {
+	annotations := map[string]string{scopeAnnotation: s.scope}
+	if s.transformer != "" {
+		annotations[transformerAnnotation] = s.transformer
+	}
+	if s.paths != "" {
+		annotations[pathsAnnotation] = s.paths
+	}
+	if s.valuesOnly {
+		annotations[valuesOnlyAnnotation] = "true"
+	}
+	if len(s.excludeLabels) > 0 {
+		annotations[excludeLabelsAnnotation] = formatExclusions(s.excludeLabels)
+	}
+	if len(s.excludeAnnotations) > 0 {
+		annotations[excludeAnnotationsAnnotation] = formatExclusions(s.excludeAnnotations)
+	}
+	if s.excludePaths != "" {
+		annotations[excludePathsAnnotation] = s.excludePaths
+	}
+	if len(s.excludeStrings) > 0 {
+		annotations[excludeStringsAnnotation] = strings.Join(s.excludeStrings, ",")
+	}
+	if s.restoreSelector != "" {
+		annotations[restoreSelectorAnnotation] = s.restoreSelector
+	}
+	if len(s.clusters) > 0 {
+		annotations[clustersAnnotation] = strings.Join(s.clusters, ",")
+	}
+	if s.templates {
+		annotations[templatesAnnotation] = "true"
+	}
+	if s.condition != "" {
+		annotations[conditionAnnotation] = s.condition
+	}
+	if s.patternConditions != "" {
+		annotations[patternConditionsAnnotation] = s.patternConditions
+	}
+	if s.matchOptions != "" {
+		annotations[matchOptionsAnnotation] = s.matchOptions
+	}
+	if s.stage != "" {
+		annotations[stageAnnotation] = s.stage
+	}
+	if s.priority != 0 {
+		annotations[priorityAnnotation] = strconv.Itoa(s.priority)
+	}
+	data := s.patterns
+	if !s.isLiteral() {
+		data = s.config
+	}
+
+	return v1.ConfigMap{
+		TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "ConfigMap"},
+		ObjectMeta: metav1.ObjectMeta{Name: s.name, Annotations: annotations},
+		Data:       data,
+	}
+}
+
+// Replay runs the transformer chain on an item recorded by the recorder, read
+// from in, and writes the transformed item to out as indented JSON.
+func Replay(in io.Reader, out io.Writer, logger logrus.FieldLogger) error {
+	var rec recording
+	if err := json.NewDecoder(in).Decode(&rec); err != nil {
+		return fmt.Errorf("failed to read recording: %v", err)
+	}
+	if rec.Item == nil {
+		return fmt.Errorf("recording holds no item")
+	}
+	for _, err := range rec.Errors {
+		logger.Infof("Recorded error: %s", err)
+	}
+
+	p := &RestorePlugin{
+		logger: logger,
+		limits: loadLimits(os.LookupEnv, logger),
+	}
+	input := &velero.RestoreItemActionExecuteInput{Item: &unstructured.Unstructured{Object: rec.Item}}
+	if rec.ItemFromBackup != nil {
+		input.ItemFromBackup = &unstructured.Unstructured{Object: rec.ItemFromBackup}
+	}
+
+	output, err := replacePatternAction(p, input, ruleSetsFrom(rec.ConfigMaps))
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(output.UpdatedItem.UnstructuredContent()); err != nil {
+		return fmt.Errorf("failed to write item: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,90 @@
+package plugin
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	velerov1 "github.com/vmware-tanzu/velero/pkg/apis/velero/v1"
+	"github.com/vmware-tanzu/velero/pkg/plugin/velero"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestRuleSetConfigMap(t *testing.T) {
+	sets := []ruleSet{
+		{name: "patterns", scope: scopeNamespaced, patterns: map[string]string{"foo": "bar"}},
+		{
+			name:               "identities",
+			scope:              scopeAll,
+			transformer:        transformerIdentity,
+			config:             map[string]string{"aws.yaml": "a: b"},
+			excludeLabels:      []exclusion{{key: "a", value: "b"}, {key: "c", anyValue: true}},
+			excludeAnnotations: []exclusion{{key: "d", anyValue: true}},
+			priority:           5,
+		},
+	}
+
+	var configMaps []v1.ConfigMap
+	for _, set := range sets {
+		configMaps = append(configMaps, set.configMap())
+	}
+	assert.Equal(t, []ruleSet{sets[1], sets[0]}, ruleSetsFrom(configMaps), "ordered by priority")
+}
+
+func TestRecordAndReplay(t *testing.T) {
+	t.Setenv(stampOriginEnv, "false")
+	dir := t.TempDir()
+	plugin := &RestorePlugin{logger: logrus.New(), recordDir: dir}
+
+	secret := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "Secret",
+		"metadata":   map[string]interface{}{"name": "db", "namespace": "production"},
+		"stringData": map[string]interface{}{"password": "hunter2", "host": "db.production"},
+	}}
+	input := &velero.RestoreItemActionExecuteInput{
+		Item:    secret,
+		Restore: &velerov1.Restore{ObjectMeta: metav1.ObjectMeta{Name: "dr-1"}},
+	}
+	sets := []ruleSet{{name: "patterns", scope: scopeAll, patterns: map[string]string{"production": "review-3"}}}
+
+	// a healthy item is not recorded
+	_, err := replacePatternAction(plugin, input, sets)
+	require.NoError(t, err)
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+
+	// an undecodable last-applied-configuration makes a transformer fail
+	secret.SetAnnotations(map[string]string{v1.LastAppliedConfigAnnotation: "{not json"})
+	_, err = replacePatternAction(plugin, input, sets)
+	require.NoError(t, err)
+	entries, err = os.ReadDir(dir)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Regexp(t, `^dr-1-secret-production-db-\d+\.json$`, entries[0].Name())
+
+	data, err := os.ReadFile(filepath.Join(dir, entries[0].Name()))
+	require.NoError(t, err)
+	var rec recording
+	require.NoError(t, json.Unmarshal(data, &rec))
+	require.Len(t, rec.Errors, 1)
+	assert.Contains(t, rec.Errors[0], "embedded: failed to decode annotation")
+	assert.Equal(t, map[string]interface{}{"password": redacted, "host": redacted}, rec.Item["stringData"])
+	assert.Equal(t, "hunter2", secret.Object["stringData"].(map[string]interface{})["password"])
+	assert.Equal(t, redacted, (&unstructured.Unstructured{Object: rec.Item}).GetAnnotations()[v1.LastAppliedConfigAnnotation])
+	assert.Len(t, rec.ConfigMaps, 1)
+
+	var out bytes.Buffer
+	require.NoError(t, Replay(bytes.NewReader(data), &out, logrus.New()))
+	var replayed map[string]interface{}
+	require.NoError(t, json.Unmarshal(out.Bytes(), &replayed))
+	assert.Equal(t, "review-3", lookupPath(t, replayed, "metadata.namespace"))
+}
@@ -0,0 +1,62 @@
+package plugin
+
+import (
+	"fmt"
+
+	"github.com/wrkt/velero-custom-plugins/internal/transform"
+	"sigs.k8s.io/yaml"
+)
+
+// removedFieldsKey is the data key of the fields a removed-fields ConfigMap
+// adds to the built-in ones.
+const removedFieldsKey = "fields.yaml"
+
+// removedFieldConfig is an entry of the fields.yaml key of a removed-fields
+// ConfigMap.
+type removedFieldConfig struct {
+	Kind      string `json:"kind"`
+	Path      string `json:"path"`
+	RemovedIn string `json:"removedIn"`
+}
+
+// parseRemovedFields parses and validates the YAML list of removed fields.
+func parseRemovedFields(data string) ([]transform.RemovedField, error) {
+	var configs []removedFieldConfig
+	if err := yaml.UnmarshalStrict([]byte(data), &configs); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %v", removedFieldsKey, err)
+	}
+	fields := make([]transform.RemovedField, 0, len(configs))
+	for i, config := range configs {
+		path, err := transform.ParseFieldPath(config.Path)
+		if err != nil {
+			return nil, fmt.Errorf("field %d: %v", i, err)
+		}
+		field := transform.RemovedField{Kind: config.Kind, Path: path, RemovedIn: config.RemovedIn}
+		if err := field.Validate(); err != nil {
+			return nil, fmt.Errorf("field %d: %v", i, err)
+		}
+		fields = append(fields, field)
+	}
+	return fields, nil
+}
+
+// targetVersion returns the Version function of the removed-fields
+// transformer for a restore: the version of the target cluster, discovered
+// once per restore.
+func (p *RestorePlugin) targetVersion(state *restoreState) func() (string, error) {
+	return func() (string, error) {
+		state.versionMu.Lock()
+		defer state.versionMu.Unlock()
+		if state.version == "" {
+			if p.serverVersion == nil {
+				return "", fmt.Errorf("the Kubernetes version of the target cluster cannot be discovered")
+			}
+			info, err := p.serverVersion.ServerVersion()
+			if err != nil {
+				return "", fmt.Errorf("failed to discover the Kubernetes version of the target cluster: %v", err)
+			}
+			state.version = info.Major + "." + info.Minor
+		}
+		return state.version, nil
+	}
+}
@@ -0,0 +1,78 @@
+package plugin
+
+import (
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vmware-tanzu/velero/pkg/plugin/velero"
+	"github.com/wrkt/velero-custom-plugins/internal/transform"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/version"
+	fakediscovery "k8s.io/client-go/discovery/fake"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestRuleSetBuild_RemovedFields(t *testing.T) {
+	transformer, err := ruleSet{transformer: transformerRemoved, config: map[string]string{}}.build(logrus.New())
+	require.NoError(t, err)
+	removed := transformer.(*transform.RemovedFields)
+	assert.Equal(t, transform.RemovedFieldsRemove, removed.Action)
+	assert.True(t, removed.Builtin)
+	assert.Nil(t, removed.Version)
+
+	transformer, err = ruleSet{transformer: transformerRemoved, config: map[string]string{
+		removedFieldsKey: "- kind: Certificate\n  path: spec.acme\n  removedIn: \"1.28\"\n- path: metadata.annotations['example.com/legacy']\n  removedIn: \"1.30\"\n",
+		"action":         "fail",
+		"builtin":        "false",
+		"target-version": "1.29",
+	}}.build(logrus.New())
+	require.NoError(t, err)
+	removed = transformer.(*transform.RemovedFields)
+	assert.Equal(t, transform.RemovedFieldsFail, removed.Action)
+	assert.False(t, removed.Builtin)
+	require.Len(t, removed.Fields, 2)
+	assert.Equal(t, "Certificate", removed.Fields[0].Kind)
+	assert.Equal(t, "spec.acme", removed.Fields[0].Path.String())
+	assert.Equal(t, "1.30", removed.Fields[1].RemovedIn)
+	version, err := removed.Version()
+	require.NoError(t, err)
+	assert.Equal(t, "1.29", version)
+
+	for _, config := range []map[string]string{
+		{"action": "drop"},
+		{"builtin": "maybe"},
+		{"target-version": "latest"},
+		{removedFieldsKey: "- path: spec.acme\n  removedIn: next\n"},
+		{removedFieldsKey: "- path: spec.containers[0]\n  removedIn: \"1.25\"\n"},
+		{removedFieldsKey: "- path: spec.acme\n  removed: \"1.25\"\n"},
+	} {
+		_, err = ruleSet{transformer: transformerRemoved, config: config}.build(logrus.New())
+		assert.Error(t, err, config)
+	}
+}
+
+func TestReplacePatternAction_RemovedFields(t *testing.T) {
+	t.Setenv(stampOriginEnv, "false")
+	discovery := fake.NewSimpleClientset().Discovery().(*fakediscovery.FakeDiscovery)
+	discovery.FakedServerVersion = &version.Info{Major: "1", Minor: "26+"}
+	plugin := &RestorePlugin{logger: logrus.New(), serverVersion: discovery}
+	sets := ruleSetsFrom([]v1.ConfigMap{{
+		ObjectMeta: metav1.ObjectMeta{Name: "cleanup", Annotations: map[string]string{transformerAnnotation: transformerRemoved}},
+	}})
+
+	service := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "Service",
+		"metadata":   map[string]interface{}{"name": "web", "namespace": "shop", "clusterName": "prod"},
+		"spec":       map[string]interface{}{"topologyKeys": []interface{}{"*"}, "type": "ClusterIP"},
+	}}
+	output, err := replacePatternAction(plugin, &velero.RestoreItemActionExecuteInput{Item: service}, sets)
+	require.NoError(t, err)
+	restored := output.UpdatedItem.(*unstructured.Unstructured)
+	assert.Equal(t, map[string]interface{}{"type": "ClusterIP"}, restored.Object["spec"])
+	assert.NotContains(t, restored.Object["metadata"], "clusterName")
+}
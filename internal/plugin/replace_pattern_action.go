@@ -18,14 +18,26 @@ package plugin
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
+	"sort"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/sirupsen/logrus"
+	velerov1 "github.com/vmware-tanzu/velero/pkg/apis/velero/v1"
+	veleroclient "github.com/vmware-tanzu/velero/pkg/generated/clientset/versioned"
+	velerov1client "github.com/vmware-tanzu/velero/pkg/generated/clientset/versioned/typed/velero/v1"
 	"github.com/vmware-tanzu/velero/pkg/plugin/velero"
+	"github.com/wrkt/velero-custom-plugins/internal/config"
+	"github.com/wrkt/velero-custom-plugins/internal/transform"
+	v1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
 	corev1 "k8s.io/client-go/kubernetes/typed/core/v1"
 	"k8s.io/client-go/rest"
@@ -35,6 +47,63 @@ import (
 type RestorePlugin struct {
 	logger          logrus.FieldLogger
 	configMapClient corev1.ConfigMapInterface
+	limits          limits
+	resolver        *resourceResolver
+	liveGetter      liveObjectGetter
+	// apiLimiter bounds the API calls of the transforms, nil without limits
+	apiLimiter     *apiLimiter
+	nodePortLister nodePortLister
+	nodeLister     nodeLister
+	serverVersion  discovery.ServerVersionInterface
+	// dnsChecker resolves rewritten hostnames, nil when disabled
+	dnsChecker *dnsChecker
+	// recordDir is where the inputs of the items that hit errors are
+	// recorded, empty when disabled
+	recordDir string
+	sampler   sampler
+	// skipOrigin disables the original identity annotations, for engines
+	// transforming objects that do not come from a backup
+	skipOrigin bool
+	// protectedPrefixes prefix the label and annotation keys rules never
+	// alter, the defaults when nil
+	protectedPrefixes []string
+	// sections are the top-level fields the patterns of the ConfigMaps
+	// without paths are restricted to, nil for the whole item
+	sections []transform.FieldPath
+
+	// reportFlushInterval is the least time between two writes of a report,
+	// zero disables automatic writes
+	reportFlushInterval time.Duration
+	// readOnly disables every write to the API
+	readOnly bool
+	// config holds the settings loaded at startup, nil when the plugin is
+	// built without, the environment being read instead
+	config *config.Config
+	// versions checks that items are restored in a served version, nil when
+	// disabled
+	versions *versionChecker
+	// reportStores keeps the state of restores in object storage, nil when
+	// it is kept in ConfigMaps
+	reportStores reportStores
+	// policies evaluates the rego ConfigMaps, nil when no OPA server is set
+	policies transform.PolicyDecider
+	// disabled holds the features disabled for missing permissions
+	disabled map[string]bool
+	// freezeWindow is how long the restored workloads stay frozen, zero when
+	// they are not
+	freezeWindow time.Duration
+	// dryRun restores the items unmodified, their changes only logged and
+	// reported, unless the Restore says otherwise
+	dryRun bool
+	// veleroPolicy is what to do with the items of Velero the rules change
+	veleroPolicy string
+	// restores lists the restores in progress, whose annotations may enable
+	// features acting on every item, nil when unknown
+	restores velerov1client.RestoreInterface
+
+	// states holds what is kept between items, per restore
+	statesMu sync.Mutex
+	states   map[types.UID]*restoreState
 }
 
 // NewRestorePlugin instantiates a RestorePlugin.
@@ -48,35 +117,119 @@ func NewRestorePlugin(logger logrus.FieldLogger) *RestorePlugin {
 	if err != nil {
 		logger.Fatalf("Failed to create clientset: %v", err)
 	}
+	dynamicClient, err := dynamic.NewForConfig(config)
+	if err != nil {
+		logger.Fatalf("Failed to create dynamic client: %v", err)
+	}
+	veleroClient, err := veleroclient.NewForConfig(config)
+	if err != nil {
+		logger.Fatalf("Failed to create Velero clientset: %v", err)
+	}
 	configMapClient := clientset.CoreV1().ConfigMaps("velero")
+	cfg, err := loadConfig(configMapClient, logger)
+	if err != nil {
+		logger.Fatalf("Invalid configuration: %v", err)
+	}
+	logger.Infof("Replace-pattern %s", GetCapabilities())
+	readOnly := loadReadOnly(cfg.Lookup, logger)
+	disabled := disabledFeatures(clientset.AuthorizationV1().SelfSubjectAccessReviews(), restorePermissions, readOnly, logger)
+	if !disabled[featureVersionCheck] {
+		enforceVeleroVersion(clientset.AppsV1().Deployments("velero"), cfg.Lookup, logger)
+	}
+	resolver := newResourceResolver(clientset.Discovery(), logger)
+	recordDir, _ := cfg.Lookup(recordDirEnv)
 
-	return &RestorePlugin{
+	p := &RestorePlugin{
 		logger:          logger,
 		configMapClient: configMapClient,
+		config:          cfg,
+		limits:          loadLimits(cfg.Lookup, logger),
+		resolver:        resolver,
+		liveGetter:      &dynamicLiveGetter{client: dynamicClient, resolver: resolver},
+		apiLimiter:      loadAPILimiter(cfg.Lookup, logger),
+		nodePortLister:  &clientNodePortLister{services: clientset.CoreV1()},
+		nodeLister:      &clientNodeLister{nodes: clientset.CoreV1()},
+		serverVersion:   clientset.Discovery(),
+		recordDir:       recordDir,
+		sampler:         loadSampler(cfg.Lookup, logger),
+		dnsChecker:      loadDNSChecker(cfg.Lookup, logger),
+
+		protectedPrefixes: loadProtectedPrefixes(cfg.Lookup, logger),
+		sections:          loadSections(cfg.Lookup, logger),
+
+		reportFlushInterval: defaultReportFlushInterval,
+		readOnly:            readOnly,
+		versions:            newVersionChecker(clientset.Discovery(), dynamicClient, logger),
+		policies:            loadPolicyDecider(cfg.Lookup, logger),
+		reportStores:        loadReportStores(cfg.Lookup, logger, veleroClient.VeleroV1(), clientset.CoreV1().Secrets("velero")),
+		disabled:            disabled,
+		freezeWindow:        loadFreezeWindow(cfg.Lookup, logger),
+		dryRun:              loadDryRun(cfg.Lookup, logger),
+		veleroPolicy:        loadVeleroResourcesPolicy(cfg.Lookup, logger),
+		restores:            veleroClient.VeleroV1().Restores("velero"),
+	}
+	if disabled[featureReports] {
+		p.readOnly = true
+	}
+	if disabled[featureNodePorts] {
+		// node ports are only checked against the ones of the restore
+		p.nodePortLister = nil
+	}
+	if disabled[featureCRDs] {
+		p.versions.crds = nil
 	}
+	return p
 }
 
-// AppliesTo returns a ResourceSelector that matches all resources
+// AppliesTo returns a ResourceSelector that matches the resources the rules
+// can change, or all resources when they are not all scoped to some or a
+// feature acts on every item.
 func (p *RestorePlugin) AppliesTo() (velero.ResourceSelector, error) {
-	return velero.ResourceSelector{}, nil
+	configMaps, err := p.getConfigMapsByLabel(RulesSelector, "velero")
+	if err != nil {
+		return velero.ResourceSelector{}, nil
+	}
+	if features := p.allItemFeatures(configMaps); len(features) > 0 {
+		p.logger.Infof("Routing every resource through the plugin for %s", strings.Join(features, ", "))
+		return velero.ResourceSelector{}, nil
+	}
+	resources := p.appliesToResources(configMaps)
+	if len(resources) > 0 {
+		p.logger.Infof("Restricting the plugin to the resources of the rules: %s", strings.Join(resources, ", "))
+	}
+	return velero.ResourceSelector{IncludedResources: resources}, nil
 }
 
 // Execute allows the RestorePlugin to perform arbitrary logic with the item being restored
 func (p *RestorePlugin) Execute(input *velero.RestoreItemActionExecuteInput) (*velero.RestoreItemActionExecuteOutput, error) {
-	p.logger.Info("Executing CustomRestorePlugin")
-	defer p.logger.Info("Done executing CustomRestorePlugin")
+	logger := p.verbose(&unstructured.Unstructured{Object: input.Item.UnstructuredContent()})
+	logger.Info("Executing CustomRestorePlugin")
+	defer logger.Info("Done executing CustomRestorePlugin")
 
 	// Fetch patterns from ConfigMaps based on label selector
-	patterns, err := p.getConfigMapDataByLabel("agoracalyce.io/replace-pattern=RestoreItemAction", "velero")
+	configMaps, err := p.getConfigMapsByLabel(RulesSelector, "velero")
 	if err != nil {
+		if err := checkRulesPin(input.Restore, nil); err != nil {
+			return nil, err
+		}
 		p.logger.Warnf("No ConfigMap found or error fetching ConfigMap: %v", err)
 		return velero.NewRestoreItemActionExecuteOutput(input.Item), nil // Continue without applying the plugin logic if ConfigMap is not found
 	}
+	if err := checkRulesPin(input.Restore, configMaps); err != nil {
+		return nil, err
+	}
+	if report := p.stateFor(input.Restore).report; report != nil {
+		report.recordRulesHash(rulesHash(configMaps))
+	}
+	configMaps = expandRules(configMaps, p.logger)
+
+	gvk := input.Item.GetObjectKind().GroupVersionKind()
+	sets := ruleSetsFrom(p.configMapsFor(gvk, configMaps))
 
-	return replacePatternAction(p, input, patterns)
+	return replacePatternAction(p, input, sets)
 }
 
-func (p *RestorePlugin) getConfigMapDataByLabel(labelSelector, namespace string) (map[string]string, error) {
+func (p *RestorePlugin) getConfigMapsByLabel(labelSelector, namespace string) ([]v1.ConfigMap, error) {
 	configMaps, err := p.configMapClient.List(context.TODO(), metav1.ListOptions{
 		LabelSelector: labelSelector,
 	})
@@ -88,34 +241,422 @@ func (p *RestorePlugin) getConfigMapDataByLabel(labelSelector, namespace string)
 		return nil, fmt.Errorf("no configmap found with label selector: %s", labelSelector)
 	}
 
-	// So we can use this plugin simultaneously
-	aggregatedPatterns := make(map[string]string)
-	for _, configMap := range configMaps.Items {
-		for key, value := range configMap.Data {
-			aggregatedPatterns[key] = value
+	return configMaps.Items, nil
+}
+
+func replacePatternAction(p *RestorePlugin, input *velero.RestoreItemActionExecuteInput, sets []ruleSet) (*velero.RestoreItemActionExecuteOutput, error) {
+	output, err := applyRules(p, input, sets)
+	state := p.stateFor(input.Restore)
+	if !state.dryRun {
+		return output, err
+	}
+	if err != nil {
+		item := &unstructured.Unstructured{Object: input.Item.UnstructuredContent()}
+		p.logger.Warnf("Dry run: %s %s/%s would fail the restore: %v", item.GetKind(), item.GetNamespace(), item.GetName(), err)
+		return velero.NewRestoreItemActionExecuteOutput(input.Item), nil
+	}
+	return p.dryRunOutput(input, output, state)
+}
+
+// applyRules applies the rule sets to the item of input.
+func applyRules(p *RestorePlugin, input *velero.RestoreItemActionExecuteInput, sets []ruleSet) (*velero.RestoreItemActionExecuteOutput, error) {
+	item := &unstructured.Unstructured{Object: input.Item.UnstructuredContent()}
+	logger := p.verbose(item)
+	logger.Infof("Executing ReplacePatternAction on %v", item.GetKind())
+
+	state := p.stateFor(input.Restore)
+	clusterScoped := p.isClusterScoped(item)
+	if output := p.abortedOutput(input, state, clusterScoped); output != nil {
+		return output, nil
+	}
+
+	if rules := countRules(sets); p.limits.maxRules > 0 && rules > p.limits.maxRules {
+		p.logger.Errorf("Refusing to apply %d patterns, the limit is %d: restoring the item untouched", rules, p.limits.maxRules)
+		return velero.NewRestoreItemActionExecuteOutput(input.Item), nil
+	}
+
+	if p.limits.maxItemSize > 0 {
+		if size := transform.Size(item.Object); size > p.limits.maxItemSize {
+			p.logger.Warnf("%s %s is about %d bytes, above the %d bytes limit: restoring the item untouched", item.GetKind(), item.GetName(), size, p.limits.maxItemSize)
+			return velero.NewRestoreItemActionExecuteOutput(input.Item), nil
 		}
 	}
 
-	return aggregatedPatterns, nil
-}
+	kind, bucket := item.GetKind(), item.GetNamespace()
+	if clusterScoped {
+		bucket = clusterScopeBucket
+	}
+
+	applicable := p.applicableSets(sets, item, input.Restore, clusterScoped)
+	for _, set := range applicable {
+		if match, excluded := set.excludes(item); excluded {
+			logger.Infof("Skipping %s %s/%s: excluded from restore by %s in %s", kind, item.GetNamespace(), item.GetName(), match, set.name)
+			if state.report != nil {
+				state.report.recordItem(false, clusterScoped)
+				state.report.recordExcluded()
+				p.scheduleReportFlush(state.report)
+			}
+			return velero.NewRestoreItemActionExecuteOutput(input.Item).WithoutRestore(), nil
+		}
+	}
+
+	// each stage of the pipeline runs its patterns, then its other
+	// transformers, built first so that the patterns leave their fields alone
+	pipeline := p.pipeline(input.Restore)
+	rewrites, others := make([][]chainStep, len(pipeline)+1), make([][]chainStep, len(pipeline)+1)
+	var conversions []chainStep
+	var policies []*transform.Rego
+	var owned [][]string
+	// the hits and dependencies are counted once the chain completed in time
+	effects := &deferred{}
+	for _, set := range applicable {
+		if set.isLiteral() || set.isRegex() || set.isChainOrder() || p.isDisabled(set) {
+			continue
+		}
+		transformer, err := set.build(p.logger)
+		if err != nil {
+			p.logger.Warnf("Ignoring ConfigMap %s: %v", set.name, err)
+			continue
+		}
+		if nodePorts, ok := transformer.(*transform.NodePorts); ok {
+			nodePorts.Claim = p.nodePortClaimer(state, effects)
+		}
+		if topology, ok := transformer.(*transform.TopologySpread); ok {
+			topology.Nodes = p.topologyNodes(state)
+		}
+		if devices, ok := transformer.(*transform.ExtendedResources); ok {
+			devices.Available = p.extendedResources(state)
+		}
+		if modifiers, ok := transformer.(*transform.ResourceModifiers); ok {
+			modifiers.Resolve = p.resolver.resolve
+		}
+		if removed, ok := transformer.(*transform.RemovedFields); ok && removed.Version == nil {
+			removed.Version = p.targetVersion(state)
+		}
+		if order, ok := transformer.(*transform.InitOrder); ok && set.reportsDependencies() && state.report != nil {
+			recordDependencies := dependencyRecorder(state.report)
+			order.OnDependencies = func(item *unstructured.Unstructured, dependencies []string) {
+				effects.add(func() { recordDependencies(item, dependencies) })
+			}
+		}
+		if policy, ok := transformer.(*transform.NamespacePolicy); ok {
+			data := newTemplateData(input)
+			policy.Render = func(key, value string) (string, error) { return renderTemplate(key, value, data) }
+		}
+		if targets, ok := transformer.(*transform.ClusterTargets); ok {
+			targets.Namespace = originalItem(input).GetNamespace()
+		}
+		if rego, ok := transformer.(*transform.Rego); ok {
+			if p.policies == nil {
+				p.logger.Warnf("Ignoring ConfigMap %s: %s is not set", set.name, opaURLEnv)
+				continue
+			}
+			rego.Decider = p.policies
+			rego.Original = originalItem(input)
+			policies = append(policies, rego)
+		}
+		if _, ok := transformer.(*transform.APIVersions); ok {
+			// the other transformers expect the current schemas
+			conversions = append(conversions, setStep(set, transformer))
+			continue
+		}
+		stage := set.stageRank(pipeline)
+		others[stage] = append(others[stage], setStep(set, transformer))
+		if owner, ok := transformer.(transform.FieldOwner); ok {
+			owned = append(owned, owner.OwnedPaths()...)
+		}
+	}
 
-func replacePatternAction(p *RestorePlugin, input *velero.RestoreItemActionExecuteInput, patterns map[string]string) (*velero.RestoreItemActionExecuteOutput, error) {
-	p.logger.Infof("Executing ReplacePatternAction on %v", input.Item.GetObjectKind().GroupVersionKind().Kind)
+	// with the update policy, existing objects are patched in place
+	updateExisting := input.Restore != nil && input.Restore.Spec.ExistingResourcePolicy == velerov1.PolicyTypeUpdate
 
-	jsonData, err := json.Marshal(input.Item)
+	// Velero's own labels and annotations are never rewritten
+	owned = append(owned, p.protectedMetadataPaths(item)...)
+
+	hits := 0
+	var embedded []transform.Transformer
+	// renames applies the sets to a label or annotation key, in order
+	var renames []func(string) string
+	for _, set := range applicable {
+		if !set.isLiteral() && !set.isRegex() {
+			continue
+		}
+		paths, err := p.patternPaths(set)
+		if err != nil {
+			p.logger.Warnf("Ignoring ConfigMap %s: %v", set.name, err)
+			continue
+		}
+		excluded, err := set.excludedPaths()
+		if err != nil {
+			p.logger.Warnf("Ignoring ConfigMap %s: %v", set.name, err)
+			continue
+		}
+		protected := append(append(append([][]string{}, set.protectedPaths(clusterScoped, updateExisting)...), owned...), excluded...)
+		if set.isRegex() {
+			transformer, err := set.build(p.logger)
+			if err != nil {
+				p.logger.Warnf("Ignoring ConfigMap %s: %v", set.name, err)
+				continue
+			}
+			regex := transformer.(*transform.Regex)
+			// regex rules cannot be inverted, so they are not recorded as applied
+			regex.OnHit = func(expr string, count int) {
+				effects.add(func() {
+					hits += count
+					if state.report != nil {
+						state.report.recordHit(expr, kind, bucket, count)
+					}
+				})
+			}
+			regex.Protected = append(protected, lastAppliedPath)
+			regex.Paths = paths
+			regex.Excluded = set.excludeStrings
+			regex.ValuesOnly = set.valuesOnly
+			stage := set.stageRank(pipeline)
+			rewrites[stage] = append(rewrites[stage], setStep(set, regex))
+			if paths == nil && !set.valuesOnly {
+				renames = append(renames, regex.Replace)
+			}
+			embedded = append(embedded, &transform.Regex{Rules: regex.Rules, Protected: protected, Paths: paths, Excluded: set.excludeStrings, ValuesOnly: set.valuesOnly})
+			continue
+		}
+		// checked with the applicable sets
+		options, _ := set.parseMatchOptions()
+		patterns := set.patterns
+		if set.templates {
+			if patterns, err = set.renderPatterns(newTemplateData(input)); err != nil {
+				p.logger.Warnf("Ignoring ConfigMap %s: %v", set.name, err)
+				continue
+			}
+		}
+		patterns = p.resolveLookups(set, patterns, state)
+		// patterns restricted to some fields or to values leave keys alone
+		if paths == nil && !set.valuesOnly {
+			renames = append(renames, transform.Excluding(set.excludeStrings, func(key string) string { return applyLiteral(key, patterns, options) }))
+		}
+		stage := set.stageRank(pipeline)
+		rewrites[stage] = append(rewrites[stage], setStep(set, &transform.Literal{
+			Patterns: patterns,
+			OnHit: func(pattern string, count int) {
+				effects.add(func() {
+					hits += count
+					if state.report != nil {
+						state.report.recordHit(pattern, kind, bucket, count)
+						if set.recordsApplied(pattern, paths, excluded) {
+							state.report.recordApplied(pattern, patterns[pattern])
+						}
+					}
+				})
+			},
+			Protected:  append(protected, lastAppliedPath),
+			Paths:      paths,
+			Excluded:   set.excludeStrings,
+			ValuesOnly: set.valuesOnly,
+			Options:    options,
+		}))
+		// hits in the embedded copy of the item are not counted twice
+		embedded = append(embedded, &transform.Literal{Patterns: patterns, Protected: protected, Paths: paths, Excluded: set.excludeStrings, ValuesOnly: set.valuesOnly, Options: options})
+	}
+	steps := conversions
+	for stage := range rewrites {
+		steps = append(append(steps, rewrites[stage]...), others[stage]...)
+	}
+	steps = append(steps,
+		builtinStep(stepLastApplied, lastAppliedTransformer(embedded, p.setting, p.logger)),
+		builtinStep(stepFieldRefs, &transform.FieldRefs{
+			Original: item,
+			RenameKey: func(key string) string {
+				if p.isProtectedKey(key) {
+					return key
+				}
+				for _, rename := range renames {
+					key = rename(key)
+				}
+				return key
+			},
+		}),
+		builtinStep(stepGatewayRefs, gatewayRefs(input, state.report)),
+	)
+
+	if freeze := p.freezeTransformer(input.Restore); freeze != nil {
+		steps = append(steps, builtinStep(stepFreeze, freeze))
+	}
+
+	// stamped last so that rules never rewrite the original identity
+	if origin := originTransformer(input, clusterScoped, p.setting); origin != nil && !p.skipOrigin {
+		steps = append(steps, builtinStep(stepOrigin, origin))
+	}
+
+	// chain-order ConfigMaps rearrange the steps for the kind of the item
+	steps = p.arrangeChain(applicable, kind, steps)
+	transformers := make([]transform.Transformer, 0, len(steps))
+	keys := make([]string, 0, len(steps))
+	for _, step := range steps {
+		transformers = append(transformers, step.transformer)
+		keys = append(keys, step.String())
+	}
+
+	failed := &failures{}
+	chain := &transform.Chain{
+		Transformers: transformers,
+		Keys:         keys,
+		Breaker:      state.breaker,
+		MaxLatency:   p.limits.maxTransformLatency,
+		Logger:       p.logger,
+		OnFailure:    failed.add,
+	}
+	output, err := chain.RunWithin(item, p.limits.itemTimeout)
 	if err != nil {
-		return nil, err
+		effects.discard()
+		p.record(input, applicable, append(failed.list(), err.Error()))
+		if errors.Is(err, transform.ErrTimeout) {
+			return p.onTimeout(input, state, clusterScoped)
+		}
+		return nil, fmt.Errorf("failed to transform %s %s/%s: %v", item.GetKind(), item.GetNamespace(), item.GetName(), err)
+	}
+	effects.apply()
+	if errs := failed.list(); len(errs) > 0 {
+		p.record(input, applicable, errs)
+	}
+	if logger != quietLogger && debugEnabled(logger) {
+		for _, change := range diffItems(item.Object, output.Object) {
+			logger.Debugf("%s %s/%s: %s", item.GetKind(), item.GetNamespace(), item.GetName(), change)
+		}
 	}
 
-	modifiedString := string(jsonData)
-	for pattern, replacement := range patterns {
-		modifiedString = strings.ReplaceAll(modifiedString, pattern, replacement)
+	for _, policy := range policies {
+		reasons, err := policy.Denied(output)
+		if err != nil {
+			// policies fail closed
+			reasons = []string{err.Error()}
+		}
+		if len(reasons) > 0 && policy.Critical {
+			p.abortRestore(state, item, fmt.Sprintf("policy %s denies its changes: %s", policy.ID, strings.Join(reasons, "; ")))
+			if state.report != nil {
+				state.report.recordItem(false, clusterScoped)
+				p.scheduleReportFlush(state.report)
+			}
+			return velero.NewRestoreItemActionExecuteOutput(input.Item).WithoutRestore(), nil
+		}
+		if len(reasons) > 0 {
+			p.logger.Warnf("Restoring %s %s/%s untouched: policy %s denies its changes: %s", item.GetKind(), item.GetNamespace(), item.GetName(), policy.ID, strings.Join(reasons, "; "))
+			if state.report != nil {
+				state.report.recordItem(false, clusterScoped)
+				state.report.recordDenied()
+				p.scheduleReportFlush(state.report)
+			}
+			return velero.NewRestoreItemActionExecuteOutput(input.Item), nil
+		}
 	}
 
-	// Create a new item from the modified JSON data
-	var modifiedObj unstructured.Unstructured
-	if err := json.Unmarshal([]byte(modifiedString), &modifiedObj); err != nil {
-		return nil, err
+	if policy := p.guardVeleroItem(input, item, output, state); policy != veleroResourcesWarn {
+		if state.report != nil {
+			state.report.recordItem(false, clusterScoped)
+			p.scheduleReportFlush(state.report)
+		}
+		if policy == veleroResourcesCritical {
+			return velero.NewRestoreItemActionExecuteOutput(input.Item).WithoutRestore(), nil
+		}
+		return velero.NewRestoreItemActionExecuteOutput(input.Item), nil
+	}
+
+	if p.versions != nil {
+		served, err := p.versions.check(output)
+		if err != nil {
+			p.logger.Warnf("Skipping %s %s/%s: %v", output.GetKind(), output.GetNamespace(), output.GetName(), err)
+			if state.report != nil {
+				state.report.recordItem(false, clusterScoped)
+				state.report.recordUnservedVersion()
+				p.scheduleReportFlush(state.report)
+			}
+			return velero.NewRestoreItemActionExecuteOutput(output).WithoutRestore(), nil
+		}
+		if served != output {
+			p.logger.Infof("Restoring %s %s/%s as %s: the cluster does not serve %s", output.GetKind(), output.GetNamespace(), output.GetName(), served.GetAPIVersion(), output.GetAPIVersion())
+			output = served
+		}
+	}
+
+	p.checkHostnames(item, output, state.report)
+
+	skip := differentialEnabled(input.Restore) && p.identicalToLive(output, state)
+	if skip {
+		logger.Infof("Skipping %s %s/%s: identical to the live object", output.GetKind(), output.GetNamespace(), output.GetName())
+	}
+
+	if state.report != nil {
+		state.report.recordItem(hits > 0, clusterScoped)
+		state.report.recordRename(originalItem(input), output)
+		if skip {
+			state.report.recordSkippedIdentical()
+		}
+		p.scheduleReportFlush(state.report)
+	}
+	if skip {
+		return velero.NewRestoreItemActionExecuteOutput(output).WithoutRestore(), nil
+	}
+	return velero.NewRestoreItemActionExecuteOutput(output), nil
+}
+
+// applicableSets returns the sets applying to the item: matching its scope and
+// the Restore's target cluster, in a stage of its pipeline, and selected by
+// the Restore selector they refer to.
+func (p *RestorePlugin) applicableSets(sets []ruleSet, item *unstructured.Unstructured, restore *velerov1.Restore, clusterScoped bool) []ruleSet {
+	pipeline := p.pipeline(restore)
+	applicable := make([]ruleSet, 0, len(sets))
+	for _, set := range sets {
+		if !set.appliesTo(clusterScoped) || !set.targetsCluster(restore) || set.stageRank(pipeline) < 0 {
+			continue
+		}
+		if err := set.loadErr(); err != nil {
+			p.logger.Warnf("Ignoring ConfigMap %s: %v", set.name, err)
+			continue
+		}
+		selected, err := set.selectsItem(item, restore)
+		if err != nil {
+			p.logger.Warnf("Ignoring ConfigMap %s: %v", set.name, err)
+			continue
+		}
+		if selected {
+			selected, err = set.matchesCondition(item)
+		}
+		if selected && err == nil {
+			set, err = set.gatePatterns(item)
+		}
+		if selected && err == nil {
+			_, err = set.parseMatchOptions()
+		}
+		if err != nil {
+			p.logger.Warnf("Ignoring ConfigMap %s: %v", set.name, err)
+			continue
+		}
+		if selected {
+			applicable = append(applicable, set)
+		}
+	}
+	// by priority within a stage
+	sort.SliceStable(applicable, func(i, j int) bool { return applicable[i].stageRank(pipeline) < applicable[j].stageRank(pipeline) })
+	return applicable
+}
+
+// onTimeout applies the timeout policy to an item whose transformation was
+// aborted by the watchdog.
+func (p *RestorePlugin) onTimeout(input *velero.RestoreItemActionExecuteInput, state *restoreState, clusterScoped bool) (*velero.RestoreItemActionExecuteOutput, error) {
+	if state.report != nil {
+		state.report.recordItem(false, clusterScoped)
+		state.report.recordTimedOut()
+		p.flushReportNow(state.report)
+	}
+
+	item := &unstructured.Unstructured{Object: input.Item.UnstructuredContent()}
+	switch p.limits.timeoutPolicy {
+	case timeoutSkip:
+		p.logger.Errorf("Transformation of %s %s/%s timed out after %v: skipping the item", item.GetKind(), item.GetNamespace(), item.GetName(), p.limits.itemTimeout)
+		return velero.NewRestoreItemActionExecuteOutput(input.Item).WithoutRestore(), nil
+	case timeoutFail:
+		return nil, fmt.Errorf("transformation of %s %s/%s timed out after %v", item.GetKind(), item.GetNamespace(), item.GetName(), p.limits.itemTimeout)
+	default:
+		p.logger.Errorf("Transformation of %s %s/%s timed out after %v: restoring the item untouched", item.GetKind(), item.GetNamespace(), item.GetName(), p.limits.itemTimeout)
+		return velero.NewRestoreItemActionExecuteOutput(input.Item), nil
 	}
-	return velero.NewRestoreItemActionExecuteOutput(&modifiedObj), nil
 }
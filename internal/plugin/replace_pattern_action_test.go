@@ -2,6 +2,7 @@ package plugin
 
 import (
 	"encoding/json"
+	"fmt"
 	"os"
 	"strings"
 	"testing"
@@ -96,3 +97,37 @@ func TestRestorePlugin_Execute(t *testing.T) {
 	t.Log(string(yamlFile))
 	t.Log(string(yamlData))
 }
+
+// BenchmarkReplacePatternAction_LargeItem profiles a restore of a very large
+// item. Run with `make bench` to get allocation figures and a memory profile.
+func BenchmarkReplacePatternAction_LargeItem(b *testing.B) {
+	data := make(map[string]interface{})
+	for i := 0; i < 2000; i++ {
+		data[fmt.Sprintf("key-%d", i)] = strings.Repeat("logs.foo-production.example.com ", 100)
+	}
+	item := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "ConfigMap",
+		"metadata": map[string]interface{}{
+			"name": "foo-production-config",
+		},
+		"data": data,
+	}}
+
+	plugin := &RestorePlugin{logger: logrus.New()}
+	plugin.logger.(*logrus.Logger).SetLevel(logrus.WarnLevel)
+	patterns := map[string]string{
+		pattern1: replacement1,
+		pattern2: replacement2,
+		pattern3: replacement3,
+	}
+	input := &velero.RestoreItemActionExecuteInput{Item: item}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := replacePatternAction(plugin, input, []ruleSet{{patterns: patterns}}); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,528 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+const (
+	// reportLabel marks the summary report ConfigMaps, its value is the restore name
+	reportLabel = "agoracalyce.io/replace-pattern-report"
+
+	// reportRestoreUIDAnnotation on the report records the UID of its restore:
+	// a plugin restarted in the middle of the restore resumes the report, not
+	// the one left by an earlier restore of the same name
+	reportRestoreUIDAnnotation = "agoracalyce.io/restore-uid"
+
+	reportSummaryKey = "summary.json"
+	reportHeatmapKey = "heatmap.json"
+	reportAppliedKey = "applied.json"
+
+	defaultReportFlushInterval = 5 * time.Second
+
+	// clusterScopeBucket stands for the namespace of cluster-scoped items in
+	// the heatmap. It cannot collide with a namespace name.
+	clusterScopeBucket = "(cluster)"
+)
+
+// heatmapCell is one row of the heatmap dataset. Rows are flat so they can be
+// loaded as-is by Grafana's JSON/Infinity data sources.
+type heatmapCell struct {
+	Restore   string `json:"restore"`
+	Rule      string `json:"rule"`
+	Kind      string `json:"kind"`
+	Namespace string `json:"namespace"`
+	Hits      int    `json:"hits"`
+}
+
+type heatmapKey struct {
+	rule, kind, namespace string
+}
+
+// reportSummary holds the totals of a restore.
+type reportSummary struct {
+	Restore        string `json:"restore"`
+	ItemsProcessed int    `json:"itemsProcessed"`
+	ItemsModified  int    `json:"itemsModified"`
+	// ItemsClusterScoped counts the processed items that are cluster-scoped
+	ItemsClusterScoped int `json:"itemsClusterScoped"`
+	// ItemsSkippedIdentical counts the items skipped by the differential mode
+	ItemsSkippedIdentical int `json:"itemsSkippedIdentical"`
+	// ItemsExcluded counts the items excluded from restore by the rule sets
+	ItemsExcluded int `json:"itemsExcluded"`
+	// ItemsTimedOut counts the items whose transformation was aborted
+	ItemsTimedOut int `json:"itemsTimedOut"`
+	// ItemsUnservedVersion counts the items skipped because the cluster does
+	// not serve their version
+	ItemsUnservedVersion int `json:"itemsUnservedVersion"`
+	// ItemsDenied counts the items restored untouched because a policy
+	// denied their changes
+	ItemsDenied int `json:"itemsDenied"`
+	// ItemsVelero counts the items of Velero the rules changed, restored
+	// untouched with the block policy
+	ItemsVelero int `json:"itemsVelero"`
+	// ItemsAborted counts the items not restored once a critical policy
+	// aborted the restore, Aborted tells why
+	ItemsAborted int           `json:"itemsAborted,omitempty"`
+	Aborted      *restoreAbort `json:"aborted,omitempty"`
+	Hits         int           `json:"hits"`
+	// RulesHash is the hash of the rule ConfigMaps, to pin them in later
+	// restores
+	RulesHash string `json:"rulesHash,omitempty"`
+	// DryRun is set when the items were restored unmodified, DiffsDropped
+	// counts the changes left out of the diffs document
+	DryRun       bool `json:"dryRun,omitempty"`
+	DiffsDropped int  `json:"diffsDropped,omitempty"`
+	// APICalls counts the API calls of the transforms, APICallsQueued the
+	// ones that waited for the API limits, and how long in total and at most
+	APICalls                int   `json:"apiCalls,omitempty"`
+	APICallsQueued          int   `json:"apiCallsQueued,omitempty"`
+	APIQueueMilliseconds    int64 `json:"apiQueueMilliseconds,omitempty"`
+	APIMaxQueueMilliseconds int64 `json:"apiMaxQueueMilliseconds,omitempty"`
+}
+
+// restoreReport accumulates what the plugin did during a restore. It is
+// written to a ConfigMap named after the restore in the velero namespace.
+type restoreReport struct {
+	mu           sync.Mutex
+	uid          types.UID
+	summary      reportSummary
+	heatmap      map[heatmapKey]int
+	flushPending bool
+	lastFlush    time.Time
+	// flushMu keeps the writes of the report from overlapping
+	flushMu sync.Mutex
+
+	// applied maps the patterns that matched at least once to their
+	// replacement, renames is the rename registry
+	applied map[string]string
+	renames []rename
+	// migration is the migration the restore is part of, whose earlier
+	// restores left the inherited renames
+	migration string
+	inherited []rename
+	// dns holds the last lookup of each rewritten hostname
+	dns map[string]dnsResult
+	// dependencies holds the items depending on others, by kind, namespace
+	// and name
+	dependencies map[string]dependency
+	// diffs holds the changes of a dry run, by kind, namespace and name
+	diffs map[string]itemDiff
+	// store keeps the documents of the report in object storage, nil when
+	// they are kept in the report ConfigMap
+	store *reportStore
+}
+
+func newRestoreReport(restoreName string) *restoreReport {
+	return &restoreReport{
+		summary: reportSummary{Restore: restoreName},
+		heatmap: make(map[heatmapKey]int),
+	}
+}
+
+func (r *restoreReport) recordHit(rule, kind, namespace string, hits int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.heatmap[heatmapKey{rule: rule, kind: kind, namespace: namespace}] += hits
+	r.summary.Hits += hits
+}
+
+func (r *restoreReport) recordItem(modified, clusterScoped bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.summary.ItemsProcessed++
+	if clusterScoped {
+		r.summary.ItemsClusterScoped++
+	}
+	if modified {
+		r.summary.ItemsModified++
+	}
+}
+
+func (r *restoreReport) recordSkippedIdentical() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.summary.ItemsSkippedIdentical++
+}
+
+func (r *restoreReport) recordExcluded() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.summary.ItemsExcluded++
+}
+
+func (r *restoreReport) recordTimedOut() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.summary.ItemsTimedOut++
+}
+
+func (r *restoreReport) recordUnservedVersion() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.summary.ItemsUnservedVersion++
+}
+
+func (r *restoreReport) recordDenied() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.summary.ItemsDenied++
+}
+
+func (r *restoreReport) recordVeleroItem() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.summary.ItemsVelero++
+}
+
+func (r *restoreReport) recordRulesHash(hash string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.summary.RulesHash = hash
+}
+
+// configMapName is the name of the ConfigMap holding the report.
+func (r *restoreReport) configMapName() string {
+	return fmt.Sprintf("%s-replace-pattern-report", r.summary.Restore)
+}
+
+// data renders the report as ConfigMap data.
+func (r *restoreReport) data() (map[string]string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	cells := make([]heatmapCell, 0, len(r.heatmap))
+	for key, hits := range r.heatmap {
+		cells = append(cells, heatmapCell{
+			Restore:   r.summary.Restore,
+			Rule:      key.rule,
+			Kind:      key.kind,
+			Namespace: key.namespace,
+			Hits:      hits,
+		})
+	}
+	sort.Slice(cells, func(i, j int) bool {
+		a, b := cells[i], cells[j]
+		if a.Rule != b.Rule {
+			return a.Rule < b.Rule
+		}
+		if a.Kind != b.Kind {
+			return a.Kind < b.Kind
+		}
+		return a.Namespace < b.Namespace
+	})
+
+	summary, err := json.Marshal(r.summary)
+	if err != nil {
+		return nil, err
+	}
+	heatmap, err := json.Marshal(cells)
+	if err != nil {
+		return nil, err
+	}
+	renames := r.renames
+	if renames == nil {
+		renames = []rename{}
+	}
+	renamesJSON, err := json.Marshal(renames)
+	if err != nil {
+		return nil, err
+	}
+	applied := r.applied
+	if applied == nil {
+		applied = map[string]string{}
+	}
+	appliedJSON, err := json.Marshal(applied)
+	if err != nil {
+		return nil, err
+	}
+
+	lookups := make([]dnsResult, 0, len(r.dns))
+	for _, result := range r.dns {
+		lookups = append(lookups, result)
+	}
+	sort.Slice(lookups, func(i, j int) bool { return lookups[i].Hostname < lookups[j].Hostname })
+	dns, err := json.Marshal(lookups)
+	if err != nil {
+		return nil, err
+	}
+
+	documents := map[string]string{
+		reportSummaryKey: string(summary),
+		reportHeatmapKey: string(heatmap),
+		reportRenamesKey: string(renamesJSON),
+		reportAppliedKey: string(appliedJSON),
+		reportDNSKey:     string(dns),
+	}
+	if len(r.dependencies) > 0 {
+		items := make([]dependency, 0, len(r.dependencies))
+		for _, item := range r.dependencies {
+			items = append(items, item)
+		}
+		sort.Slice(items, func(i, j int) bool { return items[i].key() < items[j].key() })
+		dependencies, err := json.Marshal(items)
+		if err != nil {
+			return nil, err
+		}
+		documents[reportDependenciesKey] = string(dependencies)
+	}
+	if len(r.diffs) > 0 {
+		items := make([]itemDiff, 0, len(r.diffs))
+		for _, item := range r.diffs {
+			items = append(items, item)
+		}
+		sort.Slice(items, func(i, j int) bool { return items[i].key() < items[j].key() })
+		diffs, err := json.Marshal(items)
+		if err != nil {
+			return nil, err
+		}
+		documents[reportDiffsKey] = string(diffs)
+	}
+	return documents, nil
+}
+
+// scheduleReportFlush writes the report at once, then at most once per flush
+// interval: later changes are written when the interval has passed. Velero
+// gives plugins no end-of-restore hook, so the report trails the restore by at
+// most that interval.
+func (p *RestorePlugin) scheduleReportFlush(r *restoreReport) {
+	if p.reportFlushInterval <= 0 || p.readOnly {
+		return
+	}
+
+	r.mu.Lock()
+	if r.flushPending {
+		r.mu.Unlock()
+		return
+	}
+	wait := p.reportFlushInterval - time.Since(r.lastFlush)
+	if wait <= 0 {
+		r.lastFlush = time.Now()
+		r.mu.Unlock()
+		p.writeReport(r)
+		return
+	}
+	r.flushPending = true
+	r.mu.Unlock()
+	time.AfterFunc(wait, func() {
+		r.mu.Lock()
+		r.flushPending = false
+		r.lastFlush = time.Now()
+		r.mu.Unlock()
+		p.writeReport(r)
+	})
+}
+
+// flushReportNow writes the report at once, for the changes of its summary
+// that must not wait for the flush interval: aborts and failures.
+func (p *RestorePlugin) flushReportNow(r *restoreReport) {
+	if p.reportFlushInterval <= 0 || p.readOnly {
+		return
+	}
+	r.mu.Lock()
+	r.lastFlush = time.Now()
+	r.mu.Unlock()
+	p.writeReport(r)
+}
+
+func (p *RestorePlugin) writeReport(r *restoreReport) {
+	if err := p.flushReport(r); err != nil {
+		p.logger.Warnf("Failed to write the summary report: %v", err)
+	}
+}
+
+// flushReport writes the report to its store, or to the report ConfigMap when
+// it has none or the store fails, the state of the migration of the restore
+// and, once rules were applied, the inverse rule set ConfigMap. Dry
+// runs, which change nothing, only write the report, and nothing is written in
+// read-only mode.
+func (p *RestorePlugin) flushReport(r *restoreReport) error {
+	if p.readOnly {
+		return nil
+	}
+	r.flushMu.Lock()
+	defer r.flushMu.Unlock()
+	data, err := r.data()
+	if err != nil {
+		return fmt.Errorf("failed to render report: %v", err)
+	}
+	stored := false
+	if r.store != nil {
+		// the report ConfigMap is only the fallback of the store
+		if err := r.store.save(r.uid, data); err != nil {
+			p.logger.Warnf("Restore %s writes its report to ConfigMap %s: %v", r.summary.Restore, r.configMapName(), err)
+		} else {
+			stored = true
+		}
+	}
+	if !stored {
+		labels := map[string]string{reportLabel: r.summary.Restore}
+		var annotations map[string]string
+		if r.uid != "" {
+			annotations = map[string]string{reportRestoreUIDAnnotation: string(r.uid)}
+		}
+		if err := p.upsertConfigMap(r.configMapName(), labels, annotations, data); err != nil {
+			return err
+		}
+	}
+	if r.summary.DryRun {
+		return nil
+	}
+	if r.migration != "" {
+		if err := p.flushMigration(r); err != nil {
+			return err
+		}
+	}
+
+	reverse, warnings := r.reverseRules()
+	if len(reverse) == 0 {
+		return nil
+	}
+	for _, warning := range warnings {
+		p.logger.Warnf("Inverse rule set of restore %s: %s", r.summary.Restore, warning)
+	}
+	labels := map[string]string{reverseLabel: r.summary.Restore}
+	annotations := map[string]string{reverseOfAnnotation: r.summary.Restore}
+	return p.upsertConfigMap(r.reverseConfigMapName(), labels, annotations, reverse)
+}
+
+// resumeReport seeds the report with the one written for the same restore
+// before the plugin restarted, if any: Velero restarts plugins that crash or
+// time out in the middle of a restore. What was recorded after the last flush
+// is lost.
+func (p *RestorePlugin) resumeReport(r *restoreReport) error {
+	data, uid, err := p.loadReport(r)
+	if err != nil || data == nil {
+		return err
+	}
+	if r.uid == "" || uid != r.uid {
+		return nil
+	}
+
+	var summary reportSummary
+	var cells []heatmapCell
+	var renames []rename
+	var applied map[string]string
+	var lookups []dnsResult
+	var dependencies []dependency
+	var diffs []itemDiff
+	for key, target := range map[string]interface{}{
+		reportSummaryKey:      &summary,
+		reportHeatmapKey:      &cells,
+		reportRenamesKey:      &renames,
+		reportAppliedKey:      &applied,
+		reportDNSKey:          &lookups,
+		reportDependenciesKey: &dependencies,
+		reportDiffsKey:        &diffs,
+	} {
+		if document, ok := data[key]; ok {
+			if err := json.Unmarshal([]byte(document), target); err != nil {
+				return fmt.Errorf("failed to decode %s of the report of restore %s: %v", key, r.summary.Restore, err)
+			}
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	summary.Restore = r.summary.Restore
+	r.summary = summary
+	for _, cell := range cells {
+		r.heatmap[heatmapKey{rule: cell.Rule, kind: cell.Kind, namespace: cell.Namespace}] += cell.Hits
+	}
+	r.renames = append(renames, r.renames...)
+	for pattern, replacement := range applied {
+		if r.applied == nil {
+			r.applied = make(map[string]string, len(applied))
+		}
+		r.applied[pattern] = replacement
+	}
+	for _, lookup := range lookups {
+		if r.dns == nil {
+			r.dns = make(map[string]dnsResult, len(lookups))
+		}
+		r.dns[lookup.Hostname] = lookup
+	}
+	for _, item := range dependencies {
+		if r.dependencies == nil {
+			r.dependencies = make(map[string]dependency, len(dependencies))
+		}
+		r.dependencies[item.key()] = item
+	}
+	for _, item := range diffs {
+		if r.diffs == nil {
+			r.diffs = make(map[string]itemDiff, len(diffs))
+		}
+		r.diffs[item.key()] = item
+	}
+	return nil
+}
+
+// loadReport returns the documents of the report written for the same restore
+// name and the UID of the restore written for, nil when there are none.
+func (p *RestorePlugin) loadReport(r *restoreReport) (map[string]string, types.UID, error) {
+	if r.store != nil {
+		// the report was written to the ConfigMap when the store failed
+		if data, uid, err := r.store.load(); err != nil || data != nil || p.configMapClient == nil {
+			return data, uid, err
+		}
+	}
+	configMap, err := p.configMapClient.Get(context.TODO(), r.configMapName(), metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return nil, "", nil
+	}
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to get configmap %s: %v", r.configMapName(), err)
+	}
+	if configMap.Data == nil {
+		configMap.Data = map[string]string{}
+	}
+	return configMap.Data, types.UID(configMap.Annotations[reportRestoreUIDAnnotation]), nil
+}
+
+// reverseConfigMapName is the name of the ConfigMap holding the inverse rules.
+func (r *restoreReport) reverseConfigMapName() string {
+	return fmt.Sprintf("%s-replace-pattern-reverse", r.summary.Restore)
+}
+
+// upsertConfigMap creates or updates a ConfigMap of the velero namespace.
+func (p *RestorePlugin) upsertConfigMap(name string, labels, annotations, data map[string]string) error {
+	existing, err := p.configMapClient.Get(context.TODO(), name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		_, err = p.configMapClient.Create(context.TODO(), &v1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        name,
+				Labels:      labels,
+				Annotations: annotations,
+			},
+			Data: data,
+		}, metav1.CreateOptions{})
+		if err != nil {
+			return fmt.Errorf("failed to create configmap %s: %v", name, err)
+		}
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get configmap %s: %v", name, err)
+	}
+
+	existing.Data = data
+	for key, value := range annotations {
+		if existing.Annotations == nil {
+			existing.Annotations = make(map[string]string, len(annotations))
+		}
+		existing.Annotations[key] = value
+	}
+	if _, err := p.configMapClient.Update(context.TODO(), existing, metav1.UpdateOptions{}); err != nil {
+		return fmt.Errorf("failed to update configmap %s: %v", name, err)
+	}
+	return nil
+}
@@ -0,0 +1,159 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	velerov1 "github.com/vmware-tanzu/velero/pkg/apis/velero/v1"
+	"github.com/vmware-tanzu/velero/pkg/plugin/velero"
+	"github.com/wrkt/velero-custom-plugins/mocks"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestReplacePatternAction_Report(t *testing.T) {
+	plugin := &RestorePlugin{logger: logrus.New()}
+	restore := &velerov1.Restore{ObjectMeta: metav1.ObjectMeta{Name: "dr-1", UID: "uid-1"}}
+	patterns := map[string]string{pattern1: replacement1, pattern2: replacement2}
+
+	items := []*unstructured.Unstructured{
+		{Object: map[string]interface{}{
+			"kind":     "Ingress",
+			"metadata": map[string]interface{}{"name": "foo", "namespace": "web"},
+			"spec":     map[string]interface{}{"host": "foo.example.com"},
+		}},
+		{Object: map[string]interface{}{
+			"kind":     "Ingress",
+			"metadata": map[string]interface{}{"name": "other", "namespace": "web"},
+			"spec":     map[string]interface{}{"host": "other.example.com"},
+		}},
+		{Object: map[string]interface{}{
+			"kind":     "Service",
+			"metadata": map[string]interface{}{"name": "untouched", "namespace": "web"},
+		}},
+	}
+	for _, item := range items {
+		_, err := replacePatternAction(plugin, &velero.RestoreItemActionExecuteInput{Item: item, Restore: restore}, []ruleSet{{patterns: patterns}})
+		require.NoError(t, err)
+	}
+
+	data, err := plugin.stateFor(restore).report.data()
+	require.NoError(t, err)
+
+	var summary reportSummary
+	require.NoError(t, json.Unmarshal([]byte(data[reportSummaryKey]), &summary))
+	assert.Equal(t, reportSummary{Restore: "dr-1", ItemsProcessed: 3, ItemsModified: 2, Hits: 4}, summary)
+
+	var heatmap []heatmapCell
+	require.NoError(t, json.Unmarshal([]byte(data[reportHeatmapKey]), &heatmap))
+	assert.Equal(t, []heatmapCell{
+		{Restore: "dr-1", Rule: pattern1, Kind: "Ingress", Namespace: "web", Hits: 2},
+		{Restore: "dr-1", Rule: pattern2, Kind: "Ingress", Namespace: "web", Hits: 2},
+	}, heatmap)
+}
+
+func TestFlushReport(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockConfigMapClient := mocks.NewMockConfigMapInterface(ctrl)
+	plugin := &RestorePlugin{logger: logrus.New(), configMapClient: mockConfigMapClient}
+
+	report := newRestoreReport("dr-1")
+	report.recordHit(pattern1, "Ingress", "web", 1)
+	report.recordItem(true, false)
+
+	notFound := apierrors.NewNotFound(schema.GroupResource{Resource: "configmaps"}, "dr-1-replace-pattern-report")
+	mockConfigMapClient.EXPECT().
+		Get(gomock.Any(), "dr-1-replace-pattern-report", gomock.Any()).
+		Return(nil, notFound)
+	mockConfigMapClient.EXPECT().
+		Create(gomock.Any(), gomock.Any(), gomock.Any()).
+		DoAndReturn(func(_ interface{}, cm *corev1.ConfigMap, _ metav1.CreateOptions) (*corev1.ConfigMap, error) {
+			assert.Equal(t, "dr-1", cm.Labels[reportLabel])
+			assert.Contains(t, cm.Data[reportHeatmapKey], `"rule":"example.com"`)
+			return cm, nil
+		})
+	require.NoError(t, plugin.flushReport(report))
+
+	existing := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "dr-1-replace-pattern-report"}}
+	mockConfigMapClient.EXPECT().
+		Get(gomock.Any(), "dr-1-replace-pattern-report", gomock.Any()).
+		Return(existing, nil)
+	mockConfigMapClient.EXPECT().
+		Update(gomock.Any(), existing, gomock.Any()).
+		Return(existing, nil)
+	require.NoError(t, plugin.flushReport(report))
+	assert.Contains(t, existing.Data[reportSummaryKey], `"itemsProcessed":1`)
+}
+
+func TestScheduleReportFlush(t *testing.T) {
+	configMaps := fake.NewSimpleClientset().CoreV1().ConfigMaps("velero")
+	plugin := &RestorePlugin{logger: logrus.New(), configMapClient: configMaps, reportFlushInterval: 50 * time.Millisecond}
+	report := newRestoreReport("dr-1")
+	summary := func() string {
+		cm, err := configMaps.Get(context.TODO(), "dr-1-replace-pattern-report", metav1.GetOptions{})
+		require.NoError(t, err)
+		return cm.Data[reportSummaryKey]
+	}
+
+	// the first change is written at once
+	report.recordItem(true, false)
+	plugin.scheduleReportFlush(report)
+	assert.Contains(t, summary(), `"itemsProcessed":1`)
+
+	// the next ones once the interval has passed
+	report.recordItem(true, false)
+	plugin.scheduleReportFlush(report)
+	report.recordItem(true, false)
+	plugin.scheduleReportFlush(report)
+	assert.Contains(t, summary(), `"itemsProcessed":1`)
+	assert.Eventually(t, func() bool { return strings.Contains(summary(), `"itemsProcessed":3`) }, time.Second, 10*time.Millisecond)
+
+	// failures are written at once
+	report.recordTimedOut()
+	plugin.flushReportNow(report)
+	assert.Contains(t, summary(), `"itemsTimedOut":1`)
+}
+
+func TestResumeReport(t *testing.T) {
+	configMaps := fake.NewSimpleClientset().CoreV1().ConfigMaps("velero")
+	plugin := &RestorePlugin{logger: logrus.New(), configMapClient: configMaps}
+	restore := &velerov1.Restore{ObjectMeta: metav1.ObjectMeta{Name: "dr-1", UID: "uid-1"}}
+
+	report := plugin.stateFor(restore).report
+	report.recordItem(true, false)
+	report.recordHit(pattern1, "Ingress", "web", 2)
+	report.recordApplied(pattern1, replacement1)
+	report.recordRename(item("", "Service", "web", "foo"), item("", "Service", "web", "bar"))
+	report.recordDependencies(dependency{Kind: "Deployment", Namespace: "web", Name: "web", DependsOn: []string{"Secret/db"}})
+	require.NoError(t, plugin.flushReport(report))
+
+	// the plugin restarts in the middle of the restore
+	plugin.states = nil
+	resumed := plugin.stateFor(restore).report
+	resumed.recordItem(false, false)
+	assert.Equal(t, reportSummary{Restore: "dr-1", ItemsProcessed: 2, ItemsModified: 1, Hits: 2}, resumed.summary)
+	assert.Equal(t, map[heatmapKey]int{{rule: pattern1, kind: "Ingress", namespace: "web"}: 2}, resumed.heatmap)
+	assert.Equal(t, map[string]string{pattern1: replacement1}, resumed.applied)
+	namespace, name, ok := resumed.renamed("", "Service", "web", "foo")
+	assert.True(t, ok)
+	assert.Equal(t, []string{"web", "bar"}, []string{namespace, name})
+	assert.Equal(t, []string{"Secret/db"}, resumed.dependencies["Deployment/web/web"].DependsOn)
+
+	// a later restore of the same name starts afresh
+	plugin.states = nil
+	recreated := &velerov1.Restore{ObjectMeta: metav1.ObjectMeta{Name: "dr-1", UID: "uid-2"}}
+	assert.Equal(t, reportSummary{Restore: "dr-1"}, plugin.stateFor(recreated).report.summary)
+}
@@ -0,0 +1,227 @@
+package plugin
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	jsonpatch "github.com/evanphx/json-patch"
+	"github.com/wrkt/velero-custom-plugins/internal/transform"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/yaml"
+)
+
+// transformerResourceModifiers applies the rules of a ConfigMap in the format
+// of Velero's resource modifiers, so that the same rule files serve stock
+// Velero and the plugin. The ConfigMap has a single data key, of any name.
+const transformerResourceModifiers = "resource-modifiers"
+
+// resourceModifiersVersion is the only version of the format.
+const resourceModifiersVersion = "v1"
+
+// resourceModifiers is a resource modifiers document, as Velero reads it.
+type resourceModifiers struct {
+	Version               string                 `json:"version"`
+	ResourceModifierRules []resourceModifierRule `json:"resourceModifierRules"`
+}
+
+type resourceModifierRule struct {
+	Conditions       modifierConditions  `json:"conditions"`
+	Patches          []modifierPatch     `json:"patches,omitempty"`
+	MergePatches     []modifierPatchData `json:"mergePatches,omitempty"`
+	StrategicPatches []modifierPatchData `json:"strategicPatches,omitempty"`
+}
+
+type modifierConditions struct {
+	GroupResource     string                `json:"groupResource"`
+	ResourceNameRegex string                `json:"resourceNameRegex,omitempty"`
+	Namespaces        []string              `json:"namespaces,omitempty"`
+	LabelSelector     *metav1.LabelSelector `json:"labelSelector,omitempty"`
+	Matches           []modifierMatch       `json:"matches,omitempty"`
+}
+
+type modifierMatch struct {
+	Path  string      `json:"path"`
+	Value interface{} `json:"value"`
+}
+
+type modifierPatch struct {
+	Operation string      `json:"operation"`
+	From      string      `json:"from,omitempty"`
+	Path      string      `json:"path"`
+	Value     interface{} `json:"value,omitempty"`
+}
+
+type modifierPatchData struct {
+	PatchData string `json:"patchData"`
+}
+
+// isResourceModifiers reports whether a ConfigMap without transformer
+// annotation holds a resource modifiers document, as the ones Velero reads.
+func isResourceModifiers(configMap v1.ConfigMap) bool {
+	if _, ok := configMap.Annotations[transformerAnnotation]; ok || len(configMap.Data) != 1 {
+		return false
+	}
+	for _, data := range configMap.Data {
+		if !strings.Contains(data, "resourceModifierRules") {
+			return false
+		}
+		var document struct {
+			Version string        `json:"version"`
+			Rules   []interface{} `json:"resourceModifierRules"`
+		}
+		return yaml.Unmarshal([]byte(data), &document) == nil && document.Version != "" && document.Rules != nil
+	}
+	return false
+}
+
+// parseResourceModifiers parses the resource modifiers document of the single
+// data key of config.
+func parseResourceModifiers(config map[string]string) ([]transform.ModifierRule, error) {
+	if len(config) != 1 {
+		return nil, fmt.Errorf("expected a single data key, found %d", len(config))
+	}
+	var document resourceModifiers
+	for key, data := range config {
+		if err := yaml.UnmarshalStrict([]byte(data), &document); err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %v", key, err)
+		}
+	}
+	if document.Version != resourceModifiersVersion {
+		return nil, fmt.Errorf("unsupported version %q: expected %s", document.Version, resourceModifiersVersion)
+	}
+	rules := make([]transform.ModifierRule, 0, len(document.ResourceModifierRules))
+	for i, r := range document.ResourceModifierRules {
+		rule, err := r.compile()
+		if err != nil {
+			return nil, fmt.Errorf("rule %d: %v", i, err)
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+func (r resourceModifierRule) compile() (transform.ModifierRule, error) {
+	conditions := r.Conditions
+	rule := transform.ModifierRule{GroupResource: strings.TrimSpace(conditions.GroupResource), Namespaces: conditions.Namespaces}
+	if rule.GroupResource == "" {
+		return transform.ModifierRule{}, fmt.Errorf("missing groupResource")
+	}
+	if len(r.Patches) == 0 && len(r.MergePatches) == 0 && len(r.StrategicPatches) == 0 {
+		return transform.ModifierRule{}, fmt.Errorf("no patches")
+	}
+	if conditions.ResourceNameRegex != "" {
+		if err := transform.ValidateRegex(conditions.ResourceNameRegex); err != nil {
+			return transform.ModifierRule{}, fmt.Errorf("invalid resourceNameRegex: %v", err)
+		}
+		rule.Name = regexp.MustCompile(conditions.ResourceNameRegex)
+	}
+	if conditions.LabelSelector != nil {
+		selector, err := metav1.LabelSelectorAsSelector(conditions.LabelSelector)
+		if err != nil {
+			return transform.ModifierRule{}, fmt.Errorf("invalid labelSelector: %v", err)
+		}
+		rule.Labels = selector
+	}
+
+	if len(conditions.Matches) > 0 {
+		operations := make([]map[string]interface{}, 0, len(conditions.Matches))
+		for _, match := range conditions.Matches {
+			value, err := modifierValue(match.Value)
+			if err != nil {
+				return transform.ModifierRule{}, fmt.Errorf("invalid value of match %s: %v", match.Path, err)
+			}
+			operations = append(operations, map[string]interface{}{"op": "test", "path": match.Path, "value": value})
+		}
+		// marshalling decoded values cannot fail
+		document, _ := json.Marshal(operations)
+		patch, err := jsonpatch.DecodePatch(document)
+		if err != nil {
+			return transform.ModifierRule{}, fmt.Errorf("invalid matches: %v", err)
+		}
+		rule.Matches = patch
+	}
+
+	if len(r.Patches) > 0 {
+		operations := make([]map[string]interface{}, 0, len(r.Patches))
+		for _, p := range r.Patches {
+			operation := map[string]interface{}{"op": p.Operation, "path": p.Path}
+			if p.From != "" {
+				operation["from"] = p.From
+			}
+			if p.Value != nil {
+				value, err := modifierValue(p.Value)
+				if err != nil {
+					return transform.ModifierRule{}, fmt.Errorf("invalid value of %s %s: %v", p.Operation, p.Path, err)
+				}
+				operation["value"] = value
+			}
+			operations = append(operations, operation)
+		}
+		document, _ := json.Marshal(operations)
+		patch, err := transform.NewJSONPatch(document)
+		if err != nil {
+			return transform.ModifierRule{}, err
+		}
+		rule.Patch = patch
+	}
+
+	for _, p := range r.MergePatches {
+		patch, err := patchObject(p.PatchData)
+		if err != nil {
+			return transform.ModifierRule{}, fmt.Errorf("invalid merge patch: %v", err)
+		}
+		rule.MergePatches = append(rule.MergePatches, patch)
+	}
+	for _, p := range r.StrategicPatches {
+		patch, err := patchObject(p.PatchData)
+		if err != nil {
+			return transform.ModifierRule{}, fmt.Errorf("invalid strategic patch: %v", err)
+		}
+		rule.StrategicPatches = append(rule.StrategicPatches, patch)
+	}
+	return rule, nil
+}
+
+// modifierValue returns the JSON value of a patch value. Velero reads values
+// as strings, holding JSON unless they are plain text: "3" is a number, "true"
+// a boolean, "null" null, and "\"3\"" the string 3. Values written with
+// another YAML type are taken as they are.
+func modifierValue(value interface{}) (json.RawMessage, error) {
+	s, ok := value.(string)
+	if !ok {
+		return json.Marshal(value)
+	}
+	switch {
+	case len(s) >= 2 && strings.HasPrefix(s, `"`) && strings.HasSuffix(s, `"`):
+		return json.Marshal(strings.Trim(s, `"`))
+	case s == "null", strings.EqualFold(s, "true"), strings.EqualFold(s, "false"):
+		return json.RawMessage(strings.ToLower(s)), nil
+	case strings.HasPrefix(s, "{"), strings.HasPrefix(s, "["):
+		if !json.Valid([]byte(s)) {
+			return nil, fmt.Errorf("%q is not valid JSON", s)
+		}
+		return json.RawMessage(s), nil
+	}
+	if _, err := strconv.ParseFloat(s, 64); err == nil && json.Valid([]byte(s)) {
+		return json.RawMessage(s), nil
+	}
+	return json.Marshal(s)
+}
+
+// patchObject returns the JSON of a patch written in YAML or JSON, which must
+// be an object.
+func patchObject(data string) ([]byte, error) {
+	patch, err := yaml.YAMLToJSON([]byte(data))
+	if err != nil {
+		return nil, err
+	}
+	var object map[string]interface{}
+	if err := json.Unmarshal(patch, &object); err != nil || object == nil {
+		return nil, fmt.Errorf("the patch is not an object")
+	}
+	return patch, nil
+}
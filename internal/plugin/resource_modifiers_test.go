@@ -0,0 +1,166 @@
+package plugin
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	velerov1 "github.com/vmware-tanzu/velero/pkg/apis/velero/v1"
+	"github.com/vmware-tanzu/velero/pkg/plugin/velero"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// veleroModifiers is a resource modifiers ConfigMap as written for Velero.
+const veleroModifiers = `version: v1
+resourceModifierRules:
+- conditions:
+    groupResource: persistentvolumeclaims
+    resourceNameRegex: "^mysql.*$"
+    namespaces:
+    - shop
+    labelSelector:
+      matchLabels:
+        tier: db
+  patches:
+  - operation: replace
+    path: "/spec/storageClassName"
+    value: "premium"
+  - operation: add
+    path: "/metadata/annotations/replicas"
+    value: "\"3\""
+- conditions:
+    groupResource: deployments.apps
+    matches:
+    - path: "/spec/replicas"
+      value: "3"
+  mergePatches:
+  - patchData: |
+      spec:
+        replicas: 1
+`
+
+func TestModifierValue(t *testing.T) {
+	for value, expected := range map[interface{}]string{
+		"premium":      `"premium"`,
+		`"3"`:          `"3"`,
+		"3":            `3`,
+		"1.5":          `1.5`,
+		"True":         `true`,
+		"null":         `null`,
+		`{"a": 1}`:     `{"a": 1}`,
+		"":             `""`,
+		"0x10":         `"0x10"`,
+		"Infinity":     `"Infinity"`,
+		int64(4):       `4`,
+		false:          `false`,
+		"10.0.0.1/32":  `"10.0.0.1/32"`,
+		"[1, 2]":       `[1, 2]`,
+		"\"quoted\"\"": `"quoted"`,
+	} {
+		got, err := modifierValue(value)
+		require.NoError(t, err, value)
+		assert.Equal(t, expected, string(got), value)
+		assert.True(t, json.Valid(got), value)
+	}
+	_, err := modifierValue("{not json")
+	assert.Error(t, err)
+}
+
+func TestParseResourceModifiers(t *testing.T) {
+	rules, err := parseResourceModifiers(map[string]string{"modifiers.yaml": veleroModifiers})
+	require.NoError(t, err)
+	require.Len(t, rules, 2)
+	assert.Equal(t, "persistentvolumeclaims", rules[0].GroupResource)
+	assert.NotNil(t, rules[0].Patch)
+	assert.Len(t, rules[1].MergePatches, 1)
+	assert.Len(t, rules[1].Matches, 1)
+
+	for name, data := range map[string]string{
+		"version":        "version: v2\nresourceModifierRules: []\n",
+		"unknown field":  "version: v1\nresourceModifierRules:\n- conditions: {groupResource: pods}\n  patch: []\n",
+		"no resource":    "version: v1\nresourceModifierRules:\n- conditions: {}\n  patches: [{operation: remove, path: /spec}]\n",
+		"no patches":     "version: v1\nresourceModifierRules:\n- conditions: {groupResource: pods}\n",
+		"invalid regex":  "version: v1\nresourceModifierRules:\n- conditions: {groupResource: pods, resourceNameRegex: '('}\n  patches: [{operation: remove, path: /spec}]\n",
+		"invalid op":     "version: v1\nresourceModifierRules:\n- conditions: {groupResource: pods}\n  patches: [{operation: delete, path: /spec}]\n",
+		"invalid merge":  "version: v1\nresourceModifierRules:\n- conditions: {groupResource: pods}\n  mergePatches: [{patchData: '[1]'}]\n",
+		"invalid labels": "version: v1\nresourceModifierRules:\n- conditions: {groupResource: pods, labelSelector: {matchExpressions: [{key: a, operator: Near}]}}\n  patches: [{operation: remove, path: /spec}]\n",
+	} {
+		_, err := parseResourceModifiers(map[string]string{"modifiers.yaml": data})
+		assert.Error(t, err, name)
+	}
+	_, err = parseResourceModifiers(map[string]string{"modifiers.yaml": "version: v1\nresourceModifierRules:\n- conditions: {groupResource: pods, resourceNameRegex: '(abcdefghij|klmnopqrst){1,1000}'}\n  patches: [{operation: remove, path: /spec}]\n"})
+	assert.ErrorContains(t, err, "too complex", "names are matched with the limits of regex rules")
+	_, err = parseResourceModifiers(map[string]string{"a": veleroModifiers, "b": veleroModifiers})
+	assert.ErrorContains(t, err, "single data key")
+}
+
+func TestIsResourceModifiers(t *testing.T) {
+	configMap := v1.ConfigMap{Data: map[string]string{"resource-modifiers.yaml": veleroModifiers}}
+	assert.True(t, isResourceModifiers(configMap))
+	assert.Equal(t, transformerResourceModifiers, ruleSetsFrom([]v1.ConfigMap{configMap})[0].transformer, "no annotation is needed")
+
+	rules := v1.ConfigMap{Data: map[string]string{rulesKey: veleroModifiers}}
+	assert.False(t, isStructured(rules), "whatever its key")
+	assert.Len(t, expandRules([]v1.ConfigMap{rules}, logrus.New()), 1)
+
+	assert.False(t, isResourceModifiers(v1.ConfigMap{Data: map[string]string{"resourceModifierRules": "rules"}}), "a pattern like any other")
+	annotated := v1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{transformerAnnotation: transformerJQ}},
+		Data:       map[string]string{jqFilterKey: veleroModifiers},
+	}
+	assert.False(t, isResourceModifiers(annotated))
+}
+
+func TestReplacePatternAction_ResourceModifiers(t *testing.T) {
+	plugin := &RestorePlugin{logger: logrus.New(), resolver: newResourceResolver(nil, logrus.New())}
+	configMaps := []v1.ConfigMap{{
+		ObjectMeta: metav1.ObjectMeta{Name: "modifiers"},
+		Data:       map[string]string{"resource-modifiers.yaml": veleroModifiers},
+	}}
+	restore := &velerov1.Restore{ObjectMeta: metav1.ObjectMeta{Name: "dr-1", UID: "uid-1"}}
+	run := func(item *unstructured.Unstructured) *unstructured.Unstructured {
+		sets := ruleSetsFrom(plugin.configMapsFor(item.GroupVersionKind(), configMaps))
+		output, err := replacePatternAction(plugin, &velero.RestoreItemActionExecuteInput{Item: item, Restore: restore}, sets)
+		require.NoError(t, err)
+		return output.UpdatedItem.(*unstructured.Unstructured)
+	}
+
+	claim := func(name string) *unstructured.Unstructured {
+		return &unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": "v1",
+			"kind":       "PersistentVolumeClaim",
+			"metadata": map[string]interface{}{
+				"name": name, "namespace": "shop",
+				"labels":      map[string]interface{}{"tier": "db"},
+				"annotations": map[string]interface{}{},
+			},
+			"spec": map[string]interface{}{"storageClassName": "standard"},
+		}}
+	}
+	out := run(claim("mysql-0"))
+	class, _, _ := unstructured.NestedString(out.Object, "spec", "storageClassName")
+	assert.Equal(t, "premium", class)
+	assert.Equal(t, "3", out.GetAnnotations()["replicas"])
+	out = run(claim("redis-0"))
+	class, _, _ = unstructured.NestedString(out.Object, "spec", "storageClassName")
+	assert.Equal(t, "standard", class, "the name does not match")
+
+	deployment := func(replicas int64) *unstructured.Unstructured {
+		return &unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": "apps/v1",
+			"kind":       "Deployment",
+			"metadata":   map[string]interface{}{"name": "web", "namespace": "shop"},
+			"spec":       map[string]interface{}{"replicas": replicas},
+		}}
+	}
+	out = run(deployment(3))
+	replicas, _, _ := unstructured.NestedInt64(out.Object, "spec", "replicas")
+	assert.Equal(t, int64(1), replicas)
+	out = run(deployment(5))
+	replicas, _, _ = unstructured.NestedInt64(out.Object, "spec", "replicas")
+	assert.Equal(t, int64(5), replicas, "the match does not hold")
+}
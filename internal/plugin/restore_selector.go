@@ -0,0 +1,73 @@
+package plugin
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+
+	velerov1 "github.com/vmware-tanzu/velero/pkg/apis/velero/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+const (
+	// restoreSelectorAnnotation on a ConfigMap restricts it to the items
+	// selected by one of the selectors of the Restore: `labelSelector`,
+	// `orLabelSelectors[<index>]`, or `any` for any of them.
+	restoreSelectorAnnotation = "agoracalyce.io/restore-selector"
+
+	restoreSelectorLabel = "labelSelector"
+	restoreSelectorAny   = "any"
+)
+
+var orLabelSelectorRef = regexp.MustCompile(`^orLabelSelectors\[(\d+)\]$`)
+
+// selectsItem reports whether the restore selector the set refers to selects
+// the item. Sets without one select every item.
+func (s ruleSet) selectsItem(item *unstructured.Unstructured, restore *velerov1.Restore) (bool, error) {
+	if s.restoreSelector == "" {
+		return true, nil
+	}
+	if restore == nil {
+		return false, nil
+	}
+
+	var selectors []*metav1.LabelSelector
+	switch ref := s.restoreSelector; {
+	case ref == restoreSelectorLabel:
+		// Velero restores everything when the Restore has no selector
+		if restore.Spec.LabelSelector == nil && len(restore.Spec.OrLabelSelectors) == 0 {
+			return true, nil
+		}
+		selectors = []*metav1.LabelSelector{restore.Spec.LabelSelector}
+	case ref == restoreSelectorAny:
+		if restore.Spec.LabelSelector == nil && len(restore.Spec.OrLabelSelectors) == 0 {
+			return true, nil
+		}
+		selectors = append([]*metav1.LabelSelector{restore.Spec.LabelSelector}, restore.Spec.OrLabelSelectors...)
+	case orLabelSelectorRef.MatchString(ref):
+		index, _ := strconv.Atoi(orLabelSelectorRef.FindStringSubmatch(ref)[1])
+		if index >= len(restore.Spec.OrLabelSelectors) {
+			return false, nil
+		}
+		selectors = []*metav1.LabelSelector{restore.Spec.OrLabelSelectors[index]}
+	default:
+		return false, fmt.Errorf("invalid %s %q, expected %s, %s or orLabelSelectors[<index>]", restoreSelectorAnnotation, ref, restoreSelectorLabel, restoreSelectorAny)
+	}
+
+	itemLabels := labels.Set(item.GetLabels())
+	for _, selector := range selectors {
+		if selector == nil {
+			continue
+		}
+		parsed, err := metav1.LabelSelectorAsSelector(selector)
+		if err != nil {
+			return false, fmt.Errorf("invalid selector %s of restore %s: %v", s.restoreSelector, restore.Name, err)
+		}
+		if parsed.Matches(itemLabels) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,84 @@
+package plugin
+
+import (
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	velerov1 "github.com/vmware-tanzu/velero/pkg/apis/velero/v1"
+	"github.com/vmware-tanzu/velero/pkg/plugin/velero"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestRuleSetSelectsItem(t *testing.T) {
+	frontend := &unstructured.Unstructured{}
+	frontend.SetLabels(map[string]string{"tier": "frontend"})
+	backend := &unstructured.Unstructured{}
+	backend.SetLabels(map[string]string{"tier": "backend"})
+
+	orRestore := &velerov1.Restore{Spec: velerov1.RestoreSpec{OrLabelSelectors: []*metav1.LabelSelector{
+		{MatchLabels: map[string]string{"tier": "frontend"}},
+		{MatchExpressions: []metav1.LabelSelectorRequirement{{Key: "tier", Operator: metav1.LabelSelectorOpIn, Values: []string{"backend"}}}},
+	}}}
+	labelRestore := &velerov1.Restore{Spec: velerov1.RestoreSpec{LabelSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"tier": "backend"}}}}
+	allRestore := &velerov1.Restore{}
+
+	tests := []struct {
+		selector string
+		restore  *velerov1.Restore
+		item     *unstructured.Unstructured
+		selected bool
+	}{
+		{selector: "", restore: nil, item: frontend, selected: true},
+		{selector: restoreSelectorAny, restore: nil, item: frontend},
+		{selector: "orLabelSelectors[0]", restore: orRestore, item: frontend, selected: true},
+		{selector: "orLabelSelectors[0]", restore: orRestore, item: backend},
+		{selector: "orLabelSelectors[1]", restore: orRestore, item: backend, selected: true},
+		{selector: "orLabelSelectors[2]", restore: orRestore, item: backend},
+		{selector: restoreSelectorAny, restore: orRestore, item: backend, selected: true},
+		{selector: restoreSelectorLabel, restore: orRestore, item: backend},
+		{selector: restoreSelectorLabel, restore: labelRestore, item: backend, selected: true},
+		{selector: restoreSelectorLabel, restore: labelRestore, item: frontend},
+		{selector: restoreSelectorAny, restore: labelRestore, item: backend, selected: true},
+		{selector: restoreSelectorLabel, restore: allRestore, item: frontend, selected: true},
+		{selector: restoreSelectorAny, restore: allRestore, item: frontend, selected: true},
+	}
+	for _, tt := range tests {
+		selected, err := ruleSet{restoreSelector: tt.selector}.selectsItem(tt.item, tt.restore)
+		require.NoError(t, err)
+		assert.Equal(t, tt.selected, selected, "%s on %v", tt.selector, tt.item.GetLabels())
+	}
+
+	_, err := ruleSet{restoreSelector: "orLabelSelectors[x]"}.selectsItem(frontend, orRestore)
+	assert.Error(t, err)
+}
+
+func TestReplacePatternAction_RestoreSelector(t *testing.T) {
+	t.Setenv(stampOriginEnv, "false")
+	plugin := &RestorePlugin{logger: logrus.New()}
+	restore := &velerov1.Restore{Spec: velerov1.RestoreSpec{OrLabelSelectors: []*metav1.LabelSelector{
+		{MatchLabels: map[string]string{"app": "web"}},
+		{MatchLabels: map[string]string{"app": "db"}},
+	}}}
+	sets := []ruleSet{
+		{name: "web", restoreSelector: "orLabelSelectors[0]", patterns: map[string]string{"example.com": "web.replaced.com"}},
+		{name: "db", restoreSelector: "orLabelSelectors[1]", patterns: map[string]string{"example.com": "db.replaced.com"}},
+	}
+
+	for app, expected := range map[string]string{"web": "web.replaced.com", "db": "db.replaced.com"} {
+		item := &unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": "v1",
+			"kind":       "ConfigMap",
+			"data":       map[string]interface{}{"host": "example.com"},
+		}}
+		item.SetName(app)
+		item.SetNamespace("default")
+		item.SetLabels(map[string]string{"app": app})
+
+		output, err := replacePatternAction(plugin, &velero.RestoreItemActionExecuteInput{Item: item, Restore: restore}, sets)
+		require.NoError(t, err)
+		assert.Equal(t, expected, lookupPath(t, output.UpdatedItem.UnstructuredContent(), "data.host"))
+	}
+}
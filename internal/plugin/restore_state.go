@@ -0,0 +1,113 @@
+package plugin
+
+import (
+	"sync"
+
+	velerov1 "github.com/vmware-tanzu/velero/pkg/apis/velero/v1"
+	"github.com/wrkt/velero-custom-plugins/internal/transform"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// restoreState is what the plugin keeps about a restore between two items.
+type restoreState struct {
+	breaker *transform.Breaker
+	// report is nil when the restore is unknown (local mode)
+	report *restoreReport
+	// dryRun restores the items unmodified
+	dryRun bool
+
+	// nodePorts holds the node ports in use in the target cluster and the ones
+	// claimed by restored Services, loaded on first use
+	nodePortsMu sync.Mutex
+	nodePorts   map[int64]string
+
+	// nodes holds the schedulable nodes of the target cluster, loaded on
+	// first use
+	nodesMu sync.Mutex
+	nodes   []v1.Node
+
+	// version is the Kubernetes version of the target cluster, loaded on
+	// first use
+	versionMu sync.Mutex
+	version   string
+
+	// lookups holds the values of the lookup replacements, read on first use
+	lookupsMu sync.Mutex
+	lookups   map[string]lookupResult
+
+	// aborted is set once a critical policy is violated: no later item is
+	// restored
+	abortMu sync.Mutex
+	aborted *restoreAbort
+}
+
+// stateFor returns the state of the given restore, creating it on first use.
+// The state is built outside of statesMu, as it reads the report of the
+// restore from the API server or object storage: the items of other restores
+// do not wait for it. When two items of a restore race, the state of the
+// first one inserted is kept.
+func (p *RestorePlugin) stateFor(restore *velerov1.Restore) *restoreState {
+	var uid types.UID
+	if restore != nil {
+		uid = restore.UID
+	}
+
+	p.statesMu.Lock()
+	state, ok := p.states[uid]
+	p.statesMu.Unlock()
+	if ok {
+		return state
+	}
+
+	built := p.newRestoreState(restore)
+	p.statesMu.Lock()
+	defer p.statesMu.Unlock()
+	if state, ok := p.states[uid]; ok {
+		return state
+	}
+	if p.states == nil {
+		p.states = make(map[types.UID]*restoreState)
+	}
+	p.states[uid] = built
+	return built
+}
+
+// newRestoreState builds the state of a restore, resuming its report.
+func (p *RestorePlugin) newRestoreState(restore *velerov1.Restore) *restoreState {
+	state := &restoreState{
+		breaker: transform.NewBreaker(p.limits.breakerThreshold),
+		dryRun:  p.isDryRun(restore),
+	}
+	if restore == nil {
+		return state
+	}
+	state.report = newRestoreReport(restore.Name)
+	state.report.uid = restore.UID
+	if p.reportStores != nil {
+		store, err := p.reportStores.open(restore)
+		if err != nil {
+			p.logger.Warnf("Restore %s keeps its state in ConfigMaps: %v", restore.Name, err)
+		} else {
+			p.logger.Infof("Restore %s keeps its state in %s", restore.Name, store.url())
+		}
+		state.report.store = store
+	}
+	// without a client, as in tests, there is nothing to resume
+	if p.configMapClient != nil || state.report.store != nil {
+		if err := p.resumeReport(state.report); err != nil {
+			p.logger.Warnf("Restore %s restarts its summary report from scratch: %v", restore.Name, err)
+		}
+	}
+	// set after resuming, which replaces the summary
+	state.report.summary.DryRun = state.dryRun
+	if !state.dryRun {
+		state.aborted = state.report.summary.Aborted
+	}
+	if state.report.migration = p.migrationID(restore); state.report.migration != "" {
+		if err := p.loadMigration(state.report); err != nil {
+			p.logger.Warnf("Restore %s does not see the renames of the earlier restores of its migration: %v", restore.Name, err)
+		}
+	}
+	return state
+}
@@ -0,0 +1,149 @@
+package plugin
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/wrkt/velero-custom-plugins/internal/transform"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+const (
+	// reverseLabel marks the inverse rule set ConfigMaps, its value is the
+	// restore name. It is deliberately not the pattern label: the inverse rules
+	// are meant for the fail-back restore on the primary cluster, not for this
+	// one.
+	reverseLabel = "agoracalyce.io/replace-pattern-reverse"
+
+	// reverseOfAnnotation on the inverse rule set names the restore it undoes
+	reverseOfAnnotation = "agoracalyce.io/reverse-of-restore"
+
+	reportRenamesKey = "renames.json"
+)
+
+// rename is an entry of the rename registry: an item whose name or namespace
+// differs from the one it had in the backup.
+type rename struct {
+	Group        string `json:"group"`
+	Kind         string `json:"kind"`
+	OldNamespace string `json:"oldNamespace,omitempty"`
+	OldName      string `json:"oldName"`
+	NewNamespace string `json:"newNamespace,omitempty"`
+	NewName      string `json:"newName"`
+}
+
+// recordsApplied tells whether the hits of pattern are recorded for the
+// inverse rule set: only literal patterns replacing the same string
+// everywhere in the item can be undone by swapping them. paths holds the
+// sections of the plugin for the sets without their own. Sets restricted to
+// some restores, clusters or scopes are left out too, the fail-back restore
+// applying the inverse rules to every item, and so are the lookups, whose
+// replacement belongs to the target cluster.
+func (s ruleSet) recordsApplied(pattern string, paths []transform.FieldPath, excluded [][]string) bool {
+	return paths == nil && !s.valuesOnly && excluded == nil && s.excludeStrings == nil &&
+		!s.templates && s.condition == "" && !s.isGated(pattern) && !s.hasMatchOptions(pattern) &&
+		s.restoreSelector == "" && s.clusters == nil && (s.scope == "" || s.scope == scopeAll) &&
+		!isLookup(s.patterns[pattern])
+}
+
+// recordApplied remembers that pattern was replaced by replacement at least
+// once during the restore.
+func (r *restoreReport) recordApplied(pattern, replacement string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.applied == nil {
+		r.applied = make(map[string]string)
+	}
+	r.applied[pattern] = replacement
+}
+
+// recordRename adds the item to the rename registry when its identity changed.
+func (r *restoreReport) recordRename(original, restored *unstructured.Unstructured) {
+	if original.GetName() == restored.GetName() && original.GetNamespace() == restored.GetNamespace() {
+		return
+	}
+
+	gvk := restored.GroupVersionKind()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.renames = append(r.renames, rename{
+		Group:        gvk.Group,
+		Kind:         gvk.Kind,
+		OldNamespace: original.GetNamespace(),
+		OldName:      original.GetName(),
+		NewNamespace: restored.GetNamespace(),
+		NewName:      restored.GetName(),
+	})
+}
+
+// renamed returns the namespace and name an item restored before was renamed
+// to, from its identity in the backup, by this restore or an earlier restore
+// of its migration.
+func (r *restoreReport) renamed(group, kind, namespace, name string) (string, string, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, renames := range [][]rename{r.renames, r.inherited} {
+		for _, rn := range renames {
+			if rn.Group == group && rn.Kind == kind && rn.OldNamespace == namespace && rn.OldName == name {
+				return rn.NewNamespace, rn.NewName, true
+			}
+		}
+	}
+	return "", "", false
+}
+
+// reverseRules derives the inverse rule set: replacement -> pattern for every
+// applied rule, plus new -> old names for the renames the inverse rules alone
+// would not undo. Rules that cannot be inverted are returned as warnings.
+func (r *restoreReport) reverseRules() (map[string]string, []string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	reverse := make(map[string]string)
+	var warnings []string
+
+	patterns := make([]string, 0, len(r.applied))
+	for pattern := range r.applied {
+		patterns = append(patterns, pattern)
+	}
+	sort.Strings(patterns)
+
+	for _, pattern := range patterns {
+		replacement := r.applied[pattern]
+		if existing, ok := reverse[replacement]; ok {
+			warnings = append(warnings, fmt.Sprintf("both %q and %q were replaced by %q: cannot invert %q", existing, pattern, replacement, pattern))
+			continue
+		}
+		if errs := validation.IsConfigMapKey(replacement); len(errs) > 0 {
+			warnings = append(warnings, fmt.Sprintf("replacement %q of %q is not a valid ConfigMap key: %s", replacement, pattern, strings.Join(errs, ", ")))
+			continue
+		}
+		reverse[replacement] = pattern
+	}
+
+	for _, rn := range r.renames {
+		for _, pair := range [][2]string{{rn.NewName, rn.OldName}, {rn.NewNamespace, rn.OldNamespace}} {
+			newValue, oldValue := pair[0], pair[1]
+			if newValue == oldValue || applyLiteral(newValue, reverse, nil) == oldValue {
+				continue
+			}
+			if _, ok := reverse[newValue]; ok || len(validation.IsConfigMapKey(newValue)) > 0 {
+				warnings = append(warnings, fmt.Sprintf("cannot add an inverse rule for the rename of %s %q to %q", rn.Kind, oldValue, newValue))
+				continue
+			}
+			reverse[newValue] = oldValue
+		}
+	}
+
+	return reverse, warnings
+}
+
+// applyLiteral applies literal patterns the way the literal transformer does.
+func applyLiteral(s string, patterns map[string]string, options map[string]transform.MatchOptions) string {
+	for _, pattern := range transform.PatternOrder(patterns) {
+		s, _ = transform.ReplaceLiteral(s, pattern, patterns[pattern], options[pattern])
+	}
+	return s
+}
@@ -0,0 +1,126 @@
+package plugin
+
+import (
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	velerov1 "github.com/vmware-tanzu/velero/pkg/apis/velero/v1"
+	"github.com/vmware-tanzu/velero/pkg/plugin/velero"
+	"github.com/wrkt/velero-custom-plugins/internal/transform"
+	"github.com/wrkt/velero-custom-plugins/mocks"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func TestReverseRules(t *testing.T) {
+	report := newRestoreReport("dr-1")
+	report.recordApplied("production", "review-3")
+	report.recordApplied("example.com", "replaced.com")
+	// not invertible: two patterns share the same replacement
+	report.recordApplied("staging", "review-3")
+	// not invertible: not a valid ConfigMap key
+	report.recordApplied("old-registry", "registry.dr.local/mirror")
+
+	original := &unstructured.Unstructured{}
+	original.SetKind("Service")
+	original.SetName("foo-production")
+	original.SetNamespace("production")
+
+	// explained by the inverse rules
+	restored := original.DeepCopy()
+	restored.SetName("foo-review-3")
+	restored.SetNamespace("review-3")
+	report.recordRename(original, restored)
+
+	// renamed by another action, needs an explicit inverse rule
+	restored = original.DeepCopy()
+	restored.SetName("bar")
+	restored.SetNamespace("review-3")
+	report.recordRename(original, restored)
+
+	// unchanged items are not registered
+	report.recordRename(original, original)
+
+	reverse, warnings := report.reverseRules()
+	assert.Equal(t, map[string]string{
+		"review-3":     "production",
+		"replaced.com": "example.com",
+		"bar":          "foo-production",
+	}, reverse)
+	assert.Len(t, warnings, 2)
+	assert.Len(t, report.renames, 2)
+}
+
+func TestFlushReport_Reverse(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockConfigMapClient := mocks.NewMockConfigMapInterface(ctrl)
+	plugin := &RestorePlugin{logger: logrus.New(), configMapClient: mockConfigMapClient}
+	restore := &velerov1.Restore{ObjectMeta: metav1.ObjectMeta{Name: "dr-1", UID: "uid-1"}}
+
+	item := &unstructured.Unstructured{Object: map[string]interface{}{
+		"kind":     "Service",
+		"metadata": map[string]interface{}{"name": "foo", "namespace": "web"},
+	}}
+	// no report to resume
+	notFound := apierrors.NewNotFound(schema.GroupResource{Resource: "configmaps"}, "")
+	mockConfigMapClient.EXPECT().Get(gomock.Any(), "dr-1-replace-pattern-report", gomock.Any()).Return(nil, notFound)
+	_, err := replacePatternAction(plugin, &velero.RestoreItemActionExecuteInput{Item: item, Restore: restore}, []ruleSet{{patterns: map[string]string{pattern2: replacement2}}})
+	require.NoError(t, err)
+
+	mockConfigMapClient.EXPECT().Get(gomock.Any(), "dr-1-replace-pattern-report", gomock.Any()).Return(nil, notFound)
+	mockConfigMapClient.EXPECT().
+		Create(gomock.Any(), gomock.Any(), gomock.Any()).
+		DoAndReturn(func(_ interface{}, cm *corev1.ConfigMap, _ metav1.CreateOptions) (*corev1.ConfigMap, error) {
+			assert.JSONEq(t, `[{"group":"","kind":"Service","oldNamespace":"web","oldName":"foo","newNamespace":"web","newName":"bar"}]`, cm.Data[reportRenamesKey])
+			return cm, nil
+		})
+	mockConfigMapClient.EXPECT().Get(gomock.Any(), "dr-1-replace-pattern-reverse", gomock.Any()).Return(nil, notFound)
+	mockConfigMapClient.EXPECT().
+		Create(gomock.Any(), gomock.Any(), gomock.Any()).
+		DoAndReturn(func(_ interface{}, cm *corev1.ConfigMap, _ metav1.CreateOptions) (*corev1.ConfigMap, error) {
+			assert.Equal(t, map[string]string{reverseLabel: "dr-1"}, cm.Labels)
+			assert.Equal(t, map[string]string{replacement2: pattern2}, cm.Data)
+			return cm, nil
+		})
+
+	require.NoError(t, plugin.flushReport(plugin.stateFor(restore).report))
+}
+
+func TestRuleSet_RecordsApplied(t *testing.T) {
+	set := ruleSet{patterns: map[string]string{pattern1: replacement1}}
+	assert.True(t, set.recordsApplied(pattern1, nil, nil))
+	assert.False(t, set.recordsApplied(pattern1, []transform.FieldPath{{}}, nil), "restricted to some fields")
+	assert.False(t, set.recordsApplied(pattern1, nil, [][]string{{"spec"}}), "with excluded fields")
+
+	for name, other := range map[string]ruleSet{
+		"values only":      {valuesOnly: true},
+		"templates":        {templates: true},
+		"conditioned":      {condition: "spec.replicas == 1"},
+		"restore selector": {restoreSelector: restoreSelectorLabel},
+		"cluster targets":  {clusters: []string{"dr-east"}},
+		"namespaced scope": {scope: scopeNamespaced},
+		"cluster scope":    {scope: scopeCluster},
+	} {
+		other.patterns = set.patterns
+		assert.False(t, other.recordsApplied(pattern1, nil, nil), name)
+	}
+	assert.True(t, ruleSet{scope: scopeAll, patterns: set.patterns}.recordsApplied(pattern1, nil, nil))
+
+	lookup := ruleSet{patterns: map[string]string{pattern1: "lookup:configmap/velero/cluster-info:apiEndpoint", pattern2: replacement2}}
+	assert.False(t, lookup.recordsApplied(pattern1, nil, nil), "lookup replacement")
+	assert.True(t, lookup.recordsApplied(pattern2, nil, nil))
+
+	// the patterns restricted to the sections of the plugin
+	sectioned := &RestorePlugin{sections: []transform.FieldPath{{{Key: "spec"}}}}
+	paths, err := sectioned.patternPaths(set)
+	require.NoError(t, err)
+	assert.False(t, set.recordsApplied(pattern1, paths, nil), "restricted to sections")
+}
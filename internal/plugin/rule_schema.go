@@ -0,0 +1,184 @@
+package plugin
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"github.com/wrkt/velero-custom-plugins/internal/transform"
+	v1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/yaml"
+)
+
+// rulesKey is the only data key of a structured rule ConfigMap, holding a
+// rulesDocument instead of flat pattern: replacement pairs.
+const rulesKey = "rules.yaml"
+
+const (
+	ruleTypeLiteral = "literal"
+	ruleTypeRegex   = "regex"
+)
+
+// rulesDocument is the structured form of a rule ConfigMap: rules carrying
+// their own options, applied in document order.
+type rulesDocument struct {
+	Rules []rule `json:"rules"`
+}
+
+// rule is a pattern with its options. The options it leaves unset are the
+// ones of the annotations of its ConfigMap.
+type rule struct {
+	// Name identifies the rule in logs and reports, its position by default
+	Name string `json:"name,omitempty"`
+	// Type is literal, the default, or regex
+	Type        string `json:"type,omitempty"`
+	Pattern     string `json:"pattern"`
+	Replacement string `json:"replacement"`
+	// Scope is all, namespaced or cluster, as the scopeAnnotation
+	Scope string `json:"scope,omitempty"`
+	// Kinds are the resources the rule applies to, as the resourcesAnnotation
+	Kinds []string `json:"kinds,omitempty"`
+	// APIVersions are the API groups and versions the rule applies to, as
+	// the apiVersionsAnnotation
+	APIVersions []string `json:"apiVersions,omitempty"`
+	// Paths are the fields the rule is restricted to, as the pathsAnnotation
+	Paths      []string `json:"paths,omitempty"`
+	ValuesOnly *bool    `json:"valuesOnly,omitempty"`
+	Priority   *int     `json:"priority,omitempty"`
+}
+
+// isStructured reports whether a ConfigMap holds a rulesDocument.
+func isStructured(configMap v1.ConfigMap) bool {
+	if _, ok := configMap.Annotations[transformerAnnotation]; ok {
+		return false
+	}
+	_, ok := configMap.Data[rulesKey]
+	return ok && len(configMap.Data) == 1 && !isResourceModifiers(configMap)
+}
+
+// parseRulesDocument parses and validates a rulesDocument.
+func parseRulesDocument(data string) (rulesDocument, error) {
+	var doc rulesDocument
+	if err := yaml.UnmarshalStrict([]byte(data), &doc); err != nil {
+		return rulesDocument{}, fmt.Errorf("failed to parse %s: %v", rulesKey, err)
+	}
+	names := make(map[string]bool, len(doc.Rules))
+	for i := range doc.Rules {
+		r := &doc.Rules[i]
+		if r.Name == "" {
+			r.Name = strconv.Itoa(i + 1)
+		}
+		if err := r.validate(); err != nil {
+			return rulesDocument{}, fmt.Errorf("rule %s: %v", r.Name, err)
+		}
+		if names[r.Name] {
+			return rulesDocument{}, fmt.Errorf("rule %s: duplicate name", r.Name)
+		}
+		names[r.Name] = true
+	}
+	return doc, nil
+}
+
+func (r *rule) validate() error {
+	if r.Pattern == "" {
+		return fmt.Errorf("empty pattern")
+	}
+	if strings.ContainsAny(r.Name, "/,") {
+		return fmt.Errorf("invalid name %q: must not contain / or ,", r.Name)
+	}
+	switch r.Type {
+	case "", ruleTypeLiteral:
+		r.Type = ruleTypeLiteral
+	case ruleTypeRegex:
+		if _, err := transform.NewRegex([]transform.RegexRule{{Expr: r.Pattern, Replacement: r.Replacement}}); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("invalid type %q: must be %s or %s", r.Type, ruleTypeLiteral, ruleTypeRegex)
+	}
+	switch r.Scope {
+	case "", scopeAll, scopeNamespaced, scopeCluster:
+	default:
+		return fmt.Errorf("invalid scope %q: must be %s, %s or %s", r.Scope, scopeAll, scopeNamespaced, scopeCluster)
+	}
+	for _, kind := range r.Kinds {
+		if strings.TrimSpace(kind) == "" || strings.Contains(kind, ",") {
+			return fmt.Errorf("invalid kind %q", kind)
+		}
+	}
+	for _, apiVersion := range r.APIVersions {
+		if strings.Contains(apiVersion, ",") {
+			return fmt.Errorf("invalid API version %q", apiVersion)
+		}
+		if _, err := parseAPIVersionFilter(apiVersion); err != nil {
+			return err
+		}
+	}
+	if len(r.Paths) > 0 {
+		if _, err := transform.ParseFieldPaths(strings.Join(r.Paths, ",")); err != nil {
+			return fmt.Errorf("invalid paths: %v", err)
+		}
+	}
+	return nil
+}
+
+// configMap returns the flat ConfigMap equivalent to the rule of a structured
+// ConfigMap, named <ConfigMap>/<rule>.
+func (r rule) configMap(parent v1.ConfigMap) v1.ConfigMap {
+	configMap := *parent.DeepCopy()
+	configMap.Name = parent.Name + "/" + r.Name
+	if configMap.Annotations == nil {
+		configMap.Annotations = make(map[string]string)
+	}
+	if r.Scope != "" {
+		configMap.Annotations[scopeAnnotation] = r.Scope
+	}
+	if len(r.Kinds) > 0 {
+		configMap.Annotations[resourcesAnnotation] = strings.Join(r.Kinds, ",")
+	}
+	if len(r.APIVersions) > 0 {
+		configMap.Annotations[apiVersionsAnnotation] = strings.Join(r.APIVersions, ",")
+	}
+	if len(r.Paths) > 0 {
+		configMap.Annotations[pathsAnnotation] = strings.Join(r.Paths, ",")
+	}
+	if r.ValuesOnly != nil {
+		configMap.Annotations[valuesOnlyAnnotation] = strconv.FormatBool(*r.ValuesOnly)
+	}
+	if r.Priority != nil {
+		configMap.Annotations[priorityAnnotation] = strconv.Itoa(*r.Priority)
+	}
+	if r.Type == ruleTypeRegex {
+		configMap.Annotations[transformerAnnotation] = transformerRegex
+		// marshalling strings cannot fail
+		patterns, _ := yaml.Marshal([]regexPatternConfig{{Regex: r.Pattern, Replacement: r.Replacement}})
+		configMap.Data = map[string]string{regexPatternsKey: string(patterns)}
+	} else {
+		configMap.Data = map[string]string{r.Pattern: r.Replacement}
+	}
+	return configMap
+}
+
+// expandRules replaces the structured ConfigMaps of configMaps with one flat
+// ConfigMap per rule, in document order, so that rules apply in that order
+// rather than longest first. Invalid structured ConfigMaps are ignored with a
+// warning.
+func expandRules(configMaps []v1.ConfigMap, logger logrus.FieldLogger) []v1.ConfigMap {
+	expanded := make([]v1.ConfigMap, 0, len(configMaps))
+	for _, configMap := range configMaps {
+		if !isStructured(configMap) {
+			expanded = append(expanded, configMap)
+			continue
+		}
+		doc, err := parseRulesDocument(configMap.Data[rulesKey])
+		if err != nil {
+			logger.Warnf("Ignoring ConfigMap %s: %v", configMap.Name, err)
+			continue
+		}
+		for _, r := range doc.Rules {
+			expanded = append(expanded, r.configMap(configMap))
+		}
+	}
+	return expanded
+}
@@ -0,0 +1,118 @@
+package plugin
+
+import (
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	velerov1 "github.com/vmware-tanzu/velero/pkg/apis/velero/v1"
+	"github.com/vmware-tanzu/velero/pkg/plugin/velero"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+const structuredRules = `rules:
+- name: api
+  pattern: example.com
+  replacement: example.org
+- pattern: api.example.org
+  replacement: api.dr.example.net
+- name: buckets
+  type: regex
+  pattern: 'bucket-(.*)-prod'
+  replacement: 'bucket-${1}-dr'
+  kinds: [Deployment]
+  apiVersions: [apps/v1]
+  paths: ['spec.template.spec.containers[*].env[*].value']
+  priority: 10
+`
+
+func TestParseRulesDocument(t *testing.T) {
+	doc, err := parseRulesDocument(structuredRules)
+	require.NoError(t, err)
+	require.Len(t, doc.Rules, 3)
+	assert.Equal(t, "api", doc.Rules[0].Name)
+	assert.Equal(t, "2", doc.Rules[1].Name, "named after their position by default")
+	assert.Equal(t, ruleTypeLiteral, doc.Rules[1].Type)
+	assert.Equal(t, ruleTypeRegex, doc.Rules[2].Type)
+
+	for name, data := range map[string]string{
+		"unknown field":       "rules:\n- pattern: a\n  replacment: b\n",
+		"empty pattern":       "rules:\n- replacement: b\n",
+		"invalid type":        "rules:\n- pattern: a\n  type: glob\n",
+		"invalid regex":       "rules:\n- pattern: '(a'\n  type: regex\n",
+		"invalid scope":       "rules:\n- pattern: a\n  scope: global\n",
+		"invalid paths":       "rules:\n- pattern: a\n  paths: ['spec[']\n",
+		"invalid API version": "rules:\n- pattern: a\n  apiVersions: [apps/latest]\n",
+		"duplicate name":      "rules:\n- name: a\n  pattern: a\n- name: a\n  pattern: b\n",
+		"invalid name":        "rules:\n- name: a/b\n  pattern: a\n",
+	} {
+		_, err := parseRulesDocument(data)
+		assert.Error(t, err, name)
+	}
+}
+
+func TestExpandRules(t *testing.T) {
+	configMaps := []v1.ConfigMap{
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "flat"},
+			Data:       map[string]string{"prod": "dr"},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "hosts", Annotations: map[string]string{scopeAnnotation: scopeNamespaced}},
+			Data:       map[string]string{rulesKey: structuredRules},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "broken"},
+			Data:       map[string]string{rulesKey: "rules: {}"},
+		},
+	}
+	expanded := expandRules(configMaps, logrus.New())
+	require.Len(t, expanded, 4, "the invalid structured ConfigMap is ignored")
+	assert.Equal(t, configMaps[0], expanded[0], "flat ConfigMaps are kept")
+
+	assert.Equal(t, "hosts/api", expanded[1].Name)
+	assert.Equal(t, map[string]string{"example.com": "example.org"}, expanded[1].Data)
+	assert.Equal(t, scopeNamespaced, expanded[1].Annotations[scopeAnnotation], "the annotations of the ConfigMap apply to its rules")
+	assert.Equal(t, "hosts/2", expanded[2].Name)
+
+	regex := expanded[3]
+	assert.Equal(t, transformerRegex, regex.Annotations[transformerAnnotation])
+	assert.Equal(t, "Deployment", regex.Annotations[resourcesAnnotation])
+	assert.Equal(t, "apps/v1", regex.Annotations[apiVersionsAnnotation])
+	assert.Equal(t, "spec.template.spec.containers[*].env[*].value", regex.Annotations[pathsAnnotation])
+	assert.Equal(t, "10", regex.Annotations[priorityAnnotation])
+	rules, err := parseRegexPatterns(regex.Data[regexPatternsKey])
+	require.NoError(t, err)
+	assert.Equal(t, "bucket-(.*)-prod", rules[0].Expr)
+	assert.Equal(t, "bucket-${1}-dr", rules[0].Replacement)
+
+	assert.NotContains(t, configMaps[1].Annotations, transformerAnnotation, "the ConfigMaps are not modified")
+	assert.True(t, isStructured(configMaps[1]))
+	assert.False(t, isStructured(v1.ConfigMap{Data: map[string]string{rulesKey: "", "other": ""}}), "a pattern like any other")
+}
+
+func TestReplacePatternAction_StructuredRules(t *testing.T) {
+	plugin := &RestorePlugin{logger: logrus.New(), resolver: newResourceResolver(nil, logrus.New())}
+	configMaps := expandRules([]v1.ConfigMap{{
+		ObjectMeta: metav1.ObjectMeta{Name: "hosts"},
+		Data:       map[string]string{rulesKey: structuredRules},
+	}}, logrus.New())
+	item := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "ConfigMap",
+		"metadata":   map[string]interface{}{"name": "app", "namespace": "shop"},
+		"data":       map[string]interface{}{"url": "https://api.example.com", "bucket": "bucket-logs-prod"},
+	}}
+	restore := &velerov1.Restore{ObjectMeta: metav1.ObjectMeta{Name: "dr-1", UID: "uid-1"}}
+	sets := ruleSetsFrom(plugin.configMapsFor(schema.GroupVersionKind{Version: "v1", Kind: "ConfigMap"}, configMaps))
+
+	output, err := replacePatternAction(plugin, &velero.RestoreItemActionExecuteInput{Item: item, Restore: restore}, sets)
+	require.NoError(t, err)
+	data, _, _ := unstructured.NestedStringMap(output.UpdatedItem.UnstructuredContent(), "data")
+	assert.Equal(t, "https://api.dr.example.net", data["url"], "the rules apply in document order, not longest first")
+	assert.Equal(t, "bucket-logs-prod", data["bucket"], "the regex rule is restricted to Deployments")
+}
@@ -0,0 +1,228 @@
+package plugin
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/wrkt/velero-custom-plugins/internal/transform"
+	v1 "k8s.io/api/core/v1"
+)
+
+const (
+	// scopeAnnotation restricts a pattern ConfigMap to namespaced or to
+	// cluster-scoped items.
+	scopeAnnotation = "agoracalyce.io/scope"
+
+	// pathsAnnotation restricts the patterns of a ConfigMap to a comma
+	// separated list of fields, as JSONPath expressions such as
+	// spec.template.spec.containers[*].image.
+	pathsAnnotation = "agoracalyce.io/paths"
+
+	// valuesOnlyAnnotation, when true, keeps the patterns of a ConfigMap from
+	// rewriting object keys: only string values are rewritten.
+	valuesOnlyAnnotation = "agoracalyce.io/values-only"
+
+	// priorityAnnotation orders the ConfigMaps: the ones of higher priority
+	// apply first, the ones of equal priority in name order. It defaults to 0.
+	priorityAnnotation = "agoracalyce.io/priority"
+
+	scopeAll        = "all"
+	scopeNamespaced = "namespaced"
+	scopeCluster    = "cluster"
+)
+
+// clusterScopedIdentity is never rewritten on cluster-scoped items by rule sets
+// that are not explicitly scoped to them: those objects are shared by the whole
+// cluster, and rules written for namespaced content (typically namespace
+// renames) would otherwise rename or move them.
+var clusterScopedIdentity = [][]string{
+	{"metadata", "name"},
+	{"metadata", "namespace"},
+}
+
+// updateProtected is never rewritten when the Restore updates existing
+// resources: Velero patches the live object of the same name, so a renamed
+// item would be created next to it instead, and the patch must not fight over
+// the fields managers own.
+var updateProtected = [][]string{
+	{"metadata", "name"},
+	{"metadata", "namespace"},
+	{"metadata", "managedFields"},
+}
+
+// ruleSet groups the patterns, or the transformer configuration, of one
+// ConfigMap with its options.
+type ruleSet struct {
+	name     string
+	patterns map[string]string
+	scope    string
+	// paths is the pathsAnnotation, empty when the patterns apply to the
+	// whole item
+	paths string
+	// valuesOnly leaves object keys alone
+	valuesOnly bool
+
+	// transformer and config are set for the ConfigMaps configuring another
+	// transformer than the literal patterns
+	transformer string
+	config      map[string]string
+
+	excludeLabels      []exclusion
+	excludeAnnotations []exclusion
+	// excludePaths is the excludePathsAnnotation, excludeStrings the
+	// excludeStringsAnnotation
+	excludePaths   string
+	excludeStrings []string
+
+	// restoreSelector names the selector of the Restore the set is restricted to
+	restoreSelector string
+	// clusters lists the target clusters the set is restricted to
+	clusters []string
+	// templates makes the replacements Go templates
+	templates bool
+	// condition is the CEL expression the items must satisfy, empty when the
+	// set applies to every item
+	condition string
+	// patternConditions is the patternConditionsAnnotation, empty when no
+	// pattern has conditions
+	patternConditions string
+	// matchOptions is the matchOptionsAnnotation, empty when every pattern
+	// matches exactly
+	matchOptions string
+	// stage is the stage of the pipeline the set belongs to, empty for the
+	// sets applying before the pipeline
+	stage string
+	// priority orders the sets, priorityErr is set when the annotation is
+	// invalid
+	priority    int
+	priorityErr error
+	// regexErr is set when a pattern of a regex set is invalid
+	regexErr error
+}
+
+// ruleSetsFrom builds one rule set per pattern ConfigMap, by decreasing
+// priority, in list order within a priority.
+func ruleSetsFrom(configMaps []v1.ConfigMap) []ruleSet {
+	sets := make([]ruleSet, 0, len(configMaps))
+	for _, configMap := range configMaps {
+		scope := strings.TrimSpace(configMap.Annotations[scopeAnnotation])
+		if scope == "" {
+			scope = scopeAll
+		}
+		set := ruleSet{
+			name:        configMap.Name,
+			scope:       scope,
+			paths:       strings.TrimSpace(configMap.Annotations[pathsAnnotation]),
+			valuesOnly:  strings.TrimSpace(configMap.Annotations[valuesOnlyAnnotation]) == "true",
+			transformer: strings.TrimSpace(configMap.Annotations[transformerAnnotation]),
+
+			excludeLabels:      parseExclusions(configMap.Annotations[excludeLabelsAnnotation]),
+			excludeAnnotations: parseExclusions(configMap.Annotations[excludeAnnotationsAnnotation]),
+			excludePaths:       strings.TrimSpace(configMap.Annotations[excludePathsAnnotation]),
+			excludeStrings:     parseExcludedStrings(configMap.Annotations[excludeStringsAnnotation]),
+			restoreSelector:    strings.TrimSpace(configMap.Annotations[restoreSelectorAnnotation]),
+			clusters:           parseClusters(configMap.Annotations[clustersAnnotation]),
+			templates:          strings.TrimSpace(configMap.Annotations[templatesAnnotation]) == "true",
+			condition:          strings.TrimSpace(configMap.Annotations[conditionAnnotation]),
+			patternConditions:  strings.TrimSpace(configMap.Annotations[patternConditionsAnnotation]),
+			matchOptions:       strings.TrimSpace(configMap.Annotations[matchOptionsAnnotation]),
+			stage:              strings.TrimSpace(configMap.Annotations[stageAnnotation]),
+		}
+		if value := strings.TrimSpace(configMap.Annotations[priorityAnnotation]); value != "" {
+			if set.priority, set.priorityErr = strconv.Atoi(value); set.priorityErr != nil {
+				set.priorityErr = fmt.Errorf("invalid %s annotation %q: must be an integer", priorityAnnotation, value)
+			}
+		}
+		if set.transformer == "" && isResourceModifiers(configMap) {
+			set.transformer = transformerResourceModifiers
+		}
+		if set.isLiteral() {
+			set.patterns = configMap.Data
+		} else {
+			set.config = configMap.Data
+		}
+		if set.isRegex() {
+			set.regexErr = validateRegexPatterns(set.config[regexPatternsKey])
+		}
+		sets = append(sets, set)
+	}
+	sort.SliceStable(sets, func(i, j int) bool { return sets[i].priority > sets[j].priority })
+	return sets
+}
+
+// validateRegexPatterns checks the expressions of the patterns of a regex set,
+// so that a set with an invalid one is ignored as a whole when loaded rather
+// than failing every item.
+func validateRegexPatterns(data string) error {
+	rules, err := parseRegexPatterns(data)
+	if err != nil {
+		return err
+	}
+	for _, rule := range rules {
+		if rule.Expr == "" {
+			return fmt.Errorf("empty regex")
+		}
+		if err := transform.ValidateRegex(rule.Expr); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// loadErr returns why the set is ignored, nil when it is valid.
+func (s ruleSet) loadErr() error {
+	if s.priorityErr != nil {
+		return s.priorityErr
+	}
+	return s.regexErr
+}
+
+// countRules returns the number of patterns across all sets.
+func countRules(sets []ruleSet) int {
+	rules := 0
+	for _, set := range sets {
+		rules += len(set.patterns)
+	}
+	return rules
+}
+
+// appliesTo reports whether the set applies to an item of the given scope. Sets
+// with an unknown scope apply to nothing.
+func (s ruleSet) appliesTo(clusterScoped bool) bool {
+	switch s.scope {
+	case scopeAll, "":
+		return true
+	case scopeNamespaced:
+		return !clusterScoped
+	case scopeCluster:
+		return clusterScoped
+	default:
+		return false
+	}
+}
+
+// protectedPaths returns the fields of an item the set must not rewrite.
+func (s ruleSet) protectedPaths(clusterScoped, updateExisting bool) [][]string {
+	if updateExisting {
+		return updateProtected
+	}
+	if clusterScoped && s.scope != scopeCluster {
+		return clusterScopedIdentity
+	}
+	return nil
+}
+
+// fieldPaths returns the fields the patterns of the set are restricted to, nil
+// when they apply to the whole item.
+func (s ruleSet) fieldPaths() ([]transform.FieldPath, error) {
+	if s.paths == "" {
+		return nil, nil
+	}
+	paths, err := transform.ParseFieldPaths(s.paths)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s annotation: %v", pathsAnnotation, err)
+	}
+	return paths, nil
+}
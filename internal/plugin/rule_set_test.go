@@ -0,0 +1,262 @@
+package plugin
+
+import (
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	velerov1 "github.com/vmware-tanzu/velero/pkg/apis/velero/v1"
+	"github.com/vmware-tanzu/velero/pkg/plugin/velero"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestRuleSetsFrom(t *testing.T) {
+	sets := ruleSetsFrom([]v1.ConfigMap{
+		{ObjectMeta: metav1.ObjectMeta{Name: "a"}, Data: map[string]string{"x": "y"}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "b", Annotations: map[string]string{scopeAnnotation: " cluster "}}},
+	})
+
+	assert.Equal(t, []ruleSet{
+		{name: "a", patterns: map[string]string{"x": "y"}, scope: scopeAll},
+		{name: "b", scope: scopeCluster},
+	}, sets)
+	assert.Equal(t, 1, countRules(sets))
+}
+
+func TestRuleSetsFrom_Priority(t *testing.T) {
+	sets := ruleSetsFrom([]v1.ConfigMap{
+		{ObjectMeta: metav1.ObjectMeta{Name: "a"}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "b", Annotations: map[string]string{priorityAnnotation: "-5"}}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "c", Annotations: map[string]string{priorityAnnotation: " 10 "}}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "d", Annotations: map[string]string{priorityAnnotation: "high"}}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "e", Annotations: map[string]string{priorityAnnotation: "0"}}},
+	})
+	var names []string
+	for _, set := range sets {
+		names = append(names, set.name)
+	}
+	assert.Equal(t, []string{"c", "a", "d", "e", "b"}, names)
+	assert.Error(t, sets[2].priorityErr)
+}
+
+func TestReplacePatternAction_Priority(t *testing.T) {
+	t.Setenv(stampOriginEnv, "false")
+	plugin := &RestorePlugin{logger: logrus.New()}
+	configMaps := func(priority string) []v1.ConfigMap {
+		return []v1.ConfigMap{
+			{ObjectMeta: metav1.ObjectMeta{Name: "domains"}, Data: map[string]string{"example.com": "example.org"}},
+			{ObjectMeta: metav1.ObjectMeta{Name: "hosts", Annotations: map[string]string{priorityAnnotation: priority}}, Data: map[string]string{"api.example.com": "api.dr.example.net"}},
+			{ObjectMeta: metav1.ObjectMeta{Name: "typo", Annotations: map[string]string{priorityAnnotation: "first"}}, Data: map[string]string{"api": "broken"}},
+		}
+	}
+	item := func() *unstructured.Unstructured {
+		return &unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": "v1",
+			"kind":       "ConfigMap",
+			"metadata":   map[string]interface{}{"name": "web", "namespace": "shop"},
+			"data":       map[string]interface{}{"url": "https://api.example.com"},
+		}}
+	}
+
+	for priority, url := range map[string]string{
+		// domains applies first: api.example.com is gone when hosts applies
+		"":   "https://api.example.org",
+		"-1": "https://api.example.org",
+		"1":  "https://api.dr.example.net",
+	} {
+		output, err := replacePatternAction(plugin, &velero.RestoreItemActionExecuteInput{Item: item(), ItemFromBackup: item()}, ruleSetsFrom(configMaps(priority)))
+		require.NoError(t, err)
+		data, _, _ := unstructured.NestedStringMap(output.UpdatedItem.(*unstructured.Unstructured).Object, "data")
+		assert.Equal(t, url, data["url"], priority)
+	}
+}
+
+func TestReplacePatternAction_Scopes(t *testing.T) {
+	plugin := &RestorePlugin{logger: logrus.New(), resolver: newResourceResolver(newStubResourceLister(), logrus.New())}
+
+	sets := []ruleSet{
+		{name: "generic", scope: scopeAll, patterns: map[string]string{"production": "review-3"}},
+		{name: "namespaced-only", scope: scopeNamespaced, patterns: map[string]string{"example.com": "replaced.com"}},
+		{name: "cluster-only", scope: scopeCluster, patterns: map[string]string{"ceph": "rook"}},
+	}
+
+	// PersistentVolume is not in the stub discovery: scope falls back to the
+	// absence of a namespace
+	pv := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "PersistentVolume",
+		"metadata":   map[string]interface{}{"name": "production-ceph-data"},
+		"spec": map[string]interface{}{
+			"claimRef":         map[string]interface{}{"namespace": "production"},
+			"storageClassName": "ceph",
+			"csi":              map[string]interface{}{"volumeAttributes": map[string]interface{}{"endpoint": "s3.example.com"}},
+		},
+	}}
+	output, err := replacePatternAction(plugin, &velero.RestoreItemActionExecuteInput{Item: pv}, sets)
+	require.NoError(t, err)
+	content := output.UpdatedItem.UnstructuredContent()
+
+	// only the cluster-scoped set renames cluster-scoped items
+	assert.Equal(t, "production-rook-data", lookupPath(t, content, "metadata.name"))
+	assert.Equal(t, "review-3", lookupPath(t, content, "spec.claimRef.namespace"))
+	assert.Equal(t, "rook", lookupPath(t, content, "spec.storageClassName"))
+	assert.Equal(t, "s3.example.com", lookupPath(t, content, "spec.csi.volumeAttributes.endpoint"))
+
+	service := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "Service",
+		"metadata":   map[string]interface{}{"name": "production-ceph", "namespace": "production"},
+		"spec":       map[string]interface{}{"externalName": "db.example.com"},
+	}}
+	output, err = replacePatternAction(plugin, &velero.RestoreItemActionExecuteInput{Item: service}, sets)
+	require.NoError(t, err)
+	content = output.UpdatedItem.UnstructuredContent()
+
+	assert.Equal(t, "review-3-ceph", lookupPath(t, content, "metadata.name"))
+	assert.Equal(t, "review-3", lookupPath(t, content, "metadata.namespace"))
+	assert.Equal(t, "db.replaced.com", lookupPath(t, content, "spec.externalName"))
+}
+
+func TestReplacePatternAction_ExistingResourcePolicy(t *testing.T) {
+	t.Setenv(stampOriginEnv, "false")
+	plugin := &RestorePlugin{logger: logrus.New()}
+	sets := []ruleSet{{name: "generic", scope: scopeAll, patterns: map[string]string{"production": "review-3"}}}
+
+	for policy, expectedName := range map[velerov1.PolicyType]string{
+		velerov1.PolicyTypeNone:   "review-3-db",
+		velerov1.PolicyTypeUpdate: "production-db",
+	} {
+		t.Run(string(policy), func(t *testing.T) {
+			item := &unstructured.Unstructured{Object: map[string]interface{}{
+				"apiVersion": "v1",
+				"kind":       "Service",
+				"metadata":   map[string]interface{}{"name": "production-db", "namespace": "production"},
+				"spec":       map[string]interface{}{"externalName": "db.production.svc"},
+			}}
+			restore := &velerov1.Restore{Spec: velerov1.RestoreSpec{ExistingResourcePolicy: policy}}
+
+			output, err := replacePatternAction(plugin, &velero.RestoreItemActionExecuteInput{Item: item, Restore: restore}, sets)
+			require.NoError(t, err)
+			content := output.UpdatedItem.UnstructuredContent()
+
+			assert.Equal(t, expectedName, lookupPath(t, content, "metadata.name"))
+			assert.Equal(t, "db.review-3.svc", lookupPath(t, content, "spec.externalName"))
+		})
+	}
+}
+
+func TestReplacePatternAction_Paths(t *testing.T) {
+	t.Setenv(stampOriginEnv, "false")
+	plugin := &RestorePlugin{logger: logrus.New()}
+	sets := ruleSetsFrom([]v1.ConfigMap{
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "images", Annotations: map[string]string{pathsAnnotation: "spec.template.spec.containers[*].image"}},
+			Data:       map[string]string{"registry.prod": "registry.dr"},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "broken", Annotations: map[string]string{pathsAnnotation: "spec.containers[?(@.name=='web')]"}},
+			Data:       map[string]string{"web": "broken"},
+		},
+	})
+
+	item := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "apps/v1",
+		"kind":       "Deployment",
+		"metadata": map[string]interface{}{
+			"name":      "web",
+			"namespace": "shop",
+			"labels":    map[string]interface{}{"registry.prod/mirror": "true"},
+		},
+		"spec": map[string]interface{}{
+			"template": map[string]interface{}{
+				"spec": map[string]interface{}{
+					"containers": []interface{}{
+						map[string]interface{}{
+							"name":  "web",
+							"image": "registry.prod/web:1",
+							"env":   []interface{}{map[string]interface{}{"name": "MIRROR", "value": "registry.prod"}},
+						},
+					},
+				},
+			},
+		},
+	}}
+
+	output, err := replacePatternAction(plugin, &velero.RestoreItemActionExecuteInput{Item: item, ItemFromBackup: item}, sets)
+	require.NoError(t, err)
+	result := output.UpdatedItem.(*unstructured.Unstructured)
+	assert.Equal(t, "web", result.GetName())
+	assert.Equal(t, map[string]string{"registry.prod/mirror": "true"}, result.GetLabels())
+	containers, _, _ := unstructured.NestedSlice(result.Object, "spec", "template", "spec", "containers")
+	container := containers[0].(map[string]interface{})
+	assert.Equal(t, "registry.dr/web:1", container["image"])
+	assert.Equal(t, "registry.prod", container["env"].([]interface{})[0].(map[string]interface{})["value"])
+}
+
+func TestReplacePatternAction_ValuesOnly(t *testing.T) {
+	t.Setenv(stampOriginEnv, "false")
+	plugin := &RestorePlugin{logger: logrus.New()}
+	restore := &velerov1.Restore{ObjectMeta: metav1.ObjectMeta{Name: "dr-1", UID: "dr-1"}}
+	configMaps := []v1.ConfigMap{{
+		ObjectMeta: metav1.ObjectMeta{Name: "databases", Annotations: map[string]string{valuesOnlyAnnotation: "true"}},
+		Data:       map[string]string{"db": "pg"},
+	}}
+	sets := ruleSetsFrom(configMaps)
+	require.True(t, sets[0].valuesOnly)
+
+	pod := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "Pod",
+		"metadata": map[string]interface{}{
+			"name":      "api",
+			"namespace": "shop",
+			"labels":    map[string]interface{}{"db-role": "db-client"},
+		},
+		"spec": map[string]interface{}{
+			"dbConfig": map[string]interface{}{"url": "db.shop.svc"},
+			"containers": []interface{}{map[string]interface{}{
+				"name": "api",
+				"env": []interface{}{map[string]interface{}{
+					"name":      "ROLE",
+					"valueFrom": map[string]interface{}{"fieldRef": map[string]interface{}{"fieldPath": "metadata.labels['db-role']"}},
+				}},
+			}},
+		},
+	}}
+	output, err := replacePatternAction(plugin, &velero.RestoreItemActionExecuteInput{Item: pod, Restore: restore}, sets)
+	require.NoError(t, err)
+	restored := output.UpdatedItem.(*unstructured.Unstructured)
+	assert.Equal(t, map[string]string{"db-role": "pg-client"}, restored.GetLabels())
+	url, _, _ := unstructured.NestedString(restored.Object, "spec", "dbConfig", "url")
+	assert.Equal(t, "pg.shop.svc", url)
+	containers, _, _ := unstructured.NestedSlice(restored.Object, "spec", "containers")
+	fieldPath, _, _ := unstructured.NestedString(containers[0].(map[string]interface{})["env"].([]interface{})[0].(map[string]interface{}), "valueFrom", "fieldRef", "fieldPath")
+	assert.Equal(t, "metadata.labels['db-role']", fieldPath, "the label key is not renamed")
+	assert.Empty(t, plugin.stateFor(restore).report.applied, "the patterns are not recorded as applied")
+
+	// the annotation survives a recording, and keys do not drift
+	assert.Equal(t, sets, ruleSetsFrom([]v1.ConfigMap{sets[0].configMap()}))
+	configMap := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "ConfigMap",
+		"metadata":   map[string]interface{}{"name": "api", "namespace": "shop"},
+		"data":       map[string]interface{}{"dbHost": "pg.shop.svc", "dbReplica": "db-replica.shop.svc"},
+	}}
+	assert.Equal(t, []Drift{{Rules: "databases", Pattern: "db", Path: "data.dbReplica"}}, NewDriftChecker(configMaps).Check(configMap))
+}
+
+func TestRuleSetsFrom_Regex(t *testing.T) {
+	regex := func(name, expr string) v1.ConfigMap {
+		return v1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Annotations: map[string]string{transformerAnnotation: transformerRegex}},
+			Data:       map[string]string{regexPatternsKey: "- regex: '" + expr + "'\n  replacement: x\n"},
+		}
+	}
+	sets := ruleSetsFrom([]v1.ConfigMap{regex("valid", `v(\d+)`), regex("pcre", `a++`), regex("empty", ``)})
+	assert.NoError(t, sets[0].loadErr())
+	assert.ErrorContains(t, sets[1].loadErr(), "possessive quantifiers are not supported")
+	assert.EqualError(t, sets[2].loadErr(), "empty regex")
+}
@@ -0,0 +1,90 @@
+package plugin
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	velerov1 "github.com/vmware-tanzu/velero/pkg/apis/velero/v1"
+	v1 "k8s.io/api/core/v1"
+)
+
+const (
+	// rulesPinAnnotation on a Restore pins the rule ConfigMaps it must be
+	// restored with: `sha256:<hex>` for the hash of the bundle, reported in
+	// the summary, or a version all the rule ConfigMaps carry in
+	// rulesVersionAnnotation.
+	rulesPinAnnotation = "agoracalyce.io/rules-pin"
+	// rulesVersionAnnotation on a rule ConfigMap names the bundle version it
+	// belongs to.
+	rulesVersionAnnotation = "agoracalyce.io/rules-version"
+
+	rulesHashPrefix = "sha256:"
+)
+
+// bundleEntry is what the hash of a rule ConfigMap covers: everything the
+// plugin reads from it.
+type bundleEntry struct {
+	Name        string            `json:"name"`
+	Labels      map[string]string `json:"labels,omitempty"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+	Data        map[string]string `json:"data,omitempty"`
+	BinaryData  map[string][]byte `json:"binaryData,omitempty"`
+}
+
+// rulesHash hashes the rule ConfigMaps, whatever the order they are listed in.
+func rulesHash(configMaps []v1.ConfigMap) string {
+	entries := make([]bundleEntry, 0, len(configMaps))
+	for _, cm := range configMaps {
+		entries = append(entries, bundleEntry{
+			Name:        cm.Name,
+			Labels:      cm.Labels,
+			Annotations: cm.Annotations,
+			Data:        cm.Data,
+			BinaryData:  cm.BinaryData,
+		})
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name < entries[j].Name })
+
+	// map keys are sorted by encoding/json, so the encoding is canonical
+	data, _ := json.Marshal(entries)
+	sum := sha256.Sum256(data)
+	return rulesHashPrefix + hex.EncodeToString(sum[:])
+}
+
+// checkRulesPin fails when the Restore pins a rule bundle the rule ConfigMaps
+// do not match.
+func checkRulesPin(restore *velerov1.Restore, configMaps []v1.ConfigMap) error {
+	if restore == nil {
+		return nil
+	}
+	pin := strings.TrimSpace(restore.Annotations[rulesPinAnnotation])
+	if pin == "" {
+		return nil
+	}
+	if len(configMaps) == 0 {
+		return fmt.Errorf("restore %s pins the rules to %s, but no rule ConfigMap was found", restore.Name, pin)
+	}
+
+	if strings.HasPrefix(pin, rulesHashPrefix) {
+		if hash := rulesHash(configMaps); !strings.EqualFold(hash, pin) {
+			return fmt.Errorf("restore %s pins the rules to %s, but they hash to %s", restore.Name, pin, hash)
+		}
+		return nil
+	}
+
+	var mismatched []string
+	for _, cm := range configMaps {
+		if version := cm.Annotations[rulesVersionAnnotation]; version != pin {
+			mismatched = append(mismatched, fmt.Sprintf("%s (%q)", cm.Name, version))
+		}
+	}
+	if len(mismatched) > 0 {
+		sort.Strings(mismatched)
+		return fmt.Errorf("restore %s pins the rules to version %s, but other versions were found: %s", restore.Name, pin, strings.Join(mismatched, ", "))
+	}
+	return nil
+}
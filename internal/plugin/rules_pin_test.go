@@ -0,0 +1,109 @@
+package plugin
+
+import (
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	velerov1 "github.com/vmware-tanzu/velero/pkg/apis/velero/v1"
+	"github.com/vmware-tanzu/velero/pkg/plugin/velero"
+	"github.com/wrkt/velero-custom-plugins/mocks"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func pinnedRestore(pin string) *velerov1.Restore {
+	return &velerov1.Restore{ObjectMeta: metav1.ObjectMeta{
+		Name:        "dr-1",
+		UID:         "uid-1",
+		Annotations: map[string]string{rulesPinAnnotation: pin},
+	}}
+}
+
+func TestRulesHash(t *testing.T) {
+	a := corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "a"}, Data: map[string]string{pattern1: replacement1}}
+	b := corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "b", Annotations: map[string]string{scopeAnnotation: "cluster"}}, Data: map[string]string{pattern2: replacement2}}
+
+	hash := rulesHash([]corev1.ConfigMap{a, b})
+	assert.Regexp(t, `^sha256:[0-9a-f]{64}$`, hash)
+	assert.Equal(t, hash, rulesHash([]corev1.ConfigMap{b, a}))
+
+	b.Annotations[scopeAnnotation] = "namespaced"
+	assert.NotEqual(t, hash, rulesHash([]corev1.ConfigMap{a, b}))
+}
+
+func TestCheckRulesPin(t *testing.T) {
+	configMaps := []corev1.ConfigMap{
+		{ObjectMeta: metav1.ObjectMeta{Name: "a", Annotations: map[string]string{rulesVersionAnnotation: "2024.05"}}, Data: map[string]string{pattern1: replacement1}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "b", Annotations: map[string]string{rulesVersionAnnotation: "2024.04"}}, Data: map[string]string{pattern2: replacement2}},
+	}
+
+	assert.NoError(t, checkRulesPin(nil, configMaps))
+	assert.NoError(t, checkRulesPin(&velerov1.Restore{}, configMaps))
+	assert.NoError(t, checkRulesPin(pinnedRestore(rulesHash(configMaps)), configMaps))
+	assert.ErrorContains(t, checkRulesPin(pinnedRestore("sha256:0000"), configMaps), "but they hash to sha256:")
+	assert.EqualError(t, checkRulesPin(pinnedRestore("2024.05"), configMaps), `restore dr-1 pins the rules to version 2024.05, but other versions were found: b ("2024.04")`)
+	assert.ErrorContains(t, checkRulesPin(pinnedRestore("2024.05"), nil), "no rule ConfigMap was found")
+
+	configMaps[1].Annotations[rulesVersionAnnotation] = "2024.05"
+	assert.NoError(t, checkRulesPin(pinnedRestore("2024.05"), configMaps))
+}
+
+func TestRestorePlugin_Execute_RulesPin(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	configMaps := []corev1.ConfigMap{{ObjectMeta: metav1.ObjectMeta{Name: "rules"}, Data: map[string]string{pattern1: replacement1}}}
+	mockConfigMapClient := mocks.NewMockConfigMapInterface(ctrl)
+	mockConfigMapClient.EXPECT().
+		List(gomock.Any(), metav1.ListOptions{LabelSelector: labelSelector}).
+		Return(&corev1.ConfigMapList{Items: configMaps}, nil).
+		Times(2)
+	mockConfigMapClient.EXPECT().
+		Get(gomock.Any(), "dr-1-replace-pattern-report", gomock.Any()).
+		Return(nil, apierrors.NewNotFound(corev1.Resource("configmaps"), "dr-1-replace-pattern-report"))
+	plugin := &RestorePlugin{logger: logrus.New(), configMapClient: mockConfigMapClient}
+
+	item := &unstructured.Unstructured{Object: map[string]interface{}{
+		"kind":     "ConfigMap",
+		"metadata": map[string]interface{}{"name": "web", "namespace": "web"},
+		"data":     map[string]interface{}{"host": "web.example.com"},
+	}}
+
+	_, err := plugin.Execute(&velero.RestoreItemActionExecuteInput{Item: item, Restore: pinnedRestore("sha256:0000")})
+	assert.ErrorContains(t, err, "restore dr-1 pins the rules to sha256:0000")
+
+	restore := pinnedRestore(rulesHash(configMaps))
+	output, err := plugin.Execute(&velero.RestoreItemActionExecuteInput{Item: item, Restore: restore})
+	require.NoError(t, err)
+	host, _, _ := unstructured.NestedString(output.UpdatedItem.UnstructuredContent(), "data", "host")
+	assert.Equal(t, "web.replaced.com", host)
+	assert.Equal(t, restore.Annotations[rulesPinAnnotation], plugin.stateFor(restore).report.summary.RulesHash)
+}
+
+func TestRestorePlugin_Execute_RulesPinStructured(t *testing.T) {
+	configMaps := []corev1.ConfigMap{{
+		ObjectMeta: metav1.ObjectMeta{Name: "hosts", Namespace: "velero", Labels: map[string]string{"agoracalyce.io/replace-pattern": "RestoreItemAction"}},
+		Data:       map[string]string{rulesKey: structuredRules},
+	}}
+	plugin := &RestorePlugin{logger: logrus.New(), configMapClient: fake.NewSimpleClientset(&configMaps[0]).CoreV1().ConfigMaps("velero")}
+	item := &unstructured.Unstructured{Object: map[string]interface{}{
+		"kind":     "ConfigMap",
+		"metadata": map[string]interface{}{"name": "web", "namespace": "web"},
+		"data":     map[string]interface{}{"host": "web.example.com"},
+	}}
+
+	// the bundle is the ConfigMaps as written, not their expanded rules
+	assert.NotEqual(t, rulesHash(configMaps), rulesHash(expandRules(configMaps, logrus.New())))
+	restore := pinnedRestore(rulesHash(configMaps))
+	output, err := plugin.Execute(&velero.RestoreItemActionExecuteInput{Item: item, Restore: restore})
+	require.NoError(t, err)
+	host, _, _ := unstructured.NestedString(output.UpdatedItem.UnstructuredContent(), "data", "host")
+	assert.Equal(t, "web.example.org", host)
+	assert.Equal(t, restore.Annotations[rulesPinAnnotation], plugin.stateFor(restore).report.summary.RulesHash)
+}
@@ -0,0 +1,135 @@
+package plugin
+
+import (
+	"fmt"
+	"hash/fnv"
+	"io"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+const (
+	// logSampleRateEnv is the fraction, between 0 and 1, of the items whose
+	// detailed logs are emitted.
+	logSampleRateEnv = "REPLACE_PATTERN_LOG_SAMPLE_RATE"
+	// logNamespacesEnv lists namespaces whose items are always logged in
+	// detail, comma-separated.
+	logNamespacesEnv = "REPLACE_PATTERN_LOG_NAMESPACES"
+)
+
+// quietLogger swallows the detailed logs of the items left out by sampling.
+var quietLogger = func() *logrus.Logger {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	return logger
+}()
+
+// sampler decides which items get detailed logs.
+type sampler interface {
+	sampled(item *unstructured.Unstructured) bool
+}
+
+// hashSampler samples items on a hash of their identity, so the same items are
+// logged in detail across restores and plugin restarts.
+type hashSampler struct {
+	rate       float64
+	namespaces map[string]bool
+}
+
+func loadSampler(lookup lookupFunc, logger logrus.FieldLogger) sampler {
+	s := &hashSampler{rate: 1, namespaces: make(map[string]bool)}
+
+	if value, ok := lookup(logSampleRateEnv); ok {
+		if rate, err := strconv.ParseFloat(value, 64); err == nil && rate >= 0 && rate <= 1 {
+			s.rate = rate
+		} else {
+			logger.Warnf("Ignoring invalid %s=%q", logSampleRateEnv, value)
+		}
+	}
+	namespaces, _ := lookup(logNamespacesEnv)
+	for _, namespace := range strings.Split(namespaces, ",") {
+		if namespace = strings.TrimSpace(namespace); namespace != "" {
+			s.namespaces[namespace] = true
+		}
+	}
+	return s
+}
+
+func (s *hashSampler) sampled(item *unstructured.Unstructured) bool {
+	if s.rate >= 1 || s.namespaces[item.GetNamespace()] {
+		return true
+	}
+	if s.rate <= 0 {
+		return false
+	}
+	h := fnv.New64a()
+	fmt.Fprintf(h, "%s/%s/%s", item.GroupVersionKind().GroupKind(), item.GetNamespace(), item.GetName())
+	return float64(h.Sum64()%10000) < s.rate*10000
+}
+
+// verbose returns the logger for the detailed logs of an item. Warnings and
+// errors go to p.logger, whatever the sampling.
+func (p *RestorePlugin) verbose(item *unstructured.Unstructured) logrus.FieldLogger {
+	if p.sampler == nil || p.sampler.sampled(item) {
+		return p.logger
+	}
+	return quietLogger
+}
+
+// debugEnabled tells whether debug logs would be emitted, to avoid computing
+// diffs for nothing.
+func debugEnabled(logger logrus.FieldLogger) bool {
+	switch l := logger.(type) {
+	case *logrus.Logger:
+		return l.IsLevelEnabled(logrus.DebugLevel)
+	case *logrus.Entry:
+		return l.Logger.IsLevelEnabled(logrus.DebugLevel)
+	default:
+		return false
+	}
+}
+
+// diffItems lists the leaf values that differ between two items, by path.
+func diffItems(before, after map[string]interface{}) []string {
+	old, updated := make(map[string]interface{}), make(map[string]interface{})
+	flatten("", before, old)
+	flatten("", after, updated)
+
+	var changes []string
+	for path, value := range updated {
+		previous, ok := old[path]
+		switch {
+		case !ok:
+			changes = append(changes, fmt.Sprintf("+%s=%v", path, value))
+		case !reflect.DeepEqual(previous, value):
+			changes = append(changes, fmt.Sprintf("%s: %v -> %v", path, previous, value))
+		}
+	}
+	for path := range old {
+		if _, ok := updated[path]; !ok {
+			changes = append(changes, "-"+path)
+		}
+	}
+	sort.Strings(changes)
+	return changes
+}
+
+func flatten(prefix string, value interface{}, out map[string]interface{}) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, child := range v {
+			flatten(prefix+"."+key, child, out)
+		}
+	case []interface{}:
+		for i, child := range v {
+			flatten(prefix+"."+strconv.Itoa(i), child, out)
+		}
+	default:
+		out[strings.TrimPrefix(prefix, ".")] = v
+	}
+}
@@ -0,0 +1,92 @@
+package plugin
+
+import (
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	logtest "github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vmware-tanzu/velero/pkg/plugin/velero"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func sampledItem(namespace, name string) *unstructured.Unstructured {
+	item := &unstructured.Unstructured{}
+	item.SetAPIVersion("v1")
+	item.SetKind("ConfigMap")
+	item.SetNamespace(namespace)
+	item.SetName(name)
+	return item
+}
+
+func TestLoadSampler(t *testing.T) {
+	t.Setenv(logSampleRateEnv, "0.25")
+	t.Setenv(logNamespacesEnv, "payments, ,web")
+	assert.Equal(t, &hashSampler{rate: 0.25, namespaces: map[string]bool{"payments": true, "web": true}}, loadSampler(os.LookupEnv, logrus.New()))
+
+	t.Setenv(logSampleRateEnv, "2")
+	assert.Equal(t, 1.0, loadSampler(os.LookupEnv, logrus.New()).(*hashSampler).rate)
+}
+
+func TestHashSampler(t *testing.T) {
+	s := &hashSampler{rate: 0.1, namespaces: map[string]bool{"payments": true}}
+
+	sampled := 0
+	for i := 0; i < 10000; i++ {
+		item := sampledItem("default", fmt.Sprintf("item-%d", i))
+		if s.sampled(item) {
+			sampled++
+		}
+		// the decision is stable
+		assert.Equal(t, s.sampled(item), s.sampled(item.DeepCopy()))
+	}
+	assert.InDelta(t, 1000, sampled, 150)
+
+	assert.True(t, s.sampled(sampledItem("payments", "anything")))
+	assert.False(t, (&hashSampler{}).sampled(sampledItem("default", "item")))
+}
+
+func TestDiffItems(t *testing.T) {
+	before := map[string]interface{}{
+		"metadata": map[string]interface{}{"name": "a", "labels": map[string]interface{}{"old": "x"}},
+		"spec":     map[string]interface{}{"hosts": []interface{}{"a.example.com", "b"}, "port": int64(80)},
+	}
+	after := map[string]interface{}{
+		"metadata": map[string]interface{}{"name": "a", "labels": map[string]interface{}{"new": "x"}},
+		"spec":     map[string]interface{}{"hosts": []interface{}{"a.replaced.com", "b"}, "port": int64(80)},
+	}
+
+	assert.Equal(t, []string{
+		"+metadata.labels.new=x",
+		"-metadata.labels.old",
+		"spec.hosts.0: a.example.com -> a.replaced.com",
+	}, diffItems(before, after))
+}
+
+func TestReplacePatternAction_Sampling(t *testing.T) {
+	logger, hook := logtest.NewNullLogger()
+	logger.SetLevel(logrus.DebugLevel)
+	plugin := &RestorePlugin{logger: logger, sampler: &hashSampler{namespaces: map[string]bool{"payments": true}}}
+	sets := []ruleSet{{patterns: map[string]string{"example.com": "replaced.com"}}}
+
+	for _, namespace := range []string{"default", "payments"} {
+		item := sampledItem(namespace, "app")
+		item.Object["data"] = map[string]interface{}{"url": "https://example.com"}
+		_, err := replacePatternAction(plugin, &velero.RestoreItemActionExecuteInput{Item: item}, sets)
+		require.NoError(t, err)
+	}
+
+	var messages []string
+	for _, entry := range hook.AllEntries() {
+		messages = append(messages, entry.Message)
+	}
+	assert.Equal(t, []string{
+		"Executing ReplacePatternAction on ConfigMap",
+		"ConfigMap payments/app: +metadata.annotations.agoracalyce.io/original-name=app",
+		"ConfigMap payments/app: +metadata.annotations.agoracalyce.io/original-namespace=payments",
+		"ConfigMap payments/app: data.url: https://example.com -> https://replaced.com",
+	}, messages)
+}
@@ -0,0 +1,233 @@
+package plugin
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	velerov1 "github.com/vmware-tanzu/velero/pkg/apis/velero/v1"
+	"github.com/vmware-tanzu/velero/pkg/plugin/velero"
+	"github.com/wrkt/velero-custom-plugins/internal/transform"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// Environment variables configuring the scrub plugin.
+const (
+	scrubScannerURLEnv  = "SCRUB_SCANNER_URL"
+	scrubMinItemSizeEnv = "SCRUB_MIN_ITEM_SIZE"
+
+	defaultScrubMinItemSize = 64 * 1024
+	scrubRequestTimeout     = 30 * time.Second
+)
+
+// scanRequest is posted to the scanner to start a scan.
+type scanRequest struct {
+	Backup    string                 `json:"backup"`
+	Kind      string                 `json:"kind"`
+	Namespace string                 `json:"namespace,omitempty"`
+	Name      string                 `json:"name"`
+	Item      map[string]interface{} `json:"item"`
+}
+
+// scanStatus is the state of a scan as reported by the scanner.
+type scanStatus struct {
+	Completed bool      `json:"completed"`
+	Error     string    `json:"error,omitempty"`
+	Scanned   int64     `json:"scanned"`
+	Total     int64     `json:"total"`
+	Findings  []string  `json:"findings,omitempty"`
+	Started   time.Time `json:"started,omitempty"`
+	Updated   time.Time `json:"updated,omitempty"`
+}
+
+// scanner runs scans in an external DLP service.
+type scanner interface {
+	start(ctx context.Context, request scanRequest) (string, error)
+	status(ctx context.Context, id string) (scanStatus, error)
+	cancel(ctx context.Context, id string) error
+}
+
+// httpScanner talks to a scanner exposing POST /scans, GET /scans/<id> and
+// DELETE /scans/<id>.
+type httpScanner struct {
+	baseURL string
+	client  *http.Client
+}
+
+func (s *httpScanner) start(ctx context.Context, request scanRequest) (string, error) {
+	body, err := json.Marshal(request)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode scan request: %v", err)
+	}
+	var started struct {
+		ID string `json:"id"`
+	}
+	if err := s.do(ctx, http.MethodPost, "/scans", body, &started); err != nil {
+		return "", err
+	}
+	if started.ID == "" {
+		return "", fmt.Errorf("scanner returned no scan id")
+	}
+	return started.ID, nil
+}
+
+func (s *httpScanner) status(ctx context.Context, id string) (scanStatus, error) {
+	var status scanStatus
+	err := s.do(ctx, http.MethodGet, "/scans/"+url.PathEscape(id), nil, &status)
+	return status, err
+}
+
+func (s *httpScanner) cancel(ctx context.Context, id string) error {
+	return s.do(ctx, http.MethodDelete, "/scans/"+url.PathEscape(id), nil, nil)
+}
+
+func (s *httpScanner) do(ctx context.Context, method, path string, body []byte, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, method, strings.TrimSuffix(s.baseURL, "/")+path, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to build scanner request: %v", err)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to call scanner: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("scanner answered %s to %s %s", resp.Status, method, path)
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode scanner response: %v", err)
+	}
+	return nil
+}
+
+// ScrubPlugin is a backup item action sending large ConfigMaps to an external
+// DLP scanner. Scans run as asynchronous operations: the backup does not wait
+// for them, and findings fail the operation.
+type ScrubPlugin struct {
+	logger      logrus.FieldLogger
+	scanner     scanner
+	minItemSize int
+}
+
+// NewScrubPlugin instantiates a ScrubPlugin. Without SCRUB_SCANNER_URL, it
+// backs items up untouched.
+func NewScrubPlugin(logger logrus.FieldLogger) *ScrubPlugin {
+	// without a Kubernetes client, the settings ConfigMap is not read
+	cfg, err := loadConfig(nil, logger)
+	if err != nil {
+		logger.Fatalf("Invalid configuration: %v", err)
+	}
+	lookup := cfg.Lookup
+	p := &ScrubPlugin{logger: logger, minItemSize: defaultScrubMinItemSize}
+
+	if scannerURL, _ := lookup(scrubScannerURLEnv); scannerURL != "" {
+		p.scanner = &httpScanner{baseURL: scannerURL, client: &http.Client{Timeout: scrubRequestTimeout}}
+	}
+	if value, ok := lookup(scrubMinItemSizeEnv); ok {
+		if n, err := strconv.Atoi(value); err == nil && n >= 0 {
+			p.minItemSize = n
+		} else {
+			logger.Warnf("Ignoring invalid %s=%q", scrubMinItemSizeEnv, value)
+		}
+	}
+	return p
+}
+
+// Name implements BackupItemAction.
+func (p *ScrubPlugin) Name() string {
+	return "agoracalyce.io/scrub"
+}
+
+// AppliesTo returns a ResourceSelector that matches ConfigMaps
+func (p *ScrubPlugin) AppliesTo() (velero.ResourceSelector, error) {
+	return velero.ResourceSelector{IncludedResources: []string{"configmaps"}}, nil
+}
+
+// Execute starts a scan of the item when it is large enough, and returns its id
+// as the operation id.
+func (p *ScrubPlugin) Execute(item runtime.Unstructured, backup *velerov1.Backup) (runtime.Unstructured, []velero.ResourceIdentifier, string, []velero.ResourceIdentifier, error) {
+	if p.scanner == nil {
+		return item, nil, "", nil, nil
+	}
+	// operations can't be started once the backup is finalizing
+	if phase := backup.Status.Phase; phase == velerov1.BackupPhaseFinalizing || phase == velerov1.BackupPhaseFinalizingPartiallyFailed {
+		return item, nil, "", nil, nil
+	}
+
+	content := item.UnstructuredContent()
+	if transform.Size(content) < p.minItemSize {
+		return item, nil, "", nil, nil
+	}
+
+	object := &unstructured.Unstructured{Object: content}
+	ctx, cancel := context.WithTimeout(context.Background(), scrubRequestTimeout)
+	defer cancel()
+	id, err := p.scanner.start(ctx, scanRequest{
+		Backup:    backup.Name,
+		Kind:      object.GetKind(),
+		Namespace: object.GetNamespace(),
+		Name:      object.GetName(),
+		Item:      content,
+	})
+	if err != nil {
+		return nil, nil, "", nil, fmt.Errorf("failed to start scan of %s %s/%s: %v", object.GetKind(), object.GetNamespace(), object.GetName(), err)
+	}
+	p.logger.Infof("Started scan %s of %s %s/%s", id, object.GetKind(), object.GetNamespace(), object.GetName())
+	return item, nil, id, nil, nil
+}
+
+// Progress reports the progress of a scan. Findings fail the operation.
+func (p *ScrubPlugin) Progress(operationID string, backup *velerov1.Backup) (velero.OperationProgress, error) {
+	if p.scanner == nil {
+		return velero.OperationProgress{}, fmt.Errorf("no scanner configured for scan %s", operationID)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), scrubRequestTimeout)
+	defer cancel()
+	status, err := p.scanner.status(ctx, operationID)
+	if err != nil {
+		return velero.OperationProgress{}, err
+	}
+
+	progress := velero.OperationProgress{
+		Completed:      status.Completed,
+		Err:            status.Error,
+		NCompleted:     status.Scanned,
+		NTotal:         status.Total,
+		OperationUnits: "bytes",
+		Description:    "Scanning",
+		Started:        status.Started,
+		Updated:        status.Updated,
+	}
+	if status.Completed {
+		progress.Description = "Scan completed"
+	}
+	if len(status.Findings) > 0 && progress.Err == "" {
+		progress.Err = fmt.Sprintf("%d finding(s): %s", len(status.Findings), strings.Join(status.Findings, "; "))
+	}
+	return progress, nil
+}
+
+// Cancel cancels a scan.
+func (p *ScrubPlugin) Cancel(operationID string, backup *velerov1.Backup) error {
+	if p.scanner == nil {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), scrubRequestTimeout)
+	defer cancel()
+	return p.scanner.cancel(ctx, operationID)
+}
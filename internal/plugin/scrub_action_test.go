@@ -0,0 +1,127 @@
+package plugin
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	velerov1 "github.com/vmware-tanzu/velero/pkg/apis/velero/v1"
+	biav2 "github.com/vmware-tanzu/velero/pkg/plugin/velero/backupitemaction/v2"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+var _ biav2.BackupItemAction = &ScrubPlugin{}
+
+// fakeScanServer serves the scanner API, with one scan finding a leaked key.
+func fakeScanServer(t *testing.T) (*httptest.Server, *[]scanRequest, *[]string) {
+	var requests []scanRequest
+	var cancelled []string
+	mux := http.NewServeMux()
+	mux.HandleFunc("/scans", func(w http.ResponseWriter, r *http.Request) {
+		var request scanRequest
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&request))
+		requests = append(requests, request)
+		w.WriteHeader(http.StatusAccepted)
+		w.Write([]byte(`{"id": "scan-1"}`))
+	})
+	mux.HandleFunc("/scans/", func(w http.ResponseWriter, r *http.Request) {
+		id := strings.TrimPrefix(r.URL.Path, "/scans/")
+		switch {
+		case r.Method == http.MethodDelete:
+			cancelled = append(cancelled, id)
+		case id == "scan-1":
+			w.Write([]byte(`{"completed": false, "scanned": 10, "total": 100}`))
+		case id == "scan-2":
+			w.Write([]byte(`{"completed": true, "scanned": 100, "total": 100, "findings": ["AWS key in data.config"]}`))
+		default:
+			http.NotFound(w, r)
+		}
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server, &requests, &cancelled
+}
+
+func TestNewScrubPlugin(t *testing.T) {
+	plugin := NewScrubPlugin(logrus.New())
+	assert.Nil(t, plugin.scanner)
+	assert.Equal(t, defaultScrubMinItemSize, plugin.minItemSize)
+
+	t.Setenv(scrubScannerURLEnv, "http://scanner.dlp:8080")
+	t.Setenv(scrubMinItemSizeEnv, "1024")
+	plugin = NewScrubPlugin(logrus.New())
+	assert.Equal(t, "http://scanner.dlp:8080", plugin.scanner.(*httpScanner).baseURL)
+	assert.Equal(t, 1024, plugin.minItemSize)
+}
+
+func TestScrubPlugin(t *testing.T) {
+	server, requests, cancelled := fakeScanServer(t)
+	plugin := &ScrubPlugin{
+		logger:      logrus.New(),
+		scanner:     &httpScanner{baseURL: server.URL + "/", client: server.Client()},
+		minItemSize: 100,
+	}
+	backup := &velerov1.Backup{ObjectMeta: metav1.ObjectMeta{Name: "nightly"}}
+
+	small := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "ConfigMap",
+		"metadata":   map[string]interface{}{"name": "small", "namespace": "web"},
+	}}
+	_, _, operationID, _, err := plugin.Execute(small, backup)
+	require.NoError(t, err)
+	assert.Empty(t, operationID)
+
+	large := small.DeepCopy()
+	large.SetName("large")
+	large.Object["data"] = map[string]interface{}{"config": strings.Repeat("x", 200)}
+	item, _, operationID, postOperationItems, err := plugin.Execute(large, backup)
+	require.NoError(t, err)
+	assert.Same(t, large, item)
+	assert.Equal(t, "scan-1", operationID)
+	assert.Empty(t, postOperationItems)
+	require.Len(t, *requests, 1)
+	assert.Equal(t, scanRequest{Backup: "nightly", Kind: "ConfigMap", Namespace: "web", Name: "large", Item: large.Object}, (*requests)[0])
+
+	// no operation is started once the backup is finalizing
+	finalizing := backup.DeepCopy()
+	finalizing.Status.Phase = velerov1.BackupPhaseFinalizing
+	_, _, operationID, _, err = plugin.Execute(large, finalizing)
+	require.NoError(t, err)
+	assert.Empty(t, operationID)
+
+	progress, err := plugin.Progress("scan-1", backup)
+	require.NoError(t, err)
+	assert.False(t, progress.Completed)
+	assert.Equal(t, int64(10), progress.NCompleted)
+	assert.Equal(t, int64(100), progress.NTotal)
+	assert.Empty(t, progress.Err)
+
+	progress, err = plugin.Progress("scan-2", backup)
+	require.NoError(t, err)
+	assert.True(t, progress.Completed)
+	assert.Equal(t, "1 finding(s): AWS key in data.config", progress.Err)
+
+	_, err = plugin.Progress("unknown", backup)
+	assert.Error(t, err)
+
+	require.NoError(t, plugin.Cancel("scan-1", backup))
+	assert.Equal(t, []string{"scan-1"}, *cancelled)
+}
+
+func TestScrubPlugin_Disabled(t *testing.T) {
+	plugin := &ScrubPlugin{logger: logrus.New()}
+	item := &unstructured.Unstructured{Object: map[string]interface{}{"kind": "ConfigMap"}}
+
+	output, _, operationID, _, err := plugin.Execute(item, &velerov1.Backup{})
+	require.NoError(t, err)
+	assert.Same(t, item, output)
+	assert.Empty(t, operationID)
+	assert.NoError(t, plugin.Cancel("scan-1", &velerov1.Backup{}))
+}
@@ -0,0 +1,49 @@
+package plugin
+
+import (
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"github.com/wrkt/velero-custom-plugins/internal/transform"
+)
+
+// sectionsEnv restricts the patterns of the ConfigMaps without an
+// agoracalyce.io/paths annotation to the comma-separated top-level fields of
+// the items, such as spec,data: metadata and status are then left alone.
+const sectionsEnv = "REPLACE_PATTERN_SECTIONS"
+
+// SectionsSetting is the setting restricting the patterns to sections, which
+// the verifier reads too.
+const SectionsSetting = sectionsEnv
+
+// loadSections returns the top-level fields of sectionsEnv as paths, nil when
+// patterns rewrite the whole item.
+func loadSections(lookup lookupFunc, logger logrus.FieldLogger) []transform.FieldPath {
+	value, ok := lookup(sectionsEnv)
+	if !ok {
+		return nil
+	}
+	var sections []transform.FieldPath
+	for _, section := range strings.Split(value, ",") {
+		section = strings.TrimSpace(section)
+		if section == "" || strings.ContainsAny(section, ".[]{}$'\"") {
+			logger.Warnf("Ignoring invalid section %q in %s=%q: sections are top-level fields", section, sectionsEnv, value)
+			continue
+		}
+		sections = append(sections, transform.FieldPath{{Key: section}})
+	}
+	if len(sections) > 0 {
+		logger.Infof("Restricting the patterns without paths to the sections %s", value)
+	}
+	return sections
+}
+
+// patternPaths returns the fields the patterns of a set are restricted to: its
+// own paths, or else the sections of the plugin.
+func (p *RestorePlugin) patternPaths(set ruleSet) ([]transform.FieldPath, error) {
+	paths, err := set.fieldPaths()
+	if err != nil || paths != nil {
+		return paths, err
+	}
+	return p.sections, nil
+}
@@ -0,0 +1,54 @@
+package plugin
+
+import (
+	"os"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vmware-tanzu/velero/pkg/plugin/velero"
+	"github.com/wrkt/velero-custom-plugins/internal/transform"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestLoadSections(t *testing.T) {
+	assert.Nil(t, loadSections(os.LookupEnv, logrus.New()))
+
+	t.Setenv(sectionsEnv, "spec, ,data,metadata.labels")
+	assert.Equal(t, []transform.FieldPath{{{Key: "spec"}}, {{Key: "data"}}}, loadSections(os.LookupEnv, logrus.New()))
+
+	t.Setenv(sectionsEnv, "status.phase")
+	assert.Nil(t, loadSections(os.LookupEnv, logrus.New()))
+}
+
+func TestReplacePatternAction_Sections(t *testing.T) {
+	t.Setenv(stampOriginEnv, "false")
+	plugin := &RestorePlugin{logger: logrus.New(), sections: []transform.FieldPath{{{Key: "spec"}}}}
+	sets := []ruleSet{
+		{name: "spec-only", patterns: map[string]string{"prod": "dr"}},
+		{name: "labels", patterns: map[string]string{"tier-a": "tier-b"}, paths: "metadata.labels"},
+	}
+
+	item := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "apps/v1",
+		"kind":       "Deployment",
+		"metadata": map[string]interface{}{
+			"name":      "prod-api",
+			"namespace": "shop",
+			"uid":       "prod-1234",
+			"labels":    map[string]interface{}{"env": "prod", "tier": "tier-a"},
+		},
+		"spec":   map[string]interface{}{"host": "api.prod.example.com"},
+		"status": map[string]interface{}{"message": "prod rollout complete"},
+	}}
+	output, err := replacePatternAction(plugin, &velero.RestoreItemActionExecuteInput{Item: item}, sets)
+	require.NoError(t, err)
+	restored := output.UpdatedItem.(*unstructured.Unstructured)
+	assert.Equal(t, "api.dr.example.com", restored.Object["spec"].(map[string]interface{})["host"])
+	assert.Equal(t, "prod-api", restored.GetName())
+	assert.Equal(t, "prod-1234", string(restored.GetUID()))
+	// the paths of a ConfigMap replace the sections
+	assert.Equal(t, map[string]string{"env": "prod", "tier": "tier-b"}, restored.GetLabels())
+	assert.Equal(t, "prod rollout complete", restored.Object["status"].(map[string]interface{})["message"])
+}
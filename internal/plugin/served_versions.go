@@ -0,0 +1,144 @@
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+)
+
+// servedVersionsRefresh is the minimum delay between two discoveries of the
+// served versions: the CRDs of a restore are created while it runs.
+const servedVersionsRefresh = 10 * time.Second
+
+var crdResource = schema.GroupVersionResource{Group: "apiextensions.k8s.io", Version: "v1", Resource: "customresourcedefinitions"}
+
+// groupsLister is the part of the discovery client listing every served
+// version.
+type groupsLister interface {
+	ServerGroupsAndResources() ([]*metav1.APIGroup, []*metav1.APIResourceList, error)
+}
+
+// servedVersion is a version serving a kind, and the resource it is served as.
+type servedVersion struct {
+	version  string
+	resource string
+}
+
+// versionChecker makes sure items are restored in a version the target
+// cluster serves.
+type versionChecker struct {
+	lister groupsLister
+	// crds reads CustomResourceDefinitions, nil when unavailable
+	crds   dynamic.Interface
+	logger logrus.FieldLogger
+
+	mu     sync.Mutex
+	loaded time.Time
+	// served lists the versions serving each kind, preferred first
+	served map[schema.GroupKind][]servedVersion
+	now    func() time.Time
+}
+
+func newVersionChecker(lister groupsLister, crds dynamic.Interface, logger logrus.FieldLogger) *versionChecker {
+	return &versionChecker{lister: lister, crds: crds, logger: logger, now: time.Now}
+}
+
+// versions returns the versions serving a kind, discovering them again when
+// the kind or the version is unknown and the last discovery is old enough.
+func (c *versionChecker) versions(gvk schema.GroupVersionKind) []servedVersion {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.served == nil || (!servesVersion(c.served[gvk.GroupKind()], gvk.Version) && c.now().Sub(c.loaded) >= servedVersionsRefresh) {
+		c.load()
+	}
+	return c.served[gvk.GroupKind()]
+}
+
+func (c *versionChecker) load() {
+	c.loaded = c.now()
+	groups, lists, err := c.lister.ServerGroupsAndResources()
+	if err != nil {
+		// partial results are still returned when some API groups fail
+		c.logger.Warnf("Version discovery is incomplete: %v", err)
+	}
+
+	preferred := make(map[string]string, len(groups))
+	for _, group := range groups {
+		preferred[group.Name] = group.PreferredVersion.Version
+	}
+	c.served = make(map[schema.GroupKind][]servedVersion)
+	for _, list := range lists {
+		gv, err := schema.ParseGroupVersion(list.GroupVersion)
+		if err != nil {
+			continue
+		}
+		for _, resource := range list.APIResources {
+			if strings.Contains(resource.Name, "/") {
+				continue
+			}
+			gk := schema.GroupKind{Group: gv.Group, Kind: resource.Kind}
+			version := servedVersion{version: gv.Version, resource: resource.Name}
+			if gv.Version == preferred[gv.Group] {
+				c.served[gk] = append([]servedVersion{version}, c.served[gk]...)
+			} else {
+				c.served[gk] = append(c.served[gk], version)
+			}
+		}
+	}
+}
+
+func servesVersion(versions []servedVersion, version string) bool {
+	for _, served := range versions {
+		if served.version == version {
+			return true
+		}
+	}
+	return false
+}
+
+// check returns the item in a version the cluster serves: unchanged when it
+// already is, or moved to the preferred version of its CRD when the CRD
+// converts between versions without a webhook, its versions sharing their
+// schema. It fails when the item cannot be restored.
+func (c *versionChecker) check(item *unstructured.Unstructured) (*unstructured.Unstructured, error) {
+	gvk := item.GroupVersionKind()
+	versions := c.versions(gvk)
+	if len(versions) == 0 {
+		// Velero skips the resources the cluster does not serve at all
+		return item, nil
+	}
+	if servesVersion(versions, gvk.Version) {
+		return item, nil
+	}
+
+	served := make([]string, 0, len(versions))
+	for _, version := range versions {
+		served = append(served, version.version)
+	}
+	if c.crds == nil || gvk.Group == "" || !strings.Contains(gvk.Group, ".") {
+		return nil, fmt.Errorf("the cluster serves %s in %s only, not %s", gvk.Kind, strings.Join(served, ", "), gvk.Version)
+	}
+
+	name := versions[0].resource + "." + gvk.Group
+	crd, err := c.crds.Resource(crdResource).Get(context.TODO(), name, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("the cluster serves %s in %s only, not %s, and its CRD cannot be read: %v", gvk.Kind, strings.Join(served, ", "), gvk.Version, err)
+	}
+	strategy, _, _ := unstructured.NestedString(crd.Object, "spec", "conversion", "strategy")
+	if strategy != "" && strategy != "None" {
+		return nil, fmt.Errorf("the cluster serves %s in %s only, not %s, and CRD %s converts versions with a %s", gvk.Kind, strings.Join(served, ", "), gvk.Version, name, strategy)
+	}
+
+	out := item.DeepCopy()
+	out.SetAPIVersion(schema.GroupVersion{Group: gvk.Group, Version: versions[0].version}.String())
+	return out, nil
+}
@@ -0,0 +1,170 @@
+package plugin
+
+import (
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	velerov1 "github.com/vmware-tanzu/velero/pkg/apis/velero/v1"
+	"github.com/vmware-tanzu/velero/pkg/plugin/velero"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+)
+
+type stubGroupsLister struct {
+	groups []*metav1.APIGroup
+	lists  []*metav1.APIResourceList
+	calls  int
+}
+
+func (s *stubGroupsLister) ServerGroupsAndResources() ([]*metav1.APIGroup, []*metav1.APIResourceList, error) {
+	s.calls++
+	return s.groups, s.lists, nil
+}
+
+func servedGroup(name, preferred string, kind, resource string, versions ...string) (*metav1.APIGroup, []*metav1.APIResourceList) {
+	group := &metav1.APIGroup{Name: name, PreferredVersion: metav1.GroupVersionForDiscovery{Version: preferred}}
+	var lists []*metav1.APIResourceList
+	for _, version := range versions {
+		groupVersion := version
+		if name != "" {
+			groupVersion = name + "/" + version
+		}
+		lists = append(lists, &metav1.APIResourceList{GroupVersion: groupVersion, APIResources: []metav1.APIResource{
+			{Name: resource, Kind: kind, Namespaced: true},
+			{Name: resource + "/status", Kind: kind, Namespaced: true},
+		}})
+	}
+	return group, lists
+}
+
+func crdObject(name, strategy string) *unstructured.Unstructured {
+	crd := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "apiextensions.k8s.io/v1",
+		"kind":       "CustomResourceDefinition",
+		"metadata":   map[string]interface{}{"name": name},
+		"spec":       map[string]interface{}{},
+	}}
+	if strategy != "" {
+		_ = unstructured.SetNestedField(crd.Object, strategy, "spec", "conversion", "strategy")
+	}
+	return crd
+}
+
+func newTestVersionChecker(crds ...runtime.Object) (*versionChecker, *stubGroupsLister) {
+	lister := &stubGroupsLister{}
+	for _, served := range []struct {
+		group, preferred, kind, resource string
+		versions                         []string
+	}{
+		{"", "v1", "Service", "services", []string{"v1"}},
+		{"networking.k8s.io", "v1", "Ingress", "ingresses", []string{"v1"}},
+		{"stable.example.com", "v2", "Widget", "widgets", []string{"v1", "v2"}},
+		{"hooks.example.com", "v2", "Gadget", "gadgets", []string{"v2"}},
+	} {
+		group, lists := servedGroup(served.group, served.preferred, served.kind, served.resource, served.versions...)
+		lister.groups = append(lister.groups, group)
+		lister.lists = append(lister.lists, lists...)
+	}
+	client := dynamicfake.NewSimpleDynamicClient(runtime.NewScheme(), crds...)
+	return newVersionChecker(lister, client, logrus.New()), lister
+}
+
+func versionedItem(apiVersion, kind string) *unstructured.Unstructured {
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": apiVersion,
+		"kind":       kind,
+		"metadata":   map[string]interface{}{"name": "one", "namespace": "shop"},
+		"spec":       map[string]interface{}{"size": int64(3)},
+	}}
+}
+
+func TestVersionChecker_Check(t *testing.T) {
+	checker, _ := newTestVersionChecker(
+		crdObject("widgets.stable.example.com", ""),
+		crdObject("gadgets.hooks.example.com", "Webhook"),
+	)
+
+	for _, tc := range []struct {
+		name       string
+		item       *unstructured.Unstructured
+		apiVersion string
+		err        string
+	}{
+		{name: "served core version", item: versionedItem("v1", "Service"), apiVersion: "v1"},
+		{name: "served CRD version", item: versionedItem("stable.example.com/v1", "Widget"), apiVersion: "stable.example.com/v1"},
+		{name: "unknown kind", item: versionedItem("other.example.com/v1", "Thing"), apiVersion: "other.example.com/v1"},
+		{name: "CRD without conversion", item: versionedItem("stable.example.com/v1beta1", "Widget"), apiVersion: "stable.example.com/v2"},
+		{name: "CRD converting with a webhook", item: versionedItem("hooks.example.com/v1", "Gadget"), err: "converts versions with a Webhook"},
+		{name: "built-in kind", item: versionedItem("networking.k8s.io/v1beta1", "Ingress"), err: "cannot be read"},
+		{name: "core kind", item: versionedItem("v2", "Service"), err: "serves Service in v1 only, not v2"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			original := tc.item.DeepCopy()
+			out, err := checker.check(tc.item)
+			if tc.err != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tc.err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.apiVersion, out.GetAPIVersion())
+			assert.Equal(t, original.Object["spec"], out.Object["spec"])
+			assert.Equal(t, original, tc.item, "the input is not modified")
+		})
+	}
+}
+
+func TestVersionChecker_Refresh(t *testing.T) {
+	checker, lister := newTestVersionChecker()
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	checker.now = func() time.Time { return now }
+
+	_, err := checker.check(versionedItem("v1", "Service"))
+	require.NoError(t, err)
+	_, err = checker.check(versionedItem("late.example.com/v1", "Late"))
+	require.NoError(t, err)
+	assert.Equal(t, 1, lister.calls, "discovery is not repeated within the refresh delay")
+
+	// the CRD of the kind is restored meanwhile
+	group, lists := servedGroup("late.example.com", "v1", "Late", "lates", "v1")
+	lister.groups = append(lister.groups, group)
+	lister.lists = append(lister.lists, lists...)
+	now = now.Add(servedVersionsRefresh)
+
+	assert.Len(t, checker.versions(versionedItem("late.example.com/v1", "Late").GroupVersionKind()), 1)
+	assert.Equal(t, 2, lister.calls)
+	_, err = checker.check(versionedItem("v1", "Service"))
+	require.NoError(t, err)
+	assert.Equal(t, 2, lister.calls, "served versions never trigger a discovery")
+}
+
+func TestReplacePatternAction_UnservedVersion(t *testing.T) {
+	t.Setenv(stampOriginEnv, "false")
+	checker, _ := newTestVersionChecker(
+		crdObject("widgets.stable.example.com", "None"),
+		crdObject("gadgets.hooks.example.com", "Webhook"),
+	)
+	plugin := &RestorePlugin{logger: logrus.New(), versions: checker}
+	sets := ruleSetsFrom([]v1.ConfigMap{{
+		ObjectMeta: metav1.ObjectMeta{Name: "sizes"},
+		Data:       map[string]string{"small": "large"},
+	}})
+	restore := &velerov1.Restore{ObjectMeta: metav1.ObjectMeta{Name: "dr-1", UID: "uid-1"}}
+
+	widget := versionedItem("stable.example.com/v1beta1", "Widget")
+	output, err := replacePatternAction(plugin, &velero.RestoreItemActionExecuteInput{Item: widget, Restore: restore}, sets)
+	require.NoError(t, err)
+	assert.False(t, output.SkipRestore)
+	assert.Equal(t, "stable.example.com/v2", output.UpdatedItem.(*unstructured.Unstructured).GetAPIVersion())
+
+	gadget := versionedItem("hooks.example.com/v1", "Gadget")
+	output, err = replacePatternAction(plugin, &velero.RestoreItemActionExecuteInput{Item: gadget, Restore: restore}, sets)
+	require.NoError(t, err)
+	assert.True(t, output.SkipRestore)
+}
@@ -0,0 +1,106 @@
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/sirupsen/logrus"
+	"github.com/wrkt/velero-custom-plugins/internal/config"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	corev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+)
+
+const (
+	// configFileEnv is the path of the mounted settings file. It is read from
+	// the environment only.
+	configFileEnv     = "REPLACE_PATTERN_CONFIG_FILE"
+	defaultConfigFile = "/etc/replace-pattern/config.yaml"
+	// settingsConfigMapName is the ConfigMap, in the velero namespace, holding
+	// settings shared by the Velero servers of a cluster.
+	settingsConfigMapName = "replace-pattern-settings"
+)
+
+// SettingsConfigMapName is the ConfigMap holding the settings shared by the
+// Velero servers of a cluster, for the tools reading them too.
+const SettingsConfigMapName = settingsConfigMapName
+
+// lookupFunc returns the value of a setting, and whether it is set, as
+// os.LookupEnv does.
+type lookupFunc func(name string) (string, bool)
+
+// settings are the keys the plugins read, under the same names in every
+// source. The defaults are those the loaders apply when a key is unset.
+var settings = []config.Setting{
+	{Name: maxItemSizeEnv, Validate: config.NonNegativeInt},
+	{Name: maxRulesEnv, Validate: config.NonNegativeInt},
+	{Name: maxTransformLatencyEnv, Validate: config.NonNegativeDuration},
+	{Name: breakerThresholdEnv, Default: fmt.Sprint(defaultBreakerThreshold), Validate: config.NonNegativeInt},
+	{Name: itemTimeoutEnv, Validate: config.NonNegativeDuration},
+	{Name: timeoutPolicyEnv, Default: timeoutRestoreOriginal, Validate: config.OneOf(timeoutRestoreOriginal, timeoutSkip, timeoutFail)},
+	{Name: logSampleRateEnv, Default: "1", Validate: config.Fraction},
+	{Name: logNamespacesEnv, Validate: config.List},
+	{Name: readOnlyEnv, Default: "false", Validate: config.Bool},
+	{Name: recordDirEnv},
+	{Name: lastAppliedEnv, Default: lastAppliedTransform, Validate: config.OneOf(lastAppliedTransform, lastAppliedStrip)},
+	{Name: dnsCheckEnv, Default: "false", Validate: config.Bool},
+	{Name: dnsTimeoutEnv, Default: defaultDNSTimeout.String(), Validate: config.PositiveDuration},
+	{Name: protectedPrefixesEnv, Validate: config.List},
+	{Name: sectionsEnv, Validate: config.List},
+	{Name: sourceClusterEnv},
+	{Name: stampOriginEnv, Default: "true", Validate: config.Bool},
+	{Name: versionPolicyEnv, Default: versionPolicyWarn, Validate: config.OneOf(versionPolicyWarn, versionPolicyRefuse)},
+	{Name: opaURLEnv, Validate: config.URL},
+	{Name: stateStoreEnv, Default: stateStoreConfigMap, Validate: config.OneOf(stateStoreConfigMap, stateStoreObjectStorage)},
+	{Name: scrubScannerURLEnv, Secret: true, Validate: config.URL},
+	{Name: scrubMinItemSizeEnv, Default: fmt.Sprint(defaultScrubMinItemSize), Validate: config.NonNegativeInt},
+	{Name: pipelineEnv, Validate: config.List},
+	{Name: freezeWindowEnv, Validate: config.NonNegativeDuration},
+	{Name: dryRunEnv, Default: "false", Validate: config.Bool},
+	{Name: apiConcurrencyEnv, Default: fmt.Sprint(defaultAPIConcurrency), Validate: config.NonNegativeInt},
+	{Name: apiConcurrencyTotalEnv, Validate: config.NonNegativeInt},
+	{Name: veleroResourcesPolicyEnv, Default: veleroResourcesWarn, Validate: config.OneOf(veleroResourcesWarn, veleroResourcesBlock, veleroResourcesCritical)},
+}
+
+// loadConfig merges, from lowest to highest precedence, the defaults, the
+// settings ConfigMap when configMaps is set, the settings file and the
+// environment, and logs the result.
+func loadConfig(configMaps corev1.ConfigMapInterface, logger logrus.FieldLogger) (*config.Config, error) {
+	var sources []config.Source
+	if configMaps != nil {
+		configMap, err := configMaps.Get(context.TODO(), settingsConfigMapName, metav1.GetOptions{})
+		switch {
+		case err == nil:
+			sources = append(sources, config.Source{Name: "ConfigMap " + settingsConfigMapName, Values: configMap.Data})
+		case !apierrors.IsNotFound(err):
+			return nil, fmt.Errorf("failed to get ConfigMap %s: %v", settingsConfigMapName, err)
+		}
+	}
+
+	path, ok := os.LookupEnv(configFileEnv)
+	if !ok {
+		path = defaultConfigFile
+	}
+	file, err := config.File(path)
+	if err != nil {
+		return nil, err
+	}
+	sources = append(sources, file, config.Environment())
+
+	c, err := config.Load(settings, sources...)
+	if err != nil {
+		return nil, err
+	}
+	c.Dump(logger.Infof)
+	return c, nil
+}
+
+// setting returns the value of a setting in the configuration loaded at
+// startup, or in the environment for plugins built without one.
+func (p *RestorePlugin) setting(name string) (string, bool) {
+	if p.config == nil {
+		return os.LookupEnv(name)
+	}
+	return p.config.Lookup(name)
+}
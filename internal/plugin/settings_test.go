@@ -0,0 +1,113 @@
+package plugin
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestLoadConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(path, []byte("REPLACE_PATTERN_MAX_RULES: 50\nREPLACE_PATTERN_TIMEOUT_POLICY: fail\n"), 0o600))
+	t.Setenv(configFileEnv, path)
+	t.Setenv(timeoutPolicyEnv, timeoutSkip)
+
+	clientset := fake.NewSimpleClientset(&v1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: settingsConfigMapName, Namespace: "velero"},
+		Data: map[string]string{
+			maxRulesEnv:      "10",
+			maxItemSizeEnv:   "2048",
+			timeoutPolicyEnv: timeoutRestoreOriginal,
+		},
+	})
+	c, err := loadConfig(clientset.CoreV1().ConfigMaps("velero"), logrus.New())
+	require.NoError(t, err)
+
+	l := loadLimits(c.Lookup, logrus.New())
+	assert.Equal(t, 2048, l.maxItemSize, "from the ConfigMap")
+	assert.Equal(t, 50, l.maxRules, "the file overrides the ConfigMap")
+	assert.Equal(t, timeoutSkip, l.timeoutPolicy, "the environment overrides the file")
+	assert.Equal(t, defaultBreakerThreshold, l.breakerThreshold)
+
+	// without the ConfigMap
+	c, err = loadConfig(fake.NewSimpleClientset().CoreV1().ConfigMaps("velero"), logrus.New())
+	require.NoError(t, err)
+	assert.Equal(t, 50, loadLimits(c.Lookup, logrus.New()).maxRules)
+
+	t.Setenv(breakerThresholdEnv, "never")
+	_, err = loadConfig(nil, logrus.New())
+	assert.ErrorContains(t, err, breakerThresholdEnv)
+
+	t.Setenv(breakerThresholdEnv, "")
+	require.NoError(t, os.WriteFile(path, []byte("REPLACE_PATTERN_MAX_RULE: 50\n"), 0o600))
+	_, err = loadConfig(nil, logrus.New())
+	assert.ErrorContains(t, err, "unknown setting REPLACE_PATTERN_MAX_RULE")
+}
+
+func TestSettingDefaults(t *testing.T) {
+	// the defaults of the settings are those the loaders apply
+	c, err := loadConfig(nil, logrus.New())
+	require.NoError(t, err)
+	empty := func(string) (string, bool) { return "", false }
+	logger := logrus.New()
+
+	assert.Equal(t, loadLimits(empty, logger), loadLimits(c.Lookup, logger))
+	assert.Equal(t, loadSampler(empty, logger), loadSampler(c.Lookup, logger))
+	assert.Equal(t, loadReadOnly(empty, logger), loadReadOnly(c.Lookup, logger))
+	assert.Equal(t, loadProtectedPrefixes(empty, logger), loadProtectedPrefixes(c.Lookup, logger))
+	assert.Equal(t, loadSections(empty, logger), loadSections(c.Lookup, logger))
+	assert.Equal(t, loadFreezeWindow(empty, logger), loadFreezeWindow(c.Lookup, logger))
+	assert.Equal(t, loadDryRun(empty, logger), loadDryRun(c.Lookup, logger))
+	assert.Equal(t, loadVeleroResourcesPolicy(empty, logger), loadVeleroResourcesPolicy(c.Lookup, logger))
+	assert.Nil(t, loadDNSChecker(c.Lookup, logger))
+}
+
+func TestSettingsRegistered(t *testing.T) {
+	registered := make(map[string]bool)
+	for _, setting := range settings {
+		registered[setting.Name] = true
+	}
+
+	// every *Env constant of the package is a setting: the environment only
+	// passes the registered ones. configFileEnv, which names the file of the
+	// settings, is read from the environment itself.
+	packages, err := parser.ParseDir(token.NewFileSet(), ".", func(info fs.FileInfo) bool {
+		return !strings.HasSuffix(info.Name(), "_test.go")
+	}, 0)
+	require.NoError(t, err)
+	for _, file := range packages["plugin"].Files {
+		for _, decl := range file.Decls {
+			gen, ok := decl.(*ast.GenDecl)
+			if !ok || gen.Tok != token.CONST {
+				continue
+			}
+			for _, spec := range gen.Specs {
+				value := spec.(*ast.ValueSpec)
+				for i, name := range value.Names {
+					if !strings.HasSuffix(name.Name, "Env") || i >= len(value.Values) {
+						continue
+					}
+					literal, ok := value.Values[i].(*ast.BasicLit)
+					if !ok || literal.Kind != token.STRING || name.Name == "configFileEnv" {
+						continue
+					}
+					key, _ := strconv.Unquote(literal.Value)
+					assert.True(t, registered[key], "%s (%s) is not in settings", name.Name, key)
+				}
+			}
+		}
+	}
+}
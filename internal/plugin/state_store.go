@@ -0,0 +1,225 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	velerov1 "github.com/vmware-tanzu/velero/pkg/apis/velero/v1"
+	velerov1client "github.com/vmware-tanzu/velero/pkg/generated/clientset/versioned/typed/velero/v1"
+	"github.com/wrkt/velero-custom-plugins/internal/objectstore"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	corev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+)
+
+const (
+	// stateStoreEnv selects where the state of restores is kept
+	stateStoreEnv           = "REPLACE_PATTERN_STATE_STORE"
+	stateStoreConfigMap     = "configmap"
+	stateStoreObjectStorage = "object-storage"
+
+	// stateObjectPrefix is where, under the prefix of the backup storage
+	// location, the restores keep their state
+	stateObjectPrefix = "replace-pattern/restores"
+	stateObjectName   = "state.json"
+
+	// azureCredentialsFile is the variable Velero's Azure installation sets
+	// to the file of its credentials, which the SDK does not read
+	azureCredentialsFile = "AZURE_CREDENTIALS_FILE"
+)
+
+// objectStoreProviders open the buckets of the storage locations, by provider
+// without its velero.io/ prefix. The credentials are the content of the
+// secret of the location, nil to use the default credential chain of the
+// provider.
+var objectStoreProviders = map[string]func(location *velerov1.BackupStorageLocation, credentials []byte) (objectStore, error){
+	"aws":   newS3Objects,
+	"gcp":   newGCSObjects,
+	"azure": newAzureObjects,
+}
+
+// objectStore reads and writes objects of a bucket.
+type objectStore interface {
+	Get(ctx context.Context, key string) ([]byte, error)
+	Put(ctx context.Context, key string, data []byte) error
+	URL(key string) string
+}
+
+// reportStore keeps the documents of the report of a restore in object
+// storage.
+type reportStore struct {
+	objects objectStore
+	key     string
+}
+
+// storedReport is the object holding the documents of a report.
+type storedReport struct {
+	UID  types.UID         `json:"uid"`
+	Data map[string]string `json:"data"`
+}
+
+// load returns the documents of the report and the UID of its restore, nil
+// when there are none.
+func (s *reportStore) load() (map[string]string, types.UID, error) {
+	data, err := s.objects.Get(context.TODO(), s.key)
+	if errors.Is(err, objectstore.ErrNotFound) {
+		return nil, "", nil
+	}
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to get %s: %v", s.url(), err)
+	}
+	var stored storedReport
+	if err := json.Unmarshal(data, &stored); err != nil {
+		return nil, "", fmt.Errorf("failed to decode %s: %v", s.url(), err)
+	}
+	return stored.Data, stored.UID, nil
+}
+
+func (s *reportStore) save(uid types.UID, data map[string]string) error {
+	content, err := json.Marshal(storedReport{UID: uid, Data: data})
+	if err != nil {
+		return fmt.Errorf("failed to encode %s: %v", s.url(), err)
+	}
+	if err := s.objects.Put(context.TODO(), s.key, content); err != nil {
+		return fmt.Errorf("failed to write %s: %v", s.url(), err)
+	}
+	return nil
+}
+
+func (s *reportStore) url() string {
+	return s.objects.URL(s.key)
+}
+
+// reportStores opens the report store of a restore.
+type reportStores interface {
+	open(restore *velerov1.Restore) (*reportStore, error)
+}
+
+// storageLocations opens the report stores in the backup storage location of
+// the backup of the restores.
+type storageLocations struct {
+	backups   velerov1client.BackupInterface
+	locations velerov1client.BackupStorageLocationInterface
+	secrets   corev1.SecretInterface
+	// newObjects opens the bucket of a location with the provider of
+	// objectStoreProviders
+	newObjects func(location *velerov1.BackupStorageLocation, credentials []byte) (objectStore, error)
+}
+
+// loadReportStores returns the report stores selected by
+// REPLACE_PATTERN_STATE_STORE, nil when the state is kept in ConfigMaps.
+func loadReportStores(lookup lookupFunc, logger logrus.FieldLogger, velero velerov1client.VeleroV1Interface, secrets corev1.SecretInterface) reportStores {
+	if store, _ := lookup(stateStoreEnv); store != stateStoreObjectStorage {
+		return nil
+	}
+	logger.Infof("Keeping the state of the restores in the backup storage locations")
+	return &storageLocations{
+		backups:   velero.Backups("velero"),
+		locations: velero.BackupStorageLocations("velero"),
+		secrets:   secrets,
+		newObjects: func(location *velerov1.BackupStorageLocation, credentials []byte) (objectStore, error) {
+			return objectStoreProviders[locationProvider(location)](location, credentials)
+		},
+	}
+}
+
+func (l *storageLocations) open(restore *velerov1.Restore) (*reportStore, error) {
+	backup, err := l.backups.Get(context.TODO(), restore.Spec.BackupName, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get backup %s: %v", restore.Spec.BackupName, err)
+	}
+	name := backup.Spec.StorageLocation
+	if name == "" {
+		name = "default"
+	}
+	location, err := l.locations.Get(context.TODO(), name, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get backup storage location %s: %v", name, err)
+	}
+	if objectStoreProviders[locationProvider(location)] == nil {
+		return nil, fmt.Errorf("backup storage location %s uses provider %s, only aws, gcp and azure are supported", name, location.Spec.Provider)
+	}
+	if location.Spec.ObjectStorage == nil {
+		return nil, fmt.Errorf("backup storage location %s has no object storage", name)
+	}
+
+	var credentials []byte
+	if selector := location.Spec.Credential; selector != nil {
+		secret, err := l.secrets.Get(context.TODO(), selector.Name, metav1.GetOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("failed to get secret %s: %v", selector.Name, err)
+		}
+		if credentials = secret.Data[selector.Key]; credentials == nil {
+			return nil, fmt.Errorf("secret %s has no key %s", selector.Name, selector.Key)
+		}
+	}
+	objects, err := l.newObjects(location, credentials)
+	if err != nil {
+		return nil, fmt.Errorf("backup storage location %s: %v", name, err)
+	}
+	key := path.Join(location.Spec.ObjectStorage.Prefix, stateObjectPrefix, restore.Name, stateObjectName)
+	return &reportStore{objects: objects, key: key}, nil
+}
+
+// locationProvider returns the provider of a location without its velero.io/
+// prefix.
+func locationProvider(location *velerov1.BackupStorageLocation) string {
+	return strings.TrimPrefix(location.Spec.Provider, "velero.io/")
+}
+
+// newS3Objects returns the bucket of a location, configured as Velero's AWS
+// provider reads it.
+func newS3Objects(location *velerov1.BackupStorageLocation, credentials []byte) (objectStore, error) {
+	options := location.Spec.Config
+	region := options["region"]
+	if region == "" && options["s3Url"] != "" {
+		// S3-compatible services mostly ignore the region
+		region = "us-east-1"
+	}
+	var pathStyle bool
+	if value := options["s3ForcePathStyle"]; value != "" {
+		var err error
+		if pathStyle, err = strconv.ParseBool(value); err != nil {
+			return nil, fmt.Errorf("invalid s3ForcePathStyle %q: %v", value, err)
+		}
+	}
+	return objectstore.NewS3(context.TODO(), objectstore.S3Options{
+		Bucket:      location.Spec.ObjectStorage.Bucket,
+		Region:      region,
+		Endpoint:    options["s3Url"],
+		PathStyle:   pathStyle,
+		Credentials: credentials,
+		Profile:     options["profile"],
+	})
+}
+
+// newGCSObjects returns the bucket of a location of Velero's GCP provider.
+func newGCSObjects(location *velerov1.BackupStorageLocation, credentials []byte) (objectStore, error) {
+	return objectstore.NewGCS(context.TODO(), location.Spec.ObjectStorage.Bucket, credentials)
+}
+
+// newAzureObjects returns the container of a location, configured as Velero's
+// Azure provider reads it.
+func newAzureObjects(location *velerov1.BackupStorageLocation, credentials []byte) (objectStore, error) {
+	if file := os.Getenv(azureCredentialsFile); credentials == nil && file != "" {
+		var err error
+		if credentials, err = os.ReadFile(file); err != nil {
+			return nil, fmt.Errorf("failed to read credentials: %v", err)
+		}
+	}
+	options := location.Spec.Config
+	return objectstore.NewAzure(objectstore.AzureOptions{
+		Container:          location.Spec.ObjectStorage.Bucket,
+		Account:            options["storageAccount"],
+		AccountURI:         options["storageAccountURI"],
+		Credentials:        objectstore.ParseAzureCredentials(credentials),
+		AccountKeyVariable: options["storageAccountKeyEnvVar"],
+	})
+}
@@ -0,0 +1,233 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	velerov1 "github.com/vmware-tanzu/velero/pkg/apis/velero/v1"
+	velerofake "github.com/vmware-tanzu/velero/pkg/generated/clientset/versioned/fake"
+	"github.com/wrkt/velero-custom-plugins/internal/objectstore"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// memoryObjects is an in-memory bucket.
+type memoryObjects map[string][]byte
+
+func (m memoryObjects) Get(_ context.Context, key string) ([]byte, error) {
+	data, ok := m[key]
+	if !ok {
+		return nil, objectstore.ErrNotFound
+	}
+	return data, nil
+}
+
+func (m memoryObjects) Put(_ context.Context, key string, data []byte) error {
+	m[key] = data
+	return nil
+}
+
+func (m memoryObjects) URL(key string) string {
+	return "s3://backups/" + key
+}
+
+// fixedReportStores opens the stores of every restore in the same bucket.
+type fixedReportStores struct {
+	objects memoryObjects
+}
+
+func (f fixedReportStores) open(restore *velerov1.Restore) (*reportStore, error) {
+	return &reportStore{objects: f.objects, key: "velero/" + stateObjectPrefix + "/" + restore.Name + "/" + stateObjectName}, nil
+}
+
+func storageLocation(name, provider string, credential *corev1.SecretKeySelector) *velerov1.BackupStorageLocation {
+	return &velerov1.BackupStorageLocation{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "velero"},
+		Spec: velerov1.BackupStorageLocationSpec{
+			Provider:    provider,
+			StorageType: velerov1.StorageType{ObjectStorage: &velerov1.ObjectStorageLocation{Bucket: "backups", Prefix: "cluster-a"}},
+			Config:      map[string]string{"region": "eu-west-3", "profile": "backups"},
+			Credential:  credential,
+		},
+	}
+}
+
+func TestStorageLocations_Open(t *testing.T) {
+	credentials := "[backups]\naws_access_key_id = AKID\naws_secret_access_key = secret\n"
+	file := filepath.Join(t.TempDir(), "cloud")
+	require.NoError(t, os.WriteFile(file, []byte("[backups]\naws_access_key_id = FILE\naws_secret_access_key = secret\n"), 0o600))
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", file)
+
+	velero := velerofake.NewSimpleClientset(
+		&velerov1.Backup{ObjectMeta: metav1.ObjectMeta{Name: "nightly", Namespace: "velero"}, Spec: velerov1.BackupSpec{StorageLocation: "primary"}},
+		&velerov1.Backup{ObjectMeta: metav1.ObjectMeta{Name: "weekly", Namespace: "velero"}},
+		&velerov1.Backup{ObjectMeta: metav1.ObjectMeta{Name: "archive", Namespace: "velero"}, Spec: velerov1.BackupSpec{StorageLocation: "swift"}},
+		storageLocation("primary", "velero.io/aws", &corev1.SecretKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: "bsl-primary"}, Key: "cloud"}),
+		storageLocation("default", "aws", nil),
+		storageLocation("swift", "velero.io/openstack", nil),
+	)
+	secrets := fake.NewSimpleClientset(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "bsl-primary", Namespace: "velero"},
+		Data:       map[string][]byte{"cloud": []byte(credentials)},
+	}).CoreV1().Secrets("velero")
+
+	var opened [][]byte
+	locations := &storageLocations{
+		backups:   velero.VeleroV1().Backups("velero"),
+		locations: velero.VeleroV1().BackupStorageLocations("velero"),
+		secrets:   secrets,
+		newObjects: func(location *velerov1.BackupStorageLocation, credentials []byte) (objectStore, error) {
+			opened = append(opened, credentials)
+			return newS3Objects(location, credentials)
+		},
+	}
+
+	store, err := locations.open(&velerov1.Restore{ObjectMeta: metav1.ObjectMeta{Name: "dr-1"}, Spec: velerov1.RestoreSpec{BackupName: "nightly"}})
+	require.NoError(t, err)
+	assert.Equal(t, "s3://backups/cluster-a/replace-pattern/restores/dr-1/state.json", store.url())
+	store, err = locations.open(&velerov1.Restore{ObjectMeta: metav1.ObjectMeta{Name: "dr-2"}, Spec: velerov1.RestoreSpec{BackupName: "weekly"}})
+	require.NoError(t, err)
+	assert.Equal(t, "cluster-a/replace-pattern/restores/dr-2/state.json", store.key)
+	assert.Equal(t, [][]byte{[]byte(credentials), nil}, opened, "without secret, the default credential chain is used")
+
+	for _, backup := range []string{"archive", "missing"} {
+		_, err = locations.open(&velerov1.Restore{ObjectMeta: metav1.ObjectMeta{Name: "dr-3"}, Spec: velerov1.RestoreSpec{BackupName: backup}})
+		assert.Error(t, err, backup)
+	}
+}
+
+func TestObjectStoreProviders(t *testing.T) {
+	t.Setenv("AWS_ACCESS_KEY_ID", "AKID")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+	location := storageLocation("minio", "aws", nil)
+	location.Spec.Config = map[string]string{"s3Url": "http://minio.velero.svc:9000", "s3ForcePathStyle": "true"}
+	objects, err := objectStoreProviders["aws"](location, nil)
+	require.NoError(t, err, "S3-compatible services default the region")
+	assert.Equal(t, "s3://backups/key", objects.URL("key"))
+	location.Spec.Config["s3ForcePathStyle"] = "yes please"
+	_, err = objectStoreProviders["aws"](location, nil)
+	assert.Error(t, err)
+	location.Spec.Config = nil
+	_, err = objectStoreProviders["aws"](location, nil)
+	assert.Error(t, err, "the region is required on AWS")
+
+	location = storageLocation("blobs", "velero.io/azure", nil)
+	location.Spec.Config = map[string]string{"storageAccount": "account", "storageAccountKeyEnvVar": "KEY"}
+	objects, err = objectStoreProviders[locationProvider(location)](location, []byte("KEY=a2V5\n"))
+	require.NoError(t, err)
+	assert.Equal(t, "azure://account/backups/key", objects.URL("key"))
+	location.Spec.Config = nil
+	_, err = objectStoreProviders["azure"](location, nil)
+	assert.Error(t, err, "the storage account is required")
+
+	location = storageLocation("gcs", "velero.io/gcp", nil)
+	_, err = objectStoreProviders["gcp"](location, []byte("not a key"))
+	assert.Error(t, err)
+}
+
+func TestResumeReport_ObjectStorage(t *testing.T) {
+	objects := memoryObjects{}
+	configMaps := fake.NewSimpleClientset().CoreV1().ConfigMaps("velero")
+	plugin := &RestorePlugin{logger: logrus.New(), configMapClient: configMaps, reportStores: fixedReportStores{objects: objects}}
+	restore := &velerov1.Restore{ObjectMeta: metav1.ObjectMeta{Name: "dr-1", UID: "uid-1"}}
+
+	report := plugin.stateFor(restore).report
+	report.recordItem(true, false)
+	report.recordHit(pattern1, "Ingress", "web", 2)
+	report.recordApplied(pattern1, replacement1)
+	report.recordRename(item("", "Service", "web", "foo"), item("", "Service", "web", "bar"))
+	require.NoError(t, plugin.flushReport(report))
+
+	_, err := configMaps.Get(context.TODO(), "dr-1-replace-pattern-report", metav1.GetOptions{})
+	assert.True(t, apierrors.IsNotFound(err), "the report is only written to object storage")
+	var stored storedReport
+	require.NoError(t, json.Unmarshal(objects["velero/replace-pattern/restores/dr-1/state.json"], &stored))
+	assert.Equal(t, "uid-1", string(stored.UID))
+	assert.Contains(t, stored.Data[reportSummaryKey], `"itemsProcessed":1`)
+	assert.Contains(t, stored.Data[reportRenamesKey], `"bar"`)
+
+	// the plugin restarts in the middle of the restore
+	plugin.states = nil
+	resumed := plugin.stateFor(restore).report
+	assert.Equal(t, reportSummary{Restore: "dr-1", ItemsProcessed: 1, ItemsModified: 1, Hits: 2}, resumed.summary)
+	assert.Equal(t, map[string]string{pattern1: replacement1}, resumed.applied)
+	_, name, ok := resumed.renamed("", "Service", "web", "foo")
+	assert.True(t, ok)
+	assert.Equal(t, "bar", name)
+
+	// a later restore of the same name starts afresh
+	plugin.states = nil
+	recreated := &velerov1.Restore{ObjectMeta: metav1.ObjectMeta{Name: "dr-1", UID: "uid-2"}}
+	assert.Equal(t, reportSummary{Restore: "dr-1"}, plugin.stateFor(recreated).report.summary)
+}
+
+// failingObjects is a bucket that cannot be written.
+type failingObjects struct {
+	memoryObjects
+}
+
+func (failingObjects) Put(context.Context, string, []byte) error {
+	return errors.New("access denied")
+}
+
+func TestFlushReport_StoreFallback(t *testing.T) {
+	configMaps := fake.NewSimpleClientset().CoreV1().ConfigMaps("velero")
+	plugin := &RestorePlugin{logger: logrus.New(), configMapClient: configMaps}
+	restore := &velerov1.Restore{ObjectMeta: metav1.ObjectMeta{Name: "dr-1", UID: "uid-1"}}
+	report := plugin.stateFor(restore).report
+	report.store = &reportStore{objects: failingObjects{memoryObjects{}}, key: "velero/state.json"}
+	report.recordItem(true, false)
+	report.recordRename(item("", "Service", "web", "foo"), item("", "Service", "web", "bar"))
+	require.NoError(t, plugin.flushReport(report))
+
+	configMap, err := configMaps.Get(context.TODO(), "dr-1-replace-pattern-report", metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.Contains(t, configMap.Data[reportSummaryKey], `"itemsProcessed":1`)
+	assert.Contains(t, configMap.Data[reportRenamesKey], `"bar"`)
+
+	// the store, empty, falls back to the ConfigMap on resume
+	plugin.states = nil
+	plugin.reportStores = fixedReportStores{objects: memoryObjects{}}
+	resumed := plugin.stateFor(restore).report
+	assert.Equal(t, 1, resumed.summary.ItemsProcessed)
+}
+
+// blockingReportStores opens the store of restore slow once released.
+type blockingReportStores struct {
+	fixedReportStores
+	release chan struct{}
+}
+
+func (b blockingReportStores) open(restore *velerov1.Restore) (*reportStore, error) {
+	if restore.Name == "slow" {
+		<-b.release
+	}
+	return b.fixedReportStores.open(restore)
+}
+
+func TestStateFor_OpensStoresOutsideTheLock(t *testing.T) {
+	stores := blockingReportStores{fixedReportStores: fixedReportStores{objects: memoryObjects{}}, release: make(chan struct{})}
+	plugin := &RestorePlugin{logger: logrus.New(), reportStores: stores}
+	slow := &velerov1.Restore{ObjectMeta: metav1.ObjectMeta{Name: "slow", UID: "uid-slow"}}
+
+	states := make(chan *restoreState, 2)
+	for i := 0; i < 2; i++ {
+		go func() { states <- plugin.stateFor(slow) }()
+	}
+	fast := plugin.stateFor(&velerov1.Restore{ObjectMeta: metav1.ObjectMeta{Name: "fast", UID: "uid-fast"}})
+	assert.Equal(t, "fast", fast.report.summary.Restore, "other restores do not wait for the store of slow")
+
+	close(stores.release)
+	first, second := <-states, <-states
+	assert.Same(t, first, second, "racing items share the state inserted first")
+	assert.Same(t, first, plugin.stateFor(slow))
+}
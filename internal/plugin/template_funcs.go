@@ -0,0 +1,213 @@
+package plugin
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base32"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"hash/adler32"
+	"regexp"
+	"strings"
+	"sync"
+	"text/template"
+
+	"github.com/wrkt/velero-custom-plugins/internal/transform"
+)
+
+// templateFuncs are the functions of templates: those of the sprig library
+// that derive a value from their arguments, with the same names and argument
+// order, the piped value last. The functions depending on the time or on
+// randomness are left out, a template rendering the same for an item on
+// every attempt. The functions take any value, .Restore and .Backup
+// included, as a string.
+var templateFuncs = template.FuncMap{
+	// strings
+	"lower":      func(s interface{}) string { return strings.ToLower(fmt.Sprint(s)) },
+	"upper":      func(s interface{}) string { return strings.ToUpper(fmt.Sprint(s)) },
+	"trim":       func(s interface{}) string { return strings.TrimSpace(fmt.Sprint(s)) },
+	"trimAll":    func(cutset string, s interface{}) string { return strings.Trim(fmt.Sprint(s), cutset) },
+	"trimPrefix": func(prefix string, s interface{}) string { return strings.TrimPrefix(fmt.Sprint(s), prefix) },
+	"trimSuffix": func(suffix string, s interface{}) string { return strings.TrimSuffix(fmt.Sprint(s), suffix) },
+	"replace":    func(old, new string, s interface{}) string { return strings.ReplaceAll(fmt.Sprint(s), old, new) },
+	"repeat":     func(count int, s interface{}) string { return strings.Repeat(fmt.Sprint(s), count) },
+	"trunc":      trunc,
+	"substr":     substr,
+	"nospace":    func(s interface{}) string { return strings.Join(strings.Fields(fmt.Sprint(s)), "") },
+	"quote":      func(s interface{}) string { return fmt.Sprintf("%q", fmt.Sprint(s)) },
+	"squote":     func(s interface{}) string { return "'" + fmt.Sprint(s) + "'" },
+	"contains":   func(substr string, s interface{}) bool { return strings.Contains(fmt.Sprint(s), substr) },
+	"hasPrefix":  func(prefix string, s interface{}) bool { return strings.HasPrefix(fmt.Sprint(s), prefix) },
+	"hasSuffix":  func(suffix string, s interface{}) bool { return strings.HasSuffix(fmt.Sprint(s), suffix) },
+	"splitList":  func(sep string, s interface{}) []string { return strings.Split(fmt.Sprint(s), sep) },
+	"join":       join,
+	"default":    defaultValue,
+	"empty":      empty,
+
+	// regular expressions
+	"regexMatch":      regexMatch,
+	"regexFind":       regexFind,
+	"regexReplaceAll": regexReplaceAll,
+
+	// encodings
+	"b64enc": func(s interface{}) string { return base64.StdEncoding.EncodeToString([]byte(fmt.Sprint(s))) },
+	"b64dec": func(s interface{}) (string, error) {
+		decoded, err := base64.StdEncoding.DecodeString(fmt.Sprint(s))
+		return string(decoded), err
+	},
+	"b32enc": func(s interface{}) string { return base32.StdEncoding.EncodeToString([]byte(fmt.Sprint(s))) },
+	"b32dec": func(s interface{}) (string, error) {
+		decoded, err := base32.StdEncoding.DecodeString(fmt.Sprint(s))
+		return string(decoded), err
+	},
+
+	// hashes, hex encoded
+	"sha1sum": func(s interface{}) string {
+		sum := sha1.Sum([]byte(fmt.Sprint(s)))
+		return hex.EncodeToString(sum[:])
+	},
+	"sha256sum": func(s interface{}) string {
+		sum := sha256.Sum256([]byte(fmt.Sprint(s)))
+		return hex.EncodeToString(sum[:])
+	},
+	"sha512sum": func(s interface{}) string {
+		sum := sha512.Sum512([]byte(fmt.Sprint(s)))
+		return hex.EncodeToString(sum[:])
+	},
+	"adler32sum": func(s interface{}) string { return fmt.Sprint(adler32.Checksum([]byte(fmt.Sprint(s)))) },
+}
+
+// trunc keeps the first n bytes of s, or the last -n when n is negative.
+func trunc(n int, s interface{}) string {
+	str := fmt.Sprint(s)
+	switch {
+	case n >= 0 && len(str) > n:
+		return str[:n]
+	case n < 0 && len(str) > -n:
+		return str[len(str)+n:]
+	}
+	return str
+}
+
+// substr returns the bytes of s from start to end, to its end when end is
+// negative.
+func substr(start, end int, s interface{}) string {
+	str := fmt.Sprint(s)
+	if start < 0 {
+		start = 0
+	}
+	if end < 0 || end > len(str) {
+		end = len(str)
+	}
+	if start > end {
+		return ""
+	}
+	return str[start:end]
+}
+
+// join joins the elements of list, a list of any values, with sep.
+func join(sep string, list interface{}) string {
+	switch list := list.(type) {
+	case []string:
+		return strings.Join(list, sep)
+	case []interface{}:
+		parts := make([]string, 0, len(list))
+		for _, part := range list {
+			parts = append(parts, fmt.Sprint(part))
+		}
+		return strings.Join(parts, sep)
+	default:
+		return fmt.Sprint(list)
+	}
+}
+
+// defaultValue returns value, or def when value is empty.
+func defaultValue(def interface{}, value ...interface{}) interface{} {
+	if len(value) == 0 || empty(value[0]) {
+		return def
+	}
+	return value[0]
+}
+
+// empty reports whether value is missing, false, zero or empty.
+func empty(value interface{}) bool {
+	switch value := value.(type) {
+	case nil:
+		return true
+	case string:
+		return value == ""
+	case bool:
+		return !value
+	case int:
+		return value == 0
+	case int64:
+		return value == 0
+	case float64:
+		return value == 0
+	case []interface{}:
+		return len(value) == 0
+	case map[string]interface{}:
+		return len(value) == 0
+	case map[string]string:
+		return len(value) == 0
+	default:
+		return fmt.Sprint(value) == ""
+	}
+}
+
+// maxTemplateRegexes bounds the compiled expressions templateRegexes keeps,
+// templates possibly building them from the items.
+const maxTemplateRegexes = 256
+
+// templateRegexes caches the expressions of the regex functions, validated as
+// those of the regex rules, by pattern.
+var templateRegexes = struct {
+	sync.Mutex
+	compiled map[string]*regexp.Regexp
+}{compiled: make(map[string]*regexp.Regexp)}
+
+// compileTemplateRegex returns the compiled expr.
+func compileTemplateRegex(expr string) (*regexp.Regexp, error) {
+	templateRegexes.Lock()
+	defer templateRegexes.Unlock()
+	if re, ok := templateRegexes.compiled[expr]; ok {
+		return re, nil
+	}
+	if err := transform.ValidateRegex(expr); err != nil {
+		return nil, err
+	}
+	if len(templateRegexes.compiled) >= maxTemplateRegexes {
+		templateRegexes.compiled = make(map[string]*regexp.Regexp)
+	}
+	re := regexp.MustCompile(expr)
+	templateRegexes.compiled[expr] = re
+	return re, nil
+}
+
+func regexMatch(expr string, s interface{}) (bool, error) {
+	re, err := compileTemplateRegex(expr)
+	if err != nil {
+		return false, err
+	}
+	return re.MatchString(fmt.Sprint(s)), nil
+}
+
+func regexFind(expr string, s interface{}) (string, error) {
+	re, err := compileTemplateRegex(expr)
+	if err != nil {
+		return "", err
+	}
+	return re.FindString(fmt.Sprint(s)), nil
+}
+
+// regexReplaceAll replaces the matches of expr in s. As in sprig, a piped
+// value is the replacement.
+func regexReplaceAll(expr string, s interface{}, replacement string) (string, error) {
+	re, err := compileTemplateRegex(expr)
+	if err != nil {
+		return "", err
+	}
+	return re.ReplaceAllString(fmt.Sprint(s), replacement), nil
+}
@@ -0,0 +1,66 @@
+package plugin
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTemplateFuncs(t *testing.T) {
+	data := templateData{
+		Restore: restoreData{Name: "dr-1"},
+		Env:     map[string]string{"REGION": " eu-west-1 ", "EMPTY": ""},
+	}
+	for text, expected := range map[string]string{
+		`{{ .Env.REGION | trim }}`:                          "eu-west-1",
+		`{{ .Env.REGION | trimAll " 1" }}`:                  "eu-west-",
+		`{{ .Restore | replace "-" "." | upper }}`:          "DR.1",
+		`{{ .Restore | b64enc }}`:                           "ZHItMQ==",
+		`{{ "ZHItMQ==" | b64dec }}`:                         "dr-1",
+		`{{ .Restore | b32enc }}`:                           "MRZC2MI=",
+		`{{ .Restore | sha256sum | trunc 8 }}`:              "a930ff90",
+		`{{ .Restore | sha1sum | trunc -4 }}`:               "db26",
+		`{{ .Restore | adler32sum }}`:                       "57999669",
+		`{{ .Restore | substr 0 2 }}`:                       "dr",
+		`{{ .Restore | repeat 2 | quote }}`:                 `"dr-1dr-1"`,
+		`{{ .Env.EMPTY | default "none" }}`:                 "none",
+		`{{ .Restore | default "none" }}`:                   "dr-1",
+		`{{ .Restore | splitList "-" | join "_" }}`:         "dr_1",
+		`{{ if .Restore | hasPrefix "dr-" }}dr{{ end }}`:    "dr",
+		`{{ .Restore | regexFind "[0-9]+" }}`:               "1",
+		`{{ regexReplaceAll "-([0-9]+)$" .Restore ".$1" }}`: "dr.1",
+		`{{ if regexMatch "^dr-" .Restore }}dr{{ end }}`:    "dr",
+	} {
+		rendered, err := renderTemplate("key", text, data)
+		require.NoError(t, err, text)
+		assert.Equal(t, expected, rendered, text)
+	}
+
+	_, err := renderTemplate("key", `{{ "not base64" | b64dec }}`, data)
+	assert.ErrorContains(t, err, "failed to render the template")
+	_, err = renderTemplate("key", `{{ .Restore | regexFind "(" }}`, data)
+	assert.ErrorContains(t, err, "failed to render the template")
+	_, err = renderTemplate("key", `{{ .Restore | regexFind "(abcdefghij|klmnopqrst){1,1000}" }}`, data)
+	assert.ErrorContains(t, err, "too complex", "expressions have the limits of regex rules")
+	_, err = renderTemplate("key", `{{ .Restore | randAlphaNum 8 }}`, data)
+	assert.ErrorContains(t, err, `function "randAlphaNum" not defined`, "functions depending on randomness are left out")
+}
+
+func TestCompileTemplateRegex(t *testing.T) {
+	re, err := compileTemplateRegex("^dr-[0-9]+$")
+	require.NoError(t, err)
+	again, err := compileTemplateRegex("^dr-[0-9]+$")
+	require.NoError(t, err)
+	assert.Same(t, re, again, "compiled once")
+
+	_, err = compileTemplateRegex("(?=dr)")
+	assert.ErrorContains(t, err, "lookahead")
+
+	for i := 0; i < maxTemplateRegexes+1; i++ {
+		_, err := compileTemplateRegex(fmt.Sprintf("^dr-%d$", i))
+		require.NoError(t, err)
+	}
+	assert.LessOrEqual(t, len(templateRegexes.compiled), maxTemplateRegexes)
+}
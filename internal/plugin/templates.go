@@ -0,0 +1,119 @@
+package plugin
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"text/template"
+
+	"github.com/vmware-tanzu/velero/pkg/plugin/velero"
+)
+
+const (
+	// templatesAnnotation, when true, makes the replacements of a pattern
+	// ConfigMap Go templates, rendered for every item.
+	templatesAnnotation = "agoracalyce.io/templates"
+
+	// templateVarPrefix prefixes the environment variables templates see, in
+	// Env without the prefix. The others, credentials included, stay hidden.
+	templateVarPrefix = "REPLACE_PATTERN_VAR_"
+)
+
+// templateData is what replacement templates are rendered with.
+type templateData struct {
+	// Item is the item as Velero passes it, before the rules
+	Item             map[string]interface{}
+	Restore          restoreData
+	Backup           backupData
+	NamespaceMapping map[string]string
+	Env              map[string]string
+}
+
+// restoreData renders as the name of the Restore, as .Restore did when it
+// was a string.
+type restoreData struct {
+	Name string
+	UID  string
+}
+
+func (r restoreData) String() string {
+	return r.Name
+}
+
+// backupData renders as the name of the backup restored.
+type backupData struct {
+	Name string
+	// Schedule is the schedule the backup was taken by, empty for manual
+	// backups
+	Schedule string
+}
+
+func (b backupData) String() string {
+	return b.Name
+}
+
+// scheduledBackupName matches the names Velero gives scheduled backups, the
+// schedule name followed by the creation time.
+var scheduledBackupName = regexp.MustCompile(`^(.+)-[0-9]{14}$`)
+
+// newTemplateData returns the data templates are rendered with for an item.
+func newTemplateData(input *velero.RestoreItemActionExecuteInput) templateData {
+	data := templateData{
+		Item: input.Item.UnstructuredContent(),
+		Env:  make(map[string]string),
+	}
+	if input.Restore != nil {
+		data.Restore = restoreData{Name: input.Restore.Name, UID: string(input.Restore.UID)}
+		data.NamespaceMapping = input.Restore.Spec.NamespaceMapping
+		data.Backup = backupData{Name: input.Restore.Spec.BackupName, Schedule: input.Restore.Spec.ScheduleName}
+		if match := scheduledBackupName.FindStringSubmatch(data.Backup.Name); data.Backup.Schedule == "" && match != nil {
+			data.Backup.Schedule = match[1]
+		}
+	}
+	for _, variable := range os.Environ() {
+		name, value, _ := strings.Cut(variable, "=")
+		if strings.HasPrefix(name, templateVarPrefix) {
+			data.Env[strings.TrimPrefix(name, templateVarPrefix)] = value
+		}
+	}
+	return data
+}
+
+// renderPatterns returns the patterns of the set with their replacements
+// rendered. A reference to a missing key fails the rendering.
+func (s ruleSet) renderPatterns(data templateData) (map[string]string, error) {
+	rendered := make(map[string]string, len(s.patterns))
+	for pattern, replacement := range s.patterns {
+		value, err := renderTemplate(pattern, replacement, data)
+		if err != nil {
+			return nil, err
+		}
+		rendered[pattern] = value
+	}
+	return rendered, nil
+}
+
+// parseTemplate parses the template text of the value of key.
+func parseTemplate(key, text string) (*template.Template, error) {
+	tmpl, err := template.New(key).Funcs(templateFuncs).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid template for %q: %v", key, err)
+	}
+	return tmpl, nil
+}
+
+// renderTemplate renders the template text of the value of key. A reference
+// to a missing key fails the rendering.
+func renderTemplate(key, text string, data templateData) (string, error) {
+	tmpl, err := parseTemplate(key, text)
+	if err != nil {
+		return "", err
+	}
+	var b bytes.Buffer
+	if err := tmpl.Execute(&b, data); err != nil {
+		return "", fmt.Errorf("failed to render the template for %q: %v", key, err)
+	}
+	return b.String(), nil
+}
@@ -0,0 +1,78 @@
+package plugin
+
+import (
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	velerov1 "github.com/vmware-tanzu/velero/pkg/apis/velero/v1"
+	"github.com/vmware-tanzu/velero/pkg/plugin/velero"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestReplacePatternAction_Templates(t *testing.T) {
+	t.Setenv(stampOriginEnv, "false")
+	t.Setenv(templateVarPrefix+"REGION", "eu-west-1")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+	plugin := &RestorePlugin{logger: logrus.New()}
+	templated := map[string]string{templatesAnnotation: "true"}
+	sets := ruleSetsFrom([]v1.ConfigMap{
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "hosts", Annotations: templated},
+			Data: map[string]string{
+				"db.example.com": "db.{{ .Item.metadata.namespace }}.{{ .Env.REGION }}.example.com",
+				"prod-cache":     "{{ .Restore | upper }}-cache",
+				"legacy":         `{{ index .NamespaceMapping "legacy" }}`,
+			},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "typo", Annotations: templated},
+			Data:       map[string]string{"web": "{{ .Env.AWS_SECRET_ACCESS_KEY }}"},
+		},
+	})
+	restore := &velerov1.Restore{
+		ObjectMeta: metav1.ObjectMeta{Name: "dr-1", UID: "uid-1"},
+		Spec:       velerov1.RestoreSpec{NamespaceMapping: map[string]string{"legacy": "modern"}},
+	}
+
+	item := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "ConfigMap",
+		"metadata":   map[string]interface{}{"name": "web", "namespace": "shop"},
+		"data":       map[string]interface{}{"db": "db.example.com", "cache": "prod-cache", "ns": "legacy"},
+	}}
+	output, err := replacePatternAction(plugin, &velero.RestoreItemActionExecuteInput{Item: item, Restore: restore}, sets)
+	require.NoError(t, err)
+	result := output.UpdatedItem.(*unstructured.Unstructured)
+	assert.Equal(t, "web", result.GetName())
+	assert.Equal(t, map[string]interface{}{"db": "db.shop.eu-west-1.example.com", "cache": "DR-1-cache", "ns": "modern"}, result.Object["data"])
+	assert.Empty(t, plugin.stateFor(restore).report.applied)
+}
+
+func TestNewTemplateData_Provenance(t *testing.T) {
+	item := &unstructured.Unstructured{Object: map[string]interface{}{"kind": "ConfigMap"}}
+	restore := &velerov1.Restore{
+		ObjectMeta: metav1.ObjectMeta{Name: "dr-1", UID: "uid-1"},
+		Spec:       velerov1.RestoreSpec{BackupName: "nightly-20240501020000"},
+	}
+	data := newTemplateData(&velero.RestoreItemActionExecuteInput{Item: item, Restore: restore})
+	assert.Equal(t, restoreData{Name: "dr-1", UID: "uid-1"}, data.Restore)
+	assert.Equal(t, backupData{Name: "nightly-20240501020000", Schedule: "nightly"}, data.Backup)
+
+	set := ruleSet{name: "provenance", templates: true, patterns: map[string]string{
+		"restore": "{{ .Restore }}/{{ .Restore.UID }}",
+		"backup":  "{{ .Backup | upper }} from {{ .Backup.Schedule }}",
+	}}
+	rendered, err := set.renderPatterns(data)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"restore": "dr-1/uid-1", "backup": "NIGHTLY-20240501020000 from nightly"}, rendered)
+
+	// the schedule of the Restore wins, manual backups have none
+	restore.Spec.ScheduleName = "hourly"
+	assert.Equal(t, "hourly", newTemplateData(&velero.RestoreItemActionExecuteInput{Item: item, Restore: restore}).Backup.Schedule)
+	restore.Spec = velerov1.RestoreSpec{BackupName: "before-upgrade"}
+	assert.Empty(t, newTemplateData(&velero.RestoreItemActionExecuteInput{Item: item, Restore: restore}).Backup.Schedule)
+}
@@ -0,0 +1,92 @@
+package plugin
+
+import (
+	"context"
+	"fmt"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	corev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+)
+
+// nodeLister lists the schedulable nodes of the target cluster.
+type nodeLister interface {
+	schedulableNodes() ([]v1.Node, error)
+}
+
+// clientNodeLister lists the Nodes of the target cluster.
+type clientNodeLister struct {
+	nodes corev1.NodesGetter
+}
+
+func (l *clientNodeLister) schedulableNodes() ([]v1.Node, error) {
+	nodes, err := l.nodes.Nodes().List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list nodes: %v", err)
+	}
+	schedulable := []v1.Node{}
+	for _, node := range nodes.Items {
+		if !node.Spec.Unschedulable {
+			schedulable = append(schedulable, node)
+		}
+	}
+	return schedulable, nil
+}
+
+// targetNodes returns the schedulable nodes of the target cluster, listed once
+// per restore.
+func (p *RestorePlugin) targetNodes(state *restoreState) ([]v1.Node, error) {
+	state.nodesMu.Lock()
+	defer state.nodesMu.Unlock()
+	if state.nodes == nil {
+		if p.nodeLister == nil {
+			return nil, fmt.Errorf("the nodes of the target cluster cannot be listed")
+		}
+		nodes, err := p.nodeLister.schedulableNodes()
+		if err != nil {
+			return nil, err
+		}
+		state.nodes = nodes
+	}
+	return state.nodes, nil
+}
+
+// topologyNodes returns the Nodes function of the topology-spread transformer
+// for a restore.
+func (p *RestorePlugin) topologyNodes(state *restoreState) func() ([]map[string]string, error) {
+	return func() ([]map[string]string, error) {
+		nodes, err := p.targetNodes(state)
+		if err != nil {
+			return nil, err
+		}
+		labels := make([]map[string]string, 0, len(nodes))
+		for _, node := range nodes {
+			if node.Labels == nil {
+				labels = append(labels, map[string]string{})
+				continue
+			}
+			labels = append(labels, node.Labels)
+		}
+		return labels, nil
+	}
+}
+
+// extendedResources returns the Available function of the extended-resources
+// transformer for a restore: the resources some schedulable node has.
+func (p *RestorePlugin) extendedResources(state *restoreState) func() (map[string]bool, error) {
+	return func() (map[string]bool, error) {
+		nodes, err := p.targetNodes(state)
+		if err != nil {
+			return nil, err
+		}
+		available := make(map[string]bool)
+		for _, node := range nodes {
+			for name, quantity := range node.Status.Allocatable {
+				if !quantity.IsZero() {
+					available[string(name)] = true
+				}
+			}
+		}
+		return available, nil
+	}
+}
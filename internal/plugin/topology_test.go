@@ -0,0 +1,156 @@
+package plugin
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vmware-tanzu/velero/pkg/plugin/velero"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+type stubNodeLister struct {
+	nodes []v1.Node
+	err   error
+	calls int
+}
+
+func (s *stubNodeLister) schedulableNodes() ([]v1.Node, error) {
+	s.calls++
+	if s.err != nil {
+		return nil, s.err
+	}
+	return append([]v1.Node{}, s.nodes...), nil
+}
+
+func targetNode(labels map[string]string, allocatable v1.ResourceList) v1.Node {
+	return v1.Node{ObjectMeta: metav1.ObjectMeta{Labels: labels}, Status: v1.NodeStatus{Allocatable: allocatable}}
+}
+
+func TestClientNodeLister(t *testing.T) {
+	clientset := fake.NewSimpleClientset(
+		&v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "a", Labels: map[string]string{"topology.kubernetes.io/zone": "dr-a"}}},
+		&v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "b"}},
+		&v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "c"}, Spec: v1.NodeSpec{Unschedulable: true}},
+	)
+	nodes, err := (&clientNodeLister{nodes: clientset.CoreV1()}).schedulableNodes()
+	require.NoError(t, err)
+	require.Len(t, nodes, 2)
+	assert.Equal(t, []string{"a", "b"}, []string{nodes[0].Name, nodes[1].Name})
+}
+
+func TestTopologyNodes(t *testing.T) {
+	lister := &stubNodeLister{nodes: []v1.Node{targetNode(map[string]string{"kubernetes.io/hostname": "a"}, nil), targetNode(nil, nil)}}
+	plugin := &RestorePlugin{logger: logrus.New(), nodeLister: lister}
+	nodes := plugin.topologyNodes(&restoreState{})
+	for i := 0; i < 2; i++ {
+		listed, err := nodes()
+		require.NoError(t, err)
+		assert.Equal(t, []map[string]string{{"kubernetes.io/hostname": "a"}, {}}, listed)
+	}
+	assert.Equal(t, 1, lister.calls, "the nodes are listed once per restore")
+
+	empty := &stubNodeLister{}
+	plugin = &RestorePlugin{logger: logrus.New(), nodeLister: empty}
+	nodes = plugin.topologyNodes(&restoreState{})
+	for i := 0; i < 2; i++ {
+		listed, err := nodes()
+		require.NoError(t, err)
+		assert.Empty(t, listed)
+	}
+	assert.Equal(t, 1, empty.calls, "clusters without nodes are listed once too")
+
+	failing := &RestorePlugin{logger: logrus.New(), nodeLister: &stubNodeLister{err: errors.New("forbidden")}}
+	_, err := failing.topologyNodes(&restoreState{})()
+	assert.Error(t, err)
+	_, err = (&RestorePlugin{logger: logrus.New()}).topologyNodes(&restoreState{})()
+	assert.Error(t, err)
+}
+
+func TestReplacePatternAction_TopologySpread(t *testing.T) {
+	t.Setenv(stampOriginEnv, "false")
+	lister := &stubNodeLister{nodes: []v1.Node{
+		targetNode(map[string]string{"kubernetes.io/hostname": "a"}, nil),
+		targetNode(map[string]string{"kubernetes.io/hostname": "b"}, nil),
+	}}
+	plugin := &RestorePlugin{logger: logrus.New(), nodeLister: lister}
+	sets := ruleSetsFrom([]v1.ConfigMap{{
+		ObjectMeta: metav1.ObjectMeta{Name: "dr-topology", Annotations: map[string]string{transformerAnnotation: transformerTopology}},
+		Data:       map[string]string{"max-nodes": "10"},
+	}})
+
+	term := map[string]interface{}{"topologyKey": "kubernetes.io/hostname"}
+	deployment := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "apps/v1",
+		"kind":       "Deployment",
+		"metadata":   map[string]interface{}{"name": "web", "namespace": "apps"},
+		"spec": map[string]interface{}{"replicas": int64(3), "template": map[string]interface{}{"spec": map[string]interface{}{
+			"containers": []interface{}{map[string]interface{}{"name": "web"}},
+			"affinity": map[string]interface{}{"podAntiAffinity": map[string]interface{}{
+				"requiredDuringSchedulingIgnoredDuringExecution": []interface{}{term},
+			}},
+		}}},
+	}}
+	output, err := replacePatternAction(plugin, &velero.RestoreItemActionExecuteInput{Item: deployment}, sets)
+	require.NoError(t, err)
+	antiAffinity, _, _ := unstructured.NestedMap(output.UpdatedItem.(*unstructured.Unstructured).Object, "spec", "template", "spec", "affinity", "podAntiAffinity")
+	assert.Equal(t, map[string]interface{}{
+		"preferredDuringSchedulingIgnoredDuringExecution": []interface{}{map[string]interface{}{"weight": int64(100), "podAffinityTerm": term}},
+	}, antiAffinity)
+	assert.Equal(t, 1, lister.calls)
+}
+
+func TestExtendedResources(t *testing.T) {
+	lister := &stubNodeLister{nodes: []v1.Node{
+		targetNode(nil, v1.ResourceList{v1.ResourceCPU: resource.MustParse("4"), "amd.com/gpu": resource.MustParse("2")}),
+		targetNode(nil, v1.ResourceList{"nvidia.com/gpu": resource.MustParse("0")}),
+	}}
+	plugin := &RestorePlugin{logger: logrus.New(), nodeLister: lister}
+	state := &restoreState{}
+	available, err := plugin.extendedResources(state)()
+	require.NoError(t, err)
+	assert.Equal(t, map[string]bool{"cpu": true, "amd.com/gpu": true}, available)
+	_, err = plugin.topologyNodes(state)()
+	require.NoError(t, err)
+	assert.Equal(t, 1, lister.calls, "the transformers share the nodes")
+}
+
+func TestReplacePatternAction_ExtendedResources(t *testing.T) {
+	t.Setenv(stampOriginEnv, "false")
+	plugin := &RestorePlugin{logger: logrus.New(), nodeLister: &stubNodeLister{nodes: []v1.Node{
+		targetNode(nil, v1.ResourceList{"amd.com/gpu": resource.MustParse("8")}),
+	}}}
+	sets := ruleSetsFrom([]v1.ConfigMap{{
+		ObjectMeta: metav1.ObjectMeta{Name: "gpus", Annotations: map[string]string{transformerAnnotation: transformerDevices}},
+		Data: map[string]string{
+			"resources.yaml":       "nvidia.com/gpu: amd.com/gpu\n",
+			"runtime-classes.yaml": "nvidia: amd\n",
+			"fallback":             "remove",
+		},
+	}})
+
+	pod := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "Pod",
+		"metadata":   map[string]interface{}{"name": "train", "namespace": "ml"},
+		"spec": map[string]interface{}{
+			"runtimeClassName": "nvidia",
+			"containers": []interface{}{map[string]interface{}{
+				"name":      "train",
+				"resources": map[string]interface{}{"limits": map[string]interface{}{"nvidia.com/gpu": "2", "example.com/fpga": "1"}},
+			}},
+		},
+	}}
+	output, err := replacePatternAction(plugin, &velero.RestoreItemActionExecuteInput{Item: pod}, sets)
+	require.NoError(t, err)
+	spec := output.UpdatedItem.(*unstructured.Unstructured).Object["spec"].(map[string]interface{})
+	assert.Equal(t, "amd", spec["runtimeClassName"])
+	limits, _, _ := unstructured.NestedMap(spec["containers"].([]interface{})[0].(map[string]interface{}), "resources", "limits")
+	assert.Equal(t, map[string]interface{}{"amd.com/gpu": "2"}, limits, "the cluster has no FPGA")
+}
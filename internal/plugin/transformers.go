@@ -0,0 +1,805 @@
+package plugin
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/wrkt/velero-custom-plugins/internal/opa"
+	"github.com/wrkt/velero-custom-plugins/internal/transform"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	// transformerAnnotation on a ConfigMap selects the transformer its data
+	// configures. Pattern ConfigMaps leave it unset.
+	transformerAnnotation = "agoracalyce.io/transformer"
+
+	transformerLiteral  = "literal"
+	transformerIdentity = "identity"
+	transformerCloudIDs = "cloud-ids"
+	transformerLBs      = "lb-annotations"
+	transformerLists    = "list-entries"
+	transformerCron     = "cron-schedules"
+	transformerCapacity = "capacity"
+	transformerSecrets  = "external-secrets"
+	transformerXP       = "crossplane"
+	transformerKEDA     = "keda"
+	transformerFlows    = "workflows"
+	transformerKnative  = "knative"
+	transformerSvcIPs   = "service-ips"
+	transformerPorts    = "node-ports"
+	transformerIngress  = "ingress"
+	transformerRegex    = "regex"
+	transformerTargets  = "cluster-targets"
+	transformerPatch    = "json-patch"
+	transformerMerge    = "strategic-merge"
+	transformerVersions = "api-versions"
+	transformerJQ       = "jq"
+	transformerLua      = "lua"
+	transformerStarlark = "starlark"
+	transformerRego     = "rego"
+	transformerTopology = "topology-spread"
+	transformerDevices  = "extended-resources"
+	transformerPinning  = "image-pinning"
+	transformerRemoved  = "removed-fields"
+	transformerOrder    = "init-order"
+	transformerNSPolicy = "namespace-policy"
+
+	// listRulesKey is the data key of a list-entries ConfigMap
+	listRulesKey = "rules.yaml"
+	// regexPatternsKey is the data key of a regex ConfigMap: regular
+	// expressions are not valid ConfigMap keys
+	regexPatternsKey = "patterns.yaml"
+	// targetRulesKey is the data key of a cluster-targets ConfigMap
+	targetRulesKey = "targets.yaml"
+	// jsonPatchKey is the data key of a json-patch ConfigMap, a JSON Patch
+	// written in YAML or JSON
+	jsonPatchKey = "patch.yaml"
+	// versionRulesKey is the data key of an api-versions ConfigMap
+	versionRulesKey = "rules.yaml"
+	// jqFilterKey is the data key of a jq ConfigMap
+	jqFilterKey = "filter.jq"
+	// luaScriptKey is the data key of a lua ConfigMap
+	luaScriptKey = "script.lua"
+	// starlarkScriptKey is the data key of a starlark ConfigMap
+	starlarkScriptKey = "script.star"
+	// topologyInjectKey is the data key of the spread constraints a
+	// topology-spread ConfigMap injects
+	topologyInjectKey = "inject.yaml"
+)
+
+// cloudIDsKeys are the data keys of a cloud-ids ConfigMap, one mapping table
+// per cloud.
+var cloudIDsKeys = []string{"aws.yaml", "gcp.yaml", "azure.yaml"}
+
+// capacityKeys are the data keys of a capacity ConfigMap, one mapping table
+// per kind of value.
+var capacityKeys = []string{"instance-types.yaml", "zones.yaml", "subnets.yaml", "amis.yaml", "node-groups.yaml"}
+
+// extendedResourcesKeys are the data keys of an extended-resources ConfigMap.
+var extendedResourcesKeys = []string{"resources.yaml", "runtime-classes.yaml", "node-selectors.yaml", "fallback"}
+
+// imagePinningKeys are the data keys of an image-pinning ConfigMap.
+var imagePinningKeys = []string{"pull-policy", "pin", "floating-tags", "missing"}
+
+// externalSecretsKeys are the data keys of an external-secrets ConfigMap.
+var externalSecretsKeys = []string{"stores.yaml", "roles.yaml", "keys.yaml"}
+
+// crossplaneKeys are the data keys of a crossplane ConfigMap.
+var crossplaneKeys = []string{"provider-configs.yaml", "external-names.yaml", "secret-namespaces.yaml"}
+
+// workflowsKeys are the data keys of a workflows ConfigMap.
+var workflowsKeys = []string{"endpoints.yaml", "buckets.yaml", "service-accounts.yaml"}
+
+// knativeKeys are the data keys of a knative ConfigMap.
+var knativeKeys = []string{"domains.yaml", "registries.yaml", "autoscaling.yaml"}
+
+// namespacePolicyKeys are the data keys of a namespace-policy ConfigMap.
+var namespacePolicyKeys = []string{"labels.yaml", "annotations.yaml"}
+
+// isLiteral reports whether the set holds plain patterns.
+func (s ruleSet) isLiteral() bool {
+	return s.transformer == "" || s.transformer == transformerLiteral
+}
+
+// isRegex reports whether the set holds regex patterns, applied like plain
+// patterns.
+func (s ruleSet) isRegex() bool {
+	return s.transformer == transformerRegex
+}
+
+// build returns the transformer configured by a non-literal set.
+func (s ruleSet) build(logger logrus.FieldLogger) (transform.Transformer, error) {
+	switch s.transformer {
+	case transformerIdentity:
+		mapping, err := parseMappings(s.config)
+		if err != nil {
+			return nil, err
+		}
+		return &transform.Identity{Mapping: mapping}, nil
+	case transformerCloudIDs:
+		tables, err := parseTables(s.config, cloudIDsKeys)
+		if err != nil {
+			return nil, err
+		}
+		return transform.NewCloudIDs(tables["aws.yaml"], tables["gcp.yaml"], tables["azure.yaml"])
+	case transformerLBs:
+		lb := &transform.LoadBalancerAnnotations{
+			From:    strings.TrimSpace(s.config["from"]),
+			To:      strings.TrimSpace(s.config["to"]),
+			Unknown: strings.TrimSpace(s.config["unknown"]),
+			Warn:    logger.Warnf,
+		}
+		if lb.Unknown == "" {
+			lb.Unknown = transform.UnknownWarn
+		}
+		if err := lb.Validate(); err != nil {
+			return nil, err
+		}
+		extra, err := parseMappings(map[string]string{"translations.yaml": s.config["translations.yaml"]})
+		if err != nil {
+			return nil, err
+		}
+		lb.Extra = extra
+		return lb, nil
+	case transformerLists:
+		rules, err := parseListRules(s.config[listRulesKey])
+		if err != nil {
+			return nil, err
+		}
+		return &transform.ListEntries{Rules: rules}, nil
+	case transformerCapacity:
+		tables, err := parseTables(s.config, capacityKeys)
+		if err != nil {
+			return nil, err
+		}
+		return &transform.Capacity{
+			InstanceTypes: tables["instance-types.yaml"],
+			Zones:         tables["zones.yaml"],
+			Subnets:       tables["subnets.yaml"],
+			AMIs:          tables["amis.yaml"],
+			NodeGroups:    tables["node-groups.yaml"],
+		}, nil
+	case transformerSecrets:
+		tables, err := parseTables(s.config, externalSecretsKeys)
+		if err != nil {
+			return nil, err
+		}
+		return &transform.ExternalSecrets{
+			Stores:      tables["stores.yaml"],
+			Roles:       tables["roles.yaml"],
+			KeyPrefixes: tables["keys.yaml"],
+		}, nil
+	case transformerXP:
+		tables, err := parseTables(s.config, crossplaneKeys)
+		if err != nil {
+			return nil, err
+		}
+		return &transform.Crossplane{
+			ProviderConfigs:  tables["provider-configs.yaml"],
+			ExternalNames:    tables["external-names.yaml"],
+			SecretNamespaces: tables["secret-namespaces.yaml"],
+		}, nil
+	case transformerKEDA:
+		endpoints, err := parseMappings(map[string]string{"endpoints.yaml": s.config["endpoints.yaml"]})
+		if err != nil {
+			return nil, err
+		}
+		return &transform.KEDA{Endpoints: endpoints}, nil
+	case transformerFlows:
+		tables, err := parseTables(s.config, workflowsKeys)
+		if err != nil {
+			return nil, err
+		}
+		return &transform.Workflows{
+			Endpoints:       tables["endpoints.yaml"],
+			Buckets:         tables["buckets.yaml"],
+			ServiceAccounts: tables["service-accounts.yaml"],
+		}, nil
+	case transformerKnative:
+		tables, err := parseTables(s.config, knativeKeys)
+		if err != nil {
+			return nil, err
+		}
+		knative := &transform.Knative{
+			Domains:     tables["domains.yaml"],
+			Registries:  tables["registries.yaml"],
+			Autoscaling: tables["autoscaling.yaml"],
+			Warn:        logger.Warnf,
+		}
+		if err := knative.Validate(); err != nil {
+			return nil, err
+		}
+		return knative, nil
+	case transformerSvcIPs:
+		preserve, err := transform.ParsePrefixes(s.config["preserve-load-balancer-ips"])
+		if err != nil {
+			return nil, err
+		}
+		return &transform.ServiceIPs{Preserve: preserve}, nil
+	case transformerPorts:
+		nodePorts := &transform.NodePorts{
+			Policy:  strings.TrimSpace(s.config["policy"]),
+			Mapping: make(map[int64]int64),
+			Warn:    logger.Warnf,
+		}
+		if nodePorts.Policy == "" {
+			nodePorts.Policy = transform.NodePortsPreserve
+		}
+		mapping, err := parseMappings(map[string]string{"mapping.yaml": s.config["mapping.yaml"]})
+		if err != nil {
+			return nil, err
+		}
+		for from, to := range mapping {
+			fromPort, err := strconv.ParseInt(from, 10, 32)
+			if err != nil {
+				return nil, fmt.Errorf("invalid node port %q: %v", from, err)
+			}
+			toPort, err := strconv.ParseInt(to, 10, 32)
+			if err != nil {
+				return nil, fmt.Errorf("invalid node port %q: %v", to, err)
+			}
+			nodePorts.Mapping[fromPort] = toPort
+		}
+		if err := nodePorts.Validate(); err != nil {
+			return nil, err
+		}
+		return nodePorts, nil
+	case transformerTopology:
+		topology := &transform.TopologySpread{
+			WhenUnsatisfiable: strings.TrimSpace(s.config["when-unsatisfiable"]),
+			AntiAffinity:      strings.TrimSpace(s.config["anti-affinity"]),
+		}
+		if topology.AntiAffinity == "" {
+			topology.AntiAffinity = transform.AntiAffinityAuto
+		}
+		if value := strings.TrimSpace(s.config["max-nodes"]); value != "" {
+			n, err := strconv.Atoi(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid max-nodes %q: %v", value, err)
+			}
+			topology.MaxNodes = n
+		}
+		if value := strings.TrimSpace(s.config["min-max-skew"]); value != "" {
+			n, err := strconv.ParseInt(value, 10, 32)
+			if err != nil {
+				return nil, fmt.Errorf("invalid min-max-skew %q: %v", value, err)
+			}
+			topology.MinMaxSkew = n
+		}
+		if inject := s.config[topologyInjectKey]; strings.TrimSpace(inject) != "" {
+			var constraints []json.RawMessage
+			if err := yaml.Unmarshal([]byte(inject), &constraints); err != nil {
+				return nil, fmt.Errorf("failed to parse %s: %v", topologyInjectKey, err)
+			}
+			for _, raw := range constraints {
+				constraint, err := decodeJSONValue(raw)
+				if err != nil {
+					return nil, fmt.Errorf("failed to parse %s: %v", topologyInjectKey, err)
+				}
+				object, ok := constraint.(map[string]interface{})
+				if !ok {
+					return nil, fmt.Errorf("invalid %s: constraints must be objects", topologyInjectKey)
+				}
+				topology.Inject = append(topology.Inject, object)
+			}
+		}
+		if err := topology.Validate(); err != nil {
+			return nil, err
+		}
+		return topology, nil
+	case transformerDevices:
+		for key := range s.config {
+			if !slices.Contains(extendedResourcesKeys, key) {
+				return nil, fmt.Errorf("unknown key %s, expected one of %v", key, extendedResourcesKeys)
+			}
+		}
+		resources, err := parseResourceMappings(s.config["resources.yaml"])
+		if err != nil {
+			return nil, err
+		}
+		tables, err := parseTables(map[string]string{
+			"runtime-classes.yaml": s.config["runtime-classes.yaml"],
+			"node-selectors.yaml":  s.config["node-selectors.yaml"],
+		}, []string{"runtime-classes.yaml", "node-selectors.yaml"})
+		if err != nil {
+			return nil, err
+		}
+		devices := &transform.ExtendedResources{
+			Resources:      resources,
+			RuntimeClasses: tables["runtime-classes.yaml"],
+			NodeSelectors:  tables["node-selectors.yaml"],
+			Fallback:       strings.TrimSpace(s.config["fallback"]),
+			Warn:           logger.Warnf,
+		}
+		if devices.Fallback == "" {
+			devices.Fallback = transform.ExtendedResourcesKeep
+		}
+		if err := devices.Validate(); err != nil {
+			return nil, err
+		}
+		return devices, nil
+	case transformerPinning:
+		for key := range s.config {
+			if !slices.Contains(imagePinningKeys, key) {
+				return nil, fmt.Errorf("unknown key %s, expected one of %v", key, imagePinningKeys)
+			}
+		}
+		pinning := &transform.ImagePinning{
+			PullPolicy:   strings.TrimSpace(s.config["pull-policy"]),
+			Pin:          strings.TrimSpace(s.config["pin"]),
+			FloatingTags: []string{"latest"},
+			Warn:         logger.Warnf,
+		}
+		if pinning.Pin == "" {
+			pinning.Pin = transform.PinFloating
+		}
+		if value, ok := s.config["floating-tags"]; ok {
+			pinning.FloatingTags = nil
+			for _, tag := range strings.Split(value, ",") {
+				if tag = strings.TrimSpace(tag); tag != "" {
+					pinning.FloatingTags = append(pinning.FloatingTags, tag)
+				}
+			}
+		}
+		switch missing := strings.TrimSpace(s.config["missing"]); missing {
+		case "", "warn":
+		case "fail":
+			pinning.Strict = true
+		default:
+			return nil, fmt.Errorf("unknown missing policy %q, expected warn or fail", missing)
+		}
+		if err := pinning.Validate(); err != nil {
+			return nil, err
+		}
+		return pinning, nil
+	case transformerIngress:
+		ingress := &transform.IngressAnnotations{
+			From:    strings.TrimSpace(s.config["from"]),
+			To:      strings.TrimSpace(s.config["to"]),
+			Unknown: strings.TrimSpace(s.config["unknown"]),
+			Warn:    logger.Warnf,
+		}
+		if ingress.Unknown == "" {
+			ingress.Unknown = transform.UnknownWarn
+		}
+		if err := ingress.Validate(); err != nil {
+			return nil, err
+		}
+		classes, err := parseMappings(map[string]string{"classes.yaml": s.config["classes.yaml"]})
+		if err != nil {
+			return nil, err
+		}
+		extra, err := parseMappings(map[string]string{"translations.yaml": s.config["translations.yaml"]})
+		if err != nil {
+			return nil, err
+		}
+		ingress.Classes, ingress.Extra = classes, extra
+		return ingress, nil
+	case transformerRegex:
+		rules, err := parseRegexPatterns(s.config[regexPatternsKey])
+		if err != nil {
+			return nil, err
+		}
+		return transform.NewRegex(rules)
+	case transformerTargets:
+		rules, err := parseTargetRules(s.config[targetRulesKey])
+		if err != nil {
+			return nil, err
+		}
+		targets := &transform.ClusterTargets{
+			Rules:       rules,
+			Annotation:  strings.TrimSpace(s.config["annotation"]),
+			LabelPrefix: strings.TrimSpace(s.config["label-prefix"]),
+		}
+		if targets.Annotation == "" {
+			targets.Annotation = transform.TargetsAnnotation
+		}
+		if err := targets.Validate(); err != nil {
+			return nil, err
+		}
+		return targets, nil
+	case transformerPatch:
+		document, err := yaml.YAMLToJSON([]byte(s.config[jsonPatchKey]))
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %v", jsonPatchKey, err)
+		}
+		return transform.NewJSONPatch(document)
+	case transformerMerge:
+		patches, err := parseMergePatches(s.config)
+		if err != nil {
+			return nil, err
+		}
+		return transform.NewStrategicMerge(patches)
+	case transformerResourceModifiers:
+		rules, err := parseResourceModifiers(s.config)
+		if err != nil {
+			return nil, err
+		}
+		return &transform.ResourceModifiers{Rules: rules}, nil
+	case transformerVersions:
+		rules, err := parseVersionRules(s.config[versionRulesKey])
+		if err != nil {
+			return nil, err
+		}
+		versions := &transform.APIVersions{Rules: rules, Builtin: true}
+		if builtin := strings.TrimSpace(s.config["builtin"]); builtin != "" {
+			if versions.Builtin, err = strconv.ParseBool(builtin); err != nil {
+				return nil, fmt.Errorf("invalid builtin %q: %v", builtin, err)
+			}
+		}
+		return versions, nil
+	case transformerOrder:
+		order := &transform.InitOrder{}
+		for _, key := range strings.Split(s.config["wave-annotations"], ",") {
+			if key = strings.TrimSpace(key); key != "" {
+				order.WaveAnnotations = append(order.WaveAnnotations, key)
+			}
+		}
+		if report := strings.TrimSpace(s.config["report"]); report != "" {
+			if _, err := strconv.ParseBool(report); err != nil {
+				return nil, fmt.Errorf("invalid report %q: %v", report, err)
+			}
+		}
+		return order, nil
+	case transformerRemoved:
+		fields, err := parseRemovedFields(s.config[removedFieldsKey])
+		if err != nil {
+			return nil, err
+		}
+		removed := &transform.RemovedFields{
+			Fields:  fields,
+			Builtin: true,
+			Action:  strings.TrimSpace(s.config["action"]),
+			Warn:    logger.Warnf,
+		}
+		if removed.Action == "" {
+			removed.Action = transform.RemovedFieldsRemove
+		}
+		if builtin := strings.TrimSpace(s.config["builtin"]); builtin != "" {
+			if removed.Builtin, err = strconv.ParseBool(builtin); err != nil {
+				return nil, fmt.Errorf("invalid builtin %q: %v", builtin, err)
+			}
+		}
+		if version := strings.TrimSpace(s.config["target-version"]); version != "" {
+			if _, _, err := transform.ParseKubernetesVersion(version); err != nil {
+				return nil, err
+			}
+			removed.Version = func() (string, error) { return version, nil }
+		}
+		if err := removed.Validate(); err != nil {
+			return nil, err
+		}
+		return removed, nil
+	case transformerJQ:
+		filter := strings.TrimSpace(s.config[jqFilterKey])
+		if filter == "" {
+			return nil, fmt.Errorf("%s is required", jqFilterKey)
+		}
+		return transform.NewJQ(filter)
+	case transformerLua:
+		script := s.config[luaScriptKey]
+		if strings.TrimSpace(script) == "" {
+			return nil, fmt.Errorf("%s is required", luaScriptKey)
+		}
+		return transform.NewLua(script)
+	case transformerStarlark:
+		script := s.config[starlarkScriptKey]
+		if strings.TrimSpace(script) == "" {
+			return nil, fmt.Errorf("%s is required", starlarkScriptKey)
+		}
+		maxSteps := uint64(transform.DefaultStarlarkMaxSteps)
+		if value := strings.TrimSpace(s.config["max-steps"]); value != "" {
+			n, err := strconv.ParseUint(value, 10, 64)
+			if err != nil || n == 0 {
+				return nil, fmt.Errorf("invalid max-steps %q: must be a positive integer", value)
+			}
+			maxSteps = n
+		}
+		return transform.NewStarlark(script, maxSteps)
+	case transformerRego:
+		module := s.config[regoPolicyKey]
+		if strings.TrimSpace(module) == "" {
+			return nil, fmt.Errorf("%s is required", regoPolicyKey)
+		}
+		if _, err := opa.PackagePath(module); err != nil {
+			return nil, err
+		}
+		rego := &transform.Rego{ID: regoPolicyPrefix + s.name, Module: module}
+		switch severity := strings.TrimSpace(s.config[regoSeverityKey]); severity {
+		case "", severityDeny:
+		case severityCritical:
+			rego.Critical = true
+		default:
+			return nil, fmt.Errorf("invalid %s %q: must be %s or %s", regoSeverityKey, severity, severityDeny, severityCritical)
+		}
+		return rego, nil
+	case transformerCron:
+		cron := &transform.CronSchedules{}
+		if offset := strings.TrimSpace(s.config["offset"]); offset != "" {
+			d, err := time.ParseDuration(offset)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse offset: %v", err)
+			}
+			cron.Offset = d
+		}
+		zones, err := parseMappings(map[string]string{"timezones.yaml": s.config["timezones.yaml"]})
+		if err != nil {
+			return nil, err
+		}
+		cron.TimeZones = zones
+		if err := cron.Validate(); err != nil {
+			return nil, err
+		}
+		return cron, nil
+	case transformerNSPolicy:
+		tables, err := parseTables(s.config, namespacePolicyKeys)
+		if err != nil {
+			return nil, err
+		}
+		for _, table := range tables {
+			for key, value := range table {
+				if _, err := parseTemplate(key, value); err != nil {
+					return nil, err
+				}
+			}
+		}
+		policy := &transform.NamespacePolicy{Labels: tables["labels.yaml"], Annotations: tables["annotations.yaml"]}
+		if err := policy.Validate(); err != nil {
+			return nil, err
+		}
+		return policy, nil
+	default:
+		return nil, fmt.Errorf("unknown transformer %q", s.transformer)
+	}
+}
+
+// parseMappings merges the YAML maps held by each value of data. Mapped values
+// such as ARNs or emails are not valid ConfigMap keys, hence the nesting.
+func parseMappings(data map[string]string) (map[string]string, error) {
+	mapping := make(map[string]string)
+	for key, value := range data {
+		var entries map[string]string
+		if err := yaml.Unmarshal([]byte(value), &entries); err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %v", key, err)
+		}
+		for from, to := range entries {
+			mapping[from] = to
+		}
+	}
+	return mapping, nil
+}
+
+// parseTables parses one mapping table per key, refusing the other keys.
+func parseTables(config map[string]string, keys []string) (map[string]map[string]string, error) {
+	for key := range config {
+		if !slices.Contains(keys, key) {
+			return nil, fmt.Errorf("unknown key %s, expected one of %v", key, keys)
+		}
+	}
+	tables := make(map[string]map[string]string, len(keys))
+	for _, key := range keys {
+		table, err := parseMappings(map[string]string{key: config[key]})
+		if err != nil {
+			return nil, err
+		}
+		tables[key] = table
+	}
+	return tables, nil
+}
+
+// resourceMappingConfig is an entry of the resources.yaml key of an
+// extended-resources ConfigMap, when it is not just the name of the resource.
+type resourceMappingConfig struct {
+	Name   string      `json:"name"`
+	Factor interface{} `json:"factor"`
+}
+
+// parseResourceMappings parses the resources.yaml key of an
+// extended-resources ConfigMap.
+func parseResourceMappings(data string) (map[string]transform.ResourceMapping, error) {
+	var entries map[string]json.RawMessage
+	if err := yaml.Unmarshal([]byte(data), &entries); err != nil {
+		return nil, fmt.Errorf("failed to parse resources.yaml: %v", err)
+	}
+	mappings := make(map[string]transform.ResourceMapping, len(entries))
+	for from, raw := range entries {
+		var config resourceMappingConfig
+		if err := json.Unmarshal(raw, &config.Name); err != nil {
+			if err := json.Unmarshal(raw, &config); err != nil {
+				return nil, fmt.Errorf("invalid mapping of %s: %v", from, err)
+			}
+		}
+		mapping := transform.ResourceMapping{Name: config.Name}
+		if config.Factor != nil {
+			factor, err := resource.ParseQuantity(fmt.Sprint(config.Factor))
+			if err != nil {
+				return nil, fmt.Errorf("invalid factor of %s: %v", from, err)
+			}
+			mapping.Factor = &factor
+		}
+		if mapping.Name == "" {
+			mapping.Name = from
+		}
+		mappings[from] = mapping
+	}
+	return mappings, nil
+}
+
+// listRuleConfig is a list rule as written in a ConfigMap, with a dotted path.
+type listRuleConfig struct {
+	Path        string                     `json:"path"`
+	Match       *string                    `json:"match"`
+	MatchFields map[string]string          `json:"matchFields"`
+	Replace     json.RawMessage            `json:"replace"`
+	Set         map[string]json.RawMessage `json:"set"`
+	Remove      bool                       `json:"remove"`
+}
+
+// parseListRules parses and validates the YAML list of list rules.
+func parseListRules(data string) ([]transform.ListRule, error) {
+	var configs []listRuleConfig
+	if err := yaml.Unmarshal([]byte(data), &configs); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %v", listRulesKey, err)
+	}
+	rules := make([]transform.ListRule, 0, len(configs))
+	for i, config := range configs {
+		rule := transform.ListRule{
+			Match:       config.Match,
+			MatchFields: config.MatchFields,
+			Remove:      config.Remove,
+		}
+		if config.Path != "" {
+			rule.Path = strings.Split(config.Path, ".")
+		}
+		var err error
+		if rule.Replace, err = decodeJSONValue(config.Replace); err != nil {
+			return nil, fmt.Errorf("failed to parse the replace value of rule %d: %v", i, err)
+		}
+		if len(config.Set) > 0 {
+			rule.Set = make(map[string]interface{}, len(config.Set))
+			for field, raw := range config.Set {
+				if rule.Set[field], err = decodeJSONValue(raw); err != nil {
+					return nil, fmt.Errorf("failed to parse the set value of rule %d: %v", i, err)
+				}
+			}
+		}
+		if err := rule.Validate(); err != nil {
+			return nil, fmt.Errorf("invalid rule %d: %v", i, err)
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// versionRuleConfig is an entry of the rules.yaml key of an api-versions
+// ConfigMap, with dotted paths.
+type versionRuleConfig struct {
+	Kind string `json:"kind"`
+	From string `json:"from"`
+	To   string `json:"to"`
+	Move []struct {
+		From string `json:"from"`
+		To   string `json:"to"`
+	} `json:"move"`
+	Remove   []string                   `json:"remove"`
+	Defaults map[string]json.RawMessage `json:"defaults"`
+}
+
+// parseVersionRules parses and validates the YAML list of apiVersion rules.
+func parseVersionRules(data string) ([]transform.VersionRule, error) {
+	var configs []versionRuleConfig
+	if err := yaml.Unmarshal([]byte(data), &configs); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %v", versionRulesKey, err)
+	}
+	rules := make([]transform.VersionRule, 0, len(configs))
+	for i, config := range configs {
+		rule := transform.VersionRule{Kind: config.Kind, From: config.From, To: config.To}
+		for _, move := range config.Move {
+			rule.Moves = append(rule.Moves, transform.FieldMove{From: dottedPath(move.From), To: dottedPath(move.To)})
+		}
+		for _, path := range config.Remove {
+			rule.Remove = append(rule.Remove, dottedPath(path))
+		}
+		paths := make([]string, 0, len(config.Defaults))
+		for path := range config.Defaults {
+			paths = append(paths, path)
+		}
+		sort.Strings(paths)
+		for _, path := range paths {
+			value, err := decodeJSONValue(config.Defaults[path])
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse the default of %s in rule %d: %v", path, i, err)
+			}
+			rule.Defaults = append(rule.Defaults, transform.FieldDefault{Path: dottedPath(path), Value: value})
+		}
+		if err := rule.Validate(); err != nil {
+			return nil, fmt.Errorf("invalid rule %d: %v", i, err)
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// dottedPath splits a path of object keys separated by dots.
+func dottedPath(path string) []string {
+	if path = strings.TrimSpace(path); path == "" {
+		return nil
+	}
+	return strings.Split(path, ".")
+}
+
+// regexPatternConfig is an entry of the patterns.yaml key of a regex
+// ConfigMap.
+type regexPatternConfig struct {
+	Regex       string `json:"regex"`
+	Replacement string `json:"replacement"`
+}
+
+// parseRegexPatterns parses the ordered list of regex patterns.
+func parseRegexPatterns(data string) ([]transform.RegexRule, error) {
+	var configs []regexPatternConfig
+	if err := yaml.Unmarshal([]byte(data), &configs); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %v", regexPatternsKey, err)
+	}
+	rules := make([]transform.RegexRule, 0, len(configs))
+	for _, config := range configs {
+		rules = append(rules, transform.RegexRule{Expr: config.Regex, Replacement: config.Replacement})
+	}
+	return rules, nil
+}
+
+// targetRuleConfig is an entry of the targets.yaml key of a cluster-targets
+// ConfigMap.
+type targetRuleConfig struct {
+	Namespaces []string `json:"namespaces"`
+	Clusters   []string `json:"clusters"`
+}
+
+// parseTargetRules parses the list of cluster target rules.
+func parseTargetRules(data string) ([]transform.TargetRule, error) {
+	var configs []targetRuleConfig
+	if err := yaml.Unmarshal([]byte(data), &configs); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %v", targetRulesKey, err)
+	}
+	rules := make([]transform.TargetRule, 0, len(configs))
+	for _, config := range configs {
+		rules = append(rules, transform.TargetRule{Namespaces: config.Namespaces, Clusters: config.Clusters})
+	}
+	return rules, nil
+}
+
+// parseMergePatches parses the patches of a strategic-merge ConfigMap, one per
+// <Kind>.yaml key.
+func parseMergePatches(config map[string]string) (map[string][]byte, error) {
+	patches := make(map[string][]byte, len(config))
+	for key, value := range config {
+		kind := strings.TrimSuffix(key, ".yaml")
+		if kind == key || kind == "" {
+			return nil, fmt.Errorf("unknown key %s, expected <Kind>.yaml", key)
+		}
+		patch, err := yaml.YAMLToJSON([]byte(value))
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %v", key, err)
+		}
+		patches[kind] = patch
+	}
+	return patches, nil
+}
+
+// decodeJSONValue decodes raw with the number types of unstructured objects.
+func decodeJSONValue(raw json.RawMessage) (interface{}, error) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil, nil
+	}
+	return transform.ReplaceStream(bytes.NewReader(raw), func(s string) string { return s })
+}
@@ -0,0 +1,770 @@
+package plugin
+
+import (
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	velerov1 "github.com/vmware-tanzu/velero/pkg/apis/velero/v1"
+	"github.com/vmware-tanzu/velero/pkg/plugin/velero"
+	"github.com/wrkt/velero-custom-plugins/internal/transform"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestParseMappings(t *testing.T) {
+	mapping, err := parseMappings(map[string]string{
+		"aws.yaml": `"arn:aws:iam::111111111111:role/app": "arn:aws:iam::222222222222:role/app"`,
+		"gcp.yaml": "app@prod.iam.gserviceaccount.com: app@dr.iam.gserviceaccount.com\n",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"arn:aws:iam::111111111111:role/app": "arn:aws:iam::222222222222:role/app",
+		"app@prod.iam.gserviceaccount.com":   "app@dr.iam.gserviceaccount.com",
+	}, mapping)
+
+	_, err = parseMappings(map[string]string{"broken.yaml": "- not a map"})
+	assert.Error(t, err)
+}
+
+func TestReplacePatternAction_Transformers(t *testing.T) {
+	t.Setenv(stampOriginEnv, "false")
+	plugin := &RestorePlugin{logger: logrus.New()}
+	sets := ruleSetsFrom([]v1.ConfigMap{
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "patterns"},
+			Data:       map[string]string{"production": "review-3"},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "identities", Annotations: map[string]string{transformerAnnotation: transformerIdentity}},
+			Data:       map[string]string{"aws.yaml": `"arn:aws:iam::111111111111:role/production": "arn:aws:iam::222222222222:role/production"`},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "unknown", Annotations: map[string]string{transformerAnnotation: "nope"}},
+			Data:       map[string]string{"foo": "bar"},
+		},
+	})
+	assert.Equal(t, 1, countRules(sets))
+
+	serviceAccount := &unstructured.Unstructured{}
+	serviceAccount.SetAPIVersion("v1")
+	serviceAccount.SetKind("ServiceAccount")
+	serviceAccount.SetName("app")
+	serviceAccount.SetNamespace("production")
+	serviceAccount.SetAnnotations(map[string]string{"eks.amazonaws.com/role-arn": "arn:aws:iam::111111111111:role/production", "foo": "foo"})
+
+	output, err := replacePatternAction(plugin, &velero.RestoreItemActionExecuteInput{Item: serviceAccount}, sets)
+	require.NoError(t, err)
+	item := output.UpdatedItem.(*unstructured.Unstructured)
+
+	// the identity annotations belong to the identity mapping, not to the patterns
+	assert.Equal(t, "review-3", item.GetNamespace())
+	assert.Equal(t, map[string]string{"eks.amazonaws.com/role-arn": "arn:aws:iam::222222222222:role/production", "foo": "foo"}, item.GetAnnotations())
+}
+
+func TestRuleSetBuild_CloudIDs(t *testing.T) {
+	set := ruleSet{transformer: transformerCloudIDs, config: map[string]string{
+		"aws.yaml": `"111111111111": "222222222222"`,
+		"gcp.yaml": "prod-project: dr-project",
+	}}
+	transformer, err := set.build(logrus.New())
+	require.NoError(t, err)
+
+	item := &unstructured.Unstructured{Object: map[string]interface{}{
+		"role":    "arn:aws:iam::111111111111:role/app",
+		"project": "projects/prod-project/topics/events",
+	}}
+	output, err := transformer.Transform(item)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"role":    "arn:aws:iam::222222222222:role/app",
+		"project": "projects/dr-project/topics/events",
+	}, output.Object)
+
+	set.config = map[string]string{"aws.yaml": `"111111111111": "not-an-account"`}
+	_, err = set.build(logrus.New())
+	assert.Error(t, err)
+
+	set.config = map[string]string{"oci.yaml": ""}
+	_, err = set.build(logrus.New())
+	assert.Error(t, err)
+}
+
+func TestRuleSetBuild_LoadBalancerAnnotations(t *testing.T) {
+	set := ruleSet{transformer: transformerLBs, config: map[string]string{
+		"from":              "aws",
+		"to":                "azure",
+		"unknown":           "drop",
+		"translations.yaml": `"service.beta.kubernetes.io/aws-load-balancer-name": "example.com/lb-name"`,
+	}}
+	transformer, err := set.build(logrus.New())
+	require.NoError(t, err)
+
+	service := &unstructured.Unstructured{Object: map[string]interface{}{
+		"kind": "Service",
+		"spec": map[string]interface{}{"type": "LoadBalancer"},
+	}}
+	service.SetAnnotations(map[string]string{
+		"service.beta.kubernetes.io/aws-load-balancer-internal":       "true",
+		"service.beta.kubernetes.io/aws-load-balancer-name":           "web",
+		"service.beta.kubernetes.io/aws-load-balancer-proxy-protocol": "*",
+	})
+	output, err := transformer.Transform(service)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"service.beta.kubernetes.io/azure-load-balancer-internal": "true",
+		"example.com/lb-name": "web",
+	}, output.GetAnnotations())
+
+	// unknown is optional, from and to are not
+	_, err = ruleSet{transformer: transformerLBs, config: map[string]string{"from": "aws", "to": "gcp"}}.build(logrus.New())
+	assert.NoError(t, err)
+	_, err = ruleSet{transformer: transformerLBs, config: map[string]string{"from": "aws"}}.build(logrus.New())
+	assert.Error(t, err)
+}
+
+func TestRuleSetBuild_ListEntries(t *testing.T) {
+	set := ruleSet{transformer: transformerLists, config: map[string]string{listRulesKey: `
+- path: spec.hosts
+  match: shop.example.com
+  replace: shop.dr.example.com
+- path: spec.servers
+  matchFields:
+    port: "8443"
+  set:
+    port: 443
+    tls: {mode: SIMPLE}
+- path: spec.servers
+  matchFields:
+    name: debug
+  remove: true
+`}}
+	transformer, err := set.build(logrus.New())
+	require.NoError(t, err)
+
+	gateway := &unstructured.Unstructured{Object: map[string]interface{}{
+		"kind": "Gateway",
+		"spec": map[string]interface{}{
+			"hosts": []interface{}{"shop.example.com", "api.example.com"},
+			"servers": []interface{}{
+				map[string]interface{}{"name": "debug", "port": int64(9000)},
+				map[string]interface{}{"name": "https", "port": int64(8443)},
+			},
+		},
+	}}
+	output, err := transformer.Transform(gateway)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"hosts": []interface{}{"shop.dr.example.com", "api.example.com"},
+		"servers": []interface{}{
+			map[string]interface{}{"name": "https", "port": int64(443), "tls": map[string]interface{}{"mode": "SIMPLE"}},
+		},
+	}, output.Object["spec"])
+
+	_, err = ruleSet{transformer: transformerLists, config: map[string]string{listRulesKey: "- path: spec.hosts\n  match: a\n"}}.build(logrus.New())
+	assert.Error(t, err)
+	_, err = ruleSet{transformer: transformerLists, config: map[string]string{listRulesKey: "path: spec.hosts"}}.build(logrus.New())
+	assert.Error(t, err)
+}
+
+func TestRuleSetBuild_CronSchedules(t *testing.T) {
+	set := ruleSet{transformer: transformerCron, config: map[string]string{
+		"offset":         "-5h",
+		"timezones.yaml": "Europe/Paris: America/New_York\n",
+	}}
+	transformer, err := set.build(logrus.New())
+	require.NoError(t, err)
+
+	job := &unstructured.Unstructured{Object: map[string]interface{}{
+		"kind": "CronJob",
+		"spec": map[string]interface{}{"schedule": "15 3 * * 1-5"},
+	}}
+	output, err := transformer.Transform(job)
+	require.NoError(t, err)
+	assert.Equal(t, "15 22 * * 0-4", output.Object["spec"].(map[string]interface{})["schedule"])
+
+	_, err = ruleSet{transformer: transformerCron, config: map[string]string{"offset": "east"}}.build(logrus.New())
+	assert.Error(t, err)
+	_, err = ruleSet{transformer: transformerCron, config: map[string]string{"timezones.yaml": "UTC: Nowhere/Else"}}.build(logrus.New())
+	assert.Error(t, err)
+}
+
+func TestRuleSetBuild_Capacity(t *testing.T) {
+	set := ruleSet{transformer: transformerCapacity, config: map[string]string{
+		"instance-types.yaml": "m5.large: m6i.large\n",
+		"subnets.yaml":        "subnet-0a: subnet-1a\n",
+	}}
+	transformer, err := set.build(logrus.New())
+	require.NoError(t, err)
+
+	nodeClass := &unstructured.Unstructured{Object: map[string]interface{}{
+		"kind": "EC2NodeClass",
+		"spec": map[string]interface{}{"subnetSelectorTerms": []interface{}{map[string]interface{}{"id": "subnet-0a"}}},
+	}}
+	output, err := transformer.Transform(nodeClass)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"subnetSelectorTerms": []interface{}{map[string]interface{}{"id": "subnet-1a"}}}, output.Object["spec"])
+
+	_, err = ruleSet{transformer: transformerCapacity, config: map[string]string{"regions.yaml": "a: b"}}.build(logrus.New())
+	assert.Error(t, err)
+}
+
+func TestRuleSetBuild_ExternalSecrets(t *testing.T) {
+	set := ruleSet{transformer: transformerSecrets, config: map[string]string{
+		"stores.yaml": "aws-prod: aws-dr\n",
+		"keys.yaml":   "prod/: dr/\n",
+	}}
+	transformer, err := set.build(logrus.New())
+	require.NoError(t, err)
+
+	externalSecret := &unstructured.Unstructured{Object: map[string]interface{}{
+		"kind": "ExternalSecret",
+		"spec": map[string]interface{}{
+			"secretStoreRef": map[string]interface{}{"name": "aws-prod"},
+			"dataFrom":       []interface{}{map[string]interface{}{"extract": map[string]interface{}{"key": "prod/app"}}},
+		},
+	}}
+	output, err := transformer.Transform(externalSecret)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"secretStoreRef": map[string]interface{}{"name": "aws-dr"},
+		"dataFrom":       []interface{}{map[string]interface{}{"extract": map[string]interface{}{"key": "dr/app"}}},
+	}, output.Object["spec"])
+
+	_, err = ruleSet{transformer: transformerSecrets, config: map[string]string{"paths.yaml": "a: b"}}.build(logrus.New())
+	assert.Error(t, err)
+}
+
+func TestRuleSetBuild_Crossplane(t *testing.T) {
+	set := ruleSet{transformer: transformerXP, config: map[string]string{
+		"provider-configs.yaml": "default: dr\n",
+	}}
+	transformer, err := set.build(logrus.New())
+	require.NoError(t, err)
+
+	bucket := &unstructured.Unstructured{Object: map[string]interface{}{
+		"kind": "Bucket",
+		"spec": map[string]interface{}{"providerConfigRef": map[string]interface{}{"name": "default"}},
+	}}
+	output, err := transformer.Transform(bucket)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"providerConfigRef": map[string]interface{}{"name": "dr"}}, output.Object["spec"])
+
+	_, err = ruleSet{transformer: transformerXP, config: map[string]string{"compositions.yaml": "a: b"}}.build(logrus.New())
+	assert.Error(t, err)
+}
+
+func TestRuleSetBuild_KEDA(t *testing.T) {
+	set := ruleSet{transformer: transformerKEDA, config: map[string]string{
+		"endpoints.yaml": "prometheus.prod: prometheus.dr\n",
+	}}
+	transformer, err := set.build(logrus.New())
+	require.NoError(t, err)
+
+	scaledJob := &unstructured.Unstructured{Object: map[string]interface{}{
+		"kind": "ScaledJob",
+		"spec": map[string]interface{}{"triggers": []interface{}{
+			map[string]interface{}{"type": "prometheus", "metadata": map[string]interface{}{"serverAddress": "http://prometheus.prod:9090"}},
+		}},
+	}}
+	output, err := transformer.Transform(scaledJob)
+	require.NoError(t, err)
+	assert.Equal(t, []interface{}{
+		map[string]interface{}{"type": "prometheus", "metadata": map[string]interface{}{"serverAddress": "http://prometheus.dr:9090"}},
+	}, output.Object["spec"].(map[string]interface{})["triggers"])
+}
+
+func TestRuleSetBuild_Workflows(t *testing.T) {
+	set := ruleSet{transformer: transformerFlows, config: map[string]string{
+		"service-accounts.yaml": "argo-prod: argo-dr\n",
+	}}
+	transformer, err := set.build(logrus.New())
+	require.NoError(t, err)
+
+	workflow := &unstructured.Unstructured{Object: map[string]interface{}{
+		"kind": "WorkflowTemplate",
+		"spec": map[string]interface{}{"serviceAccountName": "argo-prod"},
+	}}
+	output, err := transformer.Transform(workflow)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"serviceAccountName": "argo-dr"}, output.Object["spec"])
+
+	_, err = ruleSet{transformer: transformerFlows, config: map[string]string{"repositories.yaml": "a: b"}}.build(logrus.New())
+	assert.Error(t, err)
+}
+
+func TestRuleSetBuild_Knative(t *testing.T) {
+	set := ruleSet{transformer: transformerKnative, config: map[string]string{
+		"domains.yaml":     "example.com: dr.example.com\n",
+		"autoscaling.yaml": `"autoscaling.knative.dev/max-scale": "3"`,
+	}}
+	transformer, err := set.build(logrus.New())
+	require.NoError(t, err)
+
+	mapping := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "serving.knative.dev/v1beta1",
+		"kind":       "DomainMapping",
+		"metadata":   map[string]interface{}{"name": "api.example.com"},
+	}}
+	output, err := transformer.Transform(mapping)
+	require.NoError(t, err)
+	assert.Equal(t, "api.dr.example.com", output.GetName())
+
+	_, err = ruleSet{transformer: transformerKnative, config: map[string]string{"autoscaling.yaml": "replicas: \"3\""}}.build(logrus.New())
+	assert.Error(t, err)
+}
+
+func TestRuleSetBuild_ServiceIPs(t *testing.T) {
+	set := ruleSet{transformer: transformerSvcIPs, config: map[string]string{"preserve-load-balancer-ips": "203.0.113.10"}}
+	transformer, err := set.build(logrus.New())
+	require.NoError(t, err)
+
+	service := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "Service",
+		"spec":       map[string]interface{}{"clusterIP": "10.0.0.1", "loadBalancerIP": "203.0.113.10"},
+	}}
+	output, err := transformer.Transform(service)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"loadBalancerIP": "203.0.113.10"}, output.Object["spec"])
+
+	_, err = ruleSet{transformer: transformerSvcIPs, config: map[string]string{"preserve-load-balancer-ips": "nope"}}.build(logrus.New())
+	assert.Error(t, err)
+}
+
+func TestRuleSetBuild_NodePorts(t *testing.T) {
+	transformer, err := ruleSet{transformer: transformerPorts, config: map[string]string{
+		"policy":       "map",
+		"mapping.yaml": "30080: 31080\n",
+	}}.build(logrus.New())
+	require.NoError(t, err)
+	assert.Equal(t, &transform.NodePorts{Policy: transform.NodePortsMap, Mapping: map[int64]int64{30080: 31080}}, withoutWarn(transformer))
+
+	transformer, err = ruleSet{transformer: transformerPorts}.build(logrus.New())
+	require.NoError(t, err)
+	assert.Equal(t, transform.NodePortsPreserve, transformer.(*transform.NodePorts).Policy)
+
+	_, err = ruleSet{transformer: transformerPorts, config: map[string]string{"policy": "keep"}}.build(logrus.New())
+	assert.Error(t, err)
+	_, err = ruleSet{transformer: transformerPorts, config: map[string]string{"policy": "map", "mapping.yaml": "http: 31080"}}.build(logrus.New())
+	assert.Error(t, err)
+}
+
+func withoutWarn(transformer transform.Transformer) *transform.NodePorts {
+	nodePorts := *transformer.(*transform.NodePorts)
+	nodePorts.Warn = nil
+	return &nodePorts
+}
+
+func TestRuleSetBuild_Ingress(t *testing.T) {
+	set := ruleSet{transformer: transformerIngress, config: map[string]string{
+		"from":         "nginx",
+		"to":           "alb",
+		"unknown":      "drop",
+		"classes.yaml": "nginx: alb\n",
+	}}
+	transformer, err := set.build(logrus.New())
+	require.NoError(t, err)
+
+	ingress := &unstructured.Unstructured{Object: map[string]interface{}{
+		"kind": "Ingress",
+		"spec": map[string]interface{}{"ingressClassName": "nginx"},
+	}}
+	ingress.SetAnnotations(map[string]string{"nginx.ingress.kubernetes.io/ssl-redirect": "true", "nginx.ingress.kubernetes.io/rewrite-target": "/"})
+	output, err := transformer.Transform(ingress)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"ingressClassName": "alb"}, output.Object["spec"])
+	assert.Equal(t, map[string]string{"alb.ingress.kubernetes.io/ssl-redirect": "443"}, output.GetAnnotations())
+
+	// classes alone need no controllers
+	_, err = ruleSet{transformer: transformerIngress, config: map[string]string{"classes.yaml": "nginx: nginx-dr"}}.build(logrus.New())
+	assert.NoError(t, err)
+	_, err = ruleSet{transformer: transformerIngress, config: map[string]string{"from": "nginx", "to": "istio"}}.build(logrus.New())
+	assert.Error(t, err)
+}
+
+func TestReplacePatternAction_Regex(t *testing.T) {
+	t.Setenv(stampOriginEnv, "false")
+	plugin := &RestorePlugin{logger: logrus.New()}
+	restore := &velerov1.Restore{ObjectMeta: metav1.ObjectMeta{Name: "dr-1", UID: "uid-1"}}
+	sets := ruleSetsFrom([]v1.ConfigMap{
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "hosts", Annotations: map[string]string{transformerAnnotation: transformerRegex}},
+			Data: map[string]string{regexPatternsKey: `
+- regex: '([a-z0-9-]+)\.old-domain\.com'
+  replacement: '${1}.new-domain.com'
+- regex: 'tier-(prod|staging)'
+  replacement: 'tier-dr'
+`},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "broken", Annotations: map[string]string{transformerAnnotation: transformerRegex}},
+			Data:       map[string]string{regexPatternsKey: "- regex: 'foo(?=bar)'\n"},
+		},
+	})
+
+	ingress := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "networking.k8s.io/v1",
+		"kind":       "Ingress",
+		"metadata": map[string]interface{}{
+			"name":      "web",
+			"namespace": "shop",
+			"labels":    map[string]interface{}{"velero.io/backup-name": "tier-prod"},
+		},
+		"spec": map[string]interface{}{"rules": []interface{}{
+			map[string]interface{}{"host": "web.old-domain.com"},
+			map[string]interface{}{"host": "api.old-domain.com"},
+		}},
+	}}
+	ingress.SetAnnotations(map[string]string{"tier": "tier-staging"})
+
+	output, err := replacePatternAction(plugin, &velero.RestoreItemActionExecuteInput{Item: ingress, Restore: restore}, sets)
+	require.NoError(t, err)
+	item := output.UpdatedItem.(*unstructured.Unstructured)
+	assert.Equal(t, []interface{}{
+		map[string]interface{}{"host": "web.new-domain.com"},
+		map[string]interface{}{"host": "api.new-domain.com"},
+	}, item.Object["spec"].(map[string]interface{})["rules"])
+	assert.Equal(t, map[string]string{"tier": "tier-dr"}, item.GetAnnotations())
+	assert.Equal(t, map[string]string{"velero.io/backup-name": "tier-prod"}, item.GetLabels())
+
+	// hits are reported, but regex rules are left out of the inverse rules
+	report := plugin.stateFor(restore).report
+	assert.Equal(t, 2, report.heatmap[heatmapKey{rule: `([a-z0-9-]+)\.old-domain\.com`, kind: "Ingress", namespace: "shop"}])
+	assert.Empty(t, report.applied)
+
+	_, err = ruleSet{transformer: transformerRegex, config: map[string]string{regexPatternsKey: "regex: x"}}.build(logrus.New())
+	assert.Error(t, err)
+}
+
+func TestRuleSetBuild_JSONPatch(t *testing.T) {
+	set := ruleSet{transformer: transformerPatch, config: map[string]string{jsonPatchKey: `
+- op: test
+  path: /spec/template/spec/nodeSelector/pool
+  value: prod
+- op: remove
+  path: /spec/template/spec/nodeSelector
+- op: replace
+  path: /spec/replicas
+  value: 1
+`}}
+	transformer, err := set.build(logrus.New())
+	require.NoError(t, err)
+
+	deployment := &unstructured.Unstructured{Object: map[string]interface{}{
+		"kind": "Deployment",
+		"spec": map[string]interface{}{
+			"replicas": int64(3),
+			"template": map[string]interface{}{"spec": map[string]interface{}{"nodeSelector": map[string]interface{}{"pool": "prod"}}},
+		},
+	}}
+	output, err := transformer.Transform(deployment)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"replicas": int64(1), "template": map[string]interface{}{"spec": map[string]interface{}{}}}, output.Object["spec"])
+
+	_, err = ruleSet{transformer: transformerPatch, config: map[string]string{jsonPatchKey: "- op: replace\n  path: /spec/replicas\n"}}.build(logrus.New())
+	assert.Error(t, err)
+}
+
+func TestRuleSetBuild_APIVersions(t *testing.T) {
+	set := ruleSet{transformer: transformerVersions, config: map[string]string{versionRulesKey: `
+- kind: Certificate
+  from: certmanager.k8s.io/v1alpha1
+  to: cert-manager.io/v1
+  move:
+  - from: spec.acme.config
+    to: spec.solvers
+  remove: [spec.acme]
+  defaults:
+    spec.privateKey.rotationPolicy: Always
+`}}
+	transformer, err := set.build(logrus.New())
+	require.NoError(t, err)
+	assert.Equal(t, &transform.APIVersions{Builtin: true, Rules: []transform.VersionRule{{
+		Kind:     "Certificate",
+		From:     "certmanager.k8s.io/v1alpha1",
+		To:       "cert-manager.io/v1",
+		Moves:    []transform.FieldMove{{From: []string{"spec", "acme", "config"}, To: []string{"spec", "solvers"}}},
+		Remove:   [][]string{{"spec", "acme"}},
+		Defaults: []transform.FieldDefault{{Path: []string{"spec", "privateKey", "rotationPolicy"}, Value: "Always"}},
+	}}}, transformer)
+
+	transformer, err = ruleSet{transformer: transformerVersions, config: map[string]string{"builtin": "false"}}.build(logrus.New())
+	require.NoError(t, err)
+	assert.False(t, transformer.(*transform.APIVersions).Builtin)
+
+	_, err = ruleSet{transformer: transformerVersions, config: map[string]string{versionRulesKey: "- kind: Certificate\n  from: a/v1\n"}}.build(logrus.New())
+	assert.Error(t, err)
+	_, err = ruleSet{transformer: transformerVersions, config: map[string]string{"builtin": "maybe"}}.build(logrus.New())
+	assert.Error(t, err)
+}
+
+func TestRuleSetBuild_JQ(t *testing.T) {
+	set := ruleSet{transformer: transformerJQ, config: map[string]string{jqFilterKey: `.metadata.annotations["restored"] = "true"`}}
+	transformer, err := set.build(logrus.New())
+	require.NoError(t, err)
+	output, err := transformer.Transform(&unstructured.Unstructured{Object: map[string]interface{}{"kind": "ConfigMap", "metadata": map[string]interface{}{"name": "web"}}})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"restored": "true"}, output.GetAnnotations())
+
+	_, err = ruleSet{transformer: transformerJQ, config: map[string]string{}}.build(logrus.New())
+	assert.Error(t, err)
+	_, err = ruleSet{transformer: transformerJQ, config: map[string]string{jqFilterKey: ".metadata |"}}.build(logrus.New())
+	assert.Error(t, err)
+}
+
+func TestRuleSetBuild_Lua(t *testing.T) {
+	set := ruleSet{transformer: transformerLua, config: map[string]string{luaScriptKey: `
+function transform(item)
+  item.metadata.annotations = {restored = "true"}
+  return item
+end`}}
+	transformer, err := set.build(logrus.New())
+	require.NoError(t, err)
+	output, err := transformer.Transform(&unstructured.Unstructured{Object: map[string]interface{}{"kind": "ConfigMap", "metadata": map[string]interface{}{"name": "web"}}})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"restored": "true"}, output.GetAnnotations())
+
+	_, err = ruleSet{transformer: transformerLua, config: map[string]string{}}.build(logrus.New())
+	assert.Error(t, err)
+	_, err = ruleSet{transformer: transformerLua, config: map[string]string{luaScriptKey: "function transform("}}.build(logrus.New())
+	assert.Error(t, err)
+}
+
+func TestRuleSetBuild_ExtendedResources(t *testing.T) {
+	set := ruleSet{transformer: transformerDevices, config: map[string]string{
+		"resources.yaml":       "nvidia.com/gpu: amd.com/gpu\nnvidia.com/mig-1g:\n  name: nvidia.com/gpu\n  factor: 0.5\nexample.com/fpga:\n  factor: 2\n",
+		"runtime-classes.yaml": "nvidia: amd\n",
+		"node-selectors.yaml":  "accelerator=t4: accelerator=mi210\n",
+	}}
+	transformer, err := set.build(logrus.New())
+	require.NoError(t, err)
+	devices := transformer.(*transform.ExtendedResources)
+	assert.Equal(t, transform.ExtendedResourcesKeep, devices.Fallback)
+	assert.Equal(t, "amd.com/gpu", devices.Resources["nvidia.com/gpu"].Name)
+	assert.Nil(t, devices.Resources["nvidia.com/gpu"].Factor)
+	assert.Equal(t, "nvidia.com/gpu", devices.Resources["nvidia.com/mig-1g"].Name)
+	assert.Equal(t, "500m", devices.Resources["nvidia.com/mig-1g"].Factor.String())
+	assert.Equal(t, "example.com/fpga", devices.Resources["example.com/fpga"].Name)
+	assert.Equal(t, map[string]string{"nvidia": "amd"}, devices.RuntimeClasses)
+	assert.Equal(t, map[string]string{"accelerator=t4": "accelerator=mi210"}, devices.NodeSelectors)
+
+	for _, config := range []map[string]string{
+		{"fallback": "drop"},
+		{"gpus.yaml": "nvidia.com/gpu: amd.com/gpu"},
+		{"resources.yaml": "nvidia.com/gpu: [amd.com/gpu]"},
+		{"resources.yaml": "nvidia.com/gpu:\n  factor: lots\n"},
+		{"resources.yaml": "nvidia.com/gpu: memory"},
+		{"node-selectors.yaml": "accelerator: gpu"},
+	} {
+		_, err = ruleSet{transformer: transformerDevices, config: config}.build(logrus.New())
+		assert.Error(t, err, config)
+	}
+}
+
+func TestRuleSetBuild_TopologySpread(t *testing.T) {
+	set := ruleSet{transformer: transformerTopology, config: map[string]string{
+		"max-nodes":          "10",
+		"min-max-skew":       "2",
+		"when-unsatisfiable": "ScheduleAnyway",
+		topologyInjectKey:    "- topologyKey: kubernetes.io/hostname\n  maxSkew: 1\n",
+	}}
+	transformer, err := set.build(logrus.New())
+	require.NoError(t, err)
+	assert.Equal(t, &transform.TopologySpread{
+		MaxNodes:          10,
+		MinMaxSkew:        2,
+		WhenUnsatisfiable: "ScheduleAnyway",
+		AntiAffinity:      transform.AntiAffinityAuto,
+		Inject:            []map[string]interface{}{{"topologyKey": "kubernetes.io/hostname", "maxSkew": int64(1)}},
+	}, transformer)
+
+	for _, config := range []map[string]string{
+		{"anti-affinity": "never"},
+		{"max-nodes": "five"},
+		{"min-max-skew": "-1"},
+		{"when-unsatisfiable": "Sometimes"},
+		{topologyInjectKey: "- maxSkew: 1"},
+		{topologyInjectKey: "- kubernetes.io/hostname"},
+	} {
+		_, err = ruleSet{transformer: transformerTopology, config: config}.build(logrus.New())
+		assert.Error(t, err, config)
+	}
+}
+
+func TestRuleSetBuild_Starlark(t *testing.T) {
+	script := `
+def transform(item):
+    for i in range(1000):
+        pass
+    item["metadata"]["annotations"] = {"restored": "true"}
+    return item
+`
+	set := ruleSet{transformer: transformerStarlark, config: map[string]string{starlarkScriptKey: script}}
+	transformer, err := set.build(logrus.New())
+	require.NoError(t, err)
+	configMap := &unstructured.Unstructured{Object: map[string]interface{}{"kind": "ConfigMap", "metadata": map[string]interface{}{"name": "web"}}}
+	output, err := transformer.Transform(configMap)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"restored": "true"}, output.GetAnnotations())
+
+	set.config["max-steps"] = "100"
+	transformer, err = set.build(logrus.New())
+	require.NoError(t, err)
+	_, err = transformer.Transform(configMap)
+	assert.Error(t, err, "the loop exceeds the step limit")
+
+	for _, config := range []map[string]string{
+		{},
+		{starlarkScriptKey: "def transform(item)"},
+		{starlarkScriptKey: script, "max-steps": "0"},
+		{starlarkScriptKey: script, "max-steps": "many"},
+	} {
+		_, err = ruleSet{transformer: transformerStarlark, config: config}.build(logrus.New())
+		assert.Error(t, err, config)
+	}
+}
+
+func TestRuleSetBuild_StrategicMerge(t *testing.T) {
+	set := ruleSet{transformer: transformerMerge, config: map[string]string{
+		"Deployment.yaml": `
+metadata:
+  labels:
+    restored-by: velero
+spec:
+  template:
+    spec:
+      containers:
+      - name: web
+        env:
+        - name: REGION
+          value: dr
+`,
+		"Certificate.yaml": "spec:\n  issuerRef:\n    name: dr-issuer\n",
+	}}
+	transformer, err := set.build(logrus.New())
+	require.NoError(t, err)
+
+	deployment := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "apps/v1",
+		"kind":       "Deployment",
+		"metadata":   map[string]interface{}{"name": "web", "labels": map[string]interface{}{"app": "web"}},
+		"spec": map[string]interface{}{
+			"replicas": int64(2),
+			"template": map[string]interface{}{"spec": map[string]interface{}{"containers": []interface{}{
+				map[string]interface{}{"name": "web", "image": "web:1"},
+				map[string]interface{}{"name": "proxy", "image": "proxy:1"},
+			}}},
+		},
+	}}
+	output, err := transformer.Transform(deployment)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"app": "web", "restored-by": "velero"}, output.GetLabels())
+	assert.Equal(t, int64(2), output.Object["spec"].(map[string]interface{})["replicas"])
+	containers, _, _ := unstructured.NestedSlice(output.Object, "spec", "template", "spec", "containers")
+	// containers are merged on their name
+	assert.Equal(t, []interface{}{
+		map[string]interface{}{"name": "web", "image": "web:1", "env": []interface{}{map[string]interface{}{"name": "REGION", "value": "dr"}}},
+		map[string]interface{}{"name": "proxy", "image": "proxy:1"},
+	}, containers)
+
+	certificate := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "cert-manager.io/v1",
+		"kind":       "Certificate",
+		"spec":       map[string]interface{}{"issuerRef": map[string]interface{}{"name": "prod-issuer", "kind": "ClusterIssuer"}},
+	}}
+	output, err = transformer.Transform(certificate)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"name": "dr-issuer", "kind": "ClusterIssuer"}, output.Object["spec"].(map[string]interface{})["issuerRef"])
+
+	_, err = ruleSet{transformer: transformerMerge, config: map[string]string{"Deployment": "metadata: {}"}}.build(logrus.New())
+	assert.Error(t, err)
+	_, err = ruleSet{transformer: transformerMerge, config: map[string]string{"Deployment.yaml": "- op: remove"}}.build(logrus.New())
+	assert.Error(t, err)
+}
+
+func TestRuleSetBuild_ImagePinning(t *testing.T) {
+	transformer, err := ruleSet{transformer: transformerPinning, config: map[string]string{}}.build(logrus.New())
+	require.NoError(t, err)
+	pinning := transformer.(*transform.ImagePinning)
+	assert.Equal(t, transform.PinFloating, pinning.Pin)
+	assert.Equal(t, []string{"latest"}, pinning.FloatingTags)
+	assert.False(t, pinning.Strict)
+
+	transformer, err = ruleSet{transformer: transformerPinning, config: map[string]string{
+		"pin":           "all",
+		"floating-tags": "latest, stable,",
+		"pull-policy":   "Always",
+		"missing":       "fail",
+	}}.build(logrus.New())
+	require.NoError(t, err)
+	pinning = transformer.(*transform.ImagePinning)
+	assert.Equal(t, transform.PinAll, pinning.Pin)
+	assert.Equal(t, []string{"latest", "stable"}, pinning.FloatingTags)
+	assert.Equal(t, "Always", pinning.PullPolicy)
+	assert.True(t, pinning.Strict)
+
+	for _, config := range []map[string]string{
+		{"pin": "some"},
+		{"missing": "drop"},
+		{"pull-policy": "always"},
+		{"tags": "latest"},
+	} {
+		_, err = ruleSet{transformer: transformerPinning, config: config}.build(logrus.New())
+		assert.Error(t, err, config)
+	}
+}
+
+func TestRuleSetBuild_NamespacePolicy(t *testing.T) {
+	transformer, err := ruleSet{transformer: transformerNSPolicy, config: map[string]string{
+		"labels.yaml":      "environment: dr\npod-security.kubernetes.io/enforce: restricted",
+		"annotations.yaml": "cost-center: '{{ .Env.COST_CENTER }}'",
+	}}.build(logrus.New())
+	require.NoError(t, err)
+	policy := transformer.(*transform.NamespacePolicy)
+	assert.Equal(t, map[string]string{"environment": "dr", "pod-security.kubernetes.io/enforce": "restricted"}, policy.Labels)
+	assert.Equal(t, map[string]string{"cost-center": "{{ .Env.COST_CENTER }}"}, policy.Annotations)
+
+	for _, config := range []map[string]string{
+		{"labels.yaml": "environment: '{{ .Env.ENV'"},
+		{"labels.yaml": "bad key!: dr"},
+		{"namespaces.yaml": "shop: dr"},
+	} {
+		_, err = ruleSet{transformer: transformerNSPolicy, config: config}.build(logrus.New())
+		assert.Error(t, err, config)
+	}
+}
+
+func TestReplacePatternAction_NamespacePolicy(t *testing.T) {
+	t.Setenv(stampOriginEnv, "false")
+	t.Setenv(templateVarPrefix+"COST_CENTER", "CC-1234")
+	plugin := &RestorePlugin{logger: logrus.New()}
+	sets := ruleSetsFrom([]v1.ConfigMap{
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "governance", Annotations: map[string]string{transformerAnnotation: transformerNSPolicy}},
+			Data: map[string]string{
+				"labels.yaml":      "environment: dr\npod-security.kubernetes.io/enforce: '{{ index .Item.metadata.labels \"pod-security.kubernetes.io/enforce\" }}'",
+				"annotations.yaml": "cost-center: '{{ .Env.COST_CENTER }}'\nrestored-by: '{{ .Restore }}'",
+			},
+		},
+		{ObjectMeta: metav1.ObjectMeta{Name: "hosts"}, Data: map[string]string{"prod": "dr"}},
+	})
+	restore := &velerov1.Restore{ObjectMeta: metav1.ObjectMeta{Name: "dr-1", UID: "uid-1"}}
+	namespace := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "Namespace",
+		"metadata": map[string]interface{}{
+			"name":   "shop-prod",
+			"labels": map[string]interface{}{"environment": "prod", "pod-security.kubernetes.io/enforce": "baseline"},
+		},
+	}}
+
+	output, err := replacePatternAction(plugin, &velero.RestoreItemActionExecuteInput{Item: namespace, Restore: restore}, sets)
+	require.NoError(t, err)
+	result := output.UpdatedItem.(*unstructured.Unstructured)
+	assert.Equal(t, "shop-prod", result.GetName(), "cluster-scoped names are not rewritten")
+	assert.Equal(t, map[string]string{"environment": "dr", "pod-security.kubernetes.io/enforce": "baseline"}, result.GetLabels())
+	assert.Equal(t, map[string]string{"cost-center": "CC-1234", "restored-by": "dr-1"}, result.GetAnnotations())
+}
@@ -0,0 +1,111 @@
+package plugin
+
+import (
+	"reflect"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"github.com/vmware-tanzu/velero/pkg/plugin/velero"
+	"github.com/wrkt/velero-custom-plugins/internal/transform"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+const (
+	// veleroResourcesPolicyEnv is what the restore plugin does with the items
+	// of Velero the rules change: its resources, such as Backups or
+	// BackupStorageLocations, and the items of the velero namespace.
+	veleroResourcesPolicyEnv = "REPLACE_PATTERN_VELERO_RESOURCES_POLICY"
+	// veleroResourcesWarn restores them changed, with a warning.
+	veleroResourcesWarn = "warn"
+	// veleroResourcesBlock restores them untouched.
+	veleroResourcesBlock = "block"
+	// veleroResourcesCritical aborts the restore at the first of them.
+	veleroResourcesCritical = severityCritical
+
+	veleroGroup     = "velero.io"
+	veleroNamespace = "velero"
+)
+
+// stampedAnnotations are the annotations the plugin sets on items whatever the
+// rules.
+var stampedAnnotations = []string{
+	transform.OriginalNameAnnotation,
+	transform.OriginalNamespaceAnnotation,
+	transform.OriginalClusterAnnotation,
+	transform.FreezeUntilAnnotation,
+}
+
+// loadVeleroResourcesPolicy returns the policy of veleroResourcesPolicyEnv,
+// veleroResourcesWarn when unset or invalid.
+func loadVeleroResourcesPolicy(lookup lookupFunc, logger logrus.FieldLogger) string {
+	policy, _ := lookup(veleroResourcesPolicyEnv)
+	switch policy = strings.TrimSpace(policy); policy {
+	case veleroResourcesWarn, veleroResourcesBlock, veleroResourcesCritical:
+		return policy
+	case "":
+		return veleroResourcesWarn
+	default:
+		logger.Warnf("Ignoring invalid %s=%q", veleroResourcesPolicyEnv, policy)
+		return veleroResourcesWarn
+	}
+}
+
+// isVeleroItem reports whether an item, as in the backup or as restored,
+// belongs to Velero: a resource of its API group, the velero namespace or an
+// item of it.
+func isVeleroItem(items ...*unstructured.Unstructured) bool {
+	for _, item := range items {
+		group := strings.SplitN(item.GetAPIVersion(), "/", 2)[0]
+		if group == veleroGroup || item.GetNamespace() == veleroNamespace {
+			return true
+		}
+		if item.GetAPIVersion() == "v1" && item.GetKind() == "Namespace" && item.GetName() == veleroNamespace {
+			return true
+		}
+	}
+	return false
+}
+
+// changedByRules reports whether output differs from item other than by the
+// stampedAnnotations.
+func changedByRules(item, output *unstructured.Unstructured) bool {
+	unstamped := func(u *unstructured.Unstructured) map[string]interface{} {
+		u = u.DeepCopy()
+		annotations := u.GetAnnotations()
+		if annotations == nil {
+			return u.Object
+		}
+		for _, key := range stampedAnnotations {
+			delete(annotations, key)
+		}
+		if len(annotations) == 0 {
+			annotations = nil
+		}
+		u.SetAnnotations(annotations)
+		return u.Object
+	}
+	return !reflect.DeepEqual(unstamped(item), unstamped(output))
+}
+
+// guardVeleroItem warns when the rules change an item of Velero, and returns
+// the policy the item falls under, veleroResourcesWarn when it may be
+// restored changed.
+func (p *RestorePlugin) guardVeleroItem(input *velero.RestoreItemActionExecuteInput, item, output *unstructured.Unstructured, state *restoreState) string {
+	if !isVeleroItem(originalItem(input), item, output) || !changedByRules(item, output) {
+		return veleroResourcesWarn
+	}
+	if state.report != nil {
+		state.report.recordVeleroItem()
+	}
+	switch p.veleroPolicy {
+	case veleroResourcesBlock:
+		p.logger.Warnf("Restoring %s %s/%s untouched: it belongs to Velero, whose objects the rules must not change", item.GetKind(), item.GetNamespace(), item.GetName())
+		return veleroResourcesBlock
+	case veleroResourcesCritical:
+		p.abortRestore(state, item, "the rules change an object of Velero")
+		return veleroResourcesCritical
+	}
+	p.logger.Warnf("The rules change %s %s/%s, which belongs to Velero: rewriting Velero's own objects during a restore is almost always a mistake (set %s=%s to restore them untouched)",
+		item.GetKind(), item.GetNamespace(), item.GetName(), veleroResourcesPolicyEnv, veleroResourcesBlock)
+	return veleroResourcesWarn
+}
@@ -0,0 +1,96 @@
+package plugin
+
+import (
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	velerov1 "github.com/vmware-tanzu/velero/pkg/apis/velero/v1"
+	"github.com/vmware-tanzu/velero/pkg/plugin/velero"
+	"github.com/wrkt/velero-custom-plugins/internal/transform"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestLoadVeleroResourcesPolicy(t *testing.T) {
+	lookup := func(value string) lookupFunc {
+		return func(string) (string, bool) { return value, value != "" }
+	}
+	assert.Equal(t, veleroResourcesWarn, loadVeleroResourcesPolicy(lookup(""), logrus.New()))
+	assert.Equal(t, veleroResourcesBlock, loadVeleroResourcesPolicy(lookup(" block "), logrus.New()))
+	assert.Equal(t, veleroResourcesCritical, loadVeleroResourcesPolicy(lookup("critical"), logrus.New()))
+	assert.Equal(t, veleroResourcesWarn, loadVeleroResourcesPolicy(lookup("refuse"), logrus.New()))
+}
+
+func TestIsVeleroItem(t *testing.T) {
+	item := func(apiVersion, kind, namespace, name string) *unstructured.Unstructured {
+		u := &unstructured.Unstructured{}
+		u.SetAPIVersion(apiVersion)
+		u.SetKind(kind)
+		u.SetNamespace(namespace)
+		u.SetName(name)
+		return u
+	}
+	assert.True(t, isVeleroItem(item("velero.io/v1", "BackupStorageLocation", "velero", "default")))
+	assert.True(t, isVeleroItem(item("velero.io/v1", "Schedule", "backups", "daily")), "whatever its namespace")
+	assert.True(t, isVeleroItem(item("v1", "Secret", "velero", "cloud-credentials")))
+	assert.True(t, isVeleroItem(item("v1", "Namespace", "", "velero")))
+	assert.False(t, isVeleroItem(item("v1", "Namespace", "", "shop")))
+	assert.False(t, isVeleroItem(item("apps/v1", "Deployment", "shop", "velero")))
+	assert.True(t, isVeleroItem(item("v1", "ConfigMap", "shop", "rules"), item("v1", "ConfigMap", "velero", "rules")), "moved to the velero namespace")
+}
+
+func TestChangedByRules(t *testing.T) {
+	item := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "ConfigMap",
+		"metadata":   map[string]interface{}{"name": "rules", "namespace": "velero"},
+		"data":       map[string]interface{}{"example.com": "dr.example.com"},
+	}}
+	stamped := item.DeepCopy()
+	stamped.SetAnnotations(map[string]string{transform.OriginalNameAnnotation: "rules", transform.OriginalNamespaceAnnotation: "velero"})
+	assert.False(t, changedByRules(item, stamped))
+
+	changed := stamped.DeepCopy()
+	changed.Object["data"] = map[string]interface{}{"example.com": "dr.dr.example.com"}
+	assert.True(t, changedByRules(item, changed))
+}
+
+func TestReplacePatternAction_VeleroResources(t *testing.T) {
+	restore := &velerov1.Restore{ObjectMeta: metav1.ObjectMeta{Name: "dr-1", UID: "uid-1"}}
+	sets := ruleSetsFrom([]v1.ConfigMap{{
+		ObjectMeta: metav1.ObjectMeta{Name: "buckets"},
+		Data:       map[string]string{"backups-prod": "backups-dr"},
+	}})
+	location := func() *unstructured.Unstructured {
+		return &unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": "velero.io/v1",
+			"kind":       "BackupStorageLocation",
+			"metadata":   map[string]interface{}{"name": "default", "namespace": "velero"},
+			"spec":       map[string]interface{}{"objectStorage": map[string]interface{}{"bucket": "backups-prod"}},
+		}}
+	}
+	run := func(plugin *RestorePlugin) *unstructured.Unstructured {
+		output, err := replacePatternAction(plugin, &velero.RestoreItemActionExecuteInput{Item: location(), Restore: restore}, sets)
+		require.NoError(t, err)
+		return output.UpdatedItem.(*unstructured.Unstructured)
+	}
+
+	// warned about by default
+	plugin := &RestorePlugin{logger: logrus.New()}
+	bucket, _, _ := unstructured.NestedString(run(plugin).Object, "spec", "objectStorage", "bucket")
+	assert.Equal(t, "backups-dr", bucket)
+	assert.Equal(t, 1, plugin.stateFor(restore).report.summary.ItemsVelero)
+
+	plugin = &RestorePlugin{logger: logrus.New(), veleroPolicy: veleroResourcesBlock}
+	assert.Equal(t, location(), run(plugin), "the item is restored untouched")
+	assert.Equal(t, 1, plugin.stateFor(restore).report.summary.ItemsVelero)
+
+	// the annotations the plugin stamps are not changes of the rules
+	sets = nil
+	output := run(plugin)
+	assert.Equal(t, "default", output.GetAnnotations()[transform.OriginalNameAnnotation])
+	assert.Equal(t, 1, plugin.stateFor(restore).report.summary.ItemsVelero)
+}
@@ -0,0 +1,94 @@
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/version"
+	appsv1 "k8s.io/client-go/kubernetes/typed/apps/v1"
+)
+
+const (
+	versionPolicyEnv = "REPLACE_PATTERN_VERSION_POLICY"
+
+	// versionPolicyWarn logs unsupported Velero versions and keeps going.
+	versionPolicyWarn = "warn"
+	// versionPolicyRefuse stops the plugin on unsupported Velero versions.
+	versionPolicyRefuse = "refuse"
+
+	veleroDeploymentName = "velero"
+	veleroContainerName  = "velero"
+)
+
+// Range of Velero server versions this build supports, lower bound inclusive
+// and upper bound exclusive. It follows the Velero module the plugin is built
+// against and can be overridden at link time with -ldflags -X.
+var (
+	minVeleroVersion = "1.10.0"
+	maxVeleroVersion = "1.13.0"
+)
+
+// checkVeleroVersion reads the Velero server version from the image tag of its
+// deployment and returns an error when it is outside of the supported range.
+func checkVeleroVersion(deployments appsv1.DeploymentInterface) error {
+	deployment, err := deployments.Get(context.TODO(), veleroDeploymentName, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to get the %s deployment to check the Velero version: %v", veleroDeploymentName, err)
+	}
+
+	var image string
+	for _, container := range deployment.Spec.Template.Spec.Containers {
+		if container.Name == veleroContainerName {
+			image = container.Image
+		}
+	}
+	if image == "" {
+		return fmt.Errorf("no %s container found in the %s deployment", veleroContainerName, veleroDeploymentName)
+	}
+
+	tag := imageTag(image)
+	serverVersion, err := version.ParseSemantic(tag)
+	if err != nil {
+		return fmt.Errorf("cannot tell the Velero version from image %s: pin the image to a release tag (e.g. v%s)", image, minVeleroVersion)
+	}
+
+	minVersion := version.MustParseSemantic(minVeleroVersion)
+	maxVersion := version.MustParseSemantic(maxVeleroVersion)
+	if serverVersion.LessThan(minVersion) || !serverVersion.LessThan(maxVersion) {
+		return fmt.Errorf("Velero %s is not supported by this plugin build, which supports versions >= %s and < %s: upgrade Velero or use a plugin release built for it", tag, minVeleroVersion, maxVeleroVersion)
+	}
+	return nil
+}
+
+// imageTag returns the tag of an image reference, ignoring any digest.
+func imageTag(image string) string {
+	image = strings.SplitN(image, "@", 2)[0]
+	// the tag is after the last colon, unless that colon belongs to a
+	// registry port (followed by a path)
+	i := strings.LastIndex(image, ":")
+	if i < 0 || strings.Contains(image[i:], "/") {
+		return ""
+	}
+	return image[i+1:]
+}
+
+// enforceVeleroVersion runs the version check and applies the configured
+// policy.
+func enforceVeleroVersion(deployments appsv1.DeploymentInterface, lookup lookupFunc, logger logrus.FieldLogger) {
+	err := checkVeleroVersion(deployments)
+	if err == nil {
+		return
+	}
+
+	policy, _ := lookup(versionPolicyEnv)
+	if policy == versionPolicyRefuse {
+		logger.Fatalf("Refusing to start: %v (set %s=%s to only warn)", err, versionPolicyEnv, versionPolicyWarn)
+	}
+	if policy != "" && policy != versionPolicyWarn {
+		logger.Warnf("Ignoring invalid %s=%q", versionPolicyEnv, policy)
+	}
+	logger.Warnf("Velero version check: %v", err)
+}
@@ -0,0 +1,64 @@
+package plugin
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/wrkt/velero-custom-plugins/mocks"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func veleroDeployment(image string) *appsv1.Deployment {
+	return &appsv1.Deployment{
+		Spec: appsv1.DeploymentSpec{
+			Template: corev1.PodTemplateSpec{
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{
+						{Name: "sidecar", Image: "busybox:1.33.1"},
+						{Name: veleroContainerName, Image: image},
+					},
+				},
+			},
+		},
+	}
+}
+
+func TestCheckVeleroVersion(t *testing.T) {
+	tests := []struct {
+		name    string
+		image   string
+		getErr  error
+		wantErr bool
+	}{
+		{name: "supported", image: "velero/velero:v1.11.1"},
+		{name: "supported with registry port and digest", image: "registry:5000/velero/velero:v1.12.0@sha256:abcd"},
+		{name: "too old", image: "velero/velero:v1.9.5", wantErr: true},
+		{name: "too new", image: "velero/velero:v1.13.0", wantErr: true},
+		{name: "not a release tag", image: "velero/velero:main", wantErr: true},
+		{name: "no tag", image: "registry:5000/velero/velero", wantErr: true},
+		{name: "deployment not readable", getErr: errors.New("forbidden"), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			deployments := mocks.NewMockDeploymentInterface(ctrl)
+			deployments.EXPECT().
+				Get(gomock.Any(), veleroDeploymentName, metav1.GetOptions{}).
+				Return(veleroDeployment(tt.image), tt.getErr)
+
+			err := checkVeleroVersion(deployments)
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,95 @@
+package transform
+
+import (
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// settingAnnotation is how a vendor, a cloud provider or an ingress
+// controller, expresses a setting. decode returns the vendor-neutral value,
+// encode the vendor's value, both returning false when the value has no
+// equivalent.
+type settingAnnotation struct {
+	key    string
+	decode func(string) (string, bool)
+	encode func(string) (string, bool)
+}
+
+// annotationTranslation translates the vendor-specific annotations of an item
+// from one vendor to another. settings lists, per vendor-neutral setting, the
+// annotations of each vendor expressing it, the first one being written on
+// translation. prefixes identify the annotations of each vendor.
+type annotationTranslation struct {
+	settings map[string]map[string][]settingAnnotation
+	prefixes map[string][]string
+	from, to string
+	// extra maps source annotation keys to target ones, values being copied
+	// as is
+	extra map[string]string
+	// unknown is the policy for the source annotations without a
+	// translation, warn being called for each one under UnknownWarn
+	unknown string
+	warn    func(format string, args ...interface{})
+}
+
+// translate returns the translated annotations of item.
+func (t annotationTranslation) translate(item *unstructured.Unstructured) map[string]string {
+	annotations := item.GetAnnotations()
+	translated := make(map[string]string, len(annotations))
+	handled := make(map[string]bool)
+	for key, target := range t.extra {
+		if value, ok := annotations[key]; ok {
+			translated[target] = value
+			handled[key] = true
+		}
+	}
+	for _, vendors := range t.settings {
+		targets := vendors[t.to]
+		if len(targets) == 0 {
+			continue
+		}
+		for _, source := range vendors[t.from] {
+			value, ok := annotations[source.key]
+			if !ok || handled[source.key] {
+				continue
+			}
+			if neutral, ok := source.decode(value); ok {
+				if value, ok := targets[0].encode(neutral); ok {
+					translated[targets[0].key] = value
+					handled[source.key] = true
+				}
+			}
+		}
+	}
+
+	for key, value := range annotations {
+		if handled[key] {
+			continue
+		}
+		if t.fromVendor(key) {
+			switch t.unknown {
+			case UnknownDrop:
+				continue
+			case UnknownWarn:
+				if t.warn != nil {
+					t.warn("Annotation %s of %s %s/%s has no %s translation", key, item.GetKind(), item.GetNamespace(), item.GetName(), t.to)
+				}
+			}
+		}
+		// translated annotations win over the ones already there
+		if _, ok := translated[key]; !ok {
+			translated[key] = value
+		}
+	}
+	return translated
+}
+
+func (t annotationTranslation) fromVendor(key string) bool {
+	for _, prefix := range t.prefixes[t.from] {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,240 @@
+package transform
+
+import (
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// VersionRule rewrites the items of Kind written in the From apiVersion to the
+// To apiVersion. The fields are migrated on the way: Moves first, then
+// Remove, then Defaults.
+type VersionRule struct {
+	Kind  string
+	From  string
+	To    string
+	Moves []FieldMove
+	// Remove lists fields the To version does not have
+	Remove [][]string
+	// Defaults sets fields the To version requires, when the item lacks them
+	Defaults []FieldDefault
+}
+
+// FieldMove moves the value at From, object keys from the root, to To.
+type FieldMove struct {
+	From []string
+	To   []string
+}
+
+// FieldDefault is a value set at Path when the item has none.
+type FieldDefault struct {
+	Path  []string
+	Value interface{}
+}
+
+// Validate checks that the rule names its versions and that its paths are
+// set.
+func (r VersionRule) Validate() error {
+	switch {
+	case r.Kind == "" || r.From == "" || r.To == "":
+		return fmt.Errorf("kind, from and to are required")
+	case r.From == r.To:
+		return fmt.Errorf("from and to are both %s", r.From)
+	}
+	for _, move := range r.Moves {
+		if len(move.From) == 0 || len(move.To) == 0 {
+			return fmt.Errorf("moves need a from and a to path")
+		}
+	}
+	for _, path := range r.Remove {
+		if len(path) == 0 {
+			return fmt.Errorf("empty path in remove")
+		}
+	}
+	for _, d := range r.Defaults {
+		if len(d.Path) == 0 {
+			return fmt.Errorf("empty path in defaults")
+		}
+	}
+	return nil
+}
+
+// apply migrates the fields of object, a copy.
+func (r VersionRule) apply(object map[string]interface{}) {
+	for _, move := range r.Moves {
+		value, ok, _ := unstructured.NestedFieldNoCopy(object, move.From...)
+		if !ok {
+			continue
+		}
+		unstructured.RemoveNestedField(object, move.From...)
+		_ = unstructured.SetNestedField(object, value, move.To...)
+	}
+	for _, path := range r.Remove {
+		unstructured.RemoveNestedField(object, path...)
+	}
+	for _, d := range r.Defaults {
+		if _, ok, _ := unstructured.NestedFieldNoCopy(object, d.Path...); !ok {
+			_ = unstructured.SetNestedField(object, d.Value, d.Path...)
+		}
+	}
+}
+
+// builtinConversion upgrades an apiVersion removed from Kubernetes.
+type builtinConversion struct {
+	to string
+	// convert migrates the fields of the item, when the schemas differ
+	convert func(object map[string]interface{})
+}
+
+// builtinConversions are keyed by apiVersion and kind.
+var builtinConversions = func() map[string]builtinConversion {
+	conversions := make(map[string]builtinConversion)
+	add := func(to string, convert func(map[string]interface{}), kinds []string, from ...string) {
+		for _, version := range from {
+			for _, kind := range kinds {
+				conversions[version+"/"+kind] = builtinConversion{to: to, convert: convert}
+			}
+		}
+	}
+
+	add("networking.k8s.io/v1", convertIngress, []string{"Ingress"}, "extensions/v1beta1", "networking.k8s.io/v1beta1")
+	add("networking.k8s.io/v1", nil, []string{"NetworkPolicy"}, "extensions/v1beta1")
+	add("networking.k8s.io/v1", nil, []string{"IngressClass"}, "networking.k8s.io/v1beta1")
+	add("apps/v1", convertWorkload(false), []string{"Deployment", "ReplicaSet"}, "extensions/v1beta1", "apps/v1beta1", "apps/v1beta2")
+	// the update strategy of these versions defaulted to OnDelete
+	add("apps/v1", convertWorkload(true), []string{"DaemonSet"}, "extensions/v1beta1")
+	add("apps/v1", convertWorkload(false), []string{"DaemonSet"}, "apps/v1beta2")
+	add("apps/v1", convertWorkload(true), []string{"StatefulSet"}, "apps/v1beta1")
+	add("apps/v1", convertWorkload(false), []string{"StatefulSet"}, "apps/v1beta2")
+	add("batch/v1", nil, []string{"CronJob"}, "batch/v1beta1", "batch/v2alpha1")
+	add("policy/v1", nil, []string{"PodDisruptionBudget"}, "policy/v1beta1")
+	add("autoscaling/v2", nil, []string{"HorizontalPodAutoscaler"}, "autoscaling/v2beta2")
+	add("rbac.authorization.k8s.io/v1", nil, []string{"Role", "ClusterRole", "RoleBinding", "ClusterRoleBinding"}, "rbac.authorization.k8s.io/v1beta1", "rbac.authorization.k8s.io/v1alpha1")
+	add("storage.k8s.io/v1", nil, []string{"StorageClass", "CSIDriver", "CSINode", "VolumeAttachment"}, "storage.k8s.io/v1beta1")
+	add("scheduling.k8s.io/v1", nil, []string{"PriorityClass"}, "scheduling.k8s.io/v1beta1", "scheduling.k8s.io/v1alpha1")
+	add("coordination.k8s.io/v1", nil, []string{"Lease"}, "coordination.k8s.io/v1beta1")
+	add("node.k8s.io/v1", nil, []string{"RuntimeClass"}, "node.k8s.io/v1beta1")
+	return conversions
+}()
+
+// convertIngress moves the backends to the networking.k8s.io/v1 schema and
+// gives the paths the type their controller used to assume.
+func convertIngress(object map[string]interface{}) {
+	spec, ok := object["spec"].(map[string]interface{})
+	if !ok {
+		return
+	}
+	if backend, ok := spec["backend"].(map[string]interface{}); ok {
+		delete(spec, "backend")
+		spec["defaultBackend"] = convertIngressBackend(backend)
+	}
+	rules, _ := spec["rules"].([]interface{})
+	for _, rule := range rules {
+		field, _, _ := unstructured.NestedFieldNoCopy(asMap(rule), "http", "paths")
+		paths, _ := field.([]interface{})
+		for _, path := range paths {
+			entry := asMap(path)
+			if entry == nil {
+				continue
+			}
+			if backend, ok := entry["backend"].(map[string]interface{}); ok {
+				entry["backend"] = convertIngressBackend(backend)
+			}
+			if _, ok := entry["pathType"]; !ok {
+				entry["pathType"] = "ImplementationSpecific"
+			}
+		}
+	}
+}
+
+func convertIngressBackend(backend map[string]interface{}) map[string]interface{} {
+	name, ok := backend["serviceName"]
+	if !ok {
+		// resource backends are unchanged
+		return backend
+	}
+	port := map[string]interface{}{}
+	switch value := backend["servicePort"].(type) {
+	case string:
+		port["name"] = value
+	case nil:
+	default:
+		port["number"] = value
+	}
+	converted := make(map[string]interface{}, len(backend))
+	for key, value := range backend {
+		if key != "serviceName" && key != "servicePort" {
+			converted[key] = value
+		}
+	}
+	converted["service"] = map[string]interface{}{"name": name, "port": port}
+	return converted
+}
+
+// convertWorkload gives workloads the selector apps/v1 requires, defaulted
+// from the labels of their template as the old versions did, and drops the
+// fields apps/v1 removed. With onDelete, a missing update strategy is set to
+// the OnDelete default of the old version.
+func convertWorkload(onDelete bool) func(map[string]interface{}) {
+	return func(object map[string]interface{}) {
+		spec, ok := object["spec"].(map[string]interface{})
+		if !ok {
+			return
+		}
+		if _, ok := spec["selector"]; !ok {
+			if labels, ok, _ := unstructured.NestedMap(spec, "template", "metadata", "labels"); ok && len(labels) > 0 {
+				spec["selector"] = map[string]interface{}{"matchLabels": labels}
+			}
+		}
+		delete(spec, "rollbackTo")
+		delete(spec, "templateGeneration")
+		if _, ok := spec["updateStrategy"]; !ok && onDelete {
+			spec["updateStrategy"] = map[string]interface{}{"type": "OnDelete"}
+		}
+	}
+}
+
+func asMap(value interface{}) map[string]interface{} {
+	object, _ := value.(map[string]interface{})
+	return object
+}
+
+// APIVersions upgrades items written with apiVersions the target cluster may
+// no longer serve, such as extensions/v1beta1 Ingresses in an old backup.
+// Rules come first; with Builtin, the kinds whose beta versions Kubernetes
+// removed up to 1.26 are converted to their stable version.
+type APIVersions struct {
+	Rules   []VersionRule
+	Builtin bool
+}
+
+// Name implements Transformer.
+func (a *APIVersions) Name() string {
+	return "api-versions"
+}
+
+// Transform implements Transformer.
+func (a *APIVersions) Transform(item *unstructured.Unstructured) (*unstructured.Unstructured, error) {
+	apiVersion, kind := item.GetAPIVersion(), item.GetKind()
+	for _, rule := range a.Rules {
+		if rule.Kind == kind && rule.From == apiVersion {
+			out := item.DeepCopy()
+			rule.apply(out.Object)
+			out.SetAPIVersion(rule.To)
+			return out, nil
+		}
+	}
+	if !a.Builtin {
+		return item, nil
+	}
+	conversion, ok := builtinConversions[apiVersion+"/"+kind]
+	if !ok {
+		return item, nil
+	}
+	out := item.DeepCopy()
+	if conversion.convert != nil {
+		conversion.convert(out.Object)
+	}
+	out.SetAPIVersion(conversion.to)
+	return out, nil
+}
@@ -0,0 +1,114 @@
+package transform
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestAPIVersions_Ingress(t *testing.T) {
+	ingress := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "extensions/v1beta1",
+		"kind":       "Ingress",
+		"metadata":   map[string]interface{}{"name": "web"},
+		"spec": map[string]interface{}{
+			"backend": map[string]interface{}{"serviceName": "default", "servicePort": int64(80)},
+			"rules": []interface{}{map[string]interface{}{
+				"host": "shop.example.com",
+				"http": map[string]interface{}{"paths": []interface{}{
+					map[string]interface{}{"path": "/", "backend": map[string]interface{}{"serviceName": "web", "servicePort": "http"}},
+					map[string]interface{}{"path": "/api", "pathType": "Prefix", "backend": map[string]interface{}{"serviceName": "api", "servicePort": int64(8080)}},
+				}},
+			}},
+		},
+	}}
+
+	out, err := (&APIVersions{Builtin: true}).Transform(ingress)
+	require.NoError(t, err)
+	assert.Equal(t, "networking.k8s.io/v1", out.GetAPIVersion())
+	assert.Equal(t, map[string]interface{}{
+		"defaultBackend": map[string]interface{}{"service": map[string]interface{}{"name": "default", "port": map[string]interface{}{"number": int64(80)}}},
+		"rules": []interface{}{map[string]interface{}{
+			"host": "shop.example.com",
+			"http": map[string]interface{}{"paths": []interface{}{
+				map[string]interface{}{"path": "/", "pathType": "ImplementationSpecific", "backend": map[string]interface{}{"service": map[string]interface{}{"name": "web", "port": map[string]interface{}{"name": "http"}}}},
+				map[string]interface{}{"path": "/api", "pathType": "Prefix", "backend": map[string]interface{}{"service": map[string]interface{}{"name": "api", "port": map[string]interface{}{"number": int64(8080)}}}},
+			}},
+		}},
+	}, out.Object["spec"])
+	assert.Equal(t, "extensions/v1beta1", ingress.GetAPIVersion(), "input must be left untouched")
+
+	// without the built-in conversions, the item is left as is
+	out, err = (&APIVersions{}).Transform(ingress)
+	require.NoError(t, err)
+	assert.Equal(t, ingress, out)
+}
+
+func TestAPIVersions_Workloads(t *testing.T) {
+	daemonSet := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "extensions/v1beta1",
+		"kind":       "DaemonSet",
+		"spec": map[string]interface{}{
+			"templateGeneration": int64(2),
+			"template":           map[string]interface{}{"metadata": map[string]interface{}{"labels": map[string]interface{}{"app": "agent"}}},
+		},
+	}}
+	out, err := (&APIVersions{Builtin: true}).Transform(daemonSet)
+	require.NoError(t, err)
+	assert.Equal(t, "apps/v1", out.GetAPIVersion())
+	assert.Equal(t, map[string]interface{}{
+		"selector":       map[string]interface{}{"matchLabels": map[string]interface{}{"app": "agent"}},
+		"updateStrategy": map[string]interface{}{"type": "OnDelete"},
+		"template":       map[string]interface{}{"metadata": map[string]interface{}{"labels": map[string]interface{}{"app": "agent"}}},
+	}, out.Object["spec"])
+
+	cronJob := &unstructured.Unstructured{Object: map[string]interface{}{"apiVersion": "batch/v1beta1", "kind": "CronJob", "spec": map[string]interface{}{"schedule": "0 * * * *"}}}
+	out, err = (&APIVersions{Builtin: true}).Transform(cronJob)
+	require.NoError(t, err)
+	assert.Equal(t, "batch/v1", out.GetAPIVersion())
+	assert.Equal(t, cronJob.Object["spec"], out.Object["spec"])
+}
+
+func TestAPIVersions_Rules(t *testing.T) {
+	versions := &APIVersions{Builtin: true, Rules: []VersionRule{
+		{
+			Kind:     "Certificate",
+			From:     "certmanager.k8s.io/v1alpha1",
+			To:       "cert-manager.io/v1",
+			Moves:    []FieldMove{{From: []string{"spec", "acme", "config"}, To: []string{"spec", "solvers"}}},
+			Remove:   [][]string{{"spec", "acme"}},
+			Defaults: []FieldDefault{{Path: []string{"spec", "privateKey", "algorithm"}, Value: "RSA"}},
+		},
+		// rules win over the built-in conversions
+		{Kind: "CronJob", From: "batch/v1beta1", To: "example.com/v1"},
+	}}
+	certificate := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "certmanager.k8s.io/v1alpha1",
+		"kind":       "Certificate",
+		"spec": map[string]interface{}{
+			"secretName": "tls",
+			"acme":       map[string]interface{}{"config": []interface{}{map[string]interface{}{"http01": map[string]interface{}{}}}},
+		},
+	}}
+	out, err := versions.Transform(certificate)
+	require.NoError(t, err)
+	assert.Equal(t, "cert-manager.io/v1", out.GetAPIVersion())
+	assert.Equal(t, map[string]interface{}{
+		"secretName": "tls",
+		"solvers":    []interface{}{map[string]interface{}{"http01": map[string]interface{}{}}},
+		"privateKey": map[string]interface{}{"algorithm": "RSA"},
+	}, out.Object["spec"])
+
+	out, err = versions.Transform(&unstructured.Unstructured{Object: map[string]interface{}{"apiVersion": "batch/v1beta1", "kind": "CronJob"}})
+	require.NoError(t, err)
+	assert.Equal(t, "example.com/v1", out.GetAPIVersion())
+}
+
+func TestVersionRule_Validate(t *testing.T) {
+	assert.NoError(t, VersionRule{Kind: "Certificate", From: "a/v1", To: "b/v1"}.Validate())
+	assert.Error(t, VersionRule{Kind: "Certificate", From: "a/v1"}.Validate())
+	assert.Error(t, VersionRule{Kind: "Certificate", From: "a/v1", To: "a/v1"}.Validate())
+	assert.Error(t, VersionRule{Kind: "Certificate", From: "a/v1", To: "b/v1", Moves: []FieldMove{{From: []string{"spec"}}}}.Validate())
+}
@@ -0,0 +1,55 @@
+package transform
+
+import "sync"
+
+// Breaker is a circuit breaker keyed by the transformers of a chain. Once a
+// transformer has failed Threshold times in a row it stays open (disabled)
+// for the lifetime of the breaker, which the plugin scopes to a single
+// restore.
+type Breaker struct {
+	Threshold int
+
+	mu       sync.Mutex
+	failures map[string]int
+	open     map[string]bool
+}
+
+// NewBreaker returns a breaker opening after threshold consecutive failures.
+// A threshold of zero or less never opens.
+func NewBreaker(threshold int) *Breaker {
+	return &Breaker{
+		Threshold: threshold,
+		failures:  make(map[string]int),
+		open:      make(map[string]bool),
+	}
+}
+
+// Allow reports whether the named transformer may still run.
+func (b *Breaker) Allow(name string) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return !b.open[name]
+}
+
+// RecordSuccess resets the consecutive failure count of name.
+func (b *Breaker) RecordSuccess(name string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures[name] = 0
+}
+
+// RecordFailure counts a failure of name and reports whether this failure
+// opened the breaker.
+func (b *Breaker) RecordFailure(name string) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.Threshold <= 0 || b.open[name] {
+		return false
+	}
+	b.failures[name]++
+	if b.failures[name] >= b.Threshold {
+		b.open[name] = true
+		return true
+	}
+	return false
+}
@@ -0,0 +1,146 @@
+package transform
+
+import (
+	"slices"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// Well-known node labels that capacity requirements select on.
+var (
+	instanceTypeLabels = []string{"node.kubernetes.io/instance-type", "beta.kubernetes.io/instance-type"}
+	zoneLabels         = []string{"topology.kubernetes.io/zone", "failure-domain.beta.kubernetes.io/zone"}
+)
+
+// requirementPaths are the locations of node requirements: in Karpenter
+// NodePools (v1beta1 and v1) and in Provisioners (v1alpha5).
+var requirementPaths = map[string][]string{
+	"NodePool":    {"spec", "template", "spec", "requirements"},
+	"Provisioner": {"spec", "requirements"},
+}
+
+// Capacity adapts the capacity provisioning resources to the target account
+// or region: Karpenter NodePools, Provisioners, EC2NodeClasses and
+// AWSNodeTemplates, and the node groups of cluster-autoscaler. Only whole
+// values are mapped.
+type Capacity struct {
+	InstanceTypes map[string]string
+	Zones         map[string]string
+	Subnets       map[string]string
+	AMIs          map[string]string
+	NodeGroups    map[string]string
+}
+
+// Name implements Transformer.
+func (c *Capacity) Name() string {
+	return "capacity"
+}
+
+// OwnedPaths implements FieldOwner.
+func (c *Capacity) OwnedPaths() [][]string {
+	var paths [][]string
+	for _, kind := range []string{"NodePool", "Provisioner"} {
+		paths = append(paths, append(append([]string{}, requirementPaths[kind]...), "values"))
+	}
+	return append(paths,
+		[]string{"spec", "subnetSelectorTerms", "id"},
+		[]string{"spec", "amiSelectorTerms", "id"},
+		[]string{"spec", "subnetSelector", "aws-ids"},
+		[]string{"spec", "amiSelector", "aws-ids"},
+	)
+}
+
+// Transform implements Transformer.
+func (c *Capacity) Transform(item *unstructured.Unstructured) (*unstructured.Unstructured, error) {
+	out := item.DeepCopy()
+	switch out.GetKind() {
+	case "NodePool", "Provisioner":
+		for _, requirement := range list(out.Object, requirementPaths[out.GetKind()]...) {
+			key, _ := field(requirement, "key").(string)
+			switch {
+			case slices.Contains(instanceTypeLabels, key):
+				mapValues(list(requirement, "values"), c.InstanceTypes)
+			case slices.Contains(zoneLabels, key):
+				mapValues(list(requirement, "values"), c.Zones)
+			}
+		}
+	case "EC2NodeClass":
+		mapTerms(list(out.Object, "spec", "subnetSelectorTerms"), c.Subnets)
+		mapTerms(list(out.Object, "spec", "amiSelectorTerms"), c.AMIs)
+	case "AWSNodeTemplate":
+		mapIDList(field(out.Object, "spec", "subnetSelector"), c.Subnets)
+		mapIDList(field(out.Object, "spec", "amiSelector"), c.AMIs)
+	case "Deployment":
+		for _, container := range list(out.Object, "spec", "template", "spec", "containers") {
+			if image, _ := field(container, "image").(string); !strings.Contains(image, "cluster-autoscaler") {
+				continue
+			}
+			mapNodeGroups(list(container, "command"), c.NodeGroups)
+			mapNodeGroups(list(container, "args"), c.NodeGroups)
+		}
+	}
+	return out, nil
+}
+
+// mapValues maps the strings of a list in place.
+func mapValues(values []interface{}, mapping map[string]string) {
+	for i, value := range values {
+		if s, ok := value.(string); ok {
+			if mapped, ok := mapping[s]; ok {
+				values[i] = mapped
+			}
+		}
+	}
+}
+
+// mapTerms maps the ids of selector terms in place.
+func mapTerms(terms []interface{}, mapping map[string]string) {
+	for _, term := range terms {
+		object, ok := term.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if id, ok := object["id"].(string); ok {
+			if mapped, ok := mapping[id]; ok {
+				object["id"] = mapped
+			}
+		}
+	}
+}
+
+// mapIDList maps the comma-separated ids of the aws-ids key of a selector.
+func mapIDList(selector interface{}, mapping map[string]string) {
+	object, ok := selector.(map[string]interface{})
+	if !ok {
+		return
+	}
+	ids, ok := object["aws-ids"].(string)
+	if !ok {
+		return
+	}
+	parts := strings.Split(ids, ",")
+	for i, id := range parts {
+		if mapped, ok := mapping[strings.TrimSpace(id)]; ok {
+			parts[i] = mapped
+		}
+	}
+	object["aws-ids"] = strings.Join(parts, ",")
+}
+
+// mapNodeGroups maps the names of --nodes=<min>:<max>:<name> flags.
+func mapNodeGroups(args []interface{}, mapping map[string]string) {
+	for i, arg := range args {
+		s, ok := arg.(string)
+		if !ok || !strings.HasPrefix(s, "--nodes=") {
+			continue
+		}
+		spec := strings.SplitN(strings.TrimPrefix(s, "--nodes="), ":", 3)
+		if len(spec) != 3 {
+			continue
+		}
+		if mapped, ok := mapping[spec[2]]; ok {
+			args[i] = "--nodes=" + spec[0] + ":" + spec[1] + ":" + mapped
+		}
+	}
+}
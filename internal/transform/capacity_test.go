@@ -0,0 +1,96 @@
+package transform
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func testCapacity() *Capacity {
+	return &Capacity{
+		InstanceTypes: map[string]string{"m5.large": "m6i.large"},
+		Zones:         map[string]string{"us-east-1a": "eu-west-1a"},
+		Subnets:       map[string]string{"subnet-0a": "subnet-1a", "subnet-0b": "subnet-1b"},
+		AMIs:          map[string]string{"ami-0123": "ami-4567"},
+		NodeGroups:    map[string]string{"prod-workers": "dr-workers"},
+	}
+}
+
+func TestCapacity_NodePool(t *testing.T) {
+	nodePool := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "karpenter.sh/v1",
+		"kind":       "NodePool",
+		"spec": map[string]interface{}{"template": map[string]interface{}{"spec": map[string]interface{}{
+			"requirements": []interface{}{
+				map[string]interface{}{"key": "node.kubernetes.io/instance-type", "operator": "In", "values": []interface{}{"m5.large", "m5.xlarge"}},
+				map[string]interface{}{"key": "topology.kubernetes.io/zone", "operator": "In", "values": []interface{}{"us-east-1a"}},
+				map[string]interface{}{"key": "example.com/team", "operator": "In", "values": []interface{}{"m5.large"}},
+			},
+		}}},
+	}}
+	original := nodePool.DeepCopy()
+
+	output, err := testCapacity().Transform(nodePool)
+	require.NoError(t, err)
+	requirements := list(output.Object, "spec", "template", "spec", "requirements")
+	assert.Equal(t, []interface{}{"m6i.large", "m5.xlarge"}, field(requirements[0], "values"))
+	assert.Equal(t, []interface{}{"eu-west-1a"}, field(requirements[1], "values"))
+	assert.Equal(t, []interface{}{"m5.large"}, field(requirements[2], "values"))
+	assert.Equal(t, original, nodePool)
+}
+
+func TestCapacity_NodeClasses(t *testing.T) {
+	nodeClass := &unstructured.Unstructured{Object: map[string]interface{}{
+		"kind": "EC2NodeClass",
+		"spec": map[string]interface{}{
+			"subnetSelectorTerms": []interface{}{
+				map[string]interface{}{"id": "subnet-0a"},
+				map[string]interface{}{"tags": map[string]interface{}{"karpenter.sh/discovery": "prod"}},
+			},
+			"amiSelectorTerms": []interface{}{map[string]interface{}{"id": "ami-0123"}, map[string]interface{}{"alias": "al2023@latest"}},
+		},
+	}}
+	output, err := testCapacity().Transform(nodeClass)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"subnetSelectorTerms": []interface{}{
+			map[string]interface{}{"id": "subnet-1a"},
+			map[string]interface{}{"tags": map[string]interface{}{"karpenter.sh/discovery": "prod"}},
+		},
+		"amiSelectorTerms": []interface{}{map[string]interface{}{"id": "ami-4567"}, map[string]interface{}{"alias": "al2023@latest"}},
+	}, output.Object["spec"])
+
+	template := &unstructured.Unstructured{Object: map[string]interface{}{
+		"kind": "AWSNodeTemplate",
+		"spec": map[string]interface{}{
+			"subnetSelector": map[string]interface{}{"aws-ids": "subnet-0a,subnet-0b,subnet-0c"},
+			"amiSelector":    map[string]interface{}{"aws::name": "prod-*"},
+		},
+	}}
+	output, err = testCapacity().Transform(template)
+	require.NoError(t, err)
+	assert.Equal(t, "subnet-1a,subnet-1b,subnet-0c", field(output.Object, "spec", "subnetSelector", "aws-ids"))
+	assert.Equal(t, map[string]interface{}{"aws::name": "prod-*"}, field(output.Object, "spec", "amiSelector"))
+}
+
+func TestCapacity_ClusterAutoscaler(t *testing.T) {
+	deployment := &unstructured.Unstructured{Object: map[string]interface{}{
+		"kind": "Deployment",
+		"spec": map[string]interface{}{"template": map[string]interface{}{"spec": map[string]interface{}{
+			"containers": []interface{}{
+				map[string]interface{}{
+					"image":   "registry.k8s.io/autoscaling/cluster-autoscaler:v1.30.0",
+					"command": []interface{}{"./cluster-autoscaler", "--nodes=1:10:prod-workers", "--nodes=0:3:prod-gpu"},
+				},
+				map[string]interface{}{"image": "sidecar", "args": []interface{}{"--nodes=1:10:prod-workers"}},
+			},
+		}}},
+	}}
+	output, err := testCapacity().Transform(deployment)
+	require.NoError(t, err)
+	containers := list(output.Object, "spec", "template", "spec", "containers")
+	assert.Equal(t, []interface{}{"./cluster-autoscaler", "--nodes=1:10:dr-workers", "--nodes=0:3:prod-gpu"}, field(containers[0], "command"))
+	assert.Equal(t, []interface{}{"--nodes=1:10:prod-workers"}, field(containers[1], "args"))
+}
@@ -0,0 +1,132 @@
+package transform
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// Transformer rewrites an item being restored.
+type Transformer interface {
+	// Name identifies the transformer in logs and in the circuit breaker.
+	Name() string
+	// Transform returns the rewritten item. It must not modify item, so the
+	// chain can fall back to it when the transformer fails.
+	Transform(item *unstructured.Unstructured) (*unstructured.Unstructured, error)
+}
+
+// FieldOwner is implemented by transformers that own some fields of the items:
+// the other transformers are expected to leave them alone.
+type FieldOwner interface {
+	// OwnedPaths lists the owned fields, as object keys from the root.
+	OwnedPaths() [][]string
+}
+
+// Chain runs a list of transformers one after the other, each one receiving
+// the output of the previous one.
+type Chain struct {
+	Transformers []Transformer
+	// Keys, when set, key the transformers of the same index in the breaker
+	// instead of their Name, so that two transformers of a type fail apart.
+	Keys []string
+	// Breaker, when set, disables transformers that keep failing.
+	Breaker *Breaker
+	// MaxLatency, when positive, is the time a transformer may take on a single
+	// item before the call is counted as a failure by the breaker.
+	MaxLatency time.Duration
+	Logger     logrus.FieldLogger
+	// OnFailure, when set, is called for every failed or too slow call.
+	OnFailure func(transformer string, err error)
+}
+
+// ErrTimeout is returned by RunWithin when an item takes too long.
+var ErrTimeout = errors.New("item transformation timed out")
+
+// Run applies the chain to item. A failing transformer is logged and skipped:
+// the item continues down the chain as it was before that transformer ran.
+func (c *Chain) Run(item *unstructured.Unstructured) *unstructured.Unstructured {
+	return c.run(context.Background(), item)
+}
+
+// RunWithin is Run with a watchdog: when the chain has not completed after
+// timeout, it returns ErrTimeout. The transformer running at that time cannot
+// be interrupted, it completes in the background and its result is dropped,
+// without calling OnFailure nor counting in the breaker; the next
+// transformers are not started. A zero timeout disables the watchdog.
+func (c *Chain) RunWithin(item *unstructured.Unstructured, timeout time.Duration) (*unstructured.Unstructured, error) {
+	if timeout <= 0 {
+		return c.Run(item), nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	done := make(chan *unstructured.Unstructured, 1)
+	go func() {
+		done <- c.run(ctx, item)
+	}()
+
+	select {
+	case out := <-done:
+		return out, nil
+	case <-ctx.Done():
+		return nil, ErrTimeout
+	}
+}
+
+func (c *Chain) run(ctx context.Context, item *unstructured.Unstructured) *unstructured.Unstructured {
+	for i, t := range c.Transformers {
+		if ctx.Err() != nil {
+			return item
+		}
+		key := c.key(i)
+		if c.Breaker != nil && !c.Breaker.Allow(key) {
+			continue
+		}
+
+		start := time.Now()
+		out, err := t.Transform(item)
+		elapsed := time.Since(start)
+		if ctx.Err() != nil {
+			// abandoned by the watchdog: neither failures nor successes count
+			return item
+		}
+
+		if err == nil && c.MaxLatency > 0 && elapsed > c.MaxLatency {
+			c.Logger.Warnf("Transformer %s took %v on %s %s, limit is %v", t.Name(), elapsed, item.GetKind(), item.GetName(), c.MaxLatency)
+			c.recordFailure(t.Name(), key, fmt.Errorf("took %v, limit is %v", elapsed, c.MaxLatency))
+		} else if err != nil {
+			c.Logger.Errorf("Transformer %s failed on %s %s, leaving the item as is: %v", t.Name(), item.GetKind(), item.GetName(), err)
+			c.recordFailure(t.Name(), key, err)
+			continue
+		} else if c.Breaker != nil {
+			c.Breaker.RecordSuccess(key)
+		}
+
+		item = out
+	}
+	return item
+}
+
+// key returns the breaker key of the i-th transformer.
+func (c *Chain) key(i int) string {
+	if i < len(c.Keys) {
+		return c.Keys[i]
+	}
+	return c.Transformers[i].Name()
+}
+
+func (c *Chain) recordFailure(name, key string, err error) {
+	if c.OnFailure != nil {
+		c.OnFailure(name, err)
+	}
+	if c.Breaker == nil {
+		return
+	}
+	if c.Breaker.RecordFailure(key) {
+		c.Logger.Errorf("Transformer %s failed %d times in a row and is disabled for the rest of this restore", key, c.Breaker.Threshold)
+	}
+}
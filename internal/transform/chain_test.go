@@ -0,0 +1,205 @@
+package transform
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+type fakeTransformer struct {
+	name  string
+	err   error
+	delay time.Duration
+	calls int
+	label string
+}
+
+func (f *fakeTransformer) Name() string {
+	return f.name
+}
+
+func (f *fakeTransformer) Transform(item *unstructured.Unstructured) (*unstructured.Unstructured, error) {
+	f.calls++
+	time.Sleep(f.delay)
+	if f.err != nil {
+		return nil, f.err
+	}
+	out := item.DeepCopy()
+	labels := out.GetLabels()
+	if labels == nil {
+		labels = map[string]string{}
+	}
+	labels[f.label] = f.name
+	out.SetLabels(labels)
+	return out, nil
+}
+
+func newItem() *unstructured.Unstructured {
+	item := &unstructured.Unstructured{}
+	item.SetKind("ConfigMap")
+	item.SetName("foo")
+	return item
+}
+
+func TestChain_Run(t *testing.T) {
+	first := &fakeTransformer{name: "first", label: "a"}
+	failing := &fakeTransformer{name: "failing", label: "b", err: errors.New("boom")}
+	last := &fakeTransformer{name: "last", label: "c"}
+
+	chain := &Chain{
+		Transformers: []Transformer{first, failing, last},
+		Logger:       logrus.New(),
+	}
+	out := chain.Run(newItem())
+
+	assert.Equal(t, map[string]string{"a": "first", "c": "last"}, out.GetLabels())
+}
+
+func TestChain_BreakerDisablesFailingTransformer(t *testing.T) {
+	failing := &fakeTransformer{name: "failing", label: "b", err: errors.New("boom")}
+	healthy := &fakeTransformer{name: "healthy", label: "a"}
+
+	chain := &Chain{
+		Transformers: []Transformer{failing, healthy},
+		Breaker:      NewBreaker(3),
+		Logger:       logrus.New(),
+	}
+	for i := 0; i < 10; i++ {
+		chain.Run(newItem())
+	}
+
+	assert.Equal(t, 3, failing.calls)
+	assert.Equal(t, 10, healthy.calls)
+}
+
+func TestChain_BreakerKeys(t *testing.T) {
+	failing := &fakeTransformer{name: "regex", label: "a", err: errors.New("boom")}
+	healthy := &fakeTransformer{name: "regex", label: "b"}
+
+	chain := &Chain{
+		Transformers: []Transformer{failing, healthy},
+		Keys:         []string{"regex hosts", "regex buckets"},
+		Breaker:      NewBreaker(3),
+		Logger:       logrus.New(),
+	}
+	for i := 0; i < 10; i++ {
+		assert.Equal(t, map[string]string{"b": "regex"}, chain.Run(newItem()).GetLabels())
+	}
+
+	assert.Equal(t, 3, failing.calls)
+	assert.Equal(t, 10, healthy.calls, "a transformer of the same type keeps running")
+}
+
+func TestChain_SlowTransformerCountsAsFailure(t *testing.T) {
+	slow := &fakeTransformer{name: "slow", label: "a", delay: 5 * time.Millisecond}
+
+	chain := &Chain{
+		Transformers: []Transformer{slow},
+		Breaker:      NewBreaker(2),
+		MaxLatency:   time.Millisecond,
+		Logger:       logrus.New(),
+	}
+	for i := 0; i < 4; i++ {
+		out := chain.Run(newItem())
+		if i < 2 {
+			// slow results are still used
+			assert.Equal(t, "slow", out.GetLabels()["a"])
+		}
+	}
+
+	assert.Equal(t, 2, slow.calls)
+}
+
+func TestBreaker(t *testing.T) {
+	b := NewBreaker(2)
+	assert.False(t, b.RecordFailure("x"))
+	b.RecordSuccess("x")
+	assert.False(t, b.RecordFailure("x"))
+	assert.True(t, b.RecordFailure("x"))
+	assert.False(t, b.Allow("x"))
+	assert.True(t, b.Allow("y"))
+
+	never := NewBreaker(0)
+	for i := 0; i < 10; i++ {
+		assert.False(t, never.RecordFailure("x"))
+	}
+	assert.True(t, never.Allow("x"))
+}
+
+func TestChain_RunWithin(t *testing.T) {
+	chain := &Chain{
+		Transformers: []Transformer{&fakeTransformer{name: "first", label: "a"}},
+		Logger:       logrus.New(),
+	}
+	out, err := chain.RunWithin(newItem(), time.Second)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"a": "first"}, out.GetLabels())
+
+	// no watchdog
+	out, err = chain.RunWithin(newItem(), 0)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"a": "first"}, out.GetLabels())
+}
+
+func TestChain_RunWithinTimeout(t *testing.T) {
+	slow := &fakeTransformer{name: "slow", label: "a", delay: 100 * time.Millisecond}
+	last := &fakeTransformer{name: "last", label: "b"}
+	chain := &Chain{
+		Transformers: []Transformer{slow, last},
+		Logger:       logrus.New(),
+	}
+
+	start := time.Now()
+	out, err := chain.RunWithin(newItem(), 10*time.Millisecond)
+	assert.ErrorIs(t, err, ErrTimeout)
+	assert.Nil(t, out)
+	assert.Less(t, time.Since(start), 100*time.Millisecond)
+
+	// the slow transformer completes in the background, the chain stops there
+	time.Sleep(200 * time.Millisecond)
+	assert.Zero(t, last.calls)
+}
+
+func TestChain_RunWithinTimeoutDropsCallbacks(t *testing.T) {
+	slow := &fakeTransformer{name: "slow", label: "a", delay: 50 * time.Millisecond, err: errors.New("boom")}
+	var failures []string
+	chain := &Chain{
+		Transformers: []Transformer{slow},
+		Breaker:      NewBreaker(1),
+		Logger:       logrus.New(),
+		OnFailure: func(transformer string, err error) {
+			failures = append(failures, transformer)
+		},
+	}
+
+	_, err := chain.RunWithin(newItem(), 10*time.Millisecond)
+	assert.ErrorIs(t, err, ErrTimeout)
+	time.Sleep(100 * time.Millisecond)
+	assert.Empty(t, failures, "the abandoned transformer does not report its failure")
+	assert.True(t, chain.Breaker.Allow("slow"))
+}
+
+func TestChain_OnFailure(t *testing.T) {
+	var failures []string
+	chain := &Chain{
+		Transformers: []Transformer{
+			&fakeTransformer{name: "failing", label: "a", err: errors.New("boom")},
+			&fakeTransformer{name: "slow", label: "b", delay: 20 * time.Millisecond},
+			&fakeTransformer{name: "fast", label: "c"},
+		},
+		MaxLatency: 10 * time.Millisecond,
+		Logger:     logrus.New(),
+		OnFailure: func(transformer string, err error) {
+			failures = append(failures, transformer+": "+err.Error())
+		},
+	}
+	chain.Run(newItem())
+
+	assert.Len(t, failures, 2)
+	assert.Equal(t, "failing: boom", failures[0])
+	assert.Contains(t, failures[1], "slow: took ")
+}
@@ -0,0 +1,128 @@
+package transform
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+var (
+	awsAccountID        = regexp.MustCompile(`^\d{12}$`)
+	gcpProjectID        = regexp.MustCompile(`^[a-z][a-z0-9-]{4,28}[a-z0-9]$`)
+	azureSubscriptionID = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+	// awsARN captures the account of an ARN, arn:partition:service:region:account:resource.
+	awsARN = regexp.MustCompile(`arn:aws[a-z-]*:[a-z0-9-]+:[a-z0-9-]*:(\d{12}):`)
+	// gcpProjectRefs capture the project of resource names, service account
+	// emails, workload identity pools and registry paths.
+	gcpProjectRefs = []*regexp.Regexp{
+		regexp.MustCompile(`projects/([a-z][a-z0-9-]{4,28}[a-z0-9])\b`),
+		regexp.MustCompile(`@([a-z][a-z0-9-]{4,28}[a-z0-9])\.iam\.gserviceaccount\.com`),
+		regexp.MustCompile(`\b([a-z][a-z0-9-]{4,28}[a-z0-9])\.svc\.id\.goog`),
+		regexp.MustCompile(`\bgcr\.io/([a-z][a-z0-9-]{4,28}[a-z0-9])/`),
+		regexp.MustCompile(`docker\.pkg\.dev/([a-z][a-z0-9-]{4,28}[a-z0-9])/`),
+	}
+	// azureResourceID captures the subscription of a resource ID.
+	azureResourceID = regexp.MustCompile(`(?i)/subscriptions/([0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12})`)
+)
+
+// CloudIDs remaps the account, project and subscription segments of AWS ARNs,
+// GCP resource references and Azure resource IDs, leaving the rest of the
+// identifiers as they are. Build it with NewCloudIDs.
+type CloudIDs struct {
+	awsAccounts        map[string]string
+	gcpProjects        map[string]string
+	azureSubscriptions map[string]string
+}
+
+// NewCloudIDs validates the mapping tables: every identifier, old or new, must
+// be syntactically valid for its cloud.
+func NewCloudIDs(awsAccounts, gcpProjects, azureSubscriptions map[string]string) (*CloudIDs, error) {
+	if err := validateIDs("AWS account", awsAccounts, awsAccountID); err != nil {
+		return nil, err
+	}
+	if err := validateIDs("GCP project", gcpProjects, gcpProjectID); err != nil {
+		return nil, err
+	}
+	if err := validateIDs("Azure subscription", azureSubscriptions, azureSubscriptionID); err != nil {
+		return nil, err
+	}
+
+	// subscription IDs are case-insensitive
+	subscriptions := make(map[string]string, len(azureSubscriptions))
+	for from, to := range azureSubscriptions {
+		subscriptions[strings.ToLower(from)] = to
+	}
+	return &CloudIDs{
+		awsAccounts:        awsAccounts,
+		gcpProjects:        gcpProjects,
+		azureSubscriptions: subscriptions,
+	}, nil
+}
+
+func validateIDs(what string, mapping map[string]string, syntax *regexp.Regexp) error {
+	for from, to := range mapping {
+		for _, id := range []string{from, to} {
+			if !syntax.MatchString(id) {
+				return fmt.Errorf("invalid %s ID %q", what, id)
+			}
+		}
+	}
+	return nil
+}
+
+// Name implements Transformer.
+func (c *CloudIDs) Name() string {
+	return "cloud-ids"
+}
+
+// Transform implements Transformer.
+func (c *CloudIDs) Transform(item *unstructured.Unstructured) (*unstructured.Unstructured, error) {
+	content := ReplaceTokens(item.Object, c.replace)
+	return &unstructured.Unstructured{Object: content.(map[string]interface{})}, nil
+}
+
+func (c *CloudIDs) replace(s string) string {
+	if len(c.awsAccounts) > 0 && strings.Contains(s, "arn:") {
+		s = replaceGroup(awsARN, s, c.awsAccounts)
+	}
+	if len(c.gcpProjects) > 0 {
+		for _, re := range gcpProjectRefs {
+			s = replaceGroup(re, s, c.gcpProjects)
+		}
+	}
+	if len(c.azureSubscriptions) > 0 {
+		s = replaceGroup(azureResourceID, s, c.azureSubscriptions, strings.ToLower)
+	}
+	return s
+}
+
+// replaceGroup replaces the first group of every match of re found in
+// mapping, after normalizing it with normalize if given.
+func replaceGroup(re *regexp.Regexp, s string, mapping map[string]string, normalize ...func(string) string) string {
+	matches := re.FindAllStringSubmatchIndex(s, -1)
+	if matches == nil {
+		return s
+	}
+
+	var b strings.Builder
+	last := 0
+	for _, match := range matches {
+		start, end := match[2], match[3]
+		id := s[start:end]
+		for _, fn := range normalize {
+			id = fn(id)
+		}
+		mapped, ok := mapping[id]
+		if !ok {
+			continue
+		}
+		b.WriteString(s[last:start])
+		b.WriteString(mapped)
+		last = end
+	}
+	b.WriteString(s[last:])
+	return b.String()
+}
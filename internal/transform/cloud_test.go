@@ -0,0 +1,51 @@
+package transform
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestCloudIDs(t *testing.T) {
+	cloud, err := NewCloudIDs(
+		map[string]string{"111111111111": "222222222222"},
+		map[string]string{"prod-project": "dr-project"},
+		map[string]string{"AAAAAAAA-0000-0000-0000-000000000000": "bbbbbbbb-0000-0000-0000-000000000000"},
+	)
+	require.NoError(t, err)
+
+	tests := map[string]string{
+		"arn:aws:iam::111111111111:role/app":             "arn:aws:iam::222222222222:role/app",
+		"arn:aws-cn:s3:cn-north-1:111111111111:bucket/x": "arn:aws-cn:s3:cn-north-1:222222222222:bucket/x",
+		"arn:aws:iam::333333333333:role/111111111111":    "arn:aws:iam::333333333333:role/111111111111",
+		"111111111111":                                           "111111111111",
+		"projects/prod-project/secrets/db":                       "projects/dr-project/secrets/db",
+		"app@prod-project.iam.gserviceaccount.com":               "app@dr-project.iam.gserviceaccount.com",
+		"prod-project.svc.id.goog[ns/app]":                       "dr-project.svc.id.goog[ns/app]",
+		"eu.gcr.io/prod-project/app:1.0":                         "eu.gcr.io/dr-project/app:1.0",
+		"europe-docker.pkg.dev/prod-project/images/app":          "europe-docker.pkg.dev/dr-project/images/app",
+		"prod-project":                                           "prod-project",
+		"projects/prod-project-2/secrets/db":                     "projects/prod-project-2/secrets/db",
+		"/subscriptions/aaaaaaaa-0000-0000-0000-000000000000/rg": "/subscriptions/bbbbbbbb-0000-0000-0000-000000000000/rg",
+		"/Subscriptions/AAAAAAAA-0000-0000-0000-000000000000/rg": "/Subscriptions/bbbbbbbb-0000-0000-0000-000000000000/rg",
+		"/subscriptions/cccccccc-0000-0000-0000-000000000000/rg": "/subscriptions/cccccccc-0000-0000-0000-000000000000/rg",
+	}
+	for in, expected := range tests {
+		item := &unstructured.Unstructured{Object: map[string]interface{}{"value": in}}
+		output, err := cloud.Transform(item)
+		require.NoError(t, err)
+		assert.Equal(t, expected, output.Object["value"], in)
+		assert.Equal(t, in, item.Object["value"])
+	}
+}
+
+func TestNewCloudIDs_Invalid(t *testing.T) {
+	_, err := NewCloudIDs(map[string]string{"111111111111": "2222"}, nil, nil)
+	assert.Error(t, err)
+	_, err = NewCloudIDs(nil, map[string]string{"Prod": "dr-project"}, nil)
+	assert.Error(t, err)
+	_, err = NewCloudIDs(nil, nil, map[string]string{"sub": "bbbbbbbb-0000-0000-0000-000000000000"})
+	assert.Error(t, err)
+}
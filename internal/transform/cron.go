@@ -0,0 +1,343 @@
+package transform
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	// the plugin image may not ship the zone database
+	_ "time/tzdata"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// cronField describes one of the five fields of a standard cron schedule.
+type cronField struct {
+	min, max int
+	names    []string
+}
+
+var (
+	cronMinute = cronField{min: 0, max: 59}
+	cronHour   = cronField{min: 0, max: 23}
+	cronDom    = cronField{min: 1, max: 31}
+	cronMonth  = cronField{min: 1, max: 12, names: []string{"", "jan", "feb", "mar", "apr", "may", "jun", "jul", "aug", "sep", "oct", "nov", "dec"}}
+	cronDow    = cronField{min: 0, max: 7, names: []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}}
+)
+
+// cronMacros are the descriptors CronJobs accept in place of the five fields.
+var cronMacros = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// parse returns the sorted values of a field, and whether it is unrestricted.
+func (f cronField) parse(text string) ([]int, bool, error) {
+	if text == "*" || text == "?" {
+		return f.all(), true, nil
+	}
+	set := make(map[int]bool)
+	for _, part := range strings.Split(text, ",") {
+		rangeText, step := part, 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			n, err := strconv.Atoi(part[i+1:])
+			if err != nil || n <= 0 {
+				return nil, false, fmt.Errorf("invalid step in %q", part)
+			}
+			rangeText, step = part[:i], n
+		}
+		top := f.max
+		if f.max == 7 {
+			// 7 is an alias of Sunday, not a day of its own
+			top = 6
+		}
+		low, high := f.min, top
+		switch {
+		case rangeText == "*" || rangeText == "?":
+		case strings.Contains(rangeText, "-"):
+			bounds := strings.SplitN(rangeText, "-", 2)
+			var err error
+			if low, err = f.value(bounds[0]); err != nil {
+				return nil, false, err
+			}
+			if high, err = f.value(bounds[1]); err != nil {
+				return nil, false, err
+			}
+			if low > high {
+				return nil, false, fmt.Errorf("invalid range %q", rangeText)
+			}
+		default:
+			var err error
+			if low, err = f.value(rangeText); err != nil {
+				return nil, false, err
+			}
+			high = low
+			if strings.Contains(part, "/") {
+				high = top
+			}
+		}
+		for v := low; v <= high; v += step {
+			set[f.normalize(v)] = true
+		}
+	}
+	values := make([]int, 0, len(set))
+	for v := range set {
+		values = append(values, v)
+	}
+	sort.Ints(values)
+	return values, false, nil
+}
+
+func (f cronField) value(text string) (int, error) {
+	for i, name := range f.names {
+		if name != "" && strings.EqualFold(text, name) {
+			return i, nil
+		}
+	}
+	v, err := strconv.Atoi(text)
+	if err != nil || v < f.min || v > f.max {
+		return 0, fmt.Errorf("invalid value %q, expected %d-%d", text, f.min, f.max)
+	}
+	return v, nil
+}
+
+func (f cronField) normalize(v int) int {
+	if f.max == 7 {
+		return v % 7
+	}
+	return v
+}
+
+func (f cronField) all() []int {
+	var values []int
+	for v := f.min; v <= f.max; v++ {
+		if f.max == 7 && v == 7 {
+			break
+		}
+		values = append(values, v)
+	}
+	return values
+}
+
+// format renders sorted values as a field, using ranges for runs.
+func (f cronField) format(values []int) string {
+	if len(values) == len(f.all()) {
+		return "*"
+	}
+	var parts []string
+	for i := 0; i < len(values); {
+		j := i
+		for j+1 < len(values) && values[j+1] == values[j]+1 {
+			j++
+		}
+		switch {
+		case j-i >= 2:
+			parts = append(parts, fmt.Sprintf("%d-%d", values[i], values[j]))
+		case j > i:
+			parts = append(parts, strconv.Itoa(values[i]), strconv.Itoa(values[j]))
+		default:
+			parts = append(parts, strconv.Itoa(values[i]))
+		}
+		i = j + 1
+	}
+	return strings.Join(parts, ",")
+}
+
+// ValidateSchedule checks a CronJob schedule, without any CRON_TZ prefix.
+func ValidateSchedule(schedule string) error {
+	_, err := parseSchedule(schedule)
+	return err
+}
+
+func parseSchedule(schedule string) ([]string, error) {
+	if strings.HasPrefix(schedule, "@every ") {
+		if _, err := time.ParseDuration(strings.TrimPrefix(schedule, "@every ")); err != nil {
+			return nil, fmt.Errorf("invalid schedule %q: %v", schedule, err)
+		}
+		return nil, nil
+	}
+	if expanded, ok := cronMacros[strings.ToLower(schedule)]; ok {
+		schedule = expanded
+	}
+	fields := strings.Fields(schedule)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("invalid schedule %q: expected 5 fields, found %d", schedule, len(fields))
+	}
+	for i, f := range []cronField{cronMinute, cronHour, cronDom, cronMonth, cronDow} {
+		if _, _, err := f.parse(fields[i]); err != nil {
+			return nil, fmt.Errorf("invalid schedule %q: %v", schedule, err)
+		}
+	}
+	return fields, nil
+}
+
+// ShiftSchedule moves the times of a schedule by offset, so that it fires at
+// the same instants on a cluster whose local time differs by offset. It fails when
+// the shifted schedule cannot be expressed exactly, such as days of month
+// crossing midnight.
+func ShiftSchedule(schedule string, offset time.Duration) (string, error) {
+	fields, err := parseSchedule(schedule)
+	if err != nil || fields == nil || offset == 0 {
+		// @every intervals do not depend on the clock
+		return schedule, err
+	}
+	minutes, _, _ := cronMinute.parse(fields[0])
+	hours, _, _ := cronHour.parse(fields[1])
+	_, domAll, _ := cronDom.parse(fields[2])
+	_, monthAll, _ := cronMonth.parse(fields[3])
+	dows, dowAll, _ := cronDow.parse(fields[4])
+
+	shift := int(offset / time.Minute)
+	newHours, newMinutes, deltas := map[int]bool{}, map[int]bool{}, map[int]bool{}
+	pairs := 0
+	for _, h := range hours {
+		for _, m := range minutes {
+			t := h*60 + m + shift
+			day := floorDiv(t, 24*60)
+			t -= day * 24 * 60
+			newHours[t/60], newMinutes[t%60], deltas[day] = true, true, true
+			pairs++
+		}
+	}
+	if len(newHours)*len(newMinutes) != pairs {
+		return "", fmt.Errorf("schedule %q shifted by %v has no cron equivalent", schedule, offset)
+	}
+
+	dayDelta := 0
+	for delta := range deltas {
+		dayDelta = delta
+	}
+	if len(deltas) > 1 || dayDelta != 0 {
+		if !domAll || !monthAll {
+			return "", fmt.Errorf("schedule %q shifted by %v crosses midnight on restricted days of month", schedule, offset)
+		}
+		if !dowAll {
+			if len(deltas) > 1 {
+				return "", fmt.Errorf("schedule %q shifted by %v crosses midnight on restricted days of week", schedule, offset)
+			}
+			shifted := make([]int, 0, len(dows))
+			for _, dow := range dows {
+				shifted = append(shifted, ((dow+dayDelta)%7+7)%7)
+			}
+			sort.Ints(shifted)
+			fields[4] = cronDow.format(shifted)
+		}
+	}
+	if !sameValues(minutes, newMinutes) {
+		fields[0] = cronMinute.format(sortedKeys(newMinutes))
+	}
+	if !sameValues(hours, newHours) {
+		fields[1] = cronHour.format(sortedKeys(newHours))
+	}
+	shifted := strings.Join(fields, " ")
+	if expanded, ok := cronMacros[strings.ToLower(schedule)]; ok && shifted == expanded {
+		return schedule, nil
+	}
+	return shifted, nil
+}
+
+func floorDiv(a, b int) int {
+	q := a / b
+	if a%b != 0 && (a < 0) != (b < 0) {
+		q--
+	}
+	return q
+}
+
+func sameValues(values []int, set map[int]bool) bool {
+	if len(values) != len(set) {
+		return false
+	}
+	for _, v := range values {
+		if !set[v] {
+			return false
+		}
+	}
+	return true
+}
+
+func sortedKeys(set map[int]bool) []int {
+	keys := make([]int, 0, len(set))
+	for k := range set {
+		keys = append(keys, k)
+	}
+	sort.Ints(keys)
+	return keys
+}
+
+// cronTZPrefixes pin a schedule to a time zone from within the schedule.
+var cronTZPrefixes = []string{"CRON_TZ=", "TZ="}
+
+// CronSchedules adapts CronJobs to the clock of the target cluster. Time zones
+// set in spec.timeZone, or as a CRON_TZ prefix of the schedule, are mapped
+// through TimeZones. The other schedules follow the local time of the
+// controller and are shifted by Offset.
+type CronSchedules struct {
+	Offset    time.Duration
+	TimeZones map[string]string
+}
+
+// Validate checks the offset and the mapped time zones.
+func (c *CronSchedules) Validate() error {
+	if c.Offset%time.Minute != 0 || c.Offset <= -24*time.Hour || c.Offset >= 24*time.Hour {
+		return fmt.Errorf("invalid offset %v, expected whole minutes within a day", c.Offset)
+	}
+	for from, to := range c.TimeZones {
+		if _, err := time.LoadLocation(to); err != nil {
+			return fmt.Errorf("invalid time zone %q for %q: %v", to, from, err)
+		}
+	}
+	return nil
+}
+
+// Name implements Transformer.
+func (c *CronSchedules) Name() string {
+	return "cron-schedules"
+}
+
+// OwnedPaths implements FieldOwner.
+func (c *CronSchedules) OwnedPaths() [][]string {
+	return [][]string{{"spec", "schedule"}, {"spec", "timeZone"}}
+}
+
+// Transform implements Transformer.
+func (c *CronSchedules) Transform(item *unstructured.Unstructured) (*unstructured.Unstructured, error) {
+	if item.GetKind() != "CronJob" {
+		return item, nil
+	}
+	schedule, _, _ := unstructured.NestedString(item.Object, "spec", "schedule")
+	out := item.DeepCopy()
+
+	if zone, _, _ := unstructured.NestedString(item.Object, "spec", "timeZone"); zone != "" {
+		if mapped, ok := c.TimeZones[zone]; ok {
+			_ = unstructured.SetNestedField(out.Object, mapped, "spec", "timeZone")
+		}
+		return out, nil
+	}
+	for _, prefix := range cronTZPrefixes {
+		if !strings.HasPrefix(schedule, prefix) {
+			continue
+		}
+		zone, rest, _ := strings.Cut(strings.TrimPrefix(schedule, prefix), " ")
+		if mapped, ok := c.TimeZones[zone]; ok {
+			_ = unstructured.SetNestedField(out.Object, prefix+mapped+" "+rest, "spec", "schedule")
+		}
+		return out, nil
+	}
+
+	shifted, err := ShiftSchedule(strings.TrimSpace(schedule), c.Offset)
+	if err != nil {
+		return nil, err
+	}
+	if shifted != strings.TrimSpace(schedule) {
+		_ = unstructured.SetNestedField(out.Object, shifted, "spec", "schedule")
+	}
+	return out, nil
+}
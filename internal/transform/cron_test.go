@@ -0,0 +1,108 @@
+package transform
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestShiftSchedule(t *testing.T) {
+	for _, tc := range []struct {
+		schedule string
+		offset   time.Duration
+		expected string
+	}{
+		{"30 2 * * *", -5 * time.Hour, "30 21 * * *"},
+		{"30 2 * * *", 5*time.Hour + 30*time.Minute, "0 8 * * *"},
+		{"*/15 9-17 * * *", -2 * time.Hour, "*/15 7-15 * * *"},
+		{"0 1 * * MON-FRI", -2 * time.Hour, "0 23 * * 0-4"},
+		{"0 22 * * 5,6", 3 * time.Hour, "0 1 * * 0,6"},
+		{"0 */6 * * *", time.Hour, "0 1,7,13,19 * * *"},
+		{"0 12 1 * *", -3 * time.Hour, "0 9 1 * *"},
+		{"@hourly", time.Hour, "@hourly"},
+		{"@daily", -time.Hour, "0 23 * * *"},
+		{"@every 1h30m", time.Hour, "@every 1h30m"},
+		{"0 3 * * *", 0, "0 3 * * *"},
+	} {
+		shifted, err := ShiftSchedule(tc.schedule, tc.offset)
+		require.NoError(t, err, tc.schedule)
+		assert.Equal(t, tc.expected, shifted, tc.schedule)
+	}
+
+	for _, tc := range []struct {
+		schedule string
+		offset   time.Duration
+	}{
+		// the 1st of the month at 01:00 is the last day of the previous month
+		{"0 1 1 * *", -2 * time.Hour},
+		// only some of the hours cross midnight
+		{"0 1,12 * * MON", -2 * time.Hour},
+		// 09:15 and 10:05 are not a product of hours and minutes
+		{"0,50 9 * * *", 15 * time.Minute},
+	} {
+		_, err := ShiftSchedule(tc.schedule, tc.offset)
+		assert.Error(t, err, tc.schedule)
+	}
+}
+
+func TestValidateSchedule(t *testing.T) {
+	for _, schedule := range []string{"* * * * *", "0 0 ? * SUN", "5/10 * * jan-mar 7", "@weekly"} {
+		assert.NoError(t, ValidateSchedule(schedule), schedule)
+	}
+	for _, schedule := range []string{"* * * *", "60 * * * *", "* * 0 * *", "*/0 * * * *", "5-1 * * * *", "@every never"} {
+		assert.Error(t, ValidateSchedule(schedule), schedule)
+	}
+}
+
+func cronJob(schedule, timeZone string) *unstructured.Unstructured {
+	job := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "batch/v1",
+		"kind":       "CronJob",
+		"spec":       map[string]interface{}{"schedule": schedule},
+	}}
+	if timeZone != "" {
+		_ = unstructured.SetNestedField(job.Object, timeZone, "spec", "timeZone")
+	}
+	return job
+}
+
+func TestCronSchedules(t *testing.T) {
+	cron := &CronSchedules{Offset: -6 * time.Hour, TimeZones: map[string]string{"Europe/Paris": "America/Chicago"}}
+	require.NoError(t, cron.Validate())
+
+	output, err := cron.Transform(cronJob("0 4 * * *", ""))
+	require.NoError(t, err)
+	assert.Equal(t, cronJob("0 22 * * *", ""), output)
+
+	// explicit time zones are mapped, their schedule is left alone
+	input := cronJob("0 4 * * *", "Europe/Paris")
+	output, err = cron.Transform(input)
+	require.NoError(t, err)
+	assert.Equal(t, cronJob("0 4 * * *", "America/Chicago"), output)
+	assert.Equal(t, cronJob("0 4 * * *", "Europe/Paris"), input)
+
+	output, err = cron.Transform(cronJob("CRON_TZ=Europe/Paris 0 4 * * *", ""))
+	require.NoError(t, err)
+	assert.Equal(t, cronJob("CRON_TZ=America/Chicago 0 4 * * *", ""), output)
+	output, err = cron.Transform(cronJob("0 4 * * *", "UTC"))
+	require.NoError(t, err)
+	assert.Equal(t, cronJob("0 4 * * *", "UTC"), output)
+
+	_, err = cron.Transform(cronJob("0 4 1 * *", ""))
+	assert.Error(t, err)
+
+	// other kinds are left alone
+	deployment := &unstructured.Unstructured{Object: map[string]interface{}{"kind": "Deployment", "spec": map[string]interface{}{"schedule": "0 4 * * *"}}}
+	output, err = cron.Transform(deployment)
+	require.NoError(t, err)
+	assert.Equal(t, deployment, output)
+}
+
+func TestCronSchedules_Validate(t *testing.T) {
+	assert.Error(t, (&CronSchedules{Offset: 30 * time.Second}).Validate())
+	assert.Error(t, (&CronSchedules{Offset: 24 * time.Hour}).Validate())
+	assert.Error(t, (&CronSchedules{TimeZones: map[string]string{"UTC": "Mars/Olympus_Mons"}}).Validate())
+}
@@ -0,0 +1,58 @@
+package transform
+
+import (
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// ExternalNameAnnotation holds the name of the external resource a Crossplane
+// managed resource is bound to.
+const ExternalNameAnnotation = "crossplane.io/external-name"
+
+// providerConfigRefPaths reference the ProviderConfig of a managed resource,
+// providerRef being its deprecated form.
+var providerConfigRefPaths = [][]string{
+	{"spec", "providerConfigRef", "name"},
+	{"spec", "providerRef", "name"},
+}
+
+// Crossplane binds restored Crossplane resources, managed resources,
+// composite resources and claims, to the providers and resources of the
+// target environment: ProviderConfig references, external names, and the
+// namespaces connection secrets are written to. Only whole values are mapped.
+// The fields are recognized by their names, whatever the kind.
+type Crossplane struct {
+	ProviderConfigs  map[string]string
+	ExternalNames    map[string]string
+	SecretNamespaces map[string]string
+}
+
+// Name implements Transformer.
+func (c *Crossplane) Name() string {
+	return "crossplane"
+}
+
+// OwnedPaths implements FieldOwner.
+func (c *Crossplane) OwnedPaths() [][]string {
+	return append(append([][]string{}, providerConfigRefPaths...),
+		[]string{"metadata", "annotations", ExternalNameAnnotation},
+		[]string{"spec", "writeConnectionSecretToRef", "namespace"},
+	)
+}
+
+// Transform implements Transformer.
+func (c *Crossplane) Transform(item *unstructured.Unstructured) (*unstructured.Unstructured, error) {
+	out := item.DeepCopy()
+
+	for _, path := range providerConfigRefPaths {
+		mapField(field(out.Object, path[:len(path)-1]...), path[len(path)-1], c.ProviderConfigs)
+	}
+	mapField(field(out.Object, "spec", "writeConnectionSecretToRef"), "namespace", c.SecretNamespaces)
+
+	if annotations := out.GetAnnotations(); annotations != nil {
+		if mapped, ok := c.ExternalNames[annotations[ExternalNameAnnotation]]; ok {
+			annotations[ExternalNameAnnotation] = mapped
+			out.SetAnnotations(annotations)
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,51 @@
+package transform
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestCrossplane(t *testing.T) {
+	crossplane := &Crossplane{
+		ProviderConfigs:  map[string]string{"aws-prod": "aws-dr"},
+		ExternalNames:    map[string]string{"prod-assets": "dr-assets"},
+		SecretNamespaces: map[string]string{"crossplane-system": "crossplane-dr"},
+	}
+
+	bucket := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "s3.aws.upbound.io/v1beta1",
+		"kind":       "Bucket",
+		"spec": map[string]interface{}{
+			"forProvider":                map[string]interface{}{"region": "us-east-1"},
+			"providerConfigRef":          map[string]interface{}{"name": "aws-prod"},
+			"writeConnectionSecretToRef": map[string]interface{}{"name": "assets", "namespace": "crossplane-system"},
+		},
+	}}
+	bucket.SetAnnotations(map[string]string{ExternalNameAnnotation: "prod-assets", "other": "prod-assets"})
+	original := bucket.DeepCopy()
+
+	output, err := crossplane.Transform(bucket)
+	require.NoError(t, err)
+	assert.Equal(t, "aws-dr", field(output.Object, "spec", "providerConfigRef", "name"))
+	assert.Equal(t, map[string]interface{}{"name": "assets", "namespace": "crossplane-dr"}, field(output.Object, "spec", "writeConnectionSecretToRef"))
+	assert.Equal(t, map[string]string{ExternalNameAnnotation: "dr-assets", "other": "prod-assets"}, output.GetAnnotations())
+	assert.Equal(t, original, bucket)
+
+	// the deprecated providerRef is mapped too, and secrets without a namespace are left alone
+	claim := &unstructured.Unstructured{Object: map[string]interface{}{
+		"kind": "PostgreSQLInstance",
+		"spec": map[string]interface{}{
+			"providerRef":                map[string]interface{}{"name": "aws-prod"},
+			"writeConnectionSecretToRef": map[string]interface{}{"name": "db"},
+		},
+	}}
+	output, err = crossplane.Transform(claim)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"providerRef":                map[string]interface{}{"name": "aws-dr"},
+		"writeConnectionSecretToRef": map[string]interface{}{"name": "db"},
+	}, output.Object["spec"])
+}
@@ -0,0 +1,331 @@
+package transform
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+	"unicode/utf8"
+
+	"gopkg.in/yaml.v3"
+)
+
+// minBase64Blob is the length from which a string of base64 characters alone
+// is taken for encoded data: Kubernetes names are at most 63 characters, and
+// the names and values rules target hold dots, dashes or spaces.
+const minBase64Blob = 64
+
+// protobufMagic starts the Kubernetes protobuf encoding of an object.
+var protobufMagic = []byte("k8s\x00")
+
+// isBinary reports whether a string holds binary data, raw or base64 encoded,
+// such as protobuf payloads, which no rewrite must touch: a replacement would
+// corrupt them rather than change what they mean.
+func isBinary(s string) bool {
+	if !utf8.ValidString(s) {
+		return true
+	}
+	for i := 0; i < len(s); i++ {
+		if c := s[i]; c < 0x20 && c != '\t' && c != '\n' && c != '\r' {
+			return true
+		}
+	}
+	if len(s) < 8 || len(s)%4 != 0 || strings.Trim(s, "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789+/=") != "" {
+		return false
+	}
+	decoded, err := base64.StdEncoding.Strict().DecodeString(s)
+	if err != nil {
+		return false
+	}
+	if bytes.HasPrefix(decoded, protobufMagic) {
+		return true
+	}
+	return len(s) >= minBase64Blob && (!utf8.Valid(decoded) || bytes.IndexByte(decoded, 0) >= 0)
+}
+
+// documentAware wraps fn so that it leaves binary strings alone, and rewrites
+// the JSON and YAML documents embedded in strings as documents: fn applies to
+// their string values and comments, key to their object keys, and the
+// document is encoded again, so that replacements are quoted as needed and
+// values keep their types. Documents fn changes as a whole only, through
+// their structure, are rewritten as text. probe is fn without side effects,
+// telling the strings a rewrite changes.
+func documentAware(fn, key, probe StringFunc) StringFunc {
+	return func(s string) string {
+		if isBinary(s) || probe(s) == s {
+			return s
+		}
+		if rewritten, changed, ok := rewriteDocument(s, fn, key); ok && changed {
+			return rewritten
+		}
+		return fn(s)
+	}
+}
+
+// rewriteDocument rewrites the document s holds, and reports whether it
+// changed and whether s holds a JSON object or array, or a YAML mapping or
+// sequence.
+func rewriteDocument(s string, fn, key StringFunc) (string, bool, bool) {
+	trimmed := strings.TrimSpace(s)
+	if trimmed == "" {
+		return "", false, false
+	}
+	if (trimmed[0] == '{' || trimmed[0] == '[') && json.Valid([]byte(trimmed)) {
+		return rewriteJSON(s, fn, key)
+	}
+	if !strings.Contains(trimmed, "\n") {
+		return "", false, false
+	}
+	return rewriteYAML(s, fn, key)
+}
+
+// decodeNodes decodes the YAML documents of s.
+func decodeNodes(s string) ([]*yaml.Node, error) {
+	decoder := yaml.NewDecoder(strings.NewReader(s))
+	var documents []*yaml.Node
+	for {
+		var document yaml.Node
+		if err := decoder.Decode(&document); err != nil {
+			if errors.Is(err, io.EOF) {
+				return documents, nil
+			}
+			return nil, err
+		}
+		documents = append(documents, &document)
+	}
+}
+
+// isCollection reports whether a document is a mapping or a sequence.
+func isCollection(document *yaml.Node) bool {
+	if document.Kind != yaml.DocumentNode || len(document.Content) == 0 {
+		return false
+	}
+	kind := document.Content[0].Kind
+	return kind == yaml.MappingNode || kind == yaml.SequenceNode
+}
+
+func rewriteYAML(s string, fn, key StringFunc) (string, bool, bool) {
+	documents, err := decodeNodes(s)
+	if err != nil || len(documents) == 0 || !isCollection(documents[0]) {
+		return "", false, false
+	}
+	changed := make([]bool, len(documents))
+	anyChanged := false
+	for i, document := range documents {
+		changed[i] = rewriteNode(document, fn, key)
+		anyChanged = anyChanged || changed[i]
+	}
+	if !anyChanged {
+		return s, false, true
+	}
+	// the documents no replacement touched keep their text
+	if texts := splitDocuments(s); len(texts) == len(documents) {
+		for i, document := range documents {
+			if !changed[i] {
+				continue
+			}
+			out, err := encodeYAML(document)
+			if err != nil {
+				return "", false, false
+			}
+			if !strings.HasSuffix(texts[i], "\n") {
+				out = strings.TrimSuffix(out, "\n")
+			}
+			texts[i] = separator(texts[i]) + out
+		}
+		return strings.Join(texts, ""), true, true
+	}
+	out, err := encodeYAML(documents...)
+	if err != nil {
+		return "", false, false
+	}
+	if !strings.HasSuffix(s, "\n") {
+		out = strings.TrimSuffix(out, "\n")
+	}
+	return out, true, true
+}
+
+// encodeYAML encodes documents, indented by two spaces.
+func encodeYAML(documents ...*yaml.Node) (string, error) {
+	var b bytes.Buffer
+	encoder := yaml.NewEncoder(&b)
+	encoder.SetIndent(2)
+	for _, document := range documents {
+		if err := encoder.Encode(document); err != nil {
+			return "", err
+		}
+	}
+	if err := encoder.Close(); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+// splitDocuments splits s before its "---" lines, which YAML forbids in
+// scalars. It returns nil for the streams it cannot split so, with
+// directives, end markers or content on a separator line.
+func splitDocuments(s string) []string {
+	var texts []string
+	start := 0
+	for offset := 0; offset < len(s); {
+		end := len(s)
+		if i := strings.IndexByte(s[offset:], '\n'); i >= 0 {
+			end = offset + i + 1
+		}
+		line := strings.TrimRight(s[offset:end], " \t\r\n")
+		switch {
+		case line == "---":
+			if offset > 0 {
+				texts = append(texts, s[start:offset])
+				start = offset
+			}
+		case strings.HasPrefix(line, "---") || strings.HasPrefix(line, "...") || strings.HasPrefix(line, "%"):
+			return nil
+		}
+		offset = end
+	}
+	return append(texts, s[start:])
+}
+
+// separator returns the "---" line starting the text of a document, if any.
+func separator(text string) string {
+	if !strings.HasPrefix(text, "---") {
+		return ""
+	}
+	if i := strings.IndexByte(text, '\n'); i >= 0 {
+		return text[:i+1]
+	}
+	return text
+}
+
+// rewriteNode applies fn to the scalars and comments below node and key to
+// the keys of its mappings, and reports whether anything changed. Scalars
+// other than strings that a rewrite changes get their type from their new
+// value.
+func rewriteNode(node *yaml.Node, fn, key StringFunc) bool {
+	changed := false
+	rewrite := func(s string, fn StringFunc) string {
+		if s == "" {
+			return s
+		}
+		out := fn(s)
+		changed = changed || out != s
+		return out
+	}
+	node.HeadComment = rewrite(node.HeadComment, fn)
+	node.LineComment = rewrite(node.LineComment, fn)
+	node.FootComment = rewrite(node.FootComment, fn)
+
+	switch node.Kind {
+	case yaml.ScalarNode:
+		if value := rewrite(node.Value, fn); value != node.Value {
+			node.Value = value
+			if node.Tag != "!!str" {
+				node.Tag = ""
+			}
+		}
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			k, v := node.Content[i], node.Content[i+1]
+			if k.Kind == yaml.ScalarNode && k.Tag == "!!str" {
+				k.Value = rewrite(k.Value, key)
+				for _, comment := range []*string{&k.HeadComment, &k.LineComment, &k.FootComment} {
+					*comment = rewrite(*comment, fn)
+				}
+			}
+			changed = rewriteNode(v, fn, key) || changed
+		}
+	case yaml.DocumentNode, yaml.SequenceNode:
+		for _, child := range node.Content {
+			changed = rewriteNode(child, fn, key) || changed
+		}
+	}
+	// aliases share the node of their anchor, rewritten there
+	return changed
+}
+
+func rewriteJSON(s string, fn, key StringFunc) (string, bool, bool) {
+	documents, err := decodeNodes(s)
+	if err != nil || len(documents) != 1 || !isCollection(documents[0]) {
+		return "", false, false
+	}
+	if !rewriteNode(documents[0], fn, key) {
+		return s, false, true
+	}
+	var b bytes.Buffer
+	if err := encodeJSON(&b, documents[0].Content[0]); err != nil {
+		return "", false, false
+	}
+	out := b.Bytes()
+	// indented documents are indented again, with their first indentation
+	if indent := jsonIndent(s); indent != "" {
+		var indented bytes.Buffer
+		if err := json.Indent(&indented, out, "", indent); err != nil {
+			return "", false, false
+		}
+		out = indented.Bytes()
+	}
+	if strings.HasSuffix(s, "\n") {
+		out = append(out, '\n')
+	}
+	return string(out), true, true
+}
+
+// jsonIndent returns the indentation of the first indented line of s.
+func jsonIndent(s string) string {
+	for _, line := range strings.Split(s, "\n")[1:] {
+		if indent := line[:len(line)-len(strings.TrimLeft(line, " \t"))]; indent != "" {
+			return indent
+		}
+	}
+	return ""
+}
+
+// encodeJSON writes node as JSON, keeping the order of its keys.
+func encodeJSON(b *bytes.Buffer, node *yaml.Node) error {
+	switch node.Kind {
+	case yaml.MappingNode:
+		b.WriteByte('{')
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			k, _ := json.Marshal(node.Content[i].Value)
+			b.Write(k)
+			b.WriteByte(':')
+			if err := encodeJSON(b, node.Content[i+1]); err != nil {
+				return err
+			}
+		}
+		b.WriteByte('}')
+	case yaml.SequenceNode:
+		b.WriteByte('[')
+		for i, child := range node.Content {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			if err := encodeJSON(b, child); err != nil {
+				return err
+			}
+		}
+		b.WriteByte(']')
+	case yaml.ScalarNode:
+		if node.Tag == "!!str" {
+			value, _ := json.Marshal(node.Value)
+			b.Write(value)
+			return nil
+		}
+		// numbers, booleans and null, valid JSON when they were
+		if !json.Valid([]byte(node.Value)) {
+			value, _ := json.Marshal(node.Value)
+			b.Write(value)
+			return nil
+		}
+		b.WriteString(node.Value)
+	default:
+		return errors.New("unexpected YAML node in a JSON document")
+	}
+	return nil
+}
@@ -0,0 +1,162 @@
+package transform
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestIsBinary(t *testing.T) {
+	protobuf := append([]byte("k8s\x00\n\x0f\n\x02v1\x12\tConfigMap"), []byte("registry.prod")...)
+	assert.True(t, isBinary(string(protobuf)), "raw protobuf")
+	assert.True(t, isBinary(base64.StdEncoding.EncodeToString(protobuf)), "encoded protobuf")
+	assert.True(t, isBinary("\xff\xfeprod"), "not UTF-8")
+	blob := make([]byte, 96)
+	for i := range blob {
+		blob[i] = byte(i * 7)
+	}
+	assert.True(t, isBinary(base64.StdEncoding.EncodeToString(blob)), "encoded binary data")
+
+	assert.False(t, isBinary("registry.prod.example.com/shop/web:1.2"))
+	assert.False(t, isBinary("line one\n\tline two\r\n"))
+	assert.False(t, isBinary("prodbucket"), "short words are valid base64 too")
+	assert.False(t, isBinary(base64.StdEncoding.EncodeToString([]byte(strings.Repeat("prod.example.com ", 8)))), "encoded text")
+}
+
+func TestLiteral_BinaryFields(t *testing.T) {
+	protobuf := base64.StdEncoding.EncodeToString(append([]byte("k8s\x00"), []byte("prod-db prod-db prod-db")...))
+	item := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "example.com/v1",
+		"kind":       "Snapshot",
+		"spec": map[string]interface{}{
+			"payload": protobuf,
+			"raw":     "\x00\x01prod-db",
+			"host":    "prod-db",
+		},
+	}}
+	hits := 0
+	literal := &Literal{
+		Patterns: map[string]string{"prod-db": "dr-db", "azhz": "xxxx"},
+		OnHit:    func(string, int) { hits++ },
+	}
+	out, err := literal.Transform(item)
+	require.NoError(t, err)
+	spec := out.Object["spec"].(map[string]interface{})
+	assert.Equal(t, protobuf, spec["payload"])
+	assert.Equal(t, "\x00\x01prod-db", spec["raw"])
+	assert.Equal(t, "dr-db", spec["host"])
+	assert.Equal(t, 1, hits)
+}
+
+func TestLiteral_EmbeddedYAML(t *testing.T) {
+	values := `# values of prod.example.com
+image:
+  repository: registry.prod/web # pinned
+  tag: "1.2"
+port: 8080
+debug: false
+prod.example.com: primary
+`
+	item := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "argoproj.io/v1alpha1",
+		"kind":       "Application",
+		"spec":       map[string]interface{}{"source": map[string]interface{}{"helm": map[string]interface{}{"values": values}}},
+	}}
+	hits := map[string]int{}
+	literal := &Literal{
+		Patterns: map[string]string{
+			"registry.prod":    "registry.dr: mirror",
+			"prod.example.com": "dr.example.com",
+			"8080":             "9090",
+			"false":            "off",
+		},
+		OnHit: func(pattern string, count int) { hits[pattern] += count },
+	}
+	out, err := literal.Transform(item)
+	require.NoError(t, err)
+	rewritten, _, _ := unstructured.NestedString(out.Object, "spec", "source", "helm", "values")
+	assert.Equal(t, `# values of dr.example.com
+image:
+  repository: 'registry.dr: mirror/web' # pinned
+  tag: "1.2"
+port: 9090
+debug: off
+dr.example.com: primary
+`, rewritten, "replacements are quoted as needed, and comments and order kept")
+	assert.Equal(t, map[string]int{"registry.prod": 1, "prod.example.com": 2, "8080": 1, "false": 1}, hits, "hits are counted once")
+}
+
+func TestLiteral_EmbeddedYAMLUnmatched(t *testing.T) {
+	values := "# values for the primary\nimage:   {repository: registry.local/web}   # pinned\nlist: [a,   b]\n"
+	item := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "ConfigMap",
+		"data":       map[string]interface{}{"values.yaml": values, "zone": "prod"},
+	}}
+	out, err := (&Literal{Patterns: map[string]string{"prod": "dr"}}).Transform(item)
+	require.NoError(t, err)
+	assert.Equal(t, values, out.Object["data"].(map[string]interface{})["values.yaml"], "documents without a match are not encoded again")
+
+	// only the documents a replacement touched are encoded again
+	stream := "a:   {zone: primary}   # kept\n---\nb:   {zone: prod}\n---\nc: [x,   y]\n"
+	out, err = (&Literal{Patterns: map[string]string{"prod": "dr"}}).Transform(&unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "ConfigMap",
+		"data":       map[string]interface{}{"stream.yaml": stream},
+	}})
+	require.NoError(t, err)
+	assert.Equal(t, "a:   {zone: primary}   # kept\n---\nb: {zone: dr}\n---\nc: [x,   y]\n", out.Object["data"].(map[string]interface{})["stream.yaml"])
+}
+
+func TestSplitDocuments(t *testing.T) {
+	assert.Equal(t, []string{"a: 1\n", "---\nb: |\n  --- not a separator\n"}, splitDocuments("a: 1\n---\nb: |\n  --- not a separator\n"))
+	assert.Equal(t, []string{"---\na: 1"}, splitDocuments("---\na: 1"))
+	assert.Nil(t, splitDocuments("%YAML 1.2\n---\na: 1\n"))
+	assert.Nil(t, splitDocuments("a: 1\n--- b: 2\n"))
+}
+
+func TestLiteral_EmbeddedJSON(t *testing.T) {
+	item := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "ConfigMap",
+		"data": map[string]interface{}{
+			"config.json": "{\n  \"zone\": \"prod\",\n  \"url\": \"https://prod.example.com\",\n  \"replicas\": 3\n}\n",
+			"compact":     `{"b":"prod","a":[1,"prod"]}`,
+		},
+	}}
+	literal := &Literal{Patterns: map[string]string{"prod": `dr "east"`}}
+	out, err := literal.Transform(item)
+	require.NoError(t, err)
+	data := out.Object["data"].(map[string]interface{})
+	assert.Equal(t, "{\n  \"zone\": \"dr \\\"east\\\"\",\n  \"url\": \"https://dr \\\"east\\\".example.com\",\n  \"replicas\": 3\n}\n", data["config.json"], "still valid JSON, in the same order")
+	assert.Equal(t, `{"b":"dr \"east\"","a":[1,"dr \"east\""]}`, data["compact"])
+}
+
+func TestLiteral_EmbeddedAcrossStructure(t *testing.T) {
+	// patterns spanning keys and values apply to the text
+	item := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "ConfigMap",
+		"data":       map[string]interface{}{"app.yaml": "mode: prod\nreplicas: 3\n"},
+	}}
+	out, err := (&Literal{Patterns: map[string]string{"mode: prod": "mode: dr"}}).Transform(item)
+	require.NoError(t, err)
+	assert.Equal(t, "mode: dr\nreplicas: 3\n", out.Object["data"].(map[string]interface{})["app.yaml"])
+}
+
+func TestRegex_EmbeddedYAML(t *testing.T) {
+	regex, err := NewRegex([]RegexRule{{Expr: `bucket-(\w+)-prod`, Replacement: "bucket-${1}-dr #copy"}})
+	require.NoError(t, err)
+	item := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "ConfigMap",
+		"data":       map[string]interface{}{"backup.yaml": "buckets:\n- bucket-logs-prod\n- bucket-db-prod\n"},
+	}}
+	out, err := regex.Transform(item)
+	require.NoError(t, err)
+	assert.Equal(t, "buckets:\n  - 'bucket-logs-dr #copy'\n  - 'bucket-db-dr #copy'\n", out.Object["data"].(map[string]interface{})["backup.yaml"], "no comment slips in")
+}
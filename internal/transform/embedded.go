@@ -0,0 +1,69 @@
+package transform
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// Embedded applies its transformers to a JSON object stored in an annotation,
+// such as kubectl's last-applied-configuration, or strips that annotation.
+type Embedded struct {
+	Annotation   string
+	Transformers []Transformer
+	// Strip removes the annotation instead of transforming it.
+	Strip bool
+}
+
+// Name implements Transformer.
+func (e *Embedded) Name() string {
+	return "embedded"
+}
+
+// Transform implements Transformer.
+func (e *Embedded) Transform(item *unstructured.Unstructured) (*unstructured.Unstructured, error) {
+	annotations := item.GetAnnotations()
+	document, ok := annotations[e.Annotation]
+	if !ok {
+		return item, nil
+	}
+
+	out := item.DeepCopy()
+	annotations = out.GetAnnotations()
+	if e.Strip {
+		delete(annotations, e.Annotation)
+		if len(annotations) == 0 {
+			annotations = nil
+		}
+		out.SetAnnotations(annotations)
+		return out, nil
+	}
+
+	// numbers are kept as written, large integers included
+	embedded := &unstructured.Unstructured{}
+	decoder := json.NewDecoder(strings.NewReader(document))
+	decoder.UseNumber()
+	if err := decoder.Decode(&embedded.Object); err != nil {
+		return nil, fmt.Errorf("failed to decode annotation %s: %v", e.Annotation, err)
+	}
+	for _, transformer := range e.Transformers {
+		var err error
+		if embedded, err = transformer.Transform(embedded); err != nil {
+			return nil, fmt.Errorf("failed to apply %s to annotation %s: %v", transformer.Name(), e.Annotation, err)
+		}
+	}
+	encoded, err := json.Marshal(embedded.Object)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode annotation %s: %v", e.Annotation, err)
+	}
+
+	// kubectl terminates the document with a newline
+	if strings.HasSuffix(document, "\n") {
+		encoded = append(encoded, '\n')
+	}
+	annotations[e.Annotation] = string(encoded)
+	out.SetAnnotations(annotations)
+	return out, nil
+}
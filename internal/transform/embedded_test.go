@@ -0,0 +1,54 @@
+package transform
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+const lastApplied = "kubectl.kubernetes.io/last-applied-configuration"
+
+func embeddedItem(document string) *unstructured.Unstructured {
+	item := &unstructured.Unstructured{}
+	item.SetName("foo")
+	item.SetAnnotations(map[string]string{lastApplied: document, "other": "foo"})
+	return item
+}
+
+func TestEmbedded(t *testing.T) {
+	literal := &Literal{Patterns: map[string]string{"foo": "bar"}, Protected: [][]string{{"metadata", "name"}}}
+	embedded := &Embedded{Annotation: lastApplied, Transformers: []Transformer{literal}}
+
+	item := embeddedItem(`{"kind":"Service","metadata":{"name":"foo","namespace":"foo"},"spec":{"port":80,"uid":9007199254740993,"host":"a\"foo"}}` + "\n")
+	output, err := embedded.Transform(item)
+	require.NoError(t, err)
+
+	assert.Equal(t, `{"kind":"Service","metadata":{"name":"foo","namespace":"bar"},"spec":{"host":"a\"bar","port":80,"uid":9007199254740993}}`+"\n", output.GetAnnotations()[lastApplied])
+	// only the embedded document is touched, and the input is left as is
+	assert.Equal(t, "foo", output.GetAnnotations()["other"])
+	assert.Contains(t, item.GetAnnotations()[lastApplied], `"namespace":"foo"`)
+}
+
+func TestEmbedded_Strip(t *testing.T) {
+	item := embeddedItem("{}")
+	output, err := (&Embedded{Annotation: lastApplied, Strip: true}).Transform(item)
+	require.NoError(t, err)
+
+	assert.Equal(t, map[string]string{"other": "foo"}, output.GetAnnotations())
+	assert.Contains(t, item.GetAnnotations(), lastApplied)
+}
+
+func TestEmbedded_Invalid(t *testing.T) {
+	embedded := &Embedded{Annotation: lastApplied}
+
+	_, err := embedded.Transform(embeddedItem("not json"))
+	assert.Error(t, err)
+
+	// items without the annotation are returned as is
+	item := &unstructured.Unstructured{Object: map[string]interface{}{"kind": "Service"}}
+	output, err := embedded.Transform(item)
+	require.NoError(t, err)
+	assert.Same(t, item, output)
+}
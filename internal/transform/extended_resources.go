@@ -0,0 +1,341 @@
+package transform
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// Fallback policies of ExtendedResources, when the target cluster has none of
+// a requested extended resource.
+const (
+	// ExtendedResourcesKeep restores the workload as it is, its pods pending
+	// until the cluster offers the resource.
+	ExtendedResourcesKeep = "keep"
+	// ExtendedResourcesRemove removes the resource from the workload so that
+	// it runs without it, with the accelerator runtime classes and node
+	// selectors once it requests no other extended resource.
+	ExtendedResourcesRemove = "remove"
+	// ExtendedResourcesFail fails the item.
+	ExtendedResourcesFail = "fail"
+)
+
+// ResourceMapping maps an extended resource to another, the counts
+// multiplied by Factor and rounded up.
+type ResourceMapping struct {
+	Name   string
+	Factor *resource.Quantity
+}
+
+// ExtendedResources adapts accelerator workloads to the hardware of the
+// target cluster: the extended resources of their containers, such as
+// nvidia.com/gpu, their runtimeClassName and their node selectors. Resources
+// that the target cluster does not offer, according to Available, are handled
+// by Fallback.
+type ExtendedResources struct {
+	Resources      map[string]ResourceMapping
+	RuntimeClasses map[string]string
+	// NodeSelectors maps key=value node labels to other labels, removed when
+	// mapped to an empty string
+	NodeSelectors map[string]string
+	Fallback      string
+	// Available returns the extended resources the target cluster offers
+	Available func() (map[string]bool, error)
+	Warn      func(format string, args ...interface{})
+}
+
+// Validate checks the mappings and the policy.
+func (e *ExtendedResources) Validate() error {
+	switch e.Fallback {
+	case ExtendedResourcesKeep, ExtendedResourcesRemove, ExtendedResourcesFail:
+	default:
+		return fmt.Errorf("unknown fallback %q, expected one of %s, %s or %s", e.Fallback, ExtendedResourcesKeep, ExtendedResourcesRemove, ExtendedResourcesFail)
+	}
+	for from, to := range e.Resources {
+		if !isExtendedResource(from) || !isExtendedResource(to.Name) {
+			return fmt.Errorf("cannot map %s to %s: only extended resources can be mapped", from, to.Name)
+		}
+		if to.Factor != nil && to.Factor.Sign() <= 0 {
+			return fmt.Errorf("the factor of %s must be positive", from)
+		}
+	}
+	for from, to := range e.NodeSelectors {
+		if !strings.Contains(from, "=") || (to != "" && !strings.Contains(to, "=")) {
+			return fmt.Errorf("cannot map node selector %q to %q: expected key=value labels", from, to)
+		}
+	}
+	return nil
+}
+
+// Name implements Transformer.
+func (e *ExtendedResources) Name() string {
+	return "extended-resources"
+}
+
+// Transform implements Transformer.
+func (e *ExtendedResources) Transform(item *unstructured.Unstructured) (*unstructured.Unstructured, error) {
+	out := item.DeepCopy()
+	specs := podSpecs(out.Object)
+	if len(specs) == 0 {
+		return item, nil
+	}
+	for _, spec := range specs {
+		if err := e.mapResources(spec); err != nil {
+			return nil, err
+		}
+		if class, ok := spec["runtimeClassName"].(string); ok {
+			if mapped, ok := e.RuntimeClasses[class]; ok {
+				spec["runtimeClassName"] = mapped
+			}
+		}
+		e.mapNodeSelector(spec)
+		e.mapNodeAffinity(spec)
+	}
+	if err := e.fallback(out, specs); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// mapResources renames the mapped resources of the containers and of the
+// tolerations of the pod spec.
+func (e *ExtendedResources) mapResources(spec map[string]interface{}) error {
+	for _, container := range podContainers(spec) {
+		for _, kind := range []string{"requests", "limits"} {
+			quantities := asMap(field(container, "resources", kind))
+			mapped := make(map[string]interface{}, len(quantities))
+			for _, name := range sortedFields(quantities) {
+				to, count := name, quantities[name]
+				if mapping, ok := e.Resources[name]; ok {
+					var err error
+					if count, err = scaleCount(count, mapping.Factor); err != nil {
+						return fmt.Errorf("invalid %s %s of container %v: %v", name, kind, field(container, "name"), err)
+					}
+					to = mapping.Name
+				}
+				if _, ok := mapped[to]; ok {
+					return fmt.Errorf("several %s of container %v map to %s", kind, field(container, "name"), to)
+				}
+				mapped[to] = count
+			}
+			if quantities != nil {
+				_ = unstructured.SetNestedField(asMap(container), mapped, "resources", kind)
+			}
+		}
+	}
+	for _, toleration := range list(spec, "tolerations") {
+		tolerationMap := asMap(toleration)
+		if key, _ := tolerationMap["key"].(string); key != "" {
+			if to, ok := e.Resources[key]; ok {
+				tolerationMap["key"] = to.Name
+			}
+		}
+	}
+	return nil
+}
+
+func (e *ExtendedResources) mapNodeSelector(spec map[string]interface{}) {
+	selector := asMap(spec["nodeSelector"])
+	for _, key := range sortedFields(selector) {
+		value, _ := selector[key].(string)
+		to, ok := e.NodeSelectors[key+"="+value]
+		if !ok {
+			continue
+		}
+		delete(selector, key)
+		if to != "" {
+			toKey, toValue, _ := strings.Cut(to, "=")
+			selector[toKey] = toValue
+		}
+	}
+}
+
+// mapNodeAffinity maps the In expressions of the required node affinity whose
+// values all map to labels of the same key.
+func (e *ExtendedResources) mapNodeAffinity(spec map[string]interface{}) {
+	terms := list(spec, "affinity", "nodeAffinity", "requiredDuringSchedulingIgnoredDuringExecution", "nodeSelectorTerms")
+	for _, term := range terms {
+		for _, expression := range list(term, "matchExpressions") {
+			expressionMap := asMap(expression)
+			key, _ := expressionMap["key"].(string)
+			if operator, _ := expressionMap["operator"].(string); operator != "In" {
+				continue
+			}
+			values := list(expressionMap, "values")
+			var toKey string
+			mapped := make([]interface{}, 0, len(values))
+			for _, value := range values {
+				to, ok := e.NodeSelectors[fmt.Sprintf("%s=%v", key, value)]
+				if !ok || to == "" {
+					mapped = nil
+					break
+				}
+				k, v, _ := strings.Cut(to, "=")
+				if toKey != "" && k != toKey {
+					e.warn("Not mapping the node affinity on %s: its values map to several keys", key)
+					mapped = nil
+					break
+				}
+				toKey = k
+				mapped = append(mapped, v)
+			}
+			if len(mapped) > 0 {
+				expressionMap["key"] = toKey
+				expressionMap["values"] = mapped
+			}
+		}
+	}
+}
+
+// fallback applies the fallback policy to the extended resources the target
+// cluster does not offer.
+func (e *ExtendedResources) fallback(item *unstructured.Unstructured, specs map[int]map[string]interface{}) error {
+	if e.Fallback == ExtendedResourcesKeep {
+		return nil
+	}
+	requested := make(map[string]bool)
+	for _, spec := range specs {
+		for name := range podExtendedResources(spec) {
+			requested[name] = true
+		}
+	}
+	if len(requested) == 0 {
+		return nil
+	}
+	if e.Available == nil {
+		return fmt.Errorf("the extended resources of the target cluster are unknown")
+	}
+	available, err := e.Available()
+	if err != nil {
+		return err
+	}
+	var missing []string
+	for name := range requested {
+		if !available[name] {
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+	sort.Strings(missing)
+	if e.Fallback == ExtendedResourcesFail {
+		return fmt.Errorf("the target cluster has no %s", strings.Join(missing, ", "))
+	}
+
+	e.warn("Removing %s from %s %s/%s: the target cluster has none", strings.Join(missing, ", "), item.GetKind(), item.GetNamespace(), item.GetName())
+	for _, spec := range specs {
+		for _, container := range podContainers(spec) {
+			for _, kind := range []string{"requests", "limits"} {
+				quantities := asMap(field(container, "resources", kind))
+				for _, name := range missing {
+					delete(quantities, name)
+				}
+			}
+		}
+		if tolerations, ok := spec["tolerations"].([]interface{}); ok {
+			spec["tolerations"] = slices.DeleteFunc(tolerations, func(toleration interface{}) bool {
+				key, _ := field(toleration, "key").(string)
+				return slices.Contains(missing, key)
+			})
+		}
+		if len(podExtendedResources(spec)) > 0 {
+			continue
+		}
+		// the pods run without accelerator: the runtime classes and node
+		// labels of the mappings, the ones of the accelerators, go too
+		if class, ok := spec["runtimeClassName"].(string); ok && e.acceleratorRuntimeClass(class) {
+			delete(spec, "runtimeClassName")
+		}
+		selector := asMap(spec["nodeSelector"])
+		for key, value := range selector {
+			if e.acceleratorLabel(fmt.Sprintf("%s=%v", key, value)) {
+				delete(selector, key)
+			}
+		}
+	}
+	return nil
+}
+
+func (e *ExtendedResources) acceleratorRuntimeClass(class string) bool {
+	for from, to := range e.RuntimeClasses {
+		if class == from || class == to {
+			return true
+		}
+	}
+	return false
+}
+
+func (e *ExtendedResources) acceleratorLabel(label string) bool {
+	for from, to := range e.NodeSelectors {
+		if label == from || label == to {
+			return true
+		}
+	}
+	return false
+}
+
+func (e *ExtendedResources) warn(format string, args ...interface{}) {
+	if e.Warn != nil {
+		e.Warn(format, args...)
+	}
+}
+
+// isExtendedResource tells whether a resource name is an extended resource,
+// a name qualified by a domain outside kubernetes.io.
+func isExtendedResource(name string) bool {
+	domain, _, ok := strings.Cut(name, "/")
+	return ok && domain != "kubernetes.io" && !strings.HasSuffix(domain, ".kubernetes.io")
+}
+
+// podExtendedResources returns the extended resources the containers of a pod
+// spec request.
+func podExtendedResources(spec map[string]interface{}) map[string]bool {
+	names := make(map[string]bool)
+	for _, container := range podContainers(spec) {
+		for _, kind := range []string{"requests", "limits"} {
+			for name := range asMap(field(container, "resources", kind)) {
+				if isExtendedResource(name) {
+					names[name] = true
+				}
+			}
+		}
+	}
+	return names
+}
+
+// podContainers returns the containers and init containers of a pod spec.
+func podContainers(spec map[string]interface{}) []interface{} {
+	containers := append([]interface{}{}, list(spec, "initContainers")...)
+	return append(containers, list(spec, "containers")...)
+}
+
+// scaleCount multiplies the count of an extended resource by factor, rounding
+// up. Extended resources are counted in whole units.
+func scaleCount(value interface{}, factor *resource.Quantity) (interface{}, error) {
+	if factor == nil {
+		return value, nil
+	}
+	count, err := resource.ParseQuantity(fmt.Sprint(value))
+	if err != nil {
+		return nil, err
+	}
+	scaled := count.AsDec()
+	scaled.Mul(scaled, factor.AsDec())
+	result := resource.NewDecimalQuantity(*scaled, resource.DecimalSI)
+	// MilliValue rounds up, and so does the division of the next line
+	return fmt.Sprint((result.MilliValue() + 999) / 1000), nil
+}
+
+func sortedFields(object map[string]interface{}) []string {
+	keys := make([]string, 0, len(object))
+	for key := range object {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
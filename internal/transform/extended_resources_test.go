@@ -0,0 +1,140 @@
+package transform
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func gpuJob(limits map[string]interface{}, spec map[string]interface{}) *unstructured.Unstructured {
+	spec["containers"] = []interface{}{map[string]interface{}{
+		"name":      "train",
+		"resources": map[string]interface{}{"limits": limits, "requests": map[string]interface{}{"cpu": "2"}},
+	}}
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "batch/v1",
+		"kind":       "Job",
+		"metadata":   map[string]interface{}{"name": "train", "namespace": "ml"},
+		"spec":       map[string]interface{}{"template": map[string]interface{}{"spec": spec}},
+	}}
+}
+
+func podSpecOf(item *unstructured.Unstructured) map[string]interface{} {
+	return asMap(field(item.Object, "spec", "template", "spec"))
+}
+
+func TestExtendedResources_Mapping(t *testing.T) {
+	half := resource.MustParse("0.5")
+	transformer := &ExtendedResources{
+		Resources: map[string]ResourceMapping{
+			"nvidia.com/gpu":     {Name: "amd.com/gpu"},
+			"nvidia.com/mig-1g":  {Name: "nvidia.com/gpu", Factor: &half},
+			"example.com/fpga-a": {Name: "example.com/fpga-b", Factor: resource.NewQuantity(2, resource.DecimalSI)},
+		},
+		RuntimeClasses: map[string]string{"nvidia": "amd"},
+		NodeSelectors: map[string]string{
+			"cloud.google.com/gke-accelerator=nvidia-tesla-t4":   "accelerator=mi210",
+			"cloud.google.com/gke-accelerator=nvidia-tesla-a100": "accelerator=mi250",
+			"nvidia.com/gpu.present=true":                        "",
+		},
+		Fallback: ExtendedResourcesKeep,
+	}
+	require.NoError(t, transformer.Validate())
+
+	job := gpuJob(map[string]interface{}{"nvidia.com/gpu": int64(1), "nvidia.com/mig-1g": "3", "example.com/fpga-a": "2"}, map[string]interface{}{
+		"runtimeClassName": "nvidia",
+		"nodeSelector":     map[string]interface{}{"cloud.google.com/gke-accelerator": "nvidia-tesla-t4", "nvidia.com/gpu.present": "true", "pool": "gpu"},
+		"tolerations":      []interface{}{map[string]interface{}{"key": "nvidia.com/gpu", "operator": "Exists", "effect": "NoSchedule"}},
+		"affinity": map[string]interface{}{"nodeAffinity": map[string]interface{}{"requiredDuringSchedulingIgnoredDuringExecution": map[string]interface{}{
+			"nodeSelectorTerms": []interface{}{map[string]interface{}{"matchExpressions": []interface{}{map[string]interface{}{
+				"key": "cloud.google.com/gke-accelerator", "operator": "In", "values": []interface{}{"nvidia-tesla-t4", "nvidia-tesla-a100"},
+			}}}},
+		}}},
+	})
+	original := job.DeepCopy()
+
+	output, err := transformer.Transform(job)
+	require.NoError(t, err)
+	assert.Equal(t, original, job, "the input is not modified")
+	spec := podSpecOf(output)
+	assert.Equal(t, map[string]interface{}{"amd.com/gpu": int64(1), "nvidia.com/gpu": "2", "example.com/fpga-b": "4"},
+		field(list(spec, "containers")[0], "resources", "limits"))
+	assert.Equal(t, "amd", spec["runtimeClassName"])
+	assert.Equal(t, map[string]interface{}{"accelerator": "mi210", "pool": "gpu"}, spec["nodeSelector"])
+	assert.Equal(t, "amd.com/gpu", field(list(spec, "tolerations")[0], "key"))
+	expression := list(spec, "affinity", "nodeAffinity", "requiredDuringSchedulingIgnoredDuringExecution", "nodeSelectorTerms")[0]
+	assert.Equal(t, map[string]interface{}{"key": "accelerator", "operator": "In", "values": []interface{}{"mi210", "mi250"}}, list(expression, "matchExpressions")[0])
+
+	_, err = transformer.Transform(gpuJob(map[string]interface{}{"nvidia.com/gpu": "1", "amd.com/gpu": "1"}, map[string]interface{}{}))
+	assert.Error(t, err, "both resources map to amd.com/gpu")
+
+	configMap := &unstructured.Unstructured{Object: map[string]interface{}{"kind": "ConfigMap"}}
+	output, err = transformer.Transform(configMap)
+	require.NoError(t, err)
+	assert.Equal(t, configMap, output)
+}
+
+func TestExtendedResources_Fallback(t *testing.T) {
+	available := func() (map[string]bool, error) { return map[string]bool{"cpu": true, "amd.com/gpu": true}, nil }
+	var warnings []string
+	transformer := &ExtendedResources{
+		Resources:      map[string]ResourceMapping{"nvidia.com/gpu": {Name: "amd.com/gpu"}},
+		RuntimeClasses: map[string]string{"nvidia": "amd"},
+		NodeSelectors:  map[string]string{"accelerator=t4": "accelerator=mi210"},
+		Fallback:       ExtendedResourcesRemove,
+		Available:      available,
+		Warn:           func(format string, args ...interface{}) { warnings = append(warnings, format) },
+	}
+	spec := func() map[string]interface{} {
+		return map[string]interface{}{
+			"runtimeClassName": "nvidia",
+			"nodeSelector":     map[string]interface{}{"accelerator": "t4"},
+			"tolerations":      []interface{}{map[string]interface{}{"key": "example.com/fpga", "operator": "Exists"}},
+		}
+	}
+
+	// the GPUs are there, the FPGA is not
+	output, err := transformer.Transform(gpuJob(map[string]interface{}{"nvidia.com/gpu": "1", "example.com/fpga": "1"}, spec()))
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"amd.com/gpu": "1"}, field(list(podSpecOf(output), "containers")[0], "resources", "limits"))
+	assert.Equal(t, "amd", podSpecOf(output)["runtimeClassName"])
+	assert.Empty(t, list(podSpecOf(output), "tolerations"))
+	assert.Len(t, warnings, 1)
+
+	// nothing is left of the accelerators
+	transformer.Available = func() (map[string]bool, error) { return map[string]bool{}, nil }
+	output, err = transformer.Transform(gpuJob(map[string]interface{}{"nvidia.com/gpu": "1"}, spec()))
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{}, field(list(podSpecOf(output), "containers")[0], "resources", "limits"))
+	assert.NotContains(t, podSpecOf(output), "runtimeClassName")
+	assert.Equal(t, map[string]interface{}{}, podSpecOf(output)["nodeSelector"])
+
+	transformer.Fallback = ExtendedResourcesFail
+	_, err = transformer.Transform(gpuJob(map[string]interface{}{"nvidia.com/gpu": "1"}, spec()))
+	assert.EqualError(t, err, "the target cluster has no amd.com/gpu")
+
+	transformer.Available = func() (map[string]bool, error) { return nil, errors.New("forbidden") }
+	_, err = transformer.Transform(gpuJob(map[string]interface{}{"nvidia.com/gpu": "1"}, spec()))
+	assert.Error(t, err)
+	output, err = transformer.Transform(gpuJob(map[string]interface{}{"memory": "1Gi"}, spec()))
+	require.NoError(t, err, "the nodes are only needed for extended resources")
+	assert.Equal(t, "amd", podSpecOf(output)["runtimeClassName"])
+}
+
+func TestExtendedResources_Validate(t *testing.T) {
+	zero := resource.MustParse("0")
+	for _, transformer := range []*ExtendedResources{
+		{},
+		{Fallback: "drop"},
+		{Fallback: ExtendedResourcesKeep, Resources: map[string]ResourceMapping{"cpu": {Name: "amd.com/gpu"}}},
+		{Fallback: ExtendedResourcesKeep, Resources: map[string]ResourceMapping{"nvidia.com/gpu": {Name: "hugepages.kubernetes.io/2Mi"}}},
+		{Fallback: ExtendedResourcesKeep, Resources: map[string]ResourceMapping{"nvidia.com/gpu": {Name: "amd.com/gpu", Factor: &zero}}},
+		{Fallback: ExtendedResourcesKeep, NodeSelectors: map[string]string{"accelerator": "gpu=amd"}},
+	} {
+		assert.Error(t, transformer.Validate(), transformer)
+	}
+}
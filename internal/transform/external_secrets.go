@@ -0,0 +1,109 @@
+package transform
+
+import (
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// externalSecretSpecPaths are the locations of an ExternalSecret spec: in
+// ExternalSecrets and in ClusterExternalSecrets.
+var externalSecretSpecPaths = map[string][]string{
+	"ExternalSecret":        {"spec"},
+	"ClusterExternalSecret": {"spec", "externalSecretSpec"},
+}
+
+// ExternalSecrets adapts the resources of the external-secrets operator to
+// the target environment: the stores ExternalSecrets read from, the remote
+// keys they read, and the roles SecretStores assume. Stores and roles are
+// mapped as whole values, remote keys by path prefix.
+type ExternalSecrets struct {
+	Stores      map[string]string
+	Roles       map[string]string
+	KeyPrefixes map[string]string
+}
+
+// Name implements Transformer.
+func (e *ExternalSecrets) Name() string {
+	return "external-secrets"
+}
+
+// OwnedPaths implements FieldOwner.
+func (e *ExternalSecrets) OwnedPaths() [][]string {
+	var paths [][]string
+	for _, kind := range []string{"ExternalSecret", "ClusterExternalSecret"} {
+		spec := externalSecretSpecPaths[kind]
+		for _, path := range [][]string{
+			{"secretStoreRef", "name"},
+			{"data", "remoteRef", "key"},
+			{"dataFrom", "extract", "key"},
+			{"dataFrom", "find", "path"},
+			{"dataFrom", "sourceRef", "storeRef", "name"},
+		} {
+			paths = append(paths, append(append([]string{}, spec...), path...))
+		}
+	}
+	return append(paths, []string{"spec", "provider", "aws", "role"})
+}
+
+// Transform implements Transformer.
+func (e *ExternalSecrets) Transform(item *unstructured.Unstructured) (*unstructured.Unstructured, error) {
+	out := item.DeepCopy()
+	switch out.GetKind() {
+	case "ExternalSecret", "ClusterExternalSecret":
+		spec, ok := field(out.Object, externalSecretSpecPaths[out.GetKind()]...).(map[string]interface{})
+		if !ok {
+			break
+		}
+		mapField(field(spec, "secretStoreRef"), "name", e.Stores)
+		for _, data := range list(spec, "data") {
+			e.mapKey(field(data, "remoteRef"), "key")
+		}
+		for _, data := range list(spec, "dataFrom") {
+			e.mapKey(field(data, "extract"), "key")
+			e.mapKey(field(data, "find"), "path")
+			mapField(field(data, "sourceRef", "storeRef"), "name", e.Stores)
+		}
+	case "SecretStore", "ClusterSecretStore":
+		mapField(field(out.Object, "spec", "provider", "aws"), "role", e.Roles)
+	}
+	return out, nil
+}
+
+// mapKey maps the longest prefix of a remote key found in KeyPrefixes. Prefixes
+// match whole path segments.
+func (e *ExternalSecrets) mapKey(object interface{}, key string) {
+	o, ok := object.(map[string]interface{})
+	if !ok {
+		return
+	}
+	value, ok := o[key].(string)
+	if !ok {
+		return
+	}
+	longest := ""
+	for prefix := range e.KeyPrefixes {
+		if len(prefix) <= len(longest) || !strings.HasPrefix(value, prefix) {
+			continue
+		}
+		if rest := value[len(prefix):]; rest == "" || strings.HasPrefix(rest, "/") || strings.HasSuffix(prefix, "/") {
+			longest = prefix
+		}
+	}
+	if longest != "" {
+		o[key] = e.KeyPrefixes[longest] + value[len(longest):]
+	}
+}
+
+// mapField maps the string at key of an object.
+func mapField(object interface{}, key string, mapping map[string]string) {
+	o, ok := object.(map[string]interface{})
+	if !ok {
+		return
+	}
+	if value, ok := o[key].(string); ok {
+		if mapped, ok := mapping[value]; ok {
+			o[key] = mapped
+		}
+	}
+}
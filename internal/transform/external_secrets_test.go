@@ -0,0 +1,78 @@
+package transform
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func testExternalSecrets() *ExternalSecrets {
+	return &ExternalSecrets{
+		Stores:      map[string]string{"vault-prod": "vault-dr"},
+		Roles:       map[string]string{"arn:aws:iam::111111111111:role/eso": "arn:aws:iam::222222222222:role/eso"},
+		KeyPrefixes: map[string]string{"prod": "dr", "prod/payments": "dr-payments"},
+	}
+}
+
+func TestExternalSecrets_ExternalSecret(t *testing.T) {
+	externalSecret := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "external-secrets.io/v1beta1",
+		"kind":       "ExternalSecret",
+		"spec": map[string]interface{}{
+			"secretStoreRef": map[string]interface{}{"name": "vault-prod", "kind": "ClusterSecretStore"},
+			"data": []interface{}{
+				map[string]interface{}{"secretKey": "password", "remoteRef": map[string]interface{}{"key": "prod/app/db", "property": "password"}},
+				map[string]interface{}{"secretKey": "token", "remoteRef": map[string]interface{}{"key": "prod/payments/api"}},
+				map[string]interface{}{"secretKey": "other", "remoteRef": map[string]interface{}{"key": "production/app"}},
+			},
+			"dataFrom": []interface{}{
+				map[string]interface{}{"extract": map[string]interface{}{"key": "prod"}},
+				map[string]interface{}{"find": map[string]interface{}{"path": "prod/app"}, "sourceRef": map[string]interface{}{"storeRef": map[string]interface{}{"name": "vault-prod"}}},
+			},
+		},
+	}}
+	original := externalSecret.DeepCopy()
+
+	output, err := testExternalSecrets().Transform(externalSecret)
+	require.NoError(t, err)
+	assert.Equal(t, "vault-dr", field(output.Object, "spec", "secretStoreRef", "name"))
+	data := list(output.Object, "spec", "data")
+	assert.Equal(t, "dr/app/db", field(data[0], "remoteRef", "key"))
+	assert.Equal(t, "dr-payments/api", field(data[1], "remoteRef", "key"))
+	// prefixes match whole path segments
+	assert.Equal(t, "production/app", field(data[2], "remoteRef", "key"))
+	dataFrom := list(output.Object, "spec", "dataFrom")
+	assert.Equal(t, "dr", field(dataFrom[0], "extract", "key"))
+	assert.Equal(t, "dr/app", field(dataFrom[1], "find", "path"))
+	assert.Equal(t, "vault-dr", field(dataFrom[1], "sourceRef", "storeRef", "name"))
+	assert.Equal(t, original, externalSecret)
+}
+
+func TestExternalSecrets_ClusterExternalSecret(t *testing.T) {
+	clusterExternalSecret := &unstructured.Unstructured{Object: map[string]interface{}{
+		"kind": "ClusterExternalSecret",
+		"spec": map[string]interface{}{"externalSecretSpec": map[string]interface{}{
+			"secretStoreRef": map[string]interface{}{"name": "vault-prod"},
+			"data":           []interface{}{map[string]interface{}{"remoteRef": map[string]interface{}{"key": "prod/app"}}},
+		}},
+	}}
+	output, err := testExternalSecrets().Transform(clusterExternalSecret)
+	require.NoError(t, err)
+	assert.Equal(t, "vault-dr", field(output.Object, "spec", "externalSecretSpec", "secretStoreRef", "name"))
+	assert.Equal(t, "dr/app", field(list(output.Object, "spec", "externalSecretSpec", "data")[0], "remoteRef", "key"))
+}
+
+func TestExternalSecrets_SecretStore(t *testing.T) {
+	store := &unstructured.Unstructured{Object: map[string]interface{}{
+		"kind": "ClusterSecretStore",
+		"spec": map[string]interface{}{"provider": map[string]interface{}{"aws": map[string]interface{}{
+			"service": "SecretsManager",
+			"role":    "arn:aws:iam::111111111111:role/eso",
+		}}},
+	}}
+	output, err := testExternalSecrets().Transform(store)
+	require.NoError(t, err)
+	assert.Equal(t, "arn:aws:iam::222222222222:role/eso", field(output.Object, "spec", "provider", "aws", "role"))
+}
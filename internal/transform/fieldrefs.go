@@ -0,0 +1,118 @@
+package transform
+
+import (
+	"fmt"
+	"regexp"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// podSpecPaths are the locations of a pod spec: in Pods, in the workloads with
+// a pod template, and in CronJobs.
+var podSpecPaths = [][]string{
+	{"spec"},
+	{"spec", "template", "spec"},
+	{"spec", "jobTemplate", "spec", "template", "spec"},
+}
+
+// metadataKeyPath matches the downward API paths selecting one label or
+// annotation.
+var metadataKeyPath = regexp.MustCompile(`^metadata\.(labels|annotations)\['(.*)'\]$`)
+
+// FieldRefs keeps the downward API references of a pod spec, in env vars and in
+// downwardAPI or projected volumes, consistent with the transformed metadata.
+// Field paths are recomputed from the original item: structural paths such as
+// metadata.name are restored verbatim, and label or annotation keys are
+// renamed with RenameKey, as the keys of the metadata were.
+type FieldRefs struct {
+	Original  *unstructured.Unstructured
+	RenameKey func(key string) string
+}
+
+// Name implements Transformer.
+func (f *FieldRefs) Name() string {
+	return "fieldrefs"
+}
+
+// Transform implements Transformer.
+func (f *FieldRefs) Transform(item *unstructured.Unstructured) (*unstructured.Unstructured, error) {
+	out := item.DeepCopy()
+	for _, path := range podSpecPaths {
+		original, found, _ := unstructured.NestedFieldNoCopy(f.Original.Object, path...)
+		if !found {
+			continue
+		}
+		spec, found, _ := unstructured.NestedFieldNoCopy(out.Object, path...)
+		if !found {
+			continue
+		}
+
+		originalRefs, refs := fieldRefs(original), fieldRefs(spec)
+		if len(originalRefs) != len(refs) {
+			return nil, fmt.Errorf("pod spec at %v has %d field references, %d in the original item", path, len(refs), len(originalRefs))
+		}
+		for i, ref := range refs {
+			if fieldPath, ok := originalRefs[i]["fieldPath"].(string); ok {
+				ref["fieldPath"] = f.fieldPath(fieldPath)
+			}
+		}
+	}
+	return out, nil
+}
+
+// fieldPath returns the transformed version of an original field path.
+func (f *FieldRefs) fieldPath(path string) string {
+	match := metadataKeyPath.FindStringSubmatch(path)
+	if match == nil || f.RenameKey == nil {
+		return path
+	}
+	return fmt.Sprintf("metadata.%s['%s']", match[1], f.RenameKey(match[2]))
+}
+
+// fieldRefs lists the fieldRef objects of a pod spec, in a stable order.
+func fieldRefs(spec interface{}) []map[string]interface{} {
+	var refs []map[string]interface{}
+	for _, containers := range []string{"initContainers", "containers", "ephemeralContainers"} {
+		for _, container := range list(spec, containers) {
+			for _, env := range list(container, "env") {
+				refs = appendRef(refs, field(env, "valueFrom", "fieldRef"))
+			}
+		}
+	}
+	for _, volume := range list(spec, "volumes") {
+		for _, file := range list(volume, "downwardAPI", "items") {
+			refs = appendRef(refs, field(file, "fieldRef"))
+		}
+		for _, source := range list(volume, "projected", "sources") {
+			for _, file := range list(source, "downwardAPI", "items") {
+				refs = appendRef(refs, field(file, "fieldRef"))
+			}
+		}
+	}
+	return refs
+}
+
+func appendRef(refs []map[string]interface{}, ref interface{}) []map[string]interface{} {
+	if ref, ok := ref.(map[string]interface{}); ok {
+		return append(refs, ref)
+	}
+	return refs
+}
+
+// field returns the value at path in an object, or nil.
+func field(value interface{}, path ...string) interface{} {
+	for _, key := range path {
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		value = object[key]
+	}
+	return value
+}
+
+// list returns the list at path in an object, or nil.
+func list(value interface{}, path ...string) []interface{} {
+	items, _ := field(value, path...).([]interface{})
+	return items
+}
@@ -0,0 +1,68 @@
+package transform
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func fieldRefsDeployment(labelKey, namePath string) *unstructured.Unstructured {
+	fieldRef := func(path string) map[string]interface{} {
+		return map[string]interface{}{"fieldRef": map[string]interface{}{"fieldPath": path}}
+	}
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"kind": "Deployment",
+		"spec": map[string]interface{}{
+			"template": map[string]interface{}{
+				"metadata": map[string]interface{}{"labels": map[string]interface{}{labelKey: "web"}},
+				"spec": map[string]interface{}{
+					"containers": []interface{}{map[string]interface{}{
+						"name": "web",
+						"env": []interface{}{
+							map[string]interface{}{"name": "TIER", "valueFrom": fieldRef("metadata.labels['" + labelKey + "']")},
+							map[string]interface{}{"name": "POD", "valueFrom": fieldRef(namePath)},
+							map[string]interface{}{"name": "PLAIN", "value": "x"},
+						},
+					}},
+					"volumes": []interface{}{
+						map[string]interface{}{"name": "info", "downwardAPI": map[string]interface{}{
+							"items": []interface{}{fieldRef(namePath)},
+						}},
+						map[string]interface{}{"name": "all", "projected": map[string]interface{}{
+							"sources": []interface{}{map[string]interface{}{"downwardAPI": map[string]interface{}{
+								"items": []interface{}{fieldRef("metadata.labels['" + labelKey + "']")},
+							}}},
+						}},
+					},
+				},
+			},
+		},
+	}}
+}
+
+func TestFieldRefs(t *testing.T) {
+	original := fieldRefsDeployment("production.example.com/tier", "metadata.name")
+	// what a pattern "name" -> "id" and a mapping of the label key would leave
+	transformed := fieldRefsDeployment("review.example.com/tier", "metadata.id")
+
+	refs := &FieldRefs{Original: original, RenameKey: func(key string) string {
+		return strings.ReplaceAll(key, "production", "review")
+	}}
+	output, err := refs.Transform(transformed)
+	require.NoError(t, err)
+
+	assert.Equal(t, fieldRefsDeployment("review.example.com/tier", "metadata.name"), output)
+	assert.Equal(t, fieldRefsDeployment("review.example.com/tier", "metadata.id"), transformed)
+}
+
+func TestFieldRefs_Mismatch(t *testing.T) {
+	original := fieldRefsDeployment("tier", "metadata.name")
+	transformed := fieldRefsDeployment("tier", "metadata.name")
+	unstructured.RemoveNestedField(transformed.Object, "spec", "template", "spec", "volumes")
+
+	_, err := (&FieldRefs{Original: original}).Transform(transformed)
+	assert.Error(t, err)
+}
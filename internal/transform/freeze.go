@@ -0,0 +1,41 @@
+package transform
+
+import (
+	"time"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// FreezeUntilAnnotation holds the time, in RFC 3339, until which cooperating
+// controllers leave a restored workload alone: no scaling, no rollout.
+const FreezeUntilAnnotation = "agoracalyce.io/freeze-until"
+
+// Freeze stamps the restored workloads, the items with a pod template, with
+// FreezeUntilAnnotation, so that autoscalers and rollout tools wait for their
+// volumes to be restored. Pods are left alone.
+type Freeze struct {
+	Until time.Time
+}
+
+// Name implements Transformer.
+func (f *Freeze) Name() string {
+	return "freeze"
+}
+
+// Transform implements Transformer.
+func (f *Freeze) Transform(item *unstructured.Unstructured) (*unstructured.Unstructured, error) {
+	specs := podSpecs(item.Object)
+	// the pod spec of Pods is the first path
+	delete(specs, 0)
+	if len(specs) == 0 {
+		return item, nil
+	}
+	out := item.DeepCopy()
+	annotations := out.GetAnnotations()
+	if annotations == nil {
+		annotations = make(map[string]string)
+	}
+	annotations[FreezeUntilAnnotation] = f.Until.UTC().Format(time.RFC3339)
+	out.SetAnnotations(annotations)
+	return out, nil
+}
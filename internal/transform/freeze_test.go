@@ -0,0 +1,51 @@
+package transform
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestFreeze_Transform(t *testing.T) {
+	until := time.Date(2026, 10, 16, 12, 30, 0, 0, time.FixedZone("CEST", 2*3600))
+	freeze := &Freeze{Until: until}
+	container := []interface{}{map[string]interface{}{"name": "web"}}
+
+	for _, tt := range []struct {
+		name   string
+		object map[string]interface{}
+		frozen bool
+	}{
+		{"deployment", map[string]interface{}{
+			"kind": "Deployment",
+			"spec": map[string]interface{}{"template": map[string]interface{}{"spec": map[string]interface{}{"containers": container}}},
+		}, true},
+		{"cronjob", map[string]interface{}{
+			"kind": "CronJob",
+			"spec": map[string]interface{}{"jobTemplate": map[string]interface{}{"spec": map[string]interface{}{"template": map[string]interface{}{"spec": map[string]interface{}{"containers": container}}}}},
+		}, true},
+		{"pod", map[string]interface{}{
+			"kind": "Pod",
+			"spec": map[string]interface{}{"containers": container},
+		}, false},
+		{"configmap", map[string]interface{}{
+			"kind": "ConfigMap",
+			"data": map[string]interface{}{"key": "value"},
+		}, false},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			item := &unstructured.Unstructured{Object: tt.object}
+			out, err := freeze.Transform(item)
+			require.NoError(t, err)
+			if !tt.frozen {
+				assert.Same(t, item, out)
+				return
+			}
+			assert.Equal(t, "2026-10-16T10:30:00Z", out.GetAnnotations()[FreezeUntilAnnotation])
+			assert.Empty(t, item.GetAnnotations(), "input must be left untouched")
+		})
+	}
+}
@@ -0,0 +1,190 @@
+package transform
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/wrkt/velero-custom-plugins/internal/fixtures"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// addFixtureSeeds seeds the fixtures with rules, lines of a pattern and its
+// replacement separated by a tab, see parseRules.
+func addFixtureSeeds(f *testing.F, rules ...string) {
+	for _, name := range fixtures.Names() {
+		data, err := json.Marshal(fixtures.MustLoad(name).Object)
+		if err != nil {
+			f.Fatalf("failed to marshal fixture %s: %v", name, err)
+		}
+		for _, rule := range rules {
+			f.Add(string(data), rule)
+		}
+	}
+	f.Add(`{"a": [1, 2.5, true, null, "x"], "b": {"": ""}}`, "x\t\na\tx")
+	f.Add(`{"<foo>": "\"quoted\" \\ value"}`, "\"\t\\")
+	f.Add(`{"metadata": {"name": "web"}, "other": "x"}`, "other\tmetadata\nweb\tapp")
+}
+
+// parseRules reads the fuzzed rules: one pattern per line, its replacement
+// after the first tab.
+func parseRules(rules string) map[string]string {
+	patterns := make(map[string]string)
+	for _, line := range strings.Split(rules, "\n") {
+		pattern, replacement, _ := strings.Cut(line, "\t")
+		patterns[pattern] = replacement
+	}
+	return patterns
+}
+
+// FuzzReplaceStream checks the streaming decoder agrees with the in-memory
+// walker on any valid JSON document and always yields valid JSON.
+func FuzzReplaceStream(f *testing.F) {
+	addFixtureSeeds(f, "production\treplaced", "example.com\treplaced\nproduction\tdr")
+
+	f.Fuzz(func(t *testing.T, doc, rules string) {
+		if !json.Valid([]byte(doc)) {
+			return
+		}
+		fn := literalFunc(parseRules(rules))
+
+		streamed, err := ReplaceStream(strings.NewReader(doc), fn)
+		if err != nil {
+			t.Fatalf("valid document rejected: %v", err)
+		}
+		identity, err := ReplaceStream(strings.NewReader(doc), func(s string) string { return s })
+		if err != nil {
+			t.Fatalf("valid document rejected: %v", err)
+		}
+
+		out, err := json.Marshal(streamed)
+		if err != nil || !json.Valid(out) {
+			t.Fatalf("output is not valid JSON: %v", err)
+		}
+		// renamed keys may collapse into one, the one kept depending on the
+		// order of the walk
+		if countKeys(streamed) != countKeys(identity) {
+			return
+		}
+		walked, err := json.Marshal(ReplaceTokens(identity, fn))
+		if err != nil {
+			t.Fatalf("walker output is not valid JSON: %v", err)
+		}
+		if string(out) != string(walked) {
+			t.Fatalf("stream and walker disagree:\n%s\n%s", out, walked)
+		}
+	})
+}
+
+// FuzzLiteral feeds random items and rules to the literal transformer and
+// checks the output is valid JSON whose protected paths and non-string values
+// are untouched.
+func FuzzLiteral(f *testing.F) {
+	addFixtureSeeds(f, "production\treplaced", "\treplaced", "a\tb\nb\ta", "metadata\tspec\nname\tnom")
+
+	f.Fuzz(func(t *testing.T, doc, rules string) {
+		var obj map[string]interface{}
+		if err := json.Unmarshal([]byte(doc), &obj); err != nil {
+			return
+		}
+
+		protected := [][]string{{"metadata", "name"}, {"spec", "template", "metadata", "labels"}}
+		before := make([]interface{}, len(protected))
+		for i, path := range protected {
+			before[i], _, _ = unstructured.NestedFieldCopy(obj, path...)
+		}
+		literal := &Literal{
+			Patterns:  parseRules(rules),
+			Protected: protected,
+		}
+		out, err := literal.Transform(&unstructured.Unstructured{Object: obj})
+		if err != nil {
+			t.Fatalf("transform failed: %v", err)
+		}
+
+		// protected paths keep their values, whatever the renamed keys
+		for i, path := range protected {
+			after, _, _ := unstructured.NestedFieldCopy(out.Object, path...)
+			if !reflect.DeepEqual(before[i], after) {
+				t.Fatalf("protected %s changed: %v -> %v", strings.Join(path, "."), before[i], after)
+			}
+		}
+
+		data, err := json.Marshal(out.Object)
+		if err != nil || !json.Valid(data) {
+			t.Fatalf("output is not valid JSON: %v", err)
+		}
+
+		// Renamed keys may collapse into one; only compare values when they
+		// did not.
+		if countKeys(obj) == countKeys(out.Object) {
+			if before, after := scalars(obj), scalars(out.Object); before != after {
+				t.Fatalf("non-string values changed: %v -> %v", before, after)
+			}
+		}
+	})
+}
+
+// literalFunc replaces the patterns in a single pass, longest first.
+func literalFunc(patterns map[string]string) StringFunc {
+	keys := make([]string, 0, len(patterns))
+	for pattern := range patterns {
+		if pattern != "" {
+			keys = append(keys, pattern)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return len(keys[i]) > len(keys[j]) || len(keys[i]) == len(keys[j]) && keys[i] < keys[j]
+	})
+	pairs := make([]string, 0, 2*len(keys))
+	for _, pattern := range keys {
+		pairs = append(pairs, pattern, patterns[pattern])
+	}
+	return strings.NewReplacer(pairs...).Replace
+}
+
+func countKeys(value interface{}) int {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		n := len(v)
+		for _, child := range v {
+			n += countKeys(child)
+		}
+		return n
+	case []interface{}:
+		n := 0
+		for _, child := range v {
+			n += countKeys(child)
+		}
+		return n
+	default:
+		return 0
+	}
+}
+
+// scalars counts non-string leaves by their printed value.
+func scalars(value interface{}) string {
+	counts := map[string]int{}
+	var walk func(interface{})
+	walk = func(value interface{}) {
+		switch v := value.(type) {
+		case map[string]interface{}:
+			for _, child := range v {
+				walk(child)
+			}
+		case []interface{}:
+			for _, child := range v {
+				walk(child)
+			}
+		case string:
+		default:
+			data, _ := json.Marshal(v)
+			counts[string(data)]++
+		}
+	}
+	walk(value)
+	data, _ := json.Marshal(counts)
+	return string(data)
+}
@@ -0,0 +1,120 @@
+package transform
+
+import (
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// GatewayGroup is the API group of the Gateway API.
+const GatewayGroup = "gateway.networking.k8s.io"
+
+// gatewayRoutes are the Gateway API kinds attaching to Gateways.
+var gatewayRoutes = map[string]bool{
+	"HTTPRoute": true,
+	"GRPCRoute": true,
+	"TLSRoute":  true,
+	"TCPRoute":  true,
+	"UDPRoute":  true,
+}
+
+// RenameFunc returns the namespace and name an object restored before was
+// renamed to, and false when it was not renamed.
+type RenameFunc func(group, kind, namespace, name string) (string, string, bool)
+
+// GatewayRefs keeps the cross-namespace references of Gateway API resources
+// consistent with the namespaces and names of the restored objects: parentRefs
+// and backendRefs of routes, certificateRefs of Gateway listeners, and the
+// from and to of ReferenceGrants.
+//
+// Referenced objects are looked up with Renamed by their namespace in the
+// backup, Namespace being the one the item had there. The namespaces of the
+// references to other objects are mapped through Namespaces.
+type GatewayRefs struct {
+	Namespace  string
+	Namespaces map[string]string
+	Renamed    RenameFunc
+}
+
+// Name implements Transformer.
+func (g *GatewayRefs) Name() string {
+	return "gateway-refs"
+}
+
+// Transform implements Transformer.
+func (g *GatewayRefs) Transform(item *unstructured.Unstructured) (*unstructured.Unstructured, error) {
+	gvk := item.GroupVersionKind()
+	if gvk.Group != GatewayGroup {
+		return item, nil
+	}
+	out := item.DeepCopy()
+	namespace := out.GetNamespace()
+	switch {
+	case gatewayRoutes[gvk.Kind]:
+		for _, ref := range list(out.Object, "spec", "parentRefs") {
+			g.mapRef(ref, namespace, GatewayGroup, "Gateway")
+		}
+		for _, rule := range list(out.Object, "spec", "rules") {
+			for _, ref := range list(rule, "backendRefs") {
+				g.mapRef(ref, namespace, "", "Service")
+			}
+			for _, filter := range list(rule, "filters") {
+				g.mapRef(field(filter, "requestMirror", "backendRef"), namespace, "", "Service")
+			}
+		}
+	case gvk.Kind == "Gateway":
+		for _, listener := range list(out.Object, "spec", "listeners") {
+			for _, ref := range list(listener, "tls", "certificateRefs") {
+				g.mapRef(ref, namespace, "", "Secret")
+			}
+		}
+	case gvk.Kind == "ReferenceGrant":
+		for _, from := range list(out.Object, "spec", "from") {
+			mapField(from, "namespace", g.Namespaces)
+		}
+		// the targets of a grant are in its namespace, so only their names
+		// can follow a rename
+		for _, to := range list(out.Object, "spec", "to") {
+			name, _ := field(to, "name").(string)
+			group, _ := field(to, "group").(string)
+			kind, _ := field(to, "kind").(string)
+			if g.Renamed == nil || name == "" {
+				continue
+			}
+			if newNamespace, newName, ok := g.Renamed(group, kind, g.Namespace, name); ok && newNamespace == namespace {
+				to.(map[string]interface{})["name"] = newName
+			}
+		}
+	}
+	return out, nil
+}
+
+// mapRef maps a reference to an object of the given default group and kind,
+// in the namespace of the item unless the reference says otherwise.
+func (g *GatewayRefs) mapRef(value interface{}, namespace, group, kind string) {
+	ref, ok := value.(map[string]interface{})
+	if !ok {
+		return
+	}
+	explicit, hasNamespace := ref["namespace"].(string)
+	oldNamespace := g.Namespace
+	if hasNamespace {
+		oldNamespace = explicit
+	}
+	if name, _ := ref["name"].(string); g.Renamed != nil && name != "" {
+		if value, ok := ref["group"].(string); ok {
+			group = value
+		}
+		if value, ok := ref["kind"].(string); ok {
+			kind = value
+		}
+		if newNamespace, newName, ok := g.Renamed(group, kind, oldNamespace, name); ok {
+			ref["name"] = newName
+			if hasNamespace || newNamespace != namespace {
+				ref["namespace"] = newNamespace
+			}
+			return
+		}
+	}
+	if mapped, ok := g.Namespaces[explicit]; ok && hasNamespace {
+		ref["namespace"] = mapped
+	}
+}
@@ -0,0 +1,124 @@
+package transform
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func gatewayItem(kind, namespace string, spec map[string]interface{}) *unstructured.Unstructured {
+	item := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": GatewayGroup + "/v1",
+		"kind":       kind,
+		"spec":       spec,
+	}}
+	item.SetNamespace(namespace)
+	item.SetName("web")
+	return item
+}
+
+func TestGatewayRefs(t *testing.T) {
+	renames := map[string][2]string{
+		GatewayGroup + "/Gateway/infra/public": {"infra-dr", "public-dr"},
+		"/Service/shop/web-v1":                 {"shop-dr", "web-v1-dr"},
+		"/Service/shop/moved":                  {"elsewhere", "moved"},
+		"/Secret/infra/tls":                    {"infra-dr", "tls-dr"},
+	}
+	gateway := &GatewayRefs{
+		Namespace:  "shop",
+		Namespaces: map[string]string{"shop": "shop-dr", "infra": "infra-dr", "monitoring": "monitoring-dr"},
+		Renamed: func(group, kind, namespace, name string) (string, string, bool) {
+			renamed, ok := renames[group+"/"+kind+"/"+namespace+"/"+name]
+			return renamed[0], renamed[1], ok
+		},
+	}
+
+	route := gatewayItem("HTTPRoute", "shop-dr", map[string]interface{}{
+		"parentRefs": []interface{}{
+			map[string]interface{}{"name": "public", "namespace": "infra"},
+			map[string]interface{}{"name": "internal", "namespace": "infra"},
+		},
+		"rules": []interface{}{
+			map[string]interface{}{
+				"backendRefs": []interface{}{
+					map[string]interface{}{"name": "web-v1", "port": int64(80)},
+					map[string]interface{}{"name": "moved", "port": int64(80)},
+					map[string]interface{}{"name": "web-v1", "kind": "ServiceImport", "group": "multicluster.x-k8s.io"},
+				},
+				"filters": []interface{}{
+					map[string]interface{}{"requestMirror": map[string]interface{}{"backendRef": map[string]interface{}{"name": "mirror", "namespace": "monitoring"}}},
+				},
+			},
+		},
+	})
+	original := route.DeepCopy()
+
+	output, err := gateway.Transform(route)
+	require.NoError(t, err)
+	assert.Equal(t, []interface{}{
+		map[string]interface{}{"name": "public-dr", "namespace": "infra-dr"},
+		map[string]interface{}{"name": "internal", "namespace": "infra-dr"},
+	}, field(output.Object, "spec", "parentRefs"))
+	rule := list(output.Object, "spec", "rules")[0]
+	assert.Equal(t, []interface{}{
+		map[string]interface{}{"name": "web-v1-dr", "port": int64(80)},
+		// a target moved to another namespace gets an explicit one
+		map[string]interface{}{"name": "moved", "namespace": "elsewhere", "port": int64(80)},
+		map[string]interface{}{"name": "web-v1", "kind": "ServiceImport", "group": "multicluster.x-k8s.io"},
+	}, field(rule, "backendRefs"))
+	assert.Equal(t, map[string]interface{}{"name": "mirror", "namespace": "monitoring-dr"}, field(list(rule, "filters")[0], "requestMirror", "backendRef"))
+	assert.Equal(t, original, route)
+
+	gw := gatewayItem("Gateway", "infra-dr", map[string]interface{}{
+		"listeners": []interface{}{
+			map[string]interface{}{"tls": map[string]interface{}{"certificateRefs": []interface{}{
+				map[string]interface{}{"name": "tls", "namespace": "infra"},
+			}}},
+		},
+	})
+	output, err = gateway.Transform(gw)
+	require.NoError(t, err)
+	assert.Equal(t, []interface{}{map[string]interface{}{"name": "tls-dr", "namespace": "infra-dr"}}, list(list(output.Object, "spec", "listeners")[0], "tls", "certificateRefs"))
+
+	grant := gatewayItem("ReferenceGrant", "shop-dr", map[string]interface{}{
+		"from": []interface{}{map[string]interface{}{"group": GatewayGroup, "kind": "HTTPRoute", "namespace": "infra"}},
+		"to": []interface{}{
+			map[string]interface{}{"group": "", "kind": "Service", "name": "web-v1"},
+			// moved out of the grant namespace, the grant cannot follow
+			map[string]interface{}{"group": "", "kind": "Service", "name": "moved"},
+			map[string]interface{}{"group": "", "kind": "Service"},
+		},
+	})
+	output, err = gateway.Transform(grant)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"from": []interface{}{map[string]interface{}{"group": GatewayGroup, "kind": "HTTPRoute", "namespace": "infra-dr"}},
+		"to": []interface{}{
+			map[string]interface{}{"group": "", "kind": "Service", "name": "web-v1-dr"},
+			map[string]interface{}{"group": "", "kind": "Service", "name": "moved"},
+			map[string]interface{}{"group": "", "kind": "Service"},
+		},
+	}, output.Object["spec"])
+
+	// other groups are left alone
+	other := gatewayItem("HTTPRoute", "shop-dr", map[string]interface{}{"parentRefs": []interface{}{map[string]interface{}{"name": "public", "namespace": "infra"}}})
+	other.SetAPIVersion("example.com/v1")
+	output, err = gateway.Transform(other)
+	require.NoError(t, err)
+	assert.Same(t, other, output)
+}
+
+func TestGatewayRefsWithoutRegistry(t *testing.T) {
+	gateway := &GatewayRefs{Namespace: "shop", Namespaces: map[string]string{"infra": "infra-dr"}}
+	route := gatewayItem("TLSRoute", "shop", map[string]interface{}{
+		"parentRefs": []interface{}{map[string]interface{}{"name": "public", "namespace": "infra"}, map[string]interface{}{"name": "local"}},
+	})
+	output, err := gateway.Transform(route)
+	require.NoError(t, err)
+	assert.Equal(t, []interface{}{
+		map[string]interface{}{"name": "public", "namespace": "infra-dr"},
+		map[string]interface{}{"name": "local"},
+	}, field(output.Object, "spec", "parentRefs"))
+}
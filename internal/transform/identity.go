@@ -0,0 +1,74 @@
+package transform
+
+import (
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// IdentityAnnotations bind a ServiceAccount, and the pods running as it, to a
+// cloud identity: IRSA on EKS, workload identity on GKE and Azure.
+var IdentityAnnotations = []string{
+	"eks.amazonaws.com/role-arn",
+	"eks.amazonaws.com/audience",
+	"iam.gke.io/gcp-service-account",
+	"azure.workload.identity/client-id",
+	"azure.workload.identity/tenant-id",
+}
+
+// Identity maps the cloud identities of an item to the ones of the target
+// account or project: the IdentityAnnotations and the audiences of projected
+// service account tokens. Only whole values are mapped.
+type Identity struct {
+	Mapping map[string]string
+}
+
+// Name implements Transformer.
+func (i *Identity) Name() string {
+	return "identity"
+}
+
+// OwnedPaths implements FieldOwner.
+func (i *Identity) OwnedPaths() [][]string {
+	var paths [][]string
+	for _, key := range IdentityAnnotations {
+		paths = append(paths, []string{"metadata", "annotations", key})
+	}
+	for _, path := range podSpecPaths {
+		paths = append(paths, append(append([]string{}, path...), "volumes", "projected", "sources", "serviceAccountToken", "audience"))
+	}
+	return paths
+}
+
+// Transform implements Transformer.
+func (i *Identity) Transform(item *unstructured.Unstructured) (*unstructured.Unstructured, error) {
+	out := item.DeepCopy()
+
+	if annotations := out.GetAnnotations(); annotations != nil {
+		for _, key := range IdentityAnnotations {
+			if mapped, ok := i.Mapping[annotations[key]]; ok {
+				annotations[key] = mapped
+			}
+		}
+		out.SetAnnotations(annotations)
+	}
+
+	for _, path := range podSpecPaths {
+		spec, found, _ := unstructured.NestedFieldNoCopy(out.Object, path...)
+		if !found {
+			continue
+		}
+		for _, volume := range list(spec, "volumes") {
+			for _, source := range list(volume, "projected", "sources") {
+				token, ok := field(source, "serviceAccountToken").(map[string]interface{})
+				if !ok {
+					continue
+				}
+				if audience, ok := token["audience"].(string); ok {
+					if mapped, ok := i.Mapping[audience]; ok {
+						token["audience"] = mapped
+					}
+				}
+			}
+		}
+	}
+	return out, nil
+}
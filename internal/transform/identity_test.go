@@ -0,0 +1,64 @@
+package transform
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestIdentity(t *testing.T) {
+	identity := &Identity{Mapping: map[string]string{
+		"arn:aws:iam::111111111111:role/app":       "arn:aws:iam::222222222222:role/app",
+		"app@prod-project.iam.gserviceaccount.com": "app@dr-project.iam.gserviceaccount.com",
+		"prod-project.svc.id.goog":                 "dr-project.svc.id.goog",
+	}}
+
+	serviceAccount := &unstructured.Unstructured{}
+	serviceAccount.SetKind("ServiceAccount")
+	serviceAccount.SetAnnotations(map[string]string{
+		"eks.amazonaws.com/role-arn":        "arn:aws:iam::111111111111:role/app",
+		"iam.gke.io/gcp-service-account":    "app@prod-project.iam.gserviceaccount.com",
+		"azure.workload.identity/client-id": "unmapped",
+		// only identity annotations are mapped
+		"description": "arn:aws:iam::111111111111:role/app",
+	})
+
+	output, err := identity.Transform(serviceAccount)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"eks.amazonaws.com/role-arn":        "arn:aws:iam::222222222222:role/app",
+		"iam.gke.io/gcp-service-account":    "app@dr-project.iam.gserviceaccount.com",
+		"azure.workload.identity/client-id": "unmapped",
+		"description":                       "arn:aws:iam::111111111111:role/app",
+	}, output.GetAnnotations())
+
+	deployment := &unstructured.Unstructured{Object: map[string]interface{}{
+		"kind": "Deployment",
+		"spec": map[string]interface{}{"template": map[string]interface{}{"spec": map[string]interface{}{
+			"volumes": []interface{}{map[string]interface{}{
+				"name": "token",
+				"projected": map[string]interface{}{"sources": []interface{}{
+					map[string]interface{}{"serviceAccountToken": map[string]interface{}{"audience": "prod-project.svc.id.goog", "path": "token"}},
+					map[string]interface{}{"serviceAccountToken": map[string]interface{}{"audience": "sts.amazonaws.com", "path": "aws"}},
+				}},
+			}},
+		}}},
+	}}
+
+	audiences := func(item *unstructured.Unstructured) []interface{} {
+		var audiences []interface{}
+		for _, volume := range list(item.Object, "spec", "template", "spec", "volumes") {
+			for _, source := range list(volume, "projected", "sources") {
+				audiences = append(audiences, field(source, "serviceAccountToken", "audience"))
+			}
+		}
+		return audiences
+	}
+
+	output, err = identity.Transform(deployment)
+	require.NoError(t, err)
+	assert.Equal(t, []interface{}{"dr-project.svc.id.goog", "sts.amazonaws.com"}, audiences(output))
+	assert.Equal(t, []interface{}{"prod-project.svc.id.goog", "sts.amazonaws.com"}, audiences(deployment))
+}
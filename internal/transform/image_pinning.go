@@ -0,0 +1,145 @@
+package transform
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// ImageDigestsAnnotation holds the digests of the images the containers of a
+// workload ran when it was backed up, a JSON object mapping container names
+// to digests.
+const ImageDigestsAnnotation = "agoracalyce.io/image-digests"
+
+// Pinning modes of ImagePinning.
+const (
+	// PinFloating pins the images referenced by a floating tag, or by no tag.
+	PinFloating = "floating"
+	// PinAll pins every image referenced by a tag.
+	PinAll = "all"
+	// PinNone pins nothing.
+	PinNone = "none"
+)
+
+// ImagePinning makes restored workloads run the images they ran when they
+// were backed up: it pins the image references of containers to the digests
+// recorded in the ImageDigestsAnnotation, which it removes, and sets the
+// imagePullPolicy of the containers. The references keep their tag, and
+// whatever registry the patterns moved them to.
+type ImagePinning struct {
+	// PullPolicy, when set, replaces the imagePullPolicy of every container
+	PullPolicy string
+	Pin        string
+	// FloatingTags are the tags PinFloating pins
+	FloatingTags []string
+	// Strict fails the items whose images to pin have no recorded digest,
+	// instead of warning
+	Strict bool
+	Warn   func(format string, args ...interface{})
+}
+
+// Validate checks the policy.
+func (p *ImagePinning) Validate() error {
+	switch p.Pin {
+	case PinFloating, PinAll, PinNone:
+	default:
+		return fmt.Errorf("unknown pin mode %q, expected one of %s, %s or %s", p.Pin, PinFloating, PinAll, PinNone)
+	}
+	switch p.PullPolicy {
+	case "", "Always", "IfNotPresent", "Never":
+	default:
+		return fmt.Errorf("unknown imagePullPolicy %q", p.PullPolicy)
+	}
+	return nil
+}
+
+// Name implements Transformer.
+func (p *ImagePinning) Name() string {
+	return "image-pinning"
+}
+
+// OwnedPaths implements FieldOwner: the annotation maps container names.
+func (p *ImagePinning) OwnedPaths() [][]string {
+	return [][]string{{"metadata", "annotations", ImageDigestsAnnotation}}
+}
+
+// Transform implements Transformer.
+func (p *ImagePinning) Transform(item *unstructured.Unstructured) (*unstructured.Unstructured, error) {
+	specs := podSpecs(item.Object)
+	if len(specs) == 0 {
+		return item, nil
+	}
+	out := item.DeepCopy()
+	specs = podSpecs(out.Object)
+
+	digests := map[string]string{}
+	annotations := out.GetAnnotations()
+	if value, ok := annotations[ImageDigestsAnnotation]; ok {
+		if err := json.Unmarshal([]byte(value), &digests); err != nil {
+			return nil, fmt.Errorf("invalid %s annotation: %v", ImageDigestsAnnotation, err)
+		}
+		delete(annotations, ImageDigestsAnnotation)
+		out.SetAnnotations(annotations)
+	}
+
+	var missing []string
+	for _, spec := range specs {
+		for _, container := range podContainers(spec) {
+			object := asMap(container)
+			if p.PullPolicy != "" {
+				object["imagePullPolicy"] = p.PullPolicy
+			}
+			image, _ := object["image"].(string)
+			if !p.pins(image) {
+				continue
+			}
+			name, _ := object["name"].(string)
+			digest, ok := digests[name]
+			if !ok {
+				if !slices.Contains(missing, image) {
+					missing = append(missing, image)
+				}
+				continue
+			}
+			object["image"] = image + "@" + digest
+		}
+	}
+	if len(missing) > 0 {
+		if p.Strict {
+			return nil, fmt.Errorf("no digest was recorded at backup time for %s", strings.Join(missing, ", "))
+		}
+		if p.Warn != nil {
+			p.Warn("Not pinning %s of %s %s/%s: no digest was recorded at backup time", strings.Join(missing, ", "), out.GetKind(), out.GetNamespace(), out.GetName())
+		}
+	}
+	return out, nil
+}
+
+// pins reports whether an image reference is to be pinned.
+func (p *ImagePinning) pins(image string) bool {
+	if image == "" || strings.Contains(image, "@") {
+		return false
+	}
+	tag, tagged := ImageTag(image)
+	switch p.Pin {
+	case PinAll:
+		return true
+	case PinFloating:
+		return !tagged || slices.Contains(p.FloatingTags, tag)
+	default:
+		return false
+	}
+}
+
+// ImageTag returns the tag of an image reference without digest, and whether
+// it has one: registry.example.com:5000/web has none.
+func ImageTag(image string) (string, bool) {
+	name := image[strings.LastIndex(image, "/")+1:]
+	if i := strings.LastIndex(name, ":"); i >= 0 {
+		return name[i+1:], true
+	}
+	return "", false
+}
@@ -0,0 +1,102 @@
+package transform
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func pinnedDeployment(digests string, images ...string) *unstructured.Unstructured {
+	var containers []interface{}
+	for i, image := range images {
+		containers = append(containers, map[string]interface{}{"name": []string{"web", "proxy", "metrics"}[i], "image": image})
+	}
+	metadata := map[string]interface{}{"name": "web", "namespace": "shop"}
+	if digests != "" {
+		metadata["annotations"] = map[string]interface{}{ImageDigestsAnnotation: digests, "team": "shop"}
+	}
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "apps/v1",
+		"kind":       "Deployment",
+		"metadata":   metadata,
+		"spec": map[string]interface{}{"template": map[string]interface{}{"spec": map[string]interface{}{
+			"initContainers": []interface{}{map[string]interface{}{"name": "init", "image": "busybox"}},
+			"containers":     containers,
+		}}},
+	}}
+}
+
+func TestImagePinning(t *testing.T) {
+	transformer := &ImagePinning{Pin: PinFloating, FloatingTags: []string{"latest"}, PullPolicy: "IfNotPresent"}
+	require.NoError(t, transformer.Validate())
+
+	item := pinnedDeployment(`{"init": "sha256:0", "web": "sha256:1", "proxy": "sha256:2", "metrics": "sha256:3"}`,
+		"registry.example.com:5000/web:latest", "envoy:v1.29", "registry.example.com:5000/metrics")
+	out, err := transformer.Transform(item)
+	require.NoError(t, err)
+
+	spec := podSpecOf(out)
+	assert.Equal(t, "busybox@sha256:0", field(list(spec, "initContainers")[0], "image"))
+	containers := list(spec, "containers")
+	assert.Equal(t, "registry.example.com:5000/web:latest@sha256:1", field(containers[0], "image"))
+	assert.Equal(t, "envoy:v1.29", field(containers[1], "image"))
+	assert.Equal(t, "registry.example.com:5000/metrics@sha256:3", field(containers[2], "image"))
+	for _, container := range podContainers(spec) {
+		assert.Equal(t, "IfNotPresent", field(container, "imagePullPolicy"))
+	}
+	assert.Equal(t, map[string]string{"team": "shop"}, out.GetAnnotations())
+	// the item itself is left alone
+	assert.Equal(t, "busybox", field(list(podSpecOf(item), "initContainers")[0], "image"))
+
+	transformer.Pin = PinAll
+	out, err = transformer.Transform(item)
+	require.NoError(t, err)
+	assert.Equal(t, "envoy:v1.29@sha256:2", field(list(podSpecOf(out), "containers")[1], "image"))
+
+	transformer.Pin = PinNone
+	out, err = transformer.Transform(item)
+	require.NoError(t, err)
+	assert.Equal(t, "registry.example.com:5000/web:latest", field(list(podSpecOf(out), "containers")[0], "image"))
+}
+
+func TestImagePinning_Missing(t *testing.T) {
+	var warnings []string
+	transformer := &ImagePinning{Pin: PinAll, Warn: func(format string, args ...interface{}) { warnings = append(warnings, format) }}
+	item := pinnedDeployment(`{"web": "sha256:1"}`, "web:1.0", "envoy@sha256:2", "metrics:1.0")
+
+	out, err := transformer.Transform(item)
+	require.NoError(t, err)
+	containers := list(podSpecOf(out), "containers")
+	assert.Equal(t, "web:1.0@sha256:1", field(containers[0], "image"))
+	assert.Equal(t, "envoy@sha256:2", field(containers[1], "image"))
+	assert.Equal(t, "metrics:1.0", field(containers[2], "image"))
+	assert.Len(t, warnings, 1)
+
+	transformer.Strict = true
+	_, err = transformer.Transform(item)
+	assert.ErrorContains(t, err, "busybox, metrics:1.0")
+
+	_, err = transformer.Transform(pinnedDeployment("not json", "web:1.0"))
+	assert.Error(t, err)
+}
+
+func TestImagePinning_Validate(t *testing.T) {
+	assert.Error(t, (&ImagePinning{Pin: "latest"}).Validate())
+	assert.Error(t, (&ImagePinning{Pin: PinAll, PullPolicy: "Sometimes"}).Validate())
+	assert.NoError(t, (&ImagePinning{Pin: PinNone, PullPolicy: "Never"}).Validate())
+}
+
+func TestImageTag(t *testing.T) {
+	for image, expected := range map[string]string{
+		"web":                               "",
+		"web:1.0":                           "1.0",
+		"registry.example.com:5000/web":     "",
+		"registry.example.com:5000/web:dev": "dev",
+	} {
+		tag, tagged := ImageTag(image)
+		assert.Equal(t, expected, tag, image)
+		assert.Equal(t, expected != "", tagged, image)
+	}
+}
@@ -0,0 +1,150 @@
+package transform
+
+import (
+	"fmt"
+	"strconv"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// Ingress controllers known to IngressAnnotations.
+const (
+	ControllerNginx   = "nginx"
+	ControllerALB     = "alb"
+	ControllerTraefik = "traefik"
+)
+
+// ingressClassAnnotation is the legacy way of setting the class of an Ingress.
+const ingressClassAnnotation = "kubernetes.io/ingress.class"
+
+// controllerPrefixes identify the Ingress annotations of each controller.
+var controllerPrefixes = map[string][]string{
+	ControllerNginx:   {"nginx.ingress.kubernetes.io/"},
+	ControllerALB:     {"alb.ingress.kubernetes.io/"},
+	ControllerTraefik: {"traefik.ingress.kubernetes.io/"},
+}
+
+// ingressSettings lists, per controller-neutral setting, the annotations
+// expressing it. The first annotation of a controller is the one written on
+// translation. Traefik expresses these settings with middlewares, not
+// annotations.
+var ingressSettings = func() map[string]map[string][]settingAnnotation {
+	nginxProtocolDecode, nginxProtocolEncode := valueMap(
+		map[string]string{"http": "HTTP", "https": "HTTPS", "grpc": "GRPC", "grpcs": "GRPCS"},
+		map[string]string{"HTTP": "HTTP", "HTTPS": "HTTPS", "GRPC": "GRPC", "GRPCS": "GRPCS"},
+	)
+	albProtocolDecode, albProtocolEncode := valueMap(
+		map[string]string{"http": "HTTP", "https": "HTTPS"},
+		map[string]string{"HTTP": "HTTP", "HTTPS": "HTTPS"},
+	)
+	nginxRedirectDecode, nginxRedirectEncode := valueMap(
+		map[string]string{"true": "true", "false": "false"},
+		map[string]string{"true": "true", "false": "false"},
+	)
+	// the ALB redirects to the given HTTPS port, and has no way to say false
+	albRedirectDecode := func(value string) (string, bool) {
+		_, err := strconv.Atoi(value)
+		return "true", err == nil
+	}
+	albRedirectEncode := func(neutral string) (string, bool) {
+		return "443", neutral == "true"
+	}
+
+	return map[string]map[string][]settingAnnotation{
+		"backend-protocol": {
+			ControllerNginx: {{key: "nginx.ingress.kubernetes.io/backend-protocol", decode: nginxProtocolDecode, encode: nginxProtocolEncode}},
+			ControllerALB:   {{key: "alb.ingress.kubernetes.io/backend-protocol", decode: albProtocolDecode, encode: albProtocolEncode}},
+		},
+		"source-ranges": {
+			ControllerNginx: {
+				{key: "nginx.ingress.kubernetes.io/whitelist-source-range", decode: verbatim, encode: verbatim},
+				{key: "nginx.ingress.kubernetes.io/allowlist-source-range", decode: verbatim, encode: verbatim},
+			},
+			ControllerALB: {{key: "alb.ingress.kubernetes.io/inbound-cidrs", decode: verbatim, encode: verbatim}},
+		},
+		"ssl-redirect": {
+			ControllerNginx: {{key: "nginx.ingress.kubernetes.io/ssl-redirect", decode: nginxRedirectDecode, encode: nginxRedirectEncode}},
+			ControllerALB:   {{key: "alb.ingress.kubernetes.io/ssl-redirect", decode: albRedirectDecode, encode: albRedirectEncode}},
+		},
+	}
+}()
+
+// IngressAnnotations moves Ingresses from one ingress controller to another:
+// the class, in spec.ingressClassName or in the legacy annotation, is mapped
+// through Classes, and the controller-specific annotations are translated as
+// LoadBalancerAnnotations does for clouds.
+type IngressAnnotations struct {
+	Classes map[string]string
+	From    string
+	To      string
+	Extra   map[string]string
+	Unknown string
+	Warn    func(format string, args ...interface{})
+}
+
+// Validate checks the controllers and the policy.
+func (i *IngressAnnotations) Validate() error {
+	for _, controller := range []string{i.From, i.To} {
+		if _, ok := controllerPrefixes[controller]; !ok && controller != "" {
+			return fmt.Errorf("unknown ingress controller %q", controller)
+		}
+	}
+	if (i.From == "") != (i.To == "") {
+		return fmt.Errorf("from and to go together")
+	}
+	switch i.Unknown {
+	case UnknownKeep, UnknownDrop, UnknownWarn:
+		return nil
+	default:
+		return fmt.Errorf("unknown policy %q for untranslated annotations", i.Unknown)
+	}
+}
+
+// Name implements Transformer.
+func (i *IngressAnnotations) Name() string {
+	return "ingress"
+}
+
+// OwnedPaths implements FieldOwner.
+func (i *IngressAnnotations) OwnedPaths() [][]string {
+	return [][]string{
+		{"spec", "ingressClassName"},
+		{"metadata", "annotations", ingressClassAnnotation},
+	}
+}
+
+// Transform implements Transformer.
+func (i *IngressAnnotations) Transform(item *unstructured.Unstructured) (*unstructured.Unstructured, error) {
+	if item.GetKind() != "Ingress" {
+		return item, nil
+	}
+	out := item.DeepCopy()
+
+	if class, found, _ := unstructured.NestedString(out.Object, "spec", "ingressClassName"); found {
+		if mapped, ok := i.Classes[class]; ok {
+			_ = unstructured.SetNestedField(out.Object, mapped, "spec", "ingressClassName")
+		}
+	}
+	annotations := out.GetAnnotations()
+	if len(annotations) == 0 {
+		return out, nil
+	}
+	if i.From != i.To {
+		annotations = annotationTranslation{
+			settings: ingressSettings,
+			prefixes: controllerPrefixes,
+			from:     i.From,
+			to:       i.To,
+			extra:    i.Extra,
+			unknown:  i.Unknown,
+			warn:     i.Warn,
+		}.translate(out)
+	}
+	if class, ok := annotations[ingressClassAnnotation]; ok {
+		if mapped, ok := i.Classes[class]; ok {
+			annotations[ingressClassAnnotation] = mapped
+		}
+	}
+	out.SetAnnotations(annotations)
+	return out, nil
+}
@@ -0,0 +1,91 @@
+package transform
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func ingress(className string, annotations map[string]string) *unstructured.Unstructured {
+	item := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "networking.k8s.io/v1",
+		"kind":       "Ingress",
+		"metadata":   map[string]interface{}{"name": "web", "namespace": "apps"},
+		"spec":       map[string]interface{}{},
+	}}
+	if className != "" {
+		_ = unstructured.SetNestedField(item.Object, className, "spec", "ingressClassName")
+	}
+	item.SetAnnotations(annotations)
+	return item
+}
+
+func TestIngressAnnotations(t *testing.T) {
+	var warnings []string
+	translation := &IngressAnnotations{
+		Classes: map[string]string{"nginx": "alb", "nginx-internal": "alb-internal"},
+		From:    ControllerNginx,
+		To:      ControllerALB,
+		Extra:   map[string]string{"nginx.ingress.kubernetes.io/proxy-body-size": "example.com/max-body-size"},
+		Unknown: UnknownWarn,
+		Warn:    func(format string, args ...interface{}) { warnings = append(warnings, format) },
+	}
+	require.NoError(t, translation.Validate())
+
+	item := ingress("nginx", map[string]string{
+		"nginx.ingress.kubernetes.io/backend-protocol":       "https",
+		"nginx.ingress.kubernetes.io/whitelist-source-range": "10.0.0.0/8,192.168.0.0/16",
+		"nginx.ingress.kubernetes.io/ssl-redirect":           "true",
+		"nginx.ingress.kubernetes.io/proxy-body-size":        "8m",
+		"nginx.ingress.kubernetes.io/rewrite-target":         "/",
+		"example.com/owner":                                  "team",
+	})
+	original := item.DeepCopy()
+
+	output, err := translation.Transform(item)
+	require.NoError(t, err)
+	assert.Equal(t, "alb", output.Object["spec"].(map[string]interface{})["ingressClassName"])
+	assert.Equal(t, map[string]string{
+		"alb.ingress.kubernetes.io/backend-protocol": "HTTPS",
+		"alb.ingress.kubernetes.io/inbound-cidrs":    "10.0.0.0/8,192.168.0.0/16",
+		"alb.ingress.kubernetes.io/ssl-redirect":     "443",
+		"example.com/max-body-size":                  "8m",
+		"nginx.ingress.kubernetes.io/rewrite-target": "/",
+		"example.com/owner":                          "team",
+	}, output.GetAnnotations())
+	assert.Len(t, warnings, 1)
+	assert.Equal(t, original, item)
+}
+
+func TestIngressAnnotations_LegacyClass(t *testing.T) {
+	translation := &IngressAnnotations{Classes: map[string]string{"traefik": "nginx"}, Unknown: UnknownKeep}
+	require.NoError(t, translation.Validate())
+
+	output, err := translation.Transform(ingress("", map[string]string{
+		ingressClassAnnotation:                             "traefik",
+		"traefik.ingress.kubernetes.io/router.entrypoints": "websecure",
+	}))
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		ingressClassAnnotation:                             "nginx",
+		"traefik.ingress.kubernetes.io/router.entrypoints": "websecure",
+	}, output.GetAnnotations())
+
+	translation = &IngressAnnotations{From: ControllerALB, To: ControllerNginx, Unknown: UnknownDrop}
+	output, err = translation.Transform(ingress("alb", map[string]string{
+		"alb.ingress.kubernetes.io/ssl-redirect":     "443",
+		"alb.ingress.kubernetes.io/target-type":      "ip",
+		"alb.ingress.kubernetes.io/healthcheck-path": "/healthz",
+	}))
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"nginx.ingress.kubernetes.io/ssl-redirect": "true"}, output.GetAnnotations())
+	assert.Equal(t, "alb", output.Object["spec"].(map[string]interface{})["ingressClassName"])
+}
+
+func TestIngressAnnotations_Validate(t *testing.T) {
+	assert.Error(t, (&IngressAnnotations{From: "haproxy", To: ControllerNginx, Unknown: UnknownKeep}).Validate())
+	assert.Error(t, (&IngressAnnotations{From: ControllerNginx, Unknown: UnknownKeep}).Validate())
+	assert.Error(t, (&IngressAnnotations{Unknown: "ignore"}).Validate())
+}
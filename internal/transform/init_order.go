@@ -0,0 +1,124 @@
+package transform
+
+import (
+	"sort"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+const (
+	// InitOrderAnnotation holds the rank of an item in the dependency graph
+	// of the restore: 0 for the items others refer to, 1 for the items
+	// referring to them.
+	InitOrderAnnotation = "agoracalyce.io/init-order"
+	// DependsOnAnnotation lists the Kind/name of the items an item refers to,
+	// in its namespace, comma separated.
+	DependsOnAnnotation = "agoracalyce.io/depends-on"
+)
+
+// dependencyKinds are the kinds other items depend on, ranked 0.
+var dependencyKinds = map[string]bool{"ConfigMap": true, "Secret": true, "Service": true}
+
+// InitOrder stamps the dependencies of restored items for the tools syncing
+// them in order: workloads depend on the ConfigMaps and Secrets their pods
+// mount or read, and Ingresses on their backend Services and TLS Secrets.
+type InitOrder struct {
+	// WaveAnnotations also receive the rank, such as
+	// argocd.argoproj.io/sync-wave
+	WaveAnnotations []string
+	// OnDependencies, when set, is called with the dependencies of each item
+	// depending on others
+	OnDependencies func(item *unstructured.Unstructured, dependencies []string)
+}
+
+// Name implements Transformer.
+func (o *InitOrder) Name() string {
+	return "init-order"
+}
+
+// Transform implements Transformer.
+func (o *InitOrder) Transform(item *unstructured.Unstructured) (*unstructured.Unstructured, error) {
+	dependencies := itemDependencies(item)
+	if len(dependencies) == 0 && !dependencyKinds[item.GetKind()] {
+		return item, nil
+	}
+	out := item.DeepCopy()
+	annotations := out.GetAnnotations()
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+	rank := "0"
+	if len(dependencies) > 0 {
+		rank = "1"
+		annotations[DependsOnAnnotation] = strings.Join(dependencies, ",")
+		if o.OnDependencies != nil {
+			o.OnDependencies(out, dependencies)
+		}
+	}
+	annotations[InitOrderAnnotation] = rank
+	for _, key := range o.WaveAnnotations {
+		annotations[key] = rank
+	}
+	out.SetAnnotations(annotations)
+	return out, nil
+}
+
+// itemDependencies returns the sorted Kind/name of the items an item refers to
+// in its namespace.
+func itemDependencies(item *unstructured.Unstructured) []string {
+	found := make(map[string]bool)
+	add := func(kind string, name interface{}) {
+		if name, ok := name.(string); ok && name != "" {
+			found[kind+"/"+name] = true
+		}
+	}
+
+	for _, spec := range podSpecs(item.Object) {
+		for _, volume := range list(spec, "volumes") {
+			add("ConfigMap", field(volume, "configMap", "name"))
+			add("Secret", field(volume, "secret", "secretName"))
+			for _, source := range list(volume, "projected", "sources") {
+				add("ConfigMap", field(source, "configMap", "name"))
+				add("Secret", field(source, "secret", "name"))
+			}
+		}
+		for _, container := range podContainers(spec) {
+			for _, env := range list(container, "env") {
+				add("ConfigMap", field(env, "valueFrom", "configMapKeyRef", "name"))
+				add("Secret", field(env, "valueFrom", "secretKeyRef", "name"))
+			}
+			for _, source := range list(container, "envFrom") {
+				add("ConfigMap", field(source, "configMapRef", "name"))
+				add("Secret", field(source, "secretRef", "name"))
+			}
+		}
+		for _, secret := range list(spec, "imagePullSecrets") {
+			add("Secret", field(secret, "name"))
+		}
+	}
+
+	if item.GetKind() == "Ingress" {
+		backends := []interface{}{field(item.Object, "spec", "defaultBackend"), field(item.Object, "spec", "backend")}
+		for _, rule := range list(item.Object, "spec", "rules") {
+			for _, path := range list(rule, "http", "paths") {
+				backends = append(backends, field(path, "backend"))
+			}
+		}
+		for _, backend := range backends {
+			add("Service", field(backend, "service", "name"))
+			// extensions/v1beta1 and networking.k8s.io/v1beta1
+			add("Service", field(backend, "serviceName"))
+		}
+		for _, tls := range list(item.Object, "spec", "tls") {
+			add("Secret", field(tls, "secretName"))
+		}
+	}
+
+	dependencies := make([]string, 0, len(found))
+	for dependency := range found {
+		dependencies = append(dependencies, dependency)
+	}
+	sort.Strings(dependencies)
+	return dependencies
+}
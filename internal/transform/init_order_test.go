@@ -0,0 +1,98 @@
+package transform
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestInitOrder(t *testing.T) {
+	var recorded map[string][]string
+	transformer := &InitOrder{
+		WaveAnnotations: []string{"argocd.argoproj.io/sync-wave"},
+		OnDependencies: func(item *unstructured.Unstructured, dependencies []string) {
+			recorded[item.GetName()] = dependencies
+		},
+	}
+
+	deployment := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "apps/v1",
+		"kind":       "Deployment",
+		"metadata":   map[string]interface{}{"name": "web", "namespace": "shop", "annotations": map[string]interface{}{"team": "shop"}},
+		"spec": map[string]interface{}{"template": map[string]interface{}{"spec": map[string]interface{}{
+			"imagePullSecrets": []interface{}{map[string]interface{}{"name": "registry"}},
+			"volumes": []interface{}{
+				map[string]interface{}{"name": "config", "configMap": map[string]interface{}{"name": "web-config"}},
+				map[string]interface{}{"name": "tls", "secret": map[string]interface{}{"secretName": "web-tls"}},
+				map[string]interface{}{"name": "all", "projected": map[string]interface{}{"sources": []interface{}{
+					map[string]interface{}{"configMap": map[string]interface{}{"name": "web-config"}},
+					map[string]interface{}{"secret": map[string]interface{}{"name": "web-token"}},
+				}}},
+				map[string]interface{}{"name": "cache", "emptyDir": map[string]interface{}{}},
+			},
+			"initContainers": []interface{}{map[string]interface{}{
+				"name":    "migrate",
+				"envFrom": []interface{}{map[string]interface{}{"secretRef": map[string]interface{}{"name": "db"}}},
+			}},
+			"containers": []interface{}{map[string]interface{}{
+				"name": "web",
+				"env": []interface{}{
+					map[string]interface{}{"name": "MODE", "valueFrom": map[string]interface{}{"configMapKeyRef": map[string]interface{}{"name": "flags", "key": "mode"}}},
+					map[string]interface{}{"name": "HOST", "valueFrom": map[string]interface{}{"fieldRef": map[string]interface{}{"fieldPath": "status.podIP"}}},
+				},
+			}},
+		}}},
+	}}
+	recorded = map[string][]string{}
+	out, err := transformer.Transform(deployment)
+	require.NoError(t, err)
+	expected := []string{"ConfigMap/flags", "ConfigMap/web-config", "Secret/db", "Secret/registry", "Secret/web-tls", "Secret/web-token"}
+	assert.Equal(t, map[string]string{
+		"team":                         "shop",
+		InitOrderAnnotation:            "1",
+		DependsOnAnnotation:            "ConfigMap/flags,ConfigMap/web-config,Secret/db,Secret/registry,Secret/web-tls,Secret/web-token",
+		"argocd.argoproj.io/sync-wave": "1",
+	}, out.GetAnnotations())
+	assert.Equal(t, map[string][]string{"web": expected}, recorded)
+	assert.Equal(t, map[string]string{"team": "shop"}, deployment.GetAnnotations(), "the item itself is left alone")
+
+	ingress := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "networking.k8s.io/v1",
+		"kind":       "Ingress",
+		"metadata":   map[string]interface{}{"name": "web", "namespace": "shop"},
+		"spec": map[string]interface{}{
+			"defaultBackend": map[string]interface{}{"service": map[string]interface{}{"name": "fallback"}},
+			"tls":            []interface{}{map[string]interface{}{"secretName": "web-tls"}},
+			"rules": []interface{}{map[string]interface{}{"http": map[string]interface{}{"paths": []interface{}{
+				map[string]interface{}{"backend": map[string]interface{}{"service": map[string]interface{}{"name": "web"}}},
+				map[string]interface{}{"backend": map[string]interface{}{"resource": map[string]interface{}{"kind": "StorageBucket", "name": "static"}}},
+			}}}},
+		},
+	}}
+	recorded = map[string][]string{}
+	out, err = transformer.Transform(ingress)
+	require.NoError(t, err)
+	assert.Equal(t, "Secret/web-tls,Service/fallback,Service/web", out.GetAnnotations()[DependsOnAnnotation])
+	assert.Len(t, recorded, 1)
+
+	// the items others depend on come first
+	configMap := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "ConfigMap",
+		"metadata":   map[string]interface{}{"name": "web-config", "namespace": "shop"},
+	}}
+	out, err = transformer.Transform(configMap)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{InitOrderAnnotation: "0", "argocd.argoproj.io/sync-wave": "0"}, out.GetAnnotations())
+
+	role := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "rbac.authorization.k8s.io/v1",
+		"kind":       "Role",
+		"metadata":   map[string]interface{}{"name": "web", "namespace": "shop"},
+	}}
+	out, err = transformer.Transform(role)
+	require.NoError(t, err)
+	assert.Same(t, role, out)
+}
@@ -0,0 +1,78 @@
+package transform
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/itchyny/gojq"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// jqTimeout bounds the run of a jq filter on one item: filters such as
+// repeat never end.
+const jqTimeout = 5 * time.Second
+
+// JQ runs the item through a jq filter and restores its output, for the
+// transformations the structured transformers cannot express. The filter must
+// output a single object. It has no access to the environment.
+type JQ struct {
+	Code *gojq.Code
+}
+
+// NewJQ parses and compiles a jq filter.
+func NewJQ(filter string) (*JQ, error) {
+	query, err := gojq.Parse(filter)
+	if err != nil {
+		return nil, fmt.Errorf("invalid jq filter: %v", err)
+	}
+	code, err := gojq.Compile(query)
+	if err != nil {
+		return nil, fmt.Errorf("invalid jq filter: %v", err)
+	}
+	return &JQ{Code: code}, nil
+}
+
+// Name implements Transformer.
+func (j *JQ) Name() string {
+	return "jq"
+}
+
+// Transform implements Transformer.
+func (j *JQ) Transform(item *unstructured.Unstructured) (*unstructured.Unstructured, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), jqTimeout)
+	defer cancel()
+
+	// gojq normalizes the numbers of its input in place
+	iter := j.Code.RunWithContext(ctx, item.DeepCopy().Object)
+	result, ok := iter.Next()
+	if !ok {
+		return nil, fmt.Errorf("the jq filter output nothing")
+	}
+	if err, ok := result.(error); ok {
+		return nil, fmt.Errorf("jq filter failed: %v", err)
+	}
+	if next, ok := iter.Next(); ok {
+		if err, ok := next.(error); ok {
+			return nil, fmt.Errorf("jq filter failed: %v", err)
+		}
+		return nil, fmt.Errorf("the jq filter output several values")
+	}
+
+	// numbers are decoded as in unstructured objects
+	data, err := json.Marshal(result)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode the jq output: %v", err)
+	}
+	content, err := ReplaceStream(bytes.NewReader(data), keep)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode the jq output: %v", err)
+	}
+	object, ok := content.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("the jq filter output a %T, not an object", content)
+	}
+	return &unstructured.Unstructured{Object: object}, nil
+}
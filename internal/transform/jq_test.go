@@ -0,0 +1,51 @@
+package transform
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestJQ_Transform(t *testing.T) {
+	jq, err := NewJQ(`
+		.spec.replicas |= (if . > 2 then 2 else . end)
+		| .spec.template.spec.containers |= map(select(.name != "debug"))
+		| .metadata.labels["restored-port"] = (.spec.template.spec.containers[0].ports[0].containerPort + 1000 | tostring)`)
+	require.NoError(t, err)
+
+	deployment := &unstructured.Unstructured{Object: map[string]interface{}{
+		"kind":     "Deployment",
+		"metadata": map[string]interface{}{"name": "web"},
+		"spec": map[string]interface{}{
+			"replicas": int64(5),
+			"template": map[string]interface{}{"spec": map[string]interface{}{"containers": []interface{}{
+				map[string]interface{}{"name": "web", "ports": []interface{}{map[string]interface{}{"containerPort": int64(8080)}}},
+				map[string]interface{}{"name": "debug"},
+			}}},
+		},
+	}}
+	out, err := jq.Transform(deployment)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), out.Object["spec"].(map[string]interface{})["replicas"])
+	assert.Equal(t, map[string]string{"restored-port": "9080"}, out.GetLabels())
+	containers, _, _ := unstructured.NestedSlice(out.Object, "spec", "template", "spec", "containers")
+	assert.Len(t, containers, 1)
+	assert.Equal(t, int64(5), deployment.Object["spec"].(map[string]interface{})["replicas"], "input must be left untouched")
+}
+
+func TestJQ_Errors(t *testing.T) {
+	_, err := NewJQ(".spec |")
+	assert.Error(t, err)
+
+	item := &unstructured.Unstructured{Object: map[string]interface{}{"kind": "ConfigMap", "data": map[string]interface{}{"a": "b"}}}
+	for _, filter := range []string{"empty", ".data[]", ".data.a", `error("refused")`, "$ENV.HOME", ".data, ."} {
+		jq, err := NewJQ(filter)
+		if err != nil {
+			continue
+		}
+		_, err = jq.Transform(item)
+		assert.Error(t, err, filter)
+	}
+}
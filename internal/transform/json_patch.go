@@ -0,0 +1,79 @@
+package transform
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	jsonpatch "github.com/evanphx/json-patch"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// JSONPatch applies an RFC 6902 JSON Patch to the item, for structural edits
+// such as removing a nodeSelector. A patch that does not apply to an item,
+// because a path it operates on is missing or one of its test operations
+// fails, leaves the item unchanged: test operations guard the patch.
+type JSONPatch struct {
+	Patch jsonpatch.Patch
+}
+
+// jsonPatchValueOps are the operations taking a value.
+var jsonPatchValueOps = map[string]bool{"add": true, "replace": true, "test": true}
+
+// NewJSONPatch decodes and validates a JSON Patch document.
+func NewJSONPatch(document []byte) (*JSONPatch, error) {
+	patch, err := jsonpatch.DecodePatch(document)
+	if err != nil {
+		return nil, fmt.Errorf("invalid JSON patch: %v", err)
+	}
+	for i, op := range patch {
+		switch kind := op.Kind(); kind {
+		case "add", "remove", "replace", "test":
+		case "move", "copy":
+			if _, err := op.From(); err != nil {
+				return nil, fmt.Errorf("operation %d: %s without from", i, kind)
+			}
+		default:
+			return nil, fmt.Errorf("operation %d: unknown op %q", i, kind)
+		}
+		if _, err := op.Path(); err != nil {
+			return nil, fmt.Errorf("operation %d: %s without path", i, op.Kind())
+		}
+		if _, ok := op["value"]; jsonPatchValueOps[op.Kind()] && !ok {
+			return nil, fmt.Errorf("operation %d: %s without value", i, op.Kind())
+		}
+	}
+	return &JSONPatch{Patch: patch}, nil
+}
+
+// Name implements Transformer.
+func (j *JSONPatch) Name() string {
+	return "json-patch"
+}
+
+// Transform implements Transformer.
+func (j *JSONPatch) Transform(item *unstructured.Unstructured) (*unstructured.Unstructured, error) {
+	document, err := json.Marshal(item.Object)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode item: %v", err)
+	}
+	patched, err := j.Patch.Apply(document)
+	if errors.Is(err, jsonpatch.ErrMissing) || errors.Is(err, jsonpatch.ErrTestFailed) || errors.Is(err, jsonpatch.ErrInvalidIndex) {
+		return item, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to apply JSON patch: %v", err)
+	}
+
+	// numbers are decoded as in unstructured objects
+	content, err := ReplaceStream(bytes.NewReader(patched), keep)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode patched item: %v", err)
+	}
+	object, ok := content.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("the patch replaced the item with a %T", content)
+	}
+	return &unstructured.Unstructured{Object: object}, nil
+}
@@ -0,0 +1,55 @@
+package transform
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestJSONPatch_Transform(t *testing.T) {
+	patch, err := NewJSONPatch([]byte(`[
+		{"op": "remove", "path": "/spec/nodeSelector"},
+		{"op": "add", "path": "/metadata/annotations/example.com~1patched", "value": "true"},
+		{"op": "add", "path": "/spec/tolerations/-", "value": {"key": "dr", "operator": "Exists"}}
+	]`))
+	require.NoError(t, err)
+
+	pod := &unstructured.Unstructured{Object: map[string]interface{}{
+		"kind":     "Pod",
+		"metadata": map[string]interface{}{"name": "web", "annotations": map[string]interface{}{}},
+		"spec": map[string]interface{}{
+			"nodeSelector":                  map[string]interface{}{"pool": "prod"},
+			"tolerations":                   []interface{}{},
+			"terminationGracePeriodSeconds": int64(30),
+		},
+	}}
+	out, err := patch.Transform(pod)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"tolerations":                   []interface{}{map[string]interface{}{"key": "dr", "operator": "Exists"}},
+		"terminationGracePeriodSeconds": int64(30),
+	}, out.Object["spec"])
+	assert.Equal(t, map[string]string{"example.com/patched": "true"}, out.GetAnnotations())
+	assert.Contains(t, pod.Object["spec"], "nodeSelector", "input must be left untouched")
+
+	// a patch that does not apply leaves the item unchanged
+	out, err = patch.Transform(out)
+	require.NoError(t, err)
+	assert.NotContains(t, out.Object["spec"], "nodeSelector")
+	assert.Len(t, out.Object["spec"].(map[string]interface{})["tolerations"], 1)
+}
+
+func TestNewJSONPatch_Invalid(t *testing.T) {
+	for _, document := range []string{
+		`{"op": "remove", "path": "/spec"}`,
+		`[{"op": "delete", "path": "/spec"}]`,
+		`[{"op": "remove"}]`,
+		`[{"op": "add", "path": "/spec/replicas"}]`,
+		`[{"op": "move", "path": "/spec/replicas"}]`,
+	} {
+		_, err := NewJSONPatch([]byte(document))
+		assert.Error(t, err, document)
+	}
+}
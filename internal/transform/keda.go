@@ -0,0 +1,100 @@
+package transform
+
+import (
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// KEDA points the triggers of restored KEDA ScaledObjects and ScaledJobs, and
+// the Vault of TriggerAuthentications, to the endpoints of the target
+// environment. Endpoints are mapped by host:port, or by host keeping the port,
+// in URLs, in comma-separated lists such as Kafka brokers, and in bare values.
+type KEDA struct {
+	Endpoints map[string]string
+}
+
+// Name implements Transformer.
+func (k *KEDA) Name() string {
+	return "keda"
+}
+
+// OwnedPaths implements FieldOwner.
+func (k *KEDA) OwnedPaths() [][]string {
+	return [][]string{
+		{"spec", "triggers", "metadata"},
+		{"spec", "hashiCorpVault", "address"},
+	}
+}
+
+// Transform implements Transformer.
+func (k *KEDA) Transform(item *unstructured.Unstructured) (*unstructured.Unstructured, error) {
+	out := item.DeepCopy()
+	switch out.GetKind() {
+	case "ScaledObject", "ScaledJob":
+		for _, trigger := range list(out.Object, "spec", "triggers") {
+			metadata, ok := field(trigger, "metadata").(map[string]interface{})
+			if !ok {
+				continue
+			}
+			for key, value := range metadata {
+				if s, ok := value.(string); ok {
+					metadata[key] = MapEndpoints(s, k.Endpoints)
+				}
+			}
+		}
+	case "TriggerAuthentication", "ClusterTriggerAuthentication":
+		vault, _ := field(out.Object, "spec", "hashiCorpVault").(map[string]interface{})
+		if address, ok := vault["address"].(string); ok {
+			vault["address"] = MapEndpoints(address, k.Endpoints)
+		}
+	}
+	return out, nil
+}
+
+// MapEndpoints maps the hosts of a comma-separated list of endpoints, each a
+// URL or a host with an optional port. A mapping for host:port takes
+// precedence over one for the host alone, which keeps the port.
+func MapEndpoints(value string, mapping map[string]string) string {
+	if len(mapping) == 0 {
+		return value
+	}
+	endpoints := strings.Split(value, ",")
+	for i, endpoint := range endpoints {
+		endpoints[i] = mapEndpoint(endpoint, mapping)
+	}
+	return strings.Join(endpoints, ",")
+}
+
+func mapEndpoint(endpoint string, mapping map[string]string) string {
+	start := 0
+	if i := strings.Index(endpoint, "://"); i >= 0 {
+		start = i + len("://")
+	}
+	end := len(endpoint)
+	if i := strings.IndexAny(endpoint[start:], "/?#"); i >= 0 {
+		end = start + i
+	}
+	if i := strings.LastIndex(endpoint[start:end], "@"); i >= 0 {
+		start += i + 1
+	}
+	hostPort := strings.TrimSpace(endpoint[start:end])
+	if hostPort == "" {
+		return endpoint
+	}
+	// keep the surrounding spaces of list entries
+	start += strings.Index(endpoint[start:end], hostPort)
+	end = start + len(hostPort)
+
+	if mapped, ok := mapping[hostPort]; ok {
+		return endpoint[:start] + mapped + endpoint[end:]
+	}
+	host, port := hostPort, ""
+	if i := strings.LastIndex(hostPort, ":"); i >= 0 && !strings.Contains(hostPort[i:], "]") {
+		host, port = hostPort[:i], hostPort[i:]
+	}
+	if mapped, ok := mapping[host]; ok {
+		return endpoint[:start] + mapped + port + endpoint[end:]
+	}
+	return endpoint
+}
@@ -0,0 +1,196 @@
+package transform
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+const (
+	knativeServingGroup = "serving.knative.dev"
+	// knativeAutoscalingPrefix prefixes the autoscaling annotations of
+	// Knative revision templates.
+	knativeAutoscalingPrefix = "autoscaling.knative.dev/"
+	// knativeDomainConfig is the ConfigMap of Knative Serving whose keys are
+	// the domains routes are published under.
+	knativeDomainConfig = "config-domain"
+)
+
+// generatedRevision matches the revision names Knative generates for a
+// Service, from its name and the generation of its configuration.
+var generatedRevision = regexp.MustCompile(`^(.+)-[0-9]{5}$`)
+
+// Knative adapts Knative Serving resources to the target environment.
+//
+// Domains are mapped by suffix, on whole labels, in the names of
+// DomainMappings and the keys of the config-domain ConfigMap. Registries are
+// mapped by prefix, on whole path segments, in the images of Service
+// revision templates, whose autoscaling annotations are set from Autoscaling,
+// an empty value removing the annotation.
+//
+// Revision names do not survive a restore: Knative generates them again from
+// generation 1. Traffic targets pinned to generated revisions are merged into
+// one target following the latest revision, and a desired revision name that
+// no longer starts with the Service name is dropped.
+type Knative struct {
+	Domains     map[string]string
+	Registries  map[string]string
+	Autoscaling map[string]string
+	Warn        func(format string, args ...interface{})
+}
+
+// Validate checks that Autoscaling only holds autoscaling annotations.
+func (k *Knative) Validate() error {
+	for key := range k.Autoscaling {
+		if !strings.HasPrefix(key, knativeAutoscalingPrefix) {
+			return fmt.Errorf("annotation %s is not an autoscaling annotation (%s*)", key, knativeAutoscalingPrefix)
+		}
+	}
+	return nil
+}
+
+// Name implements Transformer.
+func (k *Knative) Name() string {
+	return "knative"
+}
+
+// Transform implements Transformer.
+func (k *Knative) Transform(item *unstructured.Unstructured) (*unstructured.Unstructured, error) {
+	gvk := item.GroupVersionKind()
+	switch {
+	case gvk.Group == knativeServingGroup && gvk.Kind == "Service":
+		out := item.DeepCopy()
+		k.service(out)
+		return out, nil
+	case gvk.Group == knativeServingGroup && gvk.Kind == "DomainMapping":
+		out := item.DeepCopy()
+		out.SetName(k.mapDomain(out.GetName()))
+		return out, nil
+	case gvk.Group == "" && gvk.Kind == "ConfigMap" && item.GetName() == knativeDomainConfig:
+		out := item.DeepCopy()
+		if data, ok := field(out.Object, "data").(map[string]interface{}); ok {
+			mapped := make(map[string]interface{}, len(data))
+			for domain, value := range data {
+				mapped[k.mapDomain(domain)] = value
+			}
+			out.Object["data"] = mapped
+		}
+		return out, nil
+	default:
+		return item, nil
+	}
+}
+
+func (k *Knative) service(out *unstructured.Unstructured) {
+	name := out.GetName()
+
+	if revision, found, _ := unstructured.NestedString(out.Object, "spec", "template", "metadata", "name"); found && !strings.HasPrefix(revision, name+"-") {
+		k.warn("Dropping the revision name %s of Knative Service %s/%s, it must start with the Service name", revision, out.GetNamespace(), name)
+		unstructured.RemoveNestedField(out.Object, "spec", "template", "metadata", "name")
+	}
+
+	for _, container := range list(out.Object, "spec", "template", "spec", "containers") {
+		if object, ok := container.(map[string]interface{}); ok {
+			if image, ok := object["image"].(string); ok {
+				object["image"] = k.mapImage(image)
+			}
+		}
+	}
+
+	if len(k.Autoscaling) > 0 {
+		annotations, _, _ := unstructured.NestedStringMap(out.Object, "spec", "template", "metadata", "annotations")
+		if annotations == nil {
+			annotations = make(map[string]string)
+		}
+		for key, value := range k.Autoscaling {
+			if value == "" {
+				delete(annotations, key)
+			} else {
+				annotations[key] = value
+			}
+		}
+		if len(annotations) == 0 {
+			unstructured.RemoveNestedField(out.Object, "spec", "template", "metadata", "annotations")
+		} else {
+			_ = unstructured.SetNestedStringMap(out.Object, annotations, "spec", "template", "metadata", "annotations")
+		}
+	}
+
+	k.traffic(out, name)
+}
+
+// traffic merges the targets pinned to generated revisions into one target
+// following the latest revision, keeping the first tag.
+func (k *Knative) traffic(out *unstructured.Unstructured, name string) {
+	targets := list(out.Object, "spec", "traffic")
+	if len(targets) == 0 {
+		return
+	}
+	kept := make([]interface{}, 0, len(targets))
+	var latest map[string]interface{}
+	for _, target := range targets {
+		object, ok := target.(map[string]interface{})
+		if !ok {
+			kept = append(kept, target)
+			continue
+		}
+		revision, _ := object["revisionName"].(string)
+		match := generatedRevision.FindStringSubmatch(revision)
+		if latestRevision, _ := object["latestRevision"].(bool); !latestRevision && (match == nil || match[1] != name) {
+			kept = append(kept, target)
+			continue
+		}
+		if latest == nil {
+			latest = map[string]interface{}{"latestRevision": true, "percent": int64(0)}
+			kept = append(kept, latest)
+		}
+		if revision != "" {
+			k.warn("Knative Service %s/%s: traffic to the generated revision %s now follows the latest revision", out.GetNamespace(), name, revision)
+		}
+		if tag, ok := object["tag"]; ok && latest["tag"] == nil {
+			latest["tag"] = tag
+		}
+		if percent, ok := object["percent"].(int64); ok {
+			latest["percent"] = latest["percent"].(int64) + percent
+		}
+	}
+	out.Object["spec"].(map[string]interface{})["traffic"] = kept
+}
+
+// mapDomain maps the longest suffix of domain found in Domains, on whole
+// labels.
+func (k *Knative) mapDomain(domain string) string {
+	longest := ""
+	for suffix := range k.Domains {
+		if len(suffix) > len(longest) && (domain == suffix || strings.HasSuffix(domain, "."+suffix)) {
+			longest = suffix
+		}
+	}
+	if longest == "" {
+		return domain
+	}
+	return strings.TrimSuffix(domain, longest) + k.Domains[longest]
+}
+
+// mapImage maps the longest prefix of image found in Registries, on whole
+// path segments.
+func (k *Knative) mapImage(image string) string {
+	longest := ""
+	for prefix := range k.Registries {
+		if len(prefix) > len(longest) && strings.HasPrefix(image, strings.TrimSuffix(prefix, "/")+"/") {
+			longest = prefix
+		}
+	}
+	if longest == "" {
+		return image
+	}
+	return strings.TrimSuffix(k.Registries[longest], "/") + image[len(strings.TrimSuffix(longest, "/")):]
+}
+
+func (k *Knative) warn(format string, args ...interface{}) {
+	if k.Warn != nil {
+		k.Warn(format, args...)
+	}
+}
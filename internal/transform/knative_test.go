@@ -0,0 +1,128 @@
+package transform
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func testKnative() *Knative {
+	return &Knative{
+		Domains:     map[string]string{"example.com": "dr.example.com", "shop.example.com": "shop.example.net"},
+		Registries:  map[string]string{"111111111111.dkr.ecr.us-east-1.amazonaws.com": "222222222222.dkr.ecr.eu-west-1.amazonaws.com"},
+		Autoscaling: map[string]string{"autoscaling.knative.dev/max-scale": "3", "autoscaling.knative.dev/min-scale": ""},
+	}
+}
+
+func knativeService(revision string, traffic ...interface{}) *unstructured.Unstructured {
+	service := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "serving.knative.dev/v1",
+		"kind":       "Service",
+		"metadata":   map[string]interface{}{"name": "hello", "namespace": "apps"},
+		"spec": map[string]interface{}{
+			"template": map[string]interface{}{
+				"metadata": map[string]interface{}{"annotations": map[string]interface{}{
+					"autoscaling.knative.dev/min-scale": "1",
+					"autoscaling.knative.dev/target":    "100",
+				}},
+				"spec": map[string]interface{}{"containers": []interface{}{
+					map[string]interface{}{"image": "111111111111.dkr.ecr.us-east-1.amazonaws.com/hello:v2"},
+				}},
+			},
+		},
+	}}
+	if revision != "" {
+		_ = unstructured.SetNestedField(service.Object, revision, "spec", "template", "metadata", "name")
+	}
+	if traffic != nil {
+		service.Object["spec"].(map[string]interface{})["traffic"] = traffic
+	}
+	return service
+}
+
+func TestKnative_Service(t *testing.T) {
+	service := knativeService("hello-v2",
+		map[string]interface{}{"revisionName": "hello-00003", "percent": int64(20), "tag": "previous"},
+		map[string]interface{}{"revisionName": "hello-v2", "percent": int64(50)},
+		map[string]interface{}{"latestRevision": true, "percent": int64(30)},
+	)
+	original := service.DeepCopy()
+
+	output, err := testKnative().Transform(service)
+	require.NoError(t, err)
+	template := field(output.Object, "spec", "template").(map[string]interface{})
+	assert.Equal(t, map[string]interface{}{
+		"name": "hello-v2",
+		"annotations": map[string]interface{}{
+			"autoscaling.knative.dev/max-scale": "3",
+			"autoscaling.knative.dev/target":    "100",
+		},
+	}, template["metadata"])
+	assert.Equal(t, "222222222222.dkr.ecr.eu-west-1.amazonaws.com/hello:v2", field(list(template, "spec", "containers")[0], "image"))
+	assert.Equal(t, []interface{}{
+		map[string]interface{}{"latestRevision": true, "percent": int64(50), "tag": "previous"},
+		map[string]interface{}{"revisionName": "hello-v2", "percent": int64(50)},
+	}, field(output.Object, "spec", "traffic"))
+	assert.Equal(t, original, service)
+}
+
+func TestKnative_RevisionName(t *testing.T) {
+	var warnings []string
+	knative := testKnative()
+	knative.Warn = func(format string, args ...interface{}) { warnings = append(warnings, format) }
+
+	// the Service was renamed, its desired revision name was not
+	service := knativeService("goodbye-v2")
+	output, err := knative.Transform(service)
+	require.NoError(t, err)
+	_, found, _ := unstructured.NestedString(output.Object, "spec", "template", "metadata", "name")
+	assert.False(t, found)
+	assert.Len(t, warnings, 1)
+}
+
+func TestKnative_Domains(t *testing.T) {
+	for domain, expected := range map[string]string{
+		"api.example.com":      "api.dr.example.com",
+		"example.com":          "dr.example.com",
+		"www.shop.example.com": "www.shop.example.net",
+		"notexample.com":       "notexample.com",
+	} {
+		mapping := &unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": "serving.knative.dev/v1beta1",
+			"kind":       "DomainMapping",
+			"metadata":   map[string]interface{}{"name": domain, "namespace": "apps"},
+		}}
+		output, err := testKnative().Transform(mapping)
+		require.NoError(t, err)
+		assert.Equal(t, expected, output.GetName(), domain)
+	}
+
+	config := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "ConfigMap",
+		"metadata":   map[string]interface{}{"name": knativeDomainConfig, "namespace": "knative-serving"},
+		"data":       map[string]interface{}{"example.com": "", "internal.local": "selector:\n  visibility: cluster-local\n"},
+	}}
+	output, err := testKnative().Transform(config)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"dr.example.com": "", "internal.local": "selector:\n  visibility: cluster-local\n"}, output.Object["data"])
+}
+
+func TestKnative_CoreService(t *testing.T) {
+	service := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "Service",
+		"metadata":   map[string]interface{}{"name": "hello"},
+		"spec":       map[string]interface{}{"template": map[string]interface{}{"metadata": map[string]interface{}{"name": "other"}}},
+	}}
+	output, err := testKnative().Transform(service)
+	require.NoError(t, err)
+	assert.Equal(t, service, output)
+}
+
+func TestKnative_Validate(t *testing.T) {
+	assert.NoError(t, testKnative().Validate())
+	assert.Error(t, (&Knative{Autoscaling: map[string]string{"example.com/max-scale": "3"}}).Validate())
+}
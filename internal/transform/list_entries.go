@@ -0,0 +1,128 @@
+package transform
+
+import (
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// ListRule rewrites the entries of the lists found at Path that match it.
+// Scalar entries are matched on their value with Match, object entries on
+// some of their fields with MatchFields. Matched entries are replaced by
+// Replace (scalars), get the fields of Set merged in (objects), or are removed.
+type ListRule struct {
+	// Path leads to the lists, as object keys from the root. Lists met on the
+	// way are walked entry by entry.
+	Path        []string
+	Match       *string
+	MatchFields map[string]string
+	Replace     interface{}
+	Set         map[string]interface{}
+	Remove      bool
+}
+
+// Validate checks that the rule matches and does one thing.
+func (r ListRule) Validate() error {
+	if len(r.Path) == 0 {
+		return fmt.Errorf("path is required")
+	}
+	switch {
+	case r.Match != nil && r.MatchFields != nil:
+		return fmt.Errorf("match and matchFields are exclusive")
+	case r.Match == nil && len(r.MatchFields) == 0:
+		return fmt.Errorf("one of match or matchFields is required")
+	case r.Remove && (r.Replace != nil || r.Set != nil):
+		return fmt.Errorf("remove excludes replace and set")
+	case r.Match != nil && !r.Remove && r.Replace == nil:
+		return fmt.Errorf("match requires replace or remove")
+	case r.MatchFields != nil && !r.Remove && len(r.Set) == 0:
+		return fmt.Errorf("matchFields requires set or remove")
+	}
+	return nil
+}
+
+func (r ListRule) matches(entry interface{}) bool {
+	if r.Match != nil {
+		value, ok := entry.(string)
+		return ok && value == *r.Match
+	}
+	object, ok := entry.(map[string]interface{})
+	if !ok {
+		return false
+	}
+	for field, expected := range r.MatchFields {
+		value, ok := object[field]
+		if !ok || fmt.Sprint(value) != expected {
+			return false
+		}
+	}
+	return true
+}
+
+// ListEntries applies list rules, in order. The order of the entries left in a
+// list is always preserved.
+type ListEntries struct {
+	Rules []ListRule
+}
+
+// Name implements Transformer.
+func (l *ListEntries) Name() string {
+	return "list-entries"
+}
+
+// Transform implements Transformer.
+func (l *ListEntries) Transform(item *unstructured.Unstructured) (*unstructured.Unstructured, error) {
+	out := item.DeepCopy()
+	for _, rule := range l.Rules {
+		applyListRule(out.Object, rule.Path, rule)
+	}
+	return out, nil
+}
+
+// applyListRule walks value down path and rewrites the list it leads to.
+func applyListRule(value interface{}, path []string, rule ListRule) interface{} {
+	switch v := value.(type) {
+	case []interface{}:
+		if len(path) == 0 {
+			return rewriteList(v, rule)
+		}
+		for i, entry := range v {
+			v[i] = applyListRule(entry, path, rule)
+		}
+		return v
+	case map[string]interface{}:
+		if len(path) == 0 {
+			return v
+		}
+		if child, ok := v[path[0]]; ok {
+			v[path[0]] = applyListRule(child, path[1:], rule)
+		}
+		return v
+	default:
+		return value
+	}
+}
+
+func rewriteList(list []interface{}, rule ListRule) []interface{} {
+	out := list[:0]
+	for _, entry := range list {
+		if !rule.matches(entry) {
+			out = append(out, entry)
+			continue
+		}
+		switch {
+		case rule.Remove:
+			continue
+		case rule.Match != nil:
+			entry = runtime.DeepCopyJSONValue(rule.Replace)
+		default:
+			object := entry.(map[string]interface{})
+			for field, value := range rule.Set {
+				object[field] = runtime.DeepCopyJSONValue(value)
+			}
+		}
+		out = append(out, entry)
+	}
+	return out
+}
@@ -0,0 +1,89 @@
+package transform
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func stringPtr(s string) *string {
+	return &s
+}
+
+func TestListEntries(t *testing.T) {
+	item := &unstructured.Unstructured{Object: map[string]interface{}{
+		"kind": "VirtualService",
+		"spec": map[string]interface{}{
+			"hosts": []interface{}{"a.example.com", "old.example.com", "b.example.com", "old.example.com"},
+			"http": []interface{}{
+				map[string]interface{}{"name": "primary", "route": []interface{}{
+					map[string]interface{}{"destination": map[string]interface{}{"host": "web", "port": int64(80)}},
+					map[string]interface{}{"destination": map[string]interface{}{"host": "legacy", "port": int64(80)}},
+				}},
+				map[string]interface{}{"name": "canary", "timeout": "1s"},
+			},
+		},
+	}}
+	original := item.DeepCopy()
+
+	lists := &ListEntries{Rules: []ListRule{
+		{Path: []string{"spec", "hosts"}, Match: stringPtr("old.example.com"), Replace: "new.example.com"},
+		{Path: []string{"spec", "http"}, MatchFields: map[string]string{"name": "canary"}, Set: map[string]interface{}{"timeout": "5s"}},
+		// lists on the way are walked
+		{Path: []string{"spec", "http", "route"}, MatchFields: map[string]string{"destination": "map[host:legacy port:80]"}, Remove: true},
+	}}
+	for _, rule := range lists.Rules {
+		require.NoError(t, rule.Validate())
+	}
+
+	output, err := lists.Transform(item)
+	require.NoError(t, err)
+	assert.Equal(t, []interface{}{"a.example.com", "new.example.com", "b.example.com", "new.example.com"}, field(output.Object, "spec", "hosts"))
+	http := list(output.Object, "spec", "http")
+	assert.Equal(t, map[string]interface{}{"name": "canary", "timeout": "5s"}, http[1])
+	assert.Equal(t, []interface{}{
+		map[string]interface{}{"destination": map[string]interface{}{"host": "web", "port": int64(80)}},
+	}, field(http[0], "route"))
+	assert.Equal(t, original, item)
+}
+
+func TestListEntries_LargeList(t *testing.T) {
+	const size = 20000
+	entries := make([]interface{}, size)
+	for i := range entries {
+		entries[i] = map[string]interface{}{"name": fmt.Sprintf("entry-%d", i), "enabled": i%2 == 0}
+	}
+	item := &unstructured.Unstructured{Object: map[string]interface{}{"spec": map[string]interface{}{"entries": entries}}}
+
+	lists := &ListEntries{Rules: []ListRule{
+		{Path: []string{"spec", "entries"}, MatchFields: map[string]string{"enabled": "false"}, Remove: true},
+		{Path: []string{"spec", "entries"}, MatchFields: map[string]string{"name": "entry-1000"}, Set: map[string]interface{}{"primary": true}},
+	}}
+	output, err := lists.Transform(item)
+	require.NoError(t, err)
+
+	kept := list(output.Object, "spec", "entries")
+	require.Len(t, kept, size/2)
+	for i, entry := range kept {
+		// order is preserved
+		assert.Equal(t, fmt.Sprintf("entry-%d", 2*i), field(entry, "name"))
+	}
+	assert.Equal(t, true, field(kept[500], "primary"))
+	assert.Len(t, list(item.Object, "spec", "entries"), size)
+}
+
+func TestListRule_Validate(t *testing.T) {
+	for name, rule := range map[string]ListRule{
+		"no path":        {Match: stringPtr("x"), Replace: "y"},
+		"no match":       {Path: []string{"a"}, Remove: true},
+		"both matches":   {Path: []string{"a"}, Match: stringPtr("x"), MatchFields: map[string]string{"a": "b"}, Remove: true},
+		"nothing to do":  {Path: []string{"a"}, Match: stringPtr("x")},
+		"remove and set": {Path: []string{"a"}, MatchFields: map[string]string{"a": "b"}, Set: map[string]interface{}{"c": "d"}, Remove: true},
+		"fields, no set": {Path: []string{"a"}, MatchFields: map[string]string{"a": "b"}},
+	} {
+		assert.Error(t, rule.Validate(), name)
+	}
+}
@@ -0,0 +1,235 @@
+package transform
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/wrkt/velero-custom-plugins/internal/lru"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// Literal replaces every occurrence of each pattern with its replacement, in
+// every string of the item, object keys and the decoded data of Secrets
+// included. The patterns apply in PatternOrder.
+type Literal struct {
+	Patterns map[string]string
+	// OnHit, when set, is called with the number of occurrences replaced each
+	// time a pattern matches a string.
+	OnHit func(pattern string, count int)
+	// Protected lists the paths (object keys from the root) whose subtrees,
+	// keys included, are never rewritten.
+	Protected [][]string
+	// Paths, when set, restricts the rewrites to the fields they select.
+	Paths []FieldPath
+	// Excluded lists strings never rewritten, even inside a match.
+	Excluded []string
+	// ValuesOnly leaves object keys alone, rewriting string values only.
+	ValuesOnly bool
+	// Options changes how the patterns it lists match.
+	Options map[string]MatchOptions
+}
+
+// MatchOptions change how a literal pattern matches.
+type MatchOptions struct {
+	// IgnoreCase matches the pattern whatever the case of its letters.
+	IgnoreCase bool
+	// WholeWord only matches the pattern neither preceded nor followed by a
+	// letter, a digit or an underscore.
+	WholeWord bool
+}
+
+// Name implements Transformer.
+func (l *Literal) Name() string {
+	return "literal"
+}
+
+// Transform implements Transformer.
+func (l *Literal) Transform(item *unstructured.Unstructured) (*unstructured.Unstructured, error) {
+	replace := func(onHit func(pattern string, count int)) StringFunc {
+		return Excluding(l.Excluded, func(token string) string {
+			for _, pattern := range PatternOrder(l.Patterns) {
+				var count int
+				token, count = ReplaceLiteral(token, pattern, l.Patterns[pattern], l.Options[pattern])
+				if count == 0 {
+					continue
+				}
+				if onHit != nil {
+					onHit(pattern, count)
+				}
+			}
+			return token
+		})
+	}
+	fn, key := replace(l.OnHit), keyFunc(replace(l.OnHit), l.ValuesOnly)
+	content := replaceItem(item.Object, l.Paths, l.Protected, documentAware(fn, key, replace(nil)), key)
+	return &unstructured.Unstructured{Object: content}, nil
+}
+
+// ReplaceLiteral replaces the matches of pattern in s with replacement, as is
+// whatever the case of the match, and returns the number of matches.
+func ReplaceLiteral(s, pattern, replacement string, options MatchOptions) (string, int) {
+	if pattern == "" {
+		return s, 0
+	}
+	if options == (MatchOptions{}) {
+		count := strings.Count(s, pattern)
+		if count == 0 {
+			return s, 0
+		}
+		return strings.ReplaceAll(s, pattern, replacement), count
+	}
+	var b strings.Builder
+	count, offset := 0, 0
+	for {
+		start, end := IndexLiteral(s, offset, pattern, options)
+		if start < 0 {
+			break
+		}
+		b.WriteString(s[offset:start])
+		b.WriteString(replacement)
+		offset = end
+		count++
+	}
+	if count == 0 {
+		return s, 0
+	}
+	b.WriteString(s[offset:])
+	return b.String(), count
+}
+
+// IndexLiteral returns the bounds of the first match of pattern in s from
+// offset on, -1 when there is none. Ignoring case, a match may not have the
+// length of the pattern.
+func IndexLiteral(s string, offset int, pattern string, options MatchOptions) (start, end int) {
+	for offset <= len(s) {
+		if options.IgnoreCase {
+			loc := foldedPattern(pattern).FindStringIndex(s[offset:])
+			if loc == nil {
+				return -1, -1
+			}
+			start, end = offset+loc[0], offset+loc[1]
+		} else {
+			i := strings.Index(s[offset:], pattern)
+			if i < 0 {
+				return -1, -1
+			}
+			start, end = offset+i, offset+i+len(pattern)
+		}
+		if !options.WholeWord || (!wordBefore(s, start) && !wordAfter(s, end)) {
+			return start, end
+		}
+		// a match inside a word may hide one starting in it
+		_, size := utf8.DecodeRuneInString(s[start:])
+		offset = start + size
+	}
+	return -1, -1
+}
+
+// cacheSize bounds foldedPatterns: patterns change with the rules over the
+// life of the process.
+const cacheSize = 1024
+
+// foldedPatterns caches the case-insensitive expressions of the patterns.
+var foldedPatterns = lru.New[string, *regexp.Regexp](cacheSize)
+
+func foldedPattern(pattern string) *regexp.Regexp {
+	if cached, ok := foldedPatterns.Get(pattern); ok {
+		return cached
+	}
+	re := regexp.MustCompile("(?i)" + regexp.QuoteMeta(pattern))
+	foldedPatterns.Add(pattern, re)
+	return re
+}
+
+// wordBefore reports whether a word character ends s[:i].
+func wordBefore(s string, i int) bool {
+	r, size := utf8.DecodeLastRuneInString(s[:i])
+	return size > 0 && isWordRune(r)
+}
+
+// wordAfter reports whether a word character starts s[i:].
+func wordAfter(s string, i int) bool {
+	r, size := utf8.DecodeRuneInString(s[i:])
+	return size > 0 && isWordRune(r)
+}
+
+func isWordRune(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// Excluding returns fn applied to the parts of a string around the
+// occurrences of the excluded strings, which are kept as they are: a pattern
+// matching across an excluded string does not apply. At a position, the
+// longest excluded string wins.
+func Excluding(excluded []string, fn StringFunc) StringFunc {
+	if len(excluded) == 0 {
+		return fn
+	}
+	ordered := make(map[string]string, len(excluded))
+	for _, s := range excluded {
+		ordered[s] = s
+	}
+	longestFirst := PatternOrder(ordered)
+	return func(s string) string {
+		var b strings.Builder
+		start := 0
+		for i := 0; i < len(s); {
+			match := ""
+			for _, candidate := range longestFirst {
+				if strings.HasPrefix(s[i:], candidate) {
+					match = candidate
+					break
+				}
+			}
+			if match == "" {
+				i++
+				continue
+			}
+			if start < i {
+				b.WriteString(fn(s[start:i]))
+			}
+			b.WriteString(match)
+			i += len(match)
+			start = i
+		}
+		if start == 0 {
+			return fn(s)
+		}
+		if start < len(s) {
+			b.WriteString(fn(s[start:]))
+		}
+		return b.String()
+	}
+}
+
+// PatternOrder returns the patterns in the order they apply: the longest
+// first, so that a pattern contained in another does not preempt it, then in
+// lexical order. Empty patterns, which would insert the replacement between
+// every rune, are left out.
+func PatternOrder(patterns map[string]string) []string {
+	ordered := make([]string, 0, len(patterns))
+	for pattern := range patterns {
+		if pattern != "" {
+			ordered = append(ordered, pattern)
+		}
+	}
+	sort.Slice(ordered, func(i, j int) bool {
+		if len(ordered[i]) != len(ordered[j]) {
+			return len(ordered[i]) > len(ordered[j])
+		}
+		return ordered[i] < ordered[j]
+	})
+	return ordered
+}
+
+// keyFunc returns the function rewriting object keys: fn, or none with
+// valuesOnly.
+func keyFunc(fn StringFunc, valuesOnly bool) StringFunc {
+	if valuesOnly {
+		return keep
+	}
+	return fn
+}
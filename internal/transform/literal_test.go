@@ -0,0 +1,170 @@
+package transform
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestLiteral_Transform(t *testing.T) {
+	item := &unstructured.Unstructured{Object: map[string]interface{}{
+		"kind": "Service",
+		"metadata": map[string]interface{}{
+			"name": "foo-production-service",
+		},
+		"spec": map[string]interface{}{
+			"ports": []interface{}{map[string]interface{}{"port": int64(80)}},
+		},
+	}}
+
+	out, err := (&Literal{Patterns: map[string]string{"production": "review-3"}}).Transform(item)
+	require.NoError(t, err)
+
+	assert.Equal(t, "foo-review-3-service", out.GetName())
+	assert.Equal(t, "foo-production-service", item.GetName(), "input must be left untouched")
+	ports, _, _ := unstructured.NestedSlice(out.Object, "spec", "ports")
+	assert.Equal(t, int64(80), ports[0].(map[string]interface{})["port"])
+}
+
+func TestLiteral_OnHit(t *testing.T) {
+	item := &unstructured.Unstructured{Object: map[string]interface{}{
+		"metadata": map[string]interface{}{"name": "foo-foo"},
+		"data":     map[string]interface{}{"foo": "bar"},
+	}}
+
+	hits := map[string]int{}
+	literal := &Literal{
+		Patterns: map[string]string{"foo": "baz", "missing": "x"},
+		OnHit:    func(pattern string, count int) { hits[pattern] += count },
+	}
+	_, err := literal.Transform(item)
+	require.NoError(t, err)
+
+	assert.Equal(t, map[string]int{"foo": 3}, hits)
+}
+
+func TestLiteral_Overlap(t *testing.T) {
+	item := &unstructured.Unstructured{Object: map[string]interface{}{
+		"metadata": map[string]interface{}{"name": "web"},
+		"spec":     map[string]interface{}{"host": "api.example.com", "mirror": "example.com", "alias": "example.co"},
+	}}
+	literal := &Literal{Patterns: map[string]string{
+		"example.com":     "example.org",
+		"api.example.com": "api.dr.example.net",
+		"example.co":      "example.io",
+		"":                "x",
+	}}
+
+	// the order of a map is random: the outcome must not be
+	for i := 0; i < 20; i++ {
+		out, err := literal.Transform(item)
+		require.NoError(t, err)
+		assert.Equal(t, map[string]interface{}{"host": "api.dr.example.net", "mirror": "example.org", "alias": "example.io"}, out.Object["spec"])
+	}
+	assert.Equal(t, []string{"api.example.com", "example.com", "example.co"}, PatternOrder(literal.Patterns))
+}
+
+func TestLiteral_Excluded(t *testing.T) {
+	literal := &Literal{
+		Patterns: map[string]string{"db.example.com": "db.dr.example.com"},
+		Excluded: []string{"--db.example.com-timeout", "db.example.com.internal"},
+	}
+	item := &unstructured.Unstructured{Object: map[string]interface{}{
+		"spec": map[string]interface{}{"args": []interface{}{
+			"--db.example.com-timeout=5s",
+			"--host=db.example.com",
+			"db.example.com.internal,db.example.com",
+		}},
+	}}
+	out, err := literal.Transform(item)
+	require.NoError(t, err)
+	assert.Equal(t, []interface{}{
+		"--db.example.com-timeout=5s",
+		"--host=db.dr.example.com",
+		"db.example.com.internal,db.dr.example.com",
+	}, out.Object["spec"].(map[string]interface{})["args"])
+
+	// the longest excluded string wins, and patterns do not match across one
+	fn := Excluding([]string{"ab", "abc"}, func(s string) string { return "<" + s + ">" })
+	assert.Equal(t, "<x>abc<y>ab", fn("xabcyab"))
+	assert.Equal(t, "<xyz>", fn("xyz"))
+}
+
+func TestLiteral_ValuesOnly(t *testing.T) {
+	literal := &Literal{Patterns: map[string]string{"db": "database"}, ValuesOnly: true}
+	item := &unstructured.Unstructured{Object: map[string]interface{}{
+		"metadata": map[string]interface{}{"labels": map[string]interface{}{"db-role": "db"}},
+		"spec": map[string]interface{}{
+			"dbConfig": map[string]interface{}{"host": "db.example.com"},
+			"env":      []interface{}{map[string]interface{}{"dbName": "shop-db"}},
+		},
+	}}
+	out, err := literal.Transform(item)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"metadata": map[string]interface{}{"labels": map[string]interface{}{"db-role": "database"}},
+		"spec": map[string]interface{}{
+			"dbConfig": map[string]interface{}{"host": "database.example.com"},
+			"env":      []interface{}{map[string]interface{}{"dbName": "shop-database"}},
+		},
+	}, out.Object)
+
+	// so do the fields paths select
+	literal.Paths = []FieldPath{{{Key: "spec"}}}
+	out, err = literal.Transform(item)
+	require.NoError(t, err)
+	assert.Contains(t, out.Object["spec"], "dbConfig")
+	assert.Equal(t, "db", out.Object["metadata"].(map[string]interface{})["labels"].(map[string]interface{})["db-role"])
+
+	assert.Equal(t, map[string]interface{}{"dbConfig": "database"}, ReplaceValues(map[string]interface{}{"dbConfig": "db"}, func(s string) string {
+		return strings.ReplaceAll(s, "db", "database")
+	}))
+}
+
+func TestReplaceLiteral_Options(t *testing.T) {
+	tests := []struct {
+		name    string
+		s       string
+		pattern string
+		options MatchOptions
+		want    string
+		count   int
+	}{
+		{"case sensitive", "PROD.example.com prod.example.com", "prod", MatchOptions{}, "PROD.example.com dr.example.com", 1},
+		{"ignore case", "PROD.example.com Prod.example.com", "prod", MatchOptions{IgnoreCase: true}, "dr.example.com dr.example.com", 2},
+		{"whole word", "db db-primary mydb dbs db_1 db", "db", MatchOptions{WholeWord: true}, "dr dr-primary mydb dbs db_1 dr", 3},
+		{"whole word inside a word", "dbdb db", "db", MatchOptions{WholeWord: true}, "dbdb dr", 1},
+		{"both", "DB.internal adbc Db", "db", MatchOptions{IgnoreCase: true, WholeWord: true}, "dr.internal adbc dr", 2},
+		{"no match", "database", "db", MatchOptions{WholeWord: true}, "database", 0},
+		{"unicode", "ÉTÉ-été", "été", MatchOptions{IgnoreCase: true}, "dr-dr", 2},
+		{"empty pattern", "db", "", MatchOptions{IgnoreCase: true}, "db", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, count := ReplaceLiteral(tt.s, tt.pattern, "dr", tt.options)
+			assert.Equal(t, tt.want, got)
+			assert.Equal(t, tt.count, count)
+		})
+	}
+}
+
+func TestLiteral_Options(t *testing.T) {
+	item := &unstructured.Unstructured{Object: map[string]interface{}{
+		"metadata": map[string]interface{}{"name": "web"},
+		"spec":     map[string]interface{}{"host": "WEB.PROD.example.com", "db": "db-primary.admin-db.svc", "DB_HOST": "mydb"},
+	}}
+
+	hits := map[string]int{}
+	out, err := (&Literal{
+		Patterns: map[string]string{"prod": "dr", "db": "pg"},
+		Options:  map[string]MatchOptions{"prod": {IgnoreCase: true}, "db": {WholeWord: true}},
+		OnHit:    func(pattern string, count int) { hits[pattern] += count },
+	}).Transform(item)
+	require.NoError(t, err)
+
+	assert.Equal(t, map[string]interface{}{"host": "WEB.dr.example.com", "pg": "pg-primary.admin-pg.svc", "DB_HOST": "mydb"}, out.Object["spec"])
+	assert.Equal(t, map[string]int{"prod": 1, "db": 3}, hits)
+}
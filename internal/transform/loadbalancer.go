@@ -0,0 +1,173 @@
+package transform
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// Cloud providers known to LoadBalancerAnnotations.
+const (
+	ProviderAWS   = "aws"
+	ProviderGCP   = "gcp"
+	ProviderAzure = "azure"
+)
+
+// Policies for the provider-specific annotations without a translation.
+const (
+	UnknownKeep = "keep"
+	UnknownDrop = "drop"
+	UnknownWarn = "warn"
+)
+
+// providerPrefixes identify the LoadBalancer annotations of each provider.
+var providerPrefixes = map[string][]string{
+	ProviderAWS:   {"service.beta.kubernetes.io/aws-load-balancer-"},
+	ProviderGCP:   {"networking.gke.io/", "cloud.google.com/"},
+	ProviderAzure: {"service.beta.kubernetes.io/azure-"},
+}
+
+func verbatim(value string) (string, bool) {
+	return value, value != ""
+}
+
+// valueMap decodes through a table of provider values, case-insensitively,
+// and encodes through a table of neutral values.
+func valueMap(decoded, encoded map[string]string) (func(string) (string, bool), func(string) (string, bool)) {
+	decode := func(value string) (string, bool) {
+		neutral, ok := decoded[strings.ToLower(value)]
+		return neutral, ok
+	}
+	encode := func(neutral string) (string, bool) {
+		value, ok := encoded[neutral]
+		return value, ok
+	}
+	return decode, encode
+}
+
+// scaled converts between a provider unit and the neutral one, rounding up.
+func scaled(factor int) (func(string) (string, bool), func(string) (string, bool)) {
+	decode := func(value string) (string, bool) {
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return "", false
+		}
+		return strconv.Itoa(n * factor), true
+	}
+	encode := func(neutral string) (string, bool) {
+		n, err := strconv.Atoi(neutral)
+		if err != nil {
+			return "", false
+		}
+		return strconv.Itoa(int(math.Ceil(float64(n) / float64(factor)))), true
+	}
+	return decode, encode
+}
+
+// lbSettings lists, per provider-neutral setting, the annotations expressing it.
+// The first annotation of a provider is the one written on translation.
+var lbSettings = func() map[string]map[string][]settingAnnotation {
+	awsInternalDecode, awsInternalEncode := valueMap(
+		map[string]string{"true": "true", "0.0.0.0/0": "true", "false": "false"},
+		map[string]string{"true": "true", "false": "false"},
+	)
+	awsSchemeDecode, awsSchemeEncode := valueMap(
+		map[string]string{"internal": "true", "internet-facing": "false"},
+		map[string]string{"true": "internal", "false": "internet-facing"},
+	)
+	gcpTypeDecode, gcpTypeEncode := valueMap(
+		map[string]string{"internal": "true", "external": "false"},
+		map[string]string{"true": "Internal", "false": "External"},
+	)
+	azureInternalDecode, azureInternalEncode := valueMap(
+		map[string]string{"true": "true", "false": "false"},
+		map[string]string{"true": "true", "false": "false"},
+	)
+	seconds, fromSeconds := scaled(1)
+	minutes, fromMinutes := scaled(60)
+
+	return map[string]map[string][]settingAnnotation{
+		"internal": {
+			ProviderAWS: {
+				{key: "service.beta.kubernetes.io/aws-load-balancer-internal", decode: awsInternalDecode, encode: awsInternalEncode},
+				{key: "service.beta.kubernetes.io/aws-load-balancer-scheme", decode: awsSchemeDecode, encode: awsSchemeEncode},
+			},
+			ProviderGCP: {
+				{key: "networking.gke.io/load-balancer-type", decode: gcpTypeDecode, encode: gcpTypeEncode},
+			},
+			ProviderAzure: {
+				{key: "service.beta.kubernetes.io/azure-load-balancer-internal", decode: azureInternalDecode, encode: azureInternalEncode},
+			},
+		},
+		"health-check-path": {
+			ProviderAWS:   {{key: "service.beta.kubernetes.io/aws-load-balancer-healthcheck-path", decode: verbatim, encode: verbatim}},
+			ProviderAzure: {{key: "service.beta.kubernetes.io/azure-load-balancer-health-probe-request-path", decode: verbatim, encode: verbatim}},
+		},
+		"idle-timeout-seconds": {
+			ProviderAWS:   {{key: "service.beta.kubernetes.io/aws-load-balancer-connection-idle-timeout", decode: seconds, encode: fromSeconds}},
+			ProviderAzure: {{key: "service.beta.kubernetes.io/azure-load-balancer-tcp-idle-timeout", decode: minutes, encode: fromMinutes}},
+		},
+	}
+}()
+
+// LoadBalancerAnnotations translates the provider-specific annotations of
+// LoadBalancer Services from one cloud to another. Extra maps source
+// annotation keys to target ones, values being copied as is. The
+// provider-specific annotations without a translation are handled according to
+// Unknown, Warn being called for each one under UnknownWarn.
+type LoadBalancerAnnotations struct {
+	From    string
+	To      string
+	Extra   map[string]string
+	Unknown string
+	Warn    func(format string, args ...interface{})
+}
+
+// Validate checks the providers and the policy.
+func (l *LoadBalancerAnnotations) Validate() error {
+	for _, provider := range []string{l.From, l.To} {
+		if _, ok := providerPrefixes[provider]; !ok {
+			return fmt.Errorf("unknown provider %q", provider)
+		}
+	}
+	switch l.Unknown {
+	case UnknownKeep, UnknownDrop, UnknownWarn:
+		return nil
+	default:
+		return fmt.Errorf("unknown policy %q for untranslated annotations", l.Unknown)
+	}
+}
+
+// Name implements Transformer.
+func (l *LoadBalancerAnnotations) Name() string {
+	return "lb-annotations"
+}
+
+// Transform implements Transformer.
+func (l *LoadBalancerAnnotations) Transform(item *unstructured.Unstructured) (*unstructured.Unstructured, error) {
+	serviceType, _, _ := unstructured.NestedString(item.Object, "spec", "type")
+	if item.GetKind() != "Service" || serviceType != "LoadBalancer" || l.From == l.To {
+		return item, nil
+	}
+	annotations := item.GetAnnotations()
+	if len(annotations) == 0 {
+		return item, nil
+	}
+
+	translated := annotationTranslation{
+		settings: lbSettings,
+		prefixes: providerPrefixes,
+		from:     l.From,
+		to:       l.To,
+		extra:    l.Extra,
+		unknown:  l.Unknown,
+		warn:     l.Warn,
+	}.translate(item)
+
+	out := item.DeepCopy()
+	out.SetAnnotations(translated)
+	return out, nil
+}
@@ -0,0 +1,112 @@
+package transform
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func loadBalancer(serviceType string, annotations map[string]string) *unstructured.Unstructured {
+	item := &unstructured.Unstructured{Object: map[string]interface{}{
+		"kind": "Service",
+		"spec": map[string]interface{}{"type": serviceType},
+	}}
+	item.SetName("web")
+	item.SetAnnotations(annotations)
+	return item
+}
+
+func TestLoadBalancerAnnotations(t *testing.T) {
+	annotations := map[string]string{
+		"service.beta.kubernetes.io/aws-load-balancer-scheme":                  "internal",
+		"service.beta.kubernetes.io/aws-load-balancer-healthcheck-path":        "/healthz",
+		"service.beta.kubernetes.io/aws-load-balancer-connection-idle-timeout": "90",
+		"service.beta.kubernetes.io/aws-load-balancer-proxy-protocol":          "*",
+		"example.com/owner": "web",
+	}
+
+	tests := []struct {
+		to       string
+		unknown  string
+		expected map[string]string
+		warnings int
+	}{
+		{
+			to:      ProviderAzure,
+			unknown: UnknownDrop,
+			expected: map[string]string{
+				"service.beta.kubernetes.io/azure-load-balancer-internal":                  "true",
+				"service.beta.kubernetes.io/azure-load-balancer-health-probe-request-path": "/healthz",
+				"service.beta.kubernetes.io/azure-load-balancer-tcp-idle-timeout":          "2",
+				"example.com/owner": "web",
+			},
+		},
+		{
+			to:      ProviderGCP,
+			unknown: UnknownWarn,
+			expected: map[string]string{
+				"networking.gke.io/load-balancer-type":                                 "Internal",
+				"service.beta.kubernetes.io/aws-load-balancer-healthcheck-path":        "/healthz",
+				"service.beta.kubernetes.io/aws-load-balancer-connection-idle-timeout": "90",
+				"service.beta.kubernetes.io/aws-load-balancer-proxy-protocol":          "*",
+				"example.com/owner": "web",
+			},
+			warnings: 3,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.to, func(t *testing.T) {
+			var warnings []string
+			lb := &LoadBalancerAnnotations{From: ProviderAWS, To: tt.to, Unknown: tt.unknown, Warn: func(format string, args ...interface{}) {
+				warnings = append(warnings, fmt.Sprintf(format, args...))
+			}}
+			require.NoError(t, lb.Validate())
+
+			item := loadBalancer("LoadBalancer", annotations)
+			output, err := lb.Transform(item)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, output.GetAnnotations())
+			assert.Len(t, warnings, tt.warnings)
+			assert.Equal(t, annotations, item.GetAnnotations())
+		})
+	}
+}
+
+func TestLoadBalancerAnnotations_Extra(t *testing.T) {
+	lb := &LoadBalancerAnnotations{From: ProviderGCP, To: ProviderAWS, Unknown: UnknownKeep, Extra: map[string]string{
+		"cloud.google.com/neg": "example.com/neg",
+	}}
+	output, err := lb.Transform(loadBalancer("LoadBalancer", map[string]string{
+		"networking.gke.io/load-balancer-type":                         "External",
+		"cloud.google.com/neg":                                         `{"ingress":true}`,
+		"networking.gke.io/internal-load-balancer-allow-global-access": "true",
+	}))
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"service.beta.kubernetes.io/aws-load-balancer-internal": "false",
+		"example.com/neg": `{"ingress":true}`,
+		"networking.gke.io/internal-load-balancer-allow-global-access": "true",
+	}, output.GetAnnotations())
+}
+
+func TestLoadBalancerAnnotations_Untouched(t *testing.T) {
+	lb := &LoadBalancerAnnotations{From: ProviderAWS, To: ProviderAzure, Unknown: UnknownDrop}
+	annotations := map[string]string{"service.beta.kubernetes.io/aws-load-balancer-internal": "true"}
+
+	for _, item := range []*unstructured.Unstructured{
+		loadBalancer("ClusterIP", annotations),
+		{Object: map[string]interface{}{"kind": "Ingress", "spec": map[string]interface{}{"type": "LoadBalancer"}}},
+	} {
+		output, err := lb.Transform(item)
+		require.NoError(t, err)
+		assert.Same(t, item, output)
+	}
+}
+
+func TestLoadBalancerAnnotations_Validate(t *testing.T) {
+	assert.Error(t, (&LoadBalancerAnnotations{From: "oci", To: ProviderAWS, Unknown: UnknownKeep}).Validate())
+	assert.Error(t, (&LoadBalancerAnnotations{From: ProviderGCP, To: ProviderAWS, Unknown: "ignore"}).Validate())
+}
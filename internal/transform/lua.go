@@ -0,0 +1,213 @@
+package transform
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	lua "github.com/yuin/gopher-lua"
+	"github.com/yuin/gopher-lua/parse"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+const (
+	// luaTimeout bounds the run of a Lua script on one item.
+	luaTimeout = 5 * time.Second
+	// luaMaxDepth bounds the nesting of the tables a script returns, which
+	// may reference themselves.
+	luaMaxDepth = 100
+	// luaFunction is the global function a script defines.
+	luaFunction = "transform"
+)
+
+// Lua runs the item through the transform function of a Lua script and
+// restores the table it returns, for the transformations no declarative
+// syntax covers. The script only has the base, string, table and math
+// libraries, without the functions loading code.
+type Lua struct {
+	Proto *lua.FunctionProto
+}
+
+// NewLua parses and compiles a Lua script.
+func NewLua(script string) (*Lua, error) {
+	chunk, err := parse.Parse(strings.NewReader(script), "script.lua")
+	if err != nil {
+		return nil, fmt.Errorf("invalid Lua script: %v", err)
+	}
+	proto, err := lua.Compile(chunk, "script.lua")
+	if err != nil {
+		return nil, fmt.Errorf("invalid Lua script: %v", err)
+	}
+	return &Lua{Proto: proto}, nil
+}
+
+// Name implements Transformer.
+func (l *Lua) Name() string {
+	return "lua"
+}
+
+// Transform implements Transformer.
+func (l *Lua) Transform(item *unstructured.Unstructured) (*unstructured.Unstructured, error) {
+	// states are not safe for concurrent use: every item gets its own
+	state := newLuaState()
+	defer state.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), luaTimeout)
+	defer cancel()
+	state.SetContext(ctx)
+
+	state.Push(state.NewFunctionFromProto(l.Proto))
+	if err := state.PCall(0, 0, nil); err != nil {
+		return nil, fmt.Errorf("Lua script failed: %v", err)
+	}
+	function, ok := state.GetGlobal(luaFunction).(*lua.LFunction)
+	if !ok {
+		return nil, fmt.Errorf("the Lua script does not define a %s function", luaFunction)
+	}
+
+	// arrays keep their type when empty
+	arrays := state.NewTable()
+	state.Push(function)
+	state.Push(toLua(state, arrays, item.Object))
+	if err := state.PCall(1, 1, nil); err != nil {
+		return nil, fmt.Errorf("Lua script failed: %v", err)
+	}
+	result := state.Get(-1)
+	state.Pop(1)
+
+	table, ok := result.(*lua.LTable)
+	if !ok {
+		return nil, fmt.Errorf("the Lua script returned a %s, not a table", result.Type())
+	}
+	content, err := fromLua(state, arrays, table, 0)
+	if err != nil {
+		return nil, fmt.Errorf("invalid Lua output: %v", err)
+	}
+	object, ok := content.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("the Lua script returned an array, not an object")
+	}
+	return &unstructured.Unstructured{Object: object}, nil
+}
+
+func newLuaState() *lua.LState {
+	state := lua.NewState(lua.Options{SkipOpenLibs: true})
+	for _, lib := range []struct {
+		name string
+		open lua.LGFunction
+	}{
+		{lua.BaseLibName, lua.OpenBase},
+		{lua.TabLibName, lua.OpenTable},
+		{lua.StringLibName, lua.OpenString},
+		{lua.MathLibName, lua.OpenMath},
+	} {
+		state.Push(state.NewFunction(lib.open))
+		state.Push(lua.LString(lib.name))
+		state.Call(1, 0)
+	}
+	for _, name := range []string{"dofile", "loadfile", "load", "loadstring", "module", "require"} {
+		state.SetGlobal(name, lua.LNil)
+	}
+	return state
+}
+
+// toLua converts an unstructured value to Lua. Arrays are 1-based tables
+// whose metatable is arrays.
+func toLua(state *lua.LState, arrays *lua.LTable, value interface{}) lua.LValue {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		table := state.CreateTable(0, len(v))
+		for key, field := range v {
+			table.RawSetString(key, toLua(state, arrays, field))
+		}
+		return table
+	case []interface{}:
+		table := state.CreateTable(len(v), 0)
+		for i, entry := range v {
+			table.RawSetInt(i+1, toLua(state, arrays, entry))
+		}
+		state.SetMetatable(table, arrays)
+		return table
+	case string:
+		return lua.LString(v)
+	case bool:
+		return lua.LBool(v)
+	case int64:
+		return lua.LNumber(v)
+	case float64:
+		return lua.LNumber(v)
+	default:
+		return lua.LNil
+	}
+}
+
+// fromLua converts a Lua value to an unstructured value. Tables are arrays
+// when they come from one or hold a sequence, objects otherwise; integral
+// numbers are integers.
+func fromLua(state *lua.LState, arrays *lua.LTable, value lua.LValue, depth int) (interface{}, error) {
+	switch v := value.(type) {
+	case *lua.LTable:
+		if depth >= luaMaxDepth {
+			return nil, fmt.Errorf("tables nested deeper than %d", luaMaxDepth)
+		}
+		if state.GetMetatable(v) == arrays || isSequence(v) {
+			list := make([]interface{}, 0, v.Len())
+			for i := 1; i <= v.Len(); i++ {
+				entry, err := fromLua(state, arrays, v.RawGetInt(i), depth+1)
+				if err != nil {
+					return nil, err
+				}
+				list = append(list, entry)
+			}
+			return list, nil
+		}
+		object := map[string]interface{}{}
+		var err error
+		v.ForEach(func(key, field lua.LValue) {
+			if err != nil {
+				return
+			}
+			name, ok := key.(lua.LString)
+			if !ok {
+				err = fmt.Errorf("key %s is not a string", key)
+				return
+			}
+			object[string(name)], err = fromLua(state, arrays, field, depth+1)
+		})
+		if err != nil {
+			return nil, err
+		}
+		return object, nil
+	case lua.LString:
+		return string(v), nil
+	case lua.LBool:
+		return bool(v), nil
+	case lua.LNumber:
+		n := float64(v)
+		if math.IsNaN(n) || math.IsInf(n, 0) {
+			return nil, fmt.Errorf("invalid number %v", n)
+		}
+		if n == math.Trunc(n) && math.Abs(n) < 1<<63 {
+			return int64(n), nil
+		}
+		return n, nil
+	case *lua.LNilType:
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("cannot convert a Lua %s", value.Type())
+	}
+}
+
+// isSequence reports whether a table only holds the keys 1 to n, n > 0.
+func isSequence(table *lua.LTable) bool {
+	n := table.Len()
+	if n == 0 {
+		return false
+	}
+	keys := 0
+	table.ForEach(func(key, _ lua.LValue) {
+		keys++
+	})
+	return keys == n
+}
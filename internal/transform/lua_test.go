@@ -0,0 +1,84 @@
+package transform
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestLua_Transform(t *testing.T) {
+	script, err := NewLua(`
+function transform(item)
+  local containers = item.spec.template.spec.containers
+  for i = #containers, 1, -1 do
+    if containers[i].name == "debug" then
+      table.remove(containers, i)
+    end
+  end
+  local port = containers[1].ports[1].containerPort
+  containers[1].ports[1].containerPort = port + 1000
+  if string.sub(item.metadata.name, 1, 4) == "web-" then
+    item.metadata.name = "site-" .. string.sub(item.metadata.name, 5)
+  end
+  item.metadata.labels = {["restored-port"] = tostring(port + 1000)}
+  item.spec.weight = 0.5
+  return item
+end`)
+	require.NoError(t, err)
+
+	deployment := &unstructured.Unstructured{Object: map[string]interface{}{
+		"kind":     "Deployment",
+		"metadata": map[string]interface{}{"name": "web-shop"},
+		"spec": map[string]interface{}{
+			"paused": false,
+			"template": map[string]interface{}{"spec": map[string]interface{}{
+				"volumes": []interface{}{},
+				"containers": []interface{}{
+					map[string]interface{}{"name": "web", "args": []interface{}{}, "ports": []interface{}{map[string]interface{}{"containerPort": int64(8080)}}},
+					map[string]interface{}{"name": "debug"},
+				},
+			}},
+		},
+	}}
+	out, err := script.Transform(deployment)
+	require.NoError(t, err)
+	assert.Equal(t, "site-shop", out.GetName())
+	assert.Equal(t, map[string]string{"restored-port": "9080"}, out.GetLabels())
+	assert.Equal(t, map[string]interface{}{
+		"paused": false,
+		"weight": 0.5,
+		"template": map[string]interface{}{"spec": map[string]interface{}{
+			"volumes": []interface{}{},
+			"containers": []interface{}{
+				map[string]interface{}{"name": "web", "args": []interface{}{}, "ports": []interface{}{map[string]interface{}{"containerPort": int64(9080)}}},
+			},
+		}},
+	}, out.Object["spec"])
+	assert.Equal(t, "web-shop", deployment.GetName(), "input must be left untouched")
+}
+
+func TestLua_Errors(t *testing.T) {
+	_, err := NewLua("function transform(item")
+	assert.Error(t, err)
+
+	item := &unstructured.Unstructured{Object: map[string]interface{}{"kind": "ConfigMap", "data": map[string]interface{}{"a": "b"}}}
+	for _, script := range []string{
+		"local x = 1",
+		"function transform(item) return nil end",
+		"function transform(item) return item.data.a end",
+		"function transform(item) return {item} end",
+		`function transform(item) error("refused") end`,
+		"function transform(item) item.data[1] = 'x' return item end",
+		"function transform(item) item.self = item return item end",
+		"function transform(item) return loadstring('return 1')() end",
+		"function transform(item) return os.exit(1) end",
+		"function transform(item) return dofile('/etc/passwd') end",
+	} {
+		lua, err := NewLua(script)
+		require.NoError(t, err, script)
+		_, err = lua.Transform(item)
+		assert.Error(t, err, script)
+	}
+}
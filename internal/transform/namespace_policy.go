@@ -0,0 +1,115 @@
+package transform
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// NamespacePolicy sets labels and annotations on the restored Namespaces, such
+// as the environment, the cost center or the Pod Security Standards level the
+// target cluster requires. An empty value removes the key.
+type NamespacePolicy struct {
+	Labels      map[string]string
+	Annotations map[string]string
+	// Render, when set, renders the value of each key for the item.
+	Render func(key, value string) (string, error)
+}
+
+// Name implements Transformer.
+func (n *NamespacePolicy) Name() string {
+	return "namespace-policy"
+}
+
+// Validate checks the label and annotation keys. The label values, rendered,
+// are checked on each item.
+func (n *NamespacePolicy) Validate() error {
+	for _, key := range policyKeys(n.Labels) {
+		if errs := validation.IsQualifiedName(key); len(errs) > 0 {
+			return fmt.Errorf("invalid label key %q: %s", key, strings.Join(errs, ", "))
+		}
+	}
+	for _, key := range policyKeys(n.Annotations) {
+		if errs := validation.IsQualifiedName(strings.ToLower(key)); len(errs) > 0 {
+			return fmt.Errorf("invalid annotation key %q: %s", key, strings.Join(errs, ", "))
+		}
+	}
+	return nil
+}
+
+// OwnedPaths implements FieldOwner: the patterns do not rewrite the values the
+// policy sets.
+func (n *NamespacePolicy) OwnedPaths() [][]string {
+	paths := make([][]string, 0, len(n.Labels)+len(n.Annotations))
+	for _, key := range policyKeys(n.Labels) {
+		paths = append(paths, []string{"metadata", "labels", key})
+	}
+	for _, key := range policyKeys(n.Annotations) {
+		paths = append(paths, []string{"metadata", "annotations", key})
+	}
+	return paths
+}
+
+// Transform implements Transformer.
+func (n *NamespacePolicy) Transform(item *unstructured.Unstructured) (*unstructured.Unstructured, error) {
+	if item.GetAPIVersion() != "v1" || item.GetKind() != "Namespace" {
+		return item, nil
+	}
+	labels, err := n.apply(item.GetLabels(), n.Labels)
+	if err != nil {
+		return nil, err
+	}
+	for _, key := range policyKeys(n.Labels) {
+		if errs := validation.IsValidLabelValue(labels[key]); len(errs) > 0 {
+			return nil, fmt.Errorf("invalid value %q of label %s: %s", labels[key], key, strings.Join(errs, ", "))
+		}
+	}
+	annotations, err := n.apply(item.GetAnnotations(), n.Annotations)
+	if err != nil {
+		return nil, err
+	}
+	out := item.DeepCopy()
+	out.SetLabels(labels)
+	out.SetAnnotations(annotations)
+	return out, nil
+}
+
+// apply returns a copy of current with the values of policy rendered and set.
+func (n *NamespacePolicy) apply(current, policy map[string]string) (map[string]string, error) {
+	out := make(map[string]string, len(current)+len(policy))
+	for key, value := range current {
+		out[key] = value
+	}
+	for _, key := range policyKeys(policy) {
+		value := policy[key]
+		if n.Render != nil {
+			rendered, err := n.Render(key, value)
+			if err != nil {
+				return nil, err
+			}
+			value = rendered
+		}
+		if value == "" {
+			delete(out, key)
+			continue
+		}
+		out[key] = value
+	}
+	if len(out) == 0 {
+		return nil, nil
+	}
+	return out, nil
+}
+
+// policyKeys returns the keys of m, sorted.
+func policyKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
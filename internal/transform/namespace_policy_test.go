@@ -0,0 +1,81 @@
+package transform
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestNamespacePolicy_Transform(t *testing.T) {
+	namespace := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "Namespace",
+		"metadata": map[string]interface{}{
+			"name":        "shop",
+			"labels":      map[string]interface{}{"environment": "prod", "team": "web", "backup-only": "true"},
+			"annotations": map[string]interface{}{"owner": "web@example.com"},
+		},
+	}}
+	policy := &NamespacePolicy{
+		Labels: map[string]string{
+			"environment":                        "dr",
+			"pod-security.kubernetes.io/enforce": "restricted",
+			"backup-only":                        "",
+		},
+		Annotations: map[string]string{"cost-center": "CC-1234"},
+	}
+	require.NoError(t, policy.Validate())
+
+	out, err := policy.Transform(namespace)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"environment": "dr", "team": "web", "pod-security.kubernetes.io/enforce": "restricted"}, out.GetLabels())
+	assert.Equal(t, map[string]string{"owner": "web@example.com", "cost-center": "CC-1234"}, out.GetAnnotations())
+	assert.Equal(t, "prod", namespace.GetLabels()["environment"], "input must be left untouched")
+	assert.Contains(t, policy.OwnedPaths(), []string{"metadata", "labels", "environment"})
+
+	configMap := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "ConfigMap",
+		"metadata":   map[string]interface{}{"name": "settings", "namespace": "shop"},
+	}}
+	out, err = policy.Transform(configMap)
+	require.NoError(t, err)
+	assert.Same(t, configMap, out, "other kinds are left alone")
+}
+
+func TestNamespacePolicy_Render(t *testing.T) {
+	namespace := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "Namespace",
+		"metadata":   map[string]interface{}{"name": "shop"},
+	}}
+	policy := &NamespacePolicy{
+		Labels: map[string]string{"environment": "$ENV"},
+		Render: func(_, value string) (string, error) { return strings.ReplaceAll(value, "$ENV", "dr"), nil },
+	}
+	out, err := policy.Transform(namespace)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"environment": "dr"}, out.GetLabels())
+
+	policy.Render = func(_, _ string) (string, error) { return "not a label value!", nil }
+	_, err = policy.Transform(namespace)
+	assert.Error(t, err, "rendered label values are checked")
+
+	policy.Render = func(_, _ string) (string, error) { return "", fmt.Errorf("missing key") }
+	_, err = policy.Transform(namespace)
+	assert.Error(t, err)
+}
+
+func TestNamespacePolicy_Validate(t *testing.T) {
+	for _, invalid := range []*NamespacePolicy{
+		{Labels: map[string]string{"bad key!": "x"}},
+		{Annotations: map[string]string{"a/b/c": "x"}},
+	} {
+		assert.Error(t, invalid.Validate())
+	}
+	assert.NoError(t, (&NamespacePolicy{Labels: map[string]string{"environment": "{{ .Env.ENV }}"}}).Validate(), "values are checked per item")
+}
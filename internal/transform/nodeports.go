@@ -0,0 +1,107 @@
+package transform
+
+import (
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// Policies for the node ports of restored Services.
+const (
+	// NodePortsPreserve keeps the node ports of the backup.
+	NodePortsPreserve = "preserve"
+	// NodePortsClear lets the target cluster assign new node ports.
+	NodePortsClear = "clear"
+	// NodePortsMap maps the node ports through a table, keeping the other
+	// ones.
+	NodePortsMap = "map"
+)
+
+// NodePorts applies the node port policy of restored Services. Before a node
+// port is kept, Claim is asked for it: a port already held by another Service
+// is cleared, and the target cluster assigns a new one.
+type NodePorts struct {
+	Policy  string
+	Mapping map[int64]int64
+	// Claim reserves port for owner, the namespace/name of the Service, and
+	// returns the other Service holding it, if any. A nil Claim grants every
+	// port.
+	Claim func(port int64, owner string) (string, error)
+	Warn  func(format string, args ...interface{})
+}
+
+// Validate checks the policy and the mapping table.
+func (n *NodePorts) Validate() error {
+	switch n.Policy {
+	case NodePortsPreserve, NodePortsClear, NodePortsMap:
+	default:
+		return fmt.Errorf("unknown node port policy %q, expected one of %s, %s or %s", n.Policy, NodePortsPreserve, NodePortsClear, NodePortsMap)
+	}
+	targets := make(map[int64]int64, len(n.Mapping))
+	for from, to := range n.Mapping {
+		if to < 1 || to > 65535 {
+			return fmt.Errorf("invalid node port %d for %d", to, from)
+		}
+		if other, ok := targets[to]; ok {
+			return fmt.Errorf("node ports %d and %d are both mapped to %d", other, from, to)
+		}
+		targets[to] = from
+	}
+	return nil
+}
+
+// Name implements Transformer.
+func (n *NodePorts) Name() string {
+	return "node-ports"
+}
+
+// OwnedPaths implements FieldOwner.
+func (n *NodePorts) OwnedPaths() [][]string {
+	return [][]string{{"spec", "ports", "nodePort"}}
+}
+
+// Transform implements Transformer.
+func (n *NodePorts) Transform(item *unstructured.Unstructured) (*unstructured.Unstructured, error) {
+	gvk := item.GroupVersionKind()
+	if gvk.Group != "" || gvk.Kind != "Service" {
+		return item, nil
+	}
+	out := item.DeepCopy()
+	owner := out.GetNamespace() + "/" + out.GetName()
+	for _, port := range list(out.Object, "spec", "ports") {
+		object, ok := port.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		nodePort, ok := object["nodePort"].(int64)
+		if !ok {
+			continue
+		}
+		if n.Policy == NodePortsClear {
+			delete(object, "nodePort")
+			continue
+		}
+		if mapped, ok := n.Mapping[nodePort]; ok && n.Policy == NodePortsMap {
+			nodePort = mapped
+		}
+		if n.Claim != nil {
+			holder, err := n.Claim(nodePort, owner)
+			if err != nil {
+				return nil, err
+			}
+			if holder != "" {
+				n.warn("Node port %d of Service %s is used by %s in the target cluster, leaving it to the cluster to assign", nodePort, owner, holder)
+				delete(object, "nodePort")
+				continue
+			}
+		}
+		object["nodePort"] = nodePort
+	}
+	return out, nil
+}
+
+func (n *NodePorts) warn(format string, args ...interface{}) {
+	if n.Warn != nil {
+		n.Warn(format, args...)
+	}
+}
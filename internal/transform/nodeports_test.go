@@ -0,0 +1,74 @@
+package transform
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func nodePortService(ports ...int64) *unstructured.Unstructured {
+	var list []interface{}
+	for _, port := range ports {
+		list = append(list, map[string]interface{}{"port": int64(80), "nodePort": port})
+	}
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "Service",
+		"metadata":   map[string]interface{}{"name": "web", "namespace": "apps"},
+		"spec":       map[string]interface{}{"type": "NodePort", "ports": list},
+	}}
+}
+
+func nodePorts(obj *unstructured.Unstructured) []interface{} {
+	var ports []interface{}
+	for _, port := range list(obj.Object, "spec", "ports") {
+		ports = append(ports, field(port, "nodePort"))
+	}
+	return ports
+}
+
+func TestNodePorts(t *testing.T) {
+	claimed := map[int64]string{30002: "other/db"}
+	claim := func(port int64, owner string) (string, error) {
+		if holder, ok := claimed[port]; ok && holder != owner {
+			return holder, nil
+		}
+		claimed[port] = owner
+		return "", nil
+	}
+	var warnings []string
+	warn := func(format string, args ...interface{}) { warnings = append(warnings, format) }
+
+	service := nodePortService(30000, 30001, 30002)
+	original := service.DeepCopy()
+
+	output, err := (&NodePorts{Policy: NodePortsPreserve, Claim: claim, Warn: warn}).Transform(service)
+	require.NoError(t, err)
+	assert.Equal(t, []interface{}{int64(30000), int64(30001), nil}, nodePorts(output))
+	assert.Len(t, warnings, 1)
+	assert.Equal(t, original, service)
+
+	output, err = (&NodePorts{Policy: NodePortsClear}).Transform(service)
+	require.NoError(t, err)
+	assert.Equal(t, []interface{}{nil, nil, nil}, nodePorts(output))
+
+	// the Service already holds its own ports
+	mapping := map[int64]int64{30001: 31001, 30002: 31002}
+	output, err = (&NodePorts{Policy: NodePortsMap, Mapping: mapping, Claim: claim, Warn: warn}).Transform(service)
+	require.NoError(t, err)
+	assert.Equal(t, []interface{}{int64(30000), int64(31001), int64(31002)}, nodePorts(output))
+	assert.Equal(t, "apps/web", claimed[31002])
+
+	_, err = (&NodePorts{Policy: NodePortsPreserve, Claim: func(int64, string) (string, error) { return "", errors.New("boom") }}).Transform(service)
+	assert.Error(t, err)
+}
+
+func TestNodePorts_Validate(t *testing.T) {
+	assert.NoError(t, (&NodePorts{Policy: NodePortsMap, Mapping: map[int64]int64{30000: 31000}}).Validate())
+	assert.Error(t, (&NodePorts{Policy: "keep"}).Validate())
+	assert.Error(t, (&NodePorts{Policy: NodePortsMap, Mapping: map[int64]int64{30000: 70000}}).Validate())
+	assert.Error(t, (&NodePorts{Policy: NodePortsMap, Mapping: map[int64]int64{30000: 31000, 30001: 31000}}).Validate())
+}
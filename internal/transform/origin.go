@@ -0,0 +1,46 @@
+package transform
+
+import (
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// Annotations stamped by the Origin transformer.
+const (
+	OriginalNameAnnotation      = "agoracalyce.io/original-name"
+	OriginalNamespaceAnnotation = "agoracalyce.io/original-namespace"
+	OriginalClusterAnnotation   = "agoracalyce.io/original-cluster"
+)
+
+// Origin stamps items with the identity they had in the backup, so restored
+// objects can be traced back to their source. Empty fields are not stamped.
+type Origin struct {
+	OriginalName      string
+	OriginalNamespace string
+	OriginalCluster   string
+}
+
+// Name implements Transformer.
+func (o *Origin) Name() string {
+	return "origin"
+}
+
+// Transform implements Transformer.
+func (o *Origin) Transform(item *unstructured.Unstructured) (*unstructured.Unstructured, error) {
+	out := item.DeepCopy()
+
+	annotations := out.GetAnnotations()
+	if annotations == nil {
+		annotations = make(map[string]string)
+	}
+	for key, value := range map[string]string{
+		OriginalNameAnnotation:      o.OriginalName,
+		OriginalNamespaceAnnotation: o.OriginalNamespace,
+		OriginalClusterAnnotation:   o.OriginalCluster,
+	} {
+		if value != "" {
+			annotations[key] = value
+		}
+	}
+	out.SetAnnotations(annotations)
+	return out, nil
+}
@@ -0,0 +1,32 @@
+package transform
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestOrigin_Transform(t *testing.T) {
+	item := &unstructured.Unstructured{}
+	item.SetName("foo-review-3")
+	item.SetNamespace("review-3")
+	item.SetAnnotations(map[string]string{"existing": "kept"})
+
+	out, err := (&Origin{OriginalName: "foo-production", OriginalNamespace: "production", OriginalCluster: "prod-eu"}).Transform(item)
+	require.NoError(t, err)
+
+	assert.Equal(t, map[string]string{
+		"existing":                  "kept",
+		OriginalNameAnnotation:      "foo-production",
+		OriginalNamespaceAnnotation: "production",
+		OriginalClusterAnnotation:   "prod-eu",
+	}, out.GetAnnotations())
+	assert.Equal(t, map[string]string{"existing": "kept"}, item.GetAnnotations(), "input must be left untouched")
+
+	// cluster-scoped items from an unknown cluster
+	out, err = (&Origin{OriginalName: "pv-1"}).Transform(&unstructured.Unstructured{Object: map[string]interface{}{}})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{OriginalNameAnnotation: "pv-1"}, out.GetAnnotations())
+}
@@ -0,0 +1,325 @@
+package transform
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// FieldPath selects fields of an item with a subset of the JSONPath syntax:
+// object keys separated by dots, quoted keys in brackets for the keys holding
+// dots (metadata.annotations['example.com/owner']), list indexes ([0]) and
+// every element of a list ([*]).
+type FieldPath []PathSegment
+
+// PathSegment is an object key, or a list index when Index is set. An index of
+// -1 selects every element.
+type PathSegment struct {
+	Key   string
+	Index *int
+}
+
+// String returns the path in the syntax ParseFieldPath reads.
+func (p FieldPath) String() string {
+	var b strings.Builder
+	for i, segment := range p {
+		switch {
+		case segment.Index == nil && isPlainKey(segment.Key):
+			if i > 0 {
+				b.WriteByte('.')
+			}
+			b.WriteString(segment.Key)
+		case segment.Index == nil:
+			fmt.Fprintf(&b, "[%s]", strconv.Quote(segment.Key))
+		case *segment.Index < 0:
+			b.WriteString("[*]")
+		default:
+			fmt.Fprintf(&b, "[%d]", *segment.Index)
+		}
+	}
+	return b.String()
+}
+
+// Values returns the values the path selects in value.
+func (p FieldPath) Values(value interface{}) []interface{} {
+	values := []interface{}{value}
+	for _, segment := range p {
+		var next []interface{}
+		for _, v := range values {
+			switch {
+			case segment.Index == nil:
+				if object, ok := v.(map[string]interface{}); ok {
+					if child, ok := object[segment.Key]; ok {
+						next = append(next, child)
+					}
+				}
+			case *segment.Index < 0:
+				if list, ok := v.([]interface{}); ok {
+					next = append(next, list...)
+				}
+			default:
+				if list, ok := v.([]interface{}); ok && *segment.Index < len(list) {
+					next = append(next, list[*segment.Index])
+				}
+			}
+		}
+		values = next
+	}
+	return values
+}
+
+func isPlainKey(key string) bool {
+	return key != "" && !strings.ContainsAny(key, ".[]'\"*,")
+}
+
+// ParseFieldPaths parses a comma separated list of paths.
+func ParseFieldPaths(list string) ([]FieldPath, error) {
+	var paths []FieldPath
+	depth, start := 0, 0
+	var quote byte
+	for i := 0; i <= len(list); i++ {
+		if i < len(list) {
+			c := list[i]
+			switch {
+			case quote != 0:
+				if c == quote {
+					quote = 0
+				}
+				continue
+			case depth > 0 && (c == '\'' || c == '"'):
+				quote = c
+				continue
+			case c == '[':
+				depth++
+				continue
+			case c == ']':
+				depth--
+				continue
+			case c != ',' || depth > 0:
+				continue
+			}
+		}
+		entry := strings.TrimSpace(list[start:i])
+		start = i + 1
+		if entry == "" {
+			continue
+		}
+		path, err := ParseFieldPath(entry)
+		if err != nil {
+			return nil, err
+		}
+		paths = append(paths, path)
+	}
+	return paths, nil
+}
+
+// ParseFieldPath parses a path such as spec.template.spec.containers[*].image.
+// The kubectl forms, {.spec.replicas} and $.spec.replicas, are accepted too.
+func ParseFieldPath(s string) (FieldPath, error) {
+	expr := strings.TrimSpace(s)
+	if strings.HasPrefix(expr, "{") && strings.HasSuffix(expr, "}") {
+		expr = expr[1 : len(expr)-1]
+	}
+	expr = strings.TrimPrefix(expr, "$")
+	expr = strings.TrimPrefix(expr, ".")
+	if expr == "" {
+		return nil, fmt.Errorf("empty path")
+	}
+
+	var path FieldPath
+	for i := 0; i < len(expr); {
+		switch expr[i] {
+		case '[':
+			segment, length, err := parseBracket(expr[i:])
+			if err != nil {
+				return nil, fmt.Errorf("invalid path %q: %v", s, err)
+			}
+			path = append(path, segment)
+			i += length
+		case '.':
+			i++
+			if i == len(expr) || expr[i] == '.' || expr[i] == '[' {
+				return nil, fmt.Errorf("invalid path %q: empty key", s)
+			}
+		default:
+			end := strings.IndexAny(expr[i:], ".[")
+			if end < 0 {
+				end = len(expr) - i
+			}
+			key := expr[i : i+end]
+			if key == "*" || strings.ContainsAny(key, "]'\"") {
+				return nil, fmt.Errorf("invalid path %q: unsupported key %q", s, key)
+			}
+			path = append(path, PathSegment{Key: key})
+			i += end
+		}
+	}
+	return path, nil
+}
+
+// parseBracket parses the bracket starting s and returns its length.
+func parseBracket(s string) (PathSegment, int, error) {
+	body := s[1:]
+	if trimmed := strings.TrimLeft(body, " "); trimmed != "" && (trimmed[0] == '\'' || trimmed[0] == '"') {
+		offset := len(body) - len(trimmed)
+		quote := trimmed[0]
+		end := strings.IndexByte(trimmed[1:], quote)
+		if end < 0 {
+			return PathSegment{}, 0, fmt.Errorf("unterminated quote")
+		}
+		key := trimmed[1 : 1+end]
+		rest := trimmed[2+end:]
+		closing := strings.IndexByte(rest, ']')
+		if closing < 0 || strings.TrimSpace(rest[:closing]) != "" {
+			return PathSegment{}, 0, fmt.Errorf("expected ] after %q", key)
+		}
+		return PathSegment{Key: key}, 1 + offset + 2 + end + closing + 1, nil
+	}
+
+	end := strings.IndexByte(body, ']')
+	if end < 0 {
+		return PathSegment{}, 0, fmt.Errorf("unterminated [")
+	}
+	inner := strings.TrimSpace(body[:end])
+	index := -1
+	switch {
+	case inner == "*":
+	case strings.HasPrefix(inner, "?"):
+		return PathSegment{}, 0, fmt.Errorf("filter expressions are not supported")
+	case strings.ContainsAny(inner, ":,"):
+		return PathSegment{}, 0, fmt.Errorf("slices and unions are not supported")
+	default:
+		n, err := strconv.Atoi(inner)
+		if err != nil || n < 0 {
+			return PathSegment{}, 0, fmt.Errorf("invalid index %q", inner)
+		}
+		index = n
+	}
+	return PathSegment{Index: &index}, 1 + end + 1, nil
+}
+
+// selection indexes paths by segment, merging those sharing a prefix so that
+// overlapping paths select each field once.
+type selection struct {
+	// end marks a selected subtree
+	end     bool
+	keys    map[string]*selection
+	indexes map[int]*selection
+	all     *selection
+}
+
+func newSelection(paths []FieldPath) *selection {
+	root := &selection{}
+	for _, path := range paths {
+		node := root
+		for _, segment := range path {
+			node = node.child(segment)
+		}
+		node.end = true
+	}
+	return root
+}
+
+func (s *selection) child(segment PathSegment) *selection {
+	switch {
+	case segment.Index == nil:
+		if s.keys == nil {
+			s.keys = make(map[string]*selection)
+		}
+		if s.keys[segment.Key] == nil {
+			s.keys[segment.Key] = &selection{}
+		}
+		return s.keys[segment.Key]
+	case *segment.Index < 0:
+		if s.all == nil {
+			s.all = &selection{}
+		}
+		return s.all
+	default:
+		if s.indexes == nil {
+			s.indexes = make(map[int]*selection)
+		}
+		if s.indexes[*segment.Index] == nil {
+			s.indexes[*segment.Index] = &selection{}
+		}
+		return s.indexes[*segment.Index]
+	}
+}
+
+// ReplaceAt is like ReplaceTokensExcept but only rewrites the subtrees
+// selected by paths: the strings found there, and the object keys below them.
+// The keys leading to a selected subtree are kept.
+func ReplaceAt(value interface{}, paths []FieldPath, protected [][]string, fn StringFunc) interface{} {
+	return replaceAt(value, []*selection{newSelection(paths)}, newPathTree(protected), fn, fn)
+}
+
+// replaceSelected applies fn with ReplaceAt when paths are set, with
+// ReplaceTokensExcept otherwise, and key to the object keys instead of fn.
+func replaceSelected(value interface{}, paths []FieldPath, protected [][]string, fn, key StringFunc) interface{} {
+	if len(paths) == 0 {
+		return replaceTokensExcept(value, protected, fn, key)
+	}
+	return replaceAt(value, []*selection{newSelection(paths)}, newPathTree(protected), fn, key)
+}
+
+// replaceAt rewrites the subtrees value's selections lead to and copies the
+// rest. tree is the protected pathTree at value, nil when nothing below is
+// protected.
+func replaceAt(value interface{}, selections []*selection, tree pathTree, fn, key StringFunc) interface{} {
+	for _, s := range selections {
+		if s.end {
+			return replaceExcept(value, tree, fn, key)
+		}
+	}
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(v))
+		for k, child := range v {
+			var next []*selection
+			for _, s := range selections {
+				if selected := s.keys[k]; selected != nil {
+					next = append(next, selected)
+				}
+			}
+			var subtree pathTree
+			protected := false
+			if tree != nil {
+				subtree, protected = tree[k]
+			}
+			if len(next) == 0 || (protected && subtree == nil) {
+				out[k] = ReplaceTokens(child, keep)
+				continue
+			}
+			out[k] = replaceAt(child, next, subtree, fn, key)
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for i, child := range v {
+			var next []*selection
+			for _, s := range selections {
+				if s.all != nil {
+					next = append(next, s.all)
+				}
+				if selected := s.indexes[i]; selected != nil {
+					next = append(next, selected)
+				}
+			}
+			if len(next) == 0 {
+				out[i] = ReplaceTokens(child, keep)
+				continue
+			}
+			// lists do not consume protected path segments
+			out[i] = replaceAt(child, next, tree, fn, key)
+		}
+		return out
+	default:
+		// a path leading through a scalar selects nothing
+		return v
+	}
+}
+
+func keep(s string) string {
+	return s
+}
@@ -0,0 +1,102 @@
+package transform
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestParseFieldPaths(t *testing.T) {
+	paths, err := ParseFieldPaths("spec.template.spec.containers[*].image, {.spec.replicas},$.data['app.properties'], spec.rules[0].host")
+	require.NoError(t, err)
+	require.Len(t, paths, 4)
+	assert.Equal(t, "spec.template.spec.containers[*].image", paths[0].String())
+	assert.Equal(t, "spec.replicas", paths[1].String())
+	assert.Equal(t, FieldPath{{Key: "data"}, {Key: "app.properties"}}, paths[2])
+	assert.Equal(t, "spec.rules[0].host", paths[3].String())
+
+	paths, err = ParseFieldPaths(`metadata.annotations["a,b]"]`)
+	require.NoError(t, err)
+	assert.Equal(t, FieldPath{{Key: "metadata"}, {Key: "annotations"}, {Key: "a,b]"}}, paths[0])
+
+	for _, invalid := range []string{"spec..image", "spec.containers[", "spec.containers[?(@.name=='web')]", "spec.containers[0:2]", "spec.containers[-1]", "spec.*", "$"} {
+		_, err := ParseFieldPath(invalid)
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestFieldPath_Values(t *testing.T) {
+	object := map[string]interface{}{
+		"spec": map[string]interface{}{
+			"replicas":   int64(3),
+			"containers": []interface{}{map[string]interface{}{"image": "web:1"}, map[string]interface{}{"image": "proxy:2"}, map[string]interface{}{}},
+		},
+	}
+	for expr, values := range map[string][]interface{}{
+		"spec.replicas":            {int64(3)},
+		"spec.containers[*].image": {"web:1", "proxy:2"},
+		"spec.containers[1].image": {"proxy:2"},
+		"spec.containers[5].image": nil,
+		"spec.replicas.count":      nil,
+		"status":                   nil,
+	} {
+		path, err := ParseFieldPath(expr)
+		require.NoError(t, err)
+		assert.Equal(t, values, path.Values(object), expr)
+	}
+}
+
+func TestLiteral_Paths(t *testing.T) {
+	item := &unstructured.Unstructured{Object: map[string]interface{}{
+		"metadata": map[string]interface{}{"name": "registry.prod"},
+		"spec": map[string]interface{}{
+			"containers": []interface{}{
+				map[string]interface{}{"name": "registry.prod", "image": "registry.prod/web:1"},
+				map[string]interface{}{"name": "sidecar", "image": "registry.prod/proxy:2", "args": []interface{}{"registry.prod"}},
+			},
+		},
+	}}
+	paths, err := ParseFieldPaths("spec.containers[*].image, spec.containers[1], spec.missing[0].image, metadata.name.value")
+	require.NoError(t, err)
+
+	hits := 0
+	literal := &Literal{
+		Patterns: map[string]string{"registry.prod": "registry.dr"},
+		OnHit:    func(_ string, count int) { hits += count },
+		Paths:    paths,
+	}
+	out, err := literal.Transform(item)
+	require.NoError(t, err)
+
+	assert.Equal(t, "registry.prod", out.GetName())
+	containers, _, _ := unstructured.NestedSlice(out.Object, "spec", "containers")
+	assert.Equal(t, map[string]interface{}{"name": "registry.prod", "image": "registry.dr/web:1"}, containers[0])
+	// overlapping paths rewrite a field once
+	assert.Equal(t, map[string]interface{}{"name": "sidecar", "image": "registry.dr/proxy:2", "args": []interface{}{"registry.dr"}}, containers[1])
+	assert.Equal(t, 3, hits)
+	assert.Equal(t, "registry.prod/web:1", item.Object["spec"].(map[string]interface{})["containers"].([]interface{})[0].(map[string]interface{})["image"], "input must be left untouched")
+}
+
+func TestReplaceAt_Protected(t *testing.T) {
+	value := map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"labels": map[string]interface{}{"velero.io/backup-name": "prod", "env": "prod"},
+		},
+	}
+	paths, err := ParseFieldPaths("metadata.labels")
+	require.NoError(t, err)
+
+	out := ReplaceAt(value, paths, [][]string{{"metadata", "labels", "velero.io/backup-name"}}, func(s string) string {
+		if s == "prod" {
+			return "dr"
+		}
+		return s
+	})
+	assert.Equal(t, map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"labels": map[string]interface{}{"velero.io/backup-name": "prod", "env": "dr"},
+		},
+	}, out)
+}
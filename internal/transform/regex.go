@@ -0,0 +1,187 @@
+package transform
+
+import (
+	"fmt"
+	"regexp"
+	"regexp/syntax"
+	"strconv"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// maxRegexInstructions bounds the compiled size of a rule regex. RE2 matches in
+// linear time, but counted repetitions such as (a{100}){100} expand into
+// programs large enough to make every match slow and memory hungry.
+const maxRegexInstructions = 10000
+
+// pcreConstructs are the constructs users copy from PCRE-based tools that RE2
+// does not support, with the hint given when one makes an expression invalid.
+var pcreConstructs = []struct {
+	re   *regexp.Regexp
+	hint string
+}{
+	{regexp.MustCompile(`\(\?<?[=!]`), "lookahead and lookbehind assertions are not supported"},
+	{regexp.MustCompile(`\(\?>`), "atomic groups are not supported"},
+	{regexp.MustCompile(`\(\?(R|[0-9]+|&\w+)\)`), "recursion is not supported"},
+	{regexp.MustCompile(`\(\?\(`), "conditionals are not supported"},
+	{regexp.MustCompile(`\\[1-9]|\\k<`), "backreferences are not supported in the expression; in the replacement, use $1 or ${name}"},
+	{regexp.MustCompile(`[*+?}]\+`), "possessive quantifiers are not supported, remove the trailing +"},
+	{regexp.MustCompile(`\\[GZRKhHvVX]`), "this escape is PCRE-only"},
+}
+
+// ValidateRegex checks that expr is a valid Go (RE2) regular expression of a
+// reasonable size. PCRE-only constructs are reported with a hint.
+func ValidateRegex(expr string) error {
+	parsed, err := syntax.Parse(expr, syntax.Perl)
+	if err != nil {
+		for _, construct := range pcreConstructs {
+			if construct.re.MatchString(expr) {
+				return fmt.Errorf("invalid regex %q: %s (Go uses RE2 syntax): %v", expr, construct.hint, err)
+			}
+		}
+		return fmt.Errorf("invalid regex %q: %v", expr, err)
+	}
+
+	prog, err := syntax.Compile(parsed.Simplify())
+	if err != nil {
+		return fmt.Errorf("invalid regex %q: %v", expr, err)
+	}
+	if len(prog.Inst) > maxRegexInstructions {
+		return fmt.Errorf("regex %q is too complex: %d instructions, the limit is %d", expr, len(prog.Inst), maxRegexInstructions)
+	}
+	return nil
+}
+
+// RegexRule replaces the matches of a regular expression. The replacement
+// expands $1, ${1} or ${name} to the submatches.
+type RegexRule struct {
+	Expr        string
+	Replacement string
+
+	re *regexp.Regexp
+}
+
+// Regex replaces the matches of each rule, in order, in every string of the
+// item, object keys and the decoded data of Secrets included.
+type Regex struct {
+	Rules []RegexRule
+	// OnHit, when set, is called with the number of matches replaced each
+	// time a rule matches a string.
+	OnHit func(expr string, count int)
+	// Protected lists the paths (object keys from the root) whose subtrees,
+	// keys included, are never rewritten.
+	Protected [][]string
+	// Paths, when set, restricts the rewrites to the fields they select.
+	Paths []FieldPath
+	// Excluded lists strings never rewritten, even inside a match.
+	Excluded []string
+	// ValuesOnly leaves object keys alone, rewriting string values only.
+	ValuesOnly bool
+}
+
+// NewRegex validates and compiles rules.
+func NewRegex(rules []RegexRule) (*Regex, error) {
+	compiled := make([]RegexRule, 0, len(rules))
+	for _, rule := range rules {
+		if rule.Expr == "" {
+			return nil, fmt.Errorf("empty regex")
+		}
+		if err := ValidateRegex(rule.Expr); err != nil {
+			return nil, err
+		}
+		rule.re = regexp.MustCompile(rule.Expr)
+		if err := validateReplacement(rule.re, rule.Replacement); err != nil {
+			return nil, fmt.Errorf("invalid replacement %q of regex %q: %v", rule.Replacement, rule.Expr, err)
+		}
+		compiled = append(compiled, rule)
+	}
+	return &Regex{Rules: compiled}, nil
+}
+
+// validateReplacement checks that the submatches a replacement refers to exist:
+// regexp expands the unknown ones to nothing, and reads $1_dr as ${1_dr}.
+func validateReplacement(re *regexp.Regexp, replacement string) error {
+	for rest := replacement; ; {
+		i := strings.IndexByte(rest, '$')
+		if i < 0 || i == len(rest)-1 {
+			return nil
+		}
+		rest = rest[i+1:]
+		var name string
+		switch {
+		case rest[0] == '$':
+			rest = rest[1:]
+			continue
+		case rest[0] == '{':
+			end := strings.IndexByte(rest, '}')
+			if end < 0 {
+				// regexp keeps it as is
+				continue
+			}
+			name, rest = rest[1:end], rest[end+1:]
+		default:
+			end := strings.IndexFunc(rest, func(r rune) bool {
+				return !(r == '_' || r >= '0' && r <= '9' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z')
+			})
+			if end < 0 {
+				end = len(rest)
+			}
+			name, rest = rest[:end], rest[end:]
+		}
+		if name == "" {
+			continue
+		}
+		if n, err := strconv.Atoi(name); err == nil {
+			if n > re.NumSubexp() {
+				return fmt.Errorf("$%s refers to group %d, the expression has %d", name, n, re.NumSubexp())
+			}
+			continue
+		}
+		if re.SubexpIndex(name) < 0 {
+			if suffix := strings.TrimLeft(name, "0123456789"); suffix != name {
+				return fmt.Errorf("$%s refers to no group: write ${%s}%s", name, name[:len(name)-len(suffix)], suffix)
+			}
+			return fmt.Errorf("$%s refers to no group", name)
+		}
+	}
+}
+
+// Name implements Transformer.
+func (r *Regex) Name() string {
+	return "regex"
+}
+
+// Transform implements Transformer.
+func (r *Regex) Transform(item *unstructured.Unstructured) (*unstructured.Unstructured, error) {
+	fn := Excluding(r.Excluded, func(token string) string {
+		return r.replace(token, r.OnHit)
+	})
+	key := keyFunc(fn, r.ValuesOnly)
+	content := replaceItem(item.Object, r.Paths, r.Protected, documentAware(fn, key, r.Replace), key)
+	return &unstructured.Unstructured{Object: content}, nil
+}
+
+// Replace applies the rules to s, without reporting hits.
+func (r *Regex) Replace(s string) string {
+	return Excluding(r.Excluded, func(token string) string {
+		return r.replace(token, nil)
+	})(s)
+}
+
+func (r *Regex) replace(s string, onHit func(expr string, count int)) string {
+	for _, rule := range r.Rules {
+		if rule.re == nil {
+			continue
+		}
+		count := len(rule.re.FindAllStringIndex(s, -1))
+		if count == 0 {
+			continue
+		}
+		s = rule.re.ReplaceAllString(s, rule.Replacement)
+		if onHit != nil {
+			onHit(rule.Expr, count)
+		}
+	}
+	return s
+}
@@ -0,0 +1,121 @@
+package transform
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestValidateRegex(t *testing.T) {
+	for _, expr := range []string{
+		`.*\.old-domain\.com`,
+		`bucket-(.*)-prod`,
+		`(?P<env>prod|staging)-db`,
+		`(a+)+$`, // catastrophic in backtracking engines, linear in RE2
+		`\(\?=literal\)`,
+	} {
+		assert.NoError(t, ValidateRegex(expr), expr)
+	}
+
+	tests := map[string]string{
+		`foo(?=bar)`:                      "lookahead and lookbehind",
+		`(?<!www\.)foo`:                   "lookahead and lookbehind",
+		`(?>a+)b`:                         "atomic groups",
+		`(a)\1`:                           "backreferences",
+		`a*+b`:                            "possessive quantifiers",
+		`foo\Z`:                           "PCRE-only",
+		`(?(1)a|b)`:                       "conditionals",
+		`foo(`:                            "missing closing )",
+		`((a{100}){100}){100}`:            "invalid repeat count",
+		`(abcdefghij|klmnopqrst){1,1000}`: "too complex",
+	}
+	for expr, message := range tests {
+		assert.ErrorContains(t, ValidateRegex(expr), message, expr)
+	}
+}
+
+func TestRegex(t *testing.T) {
+	regex, err := NewRegex([]RegexRule{
+		{Expr: `([a-z0-9-]+)\.old-domain\.com`, Replacement: "${1}.new-domain.com"},
+		{Expr: `(?P<env>prod|staging)-db`, Replacement: "dr-${env}-db"},
+	})
+	require.NoError(t, err)
+	hits := make(map[string]int)
+	regex.OnHit = func(expr string, count int) { hits[expr] += count }
+	regex.Protected = [][]string{{"metadata", "annotations"}}
+
+	item := &unstructured.Unstructured{Object: map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"name":        "web",
+			"annotations": map[string]interface{}{"note": "web.old-domain.com"},
+		},
+		"spec": map[string]interface{}{
+			"hosts":              []interface{}{"web.old-domain.com", "api.old-domain.com", "old-domain.com"},
+			"api.old-domain.com": "prod-db,staging-db",
+		},
+	}}
+	original := item.DeepCopy()
+
+	out, err := regex.Transform(item)
+	require.NoError(t, err)
+	assert.Equal(t, original, item)
+	assert.Equal(t, map[string]interface{}{
+		"hosts":              []interface{}{"web.new-domain.com", "api.new-domain.com", "old-domain.com"},
+		"api.new-domain.com": "dr-prod-db,dr-staging-db",
+	}, out.Object["spec"])
+	assert.Equal(t, "web.old-domain.com", out.GetAnnotations()["note"])
+	assert.Equal(t, map[string]int{`([a-z0-9-]+)\.old-domain\.com`: 3, `(?P<env>prod|staging)-db`: 2}, hits)
+
+	_, err = NewRegex([]RegexRule{{Expr: `foo(?=bar)`}})
+	assert.ErrorContains(t, err, "lookahead")
+	_, err = NewRegex([]RegexRule{{Replacement: "x"}})
+	assert.EqualError(t, err, "empty regex")
+}
+
+func TestRegex_Backreferences(t *testing.T) {
+	regex, err := NewRegex([]RegexRule{
+		{Expr: `bucket-(.*)-prod`, Replacement: "bucket-$1-dr"},
+		{Expr: `(?P<app>\w+)\.(?P<region>eu|us)-west`, Replacement: "${app}_dr.${region}-east, costs $$5"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "s3://bucket-logs-dr/2024", regex.Replace("s3://bucket-logs-prod/2024"))
+	assert.Equal(t, "web_dr.eu-east, costs $5", regex.Replace("web.eu-west"))
+
+	for replacement, message := range map[string]string{
+		"bucket-$1_dr":     "write ${1}_dr",
+		"bucket-${1_dr}":   "write ${1}_dr",
+		"bucket-$2-dr":     "refers to group 2, the expression has 1",
+		"bucket-${env}-dr": "$env refers to no group",
+	} {
+		_, err := NewRegex([]RegexRule{{Expr: `bucket-(.*)-prod`, Replacement: replacement}})
+		assert.ErrorContains(t, err, message, replacement)
+	}
+	for _, replacement := range []string{"bucket-${1}_dr", "bucket-$1.dr", "cost: $$1", "${", "$"} {
+		_, err := NewRegex([]RegexRule{{Expr: `bucket-(.*)-prod`, Replacement: replacement}})
+		assert.NoError(t, err, replacement)
+	}
+}
+
+func TestRegex_Excluded(t *testing.T) {
+	regex, err := NewRegex([]RegexRule{{Expr: `bucket-(\w+)-prod`, Replacement: "bucket-$1-dr"}})
+	require.NoError(t, err)
+	regex.Excluded = []string{"bucket-audit-prod"}
+	assert.Equal(t, "bucket-logs-dr bucket-audit-prod", regex.Replace("bucket-logs-prod bucket-audit-prod"))
+}
+
+func TestRegex_ValuesOnly(t *testing.T) {
+	regex, err := NewRegex([]RegexRule{{Expr: `\bdb\b|^db`, Replacement: "database"}})
+	require.NoError(t, err)
+	regex.ValuesOnly = true
+	regex.Protected = [][]string{{"metadata", "name"}}
+	item := &unstructured.Unstructured{Object: map[string]interface{}{
+		"metadata": map[string]interface{}{"name": "db"},
+		"spec":     map[string]interface{}{"dbConfig": "db", "db": "db-primary"},
+	}}
+	out, err := regex.Transform(item)
+	require.NoError(t, err)
+	assert.Equal(t, "db", out.Object["metadata"].(map[string]interface{})["name"])
+	assert.Equal(t, map[string]interface{}{"dbConfig": "database", "db": "database-primary"}, out.Object["spec"])
+}
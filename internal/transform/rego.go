@@ -0,0 +1,92 @@
+package transform
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// PolicyDecider evaluates the document of the package of a Rego module for an
+// input. The document is nil when the package defines nothing for the input.
+type PolicyDecider interface {
+	Decide(id, module string, input interface{}) ([]byte, error)
+}
+
+// PolicyDecision is the document of the package of a policy: Patch is a JSON
+// Patch to apply to the item, Deny the reasons to restore it untouched.
+type PolicyDecision struct {
+	Patch []map[string]interface{} `json:"patch"`
+	Deny  []string                 `json:"deny"`
+}
+
+// Rego applies the patch decided by a Rego policy. The policy sees the item
+// as input.object and the item of the backup as input.oldObject. Its deny
+// rule is checked on the final item by Denied.
+type Rego struct {
+	// ID names the policy in the decider
+	ID       string
+	Module   string
+	Decider  PolicyDecider
+	Original *unstructured.Unstructured
+	// Critical makes a denial abort the restore rather than restore the
+	// item untouched
+	Critical bool
+}
+
+// Name implements Transformer.
+func (r *Rego) Name() string {
+	return "rego"
+}
+
+// decide evaluates the policy on the item.
+func (r *Rego) decide(item *unstructured.Unstructured) (*PolicyDecision, error) {
+	if r.Decider == nil {
+		return nil, fmt.Errorf("no policy engine is configured")
+	}
+	input := map[string]interface{}{"object": item.Object}
+	if r.Original != nil {
+		input["oldObject"] = r.Original.Object
+	}
+	document, err := r.Decider.Decide(r.ID, r.Module, input)
+	if err != nil {
+		return nil, fmt.Errorf("failed to evaluate policy %s: %v", r.ID, err)
+	}
+	decision := &PolicyDecision{}
+	if len(document) > 0 && string(document) != "null" {
+		if err := json.Unmarshal(document, decision); err != nil {
+			return nil, fmt.Errorf("invalid decision of policy %s: %v", r.ID, err)
+		}
+	}
+	return decision, nil
+}
+
+// Transform implements Transformer.
+func (r *Rego) Transform(item *unstructured.Unstructured) (*unstructured.Unstructured, error) {
+	decision, err := r.decide(item)
+	if err != nil {
+		return nil, err
+	}
+	if len(decision.Patch) == 0 {
+		return item, nil
+	}
+	document, err := json.Marshal(decision.Patch)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode the patch of policy %s: %v", r.ID, err)
+	}
+	patch, err := NewJSONPatch(document)
+	if err != nil {
+		return nil, fmt.Errorf("policy %s: %v", r.ID, err)
+	}
+	return patch.Transform(item)
+}
+
+// Denied returns the reasons the policy gives to refuse the changes leading
+// to item.
+func (r *Rego) Denied(item *unstructured.Unstructured) ([]string, error) {
+	decision, err := r.decide(item)
+	if err != nil {
+		return nil, err
+	}
+	return decision.Deny, nil
+}
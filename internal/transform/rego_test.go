@@ -0,0 +1,86 @@
+package transform
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// fakeDecider decides with a Go function in place of the policy.
+type fakeDecider func(input map[string]interface{}) (interface{}, error)
+
+func (f fakeDecider) Decide(_, _ string, input interface{}) ([]byte, error) {
+	document, err := f(input.(map[string]interface{}))
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(document)
+}
+
+func TestRego_Transform(t *testing.T) {
+	original := &unstructured.Unstructured{Object: map[string]interface{}{
+		"kind":     "Service",
+		"metadata": map[string]interface{}{"name": "web"},
+		"spec":     map[string]interface{}{"type": "LoadBalancer"},
+	}}
+	rego := &Rego{ID: "replace-pattern/services", Original: original, Decider: fakeDecider(func(input map[string]interface{}) (interface{}, error) {
+		object := input["object"].(map[string]interface{})
+		old := input["oldObject"].(map[string]interface{})
+		decision := map[string]interface{}{}
+		if object["spec"].(map[string]interface{})["type"] == "LoadBalancer" {
+			decision["patch"] = []interface{}{map[string]interface{}{"op": "replace", "path": "/spec/type", "value": "ClusterIP"}}
+		}
+		if object["metadata"].(map[string]interface{})["name"] != old["metadata"].(map[string]interface{})["name"] {
+			decision["deny"] = []string{"Services keep their name"}
+		}
+		return decision, nil
+	})}
+
+	out, err := rego.Transform(original)
+	require.NoError(t, err)
+	assert.Equal(t, "ClusterIP", out.Object["spec"].(map[string]interface{})["type"])
+	assert.Equal(t, "LoadBalancer", original.Object["spec"].(map[string]interface{})["type"], "input must be left untouched")
+	reasons, err := rego.Denied(out)
+	require.NoError(t, err)
+	assert.Empty(t, reasons)
+
+	renamed := out.DeepCopy()
+	renamed.SetName("site")
+	reasons, err = rego.Denied(renamed)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"Services keep their name"}, reasons)
+	unchanged, err := rego.Transform(out)
+	require.NoError(t, err)
+	assert.Equal(t, out, unchanged)
+}
+
+func TestRego_Errors(t *testing.T) {
+	item := &unstructured.Unstructured{Object: map[string]interface{}{"kind": "ConfigMap"}}
+	_, err := (&Rego{ID: "replace-pattern/none"}).Transform(item)
+	assert.Error(t, err, "no decider")
+
+	for _, decider := range []fakeDecider{
+		func(map[string]interface{}) (interface{}, error) { return nil, fmt.Errorf("connection refused") },
+		func(map[string]interface{}) (interface{}, error) {
+			return map[string]interface{}{"patch": "remove it"}, nil
+		},
+		func(map[string]interface{}) (interface{}, error) {
+			return map[string]interface{}{"patch": []interface{}{map[string]interface{}{"op": "rename", "path": "/kind"}}}, nil
+		},
+	} {
+		_, err := (&Rego{ID: "replace-pattern/broken", Decider: decider}).Transform(item)
+		assert.Error(t, err)
+	}
+
+	undefined := &Rego{ID: "replace-pattern/undefined", Decider: fakeDecider(func(map[string]interface{}) (interface{}, error) { return nil, nil })}
+	out, err := undefined.Transform(item)
+	require.NoError(t, err)
+	assert.Equal(t, item, out)
+	reasons, err := undefined.Denied(item)
+	require.NoError(t, err)
+	assert.Empty(t, reasons)
+}
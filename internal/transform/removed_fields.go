@@ -0,0 +1,178 @@
+package transform
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// Actions of RemovedFields on the removed fields it finds.
+const (
+	// RemovedFieldsRemove strips the fields.
+	RemovedFieldsRemove = "remove"
+	// RemovedFieldsWarn restores the fields, warning about them.
+	RemovedFieldsWarn = "warn"
+	// RemovedFieldsFail fails the item.
+	RemovedFieldsFail = "fail"
+)
+
+// RemovedField is a field Kubernetes removed from the API of a kind, every
+// kind when Kind is empty.
+type RemovedField struct {
+	Kind string
+	Path FieldPath
+	// RemovedIn is the Kubernetes version removing the field, such as 1.25
+	RemovedIn string
+}
+
+// Validate checks the version and that the path ends with a key.
+func (f RemovedField) Validate() error {
+	if _, _, err := ParseKubernetesVersion(f.RemovedIn); err != nil {
+		return err
+	}
+	if len(f.Path) == 0 || f.Path[len(f.Path)-1].Index != nil {
+		return fmt.Errorf("the path %s must end with an object key", f.Path)
+	}
+	return nil
+}
+
+// builtinRemovedFields are the fields Kubernetes removed from the stable
+// versions it still serves.
+var builtinRemovedFields = []RemovedField{
+	{Path: FieldPath{{Key: "metadata"}, {Key: "clusterName"}}, RemovedIn: "1.25"},
+	{Kind: "Service", Path: FieldPath{{Key: "spec"}, {Key: "topologyKeys"}}, RemovedIn: "1.22"},
+	{Kind: "Service", Path: FieldPath{{Key: "spec"}, {Key: "ipFamily"}}, RemovedIn: "1.20"},
+}
+
+// RemovedFields cleans old backups of the fields the Kubernetes version of the
+// target cluster no longer has, from its Fields and, with Builtin, from the
+// fields Kubernetes removed from its stable versions. The version comes from
+// Version.
+type RemovedFields struct {
+	Fields  []RemovedField
+	Builtin bool
+	Action  string
+	// Version returns the Kubernetes version of the target cluster
+	Version func() (string, error)
+	Warn    func(format string, args ...interface{})
+}
+
+// Validate checks the action and the fields.
+func (r *RemovedFields) Validate() error {
+	switch r.Action {
+	case RemovedFieldsRemove, RemovedFieldsWarn, RemovedFieldsFail:
+	default:
+		return fmt.Errorf("unknown action %q, expected one of %s, %s or %s", r.Action, RemovedFieldsRemove, RemovedFieldsWarn, RemovedFieldsFail)
+	}
+	for _, field := range r.Fields {
+		if err := field.Validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Name implements Transformer.
+func (r *RemovedFields) Name() string {
+	return "removed-fields"
+}
+
+// Transform implements Transformer.
+func (r *RemovedFields) Transform(item *unstructured.Unstructured) (*unstructured.Unstructured, error) {
+	fields := r.Fields
+	if r.Builtin {
+		fields = append(append([]RemovedField{}, fields...), builtinRemovedFields...)
+	}
+	var applicable []RemovedField
+	for _, field := range fields {
+		if (field.Kind == "" || field.Kind == item.GetKind()) && len(field.Path.Values(item.Object)) > 0 {
+			applicable = append(applicable, field)
+		}
+	}
+	if len(applicable) == 0 {
+		return item, nil
+	}
+
+	if r.Version == nil {
+		return nil, fmt.Errorf("the Kubernetes version of the target cluster is unknown")
+	}
+	version, err := r.Version()
+	if err != nil {
+		return nil, err
+	}
+	major, minor, err := ParseKubernetesVersion(version)
+	if err != nil {
+		return nil, fmt.Errorf("invalid Kubernetes version of the target cluster: %v", err)
+	}
+
+	out := item.DeepCopy()
+	var removed []string
+	for _, field := range applicable {
+		removedMajor, removedMinor, _ := ParseKubernetesVersion(field.RemovedIn)
+		if major < removedMajor || (major == removedMajor && minor < removedMinor) {
+			continue
+		}
+		if r.Action == RemovedFieldsRemove {
+			removeFields(out.Object, field.Path)
+		}
+		removed = append(removed, field.Path.String())
+	}
+	if len(removed) == 0 {
+		return item, nil
+	}
+	sort.Strings(removed)
+	switch r.Action {
+	case RemovedFieldsFail:
+		return nil, fmt.Errorf("%s %s/%s has fields Kubernetes %s removed: %s", item.GetKind(), item.GetNamespace(), item.GetName(), version, strings.Join(removed, ", "))
+	case RemovedFieldsWarn:
+		r.warn("%s %s/%s has fields Kubernetes %s removed: %s", item.GetKind(), item.GetNamespace(), item.GetName(), version, strings.Join(removed, ", "))
+		return item, nil
+	}
+	r.warn("Removed %s from %s %s/%s: Kubernetes %s removed them", strings.Join(removed, ", "), item.GetKind(), item.GetNamespace(), item.GetName(), version)
+	return out, nil
+}
+
+func (r *RemovedFields) warn(format string, args ...interface{}) {
+	if r.Warn != nil {
+		r.Warn(format, args...)
+	}
+}
+
+// removeFields removes the fields path selects in value. The last segment of
+// path is an object key.
+func removeFields(value interface{}, path FieldPath) {
+	if len(path) == 0 {
+		return
+	}
+	segment := path[0]
+	if len(path) == 1 {
+		if object, ok := value.(map[string]interface{}); ok {
+			delete(object, segment.Key)
+		}
+		return
+	}
+	for _, child := range (FieldPath{segment}).Values(value) {
+		removeFields(child, path[1:])
+	}
+}
+
+// ParseKubernetesVersion returns the major and minor versions of a Kubernetes
+// version such as 1.27, v1.27.3-eks-a5565ad or 1.27+.
+func ParseKubernetesVersion(version string) (int, int, error) {
+	parts := strings.SplitN(strings.TrimPrefix(strings.TrimSpace(version), "v"), ".", 3)
+	if len(parts) < 2 {
+		return 0, 0, fmt.Errorf("invalid Kubernetes version %q, expected <major>.<minor>", version)
+	}
+	major, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid Kubernetes version %q, expected <major>.<minor>", version)
+	}
+	minor, err := strconv.Atoi(strings.TrimRightFunc(parts[1], func(r rune) bool { return r < '0' || r > '9' }))
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid Kubernetes version %q, expected <major>.<minor>", version)
+	}
+	return major, minor, nil
+}
@@ -0,0 +1,114 @@
+package transform
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func oldService() *unstructured.Unstructured {
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "Service",
+		"metadata":   map[string]interface{}{"name": "web", "namespace": "shop", "clusterName": "prod"},
+		"spec": map[string]interface{}{
+			"ipFamily":     "IPv4",
+			"topologyKeys": []interface{}{"kubernetes.io/hostname", "*"},
+			"ports":        []interface{}{map[string]interface{}{"port": int64(80), "appProtocol": "http"}},
+		},
+	}}
+}
+
+func TestRemovedFields(t *testing.T) {
+	var warnings []string
+	all := -1
+	transformer := &RemovedFields{
+		Fields:  []RemovedField{{Kind: "Service", Path: FieldPath{{Key: "spec"}, {Key: "ports"}, {Index: &all}, {Key: "appProtocol"}}, RemovedIn: "1.30"}},
+		Builtin: true,
+		Action:  RemovedFieldsRemove,
+		Version: func() (string, error) { return "1.22+", nil },
+		Warn:    func(format string, args ...interface{}) { warnings = append(warnings, format) },
+	}
+	require.NoError(t, transformer.Validate())
+
+	item := oldService()
+	out, err := transformer.Transform(item)
+	require.NoError(t, err)
+	assert.NotContains(t, field(out.Object, "spec"), "topologyKeys")
+	assert.NotContains(t, field(out.Object, "spec"), "ipFamily")
+	// removed in later versions
+	assert.Equal(t, "prod", field(out.Object, "metadata", "clusterName"))
+	assert.Equal(t, "http", field(list(out.Object, "spec", "ports")[0], "appProtocol"))
+	assert.Len(t, warnings, 1)
+	// the item itself is left alone
+	assert.Equal(t, "IPv4", field(item.Object, "spec", "ipFamily"))
+
+	transformer.Version = func() (string, error) { return "v1.30.2-eks-1552ad0", nil }
+	out, err = transformer.Transform(item)
+	require.NoError(t, err)
+	assert.NotContains(t, field(out.Object, "metadata"), "clusterName")
+	assert.NotContains(t, list(out.Object, "spec", "ports")[0], "appProtocol")
+	assert.Equal(t, int64(80), field(list(out.Object, "spec", "ports")[0], "port"))
+
+	transformer.Builtin = false
+	transformer.Version = func() (string, error) { return "1.29", nil }
+	out, err = transformer.Transform(item)
+	require.NoError(t, err)
+	assert.Same(t, item, out)
+}
+
+func TestRemovedFields_Actions(t *testing.T) {
+	var warnings []string
+	transformer := &RemovedFields{
+		Builtin: true,
+		Action:  RemovedFieldsWarn,
+		Version: func() (string, error) { return "1.27", nil },
+		Warn:    func(format string, args ...interface{}) { warnings = append(warnings, format) },
+	}
+	item := oldService()
+	out, err := transformer.Transform(item)
+	require.NoError(t, err)
+	assert.Same(t, item, out)
+	assert.Len(t, warnings, 1)
+
+	transformer.Action = RemovedFieldsFail
+	_, err = transformer.Transform(item)
+	assert.ErrorContains(t, err, "metadata.clusterName, spec.ipFamily, spec.topologyKeys")
+
+	transformer.Version = func() (string, error) { return "", errors.New("forbidden") }
+	_, err = transformer.Transform(item)
+	assert.ErrorContains(t, err, "forbidden")
+
+	// items without removed fields need no version
+	clean := &unstructured.Unstructured{Object: map[string]interface{}{"apiVersion": "v1", "kind": "Service", "metadata": map[string]interface{}{"name": "web"}}}
+	out, err = transformer.Transform(clean)
+	require.NoError(t, err)
+	assert.Same(t, clean, out)
+}
+
+func TestRemovedFields_Validate(t *testing.T) {
+	assert.Error(t, (&RemovedFields{Action: "drop"}).Validate())
+	assert.Error(t, (&RemovedFields{Action: RemovedFieldsRemove, Fields: []RemovedField{{Path: FieldPath{{Key: "spec"}}, RemovedIn: "next"}}}).Validate())
+	index := 0
+	assert.Error(t, (&RemovedFields{Action: RemovedFieldsRemove, Fields: []RemovedField{{Path: FieldPath{{Key: "spec"}, {Index: &index}}, RemovedIn: "1.25"}}}).Validate())
+}
+
+func TestParseKubernetesVersion(t *testing.T) {
+	for version, expected := range map[string][2]int{
+		"1.25":                 {1, 25},
+		"v1.27.3-eks-a5565ad":  {1, 27},
+		"1.28+":                {1, 28},
+		" v1.30.1-gke.1329003": {1, 30},
+	} {
+		major, minor, err := ParseKubernetesVersion(version)
+		require.NoError(t, err, version)
+		assert.Equal(t, expected, [2]int{major, minor}, version)
+	}
+	for _, version := range []string{"", "1", "next.1", "1.x"} {
+		_, _, err := ParseKubernetesVersion(version)
+		assert.Error(t, err, version)
+	}
+}
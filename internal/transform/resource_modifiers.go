@@ -0,0 +1,170 @@
+package transform
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	jsonpatch "github.com/evanphx/json-patch"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// ResourceModifiers applies rules in the format of Velero's resource
+// modifiers: each rule whose conditions an item satisfies patches it, in
+// order, the later rules seeing the patches of the earlier ones.
+type ResourceModifiers struct {
+	Rules []ModifierRule
+	// Resolve returns the group and kind a resource name such as
+	// deployments.apps stands for. Without it, or when it does not know the
+	// name, the name is compared with the plural of the kind.
+	Resolve func(resource string) (schema.GroupKind, bool)
+}
+
+// ModifierRule is a resource modifier rule: its conditions, and the patches
+// applied to the items satisfying them.
+type ModifierRule struct {
+	// GroupResource is the resource of the items, * for all
+	GroupResource string
+	// Name, when set, matches the names of the items
+	Name *regexp.Regexp
+	// Namespaces, when set, lists the namespaces of the items
+	Namespaces []string
+	// Labels, when set, selects the items on their labels
+	Labels labels.Selector
+	// Matches are JSON Patch test operations the items must pass
+	Matches jsonpatch.Patch
+
+	// Patch is the JSON Patch of the rule, nil when it has none
+	Patch            *JSONPatch
+	MergePatches     [][]byte
+	StrategicPatches [][]byte
+}
+
+// Name implements Transformer.
+func (m *ResourceModifiers) Name() string {
+	return "resource-modifiers"
+}
+
+// Transform implements Transformer.
+func (m *ResourceModifiers) Transform(item *unstructured.Unstructured) (*unstructured.Unstructured, error) {
+	for i, rule := range m.Rules {
+		ok, err := m.applies(rule, item)
+		if err != nil {
+			return nil, fmt.Errorf("rule %d: %v", i, err)
+		}
+		if !ok {
+			continue
+		}
+		if rule.Patch != nil {
+			if item, err = rule.Patch.Transform(item); err != nil {
+				return nil, fmt.Errorf("rule %d: %v", i, err)
+			}
+		}
+		for _, patch := range rule.MergePatches {
+			if item, err = mergePatch(item, patch); err != nil {
+				return nil, fmt.Errorf("rule %d: %v", i, err)
+			}
+		}
+		for _, patch := range rule.StrategicPatches {
+			strategic := &StrategicMerge{Patches: map[string][]byte{item.GetKind(): patch}}
+			if item, err = strategic.Transform(item); err != nil {
+				return nil, fmt.Errorf("rule %d: %v", i, err)
+			}
+		}
+	}
+	return item, nil
+}
+
+// applies reports whether item satisfies the conditions of rule.
+func (m *ResourceModifiers) applies(rule ModifierRule, item *unstructured.Unstructured) (bool, error) {
+	if !m.matchesResource(rule.GroupResource, item.GroupVersionKind().GroupKind()) {
+		return false, nil
+	}
+	if rule.Name != nil && !rule.Name.MatchString(item.GetName()) {
+		return false, nil
+	}
+	if len(rule.Namespaces) > 0 && !containsString(rule.Namespaces, item.GetNamespace()) {
+		return false, nil
+	}
+	if rule.Labels != nil && !rule.Labels.Matches(labels.Set(item.GetLabels())) {
+		return false, nil
+	}
+	if len(rule.Matches) == 0 {
+		return true, nil
+	}
+	document, err := json.Marshal(item.Object)
+	if err != nil {
+		return false, fmt.Errorf("failed to encode item: %v", err)
+	}
+	_, err = rule.Matches.Apply(document)
+	if errors.Is(err, jsonpatch.ErrMissing) || errors.Is(err, jsonpatch.ErrTestFailed) || errors.Is(err, jsonpatch.ErrInvalidIndex) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to match: %v", err)
+	}
+	return true, nil
+}
+
+// matchesResource reports whether a resource name, as Velero writes group
+// resources, stands for gk.
+func (m *ResourceModifiers) matchesResource(resource string, gk schema.GroupKind) bool {
+	resource = strings.ToLower(strings.TrimSpace(resource))
+	if resource == "*" {
+		return true
+	}
+	if m.Resolve != nil {
+		if resolved, ok := m.Resolve(resource); ok && resolved.Group != "*" {
+			return resolved == gk
+		}
+	}
+	gr := schema.ParseGroupResource(resource)
+	if gr.Group != strings.ToLower(gk.Group) {
+		return false
+	}
+	kind := strings.ToLower(gk.Kind)
+	switch {
+	case gr.Resource == kind, gr.Resource == kind+"s", gr.Resource == kind+"es":
+		return true
+	case strings.HasSuffix(kind, "y"):
+		return gr.Resource == strings.TrimSuffix(kind, "y")+"ies"
+	default:
+		return false
+	}
+}
+
+// mergePatch applies a JSON merge patch (RFC 7386) to item.
+func mergePatch(item *unstructured.Unstructured, patch []byte) (*unstructured.Unstructured, error) {
+	document, err := json.Marshal(item.Object)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode item: %v", err)
+	}
+	merged, err := jsonpatch.MergePatch(document, patch)
+	if err != nil {
+		return nil, fmt.Errorf("failed to apply the merge patch: %v", err)
+	}
+	// numbers are decoded as in unstructured objects
+	content, err := ReplaceStream(bytes.NewReader(merged), keep)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode patched item: %v", err)
+	}
+	object, ok := content.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("the merge patch replaced the item with a %T", content)
+	}
+	return &unstructured.Unstructured{Object: object}, nil
+}
+
+func containsString(list []string, s string) bool {
+	for _, entry := range list {
+		if entry == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,51 @@
+package transform
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func TestResourceModifiers_MatchesResource(t *testing.T) {
+	m := &ResourceModifiers{}
+	deployment := schema.GroupKind{Group: "apps", Kind: "Deployment"}
+	assert.True(t, m.matchesResource("deployments.apps", deployment))
+	assert.True(t, m.matchesResource("*", deployment))
+	assert.False(t, m.matchesResource("deployments", deployment), "the group matters")
+	assert.True(t, m.matchesResource("ingresses.networking.k8s.io", schema.GroupKind{Group: "networking.k8s.io", Kind: "Ingress"}))
+	assert.True(t, m.matchesResource("networkpolicies.networking.k8s.io", schema.GroupKind{Group: "networking.k8s.io", Kind: "NetworkPolicy"}))
+	assert.True(t, m.matchesResource("PersistentVolumeClaims", schema.GroupKind{Kind: "PersistentVolumeClaim"}))
+
+	m.Resolve = func(resource string) (schema.GroupKind, bool) {
+		return schema.GroupKind{Group: "apps", Kind: "Deployment"}, resource == "deploy"
+	}
+	assert.True(t, m.matchesResource("deploy", deployment), "discovered names win")
+}
+
+func TestResourceModifiers_Transform(t *testing.T) {
+	patch, err := NewJSONPatch([]byte(`[{"op": "replace", "path": "/spec/storageClassName", "value": "premium"}]`))
+	require.NoError(t, err)
+	modifiers := &ResourceModifiers{Rules: []ModifierRule{
+		{GroupResource: "persistentvolumeclaims", Name: regexp.MustCompile("^mysql"), Patch: patch},
+		// sees the patch of the first rule
+		{GroupResource: "persistentvolumeclaims", MergePatches: [][]byte{[]byte(`{"metadata": {"labels": {"class": "premium"}}}`)}},
+		{GroupResource: "pods", Patch: patch},
+	}}
+	item := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "PersistentVolumeClaim",
+		"metadata":   map[string]interface{}{"name": "mysql-0", "namespace": "shop"},
+		"spec":       map[string]interface{}{"storageClassName": "standard", "resources": map[string]interface{}{"requests": map[string]interface{}{"storage": "1Gi"}}},
+	}}
+	out, err := modifiers.Transform(item)
+	require.NoError(t, err)
+	class, _, _ := unstructured.NestedString(out.Object, "spec", "storageClassName")
+	assert.Equal(t, "premium", class)
+	assert.Equal(t, map[string]string{"class": "premium"}, out.GetLabels())
+	class, _, _ = unstructured.NestedString(item.Object, "spec", "storageClassName")
+	assert.Equal(t, "standard", class, "the item is not modified")
+}
@@ -0,0 +1,84 @@
+package transform
+
+import (
+	"encoding/base64"
+	"unicode/utf8"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// isSecret reports whether object is a core Secret, whose data values are
+// base64 encoded.
+func isSecret(object map[string]interface{}) bool {
+	return object["apiVersion"] == "v1" && object["kind"] == "Secret"
+}
+
+// decodeSecretData returns a copy of the object of a Secret with its data
+// values decoded, and the values left out, not being base64 encoded text, by
+// key. ok is false for other objects.
+func decodeSecretData(object map[string]interface{}) (decoded, binary map[string]interface{}, ok bool) {
+	data, isMap := object["data"].(map[string]interface{})
+	if !isSecret(object) || !isMap {
+		return nil, nil, false
+	}
+	plaintext := make(map[string]interface{}, len(data))
+	for key, value := range data {
+		if s, isString := value.(string); isString {
+			if text, err := base64.StdEncoding.DecodeString(s); err == nil && utf8.Valid(text) {
+				plaintext[key] = string(text)
+				continue
+			}
+		}
+		if binary == nil {
+			binary = make(map[string]interface{})
+		}
+		binary[key] = value
+	}
+	decoded = make(map[string]interface{}, len(object))
+	for key, value := range object {
+		decoded[key] = value
+	}
+	decoded["data"] = plaintext
+	return decoded, binary, true
+}
+
+// replaceItem applies fn with replaceSelected to the object of an item. The
+// data values of a Secret are rewritten decoded, and encoded again; those that
+// are not text are left as they are, keys included.
+func replaceItem(object map[string]interface{}, paths []FieldPath, protected [][]string, fn, key StringFunc) map[string]interface{} {
+	decoded, binary, ok := decodeSecretData(object)
+	if !ok {
+		return replaceSelected(object, paths, protected, fn, key).(map[string]interface{})
+	}
+	out := replaceSelected(decoded, paths, protected, fn, key).(map[string]interface{})
+	data, ok := out["data"].(map[string]interface{})
+	if !ok {
+		return out
+	}
+	encoded := make(map[string]interface{}, len(data)+len(binary))
+	for k, value := range data {
+		if s, ok := value.(string); ok {
+			value = base64.StdEncoding.EncodeToString([]byte(s))
+		}
+		encoded[k] = value
+	}
+	for k, value := range binary {
+		encoded[k] = value
+	}
+	out["data"] = encoded
+	return out
+}
+
+// SecretPlaintext returns a copy of a Secret with the data values that are
+// text decoded, the item itself for other kinds.
+func SecretPlaintext(item *unstructured.Unstructured) *unstructured.Unstructured {
+	decoded, binary, ok := decodeSecretData(item.Object)
+	if !ok {
+		return item
+	}
+	data := decoded["data"].(map[string]interface{})
+	for key, value := range binary {
+		data[key] = value
+	}
+	return &unstructured.Unstructured{Object: decoded}
+}
@@ -0,0 +1,88 @@
+package transform
+
+import (
+	"encoding/base64"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func encode(s string) string {
+	return base64.StdEncoding.EncodeToString([]byte(s))
+}
+
+func secret() *unstructured.Unstructured {
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "Secret",
+		"metadata":   map[string]interface{}{"name": "db-prod", "namespace": "shop"},
+		"type":       "Opaque",
+		"data": map[string]interface{}{
+			"url":          encode("postgres://app@db.prod.example.com:5432/shop"),
+			"prod.pem":     encode("-----BEGIN CERTIFICATE-----"),
+			"keystore.p12": base64.StdEncoding.EncodeToString([]byte{0xff, 0xfe, 'p', 'r', 'o', 'd'}),
+		},
+		"stringData": map[string]interface{}{"host": "db.prod.example.com"},
+	}}
+}
+
+func TestLiteral_SecretData(t *testing.T) {
+	var hits int
+	literal := &Literal{
+		Patterns: map[string]string{"prod": "dr"},
+		OnHit:    func(pattern string, count int) { hits += count },
+	}
+	item := secret()
+	out, err := literal.Transform(item)
+	require.NoError(t, err)
+
+	assert.Equal(t, map[string]interface{}{
+		"url":          encode("postgres://app@db.dr.example.com:5432/shop"),
+		"dr.pem":       encode("-----BEGIN CERTIFICATE-----"),
+		"keystore.p12": item.Object["data"].(map[string]interface{})["keystore.p12"],
+	}, out.Object["data"])
+	assert.Equal(t, map[string]interface{}{"host": "db.dr.example.com"}, out.Object["stringData"])
+	assert.Equal(t, "db-dr", out.GetName())
+	// name, url, key and stringData
+	assert.Equal(t, 4, hits)
+	// the item itself is left alone
+	assert.Equal(t, secret().Object, item.Object)
+
+	// protected and selected data keys are decoded too
+	literal = &Literal{Patterns: map[string]string{"prod": "dr"}, Protected: [][]string{{"data", "url"}}, Paths: []FieldPath{{{Key: "data"}}}}
+	out, err = literal.Transform(item)
+	require.NoError(t, err)
+	data := out.Object["data"].(map[string]interface{})
+	assert.Equal(t, encode("postgres://app@db.prod.example.com:5432/shop"), data["url"])
+	assert.Contains(t, data, "dr.pem")
+	assert.Equal(t, "db-prod", out.GetName())
+}
+
+func TestRegex_SecretData(t *testing.T) {
+	regex, err := NewRegex([]RegexRule{{Expr: `db\.(\w+)\.example\.com`, Replacement: "db.$1.dr.example.com"}})
+	require.NoError(t, err)
+	out, err := regex.Transform(secret())
+	require.NoError(t, err)
+	assert.Equal(t, encode("postgres://app@db.prod.dr.example.com:5432/shop"), out.Object["data"].(map[string]interface{})["url"])
+
+	// only Secrets are decoded
+	configMap := secret()
+	configMap.SetKind("ConfigMap")
+	out, err = regex.Transform(configMap)
+	require.NoError(t, err)
+	assert.Equal(t, configMap.Object["data"], out.Object["data"])
+}
+
+func TestSecretPlaintext(t *testing.T) {
+	item := secret()
+	plaintext := SecretPlaintext(item)
+	data := plaintext.Object["data"].(map[string]interface{})
+	assert.Equal(t, "postgres://app@db.prod.example.com:5432/shop", data["url"])
+	assert.Equal(t, item.Object["data"].(map[string]interface{})["keystore.p12"], data["keystore.p12"])
+	assert.Equal(t, encode("postgres://app@db.prod.example.com:5432/shop"), item.Object["data"].(map[string]interface{})["url"])
+
+	configMap := &unstructured.Unstructured{Object: map[string]interface{}{"apiVersion": "v1", "kind": "ConfigMap"}}
+	assert.Same(t, configMap, SecretPlaintext(configMap))
+}
@@ -0,0 +1,126 @@
+package transform
+
+import (
+	"fmt"
+	"net/netip"
+	"strings"
+
+	"github.com/wrkt/velero-custom-plugins/pkg/sanitize"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// LoadBalancerIPAnnotations request static load balancer IPs, as a
+// comma-separated list.
+var LoadBalancerIPAnnotations = []string{
+	"service.beta.kubernetes.io/azure-load-balancer-ipv4",
+	"service.beta.kubernetes.io/azure-load-balancer-ipv6",
+	"metallb.universe.tf/loadBalancerIPs",
+	"metallb.io/loadBalancerIPs",
+}
+
+// ServiceIPs applies the IP policy of restored Services: the cluster IPs and
+// the load balancer status of the source cluster are cleared, headless
+// Services keeping their None cluster IP, and the static load balancer IPs
+// requested in spec.loadBalancerIP or in LoadBalancerIPAnnotations are only
+// kept when Preserve contains them.
+type ServiceIPs struct {
+	Preserve []netip.Prefix
+}
+
+// ParsePrefixes parses a comma-separated list of IPs and CIDRs.
+func ParsePrefixes(list string) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+	for _, entry := range strings.Split(list, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if !strings.Contains(entry, "/") {
+			addr, err := netip.ParseAddr(entry)
+			if err != nil {
+				return nil, fmt.Errorf("invalid IP %q: %v", entry, err)
+			}
+			prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CIDR %q: %v", entry, err)
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
+}
+
+// Name implements Transformer.
+func (s *ServiceIPs) Name() string {
+	return "service-ips"
+}
+
+// OwnedPaths implements FieldOwner.
+func (s *ServiceIPs) OwnedPaths() [][]string {
+	paths := [][]string{
+		{"spec", "clusterIP"},
+		{"spec", "clusterIPs"},
+		{"spec", "loadBalancerIP"},
+	}
+	for _, key := range LoadBalancerIPAnnotations {
+		paths = append(paths, []string{"metadata", "annotations", key})
+	}
+	return paths
+}
+
+// Transform implements Transformer.
+func (s *ServiceIPs) Transform(item *unstructured.Unstructured) (*unstructured.Unstructured, error) {
+	gvk := item.GroupVersionKind()
+	if gvk.Group != "" || gvk.Kind != "Service" {
+		return item, nil
+	}
+	out := item.DeepCopy()
+	sanitize.Service(out)
+	unstructured.RemoveNestedField(out.Object, "status", "loadBalancer")
+	if status, found, _ := unstructured.NestedMap(out.Object, "status"); found && len(status) == 0 {
+		unstructured.RemoveNestedField(out.Object, "status")
+	}
+
+	if ip, _, _ := unstructured.NestedString(out.Object, "spec", "loadBalancerIP"); ip != "" && !s.preserved(ip) {
+		unstructured.RemoveNestedField(out.Object, "spec", "loadBalancerIP")
+	}
+	if annotations := out.GetAnnotations(); annotations != nil {
+		for _, key := range LoadBalancerIPAnnotations {
+			value, ok := annotations[key]
+			if !ok {
+				continue
+			}
+			var kept []string
+			for _, ip := range strings.Split(value, ",") {
+				if s.preserved(strings.TrimSpace(ip)) {
+					kept = append(kept, strings.TrimSpace(ip))
+				}
+			}
+			if len(kept) == 0 {
+				delete(annotations, key)
+			} else {
+				annotations[key] = strings.Join(kept, ",")
+			}
+		}
+		if len(annotations) == 0 {
+			annotations = nil
+		}
+		out.SetAnnotations(annotations)
+	}
+	return out, nil
+}
+
+func (s *ServiceIPs) preserved(ip string) bool {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	for _, prefix := range s.Preserve {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,80 @@
+package transform
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestParsePrefixes(t *testing.T) {
+	prefixes, err := ParsePrefixes("203.0.113.10, 198.51.100.0/24,2001:db8::1,")
+	require.NoError(t, err)
+	assert.Len(t, prefixes, 3)
+	assert.Equal(t, "203.0.113.10/32", prefixes[0].String())
+	assert.Equal(t, "2001:db8::1/128", prefixes[2].String())
+
+	_, err = ParsePrefixes("203.0.113.300")
+	assert.Error(t, err)
+	_, err = ParsePrefixes("198.51.100.0/33")
+	assert.Error(t, err)
+}
+
+func TestServiceIPs(t *testing.T) {
+	preserve, err := ParsePrefixes("203.0.113.0/24")
+	require.NoError(t, err)
+	serviceIPs := &ServiceIPs{Preserve: preserve}
+
+	service := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "Service",
+		"metadata": map[string]interface{}{"name": "web", "annotations": map[string]interface{}{
+			"metallb.universe.tf/loadBalancerIPs": "203.0.113.10,192.0.2.10",
+			"example.com/owner":                   "team",
+		}},
+		"spec": map[string]interface{}{
+			"type":           "LoadBalancer",
+			"clusterIP":      "10.0.0.1",
+			"clusterIPs":     []interface{}{"10.0.0.1"},
+			"loadBalancerIP": "203.0.113.10",
+		},
+		"status": map[string]interface{}{"loadBalancer": map[string]interface{}{"ingress": []interface{}{map[string]interface{}{"ip": "203.0.113.10"}}}},
+	}}
+	original := service.DeepCopy()
+
+	output, err := serviceIPs.Transform(service)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"type": "LoadBalancer", "loadBalancerIP": "203.0.113.10"}, output.Object["spec"])
+	assert.NotContains(t, output.Object, "status")
+	assert.Equal(t, map[string]string{"metallb.universe.tf/loadBalancerIPs": "203.0.113.10", "example.com/owner": "team"}, output.GetAnnotations())
+	assert.Equal(t, original, service)
+
+	// IPs outside of the allowlist are released
+	output, err = (&ServiceIPs{}).Transform(service)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"type": "LoadBalancer"}, output.Object["spec"])
+	assert.Equal(t, map[string]string{"example.com/owner": "team"}, output.GetAnnotations())
+}
+
+func TestServiceIPs_Headless(t *testing.T) {
+	service := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "Service",
+		"metadata":   map[string]interface{}{"name": "db"},
+		"spec":       map[string]interface{}{"clusterIP": "None", "clusterIPs": []interface{}{"None"}},
+	}}
+	output, err := (&ServiceIPs{}).Transform(service)
+	require.NoError(t, err)
+	assert.Equal(t, service, output)
+
+	// Knative Services are not core Services
+	knative := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "serving.knative.dev/v1",
+		"kind":       "Service",
+		"spec":       map[string]interface{}{"clusterIP": "10.0.0.1"},
+	}}
+	output, err = (&ServiceIPs{}).Transform(knative)
+	require.NoError(t, err)
+	assert.Equal(t, knative, output)
+}
@@ -0,0 +1,36 @@
+package transform
+
+import "strconv"
+
+// Size estimates the JSON encoded size of value in bytes without encoding it.
+// Escaping is ignored, so the estimate is a lower bound.
+func Size(value interface{}) int {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		size := 2 // {}
+		for key, child := range v {
+			size += len(key) + 4 // quotes, colon and comma
+			size += Size(child)
+		}
+		return size
+	case []interface{}:
+		size := 2 // []
+		for _, child := range v {
+			size += Size(child) + 1
+		}
+		return size
+	case string:
+		return len(v) + 2
+	case int64:
+		return len(strconv.FormatInt(v, 10))
+	case float64:
+		return len(strconv.FormatFloat(v, 'g', -1, 64))
+	case bool:
+		if v {
+			return 4
+		}
+		return 5
+	default:
+		return 4 // null
+	}
+}
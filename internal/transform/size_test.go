@@ -0,0 +1,25 @@
+package transform
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSize(t *testing.T) {
+	value := map[string]interface{}{
+		"name":    "foo",
+		"ports":   []interface{}{int64(80), int64(443)},
+		"ratio":   0.5,
+		"enabled": true,
+		"nothing": nil,
+	}
+
+	encoded, err := json.Marshal(value)
+	require.NoError(t, err)
+
+	// The estimate over-counts separators slightly but stays close.
+	assert.InDelta(t, len(encoded), Size(value), 8)
+}
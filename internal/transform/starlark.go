@@ -0,0 +1,198 @@
+package transform
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	starjson "go.starlark.net/lib/json"
+	starmath "go.starlark.net/lib/math"
+	"go.starlark.net/starlark"
+	"go.starlark.net/syntax"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+const (
+	// starlarkTimeout bounds the run of a Starlark script on one item,
+	// whatever its step limit.
+	starlarkTimeout = 5 * time.Second
+	// DefaultStarlarkMaxSteps is the default step limit of a run.
+	DefaultStarlarkMaxSteps = 1000000
+	// starlarkMaxDepth bounds the nesting of the values a script returns,
+	// which may contain themselves.
+	starlarkMaxDepth = 100
+	// starlarkFunction is the global function a script defines.
+	starlarkFunction = "transform"
+)
+
+// starlarkPredeclared are the modules scripts can use besides the built-ins.
+// Neither reaches the file system, the network or the clock.
+var starlarkPredeclared = starlark.StringDict{
+	"json": starjson.Module,
+	"math": starmath.Module,
+}
+
+// Starlark runs the item through the transform function of a Starlark script
+// and restores the dict it returns. Starlark has no access to the file
+// system, the network or the environment, and scripts cannot load others, so
+// that scripts can come from tenants. Each run is bounded by MaxSteps
+// execution steps and by a timeout.
+type Starlark struct {
+	Program  *starlark.Program
+	MaxSteps uint64
+}
+
+// NewStarlark parses and compiles a Starlark script.
+func NewStarlark(script string, maxSteps uint64) (*Starlark, error) {
+	_, program, err := starlark.SourceProgramOptions(&syntax.FileOptions{
+		Set:             true,
+		While:           true,
+		TopLevelControl: true,
+		GlobalReassign:  true,
+	}, "script.star", script, starlarkPredeclared.Has)
+	if err != nil {
+		return nil, fmt.Errorf("invalid Starlark script: %v", err)
+	}
+	return &Starlark{Program: program, MaxSteps: maxSteps}, nil
+}
+
+// Name implements Transformer.
+func (s *Starlark) Name() string {
+	return "starlark"
+}
+
+// Transform implements Transformer.
+func (s *Starlark) Transform(item *unstructured.Unstructured) (*unstructured.Unstructured, error) {
+	thread := &starlark.Thread{
+		Name: "transform",
+		Load: func(*starlark.Thread, string) (starlark.StringDict, error) {
+			return nil, fmt.Errorf("load is not allowed")
+		},
+		Print: func(*starlark.Thread, string) {},
+	}
+	thread.SetMaxExecutionSteps(s.MaxSteps)
+	timer := time.AfterFunc(starlarkTimeout, func() {
+		thread.Cancel(fmt.Sprintf("timed out after %v", starlarkTimeout))
+	})
+	defer timer.Stop()
+
+	globals, err := s.Program.Init(thread, starlarkPredeclared)
+	if err != nil {
+		return nil, fmt.Errorf("Starlark script failed: %v", err)
+	}
+	function, ok := globals[starlarkFunction].(*starlark.Function)
+	if !ok {
+		return nil, fmt.Errorf("the Starlark script does not define a %s function", starlarkFunction)
+	}
+	input, err := toStarlark(item.Object)
+	if err != nil {
+		return nil, err
+	}
+	result, err := starlark.Call(thread, function, starlark.Tuple{input}, nil)
+	if err != nil {
+		return nil, fmt.Errorf("Starlark script failed: %v", err)
+	}
+
+	dict, ok := result.(*starlark.Dict)
+	if !ok {
+		return nil, fmt.Errorf("the Starlark script returned a %s, not a dict", result.Type())
+	}
+	content, err := fromStarlark(dict, 0)
+	if err != nil {
+		return nil, fmt.Errorf("invalid Starlark output: %v", err)
+	}
+	return &unstructured.Unstructured{Object: content.(map[string]interface{})}, nil
+}
+
+// toStarlark converts an unstructured value to Starlark.
+func toStarlark(value interface{}) (starlark.Value, error) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		dict := starlark.NewDict(len(v))
+		for key, field := range v {
+			converted, err := toStarlark(field)
+			if err != nil {
+				return nil, err
+			}
+			if err := dict.SetKey(starlark.String(key), converted); err != nil {
+				return nil, err
+			}
+		}
+		return dict, nil
+	case []interface{}:
+		list := make([]starlark.Value, 0, len(v))
+		for _, entry := range v {
+			converted, err := toStarlark(entry)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, converted)
+		}
+		return starlark.NewList(list), nil
+	case string:
+		return starlark.String(v), nil
+	case bool:
+		return starlark.Bool(v), nil
+	case int64:
+		return starlark.MakeInt64(v), nil
+	case float64:
+		return starlark.Float(v), nil
+	case nil:
+		return starlark.None, nil
+	default:
+		return nil, fmt.Errorf("cannot convert a %T to Starlark", value)
+	}
+}
+
+// fromStarlark converts a Starlark value to an unstructured value.
+func fromStarlark(value starlark.Value, depth int) (interface{}, error) {
+	if depth >= starlarkMaxDepth {
+		return nil, fmt.Errorf("values nested deeper than %d", starlarkMaxDepth)
+	}
+	switch v := value.(type) {
+	case *starlark.Dict:
+		object := make(map[string]interface{}, v.Len())
+		for _, entry := range v.Items() {
+			key, ok := entry[0].(starlark.String)
+			if !ok {
+				return nil, fmt.Errorf("key %s is not a string", entry[0])
+			}
+			field, err := fromStarlark(entry[1], depth+1)
+			if err != nil {
+				return nil, err
+			}
+			object[string(key)] = field
+		}
+		return object, nil
+	case *starlark.List, starlark.Tuple:
+		sequence := v.(starlark.Indexable)
+		list := make([]interface{}, 0, sequence.Len())
+		for i := 0; i < sequence.Len(); i++ {
+			entry, err := fromStarlark(sequence.Index(i), depth+1)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, entry)
+		}
+		return list, nil
+	case starlark.String:
+		return string(v), nil
+	case starlark.Bool:
+		return bool(v), nil
+	case starlark.Int:
+		n, ok := v.Int64()
+		if !ok {
+			return nil, fmt.Errorf("integer %s out of range", v)
+		}
+		return n, nil
+	case starlark.Float:
+		if math.IsNaN(float64(v)) || math.IsInf(float64(v), 0) {
+			return nil, fmt.Errorf("invalid number %v", v)
+		}
+		return float64(v), nil
+	case starlark.NoneType:
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("cannot convert a Starlark %s", value.Type())
+	}
+}
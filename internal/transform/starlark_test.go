@@ -0,0 +1,79 @@
+package transform
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestStarlark_Transform(t *testing.T) {
+	script, err := NewStarlark(`
+def transform(item):
+    containers = [c for c in item["spec"]["template"]["spec"]["containers"] if c["name"] != "debug"]
+    port = containers[0]["ports"][0]["containerPort"]
+    containers[0]["ports"][0]["containerPort"] = port + 1000
+    item["spec"]["template"]["spec"]["containers"] = containers
+    name = item["metadata"]["name"]
+    if name.startswith("web-"):
+        item["metadata"]["name"] = "site-" + name.removeprefix("web-")
+    item["metadata"]["labels"] = {"restored-port": str(port + 1000)}
+    item["metadata"]["annotations"] = {"config": json.encode({"weight": math.floor(2.5)})}
+    item["spec"]["weight"] = 0.5
+    return item
+`, DefaultStarlarkMaxSteps)
+	require.NoError(t, err)
+
+	deployment := &unstructured.Unstructured{Object: map[string]interface{}{
+		"kind":     "Deployment",
+		"metadata": map[string]interface{}{"name": "web-shop"},
+		"spec": map[string]interface{}{
+			"paused": nil,
+			"template": map[string]interface{}{"spec": map[string]interface{}{"containers": []interface{}{
+				map[string]interface{}{"name": "web", "args": []interface{}{}, "ports": []interface{}{map[string]interface{}{"containerPort": int64(8080)}}},
+				map[string]interface{}{"name": "debug"},
+			}}},
+		},
+	}}
+	out, err := script.Transform(deployment)
+	require.NoError(t, err)
+	assert.Equal(t, "site-shop", out.GetName())
+	assert.Equal(t, map[string]string{"restored-port": "9080"}, out.GetLabels())
+	assert.Equal(t, map[string]string{"config": `{"weight":2}`}, out.GetAnnotations())
+	assert.Equal(t, map[string]interface{}{
+		"paused": nil,
+		"weight": 0.5,
+		"template": map[string]interface{}{"spec": map[string]interface{}{"containers": []interface{}{
+			map[string]interface{}{"name": "web", "args": []interface{}{}, "ports": []interface{}{map[string]interface{}{"containerPort": int64(9080)}}},
+		}}},
+	}, out.Object["spec"])
+	assert.Equal(t, "web-shop", deployment.GetName(), "input must be left untouched")
+}
+
+func TestStarlark_Errors(t *testing.T) {
+	_, err := NewStarlark("def transform(item)", DefaultStarlarkMaxSteps)
+	assert.Error(t, err)
+	_, err = NewStarlark(`load("other.star", "x")`, DefaultStarlarkMaxSteps)
+	assert.NoError(t, err, "load fails when run")
+
+	item := &unstructured.Unstructured{Object: map[string]interface{}{"kind": "ConfigMap", "data": map[string]interface{}{"a": "b"}}}
+	for _, script := range []string{
+		"x = 1",
+		`load("other.star", "x")`,
+		"def transform(item):\n    return None",
+		"def transform(item):\n    return [item]",
+		"def transform(item):\n    fail('refused')",
+		"def transform(item):\n    item[1] = 'x'\n    return item",
+		"def transform(item):\n    item['self'] = [item]\n    item['self'][0]['self'] = item['self']\n    return item",
+		"def transform(item):\n    item['big'] = 1 << 70\n    return item",
+		"def transform(item):\n    item['fn'] = transform\n    return item",
+		"def transform(item):\n    while True:\n        pass",
+		"def transform(item):\n    return transform(item)",
+	} {
+		star, err := NewStarlark(script, 10000)
+		require.NoError(t, err, script)
+		_, err = star.Transform(item)
+		assert.Error(t, err, script)
+	}
+}
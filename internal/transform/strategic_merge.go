@@ -0,0 +1,70 @@
+package transform
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	jsonpatch "github.com/evanphx/json-patch"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/util/strategicpatch"
+	"k8s.io/client-go/kubernetes/scheme"
+)
+
+// StrategicMerge merges a patch into the items of each kind, to add labels,
+// annotations or tolerations at restore time. Built-in kinds get a strategic
+// merge patch, lists such as containers being merged on their key; the other
+// kinds, custom resources included, a JSON merge patch (RFC 7386), as kubectl
+// patch does.
+type StrategicMerge struct {
+	// Patches maps kinds to the JSON object merged into their items.
+	Patches map[string][]byte
+}
+
+// NewStrategicMerge checks that the patches are JSON objects.
+func NewStrategicMerge(patches map[string][]byte) (*StrategicMerge, error) {
+	for kind, patch := range patches {
+		var object map[string]interface{}
+		if err := json.Unmarshal(patch, &object); err != nil || object == nil {
+			return nil, fmt.Errorf("the patch of %s is not an object", kind)
+		}
+	}
+	return &StrategicMerge{Patches: patches}, nil
+}
+
+// Name implements Transformer.
+func (s *StrategicMerge) Name() string {
+	return "strategic-merge"
+}
+
+// Transform implements Transformer.
+func (s *StrategicMerge) Transform(item *unstructured.Unstructured) (*unstructured.Unstructured, error) {
+	patch, ok := s.Patches[item.GetKind()]
+	if !ok {
+		return item, nil
+	}
+
+	document, err := json.Marshal(item.Object)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode item: %v", err)
+	}
+	var merged []byte
+	if typed, err := scheme.Scheme.New(item.GroupVersionKind()); err == nil {
+		merged, err = strategicpatch.StrategicMergePatch(document, patch, typed)
+		if err != nil {
+			return nil, fmt.Errorf("failed to apply the strategic merge patch of %s: %v", item.GetKind(), err)
+		}
+	} else {
+		merged, err = jsonpatch.MergePatch(document, patch)
+		if err != nil {
+			return nil, fmt.Errorf("failed to apply the merge patch of %s: %v", item.GetKind(), err)
+		}
+	}
+
+	// numbers are decoded as in unstructured objects
+	content, err := ReplaceStream(bytes.NewReader(merged), keep)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode patched item: %v", err)
+	}
+	return &unstructured.Unstructured{Object: content.(map[string]interface{})}, nil
+}
@@ -0,0 +1,47 @@
+package transform
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestStrategicMerge_Transform(t *testing.T) {
+	merge, err := NewStrategicMerge(map[string][]byte{
+		"Pod":    []byte(`{"spec":{"tolerations":[{"key":"dr","operator":"Exists"}],"nodeSelector":{"pool":null}}}`),
+		"Widget": []byte(`{"spec":{"size":null,"color":"blue"}}`),
+	})
+	require.NoError(t, err)
+
+	pod := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "Pod",
+		"spec":       map[string]interface{}{"nodeSelector": map[string]interface{}{"pool": "prod", "zone": "a"}},
+	}}
+	out, err := merge.Transform(pod)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"nodeSelector": map[string]interface{}{"zone": "a"},
+		"tolerations":  []interface{}{map[string]interface{}{"key": "dr", "operator": "Exists"}},
+	}, out.Object["spec"])
+	assert.Equal(t, map[string]interface{}{"pool": "prod", "zone": "a"}, pod.Object["spec"].(map[string]interface{})["nodeSelector"], "input must be left untouched")
+
+	widget := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "example.com/v1",
+		"kind":       "Widget",
+		"spec":       map[string]interface{}{"size": int64(3)},
+	}}
+	out, err = merge.Transform(widget)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"color": "blue"}, out.Object["spec"])
+
+	service := &unstructured.Unstructured{Object: map[string]interface{}{"apiVersion": "v1", "kind": "Service"}}
+	out, err = merge.Transform(service)
+	require.NoError(t, err)
+	assert.Same(t, service, out)
+
+	_, err = NewStrategicMerge(map[string][]byte{"Pod": []byte(`[]`)})
+	assert.Error(t, err)
+}
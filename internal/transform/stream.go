@@ -0,0 +1,236 @@
+// Package transform holds the item transformation engine used by the restore
+// plugin.
+package transform
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// StringFunc rewrites a single string token of a JSON document.
+type StringFunc func(string) string
+
+// ReplaceStream decodes the JSON document read from r token by token and
+// applies fn to every string token (object keys included) as soon as it is
+// read, with the number types of unstructured objects. Only the current token
+// is ever held as text besides the decoded value. It serves the transformers
+// producing JSON, such as patches; the literal and regex transformers rewrite
+// the item Velero already decoded, with ReplaceTokens, and never marshal it.
+func ReplaceStream(r io.Reader, fn StringFunc) (interface{}, error) {
+	dec := json.NewDecoder(r)
+	dec.UseNumber()
+
+	value, err := decodeValue(dec, fn)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, fmt.Errorf("unexpected data after top-level value")
+	}
+	return value, nil
+}
+
+// ReplaceTokens applies fn to every string token (object keys included) of an
+// already decoded JSON value and returns the rewritten copy. The input is left
+// untouched.
+func ReplaceTokens(value interface{}, fn StringFunc) interface{} {
+	return replaceTokens(value, fn, fn)
+}
+
+// ReplaceValues is like ReplaceTokens but leaves object keys as they are, so
+// that rewrites cannot break field names.
+func ReplaceValues(value interface{}, fn StringFunc) interface{} {
+	return replaceTokens(value, fn, keep)
+}
+
+// replaceTokens applies fn to the string values and key to the object keys.
+func replaceTokens(value interface{}, fn, key StringFunc) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(v))
+		for k, child := range v {
+			out[key(k)] = replaceTokens(child, fn, key)
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for i, child := range v {
+			out[i] = replaceTokens(child, fn, key)
+		}
+		return out
+	case string:
+		return fn(v)
+	default:
+		return v
+	}
+}
+
+// ReplaceTokensExcept is like ReplaceTokens but leaves the subtrees found at
+// the protected paths untouched, along with every key leading to them. Paths go through object
+// keys only: lists are traversed without consuming a path segment.
+func ReplaceTokensExcept(value interface{}, protected [][]string, fn StringFunc) interface{} {
+	return replaceTokensExcept(value, protected, fn, fn)
+}
+
+func replaceTokensExcept(value interface{}, protected [][]string, fn, key StringFunc) interface{} {
+	if len(protected) == 0 {
+		return replaceTokens(value, fn, key)
+	}
+	return replaceExcept(value, newPathTree(protected), fn, key)
+}
+
+// pathTree indexes protected paths by segment. A nil child marks the end of a
+// protected path.
+type pathTree map[string]pathTree
+
+func newPathTree(paths [][]string) pathTree {
+	root := pathTree{}
+	for _, path := range paths {
+		if len(path) == 0 {
+			continue
+		}
+		node := root
+		for i, segment := range path {
+			if i == len(path)-1 {
+				node[segment] = nil
+				break
+			}
+			child, ok := node[segment]
+			if ok && child == nil {
+				// a shorter path already protects this subtree
+				break
+			}
+			if !ok {
+				child = pathTree{}
+				node[segment] = child
+			}
+			node = child
+		}
+	}
+	return root
+}
+
+func replaceExcept(value interface{}, tree pathTree, fn, key StringFunc) interface{} {
+	if tree == nil {
+		return replaceTokens(value, fn, key)
+	}
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(v))
+		for k, child := range v {
+			subtree, ok := tree[k]
+			switch {
+			case ok && subtree == nil:
+				out[k] = child
+			case ok:
+				// keys leading to a protected path are kept too, so the
+				// protected subtree stays where it is
+				out[k] = replaceExcept(child, subtree, fn, key)
+			}
+		}
+		for k, child := range v {
+			if _, ok := tree[k]; ok {
+				continue
+			}
+			renamed := key(k)
+			if _, ok := tree[renamed]; ok {
+				// nothing is moved into a protected path
+				renamed = k
+			}
+			out[renamed] = replaceTokens(child, fn, key)
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for i, child := range v {
+			out[i] = replaceExcept(child, tree, fn, key)
+		}
+		return out
+	case string:
+		return fn(v)
+	default:
+		return v
+	}
+}
+
+func decodeValue(dec *json.Decoder, fn StringFunc) (interface{}, error) {
+	token, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	switch t := token.(type) {
+	case json.Delim:
+		switch t {
+		case '{':
+			return decodeObject(dec, fn)
+		case '[':
+			return decodeArray(dec, fn)
+		default:
+			return nil, fmt.Errorf("unexpected delimiter %q", t)
+		}
+	case string:
+		return fn(t), nil
+	case json.Number:
+		return convertNumber(t)
+	default:
+		// bool or nil
+		return t, nil
+	}
+}
+
+func decodeObject(dec *json.Decoder, fn StringFunc) (map[string]interface{}, error) {
+	obj := make(map[string]interface{})
+	for dec.More() {
+		token, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		key, ok := token.(string)
+		if !ok {
+			return nil, fmt.Errorf("unexpected object key %v", token)
+		}
+		value, err := decodeValue(dec, fn)
+		if err != nil {
+			return nil, err
+		}
+		obj[fn(key)] = value
+	}
+	// closing '}'
+	if _, err := dec.Token(); err != nil {
+		return nil, err
+	}
+	return obj, nil
+}
+
+func decodeArray(dec *json.Decoder, fn StringFunc) ([]interface{}, error) {
+	arr := make([]interface{}, 0)
+	for dec.More() {
+		value, err := decodeValue(dec, fn)
+		if err != nil {
+			return nil, err
+		}
+		arr = append(arr, value)
+	}
+	// closing ']'
+	if _, err := dec.Token(); err != nil {
+		return nil, err
+	}
+	return arr, nil
+}
+
+// convertNumber mirrors the unstructured JSON scheme: integers become int64,
+// everything else float64.
+func convertNumber(n json.Number) (interface{}, error) {
+	if i, err := strconv.ParseInt(n.String(), 10, 64); err == nil {
+		return i, nil
+	}
+	f, err := strconv.ParseFloat(n.String(), 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid number %q: %v", n, err)
+	}
+	return f, nil
+}
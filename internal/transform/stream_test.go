@@ -0,0 +1,101 @@
+package transform
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func fooToBar(s string) string {
+	return strings.ReplaceAll(s, "foo", "bar")
+}
+
+func TestReplaceStream(t *testing.T) {
+	doc := `{"foo": "foo-production", "spec": {"ports": [80, 1.5], "enabled": true, "hosts": ["a.foo.com", null]}}`
+
+	value, err := ReplaceStream(strings.NewReader(doc), fooToBar)
+	require.NoError(t, err)
+
+	expected := map[string]interface{}{
+		"bar": "bar-production",
+		"spec": map[string]interface{}{
+			"ports":   []interface{}{int64(80), 1.5},
+			"enabled": true,
+			"hosts":   []interface{}{"a.bar.com", nil},
+		},
+	}
+	assert.Equal(t, expected, value)
+}
+
+func TestReplaceStream_InvalidDocument(t *testing.T) {
+	_, err := ReplaceStream(strings.NewReader(`{"foo": `), fooToBar)
+	assert.Error(t, err)
+
+	_, err = ReplaceStream(strings.NewReader(`{} {}`), fooToBar)
+	assert.Error(t, err)
+}
+
+func TestReplaceTokens(t *testing.T) {
+	input := map[string]interface{}{
+		"foo":   "foo",
+		"list":  []interface{}{"foo", int64(1)},
+		"other": false,
+	}
+
+	output := ReplaceTokens(input, fooToBar)
+
+	assert.Equal(t, map[string]interface{}{
+		"bar":   "bar",
+		"list":  []interface{}{"bar", int64(1)},
+		"other": false,
+	}, output)
+	// the input must not be modified
+	assert.Equal(t, "foo", input["foo"])
+}
+
+func TestReplaceTokens_MatchesStream(t *testing.T) {
+	doc := `{"metadata": {"name": "foo", "labels": {"app": "foo"}}, "data": {"foo.conf": "host=foo"}}`
+
+	var decoded interface{}
+	require.NoError(t, json.Unmarshal([]byte(doc), &decoded))
+
+	streamed, err := ReplaceStream(strings.NewReader(doc), fooToBar)
+	require.NoError(t, err)
+
+	assert.Equal(t, streamed, ReplaceTokens(decoded, fooToBar))
+}
+
+func TestReplaceTokensExcept(t *testing.T) {
+	input := map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"name":   "foo",
+			"labels": map[string]interface{}{"foo": "foo"},
+		},
+		"spec": map[string]interface{}{
+			"items": []interface{}{
+				map[string]interface{}{"foo": "foo", "keep": "foo"},
+			},
+		},
+	}
+
+	output := ReplaceTokensExcept(input, [][]string{
+		{"metadata", "name"},
+		{"spec", "items", "keep"},
+		{"missing", "path"},
+	}, fooToBar)
+
+	assert.Equal(t, map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"name":   "foo",
+			"labels": map[string]interface{}{"bar": "bar"},
+		},
+		"spec": map[string]interface{}{
+			"items": []interface{}{
+				map[string]interface{}{"bar": "bar", "keep": "foo"},
+			},
+		},
+	}, output)
+}
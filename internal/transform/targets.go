@@ -0,0 +1,147 @@
+package transform
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// TargetsAnnotation is the default annotation listing the clusters an item is
+// fanned out to.
+const TargetsAnnotation = "agoracalyce.io/target-clusters"
+
+// TargetRule fans the items of the namespaces matching one of Namespaces, shell
+// patterns such as shop-*, out to Clusters.
+type TargetRule struct {
+	Namespaces []string
+	Clusters   []string
+}
+
+// ClusterTargets tags the items of a backup restored once, to a hub, with the
+// clusters multi-cluster tools such as Rancher Fleet or Open Cluster
+// Management deploy them to. Annotation lists the clusters, comma separated.
+// With a LabelPrefix, the item also gets one label per cluster, set to
+// "true", for the tools selecting items with label selectors; the labels of
+// the prefix naming other clusters are removed.
+type ClusterTargets struct {
+	Rules       []TargetRule
+	Annotation  string
+	LabelPrefix string
+	// Namespace is the namespace the item had in the backup, the one the rules
+	// match. Cluster-scoped items are never tagged.
+	Namespace string
+}
+
+// Validate checks the rules and that the labels are valid label keys.
+func (c *ClusterTargets) Validate() error {
+	if errs := validation.IsQualifiedName(c.Annotation); len(errs) > 0 {
+		return fmt.Errorf("invalid annotation %q: %s", c.Annotation, strings.Join(errs, ", "))
+	}
+	for i, rule := range c.Rules {
+		if len(rule.Namespaces) == 0 || len(rule.Clusters) == 0 {
+			return fmt.Errorf("rule %d: namespaces and clusters are required", i)
+		}
+		for _, pattern := range rule.Namespaces {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return fmt.Errorf("rule %d: invalid namespace pattern %q: %v", i, pattern, err)
+			}
+		}
+		for _, cluster := range rule.Clusters {
+			if strings.ContainsAny(cluster, ", ") || cluster == "" {
+				return fmt.Errorf("rule %d: invalid cluster name %q", i, cluster)
+			}
+			if c.LabelPrefix == "" {
+				continue
+			}
+			if errs := validation.IsQualifiedName(c.LabelPrefix + cluster); len(errs) > 0 {
+				return fmt.Errorf("rule %d: invalid label %q: %s", i, c.LabelPrefix+cluster, strings.Join(errs, ", "))
+			}
+		}
+	}
+	return nil
+}
+
+// Name implements Transformer.
+func (c *ClusterTargets) Name() string {
+	return "cluster-targets"
+}
+
+// OwnedPaths implements FieldOwner.
+func (c *ClusterTargets) OwnedPaths() [][]string {
+	paths := [][]string{{"metadata", "annotations", c.Annotation}}
+	if c.LabelPrefix == "" {
+		return paths
+	}
+	for _, cluster := range c.clusters() {
+		paths = append(paths, []string{"metadata", "labels", c.LabelPrefix + cluster})
+	}
+	return paths
+}
+
+// Transform implements Transformer.
+func (c *ClusterTargets) Transform(item *unstructured.Unstructured) (*unstructured.Unstructured, error) {
+	clusters := c.clusters()
+	if len(clusters) == 0 {
+		return item, nil
+	}
+
+	out := item.DeepCopy()
+	annotations := out.GetAnnotations()
+	if annotations == nil {
+		annotations = make(map[string]string, 1)
+	}
+	annotations[c.Annotation] = strings.Join(clusters, ",")
+	out.SetAnnotations(annotations)
+
+	if c.LabelPrefix != "" {
+		labels := out.GetLabels()
+		if labels == nil {
+			labels = make(map[string]string, len(clusters))
+		}
+		for key := range labels {
+			if strings.HasPrefix(key, c.LabelPrefix) {
+				delete(labels, key)
+			}
+		}
+		for _, cluster := range clusters {
+			labels[c.LabelPrefix+cluster] = "true"
+		}
+		out.SetLabels(labels)
+	}
+	return out, nil
+}
+
+// clusters returns the clusters of the rules matching the namespace, sorted.
+func (c *ClusterTargets) clusters() []string {
+	if c.Namespace == "" {
+		return nil
+	}
+	seen := make(map[string]bool)
+	var clusters []string
+	for _, rule := range c.Rules {
+		if !matchesAny(rule.Namespaces, c.Namespace) {
+			continue
+		}
+		for _, cluster := range rule.Clusters {
+			if !seen[cluster] {
+				seen[cluster] = true
+				clusters = append(clusters, cluster)
+			}
+		}
+	}
+	sort.Strings(clusters)
+	return clusters
+}
+
+func matchesAny(patterns []string, namespace string) bool {
+	for _, pattern := range patterns {
+		if matched, _ := path.Match(pattern, namespace); matched {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,54 @@
+package transform
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestClusterTargets_Transform(t *testing.T) {
+	targets := &ClusterTargets{
+		Rules: []TargetRule{
+			{Namespaces: []string{"shop", "shop-*"}, Clusters: []string{"dr-west", "dr-east"}},
+			{Namespaces: []string{"shop-eu"}, Clusters: []string{"dr-eu", "dr-east"}},
+		},
+		Annotation:  TargetsAnnotation,
+		LabelPrefix: "targets.example.com/",
+	}
+	require.NoError(t, targets.Validate())
+
+	item := &unstructured.Unstructured{}
+	item.SetLabels(map[string]string{"app": "web", "targets.example.com/prod": "true"})
+	targets.Namespace = "shop-eu"
+	out, err := targets.Transform(item)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{TargetsAnnotation: "dr-east,dr-eu,dr-west"}, out.GetAnnotations())
+	assert.Equal(t, map[string]string{
+		"app":                         "web",
+		"targets.example.com/dr-east": "true",
+		"targets.example.com/dr-eu":   "true",
+		"targets.example.com/dr-west": "true",
+	}, out.GetLabels())
+	assert.Contains(t, targets.OwnedPaths(), []string{"metadata", "labels", "targets.example.com/dr-eu"})
+
+	for _, namespace := range []string{"blog", ""} {
+		targets.Namespace = namespace
+		out, err = targets.Transform(item)
+		require.NoError(t, err)
+		assert.Same(t, item, out, namespace)
+	}
+}
+
+func TestClusterTargets_Validate(t *testing.T) {
+	for _, targets := range []*ClusterTargets{
+		{Annotation: "not an annotation"},
+		{Annotation: TargetsAnnotation, Rules: []TargetRule{{Namespaces: []string{"shop"}}}},
+		{Annotation: TargetsAnnotation, Rules: []TargetRule{{Namespaces: []string{"shop["}, Clusters: []string{"dr"}}}},
+		{Annotation: TargetsAnnotation, Rules: []TargetRule{{Namespaces: []string{"shop"}, Clusters: []string{"dr,east"}}}},
+		{Annotation: TargetsAnnotation, LabelPrefix: "targets.example.com/", Rules: []TargetRule{{Namespaces: []string{"shop"}, Clusters: []string{"dr/east"}}}},
+	} {
+		assert.Error(t, targets.Validate())
+	}
+}
@@ -0,0 +1,207 @@
+package transform
+
+import (
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// Anti-affinity modes of TopologySpread.
+const (
+	// AntiAffinityAuto makes the required pod anti-affinity terms preferred
+	// when the target cluster has fewer domains for their topology key than
+	// the workload has replicas.
+	AntiAffinityAuto = "auto"
+	// AntiAffinityPreferred makes every required term preferred.
+	AntiAffinityPreferred = "preferred"
+	// AntiAffinityKeep leaves the terms alone.
+	AntiAffinityKeep = "keep"
+)
+
+// scheduleAnyway is the whenUnsatisfiable value that never blocks scheduling.
+const scheduleAnyway = "ScheduleAnyway"
+
+// TopologySpread adapts the placement constraints of pod templates to a
+// target cluster smaller than the one of the backup, so that workloads spread
+// over 50 nodes still schedule on 5. The sizes come from Nodes, the labels of
+// the schedulable nodes of the target cluster.
+type TopologySpread struct {
+	// MaxNodes restricts the transformer to target clusters of at most as
+	// many nodes, 0 for any size
+	MaxNodes int
+	// WhenUnsatisfiable, when set, replaces the one of every spread
+	// constraint
+	WhenUnsatisfiable string
+	// MinMaxSkew raises the maxSkew of the spread constraints
+	MinMaxSkew int64
+	// AntiAffinity is the mode applied to the required pod anti-affinity
+	AntiAffinity string
+	// Inject are the spread constraints given to the pod templates without
+	// any, selecting the pods of the template when they select nothing
+	Inject []map[string]interface{}
+	Nodes  func() ([]map[string]string, error)
+}
+
+// Validate checks the policy.
+func (t *TopologySpread) Validate() error {
+	switch t.AntiAffinity {
+	case AntiAffinityAuto, AntiAffinityPreferred, AntiAffinityKeep:
+	default:
+		return fmt.Errorf("unknown anti-affinity mode %q, expected one of %s, %s or %s", t.AntiAffinity, AntiAffinityAuto, AntiAffinityPreferred, AntiAffinityKeep)
+	}
+	switch t.WhenUnsatisfiable {
+	case "", scheduleAnyway, "DoNotSchedule":
+	default:
+		return fmt.Errorf("unknown whenUnsatisfiable %q", t.WhenUnsatisfiable)
+	}
+	if t.MaxNodes < 0 || t.MinMaxSkew < 0 {
+		return fmt.Errorf("max-nodes and min-max-skew cannot be negative")
+	}
+	for i, constraint := range t.Inject {
+		if key, _ := constraint["topologyKey"].(string); key == "" {
+			return fmt.Errorf("injected constraint %d has no topologyKey", i)
+		}
+	}
+	return nil
+}
+
+// Name implements Transformer.
+func (t *TopologySpread) Name() string {
+	return "topology-spread"
+}
+
+// Transform implements Transformer.
+func (t *TopologySpread) Transform(item *unstructured.Unstructured) (*unstructured.Unstructured, error) {
+	if len(podSpecs(item.Object)) == 0 {
+		return item, nil
+	}
+	if t.Nodes == nil {
+		return nil, fmt.Errorf("the nodes of the target cluster are unknown")
+	}
+	nodes, err := t.Nodes()
+	if err != nil {
+		return nil, err
+	}
+	if t.MaxNodes > 0 && len(nodes) > t.MaxNodes {
+		return item, nil
+	}
+
+	out := item.DeepCopy()
+	replicas := replicaCount(out.Object)
+	for path, spec := range podSpecs(out.Object) {
+		template, _, _ := unstructured.NestedFieldNoCopy(out.Object, podSpecPaths[path][:len(podSpecPaths[path])-1]...)
+		labels, _, _ := unstructured.NestedStringMap(asMap(template), "metadata", "labels")
+		t.adaptSpreads(spec, nodes, labels)
+		t.adaptAntiAffinity(spec, nodes, replicas)
+	}
+	return out, nil
+}
+
+func (t *TopologySpread) adaptSpreads(spec map[string]interface{}, nodes []map[string]string, labels map[string]string) {
+	constraints, _ := spec["topologySpreadConstraints"].([]interface{})
+	if len(constraints) == 0 && len(t.Inject) > 0 {
+		for _, injected := range t.Inject {
+			constraint := runtime.DeepCopyJSON(injected)
+			if _, ok := constraint["labelSelector"]; !ok && len(labels) > 0 {
+				matchLabels := make(map[string]interface{}, len(labels))
+				for key, value := range labels {
+					matchLabels[key] = value
+				}
+				constraint["labelSelector"] = map[string]interface{}{"matchLabels": matchLabels}
+			}
+			constraints = append(constraints, constraint)
+		}
+		spec["topologySpreadConstraints"] = constraints
+	}
+
+	for _, entry := range constraints {
+		constraint := asMap(entry)
+		if constraint == nil {
+			continue
+		}
+		key, _ := constraint["topologyKey"].(string)
+		domains := domainCount(nodes, key)
+		if t.WhenUnsatisfiable != "" {
+			constraint["whenUnsatisfiable"] = t.WhenUnsatisfiable
+		}
+		if skew, ok := constraint["maxSkew"].(int64); !ok || skew < t.MinMaxSkew {
+			if t.MinMaxSkew > 0 {
+				constraint["maxSkew"] = t.MinMaxSkew
+			}
+		}
+		if minDomains, ok := constraint["minDomains"].(int64); ok && minDomains > int64(domains) {
+			if domains > 0 {
+				constraint["minDomains"] = int64(domains)
+			} else {
+				delete(constraint, "minDomains")
+			}
+		}
+		if domains == 0 {
+			// no node can be placed in the topology
+			constraint["whenUnsatisfiable"] = scheduleAnyway
+		}
+	}
+}
+
+func (t *TopologySpread) adaptAntiAffinity(spec map[string]interface{}, nodes []map[string]string, replicas int64) {
+	if t.AntiAffinity == AntiAffinityKeep {
+		return
+	}
+	antiAffinity, _, _ := unstructured.NestedMap(spec, "affinity", "podAntiAffinity")
+	required, _ := antiAffinity["requiredDuringSchedulingIgnoredDuringExecution"].([]interface{})
+	if len(required) == 0 {
+		return
+	}
+	preferred, _ := antiAffinity["preferredDuringSchedulingIgnoredDuringExecution"].([]interface{})
+	var kept []interface{}
+	for _, term := range required {
+		key, _ := asMap(term)["topologyKey"].(string)
+		if t.AntiAffinity == AntiAffinityPreferred || replicas > int64(domainCount(nodes, key)) {
+			preferred = append(preferred, map[string]interface{}{"weight": int64(100), "podAffinityTerm": term})
+		} else {
+			kept = append(kept, term)
+		}
+	}
+
+	if len(kept) > 0 {
+		antiAffinity["requiredDuringSchedulingIgnoredDuringExecution"] = kept
+	} else {
+		delete(antiAffinity, "requiredDuringSchedulingIgnoredDuringExecution")
+	}
+	antiAffinity["preferredDuringSchedulingIgnoredDuringExecution"] = preferred
+	_ = unstructured.SetNestedMap(spec, antiAffinity, "affinity", "podAntiAffinity")
+}
+
+// domainCount returns the number of values of a topology key among nodes.
+func domainCount(nodes []map[string]string, key string) int {
+	values := make(map[string]bool)
+	for _, labels := range nodes {
+		if value, ok := labels[key]; ok {
+			values[value] = true
+		}
+	}
+	return len(values)
+}
+
+// replicaCount returns the number of pods a workload runs at once.
+func replicaCount(object map[string]interface{}) int64 {
+	for _, path := range [][]string{{"spec", "replicas"}, {"spec", "parallelism"}, {"spec", "jobTemplate", "spec", "parallelism"}} {
+		if replicas, ok, _ := unstructured.NestedInt64(object, path...); ok {
+			return replicas
+		}
+	}
+	return 1
+}
+
+// podSpecs returns the pod specs of an object by their index in podSpecPaths.
+func podSpecs(object map[string]interface{}) map[int]map[string]interface{} {
+	specs := make(map[int]map[string]interface{})
+	for i, path := range podSpecPaths {
+		spec, _, _ := unstructured.NestedFieldNoCopy(object, path...)
+		if found, ok := spec.(map[string]interface{}); ok && found["containers"] != nil {
+			specs[i] = found
+		}
+	}
+	return specs
+}
@@ -0,0 +1,179 @@
+package transform
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+const zoneKey = "topology.kubernetes.io/zone"
+
+// drNodes are the nodes of a single-zone DR cluster.
+func drNodes(count int) func() ([]map[string]string, error) {
+	return func() ([]map[string]string, error) {
+		var nodes []map[string]string
+		for i := 0; i < count; i++ {
+			nodes = append(nodes, map[string]string{zoneKey: "dr-a", "kubernetes.io/hostname": string(rune('a' + i))})
+		}
+		return nodes, nil
+	}
+}
+
+func spreadDeployment(replicas int64, spec map[string]interface{}) *unstructured.Unstructured {
+	spec["containers"] = []interface{}{map[string]interface{}{"name": "web", "image": "web:1"}}
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "apps/v1",
+		"kind":       "Deployment",
+		"metadata":   map[string]interface{}{"name": "web", "namespace": "apps"},
+		"spec": map[string]interface{}{
+			"replicas": replicas,
+			"template": map[string]interface{}{
+				"metadata": map[string]interface{}{"labels": map[string]interface{}{"app": "web"}},
+				"spec":     spec,
+			},
+		},
+	}}
+}
+
+func antiAffinityTerm(key string) map[string]interface{} {
+	return map[string]interface{}{
+		"topologyKey":   key,
+		"labelSelector": map[string]interface{}{"matchLabels": map[string]interface{}{"app": "web"}},
+	}
+}
+
+func TestTopologySpread_Constraints(t *testing.T) {
+	deployment := spreadDeployment(3, map[string]interface{}{
+		"topologySpreadConstraints": []interface{}{
+			map[string]interface{}{"topologyKey": zoneKey, "maxSkew": int64(1), "minDomains": int64(3), "whenUnsatisfiable": "DoNotSchedule"},
+			map[string]interface{}{"topologyKey": "kubernetes.io/hostname", "maxSkew": int64(4), "minDomains": int64(10), "whenUnsatisfiable": "DoNotSchedule"},
+			map[string]interface{}{"topologyKey": "example.com/rack", "maxSkew": int64(1), "minDomains": int64(2), "whenUnsatisfiable": "DoNotSchedule"},
+		},
+	})
+	original := deployment.DeepCopy()
+
+	output, err := (&TopologySpread{AntiAffinity: AntiAffinityAuto, MinMaxSkew: 2, Nodes: drNodes(5)}).Transform(deployment)
+	require.NoError(t, err)
+	assert.Equal(t, original, deployment, "the input is not modified")
+	assert.Equal(t, []interface{}{
+		map[string]interface{}{"topologyKey": zoneKey, "maxSkew": int64(2), "minDomains": int64(1), "whenUnsatisfiable": "DoNotSchedule"},
+		map[string]interface{}{"topologyKey": "kubernetes.io/hostname", "maxSkew": int64(4), "minDomains": int64(5), "whenUnsatisfiable": "DoNotSchedule"},
+		// no node has the label
+		map[string]interface{}{"topologyKey": "example.com/rack", "maxSkew": int64(2), "whenUnsatisfiable": "ScheduleAnyway"},
+	}, list(output.Object, "spec", "template", "spec", "topologySpreadConstraints"))
+
+	output, err = (&TopologySpread{AntiAffinity: AntiAffinityAuto, WhenUnsatisfiable: "ScheduleAnyway", Nodes: drNodes(5)}).Transform(deployment)
+	require.NoError(t, err)
+	for _, constraint := range list(output.Object, "spec", "template", "spec", "topologySpreadConstraints") {
+		assert.Equal(t, "ScheduleAnyway", field(constraint, "whenUnsatisfiable"))
+	}
+
+	// larger clusters are left alone
+	output, err = (&TopologySpread{AntiAffinity: AntiAffinityAuto, MaxNodes: 4, MinMaxSkew: 2, Nodes: drNodes(5)}).Transform(deployment)
+	require.NoError(t, err)
+	assert.Equal(t, original, output)
+}
+
+func TestTopologySpread_AntiAffinity(t *testing.T) {
+	deployment := spreadDeployment(3, map[string]interface{}{
+		"affinity": map[string]interface{}{"podAntiAffinity": map[string]interface{}{
+			"requiredDuringSchedulingIgnoredDuringExecution": []interface{}{antiAffinityTerm(zoneKey), antiAffinityTerm("kubernetes.io/hostname")},
+		}},
+	})
+	path := []string{"spec", "template", "spec", "affinity", "podAntiAffinity"}
+
+	// 3 replicas fit on 5 hosts but not in 1 zone
+	output, err := (&TopologySpread{AntiAffinity: AntiAffinityAuto, Nodes: drNodes(5)}).Transform(deployment)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"requiredDuringSchedulingIgnoredDuringExecution": []interface{}{antiAffinityTerm("kubernetes.io/hostname")},
+		"preferredDuringSchedulingIgnoredDuringExecution": []interface{}{
+			map[string]interface{}{"weight": int64(100), "podAffinityTerm": antiAffinityTerm(zoneKey)},
+		},
+	}, field(output.Object, path...))
+
+	output, err = (&TopologySpread{AntiAffinity: AntiAffinityAuto, Nodes: drNodes(2)}).Transform(deployment)
+	require.NoError(t, err)
+	assert.Nil(t, field(output.Object, append(path, "requiredDuringSchedulingIgnoredDuringExecution")...))
+	assert.Len(t, list(output.Object, append(path, "preferredDuringSchedulingIgnoredDuringExecution")...), 2)
+
+	output, err = (&TopologySpread{AntiAffinity: AntiAffinityPreferred, Nodes: drNodes(5)}).Transform(deployment)
+	require.NoError(t, err)
+	assert.Len(t, list(output.Object, append(path, "preferredDuringSchedulingIgnoredDuringExecution")...), 2)
+
+	output, err = (&TopologySpread{AntiAffinity: AntiAffinityKeep, Nodes: drNodes(1)}).Transform(deployment)
+	require.NoError(t, err)
+	assert.Equal(t, deployment, output)
+}
+
+func TestTopologySpread_Inject(t *testing.T) {
+	inject := []map[string]interface{}{{"topologyKey": "kubernetes.io/hostname", "maxSkew": int64(1), "whenUnsatisfiable": "ScheduleAnyway"}}
+	transformer := &TopologySpread{AntiAffinity: AntiAffinityAuto, Inject: inject, Nodes: drNodes(5)}
+
+	output, err := transformer.Transform(spreadDeployment(3, map[string]interface{}{}))
+	require.NoError(t, err)
+	assert.Equal(t, []interface{}{map[string]interface{}{
+		"topologyKey":       "kubernetes.io/hostname",
+		"maxSkew":           int64(1),
+		"whenUnsatisfiable": "ScheduleAnyway",
+		"labelSelector":     map[string]interface{}{"matchLabels": map[string]interface{}{"app": "web"}},
+	}}, list(output.Object, "spec", "template", "spec", "topologySpreadConstraints"))
+	assert.NotContains(t, inject[0], "labelSelector", "the injected constraints are copied")
+
+	// templates with constraints keep theirs
+	existing := []interface{}{map[string]interface{}{"topologyKey": zoneKey, "maxSkew": int64(1)}}
+	output, err = transformer.Transform(spreadDeployment(3, map[string]interface{}{"topologySpreadConstraints": existing}))
+	require.NoError(t, err)
+	assert.Equal(t, existing, list(output.Object, "spec", "template", "spec", "topologySpreadConstraints"))
+}
+
+func TestTopologySpread_Items(t *testing.T) {
+	calls := 0
+	failing := &TopologySpread{AntiAffinity: AntiAffinityAuto, Nodes: func() ([]map[string]string, error) {
+		calls++
+		return nil, errors.New("forbidden")
+	}}
+
+	// items without pods do not need the nodes
+	configMap := &unstructured.Unstructured{Object: map[string]interface{}{"kind": "ConfigMap", "metadata": map[string]interface{}{"name": "web"}}}
+	output, err := failing.Transform(configMap)
+	require.NoError(t, err)
+	assert.Equal(t, configMap, output)
+	assert.Zero(t, calls)
+
+	_, err = failing.Transform(spreadDeployment(1, map[string]interface{}{}))
+	assert.Error(t, err)
+
+	job := &unstructured.Unstructured{Object: map[string]interface{}{
+		"kind": "CronJob",
+		"spec": map[string]interface{}{"jobTemplate": map[string]interface{}{"spec": map[string]interface{}{
+			"parallelism": int64(4),
+			"template": map[string]interface{}{"spec": map[string]interface{}{
+				"containers": []interface{}{},
+				"affinity": map[string]interface{}{"podAntiAffinity": map[string]interface{}{
+					"requiredDuringSchedulingIgnoredDuringExecution": []interface{}{antiAffinityTerm("kubernetes.io/hostname")},
+				}},
+			}},
+		}}},
+	}}
+	output, err = (&TopologySpread{AntiAffinity: AntiAffinityAuto, Nodes: drNodes(3)}).Transform(job)
+	require.NoError(t, err)
+	assert.Len(t, list(output.Object, "spec", "jobTemplate", "spec", "template", "spec", "affinity", "podAntiAffinity", "preferredDuringSchedulingIgnoredDuringExecution"), 1,
+		"4 pods at once do not fit on 3 hosts")
+}
+
+func TestTopologySpread_Validate(t *testing.T) {
+	assert.NoError(t, (&TopologySpread{AntiAffinity: AntiAffinityKeep}).Validate())
+	for _, transformer := range []*TopologySpread{
+		{},
+		{AntiAffinity: "never"},
+		{AntiAffinity: AntiAffinityAuto, WhenUnsatisfiable: "Sometimes"},
+		{AntiAffinity: AntiAffinityAuto, MaxNodes: -1},
+		{AntiAffinity: AntiAffinityAuto, Inject: []map[string]interface{}{{"maxSkew": int64(1)}}},
+	} {
+		assert.Error(t, transformer.Validate(), transformer)
+	}
+}
@@ -0,0 +1,136 @@
+package transform
+
+import (
+	"slices"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// workflowKinds are the Argo Workflows and Tekton kinds Workflows applies to.
+var workflowKinds = map[string]bool{
+	"Workflow":                true,
+	"WorkflowTemplate":        true,
+	"ClusterWorkflowTemplate": true,
+	"CronWorkflow":            true,
+	"Task":                    true,
+	"ClusterTask":             true,
+	"Pipeline":                true,
+	"TaskRun":                 true,
+	"PipelineRun":             true,
+}
+
+// artifactDrivers are the keys of the Argo artifact locations holding an
+// endpoint or a bucket.
+var artifactDrivers = []string{"s3", "gcs", "oss", "azure"}
+
+// serviceAccountKeys name a service account in Argo and Tekton specs.
+var serviceAccountKeys = map[string]bool{"serviceAccountName": true, "taskServiceAccountName": true}
+
+// tektonArtifactBucket is the ConfigMap configuring the bucket Tekton stores
+// artifacts in.
+const tektonArtifactBucket = "config-artifact-bucket"
+
+// Workflows adapts Argo Workflows and Tekton resources to the target
+// environment: the endpoints and buckets of artifact locations, and the
+// service accounts workflows and tasks run as, wherever they appear in the
+// spec. Buckets and service accounts are mapped as whole values, endpoints as
+// by MapEndpoints.
+type Workflows struct {
+	Endpoints       map[string]string
+	Buckets         map[string]string
+	ServiceAccounts map[string]string
+}
+
+// Name implements Transformer.
+func (w *Workflows) Name() string {
+	return "workflows"
+}
+
+// OwnedPaths implements FieldOwner. Only the usual locations are owned, the
+// fields are mapped wherever they appear.
+func (w *Workflows) OwnedPaths() [][]string {
+	var paths [][]string
+	for _, spec := range [][]string{{"spec"}, {"spec", "workflowSpec"}} {
+		for _, path := range [][]string{
+			{"serviceAccountName"},
+			{"executor", "serviceAccountName"},
+			{"templates", "serviceAccountName"},
+		} {
+			paths = append(paths, append(append([]string{}, spec...), path...))
+		}
+		for _, direction := range []string{"inputs", "outputs"} {
+			for _, driver := range artifactDrivers {
+				for _, key := range []string{"endpoint", "bucket", "container"} {
+					paths = append(paths, append(append([]string{}, spec...), "templates", direction, "artifacts", driver, key))
+				}
+			}
+		}
+	}
+	return append(paths,
+		[]string{"spec", "taskRunTemplate", "serviceAccountName"},
+		[]string{"spec", "taskRunSpecs", "serviceAccountName"},
+		[]string{"spec", "taskRunSpecs", "taskServiceAccountName"},
+	)
+}
+
+// Transform implements Transformer.
+func (w *Workflows) Transform(item *unstructured.Unstructured) (*unstructured.Unstructured, error) {
+	if item.GetKind() == "ConfigMap" && item.GetName() == tektonArtifactBucket {
+		out := item.DeepCopy()
+		data, _ := field(out.Object, "data").(map[string]interface{})
+		if location, ok := data["location"].(string); ok {
+			data["location"] = w.mapBucketURL(location)
+		}
+		return out, nil
+	}
+	if !workflowKinds[item.GetKind()] {
+		return item, nil
+	}
+	out := item.DeepCopy()
+	w.walk(out.Object["spec"], "")
+	return out, nil
+}
+
+// walk maps the fields of value, the value of key in its parent object.
+func (w *Workflows) walk(value interface{}, key string) {
+	switch v := value.(type) {
+	case []interface{}:
+		for _, entry := range v {
+			w.walk(entry, key)
+		}
+	case map[string]interface{}:
+		if slices.Contains(artifactDrivers, key) {
+			mapField(v, "bucket", w.Buckets)
+			mapField(v, "container", w.Buckets)
+			if endpoint, ok := v["endpoint"].(string); ok {
+				v["endpoint"] = MapEndpoints(endpoint, w.Endpoints)
+			}
+		}
+		for k, child := range v {
+			if serviceAccountKeys[k] {
+				mapField(v, k, w.ServiceAccounts)
+				continue
+			}
+			w.walk(child, k)
+		}
+	}
+}
+
+// mapBucketURL maps the bucket of a <scheme>://<bucket>[/path] location.
+func (w *Workflows) mapBucketURL(location string) string {
+	scheme, rest, ok := strings.Cut(location, "://")
+	if !ok {
+		return location
+	}
+	bucket, path, hasPath := strings.Cut(rest, "/")
+	mapped, ok := w.Buckets[bucket]
+	if !ok {
+		return location
+	}
+	location = scheme + "://" + mapped
+	if hasPath {
+		location += "/" + path
+	}
+	return location
+}
@@ -0,0 +1,88 @@
+package transform
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func testWorkflows() *Workflows {
+	return &Workflows{
+		Endpoints:       map[string]string{"minio.prod": "minio.dr"},
+		Buckets:         map[string]string{"prod-artifacts": "dr-artifacts"},
+		ServiceAccounts: map[string]string{"ci-prod": "ci-dr"},
+	}
+}
+
+func TestWorkflows_Argo(t *testing.T) {
+	cronWorkflow := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "argoproj.io/v1alpha1",
+		"kind":       "CronWorkflow",
+		"spec": map[string]interface{}{"workflowSpec": map[string]interface{}{
+			"serviceAccountName": "ci-prod",
+			"templates": []interface{}{
+				map[string]interface{}{
+					"name": "build",
+					"outputs": map[string]interface{}{"artifacts": []interface{}{
+						map[string]interface{}{"name": "binary", "s3": map[string]interface{}{
+							"endpoint": "minio.prod:9000",
+							"bucket":   "prod-artifacts",
+							"key":      "prod-artifacts/binary.tgz",
+						}},
+						map[string]interface{}{"name": "report", "gcs": map[string]interface{}{"bucket": "other", "key": "report"}},
+					}},
+				},
+			},
+		}},
+	}}
+	original := cronWorkflow.DeepCopy()
+
+	output, err := testWorkflows().Transform(cronWorkflow)
+	require.NoError(t, err)
+	assert.Equal(t, "ci-dr", field(output.Object, "spec", "workflowSpec", "serviceAccountName"))
+	artifacts := list(list(output.Object, "spec", "workflowSpec", "templates")[0], "outputs", "artifacts")
+	assert.Equal(t, map[string]interface{}{
+		"endpoint": "minio.dr:9000",
+		"bucket":   "dr-artifacts",
+		"key":      "prod-artifacts/binary.tgz",
+	}, field(artifacts[0], "s3"))
+	assert.Equal(t, map[string]interface{}{"bucket": "other", "key": "report"}, field(artifacts[1], "gcs"))
+	assert.Equal(t, original, cronWorkflow)
+}
+
+func TestWorkflows_Tekton(t *testing.T) {
+	pipelineRun := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "tekton.dev/v1",
+		"kind":       "PipelineRun",
+		"spec": map[string]interface{}{
+			"taskRunTemplate": map[string]interface{}{"serviceAccountName": "ci-prod"},
+			"taskRunSpecs": []interface{}{
+				map[string]interface{}{"pipelineTaskName": "deploy", "serviceAccountName": "ci-prod"},
+				map[string]interface{}{"pipelineTaskName": "test", "serviceAccountName": "tester"},
+			},
+		},
+	}}
+	output, err := testWorkflows().Transform(pipelineRun)
+	require.NoError(t, err)
+	assert.Equal(t, "ci-dr", field(output.Object, "spec", "taskRunTemplate", "serviceAccountName"))
+	specs := list(output.Object, "spec", "taskRunSpecs")
+	assert.Equal(t, "ci-dr", field(specs[0], "serviceAccountName"))
+	assert.Equal(t, "tester", field(specs[1], "serviceAccountName"))
+
+	configMap := &unstructured.Unstructured{Object: map[string]interface{}{
+		"kind":     "ConfigMap",
+		"metadata": map[string]interface{}{"name": tektonArtifactBucket},
+		"data":     map[string]interface{}{"location": "gs://prod-artifacts/tekton"},
+	}}
+	output, err = testWorkflows().Transform(configMap)
+	require.NoError(t, err)
+	assert.Equal(t, "gs://dr-artifacts/tekton", field(output.Object, "data", "location"))
+
+	// service accounts outside of workflows are left alone
+	pod := &unstructured.Unstructured{Object: map[string]interface{}{"kind": "Pod", "spec": map[string]interface{}{"serviceAccountName": "ci-prod"}}}
+	output, err = testWorkflows().Transform(pod)
+	require.NoError(t, err)
+	assert.Equal(t, pod, output)
+}
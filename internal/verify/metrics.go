@@ -0,0 +1,98 @@
+package verify
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Metrics exposes the results of the controller in the Prometheus text
+// format.
+type Metrics struct {
+	mu sync.Mutex
+	// drifted counts the objects with drifts per namespace, as of the last
+	// sync
+	drifted map[string]int
+	// detections counts the drifts reported per namespace and rules
+	detections map[[2]string]int
+	failures   int
+	lastSync   time.Time
+}
+
+// NewMetrics returns empty metrics.
+func NewMetrics() *Metrics {
+	return &Metrics{drifted: make(map[string]int), detections: make(map[[2]string]int)}
+}
+
+func (m *Metrics) detected(namespace, rules string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.detections[[2]string{namespace, rules}]++
+}
+
+func (m *Metrics) synced(drifted map[string]int, at time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.drifted = drifted
+	m.lastSync = at
+}
+
+func (m *Metrics) failed() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.failures++
+}
+
+// ServeHTTP implements http.Handler.
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var b strings.Builder
+	b.WriteString("# HELP replace_pattern_verified_namespaces Restored namespaces under verification.\n")
+	b.WriteString("# TYPE replace_pattern_verified_namespaces gauge\n")
+	fmt.Fprintf(&b, "replace_pattern_verified_namespaces %d\n", len(m.drifted))
+
+	b.WriteString("# HELP replace_pattern_drifted_objects Objects referencing the backup environment again.\n")
+	b.WriteString("# TYPE replace_pattern_drifted_objects gauge\n")
+	namespaces := make([]string, 0, len(m.drifted))
+	for namespace := range m.drifted {
+		namespaces = append(namespaces, namespace)
+	}
+	sort.Strings(namespaces)
+	for _, namespace := range namespaces {
+		fmt.Fprintf(&b, "replace_pattern_drifted_objects{namespace=%q} %d\n", namespace, m.drifted[namespace])
+	}
+
+	b.WriteString("# HELP replace_pattern_drift_detections_total Drifts reported since the start.\n")
+	b.WriteString("# TYPE replace_pattern_drift_detections_total counter\n")
+	keys := make([][2]string, 0, len(m.detections))
+	for key := range m.detections {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i][0] != keys[j][0] {
+			return keys[i][0] < keys[j][0]
+		}
+		return keys[i][1] < keys[j][1]
+	})
+	for _, key := range keys {
+		fmt.Fprintf(&b, "replace_pattern_drift_detections_total{namespace=%q,rules=%q} %d\n", key[0], key[1], m.detections[key])
+	}
+
+	b.WriteString("# HELP replace_pattern_verification_failures_total Verifications that failed.\n")
+	b.WriteString("# TYPE replace_pattern_verification_failures_total counter\n")
+	fmt.Fprintf(&b, "replace_pattern_verification_failures_total %d\n", m.failures)
+
+	if !m.lastSync.IsZero() {
+		b.WriteString("# HELP replace_pattern_last_verification_timestamp_seconds Time of the last successful verification.\n")
+		b.WriteString("# TYPE replace_pattern_last_verification_timestamp_seconds gauge\n")
+		fmt.Fprintf(&b, "replace_pattern_last_verification_timestamp_seconds %d\n", m.lastSync.Unix())
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	_, _ = w.Write([]byte(b.String()))
+}
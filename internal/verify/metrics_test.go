@@ -0,0 +1,25 @@
+package verify
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMetrics(t *testing.T) {
+	metrics := NewMetrics()
+	metrics.detected("shop", "domains")
+	metrics.detected("shop", "domains")
+	metrics.failed()
+	metrics.synced(map[string]int{"shop": 1, "blog": 0}, now)
+
+	recorder := httptest.NewRecorder()
+	metrics.ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+	body := recorder.Body.String()
+	assert.Contains(t, body, "replace_pattern_verified_namespaces 2\n")
+	assert.Contains(t, body, "replace_pattern_drifted_objects{namespace=\"blog\"} 0\nreplace_pattern_drifted_objects{namespace=\"shop\"} 1\n")
+	assert.Contains(t, body, "replace_pattern_drift_detections_total{namespace=\"shop\",rules=\"domains\"} 2\n")
+	assert.Contains(t, body, "replace_pattern_verification_failures_total 1\n")
+	assert.Contains(t, body, "replace_pattern_last_verification_timestamp_seconds 1714651200\n")
+}
@@ -0,0 +1,243 @@
+// Package verify implements a controller that keeps checking the namespaces of
+// recent restores for references to the backup environment that reappear, as
+// when controllers write back their own configuration, and reports them as
+// events and metrics.
+package verify
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	velerov1 "github.com/vmware-tanzu/velero/pkg/apis/velero/v1"
+	velerov1client "github.com/vmware-tanzu/velero/pkg/generated/clientset/versioned/typed/velero/v1"
+	"github.com/vmware-tanzu/velero/pkg/label"
+	"github.com/wrkt/velero-custom-plugins/internal/plugin"
+	"github.com/wrkt/velero-custom-plugins/pkg/transform"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/record"
+)
+
+// DriftReason is the reason of the events reporting a drift.
+const DriftReason = "RestoreDrift"
+
+// skippedResources are never checked: they record what happened rather than
+// the state the rules mapped.
+var skippedResources = map[schema.GroupResource]bool{
+	{Resource: "events"}:                         true,
+	{Group: "events.k8s.io", Resource: "events"}: true,
+}
+
+// Options configures a Controller.
+type Options struct {
+	// Namespace holds the Restores and the rule ConfigMaps, velero for the
+	// plugin.
+	Namespace string
+	// Window is how long after its completion the namespaces of a restore are
+	// checked.
+	Window time.Duration
+	// Sections is the REPLACE_PATTERN_SECTIONS of the plugin. When empty, the
+	// value of the settings ConfigMap of Namespace is used.
+	Sections string
+	// Logger is the standard logger when nil.
+	Logger logrus.FieldLogger
+}
+
+// Controller checks the namespaces restored within the window against the
+// literal rules of the plugin.
+type Controller struct {
+	kube     kubernetes.Interface
+	restores velerov1client.RestoresGetter
+	client   dynamic.Interface
+	recorder record.EventRecorder
+	opts     Options
+	metrics  *Metrics
+	now      func() time.Time
+
+	// reported holds the drifts already reported, so that each one raises a
+	// single event until it is fixed.
+	reported map[string]bool
+}
+
+// NewController returns a controller reading the cluster with kube, restores
+// and client, and reporting drifts to recorder and metrics.
+func NewController(kube kubernetes.Interface, restores velerov1client.RestoresGetter, client dynamic.Interface, recorder record.EventRecorder, metrics *Metrics, opts Options) *Controller {
+	if opts.Logger == nil {
+		opts.Logger = logrus.StandardLogger()
+	}
+	return &Controller{
+		kube:     kube,
+		restores: restores,
+		client:   client,
+		recorder: recorder,
+		opts:     opts,
+		metrics:  metrics,
+		now:      time.Now,
+		reported: make(map[string]bool),
+	}
+}
+
+// sections returns the sections the patterns of the plugin are restricted to,
+// empty for the whole items.
+func (c *Controller) sections(ctx context.Context) (string, error) {
+	if c.opts.Sections != "" {
+		return c.opts.Sections, nil
+	}
+	settings, err := c.kube.CoreV1().ConfigMaps(c.opts.Namespace).Get(ctx, plugin.SettingsConfigMapName, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to get configmap %s: %v", plugin.SettingsConfigMapName, err)
+	}
+	return settings.Data[plugin.SectionsSetting], nil
+}
+
+// Run checks the restored namespaces every interval until ctx is done.
+func (c *Controller) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := c.Sync(ctx); err != nil {
+			c.metrics.failed()
+			c.opts.Logger.Warnf("Failed to verify the restored namespaces: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Sync checks the restored namespaces once.
+func (c *Controller) Sync(ctx context.Context) error {
+	rules, err := transform.ListRules(ctx, c.kube.CoreV1(), c.opts.Namespace)
+	if err != nil {
+		return err
+	}
+	sections, err := c.sections(ctx)
+	if err != nil {
+		return err
+	}
+	checker := plugin.NewDriftChecker(rules).WithSections(sections)
+
+	namespaces, err := c.restoredNamespaces(ctx)
+	if err != nil {
+		return err
+	}
+	resources := c.namespacedResources()
+
+	reported := make(map[string]bool)
+	drifted := make(map[string]int, len(namespaces))
+	for _, namespace := range namespaces {
+		drifted[namespace] = 0
+		for _, resource := range resources {
+			list, err := c.client.Resource(resource).Namespace(namespace).List(ctx, metav1.ListOptions{})
+			if err != nil {
+				c.opts.Logger.Warnf("Failed to list %s in %s: %v", resource.Resource, namespace, err)
+				continue
+			}
+			for i := range list.Items {
+				item := &list.Items[i]
+				drifts := checker.Check(item)
+				if len(drifts) > 0 {
+					drifted[namespace]++
+				}
+				for _, drift := range drifts {
+					key := strings.Join([]string{resource.String(), namespace, item.GetName(), drift.Rules, drift.Pattern, drift.Path}, "\x00")
+					reported[key] = true
+					if c.reported[key] {
+						continue
+					}
+					c.opts.Logger.Warnf("%s %s/%s references %s again at %s, mapped by %s", item.GetKind(), namespace, item.GetName(), drift.Pattern, drift.Path, drift.Rules)
+					c.recorder.Eventf(item, corev1.EventTypeWarning, DriftReason, "%s references %s again, mapped by the rules %s", drift.Path, drift.Pattern, drift.Rules)
+					c.metrics.detected(namespace, drift.Rules)
+				}
+			}
+		}
+	}
+	// fixed drifts are reported again when they reappear
+	c.reported = reported
+	c.metrics.synced(drifted, c.now())
+	return nil
+}
+
+// restoredNamespaces returns the namespaces labelled by the restores that
+// completed within the window.
+func (c *Controller) restoredNamespaces(ctx context.Context) ([]string, error) {
+	restores, err := c.restores.Restores(c.opts.Namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list restores: %v", err)
+	}
+	seen := make(map[string]bool)
+	var namespaces []string
+	for _, restore := range restores.Items {
+		if !c.inWindow(restore) {
+			continue
+		}
+		list, err := c.kube.CoreV1().Namespaces().List(ctx, metav1.ListOptions{
+			LabelSelector: velerov1.RestoreNameLabel + "=" + label.GetValidName(restore.Name),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list the namespaces of restore %s: %v", restore.Name, err)
+		}
+		for _, namespace := range list.Items {
+			if !seen[namespace.Name] {
+				seen[namespace.Name] = true
+				namespaces = append(namespaces, namespace.Name)
+			}
+		}
+	}
+	return namespaces, nil
+}
+
+func (c *Controller) inWindow(restore velerov1.Restore) bool {
+	if restore.Status.Phase != velerov1.RestorePhaseCompleted && restore.Status.Phase != velerov1.RestorePhasePartiallyFailed {
+		return false
+	}
+	completed := restore.Status.CompletionTimestamp
+	return completed != nil && c.now().Sub(completed.Time) < c.opts.Window
+}
+
+// namespacedResources returns the preferred version of the namespaced
+// resources that can be listed.
+func (c *Controller) namespacedResources() []schema.GroupVersionResource {
+	lists, err := discovery.ServerPreferredNamespacedResources(c.kube.Discovery())
+	if err != nil {
+		// partial results are still returned when some API groups fail
+		c.opts.Logger.Warnf("Resource discovery is incomplete: %v", err)
+	}
+	var resources []schema.GroupVersionResource
+	for _, list := range lists {
+		gv, err := schema.ParseGroupVersion(list.GroupVersion)
+		if err != nil {
+			continue
+		}
+		for _, resource := range list.APIResources {
+			gvr := gv.WithResource(resource.Name)
+			if strings.Contains(resource.Name, "/") || skippedResources[gvr.GroupResource()] || !listable(resource) {
+				continue
+			}
+			resources = append(resources, gvr)
+		}
+	}
+	return resources
+}
+
+func listable(resource metav1.APIResource) bool {
+	for _, verb := range resource.Verbs {
+		if verb == "list" {
+			return true
+		}
+	}
+	return false
+}
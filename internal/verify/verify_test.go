@@ -0,0 +1,140 @@
+package verify
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	velerov1 "github.com/vmware-tanzu/velero/pkg/apis/velero/v1"
+	velerofake "github.com/vmware-tanzu/velero/pkg/generated/clientset/versioned/fake"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	kubefake "k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/record"
+)
+
+var now = time.Date(2024, 5, 2, 12, 0, 0, 0, time.UTC)
+
+func restore(name string, phase velerov1.RestorePhase, completed time.Time) *velerov1.Restore {
+	return &velerov1.Restore{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "velero"},
+		Status:     velerov1.RestoreStatus{Phase: phase, CompletionTimestamp: &metav1.Time{Time: completed}},
+	}
+}
+
+func namespace(name, restore string) *corev1.Namespace {
+	return &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: name, Labels: map[string]string{velerov1.RestoreNameLabel: restore}}}
+}
+
+func configMap(namespace, name, value string) *unstructured.Unstructured {
+	u := &unstructured.Unstructured{Object: map[string]interface{}{"data": map[string]interface{}{"url": value}}}
+	u.SetAPIVersion("v1")
+	u.SetKind("ConfigMap")
+	u.SetNamespace(namespace)
+	u.SetName(name)
+	return u
+}
+
+type fixture struct {
+	controller *Controller
+	client     *dynamicfake.FakeDynamicClient
+	recorder   *record.FakeRecorder
+	metrics    *Metrics
+}
+
+func newFixture(objects ...runtime.Object) *fixture {
+	kube := kubefake.NewSimpleClientset(
+		&corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "domains",
+				Namespace: "velero",
+				Labels:    map[string]string{"agoracalyce.io/replace-pattern": "RestoreItemAction"},
+			},
+			Data: map[string]string{"example.com": "dr.example.com"},
+		},
+		namespace("shop", "dr-1"),
+		namespace("blog", "dr-old"),
+		namespace("wiki", "dr-failed"),
+	)
+	kube.Resources = []*metav1.APIResourceList{{
+		GroupVersion: "v1",
+		APIResources: []metav1.APIResource{
+			{Name: "configmaps", Kind: "ConfigMap", Namespaced: true, Verbs: []string{"get", "list"}},
+			{Name: "events", Kind: "Event", Namespaced: true, Verbs: []string{"get", "list"}},
+			{Name: "pods/log", Kind: "Pod", Namespaced: true, Verbs: []string{"get"}},
+			{Name: "namespaces", Kind: "Namespace", Verbs: []string{"get", "list"}},
+		},
+	}}
+	velero := velerofake.NewSimpleClientset(
+		restore("dr-1", velerov1.RestorePhaseCompleted, now.Add(-time.Hour)),
+		restore("dr-old", velerov1.RestorePhaseCompleted, now.Add(-48*time.Hour)),
+		restore("dr-failed", velerov1.RestorePhaseFailed, now.Add(-time.Hour)),
+	)
+	client := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{{Version: "v1", Resource: "configmaps"}: "ConfigMapList"}, objects...)
+	recorder := record.NewFakeRecorder(10)
+	metrics := NewMetrics()
+
+	controller := NewController(kube, velero.VeleroV1(), client, recorder, metrics, Options{Namespace: "velero", Window: 24 * time.Hour, Logger: logrus.New()})
+	controller.now = func() time.Time { return now }
+	return &fixture{controller: controller, client: client, recorder: recorder, metrics: metrics}
+}
+
+func TestSync(t *testing.T) {
+	f := newFixture(
+		configMap("shop", "web", "https://web.dr.example.com"),
+		configMap("shop", "api", "https://api.example.com"),
+		configMap("blog", "web", "https://blog.example.com"),
+		configMap("wiki", "web", "https://wiki.example.com"),
+	)
+	ctx := context.Background()
+
+	require.NoError(t, f.controller.Sync(ctx))
+	require.Len(t, f.recorder.Events, 1)
+	assert.Equal(t, "Warning RestoreDrift data.url references example.com again, mapped by the rules domains", <-f.recorder.Events)
+	assert.Equal(t, map[string]int{"shop": 1}, f.metrics.drifted)
+
+	// a drift is reported once
+	require.NoError(t, f.controller.Sync(ctx))
+	assert.Empty(t, f.recorder.Events)
+
+	// and again when it reappears after a fix
+	gvr := schema.GroupVersionResource{Version: "v1", Resource: "configmaps"}
+	_, err := f.client.Resource(gvr).Namespace("shop").Update(ctx, configMap("shop", "api", "https://api.dr.example.com"), metav1.UpdateOptions{})
+	require.NoError(t, err)
+	require.NoError(t, f.controller.Sync(ctx))
+	assert.Equal(t, map[string]int{"shop": 0}, f.metrics.drifted)
+	_, err = f.client.Resource(gvr).Namespace("shop").Update(ctx, configMap("shop", "api", "https://api.example.com"), metav1.UpdateOptions{})
+	require.NoError(t, err)
+	require.NoError(t, f.controller.Sync(ctx))
+	assert.Len(t, f.recorder.Events, 1)
+	assert.Equal(t, 2, f.metrics.detections[[2]string{"shop", "domains"}])
+}
+
+func TestSync_Sections(t *testing.T) {
+	annotated := configMap("shop", "web", "https://web.dr.example.com")
+	annotated.SetAnnotations(map[string]string{"example.com/owner": "team"})
+	f := newFixture(annotated)
+	ctx := context.Background()
+
+	// the patterns of the plugin never reached the annotations
+	_, err := f.controller.kube.CoreV1().ConfigMaps("velero").Create(ctx, &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "replace-pattern-settings", Namespace: "velero"},
+		Data:       map[string]string{"REPLACE_PATTERN_SECTIONS": "spec,data"},
+	}, metav1.CreateOptions{})
+	require.NoError(t, err)
+	require.NoError(t, f.controller.Sync(ctx))
+	assert.Empty(t, f.recorder.Events)
+
+	f.controller.opts.Sections = "metadata"
+	require.NoError(t, f.controller.Sync(ctx))
+	require.Len(t, f.recorder.Events, 1, "the option overrides the ConfigMap")
+	assert.Equal(t, "Warning RestoreDrift metadata.annotations.example.com/owner references example.com again, mapped by the rules domains", <-f.recorder.Events)
+}
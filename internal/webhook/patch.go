@@ -0,0 +1,62 @@
+package webhook
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// patchOperation is a JSON patch operation, as admission responses carry.
+// Value is always encoded: an empty string or false is a value to set, and
+// the value of a remove operation is ignored.
+type patchOperation struct {
+	Op    string      `json:"op"`
+	Path  string      `json:"path"`
+	Value interface{} `json:"value"`
+}
+
+// createPatch returns the JSON patch turning original into modified. Objects
+// are compared key by key, other values are replaced as a whole.
+func createPatch(original, modified map[string]interface{}) []patchOperation {
+	return diffObjects("", original, modified, nil)
+}
+
+func diffObjects(path string, original, modified map[string]interface{}, ops []patchOperation) []patchOperation {
+	keys := make([]string, 0, len(original)+len(modified))
+	for key := range original {
+		keys = append(keys, key)
+	}
+	for key := range modified {
+		if _, ok := original[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		keyPath := path + "/" + escapePointer(key)
+		before, inOriginal := original[key]
+		after, inModified := modified[key]
+		switch {
+		case !inModified:
+			ops = append(ops, patchOperation{Op: "remove", Path: keyPath})
+		case !inOriginal:
+			ops = append(ops, patchOperation{Op: "add", Path: keyPath, Value: after})
+		case reflect.DeepEqual(before, after):
+		default:
+			beforeObject, ok1 := before.(map[string]interface{})
+			afterObject, ok2 := after.(map[string]interface{})
+			if ok1 && ok2 {
+				ops = diffObjects(keyPath, beforeObject, afterObject, ops)
+			} else {
+				ops = append(ops, patchOperation{Op: "replace", Path: keyPath, Value: after})
+			}
+		}
+	}
+	return ops
+}
+
+// escapePointer escapes a key as a JSON pointer token.
+func escapePointer(key string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(key, "~", "~0"), "/", "~1")
+}
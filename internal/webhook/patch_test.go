@@ -0,0 +1,39 @@
+package webhook
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCreatePatch(t *testing.T) {
+	original := map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"name":        "web",
+			"annotations": map[string]interface{}{"example.com/owner": "shop", "obsolete": "true"},
+		},
+		"spec": map[string]interface{}{
+			"rules":    []interface{}{map[string]interface{}{"host": "web.example.com"}},
+			"replicas": int64(1),
+		},
+	}
+	modified := map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"name":        "web",
+			"annotations": map[string]interface{}{"example.com/owner": "shop-dr"},
+			"labels":      map[string]interface{}{"dr": "true"},
+		},
+		"spec": map[string]interface{}{
+			"rules":    []interface{}{map[string]interface{}{"host": "web.dr.example.com"}},
+			"replicas": int64(1),
+		},
+	}
+
+	assert.Equal(t, []patchOperation{
+		{Op: "replace", Path: "/metadata/annotations/example.com~1owner", Value: "shop-dr"},
+		{Op: "remove", Path: "/metadata/annotations/obsolete"},
+		{Op: "add", Path: "/metadata/labels", Value: map[string]interface{}{"dr": "true"}},
+		{Op: "replace", Path: "/spec/rules", Value: []interface{}{map[string]interface{}{"host": "web.dr.example.com"}}},
+	}, createPatch(original, modified))
+	assert.Empty(t, createPatch(original, original))
+}
@@ -0,0 +1,204 @@
+// Package webhook serves a mutating admission webhook applying the rules of
+// the restore plugin to the objects applied to the cluster, so that manifests
+// applied directly get the same rewrites as restored ones.
+package webhook
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/wrkt/velero-custom-plugins/pkg/transform"
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+const (
+	// maxRequestSize bounds the admission reviews read, the API server
+	// sending at most a few megabytes.
+	maxRequestSize = 8 << 20
+	// RulesAnnotation holds the hash of the rules that changed an object, so
+	// that they do not apply again to the object they already changed.
+	RulesAnnotation = "agoracalyce.io/replace-pattern-rules"
+)
+
+// RulesLoader returns the current rule ConfigMaps.
+type RulesLoader func(ctx context.Context) ([]corev1.ConfigMap, error)
+
+// Handler answers AdmissionReview requests with the patch applying the rules.
+type Handler struct {
+	load   RulesLoader
+	opts   transform.Options
+	logger logrus.FieldLogger
+
+	mu    sync.RWMutex
+	chain *transform.Chain
+	// hash identifies the rules the chain was built from
+	hash string
+}
+
+// NewHandler returns a handler applying the rules returned by load with opts.
+// The rules are only read by Refresh. Objects applied to the cluster do not come
+// from a backup, so the original identity annotations are never stamped.
+func NewHandler(load RulesLoader, opts transform.Options) *Handler {
+	opts.SkipOrigin = true
+	if opts.Logger == nil {
+		opts.Logger = logrus.StandardLogger()
+	}
+	return &Handler{load: load, opts: opts, logger: opts.Logger}
+}
+
+// Refresh reloads the rules. The chain is only rebuilt when they changed, so
+// that the failures of a transformer keep counting.
+func (h *Handler) Refresh(ctx context.Context) error {
+	rules, err := h.load(ctx)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(rules)
+	if err != nil {
+		return fmt.Errorf("failed to encode rules: %v", err)
+	}
+	sum := sha256.Sum256(data)
+	hash := hex.EncodeToString(sum[:])
+
+	h.mu.RLock()
+	unchanged := h.hash == hash
+	h.mu.RUnlock()
+	if unchanged {
+		return nil
+	}
+
+	var chain *transform.Chain
+	if len(rules) > 0 {
+		chain, err = transform.New(rules, h.opts)
+		if err != nil {
+			return err
+		}
+	}
+	h.mu.Lock()
+	h.chain, h.hash = chain, hash
+	h.mu.Unlock()
+	h.logger.Infof("Loaded %d rule ConfigMaps", len(rules))
+	return nil
+}
+
+// Run refreshes the rules every interval until ctx is done.
+func (h *Handler) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := h.Refresh(ctx); err != nil {
+				h.logger.Warnf("Failed to refresh the rules, keeping the previous ones: %v", err)
+			}
+		}
+	}
+}
+
+// ServeHTTP implements http.Handler.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxRequestSize))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to read request: %v", err), http.StatusBadRequest)
+		return
+	}
+	var review admissionv1.AdmissionReview
+	if err := json.Unmarshal(body, &review); err != nil || review.Request == nil {
+		http.Error(w, "expected an AdmissionReview request", http.StatusBadRequest)
+		return
+	}
+
+	review.Response = h.admit(review.Request)
+	review.Response.UID = review.Request.UID
+	review.Request = nil
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(review); err != nil {
+		h.logger.Warnf("Failed to write admission response: %v", err)
+	}
+}
+
+// admit returns the response to a request: allowed, with the patch applying
+// the rules when they change the object, unless the rules fail. Rules are not
+// idempotent, a.com to b.a.com changing b.a.com again: the objects they
+// changed are stamped with their hash, and left alone on later updates until
+// the rules change.
+func (h *Handler) admit(request *admissionv1.AdmissionRequest) *admissionv1.AdmissionResponse {
+	response := &admissionv1.AdmissionResponse{Allowed: true}
+	if request.Operation != admissionv1.Create && request.Operation != admissionv1.Update {
+		return response
+	}
+
+	h.mu.RLock()
+	chain, hash := h.chain, h.hash
+	h.mu.RUnlock()
+	if chain == nil {
+		return response
+	}
+
+	object := &unstructured.Unstructured{}
+	if err := object.UnmarshalJSON(request.Object.Raw); err != nil {
+		return errorResponse(fmt.Errorf("failed to decode object: %v", err))
+	}
+	if object.GetAnnotations()[RulesAnnotation] == hash {
+		return response
+	}
+	if object.GetNamespace() == "" {
+		// namespaced objects may be created without their namespace
+		object.SetNamespace(request.Namespace)
+	}
+	result, err := chain.Apply(object)
+	if err != nil {
+		return errorResponse(err)
+	}
+	output := result.Object
+
+	if result.Excluded {
+		response.Warnings = append(response.Warnings, "the replace-pattern rules exclude this object from restores")
+	}
+	// the API server refuses to rename or move an object in admission
+	if output.GetName() != object.GetName() || output.GetNamespace() != object.GetNamespace() {
+		response.Warnings = append(response.Warnings, fmt.Sprintf("the replace-pattern rules rename %s/%s to %s/%s, which admission cannot do", object.GetNamespace(), object.GetName(), output.GetNamespace(), output.GetName()))
+		output.SetName(object.GetName())
+		output.SetNamespace(object.GetNamespace())
+	}
+
+	if len(createPatch(object.Object, output.Object)) == 0 {
+		return response
+	}
+	annotations := output.GetAnnotations()
+	if annotations == nil {
+		annotations = make(map[string]string)
+	}
+	annotations[RulesAnnotation] = hash
+	output.SetAnnotations(annotations)
+	ops := createPatch(object.Object, output.Object)
+	patch, err := json.Marshal(ops)
+	if err != nil {
+		return errorResponse(fmt.Errorf("failed to encode patch: %v", err))
+	}
+	h.logger.Infof("Patching %s %s/%s with %d operations", object.GetKind(), object.GetNamespace(), object.GetName(), len(ops))
+	patchType := admissionv1.PatchTypeJSONPatch
+	response.Patch = patch
+	response.PatchType = &patchType
+	return response
+}
+
+func errorResponse(err error) *admissionv1.AdmissionResponse {
+	return &admissionv1.AdmissionResponse{
+		Allowed: false,
+		Result:  &metav1.Status{Status: metav1.StatusFailure, Message: err.Error(), Code: http.StatusInternalServerError},
+	}
+}
@@ -0,0 +1,143 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	jsonpatch "github.com/evanphx/json-patch"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wrkt/velero-custom-plugins/pkg/transform"
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func review(t *testing.T, h http.Handler, operation admissionv1.Operation, object map[string]interface{}) *admissionv1.AdmissionResponse {
+	raw, err := json.Marshal(object)
+	require.NoError(t, err)
+	body, err := json.Marshal(admissionv1.AdmissionReview{
+		TypeMeta: metav1.TypeMeta{APIVersion: "admission.k8s.io/v1", Kind: "AdmissionReview"},
+		Request: &admissionv1.AdmissionRequest{
+			UID:       "req-1",
+			Operation: operation,
+			Namespace: "shop",
+			Object:    runtime.RawExtension{Raw: raw},
+		},
+	})
+	require.NoError(t, err)
+
+	recorder := httptest.NewRecorder()
+	h.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/mutate", bytes.NewReader(body)))
+	require.Equal(t, http.StatusOK, recorder.Code)
+	var out admissionv1.AdmissionReview
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &out))
+	require.NotNil(t, out.Response)
+	assert.Equal(t, "req-1", string(out.Response.UID))
+	return out.Response
+}
+
+func TestHandler(t *testing.T) {
+	rules := []corev1.ConfigMap{{
+		ObjectMeta: metav1.ObjectMeta{Name: "hosts"},
+		Data:       map[string]string{"example.com": "dr.example.com", "web": "web-dr"},
+	}}
+	loads := 0
+	h := NewHandler(func(context.Context) ([]corev1.ConfigMap, error) {
+		loads++
+		return rules, nil
+	}, transform.Options{Logger: logrus.New()})
+
+	ingress := map[string]interface{}{
+		"apiVersion": "networking.k8s.io/v1",
+		"kind":       "Ingress",
+		"metadata":   map[string]interface{}{"name": "web"},
+		"spec":       map[string]interface{}{"rules": []interface{}{map[string]interface{}{"host": "shop.example.com"}}},
+	}
+
+	// no rules loaded yet
+	response := review(t, h, admissionv1.Create, ingress)
+	assert.True(t, response.Allowed)
+	assert.Nil(t, response.Patch)
+
+	require.NoError(t, h.Refresh(context.Background()))
+	chain := h.chain
+	require.NoError(t, h.Refresh(context.Background()))
+	assert.Same(t, chain, h.chain)
+	assert.Equal(t, 2, loads)
+
+	response = review(t, h, admissionv1.Create, ingress)
+	assert.True(t, response.Allowed)
+	require.NotNil(t, response.PatchType)
+	assert.Equal(t, admissionv1.PatchTypeJSONPatch, *response.PatchType)
+	var ops []patchOperation
+	require.NoError(t, json.Unmarshal(response.Patch, &ops))
+	assert.Equal(t, []patchOperation{
+		{Op: "add", Path: "/metadata/annotations", Value: map[string]interface{}{RulesAnnotation: h.hash}},
+		{Op: "replace", Path: "/spec/rules", Value: []interface{}{map[string]interface{}{"host": "shop.dr.example.com"}}},
+	}, ops)
+	// the rename is left out, and no original identity is stamped
+	assert.Equal(t, []string{"the replace-pattern rules rename shop/web to shop/web-dr, which admission cannot do"}, response.Warnings)
+
+	response = review(t, h, admissionv1.Delete, ingress)
+	assert.True(t, response.Allowed)
+	assert.Nil(t, response.Patch)
+}
+
+func TestHandler_AdmitsChangedObjectsOnce(t *testing.T) {
+	rules := []corev1.ConfigMap{{
+		ObjectMeta: metav1.ObjectMeta{Name: "hosts"},
+		Data:       map[string]string{"example.com": "dr.example.com"},
+	}}
+	h := NewHandler(func(context.Context) ([]corev1.ConfigMap, error) {
+		return rules, nil
+	}, transform.Options{Logger: logrus.New()})
+	require.NoError(t, h.Refresh(context.Background()))
+
+	raw := []byte(`{"apiVersion":"networking.k8s.io/v1","kind":"Ingress","metadata":{"name":"web"},"spec":{"rules":[{"host":"shop.example.com"}]}}`)
+	apply := func(operation admissionv1.Operation) *admissionv1.AdmissionResponse {
+		var object map[string]interface{}
+		require.NoError(t, json.Unmarshal(raw, &object))
+		response := review(t, h, operation, object)
+		if response.Patch != nil {
+			patch, err := jsonpatch.DecodePatch(response.Patch)
+			require.NoError(t, err)
+			raw, err = patch.Apply(raw)
+			require.NoError(t, err)
+		}
+		return response
+	}
+
+	require.NotNil(t, apply(admissionv1.Create).Patch)
+	assert.Contains(t, string(raw), `"host":"shop.dr.example.com"`)
+	// the rules would change shop.dr.example.com again
+	assert.Nil(t, apply(admissionv1.Update).Patch)
+	assert.Contains(t, string(raw), `"host":"shop.dr.example.com"`)
+
+	// new rules apply again
+	rules[0].Data = map[string]string{"shop.": "store."}
+	require.NoError(t, h.Refresh(context.Background()))
+	require.NotNil(t, apply(admissionv1.Update).Patch)
+	assert.Contains(t, string(raw), `"host":"store.dr.example.com"`)
+}
+
+func TestHandler_RefreshFailure(t *testing.T) {
+	h := NewHandler(func(context.Context) ([]corev1.ConfigMap, error) {
+		return nil, fmt.Errorf("forbidden")
+	}, transform.Options{})
+	assert.EqualError(t, h.Refresh(context.Background()), "forbidden")
+}
+
+func TestHandler_BadRequest(t *testing.T) {
+	h := NewHandler(nil, transform.Options{})
+	recorder := httptest.NewRecorder()
+	h.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/mutate", bytes.NewReader([]byte("{}"))))
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+}
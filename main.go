@@ -17,17 +17,129 @@ limitations under the License.
 package main
 
 import (
+	"encoding/json"
+	"flag"
+	"os"
+
 	"github.com/sirupsen/logrus"
 	"github.com/vmware-tanzu/velero/pkg/plugin/framework"
 	"github.com/wrkt/velero-custom-plugins/internal/plugin"
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "--local" {
+		runLocal(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "--replay" {
+		runReplay(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "--import" {
+		runImport(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "--capabilities" {
+		runCapabilities()
+		return
+	}
+
 	framework.NewServer().
 		RegisterRestoreItemAction("agoracalyce.io/replace-pattern", newRestorePlugin).
+		RegisterBackupItemActionV2("agoracalyce.io/scrub", newScrubPlugin).
+		RegisterBackupItemAction("agoracalyce.io/image-digests", newImageDigestsPlugin).
 		Serve()
 }
 
 func newRestorePlugin(logger logrus.FieldLogger) (interface{}, error) {
 	return plugin.NewRestorePlugin(logger), nil
 }
+
+func newScrubPlugin(logger logrus.FieldLogger) (interface{}, error) {
+	return plugin.NewScrubPlugin(logger), nil
+}
+
+func newImageDigestsPlugin(logger logrus.FieldLogger) (interface{}, error) {
+	return plugin.NewImageDigestsPlugin(logger), nil
+}
+
+// runLocal transforms the JSON items read from stdin and writes them to stdout,
+// without connecting to any cluster.
+func runLocal(args []string) {
+	flags := flag.NewFlagSet("local", flag.ExitOnError)
+	rulesFile := flags.String("rules", "", "YAML file holding the pattern ConfigMaps to apply")
+	flags.Parse(args)
+
+	logger := logrus.New()
+	logger.SetOutput(os.Stderr)
+
+	if *rulesFile == "" {
+		logger.Fatal("--rules is required in local mode")
+	}
+	rules, err := os.Open(*rulesFile)
+	if err != nil {
+		logger.Fatalf("Failed to open rules: %v", err)
+	}
+	defer rules.Close()
+
+	if err := plugin.RunLocal(rules, os.Stdin, os.Stdout, logger); err != nil {
+		logger.Fatal(err)
+	}
+}
+
+// runReplay re-runs the transformer chain on an item recorded by the plugin and
+// writes the result to stdout.
+func runReplay(args []string) {
+	logger := logrus.New()
+	logger.SetOutput(os.Stderr)
+
+	if len(args) != 1 {
+		logger.Fatal("usage: --replay <recording.json>")
+	}
+	recording, err := os.Open(args[0])
+	if err != nil {
+		logger.Fatalf("Failed to open recording: %v", err)
+	}
+	defer recording.Close()
+
+	if err := plugin.Replay(recording, os.Stdout, logger); err != nil {
+		logger.Fatal(err)
+	}
+}
+
+// runImport converts the transformation config of another tool, read from a
+// file or stdin, into pattern ConfigMaps written to stdout.
+func runImport(args []string) {
+	flags := flag.NewFlagSet("import", flag.ExitOnError)
+	prefix := flags.String("name", "imported", "prefix of the names of the generated ConfigMaps")
+	flags.Parse(args)
+
+	logger := logrus.New()
+	logger.SetOutput(os.Stderr)
+
+	if flags.NArg() < 1 || flags.NArg() > 2 {
+		logger.Fatalf("usage: --import [--name <prefix>] <%s|%s|%s> [file]", plugin.ImportK10, plugin.ImportCrane, plugin.ImportKustomize)
+	}
+	in := os.Stdin
+	if flags.NArg() == 2 {
+		file, err := os.Open(flags.Arg(1))
+		if err != nil {
+			logger.Fatalf("Failed to open %s: %v", flags.Arg(1), err)
+		}
+		defer file.Close()
+		in = file
+	}
+
+	if err := plugin.Import(flags.Arg(0), in, os.Stdout, *prefix, logger); err != nil {
+		logger.Fatal(err)
+	}
+}
+
+// runCapabilities writes the capabilities of the engine to stdout, as JSON.
+func runCapabilities() {
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(plugin.GetCapabilities()); err != nil {
+		logrus.Fatalf("Failed to write the capabilities: %v", err)
+	}
+}
@@ -0,0 +1,309 @@
+// Package contract generates and checks contract tests of a rule bundle: cases
+// pairing an input object with the output the rules are expected to produce.
+// Checked in CI with go test, they prove that every rule is exercised, and
+// regenerated after a rule change, they show its effect as a reviewable diff
+// of the expected outputs:
+//
+//	func TestContracts(t *testing.T) {
+//		contract.Run(t, "rules.yaml", "contracts.yaml")
+//	}
+package contract
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"sort"
+	"testing"
+	"text/template"
+
+	"github.com/sirupsen/logrus"
+	"github.com/wrkt/velero-custom-plugins/internal/fixtures"
+	"github.com/wrkt/velero-custom-plugins/internal/plugin"
+	"github.com/wrkt/velero-custom-plugins/pkg/transform"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/yaml"
+)
+
+// CarrierAnnotation holds the pattern of a generated case on the fixtures
+// that carry it.
+const CarrierAnnotation = "contract.agoracalyce.io/value"
+
+// Case is a contract: the rules turn Input into Expected, or exclude it from
+// restore.
+type Case struct {
+	Name string `json:"name"`
+	// Generated is set on the cases Generate made, which it replaces; the
+	// others are written by hand and kept
+	Generated bool                   `json:"generated,omitempty"`
+	Input     map[string]interface{} `json:"input"`
+	Expected  map[string]interface{} `json:"expected,omitempty"`
+	Excluded  bool                   `json:"excluded,omitempty"`
+}
+
+// Generate returns one case per literal pattern of rules, after the cases of
+// existing written by hand, their expectations refreshed. The input of a
+// generated case is the first object holding the pattern whose copy the rules
+// change: a ConfigMap, else a fixture annotated with it. Generate also returns
+// the rules no case was generated for: the patterns no such object exercises,
+// such as those restricted to some fields, and the ConfigMaps of other
+// transformers, which need cases written by hand.
+func Generate(rules []corev1.ConfigMap, existing []Case, logger logrus.FieldLogger) ([]Case, []string, error) {
+	chain, err := newChain(rules, logger)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var cases []Case
+	for _, c := range existing {
+		if c.Generated {
+			continue
+		}
+		if c.Expected, c.Excluded, err = apply(chain, c.Input); err != nil {
+			return nil, nil, fmt.Errorf("case %s: %v", c.Name, err)
+		}
+		cases = append(cases, c)
+	}
+
+	sorted := append([]corev1.ConfigMap{}, rules...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Name < sorted[j].Name })
+	var unexercised []string
+	for _, rule := range sorted {
+		patterns := plugin.LiteralPatterns(rule)
+		if patterns == nil {
+			unexercised = append(unexercised, rule.Name)
+			continue
+		}
+		names := make([]string, 0, len(patterns))
+		for pattern := range patterns {
+			names = append(names, pattern)
+		}
+		sort.Strings(names)
+		for _, pattern := range names {
+			c, ok, err := generate(chain, pattern)
+			if err != nil {
+				return nil, nil, fmt.Errorf("pattern %q of %s: %v", pattern, rule.Name, err)
+			}
+			if !ok {
+				unexercised = append(unexercised, rule.Name+"/"+pattern)
+				continue
+			}
+			c.Name = rule.Name + "/" + pattern
+			cases = append(cases, c)
+		}
+	}
+	return cases, unexercised, nil
+}
+
+// generate returns the case of the first carrier of pattern whose copy of the
+// pattern the rules change, and false when they change none.
+func generate(chain *transform.Chain, pattern string) (Case, bool, error) {
+	for _, carrier := range carriers(pattern) {
+		expected, excluded, err := apply(chain, carrier.object)
+		if err != nil {
+			return Case{}, false, err
+		}
+		if value, _, _ := unstructured.NestedString(expected, carrier.path...); value != pattern {
+			return Case{Generated: true, Input: normalize(carrier.object), Expected: expected, Excluded: excluded}, true, nil
+		}
+	}
+	return Case{}, false, nil
+}
+
+// carrier is an object holding a pattern at path.
+type carrier struct {
+	object map[string]interface{}
+	path   []string
+}
+
+// carriers returns the objects holding pattern a case may start from, simplest
+// first.
+func carriers(pattern string) []carrier {
+	carriers := []carrier{{
+		object: map[string]interface{}{
+			"apiVersion": "v1",
+			"kind":       "ConfigMap",
+			"metadata":   map[string]interface{}{"name": "contract", "namespace": "contract"},
+			"data":       map[string]interface{}{"value": pattern},
+		},
+		path: []string{"data", "value"},
+	}}
+	for _, name := range fixtures.Names() {
+		fixture := fixtures.MustLoad(name)
+		annotations := fixture.GetAnnotations()
+		if annotations == nil {
+			annotations = make(map[string]string)
+		}
+		annotations[CarrierAnnotation] = pattern
+		fixture.SetAnnotations(annotations)
+		carriers = append(carriers, carrier{object: fixture.Object, path: []string{"metadata", "annotations", CarrierAnnotation}})
+	}
+	return carriers
+}
+
+// Check applies rules to the input of each case, and returns an error per case
+// whose result is not the expected one.
+func Check(rules []corev1.ConfigMap, cases []Case, logger logrus.FieldLogger) ([]error, error) {
+	chain, err := newChain(rules, logger)
+	if err != nil {
+		return nil, err
+	}
+	var failures []error
+	for _, c := range cases {
+		if err := check(chain, c); err != nil {
+			failures = append(failures, fmt.Errorf("case %s: %v", c.Name, err))
+		}
+	}
+	return failures, nil
+}
+
+func check(chain *transform.Chain, c Case) error {
+	output, excluded, err := apply(chain, c.Input)
+	if err != nil {
+		return err
+	}
+	if excluded != c.Excluded {
+		return fmt.Errorf("excluded is %t, expected %t", excluded, c.Excluded)
+	}
+	if expected := normalize(c.Expected); !reflect.DeepEqual(expected, output) {
+		got, _ := yaml.Marshal(output)
+		want, _ := yaml.Marshal(expected)
+		return fmt.Errorf("unexpected output:\n%s\nexpected:\n%s", got, want)
+	}
+	return nil
+}
+
+// Run checks the cases of casesFile against the rules of rulesFile, one
+// subtest per case.
+func Run(t *testing.T, rulesFile, casesFile string) {
+	t.Helper()
+	rules, err := readRules(rulesFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file, err := os.Open(casesFile)
+	if err != nil {
+		t.Fatalf("failed to open the cases: %v", err)
+	}
+	defer file.Close()
+	cases, err := ReadCases(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	chain, err := newChain(rules, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range cases {
+		c := c
+		t.Run(c.Name, func(t *testing.T) {
+			if err := check(chain, c); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+// ReadCases decodes the YAML or JSON list of cases of r.
+func ReadCases(r io.Reader) ([]Case, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the cases: %v", err)
+	}
+	var cases []Case
+	if err := yaml.UnmarshalStrict(data, &cases); err != nil {
+		return nil, fmt.Errorf("failed to parse the cases: %v", err)
+	}
+	return cases, nil
+}
+
+// WriteCases encodes cases as a YAML list.
+func WriteCases(w io.Writer, cases []Case) error {
+	data, err := yaml.Marshal(cases)
+	if err != nil {
+		return fmt.Errorf("failed to encode the cases: %v", err)
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+var testFile = template.Must(template.New("test").Parse(`// Code generated by replace-pattern-contracts. DO NOT EDIT.
+
+package {{ .Package }}
+
+import (
+	"testing"
+
+	"github.com/wrkt/velero-custom-plugins/pkg/contract"
+)
+
+func TestContracts(t *testing.T) {
+	contract.Run(t, {{ printf "%q" .Rules }}, {{ printf "%q" .Cases }})
+}
+`))
+
+// TestFile returns the source of a Go test file of package pkg running the
+// cases of casesFile against the rules of rulesFile, relative to the package.
+func TestFile(pkg, rulesFile, casesFile string) []byte {
+	var b bytes.Buffer
+	testFile.Execute(&b, struct{ Package, Rules, Cases string }{pkg, rulesFile, casesFile})
+	return b.Bytes()
+}
+
+func readRules(name string) ([]corev1.ConfigMap, error) {
+	file, err := os.Open(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open the rules: %v", err)
+	}
+	defer file.Close()
+	return transform.LoadRules(file)
+}
+
+// newChain returns the chain applying rules as a restore without Restore
+// object would, without the original identity annotations that would make
+// every case change.
+func newChain(rules []corev1.ConfigMap, logger logrus.FieldLogger) (*transform.Chain, error) {
+	return transform.New(rules, transform.Options{SkipOrigin: true, Logger: logger})
+}
+
+// apply returns the normalized output of the rules on a copy of input, and
+// whether they exclude it.
+func apply(chain *transform.Chain, input map[string]interface{}) (map[string]interface{}, bool, error) {
+	data, err := json.Marshal(input)
+	if err != nil {
+		return nil, false, fmt.Errorf("invalid input: %v", err)
+	}
+	// decoded the way Velero hands items to the plugin
+	item := &unstructured.Unstructured{}
+	if err := item.UnmarshalJSON(data); err != nil {
+		return nil, false, fmt.Errorf("invalid input: %v", err)
+	}
+	result, err := chain.Apply(item)
+	if err != nil {
+		return nil, false, err
+	}
+	return normalize(result.Object.Object), result.Excluded, nil
+}
+
+// normalize returns object as decoded from YAML, so that objects compare
+// whatever the types of their numbers.
+func normalize(object map[string]interface{}) map[string]interface{} {
+	if object == nil {
+		return nil
+	}
+	data, err := json.Marshal(object)
+	if err != nil {
+		return object
+	}
+	var normalized map[string]interface{}
+	if err := yaml.Unmarshal(data, &normalized); err != nil {
+		return object
+	}
+	return normalized
+}
@@ -0,0 +1,152 @@
+package contract
+
+import (
+	"bytes"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wrkt/velero-custom-plugins/pkg/transform"
+	corev1 "k8s.io/api/core/v1"
+)
+
+const rules = `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: hosts
+  labels:
+    agoracalyce.io/replace-pattern: RestoreItemAction
+data:
+  example.com: dr.example.com
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: images
+  labels:
+    agoracalyce.io/replace-pattern: RestoreItemAction
+  annotations:
+    agoracalyce.io/resources: Deployment
+data:
+  registry.prod: registry.dr
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: replicas
+  labels:
+    agoracalyce.io/replace-pattern: RestoreItemAction
+  annotations:
+    agoracalyce.io/paths: spec.replicas
+data:
+  three: one
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: cleanup
+  labels:
+    agoracalyce.io/replace-pattern: RestoreItemAction
+  annotations:
+    agoracalyce.io/transformer: jq
+data:
+  filter.jq: .
+`
+
+func loadRules(t *testing.T, data string) []corev1.ConfigMap {
+	configMaps, err := transform.LoadRules(strings.NewReader(data))
+	require.NoError(t, err)
+	return configMaps
+}
+
+func TestGenerate(t *testing.T) {
+	configMaps := loadRules(t, rules)
+	cases, unexercised, err := Generate(configMaps, nil, logrus.New())
+	require.NoError(t, err)
+	assert.Equal(t, []string{"cleanup", "replicas/three"}, unexercised)
+	require.Len(t, cases, 2)
+
+	assert.Equal(t, "hosts/example.com", cases[0].Name)
+	assert.True(t, cases[0].Generated)
+	assert.Equal(t, "ConfigMap", cases[0].Input["kind"], "the simplest carrier first")
+	assert.Equal(t, map[string]interface{}{"value": "dr.example.com"}, cases[0].Expected["data"])
+
+	assert.Equal(t, "images/registry.prod", cases[1].Name)
+	assert.Equal(t, "Deployment", cases[1].Input["kind"], "a fixture of a kind the rules apply to")
+	annotations := cases[1].Expected["metadata"].(map[string]interface{})["annotations"].(map[string]interface{})
+	assert.Equal(t, "registry.dr", annotations[CarrierAnnotation])
+
+	failures, err := Check(configMaps, cases, logrus.New())
+	require.NoError(t, err)
+	assert.Empty(t, failures)
+
+	// a rule change breaks the contract until the cases are regenerated
+	changed := loadRules(t, strings.Replace(rules, "example.com: dr.example.com", "example.com: example.org", 1))
+	failures, err = Check(changed, cases, logrus.New())
+	require.NoError(t, err)
+	require.Len(t, failures, 2, "the fixture of the other case holds the pattern too")
+	assert.ErrorContains(t, failures[0], "case hosts/example.com: unexpected output")
+}
+
+func TestGenerate_HandWritten(t *testing.T) {
+	configMaps := loadRules(t, rules)
+	handWritten := Case{
+		Name: "cleanup/service",
+		Input: map[string]interface{}{
+			"apiVersion": "v1",
+			"kind":       "Service",
+			"metadata":   map[string]interface{}{"name": "web", "namespace": "shop"},
+			"spec":       map[string]interface{}{"externalName": "web.example.com"},
+		},
+		Expected: map[string]interface{}{"stale": true},
+	}
+	stale := Case{Name: "hosts/removed", Generated: true}
+	cases, _, err := Generate(configMaps, []Case{handWritten, stale}, logrus.New())
+	require.NoError(t, err)
+
+	require.Len(t, cases, 3)
+	assert.Equal(t, "cleanup/service", cases[0].Name, "hand-written cases are kept, first")
+	assert.Equal(t, "web.dr.example.com", cases[0].Expected["spec"].(map[string]interface{})["externalName"], "their expectations refreshed")
+	assert.Equal(t, "hosts/example.com", cases[1].Name, "generated cases are replaced")
+}
+
+func TestCases_RoundTrip(t *testing.T) {
+	cases, _, err := Generate(loadRules(t, rules), nil, logrus.New())
+	require.NoError(t, err)
+
+	var b bytes.Buffer
+	require.NoError(t, WriteCases(&b, cases))
+	read, err := ReadCases(&b)
+	require.NoError(t, err)
+	assert.Equal(t, cases, read)
+
+	_, err = ReadCases(strings.NewReader("- name: x\n  inputs: {}\n"))
+	assert.ErrorContains(t, err, "failed to parse the cases")
+}
+
+func TestRun(t *testing.T) {
+	dir := t.TempDir()
+	rulesFile, casesFile := filepath.Join(dir, "rules.yaml"), filepath.Join(dir, "contracts.yaml")
+	require.NoError(t, os.WriteFile(rulesFile, []byte(rules), 0o600))
+	cases, _, err := Generate(loadRules(t, rules), nil, logrus.New())
+	require.NoError(t, err)
+	var b bytes.Buffer
+	require.NoError(t, WriteCases(&b, cases))
+	require.NoError(t, os.WriteFile(casesFile, b.Bytes(), 0o600))
+
+	Run(t, rulesFile, casesFile)
+}
+
+func TestTestFile(t *testing.T) {
+	source := TestFile("contracts", "rules.yaml", "testdata/contracts.yaml")
+	file, err := parser.ParseFile(token.NewFileSet(), "contracts_test.go", source, 0)
+	require.NoError(t, err)
+	assert.Equal(t, "contracts", file.Name.Name)
+	assert.Contains(t, string(source), `contract.Run(t, "rules.yaml", "testdata/contracts.yaml")`)
+}
@@ -0,0 +1,152 @@
+package sanitize
+
+import (
+	"regexp"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// serverMetadata lists the metadata fields set by the API server.
+var serverMetadata = []string{
+	"uid",
+	"resourceVersion",
+	"generation",
+	"creationTimestamp",
+	"deletionTimestamp",
+	"deletionGracePeriodSeconds",
+	"managedFields",
+	"selfLink",
+}
+
+// Metadata removes the metadata fields set by the API server.
+func Metadata(obj *unstructured.Unstructured) {
+	for _, field := range serverMetadata {
+		unstructured.RemoveNestedField(obj.Object, "metadata", field)
+	}
+}
+
+// Status removes the status.
+func Status(obj *unstructured.Unstructured) {
+	unstructured.RemoveNestedField(obj.Object, "status")
+}
+
+// serviceAccountTokenVolume matches the token volumes the service account
+// admission plugin adds to Pods.
+var serviceAccountTokenVolume = regexp.MustCompile(`^kube-api-access-[a-z0-9]{5}$`)
+
+// Pod removes the node the Pod was scheduled to, and the service account
+// token volume added at admission, which is added again on creation.
+func Pod(obj *unstructured.Unstructured) {
+	unstructured.RemoveNestedField(obj.Object, "spec", "nodeName")
+
+	spec, ok := obj.Object["spec"].(map[string]interface{})
+	if !ok {
+		return
+	}
+	removeEntries(spec, "volumes", func(volume map[string]interface{}) bool {
+		name, _ := volume["name"].(string)
+		return serviceAccountTokenVolume.MatchString(name)
+	})
+	for _, containers := range []string{"initContainers", "containers", "ephemeralContainers"} {
+		list, _ := spec[containers].([]interface{})
+		for _, container := range list {
+			if c, ok := container.(map[string]interface{}); ok {
+				removeEntries(c, "volumeMounts", func(mount map[string]interface{}) bool {
+					name, _ := mount["name"].(string)
+					return serviceAccountTokenVolume.MatchString(name)
+				})
+			}
+		}
+	}
+}
+
+// Service removes the IPs allocated by the cluster, except for headless
+// Services whose clusterIP None is part of their definition, and the health
+// check node port allocated for LoadBalancer Services.
+func Service(obj *unstructured.Unstructured) {
+	if clusterIP, _, _ := unstructured.NestedString(obj.Object, "spec", "clusterIP"); clusterIP != "None" {
+		unstructured.RemoveNestedField(obj.Object, "spec", "clusterIP")
+		unstructured.RemoveNestedField(obj.Object, "spec", "clusterIPs")
+	}
+	unstructured.RemoveNestedField(obj.Object, "spec", "healthCheckNodePort")
+}
+
+// ServiceAccount removes the references to the legacy token Secrets generated
+// for the ServiceAccount, which are generated again under other names.
+func ServiceAccount(obj *unstructured.Unstructured) {
+	prefix := obj.GetName() + "-token-"
+	removeEntries(obj.Object, "secrets", func(secret map[string]interface{}) bool {
+		name, _ := secret["name"].(string)
+		return strings.HasPrefix(name, prefix)
+	})
+}
+
+// pvcBindingAnnotations are set by the persistent volume controller and the
+// scheduler when binding a claim.
+var pvcBindingAnnotations = []string{
+	"pv.kubernetes.io/bind-completed",
+	"pv.kubernetes.io/bound-by-controller",
+	"volume.kubernetes.io/selected-node",
+}
+
+// PersistentVolumeClaim removes the annotations of the binding to a volume
+// and a node of the source cluster.
+func PersistentVolumeClaim(obj *unstructured.Unstructured) {
+	removeAnnotations(obj, pvcBindingAnnotations...)
+}
+
+// Deployment removes the revision annotation maintained by the controller.
+func Deployment(obj *unstructured.Unstructured) {
+	removeAnnotations(obj, "deployment.kubernetes.io/revision")
+}
+
+// jobControllerLabels are set by the Job controller from the uid of the Job.
+var jobControllerLabels = []string{"controller-uid", "batch.kubernetes.io/controller-uid"}
+
+// Job removes the selector and pod labels generated from the uid of the Job,
+// which the API server rejects on a Job of another uid.
+func Job(obj *unstructured.Unstructured) {
+	if manual, _, _ := unstructured.NestedBool(obj.Object, "spec", "manualSelector"); manual {
+		return
+	}
+	unstructured.RemoveNestedField(obj.Object, "spec", "selector")
+	for _, label := range jobControllerLabels {
+		unstructured.RemoveNestedField(obj.Object, "spec", "template", "metadata", "labels", label)
+	}
+}
+
+// removeEntries removes the object entries of the list at key of parent for
+// which remove returns true, deleting the list when it becomes empty.
+func removeEntries(parent map[string]interface{}, key string, remove func(map[string]interface{}) bool) {
+	list, ok := parent[key].([]interface{})
+	if !ok {
+		return
+	}
+	kept := make([]interface{}, 0, len(list))
+	for _, entry := range list {
+		if object, ok := entry.(map[string]interface{}); ok && remove(object) {
+			continue
+		}
+		kept = append(kept, entry)
+	}
+	if len(kept) == 0 {
+		delete(parent, key)
+		return
+	}
+	parent[key] = kept
+}
+
+func removeAnnotations(obj *unstructured.Unstructured, keys ...string) {
+	annotations := obj.GetAnnotations()
+	if annotations == nil {
+		return
+	}
+	for _, key := range keys {
+		delete(annotations, key)
+	}
+	if len(annotations) == 0 {
+		annotations = nil
+	}
+	obj.SetAnnotations(annotations)
+}
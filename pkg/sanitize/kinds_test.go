@@ -0,0 +1,155 @@
+package sanitize
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func object(obj map[string]interface{}) *unstructured.Unstructured {
+	return &unstructured.Unstructured{Object: obj}
+}
+
+func TestMetadata(t *testing.T) {
+	obj := object(map[string]interface{}{"metadata": map[string]interface{}{
+		"name":              "web",
+		"namespace":         "apps",
+		"labels":            map[string]interface{}{"app": "web"},
+		"ownerReferences":   []interface{}{map[string]interface{}{"name": "owner"}},
+		"uid":               "1234",
+		"resourceVersion":   "42",
+		"generation":        int64(3),
+		"creationTimestamp": "2024-01-01T00:00:00Z",
+		"managedFields":     []interface{}{},
+		"selfLink":          "/api/v1/namespaces/apps/pods/web",
+	}})
+	Metadata(obj)
+	assert.Equal(t, map[string]interface{}{
+		"name":            "web",
+		"namespace":       "apps",
+		"labels":          map[string]interface{}{"app": "web"},
+		"ownerReferences": []interface{}{map[string]interface{}{"name": "owner"}},
+	}, obj.Object["metadata"])
+}
+
+func TestStatus(t *testing.T) {
+	obj := object(map[string]interface{}{"spec": map[string]interface{}{}, "status": map[string]interface{}{"phase": "Running"}})
+	Status(obj)
+	assert.Equal(t, map[string]interface{}{"spec": map[string]interface{}{}}, obj.Object)
+}
+
+func TestPod(t *testing.T) {
+	obj := object(map[string]interface{}{"kind": "Pod", "spec": map[string]interface{}{
+		"nodeName": "node-1",
+		"volumes": []interface{}{
+			map[string]interface{}{"name": "data"},
+			map[string]interface{}{"name": "kube-api-access-x7k2p"},
+		},
+		"containers": []interface{}{
+			map[string]interface{}{"name": "app", "volumeMounts": []interface{}{
+				map[string]interface{}{"name": "data"},
+				map[string]interface{}{"name": "kube-api-access-x7k2p"},
+			}},
+			map[string]interface{}{"name": "sidecar", "volumeMounts": []interface{}{
+				map[string]interface{}{"name": "kube-api-access-x7k2p"},
+			}},
+		},
+	}})
+	Pod(obj)
+	assert.Equal(t, map[string]interface{}{
+		"volumes": []interface{}{map[string]interface{}{"name": "data"}},
+		"containers": []interface{}{
+			map[string]interface{}{"name": "app", "volumeMounts": []interface{}{map[string]interface{}{"name": "data"}}},
+			map[string]interface{}{"name": "sidecar"},
+		},
+	}, obj.Object["spec"])
+}
+
+func TestService(t *testing.T) {
+	obj := object(map[string]interface{}{"kind": "Service", "spec": map[string]interface{}{
+		"type":                "LoadBalancer",
+		"clusterIP":           "10.0.0.1",
+		"clusterIPs":          []interface{}{"10.0.0.1"},
+		"healthCheckNodePort": int64(31000),
+	}})
+	Service(obj)
+	assert.Equal(t, map[string]interface{}{"type": "LoadBalancer"}, obj.Object["spec"])
+
+	headless := object(map[string]interface{}{"kind": "Service", "spec": map[string]interface{}{
+		"clusterIP":  "None",
+		"clusterIPs": []interface{}{"None"},
+	}})
+	Service(headless)
+	assert.Equal(t, map[string]interface{}{"clusterIP": "None", "clusterIPs": []interface{}{"None"}}, headless.Object["spec"])
+}
+
+func TestServiceAccount(t *testing.T) {
+	obj := object(map[string]interface{}{
+		"kind":     "ServiceAccount",
+		"metadata": map[string]interface{}{"name": "app"},
+		"secrets": []interface{}{
+			map[string]interface{}{"name": "app-token-abcde"},
+			map[string]interface{}{"name": "registry"},
+		},
+	})
+	ServiceAccount(obj)
+	assert.Equal(t, []interface{}{map[string]interface{}{"name": "registry"}}, obj.Object["secrets"])
+
+	obj = object(map[string]interface{}{
+		"kind":     "ServiceAccount",
+		"metadata": map[string]interface{}{"name": "app"},
+		"secrets":  []interface{}{map[string]interface{}{"name": "app-token-abcde"}},
+	})
+	ServiceAccount(obj)
+	assert.NotContains(t, obj.Object, "secrets")
+}
+
+func TestPersistentVolumeClaim(t *testing.T) {
+	obj := object(map[string]interface{}{"kind": "PersistentVolumeClaim"})
+	obj.SetAnnotations(map[string]string{
+		"pv.kubernetes.io/bind-completed":      "yes",
+		"pv.kubernetes.io/bound-by-controller": "yes",
+		"volume.kubernetes.io/selected-node":   "node-1",
+		"example.com/owner":                    "team",
+	})
+	PersistentVolumeClaim(obj)
+	assert.Equal(t, map[string]string{"example.com/owner": "team"}, obj.GetAnnotations())
+
+	obj.SetAnnotations(map[string]string{"volume.kubernetes.io/selected-node": "node-1"})
+	PersistentVolumeClaim(obj)
+	assert.Nil(t, obj.GetAnnotations())
+}
+
+func TestDeployment(t *testing.T) {
+	obj := object(map[string]interface{}{"kind": "Deployment"})
+	obj.SetAnnotations(map[string]string{"deployment.kubernetes.io/revision": "7", "example.com/owner": "team"})
+	Deployment(obj)
+	assert.Equal(t, map[string]string{"example.com/owner": "team"}, obj.GetAnnotations())
+}
+
+func TestJob(t *testing.T) {
+	job := func(manualSelector bool) *unstructured.Unstructured {
+		return object(map[string]interface{}{"kind": "Job", "spec": map[string]interface{}{
+			"manualSelector": manualSelector,
+			"selector":       map[string]interface{}{"matchLabels": map[string]interface{}{"controller-uid": "1234"}},
+			"template": map[string]interface{}{"metadata": map[string]interface{}{"labels": map[string]interface{}{
+				"controller-uid":                     "1234",
+				"batch.kubernetes.io/controller-uid": "1234",
+				"job-name":                           "migrate",
+			}}},
+		}})
+	}
+
+	obj := job(false)
+	Job(obj)
+	assert.Equal(t, map[string]interface{}{
+		"manualSelector": false,
+		"template":       map[string]interface{}{"metadata": map[string]interface{}{"labels": map[string]interface{}{"job-name": "migrate"}}},
+	}, obj.Object["spec"])
+
+	// a manual selector is part of the definition of the Job
+	obj = job(true)
+	Job(obj)
+	assert.Equal(t, job(true), obj)
+}
@@ -0,0 +1,62 @@
+// Package sanitize removes from Kubernetes objects the fields that are
+// generated by the cluster they were read from, and must not or need not be
+// restored: server-set metadata, status, and kind-specific fields such as the
+// node of a Pod or the cluster IP of a Service.
+//
+// The package only depends on apimachinery, so that other Velero plugins can
+// import it. Its API is stable: new kinds and fields may be sanitized by the
+// default Registry, existing functions keep their signature.
+package sanitize
+
+import (
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// Func sanitizes an object in place.
+type Func func(obj *unstructured.Unstructured)
+
+// Registry holds the sanitizers applied to every object, and to the objects
+// of each kind.
+type Registry struct {
+	common []Func
+	kinds  map[schema.GroupKind][]Func
+}
+
+// NewRegistry returns a registry applying common to every object, and
+// nothing else.
+func NewRegistry(common ...Func) *Registry {
+	return &Registry{common: common, kinds: make(map[schema.GroupKind][]Func)}
+}
+
+// Default returns a new registry with the sanitizers of this package: Metadata
+// and Status for every object, and the kind-specific ones. The registry may be
+// extended by the caller.
+func Default() *Registry {
+	r := NewRegistry(Metadata, Status)
+	r.Register(schema.GroupKind{Kind: "Pod"}, Pod)
+	r.Register(schema.GroupKind{Kind: "Service"}, Service)
+	r.Register(schema.GroupKind{Kind: "ServiceAccount"}, ServiceAccount)
+	r.Register(schema.GroupKind{Kind: "PersistentVolumeClaim"}, PersistentVolumeClaim)
+	r.Register(schema.GroupKind{Group: "apps", Kind: "Deployment"}, Deployment)
+	r.Register(schema.GroupKind{Group: "batch", Kind: "Job"}, Job)
+	return r
+}
+
+// Register adds sanitizers for the objects of a kind, after the ones already
+// registered.
+func (r *Registry) Register(gk schema.GroupKind, fns ...Func) {
+	r.kinds[gk] = append(r.kinds[gk], fns...)
+}
+
+// Sanitize returns a sanitized copy of obj. The common sanitizers run first.
+func (r *Registry) Sanitize(obj *unstructured.Unstructured) *unstructured.Unstructured {
+	out := obj.DeepCopy()
+	for _, fn := range r.common {
+		fn(out)
+	}
+	for _, fn := range r.kinds[out.GroupVersionKind().GroupKind()] {
+		fn(out)
+	}
+	return out
+}
@@ -0,0 +1,53 @@
+package sanitize
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func TestRegistry(t *testing.T) {
+	var calls []string
+	registry := NewRegistry(func(*unstructured.Unstructured) { calls = append(calls, "common") })
+	widget := schema.GroupKind{Group: "example.com", Kind: "Widget"}
+	registry.Register(widget, func(obj *unstructured.Unstructured) {
+		calls = append(calls, "first")
+		unstructured.RemoveNestedField(obj.Object, "spec", "generated")
+	})
+	registry.Register(widget, func(*unstructured.Unstructured) { calls = append(calls, "second") })
+
+	obj := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "example.com/v1",
+		"kind":       "Widget",
+		"spec":       map[string]interface{}{"generated": "x", "size": int64(3)},
+	}}
+	original := obj.DeepCopy()
+
+	sanitized := registry.Sanitize(obj)
+	assert.Equal(t, []string{"common", "first", "second"}, calls)
+	assert.Equal(t, map[string]interface{}{"size": int64(3)}, sanitized.Object["spec"])
+	assert.Equal(t, original, obj)
+
+	// other groups of the same kind are not sanitized
+	calls = nil
+	registry.Sanitize(&unstructured.Unstructured{Object: map[string]interface{}{"apiVersion": "other.com/v1", "kind": "Widget"}})
+	assert.Equal(t, []string{"common"}, calls)
+}
+
+func TestDefault(t *testing.T) {
+	service := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "Service",
+		"metadata":   map[string]interface{}{"name": "web", "uid": "1234", "resourceVersion": "42"},
+		"spec":       map[string]interface{}{"clusterIP": "10.0.0.1", "ports": []interface{}{map[string]interface{}{"port": int64(80)}}},
+		"status":     map[string]interface{}{"loadBalancer": map[string]interface{}{}},
+	}}
+	assert.Equal(t, map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "Service",
+		"metadata":   map[string]interface{}{"name": "web"},
+		"spec":       map[string]interface{}{"ports": []interface{}{map[string]interface{}{"port": int64(80)}}},
+	}, Default().Sanitize(service).Object)
+}
@@ -0,0 +1,139 @@
+// Package transform applies the rules of the replace-pattern restore plugin to
+// Kubernetes objects outside of Velero, so that custom operators, admission
+// webhooks or CI checks rewrite objects exactly as a restore would.
+//
+// Rules are the pattern and transformer ConfigMaps the plugin reads from the
+// velero namespace, loaded from a cluster with ListRules or from files with
+// LoadRules. A Chain applies them to one object at a time:
+//
+//	rules, err := transform.ListRules(ctx, clientset.CoreV1(), "velero")
+//	...
+//	chain, err := transform.New(rules, transform.Options{Discovery: clientset.Discovery()})
+//	...
+//	result, err := chain.Apply(obj)
+//
+// A Chain is safe for concurrent use. Like the plugin during a restore, it
+// disables a transformer that keeps failing; create a new Chain to reset it.
+package transform
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/sirupsen/logrus"
+	velerov1 "github.com/vmware-tanzu/velero/pkg/apis/velero/v1"
+	"github.com/wrkt/velero-custom-plugins/internal/plugin"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/discovery"
+	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
+)
+
+// RulesSelector is the label selector of the rule ConfigMaps.
+const RulesSelector = plugin.RulesSelector
+
+// ListRules returns the rule ConfigMaps of a namespace, velero for the plugin.
+func ListRules(ctx context.Context, client corev1client.ConfigMapsGetter, namespace string) ([]corev1.ConfigMap, error) {
+	list, err := client.ConfigMaps(namespace).List(ctx, metav1.ListOptions{LabelSelector: RulesSelector})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list rules: %v", err)
+	}
+	return list.Items, nil
+}
+
+// LoadRules decodes the ConfigMaps of a multi-document YAML or JSON stream,
+// ignoring other kinds. It fails when there is none.
+func LoadRules(r io.Reader) ([]corev1.ConfigMap, error) {
+	return plugin.ReadConfigMaps(r)
+}
+
+// BundleAnnotation on a rule ConfigMap names the version of the rule bundle
+// it belongs to.
+const BundleAnnotation = plugin.RulesVersionAnnotation
+
+// SelectBundle returns the rules of a bundle version. It fails when there is
+// none.
+func SelectBundle(rules []corev1.ConfigMap, version string) ([]corev1.ConfigMap, error) {
+	var selected []corev1.ConfigMap
+	for _, rule := range rules {
+		if rule.Annotations[BundleAnnotation] == version {
+			selected = append(selected, rule)
+		}
+	}
+	if len(selected) == 0 {
+		return nil, fmt.Errorf("no rule ConfigMap of bundle %s", version)
+	}
+	return selected, nil
+}
+
+// Validate returns the errors of the rule ConfigMaps, one per ConfigMap the
+// plugin would ignore or fail to build: invalid annotations, regexes or
+// transformer configurations. Rules are valid when it returns none.
+func Validate(rules []corev1.ConfigMap) []error {
+	return plugin.ValidateRules(rules)
+}
+
+// Options configures a Chain. The zero value applies the rules as a restore
+// without any Restore object would, in local mode.
+type Options struct {
+	// Restore, when set, provides the namespace mapping, the label selectors
+	// rules may be restricted to, and the rules pin.
+	Restore *velerov1.Restore
+	// Discovery resolves the resources named in the agoracalyce.io/resources
+	// annotation. Without it, only kinds are understood.
+	Discovery discovery.ServerResourcesInterface
+	// SkipOrigin leaves out the agoracalyce.io/original-* annotations
+	// recording the identity objects had in the backup.
+	SkipOrigin bool
+	// Logger receives the logs of the transformers, the standard logger when
+	// nil.
+	Logger logrus.FieldLogger
+}
+
+// Chain applies rules to objects.
+type Chain struct {
+	engine *plugin.Engine
+}
+
+// New returns a chain applying rules. It fails when Options.Restore pins
+// other rules.
+func New(rules []corev1.ConfigMap, opts Options) (*Chain, error) {
+	logger := opts.Logger
+	if logger == nil {
+		logger = logrus.StandardLogger()
+	}
+	// a nil Discovery must reach the engine as a nil interface
+	var lister interface {
+		ServerPreferredResources() ([]*metav1.APIResourceList, error)
+	}
+	if opts.Discovery != nil {
+		lister = opts.Discovery
+	}
+	engine, err := plugin.NewEngine(rules, opts.Restore, lister, logger)
+	if err != nil {
+		return nil, err
+	}
+	if opts.SkipOrigin {
+		engine.SkipOrigin()
+	}
+	return &Chain{engine: engine}, nil
+}
+
+// Result is the outcome of the rules on an object.
+type Result struct {
+	// Object is the transformed object.
+	Object *unstructured.Unstructured
+	// Excluded tells that the rules exclude the object from restore.
+	Excluded bool
+}
+
+// Apply transforms a copy of obj.
+func (c *Chain) Apply(obj *unstructured.Unstructured) (Result, error) {
+	output, excluded, err := c.engine.Transform(obj)
+	if err != nil {
+		return Result{}, err
+	}
+	return Result{Object: output, Excluded: excluded}, nil
+}
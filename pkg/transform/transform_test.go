@@ -0,0 +1,142 @@
+package transform
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	velerov1 "github.com/vmware-tanzu/velero/pkg/apis/velero/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+const rules = `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: hosts
+  namespace: velero
+  labels:
+    agoracalyce.io/replace-pattern: RestoreItemAction
+  annotations:
+    agoracalyce.io/exclude-labels: dr.example.com/skip
+data:
+  example.com: dr.example.com
+`
+
+func TestChain(t *testing.T) {
+	configMaps, err := LoadRules(strings.NewReader(rules))
+	require.NoError(t, err)
+	chain, err := New(configMaps, Options{Logger: logrus.New()})
+	require.NoError(t, err)
+
+	ingress := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "networking.k8s.io/v1",
+		"kind":       "Ingress",
+		"metadata":   map[string]interface{}{"name": "web", "namespace": "shop"},
+		"spec":       map[string]interface{}{"rules": []interface{}{map[string]interface{}{"host": "web.example.com"}}},
+	}}
+	original := ingress.DeepCopy()
+
+	result, err := chain.Apply(ingress)
+	require.NoError(t, err)
+	assert.False(t, result.Excluded)
+	host, _, _ := unstructured.NestedSlice(result.Object.Object, "spec", "rules")
+	assert.Equal(t, "web.dr.example.com", host[0].(map[string]interface{})["host"])
+	assert.Equal(t, original, ingress)
+
+	ingress.SetLabels(map[string]string{"dr.example.com/skip": "true"})
+	result, err = chain.Apply(ingress)
+	require.NoError(t, err)
+	assert.True(t, result.Excluded)
+}
+
+func TestNew_RulesPin(t *testing.T) {
+	configMaps, err := LoadRules(strings.NewReader(rules))
+	require.NoError(t, err)
+	restore := &velerov1.Restore{ObjectMeta: metav1.ObjectMeta{
+		Name:        "dr-1",
+		Annotations: map[string]string{"agoracalyce.io/rules-pin": "2024.05"},
+	}}
+	_, err = New(configMaps, Options{Restore: restore})
+	assert.ErrorContains(t, err, "pins the rules to version 2024.05")
+}
+
+func TestListRules(t *testing.T) {
+	client := fake.NewSimpleClientset(
+		&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{
+			Name:      "hosts",
+			Namespace: "velero",
+			Labels:    map[string]string{"agoracalyce.io/replace-pattern": "RestoreItemAction"},
+		}},
+		&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "other", Namespace: "velero"}},
+	)
+	configMaps, err := ListRules(context.Background(), client.CoreV1(), "velero")
+	require.NoError(t, err)
+	require.Len(t, configMaps, 1)
+	assert.Equal(t, "hosts", configMaps[0].Name)
+}
+
+func TestSelectBundle(t *testing.T) {
+	configMaps := []corev1.ConfigMap{
+		{ObjectMeta: metav1.ObjectMeta{Name: "a", Annotations: map[string]string{BundleAnnotation: "2024.05"}}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "b", Annotations: map[string]string{BundleAnnotation: "2024.04"}}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "c"}},
+	}
+	selected, err := SelectBundle(configMaps, "2024.05")
+	require.NoError(t, err)
+	assert.Equal(t, configMaps[:1], selected)
+
+	_, err = SelectBundle(configMaps, "2023.01")
+	assert.EqualError(t, err, "no rule ConfigMap of bundle 2023.01")
+}
+
+func TestValidate(t *testing.T) {
+	valid, err := LoadRules(strings.NewReader(rules))
+	require.NoError(t, err)
+	assert.Empty(t, Validate(valid))
+
+	invalid, err := LoadRules(strings.NewReader(`apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: versions
+  annotations:
+    agoracalyce.io/transformer: regex
+data:
+  patterns.yaml: |
+    - regex: 'v(?=1)'
+      replacement: v2
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: structured
+data:
+  rules.yaml: |
+    rules:
+    - name: images
+      type: regex
+      pattern: 'registry\.(a|b)'
+      replacement: registry.$2
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: late
+  annotations:
+    agoracalyce.io/priority: high
+data:
+  a: b
+`))
+	require.NoError(t, err)
+	errs := Validate(append(valid, invalid...))
+	require.Len(t, errs, 3)
+	assert.ErrorContains(t, errs[0], "ConfigMap structured: rule images: invalid replacement")
+	assert.ErrorContains(t, errs[1], "ConfigMap versions: invalid regex")
+	assert.ErrorContains(t, errs[1], "lookahead and lookbehind assertions are not supported")
+	assert.ErrorContains(t, errs[2], "ConfigMap late: invalid agoracalyce.io/priority annotation")
+}